@@ -10,7 +10,6 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
-	"sync"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -45,23 +44,22 @@ type JSONDir struct {
 type serviceAccount struct {
 	name   string
 	config *jwt.Config
-
-	mu sync.Mutex
-	t  *oauth2.Token
+	t      *cachedToken
 }
 
 type defaultServiceAccount struct {
 	scopes []string
-	mu     sync.Mutex
-	cred   *google.Credentials
-	t      *oauth2.Token
+	t      *cachedToken
 }
 
 // New creates new account by loading json file in the dir.
 // if name is "default", returns default service account instead.
 func (j JSONDir) New(name string) (Account, error) {
 	if name == "default" {
-		return &defaultServiceAccount{scopes: j.Scopes}, nil
+		return &defaultServiceAccount{
+			scopes: j.Scopes,
+			t:      tokens.get(newTokenKey(name, j.Scopes)),
+		}, nil
 	}
 	keyFile := filepath.Join(j.Dir, name+".json")
 	jsonKey, err := ioutil.ReadFile(keyFile)
@@ -75,6 +73,7 @@ func (j JSONDir) New(name string) (Account, error) {
 	return &serviceAccount{
 		name:   name,
 		config: config,
+		t:      tokens.get(newTokenKey(name+"/"+config.Email, j.Scopes)),
 	}, nil
 }
 
@@ -93,18 +92,12 @@ func (sa *serviceAccount) Equals(other Account) bool {
 	return reflect.DeepEqual(sa.config, osa.config)
 }
 
-// Token generates new oauth2 token.
+// Token returns oauth2 token.
+// Token is refreshed in background before it expires.
 func (sa *serviceAccount) Token(ctx context.Context) (*oauth2.Token, error) {
-	sa.mu.Lock()
-	defer sa.mu.Unlock()
-	if !sa.t.Valid() {
-		var err error
-		sa.t, err = sa.config.TokenSource(ctx).Token()
-		if err != nil {
-			return nil, err
-		}
-	}
-	return sa.t, nil
+	return sa.t.token(ctx, func(ctx context.Context) (*oauth2.Token, error) {
+		return sa.config.TokenSource(ctx).Token()
+	})
 }
 
 // Equals checks other account has same default service account.
@@ -116,25 +109,18 @@ func (sa *defaultServiceAccount) Equals(other Account) bool {
 	return ok
 }
 
-// Token generates new oauth2 token.
+// Token returns oauth2 token.
+// Token is refreshed in background before it expires.
 func (sa *defaultServiceAccount) Token(ctx context.Context) (*oauth2.Token, error) {
-	sa.mu.Lock()
-	defer sa.mu.Unlock()
-	if sa.cred == nil {
-		var err error
-		sa.cred, err = google.FindDefaultCredentials(ctx, sa.scopes...)
+	return sa.t.token(ctx, func(ctx context.Context) (*oauth2.Token, error) {
+		// credentials' token source reuses token until it expires,
+		// so find credentials again to mint new token.
+		cred, err := google.FindDefaultCredentials(ctx, sa.scopes...)
 		if err != nil {
 			return nil, err
 		}
-	}
-	if !sa.t.Valid() {
-		var err error
-		sa.t, err = sa.cred.TokenSource.Token()
-		if err != nil {
-			return nil, err
-		}
-	}
-	return sa.t, nil
+		return cred.TokenSource.Token()
+	})
 }
 
 // TODO: provide another account pool using SignJWT
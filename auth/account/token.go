@@ -0,0 +1,150 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package account
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"go.chromium.org/goma/server/log"
+)
+
+const (
+	// refreshAhead is duration before token expiry to refresh
+	// token in background.
+	refreshAhead = 5 * time.Minute
+
+	// refreshJitter is max random jitter added to refreshAhead,
+	// so accounts minted at the same time won't refresh at once.
+	refreshJitter = 2 * time.Minute
+
+	// refreshRetry is duration to retry background refresh
+	// after failure.
+	refreshRetry = 30 * time.Second
+
+	// refreshTimeout is timeout of background refresh.
+	refreshTimeout = 1 * time.Minute
+)
+
+// tokenKey is a key of shared token cache.
+type tokenKey struct {
+	account string
+	scopes  string
+}
+
+func newTokenKey(account string, scopes []string) tokenKey {
+	return tokenKey{
+		account: account,
+		scopes:  strings.Join(scopes, " "),
+	}
+}
+
+// tokenCache is a token cache shared by accounts, so account
+// recreated for the same (account, scopes), e.g. by ACL update,
+// reuses token minted before.
+type tokenCache struct {
+	mu sync.Mutex
+	m  map[tokenKey]*cachedToken
+}
+
+var tokens = &tokenCache{
+	m: make(map[tokenKey]*cachedToken),
+}
+
+func (c *tokenCache) get(key tokenKey) *cachedToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.m[key]
+	if !ok {
+		t = &cachedToken{}
+		c.m[key] = t
+	}
+	return t
+}
+
+// cachedToken is a token refreshed ahead of its expiry.
+type cachedToken struct {
+	// now is for testing.
+	now func() time.Time
+
+	mu         sync.Mutex
+	t          *oauth2.Token
+	refreshAt  time.Time
+	refreshing bool
+}
+
+func (ct *cachedToken) timeNow() time.Time {
+	if ct.now != nil {
+		return ct.now()
+	}
+	return time.Now()
+}
+
+// token returns cached token, or mints token by fetch if no valid token
+// is cached. If cached token will expire soon, it refreshes the token
+// in background, and returns the cached token without waiting.
+func (ct *cachedToken) token(ctx context.Context, fetch func(context.Context) (*oauth2.Token, error)) (*oauth2.Token, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.t.Valid() {
+		// zero refreshAt means the token never expires.
+		if !ct.refreshing && !ct.refreshAt.IsZero() && !ct.timeNow().Before(ct.refreshAt) {
+			ct.refreshing = true
+			go ct.refresh(log.FromContext(ctx), fetch)
+		}
+		return ct.t, nil
+	}
+	t, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ct.set(t)
+	return t, nil
+}
+
+func (ct *cachedToken) refresh(logger log.Logger, fetch func(context.Context) (*oauth2.Token, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+	t, err := fetch(ctx)
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.refreshing = false
+	if err != nil {
+		logger.Warnf("refresh token: %v", err)
+		ct.refreshAt = ct.timeNow().Add(refreshRetry)
+		return
+	}
+	ct.set(t)
+}
+
+// set sets token t. ct.mu must be held.
+func (ct *cachedToken) set(t *oauth2.Token) {
+	ct.t = t
+	if t.Expiry.IsZero() {
+		ct.refreshAt = time.Time{}
+		return
+	}
+	jitter := time.Duration(rand.Int63n(int64(refreshJitter)))
+	ct.refreshAt = t.Expiry.Add(-refreshAhead - jitter)
+}
+
+// Prefetch mints token for a in background, so the first request
+// using a won't wait for token minting.
+func Prefetch(ctx context.Context, a Account) {
+	logger := log.FromContext(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		_, err := a.Token(ctx)
+		if err != nil {
+			logger.Warnf("prefetch token: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestCachedTokenRefreshAhead(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	ct := &cachedToken{
+		now: func() time.Time { return now },
+	}
+
+	var mu sync.Mutex
+	n := 0
+	fetched := make(chan struct{}, 10)
+	var fetchErr error
+	fetch := func(ctx context.Context) (*oauth2.Token, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		defer func() { fetched <- struct{}{} }()
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		n++
+		return &oauth2.Token{
+			AccessToken: fmt.Sprintf("token%d", n),
+			Expiry:      time.Now().Add(time.Hour),
+		}, nil
+	}
+
+	tok, err := ct.token(ctx, fetch)
+	if err != nil || tok.AccessToken != "token1" {
+		t.Fatalf("token()=%v, %v; want token1, nil", tok, err)
+	}
+	<-fetched
+
+	tok, err = ct.token(ctx, fetch)
+	if err != nil || tok.AccessToken != "token1" {
+		t.Errorf("token()=%v, %v; want cached token1, nil", tok, err)
+	}
+
+	// near expiry, it returns cached token, and refreshes in background.
+	now = now.Add(time.Hour - refreshAhead)
+	tok, err = ct.token(ctx, fetch)
+	if err != nil || tok.AccessToken != "token1" {
+		t.Errorf("token() near expiry=%v, %v; want cached token1, nil", tok, err)
+	}
+	<-fetched
+	// wait refresh to set token.
+	for i := 0; ; i++ {
+		ct.mu.Lock()
+		refreshing := ct.refreshing
+		ct.mu.Unlock()
+		if !refreshing {
+			break
+		}
+		if i > 100 {
+			t.Fatal("refresh not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tok, err = ct.token(ctx, fetch)
+	if err != nil || tok.AccessToken != "token2" {
+		t.Errorf("token() after refresh=%v, %v; want token2, nil", tok, err)
+	}
+
+	// invalid token is fetched synchronously.
+	ct.mu.Lock()
+	ct.t = &oauth2.Token{
+		AccessToken: "expired",
+		Expiry:      time.Now().Add(-time.Minute),
+	}
+	ct.mu.Unlock()
+	mu.Lock()
+	fetchErr = errors.New("mint error")
+	mu.Unlock()
+	_, err = ct.token(ctx, fetch)
+	if err == nil {
+		t.Errorf("token() with mint error=_, nil; want error")
+	}
+	<-fetched
+}
+
+func TestTokenCacheShared(t *testing.T) {
+	c := &tokenCache{
+		m: make(map[tokenKey]*cachedToken),
+	}
+	scopes := []string{"https://www.googleapis.com/auth/cloud-platform"}
+	t1 := c.get(newTokenKey("sa", scopes))
+	t2 := c.get(newTokenKey("sa", scopes))
+	if t1 != t2 {
+		t.Errorf("get(sa)=%p, %p; want same", t1, t2)
+	}
+	t3 := c.get(newTokenKey("sa", append(scopes, "https://www.googleapis.com/auth/userinfo.email")))
+	if t1 == t3 {
+		t.Errorf("get(sa) with different scopes=%p; want different from %p", t3, t1)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -74,6 +75,7 @@ func (c *Checker) Set(ctx context.Context, config *pb.ACL) error {
 		}
 		logger.Infof("service account %s: update", g.ServiceAccount)
 		c.accounts[g.ServiceAccount] = sa
+		account.Prefetch(ctx, sa)
 	}
 	for sa := range c.accounts {
 		if !seen[sa] {
@@ -86,6 +88,29 @@ func (c *Checker) Set(ctx context.Context, config *pb.ACL) error {
 	return nil
 }
 
+// CheckServiceAccounts checks tokens of all service accounts
+// in the config can be minted.
+func (c *Checker) CheckServiceAccounts(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var names []string
+	for name := range c.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []string
+	for _, name := range names {
+		_, err := c.accounts[name].Token(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("service account %s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 var errNoMatchingGroup = errors.New("no matching group")
 
 // FindGroup finds a group for tokenInfo.
@@ -17,6 +17,13 @@ import (
 // Client is authdb client.
 type Client struct {
 	*httprpc.Client
+
+	// Retry is retry policy of calls to authdb.
+	// It is overridden by rpc policy of rpc.ServiceAuthDB, if set.
+	Retry rpc.Retry
+
+	// Breaker fails calls fast while authdb is down, if set.
+	Breaker *rpc.CircuitBreaker
 }
 
 // IsMember checks email is in group.
@@ -28,8 +35,13 @@ func (c Client) IsMember(ctx context.Context, email, group string) (bool, error)
 		Group: group,
 	}
 	resp := &pb.CheckMembershipResp{}
-	err := rpc.Retry{}.Do(ctx, func() error {
-		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	policy := rpc.PolicyFor(rpc.ServiceAuthDB)
+	retry := policy.RetryOr(c.Retry)
+	retry.Breaker = c.Breaker
+	retry.Target = c.Client.URL
+	timeout := policy.TimeoutOr(3 * time.Second)
+	err := retry.Do(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 		return c.Client.Call(ctx, req, resp)
 	})
@@ -22,6 +22,8 @@ import (
 
 	"go.chromium.org/goma/server/auth/enduser"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/log/redact"
+	"go.chromium.org/goma/server/metrics"
 	authpb "go.chromium.org/goma/server/proto/auth"
 	"go.chromium.org/goma/server/rpc"
 )
@@ -41,13 +43,22 @@ var (
 		{
 			Name:        "go.chromium.org/goma/server/auth.auth_by_account",
 			Description: "auth request count by account",
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				accountKey,
 				authErrKey,
-			},
+			),
 			Measure:     authRequests,
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        "go.chromium.org/goma/server/auth.clock-skew",
+			Description: "token validations affected by clock skew",
+			TagKeys: []tag.Key{
+				clockSkewKey,
+			},
+			Measure:     clockSkews,
+			Aggregation: view.Count(),
+		},
 	}
 )
 
@@ -67,6 +78,9 @@ type authInfo struct {
 	err error
 	mu  sync.Mutex // protect resp.Quota
 
+	// tolerance of clock skew between auth server and this server.
+	clockSkew time.Duration
+
 	// TODO: define type to avoid email leak in logging.
 	resp *authpb.AuthResp
 }
@@ -108,9 +122,9 @@ func (ai *authInfo) Check(ctx context.Context) error {
 	}
 
 	expiresAt := ai.expiresAt()
-	now := time.Now()
-	if expiresAt.Before(now) {
-		logger.Warnf("auth.Check %v because token was expired at %v", ErrExpired, expiresAt)
+	err := checkTokenTime(ctx, "token", time.Time{}, expiresAt, time.Now(), ai.clockSkew)
+	if err != nil {
+		logger.Warnf("auth.Check %v: %v", ErrExpired, err)
 		return ErrExpired
 	}
 
@@ -130,10 +144,27 @@ type Auth struct {
 	Client authpb.AuthServiceClient
 	Retry  rpc.Retry
 
+	// ClockSkew is tolerance of clock skew between auth server and
+	// this server, in checking expiration of tokens.
+	// DefaultClockSkew if zero, no tolerance if negative.
+	ClockSkew time.Duration
+
+	// Credentials optionally verifies requests signed by credentials
+	// issued by Enroll, to protect them from replay.
+	// If it is set, credential used as bearer token without request
+	// signature is rejected.
+	Credentials *Credentials
+
+	// Nonces is nonce cache for signed requests.
+	// If it is not set, MemoryNonceCache is used.
+	Nonces NonceCache
+
 	sg    singleflight.Group
 	mu    sync.Mutex
 	cache map[string]*authInfo
 
+	nonces *MemoryNonceCache
+
 	runAt func(time.Time, func())
 }
 
@@ -158,6 +189,14 @@ func (a *Auth) Check(ctx context.Context, req *http.Request) (*enduser.EndUser,
 		logger.Warnf("no authorization header")
 		return nil, ErrNoAuthHeader
 	}
+	if a.Credentials != nil {
+		var err error
+		authorization, err = a.verifyRequest(ctx, req, authorization)
+		if err != nil {
+			logger.Warnf("auth request: %v", err)
+			return nil, err
+		}
+	}
 	a.mu.Lock()
 	if a.cache == nil {
 		a.cache = make(map[string]*authInfo)
@@ -167,7 +206,9 @@ func (a *Auth) Check(ctx context.Context, req *http.Request) (*enduser.EndUser,
 	if !ok {
 		v, err, _ := a.sg.Do(authorization, func() (interface{}, error) {
 			logger.Debugf("first call for %s...", authorization[:len(authorization)/3])
-			ai := &authInfo{}
+			ai := &authInfo{
+				clockSkew: clockSkew(a.ClockSkew),
+			}
 			err := a.Retry.Do(ctx, func() error {
 				var err error
 				ai.resp, err = a.Client.Auth(ctx, &authpb.AuthReq{
@@ -207,6 +248,28 @@ func (a *Auth) Check(ctx context.Context, req *http.Request) (*enduser.EndUser,
 	return enduser.New(ai.resp.Email, ai.resp.GroupId, token), nil
 }
 
+// verifyRequest verifies request signed by credential, and returns
+// authorization with the credential. Other authorization is returned
+// as is.
+func (a *Auth) verifyRequest(ctx context.Context, req *http.Request, authorization string) (string, error) {
+	if !isSignedRequest(authorization) {
+		if token, err := parseToken(authorization); err == nil && isCredential(token.AccessToken) {
+			return "", fmt.Errorf("%w: credential without request signature", ErrRequestSignature)
+		}
+		return authorization, nil
+	}
+	nonces := a.Nonces
+	if nonces == nil {
+		a.mu.Lock()
+		if a.nonces == nil {
+			a.nonces = &MemoryNonceCache{}
+		}
+		nonces = a.nonces
+		a.mu.Unlock()
+	}
+	return a.Credentials.VerifyRequest(ctx, req, nonces, time.Now())
+}
+
 // Auth authenticates the requests and returns new context with enduser info.
 func (a *Auth) Auth(ctx context.Context, req *http.Request) (context.Context, error) {
 	u, err := a.Check(ctx, req)
@@ -214,6 +277,7 @@ func (a *Auth) Auth(ctx context.Context, req *http.Request) (context.Context, er
 	if err != nil {
 		return ctx, err
 	}
+	ctx = metrics.WithGroup(ctx, u.Group)
 	return enduser.NewContext(ctx, u), nil
 }
 
@@ -229,6 +293,8 @@ func recordAuth(ctx context.Context, u *enduser.EndUser, err error) {
 		tags = append(tags, tag.Upsert(authErrKey, "expired"))
 	case errors.Is(err, ErrOverQuota):
 		tags = append(tags, tag.Upsert(authErrKey, "over-quota"))
+	case errors.Is(err, ErrRequestSignature):
+		tags = append(tags, tag.Upsert(authErrKey, "request-signature"))
 	case err == nil:
 		tags = append(tags, tag.Upsert(authErrKey, "ok"))
 	default:
@@ -237,7 +303,7 @@ func recordAuth(ctx context.Context, u *enduser.EndUser, err error) {
 	if u == nil || string(u.Email) == "" {
 		tags = append(tags, tag.Upsert(accountKey, "unauthenticated"))
 	} else if strings.HasSuffix(string(u.Email), ".iam.gserviceaccount.com") {
-		tags = append(tags, tag.Upsert(accountKey, string(u.Email)))
+		tags = append(tags, tag.Upsert(accountKey, redact.Identity(string(u.Email))))
 	} else {
 		// TODO: record personal account for user migration (need privacy review).
 		tags = append(tags, tag.Upsert(accountKey, "not-service-account"))
@@ -280,6 +280,10 @@ func (d dummyClient) Auth(ctx context.Context, req *authpb.AuthReq, opts ...grpc
 	return d.auth(ctx, req)
 }
 
+func (d dummyClient) Enroll(ctx context.Context, req *authpb.EnrollReq, opts ...grpc.CallOption) (*authpb.EnrollResp, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "enroll is not supported")
+}
+
 func TestAuthCheck(t *testing.T) {
 	// TODO: better to check the error code?
 	// Currently, the test does not check Check returns what error code,
@@ -436,3 +440,102 @@ func TestAuthInfoString(t *testing.T) {
 		t.Errorf(`fmt.Sprintf("...", ai)=%s; leak email address`, got)
 	}
 }
+
+func TestAuthInfoCheckClockSkew(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		desc      string
+		expiresAt time.Time
+		clockSkew time.Duration
+		err       error
+	}{
+		{
+			desc:      "expired within tolerance",
+			expiresAt: time.Now().Add(-10 * time.Second),
+			clockSkew: DefaultClockSkew,
+		},
+		{
+			desc:      "expired marginally beyond tolerance",
+			expiresAt: time.Now().Add(-DefaultClockSkew - time.Minute),
+			clockSkew: DefaultClockSkew,
+			err:       ErrExpired,
+		},
+		{
+			desc:      "expired without tolerance",
+			expiresAt: time.Now().Add(-10 * time.Second),
+			err:       ErrExpired,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ai := authInfo{
+				clockSkew: tc.clockSkew,
+				resp: &authpb.AuthResp{
+					ExpiresAt: timestamppb.New(tc.expiresAt),
+					Email:     "example@google.com",
+					Quota:     -1,
+				},
+			}
+			err := ai.Check(ctx)
+			if err != tc.err {
+				t.Errorf("ai.Check()=%v; want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCheckTokenTime(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for _, tc := range []struct {
+		desc      string
+		issuedAt  time.Time
+		expiresAt time.Time
+		wantErr   bool
+	}{
+		{
+			desc:      "valid",
+			issuedAt:  now.Add(-time.Minute),
+			expiresAt: now.Add(time.Hour),
+		},
+		{
+			desc:      "no issued at",
+			expiresAt: now.Add(time.Hour),
+		},
+		{
+			desc:      "issued in the future within tolerance",
+			issuedAt:  now.Add(10 * time.Second),
+			expiresAt: now.Add(time.Hour),
+		},
+		{
+			desc:      "issued in the future marginally",
+			issuedAt:  now.Add(time.Minute),
+			expiresAt: now.Add(time.Hour),
+			wantErr:   true,
+		},
+		{
+			desc:      "issued in the far future",
+			issuedAt:  now.Add(time.Hour),
+			expiresAt: now.Add(2 * time.Hour),
+			wantErr:   true,
+		},
+		{
+			desc:      "expired within tolerance",
+			expiresAt: now.Add(-10 * time.Second),
+		},
+		{
+			desc:      "expired marginally",
+			expiresAt: now.Add(-time.Minute),
+			wantErr:   true,
+		},
+		{
+			desc:      "expired long ago",
+			expiresAt: now.Add(-time.Hour),
+			wantErr:   true,
+		},
+	} {
+		err := checkTokenTime(ctx, "token", tc.issuedAt, tc.expiresAt, now, DefaultClockSkew)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: checkTokenTime=%v; want err=%t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
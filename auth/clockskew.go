@@ -0,0 +1,98 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// DefaultClockSkew is default tolerance of clock skew in validation of
+// token's expiration and issued time.
+const DefaultClockSkew = 30 * time.Second
+
+// marginalClockSkew is how long beyond the tolerance a validation failure
+// is considered as marginal, i.e. likely caused by clock skew rather
+// than really expired token.
+const marginalClockSkew = 5 * time.Minute
+
+var (
+	clockSkews = stats.Int64(
+		"go.chromium.org/goma/server/auth.clock-skew",
+		"Number of token validations affected by clock skew",
+		stats.UnitDimensionless)
+
+	// clockSkewKey is one of
+	//  tolerated-exp: token expired within tolerance, and accepted.
+	//  tolerated-iat: token issued in the future within tolerance, and accepted.
+	//  rejected-exp: token expired marginally beyond tolerance.
+	//  rejected-iat: token issued in the future marginally beyond tolerance.
+	clockSkewKey = tag.MustNewKey("clock_skew")
+)
+
+// clockSkew returns tolerance of clock skew for skew config.
+// zero means DefaultClockSkew, and negative means no tolerance.
+func clockSkew(skew time.Duration) time.Duration {
+	switch {
+	case skew == 0:
+		return DefaultClockSkew
+	case skew < 0:
+		return 0
+	}
+	return skew
+}
+
+// checkTokenTime checks token issued at issuedAt and expires at expiresAt
+// is valid at now, with tolerance of clock skew.
+// Zero issuedAt is not checked.
+// It warns and records metrics if the token is tolerated, or is rejected
+// marginally, so that clock skew (e.g. NTP drift) doesn't surface only
+// as intermittent authentication errors.
+func checkTokenTime(ctx context.Context, kind string, issuedAt, expiresAt, now time.Time, skew time.Duration) error {
+	logger := log.FromContext(ctx)
+	if !issuedAt.IsZero() && issuedAt.After(now) {
+		d := issuedAt.Sub(now)
+		switch {
+		case d <= skew:
+			logger.Warnf("%s issued %s in the future at %s, tolerated: check clock skew (NTP)", kind, d, issuedAt)
+			recordClockSkew(ctx, "tolerated-iat")
+		case d <= skew+marginalClockSkew:
+			logger.Warnf("%s issued %s in the future at %s, beyond clock skew tolerance %s: check clock skew (NTP)", kind, d, issuedAt, skew)
+			recordClockSkew(ctx, "rejected-iat")
+			return fmt.Errorf("%s issued in the future at %s (now %s): clock skew?", kind, issuedAt, now)
+		default:
+			return fmt.Errorf("%s issued in the future at %s (now %s)", kind, issuedAt, now)
+		}
+	}
+	if now.Before(expiresAt) {
+		return nil
+	}
+	d := now.Sub(expiresAt)
+	switch {
+	case d < skew:
+		logger.Warnf("%s expired %s ago at %s, tolerated: check clock skew (NTP)", kind, d, expiresAt)
+		recordClockSkew(ctx, "tolerated-exp")
+		return nil
+	case d < skew+marginalClockSkew:
+		logger.Warnf("%s expired %s ago at %s, beyond clock skew tolerance %s: check clock skew (NTP)", kind, d, expiresAt, skew)
+		recordClockSkew(ctx, "rejected-exp")
+		return fmt.Errorf("%s expired at %s (now %s): clock skew?", kind, expiresAt, now)
+	}
+	return fmt.Errorf("%s expired at %s", kind, expiresAt)
+}
+
+func recordClockSkew(ctx context.Context, v string) {
+	logger := log.FromContext(ctx)
+	err := stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(clockSkewKey, v)}, clockSkews.M(1))
+	if err != nil {
+		logger.Errorf("failed to record metrics: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultCredentialTTL is default lifetime of credential issued by Credentials.
+const DefaultCredentialTTL = 1 * time.Hour
+
+// credentialPrefix is prefix of credential to distinguish it from
+// OAuth2 access token.
+const credentialPrefix = "goma-cred."
+
+// Credentials issues and verifies short-lived credentials for bots
+// enrolled with OAuth2 access token.
+//
+// Credential is email and audience of the access token with expiration
+// time, signed by HMAC-SHA256, so that any auth server sharing the keys
+// can verify it without tokeninfo.
+type Credentials struct {
+	// Keys are HMAC keys. Keys[0] is used to sign new credentials,
+	// and all keys are used to verify credentials, so that keys can
+	// be rotated without invalidating issued credentials.
+	Keys [][]byte
+
+	// TTL is lifetime of credential. DefaultCredentialTTL if zero.
+	TTL time.Duration
+
+	// ClockSkew is tolerance of clock skew among auth servers sharing
+	// the keys. DefaultClockSkew if zero, no tolerance if negative.
+	ClockSkew time.Duration
+
+	// ReplayWindow is validity window of timestamp of signed request.
+	// DefaultReplayWindow if zero.
+	ReplayWindow time.Duration
+}
+
+type credentialPayload struct {
+	Email    string `json:"email"`
+	Audience string `json:"aud,omitempty"`
+	Expiry   int64  `json:"exp"`
+	IssuedAt int64  `json:"iat,omitempty"`
+}
+
+func isCredential(accessToken string) bool {
+	return strings.HasPrefix(accessToken, credentialPrefix)
+}
+
+func signCredential(key []byte, payload string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Issue issues new credential for tokenInfo at now.
+// It returns credential and its expiration time.
+func (c *Credentials) Issue(tokenInfo *TokenInfo, now time.Time) (string, time.Time, error) {
+	if len(c.Keys) == 0 {
+		return "", time.Time{}, errors.New("no credential keys")
+	}
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = DefaultCredentialTTL
+	}
+	expiresAt := now.Add(ttl).Truncate(time.Second)
+	b, err := json.Marshal(credentialPayload{
+		Email:    tokenInfo.Email,
+		Audience: tokenInfo.Audience,
+		Expiry:   expiresAt.Unix(),
+		IssuedAt: now.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return credentialPrefix + payload + "." + signCredential(c.Keys[0], payload), expiresAt, nil
+}
+
+// Verify verifies credential at now, and returns its token info.
+// Like tokeninfo, TokenInfo.Err is set if the credential is
+// invalid or expired, beyond tolerance of clock skew.
+func (c *Credentials) Verify(ctx context.Context, credential string, now time.Time) *TokenInfo {
+	if !isCredential(credential) {
+		return &TokenInfo{
+			Err: status.Errorf(codes.PermissionDenied, "not credential"),
+		}
+	}
+	s := strings.TrimPrefix(credential, credentialPrefix)
+	i := strings.LastIndex(s, ".")
+	if i < 0 {
+		return &TokenInfo{
+			Err: status.Errorf(codes.PermissionDenied, "malformed credential"),
+		}
+	}
+	payload, sig := s[:i], s[i+1:]
+	verified := false
+	for _, key := range c.Keys {
+		if hmac.Equal([]byte(sig), []byte(signCredential(key, payload))) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return &TokenInfo{
+			Err: status.Errorf(codes.PermissionDenied, "invalid credential signature"),
+		}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return &TokenInfo{
+			Err: status.Errorf(codes.PermissionDenied, "malformed credential payload: %v", err),
+		}
+	}
+	var p credentialPayload
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return &TokenInfo{
+			Err: status.Errorf(codes.PermissionDenied, "malformed credential payload: %v", err),
+		}
+	}
+	ti := &TokenInfo{
+		Email:     p.Email,
+		Audience:  p.Audience,
+		ExpiresAt: time.Unix(p.Expiry, 0),
+	}
+	var issuedAt time.Time
+	if p.IssuedAt != 0 {
+		issuedAt = time.Unix(p.IssuedAt, 0)
+	}
+	err = checkTokenTime(ctx, "credential", issuedAt, ti.ExpiresAt, now, clockSkew(c.ClockSkew))
+	if err != nil {
+		ti.Err = status.Error(codes.PermissionDenied, err.Error())
+	}
+	return ti
+}
+
+// ReadCredentialKeys reads credential keys from fname.
+// Each non-empty line of the file is a key, and lines starting
+// with '#' are ignored. The first key is used to sign credentials.
+func ReadCredentialKeys(fname string) ([][]byte, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, []byte(line))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no credential keys in %s", fname)
+	}
+	return keys, nil
+}
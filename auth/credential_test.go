@@ -0,0 +1,167 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authpb "go.chromium.org/goma/server/proto/auth"
+)
+
+func TestCredentials(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := &Credentials{
+		Keys: [][]byte{[]byte("key1")},
+	}
+	cred, expiresAt, err := c.Issue(&TokenInfo{
+		Email:    "bot@example.com",
+		Audience: "client-id",
+	}, now)
+	if err != nil {
+		t.Fatalf("Issue(...)=_, _, %v; want nil err", err)
+	}
+	if !isCredential(cred) {
+		t.Errorf("isCredential(%q)=false; want true", cred)
+	}
+	if want := now.Add(DefaultCredentialTTL).Truncate(time.Second); !expiresAt.Equal(want) {
+		t.Errorf("expiresAt=%s; want %s", expiresAt, want)
+	}
+
+	ti := c.Verify(ctx, cred, now)
+	if ti.Err != nil || ti.Email != "bot@example.com" || ti.Audience != "client-id" || !ti.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Verify(cred, now)=%v; want bot@example.com client-id %s", ti, expiresAt)
+	}
+
+	if ti := c.Verify(ctx, cred, expiresAt); ti.Err != nil {
+		t.Errorf("Verify(cred, expiresAt).Err=%v; want nil within clock skew tolerance", ti.Err)
+	}
+	if ti := c.Verify(ctx, cred, expiresAt.Add(DefaultClockSkew)); status.Code(ti.Err) != codes.PermissionDenied {
+		t.Errorf("Verify(cred, expiresAt+%s).Err=%v; want %v", DefaultClockSkew, ti.Err, codes.PermissionDenied)
+	}
+	strict := &Credentials{
+		Keys:      c.Keys,
+		ClockSkew: -1,
+	}
+	if ti := strict.Verify(ctx, cred, expiresAt); status.Code(ti.Err) != codes.PermissionDenied {
+		t.Errorf("strict.Verify(cred, expiresAt).Err=%v; want %v", ti.Err, codes.PermissionDenied)
+	}
+
+	// issued by auth server whose clock is ahead.
+	if ti := c.Verify(ctx, cred, now.Add(-DefaultClockSkew/2)); ti.Err != nil {
+		t.Errorf("Verify(cred, now-%s).Err=%v; want nil within clock skew tolerance", DefaultClockSkew/2, ti.Err)
+	}
+	if ti := c.Verify(ctx, cred, now.Add(-2*DefaultClockSkew)); status.Code(ti.Err) != codes.PermissionDenied {
+		t.Errorf("Verify(cred, now-%s).Err=%v; want %v", 2*DefaultClockSkew, ti.Err, codes.PermissionDenied)
+	}
+
+	// rotate keys.
+	rotated := &Credentials{
+		Keys: [][]byte{[]byte("key2"), []byte("key1")},
+	}
+	if ti := rotated.Verify(ctx, cred, now); ti.Err != nil {
+		t.Errorf("rotated.Verify(ctx, cred, now).Err=%v; want nil", ti.Err)
+	}
+	other := &Credentials{
+		Keys: [][]byte{[]byte("key2")},
+	}
+	if ti := other.Verify(ctx, cred, now); status.Code(ti.Err) != codes.PermissionDenied {
+		t.Errorf("other.Verify(ctx, cred, now).Err=%v; want %v", ti.Err, codes.PermissionDenied)
+	}
+
+	i := strings.LastIndex(cred, ".")
+	last := byte('A')
+	if cred[i-1] == last {
+		last = 'B'
+	}
+	tampered := cred[:i-1] + string(last) + cred[i:]
+	if ti := c.Verify(ctx, tampered, now); status.Code(ti.Err) != codes.PermissionDenied {
+		t.Errorf("Verify(tampered, now).Err=%v; want %v", ti.Err, codes.PermissionDenied)
+	}
+}
+
+func TestServiceEnroll(t *testing.T) {
+	ctx := context.Background()
+	fetchCount := 0
+	s := &Service{
+		CheckToken: func(ctx context.Context, token *oauth2.Token, tokenInfo *TokenInfo) (string, *oauth2.Token, error) {
+			switch tokenInfo.Email {
+			case "bot@example.com":
+				return "bots", &oauth2.Token{
+					AccessToken: "service-account-token",
+					TokenType:   "Bearer",
+				}, nil
+			case "user@example.com":
+				return "users", token, nil
+			}
+			return "", nil, status.Errorf(codes.PermissionDenied, "access rejected")
+		},
+		Credentials: &Credentials{
+			Keys: [][]byte{[]byte("key")},
+		},
+		fetchInfo: func(ctx context.Context, token *oauth2.Token) (*TokenInfo, error) {
+			fetchCount++
+			return &TokenInfo{
+				Email:     strings.TrimPrefix(token.AccessToken, "token-"),
+				ExpiresAt: time.Now().Add(1 * time.Hour),
+			}, nil
+		},
+		runAt: func(time.Time, func()) {},
+	}
+
+	resp, err := s.Enroll(ctx, &authpb.EnrollReq{
+		Authorization: "Bearer token-bot@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Enroll(bot)=_, %v; want nil err", err)
+	}
+	if resp.GroupId != "bots" || !isCredential(resp.Credential) {
+		t.Errorf("Enroll(bot)=%v; want credential for bots", resp)
+	}
+	if fetchCount != 1 {
+		t.Errorf("fetchCount=%d; want 1", fetchCount)
+	}
+
+	aresp, err := s.Auth(ctx, &authpb.AuthReq{
+		Authorization: "Bearer " + resp.Credential,
+	})
+	if err != nil {
+		t.Fatalf("Auth(credential)=_, %v; want nil err", err)
+	}
+	if aresp.Email != "bot@example.com" || aresp.GroupId != "bots" || aresp.ErrorDescription != "" {
+		t.Errorf("Auth(credential)=%v; want bot@example.com in bots", aresp)
+	}
+	if fetchCount != 1 {
+		t.Errorf("fetchCount=%d; want 1 (no tokeninfo for credential)", fetchCount)
+	}
+
+	_, err = s.Enroll(ctx, &authpb.EnrollReq{
+		Authorization: "Bearer " + resp.Credential,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Enroll(credential)=_, %v; want %v", err, codes.InvalidArgument)
+	}
+
+	_, err = s.Enroll(ctx, &authpb.EnrollReq{
+		Authorization: "Bearer token-user@example.com",
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Enroll(user)=_, %v; want %v", err, codes.FailedPrecondition)
+	}
+
+	_, err = s.Enroll(ctx, &authpb.EnrollReq{
+		Authorization: "Bearer token-other@example.com",
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Enroll(other)=_, %v; want %v", err, codes.PermissionDenied)
+	}
+}
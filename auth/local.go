@@ -20,3 +20,8 @@ func (c LocalClient) Auth(ctx context.Context, in *pb.AuthReq, opts ...grpc.Call
 	resp, err := c.Service.Auth(ctx, in)
 	return resp, err
 }
+
+func (c LocalClient) Enroll(ctx context.Context, in *pb.EnrollReq, opts ...grpc.CallOption) (*pb.EnrollResp, error) {
+	resp, err := c.Service.Enroll(ctx, in)
+	return resp, err
+}
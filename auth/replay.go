@@ -0,0 +1,225 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// Headers of signed request.
+//
+// Credential issued by Enroll is a bearer token, so anyone who captures
+// a request can replay it until the credential expires.
+// To protect it, client sends the credential without its signature
+// in authorization header, and signs each request with the signature
+// of the credential, which never goes on the wire after Enroll.
+// Signature of request covers method, path, SHA-256 digest of body,
+// timestamp and nonce, so the request can't be replayed outside of
+// the validity window, nor within the window once the nonce has been
+// seen, nor with other body.
+const (
+	// RequestTimestampHeader is unix time in seconds when the
+	// request is signed.
+	RequestTimestampHeader = "X-Goma-Timestamp"
+
+	// RequestNonceHeader is unique string of the request.
+	RequestNonceHeader = "X-Goma-Nonce"
+
+	// RequestSignatureHeader is signature of the request.
+	RequestSignatureHeader = "X-Goma-Signature"
+)
+
+// DefaultReplayWindow is default validity window of request timestamp.
+const DefaultReplayWindow = 5 * time.Minute
+
+// maxNonceLen is max length of nonce.
+const maxNonceLen = 64
+
+// ErrRequestSignature represents authentication failure due to
+// invalid signature, timestamp or nonce of signed request, or
+// credential used as bearer token without request signature.
+var ErrRequestSignature = errors.New("invalid request signature")
+
+// NonceCache remembers nonces of signed requests to detect replays.
+type NonceCache interface {
+	// Add adds key for ttl, and reports whether the key is new.
+	Add(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// DefaultNonceCacheMaxEntries is default max number of nonces
+// in MemoryNonceCache.
+const DefaultNonceCacheMaxEntries = 100000
+
+// MemoryNonceCache is in-memory NonceCache.
+// It only detects replays to the same server, and nonces evicted by
+// MaxEntries before its ttl are not detected. Use shared cache,
+// e.g. redis, for multiple servers.
+type MemoryNonceCache struct {
+	// MaxEntries is max number of nonces to keep.
+	// 0 means DefaultNonceCacheMaxEntries.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries *lru.Cache // key -> expire time.Time
+
+	// for test.
+	now func() time.Time
+}
+
+// Add adds key for ttl, and reports whether the key is new.
+func (c *MemoryNonceCache) Add(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		maxEntries := c.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = DefaultNonceCacheMaxEntries
+		}
+		c.entries = lru.New(maxEntries)
+	}
+	if v, ok := c.entries.Get(key); ok && now.Before(v.(time.Time)) {
+		return false, nil
+	}
+	c.entries.Add(key, now.Add(ttl))
+	return true, nil
+}
+
+// bodyDigest returns hex SHA-256 digest of req's body.
+// It reads the body, and resets req.Body to read the same content again.
+func bodyDigest(req *http.Request) (string, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	h := sha256.Sum256(body)
+	return hex.EncodeToString(h[:]), nil
+}
+
+func requestMessage(req *http.Request, timestamp, nonce string) (string, error) {
+	digest, err := bodyDigest(req)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{req.Method, req.URL.Path, digest, timestamp, nonce}, "\n"), nil
+}
+
+// SignRequest signs req at now with nonce, by credential issued by Enroll.
+// It sets authorization header with the credential without its signature,
+// and headers of signed request.
+func SignRequest(req *http.Request, credential, nonce string, now time.Time) error {
+	if !isCredential(credential) {
+		return errors.New("not credential")
+	}
+	if nonce == "" || len(nonce) > maxNonceLen {
+		return fmt.Errorf("nonce length must be in [1, %d]: %d", maxNonceLen, len(nonce))
+	}
+	i := strings.LastIndex(credential, ".")
+	if i < len(credentialPrefix) {
+		return errors.New("malformed credential")
+	}
+	unsigned, sig := credential[:i], credential[i+1:]
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	msg, err := requestMessage(req, timestamp, nonce)
+	if err != nil {
+		return fmt.Errorf("read body: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+unsigned)
+	req.Header.Set(RequestTimestampHeader, timestamp)
+	req.Header.Set(RequestNonceHeader, nonce)
+	req.Header.Set(RequestSignatureHeader, signCredential([]byte(sig), msg))
+	return nil
+}
+
+// isSignedRequest reports whether authorization is credential
+// without signature, i.e. request is signed by the credential.
+func isSignedRequest(authorization string) bool {
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	return isCredential(token) && !strings.Contains(strings.TrimPrefix(token, credentialPrefix), ".")
+}
+
+// VerifyRequest verifies signed request at now, and returns authorization
+// with the credential to be verified by Verify.
+// It rejects request whose timestamp is out of the validity window, or
+// whose nonce has been seen in nonces, with ErrRequestSignature.
+// It returns ErrInternal if nonces fails.
+func (c *Credentials) VerifyRequest(ctx context.Context, req *http.Request, nonces NonceCache, now time.Time) (string, error) {
+	authorization := req.Header.Get("Authorization")
+	if !isSignedRequest(authorization) {
+		return "", fmt.Errorf("%w: not signed request", ErrRequestSignature)
+	}
+	payload := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")), credentialPrefix)
+	timestamp := req.Header.Get(RequestTimestampHeader)
+	nonce := req.Header.Get(RequestNonceHeader)
+	sig := req.Header.Get(RequestSignatureHeader)
+	if timestamp == "" || nonce == "" || sig == "" {
+		return "", fmt.Errorf("%w: missing request signature headers", ErrRequestSignature)
+	}
+	if len(nonce) > maxNonceLen {
+		return "", fmt.Errorf("%w: too long nonce: %d", ErrRequestSignature, len(nonce))
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed timestamp %q: %v", ErrRequestSignature, timestamp, err)
+	}
+	window := c.ReplayWindow
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	signedAt := time.Unix(ts, 0)
+	if d := now.Sub(signedAt); d > window || d < -window {
+		return "", fmt.Errorf("%w: timestamp %s out of window %s at %s", ErrRequestSignature, signedAt, window, now)
+	}
+	msg, err := requestMessage(req, timestamp, nonce)
+	if err != nil {
+		return "", fmt.Errorf("%w: read body: %v", ErrRequestSignature, err)
+	}
+	var credSig string
+	for _, key := range c.Keys {
+		s := signCredential(key, payload)
+		if hmac.Equal([]byte(sig), []byte(signCredential([]byte(s), msg))) {
+			credSig = s
+			break
+		}
+	}
+	if credSig == "" {
+		return "", fmt.Errorf("%w: signature mismatch", ErrRequestSignature)
+	}
+	// nonce is per credential, and kept until timestamp is out of
+	// the window in either direction.
+	h := sha256.Sum256([]byte(payload))
+	ok, err := nonces.Add(ctx, hex.EncodeToString(h[:16])+":"+base64.RawURLEncoding.EncodeToString([]byte(nonce)), 2*window)
+	if err != nil {
+		return "", fmt.Errorf("%w: nonce cache: %v", ErrInternal, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: replayed nonce %q", ErrRequestSignature, nonce)
+	}
+	return "Bearer " + credentialPrefix + payload + "." + credSig, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	authpb "go.chromium.org/goma/server/proto/auth"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := &Credentials{
+		Keys: [][]byte{[]byte("key1")},
+	}
+	cred, _, err := c.Issue(&TokenInfo{
+		Email: "bot@example.com",
+	}, now)
+	if err != nil {
+		t.Fatalf("Issue(...)=_, _, %v; want nil err", err)
+	}
+	signedReq := func(t *testing.T, nonce string, signedAt time.Time) *http.Request {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/cxx-compiler-service/e/Exec", strings.NewReader("exec request"))
+		err := SignRequest(req, cred, nonce, signedAt)
+		if err != nil {
+			t.Fatalf("SignRequest(req, cred, %q, %s)=%v; want nil err", nonce, signedAt, err)
+		}
+		return req
+	}
+	nonces := &MemoryNonceCache{}
+
+	req := signedReq(t, "nonce1", now)
+	if got := req.Header.Get("Authorization"); got == "Bearer "+cred || !isSignedRequest(got) {
+		t.Errorf("Authorization=%q; want credential without signature", got)
+	}
+	authorization, err := c.VerifyRequest(ctx, req, nonces, now)
+	if err != nil || authorization != "Bearer "+cred {
+		t.Errorf("VerifyRequest(req, now)=%q, %v; want %q, nil", authorization, err, "Bearer "+cred)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil || string(body) != "exec request" {
+		t.Errorf("body after VerifyRequest=%q, %v; want %q, nil", body, err, "exec request")
+	}
+
+	t.Logf("replay")
+	_, err = c.VerifyRequest(ctx, req, nonces, now.Add(time.Second))
+	if !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("VerifyRequest(replayed req)=_, %v; want %v", err, ErrRequestSignature)
+	}
+
+	t.Logf("new nonce")
+	req = signedReq(t, "nonce2", now)
+	if _, err := c.VerifyRequest(ctx, req, nonces, now.Add(time.Second)); err != nil {
+		t.Errorf("VerifyRequest(req with new nonce)=_, %v; want nil err", err)
+	}
+
+	t.Logf("out of window")
+	for _, d := range []time.Duration{-DefaultReplayWindow - time.Second, DefaultReplayWindow + time.Second} {
+		req = signedReq(t, "nonce3", now.Add(d))
+		if _, err := c.VerifyRequest(ctx, req, nonces, now); !errors.Is(err, ErrRequestSignature) {
+			t.Errorf("VerifyRequest(req signed at now%+v)=_, %v; want %v", d, err, ErrRequestSignature)
+		}
+	}
+
+	t.Logf("tampered")
+	req = signedReq(t, "nonce4", now)
+	req.URL.Path = "/cxx-compiler-service/e/StoreFile"
+	if _, err := c.VerifyRequest(ctx, req, nonces, now); !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("VerifyRequest(req with other path)=_, %v; want %v", err, ErrRequestSignature)
+	}
+	req = signedReq(t, "nonce5", now)
+	req.Header.Set(RequestNonceHeader, "nonce6")
+	if _, err := c.VerifyRequest(ctx, req, nonces, now); !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("VerifyRequest(req with other nonce)=_, %v; want %v", err, ErrRequestSignature)
+	}
+	req = signedReq(t, "nonce9", now)
+	req.Body = ioutil.NopCloser(strings.NewReader("other exec request"))
+	if _, err := c.VerifyRequest(ctx, req, nonces, now); !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("VerifyRequest(req with other body)=_, %v; want %v", err, ErrRequestSignature)
+	}
+
+	t.Logf("rotate keys")
+	rotated := &Credentials{
+		Keys: [][]byte{[]byte("key2"), []byte("key1")},
+	}
+	req = signedReq(t, "nonce7", now)
+	authorization, err = rotated.VerifyRequest(ctx, req, nonces, now)
+	if err != nil || authorization != "Bearer "+cred {
+		t.Errorf("rotated.VerifyRequest(req, now)=%q, %v; want %q, nil", authorization, err, "Bearer "+cred)
+	}
+	other := &Credentials{
+		Keys: [][]byte{[]byte("key2")},
+	}
+	req = signedReq(t, "nonce8", now)
+	if _, err := other.VerifyRequest(ctx, req, nonces, now); !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("other.VerifyRequest(req, now)=_, %v; want %v", err, ErrRequestSignature)
+	}
+}
+
+func TestMemoryNonceCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := &MemoryNonceCache{
+		MaxEntries: 2,
+		now:        func() time.Time { return now },
+	}
+	add := func(key string, want bool) {
+		t.Helper()
+		ok, err := c.Add(ctx, key, time.Minute)
+		if err != nil || ok != want {
+			t.Errorf("Add(ctx, %q, 1m)=%t, %v; want %t, nil", key, ok, err, want)
+		}
+	}
+	add("a", true)
+	add("a", false)
+	add("b", true)
+
+	now = now.Add(time.Minute)
+	add("a", true)
+	add("a", false)
+
+	// "b" is evicted by MaxEntries.
+	add("c", true)
+	add("b", true)
+}
+
+func TestAuthCheckSignedRequest(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := &Credentials{
+		Keys: [][]byte{[]byte("key1")},
+	}
+	cred, expiresAt, err := c.Issue(&TokenInfo{
+		Email: "bot@example.com",
+	}, now)
+	if err != nil {
+		t.Fatalf("Issue(...)=_, _, %v; want nil err", err)
+	}
+	var authorizations []string
+	a := &Auth{
+		Client: dummyClient{
+			auth: func(ctx context.Context, req *authpb.AuthReq) (*authpb.AuthResp, error) {
+				authorizations = append(authorizations, req.Authorization)
+				return &authpb.AuthResp{
+					Email:     "bot@example.com",
+					ExpiresAt: timestamppb.New(expiresAt),
+					Quota:     -1,
+					GroupId:   "bot",
+				}, nil
+			},
+		},
+		Credentials: c,
+		runAt:       func(time.Time, func()) {},
+	}
+
+	req := httptest.NewRequest("POST", "/cxx-compiler-service/e/Exec", nil)
+	req.Header.Set("Authorization", "Bearer "+cred)
+	if _, err := a.Check(ctx, req); !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("Check(req with bearer credential)=_, %v; want %v", err, ErrRequestSignature)
+	}
+
+	req = httptest.NewRequest("POST", "/cxx-compiler-service/e/Exec", nil)
+	err = SignRequest(req, cred, "nonce1", now)
+	if err != nil {
+		t.Fatalf("SignRequest(req, cred, nonce1, now)=%v; want nil err", err)
+	}
+	u, err := a.Check(ctx, req)
+	if err != nil || u.Group != "bot" {
+		t.Errorf("Check(signed req)=%v, %v; want group bot, nil err", u, err)
+	}
+	if len(authorizations) != 1 || authorizations[0] != "Bearer "+cred {
+		t.Errorf("auth server got %q; want [%q]", authorizations, "Bearer "+cred)
+	}
+
+	if _, err := a.Check(ctx, req); !errors.Is(err, ErrRequestSignature) {
+		t.Errorf("Check(replayed req)=_, %v; want %v", err, ErrRequestSignature)
+	}
+
+	req = httptest.NewRequest("POST", "/cxx-compiler-service/e/Exec", nil)
+	req.Header.Set("Authorization", "Bearer oauth2-token")
+	if _, err := a.Check(ctx, req); err != nil {
+		t.Errorf("Check(req with oauth2 token)=_, %v; want nil err", err)
+	}
+}
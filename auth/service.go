@@ -47,6 +47,11 @@ type Service struct {
 	// error message will be used as ErrorDescription for user.
 	CheckToken func(context.Context, *oauth2.Token, *TokenInfo) (string, *oauth2.Token, error)
 
+	// Credentials optionally issues credentials by Enroll, and
+	// verifies credentials in Auth without tokeninfo.
+	// If it is not set, Enroll is not supported.
+	Credentials *Credentials
+
 	sg         singleflight.Group
 	mu         sync.Mutex
 	tokenCache map[string]*tokenCacheEntry
@@ -57,6 +62,9 @@ type Service struct {
 func (s *Service) fetch(ctx context.Context, token *oauth2.Token) (*TokenInfo, error) {
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/auth.fetch")
 	defer span.End()
+	if s.Credentials != nil && isCredential(token.AccessToken) {
+		return s.Credentials.Verify(ctx, token.AccessToken, time.Now()), nil
+	}
 	fetchInfo := s.fetchInfo
 	if fetchInfo == nil {
 		fetchInfo = fetch
@@ -199,3 +207,54 @@ func (s *Service) Auth(ctx context.Context, req *authpb.AuthReq) (*authpb.AuthRe
 
 	return resp, nil
 }
+
+// Enroll exchanges OAuth2 access token in authorization header
+// for short-lived credential.
+// Credential is issued only if the access token is authorized by Auth,
+// and the group doesn't use end user credential for backend, since
+// credential can't be used as access token for backend.
+func (s *Service) Enroll(ctx context.Context, req *authpb.EnrollReq) (*authpb.EnrollResp, error) {
+	logger := log.FromContext(ctx)
+	if s.Credentials == nil {
+		return nil, grpc.Errorf(codes.Unimplemented, "enroll is not configured")
+	}
+	token, err := parseToken(req.Authorization)
+	if err != nil {
+		logger.Errorf("parse token failure: %v", err)
+		return nil, grpc.Errorf(codes.InvalidArgument, "wrong authorization: %v", err)
+	}
+	if isCredential(token.AccessToken) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "credential can't be used to enroll")
+	}
+	resp, err := s.Auth(ctx, &authpb.AuthReq{
+		Authorization: req.Authorization,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.ErrorDescription != "" {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", resp.ErrorDescription)
+	}
+	if resp.GetToken().GetAccessToken() == token.AccessToken {
+		logger.Warnf("enroll rejected: group %q uses end user credential", resp.GroupId)
+		return nil, grpc.Errorf(codes.FailedPrecondition, "group %q uses end user credential", resp.GroupId)
+	}
+	s.mu.Lock()
+	te := s.tokenCache[tokenKey(token)]
+	s.mu.Unlock()
+	if te == nil || te.TokenInfo == nil {
+		// token cache entry has been expired since Auth.
+		return nil, grpc.Errorf(codes.Unavailable, "token info is not available")
+	}
+	cred, expiresAt, err := s.Credentials.Issue(te.TokenInfo, time.Now())
+	if err != nil {
+		logger.Errorf("failed to issue credential for %q: %v", resp.GroupId, err)
+		return nil, grpc.Errorf(codes.Internal, "failed to issue credential: %v", err)
+	}
+	logger.Infof("enrolled group %q until %s", resp.GroupId, expiresAt)
+	return &authpb.EnrollResp{
+		Credential: cred,
+		ExpiresAt:  timestamppb.New(expiresAt),
+		GroupId:    resp.GroupId,
+	}, nil
+}
@@ -83,10 +83,12 @@ func fetch(ctx context.Context, token *oauth2.Token) (*TokenInfo, error) {
 	}
 
 	var tokenInfo *TokenInfo
-	err = rpc.Retry{}.Do(ctx, func() error {
-		// always use 1 min timeout regardless of incoming context.
+	policy := rpc.PolicyFor(rpc.ServiceAuth)
+	timeout := policy.TimeoutOr(1 * time.Minute)
+	err = policy.RetryOr(rpc.Retry{}).Do(ctx, func() error {
+		// always use timeout regardless of incoming context.
 		// retry is controlled by incoming context.
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 		req = req.WithContext(ctx)
 		resp, err := http.DefaultClient.Do(req)
@@ -10,6 +10,9 @@ import (
 	"fmt"
 	"net/http"
 
+	"google.golang.org/grpc"
+
+	"go.chromium.org/goma/server/httprpc"
 	pb "go.chromium.org/goma/server/proto/backend"
 )
 
@@ -20,6 +23,8 @@ import (
 type Backend interface {
 	Ping() http.Handler
 	Exec() http.Handler
+	ExecExt() http.Handler
+	ExecStream() http.Handler
 	ByteStream() http.Handler
 	StoreFile() http.Handler
 	LookupFile() http.Handler
@@ -30,6 +35,27 @@ type Backend interface {
 type Option struct {
 	Auth      Auth
 	APIKeyDir string
+
+	// FileCompressor and ExecCompressor are grpc compressor names
+	// (e.g. "gzip" or "zstd") used for requests from local backend
+	// to file server and exec server respectively.
+	// Empty means no compression.
+	FileCompressor string
+	ExecCompressor string
+
+	// RateLimiter limits authenticated requests, if set.
+	RateLimiter httprpc.RateLimiter
+}
+
+// callOptions returns default call options with compressor.
+func callOptions(compressor string) []grpc.CallOption {
+	opts := []grpc.CallOption{
+		grpc.FailFast(false),
+	}
+	if compressor != "" {
+		opts = append(opts, grpc.UseCompressor(compressor))
+	}
+	return opts
 }
 
 // FromProto creates Backend based on cfg.
@@ -6,6 +6,7 @@ package backend
 
 import (
 	"context"
+	"io"
 
 	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
@@ -24,6 +25,7 @@ type ExecServer struct {
 }
 
 // Exec handles /e.
+// It retries once on other replica if exec server replica is unavailable.
 func (s ExecServer) Exec(ctx context.Context, req *gomapb.ExecReq) (*gomapb.ExecResp, error) {
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/backend.ExecServer.Exec")
 	defer span.End()
@@ -31,6 +33,52 @@ func (s ExecServer) Exec(ctx context.Context, req *gomapb.ExecReq) (*gomapb.Exec
 	ctx, id := rpc.TagID(ctx, req.GetRequesterInfo())
 	logger := log.FromContext(ctx)
 	logger.Infof("call exec %s", id)
-	resp, err := s.Client.Exec(ctx, req, grpc.MaxCallSendMsgSize(exec.DefaultMaxReqMsgSize), grpc.MaxCallRecvMsgSize(exec.DefaultMaxRespMsgSize))
+	var resp *gomapb.ExecResp
+	err := retryOnOtherReplica(ctx, "exec", func(ctx context.Context, opts ...grpc.CallOption) error {
+		var err error
+		resp, err = s.Client.Exec(ctx, req, append([]grpc.CallOption{grpc.MaxCallSendMsgSize(exec.DefaultMaxReqMsgSize), grpc.MaxCallRecvMsgSize(exec.DefaultMaxRespMsgSize)}, opts...)...)
+		return err
+	})
 	return resp, wrapError(ctx, "exec", err)
 }
+
+// ExecExt handles /ex.
+func (s ExecServer) ExecExt(ctx context.Context, req *execpb.ExecExtReq) (*execpb.ExecExtResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/backend.ExecServer.ExecExt")
+	defer span.End()
+	ctx = passThroughContext(ctx)
+	ctx, id := rpc.TagID(ctx, req.GetReq().GetRequesterInfo())
+	logger := log.FromContext(ctx)
+	logger.Infof("call exec ext %s", id)
+	resp, err := s.Client.ExecExt(ctx, req, grpc.MaxCallSendMsgSize(exec.DefaultMaxReqMsgSize), grpc.MaxCallRecvMsgSize(exec.DefaultMaxRespMsgSize))
+	return resp, wrapError(ctx, "exec_ext", err)
+}
+
+// ExecStream handles /es.
+// Unlike Exec, it doesn't retry on other replica, since progress
+// may already be sent to the client.
+func (s ExecServer) ExecStream(req *execpb.ExecExtReq, stream execpb.ExecService_ExecStreamServer) error {
+	ctx, span := trace.StartSpan(stream.Context(), "go.chromium.org/goma/server/backend.ExecServer.ExecStream")
+	defer span.End()
+	ctx = passThroughContext(ctx)
+	ctx, id := rpc.TagID(ctx, req.GetReq().GetRequesterInfo())
+	logger := log.FromContext(ctx)
+	logger.Infof("call exec stream %s", id)
+	client, err := s.Client.ExecStream(ctx, req, grpc.MaxCallSendMsgSize(exec.DefaultMaxReqMsgSize), grpc.MaxCallRecvMsgSize(exec.DefaultMaxRespMsgSize))
+	if err != nil {
+		return wrapError(ctx, "exec_stream", err)
+	}
+	for {
+		msg, err := client.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return wrapError(ctx, "exec_stream", err)
+		}
+		err = stream.Send(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
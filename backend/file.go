@@ -36,6 +36,7 @@ func (s FileServer) StoreFile(ctx context.Context, req *gomapb.StoreFileReq) (*g
 }
 
 // LookupFile handles /l.
+// It retries once on other replica if file server replica is unavailable.
 func (s FileServer) LookupFile(ctx context.Context, req *gomapb.LookupFileReq) (*gomapb.LookupFileResp, error) {
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/backend.FileServer.StoreFile")
 	defer span.End()
@@ -43,6 +44,11 @@ func (s FileServer) LookupFile(ctx context.Context, req *gomapb.LookupFileReq) (
 	ctx, id := rpc.TagID(ctx, req.GetRequesterInfo())
 	logger := log.FromContext(ctx)
 	logger.Infof("call lookupfile %s", id)
-	resp, err := s.Client.LookupFile(ctx, req, grpc.MaxCallRecvMsgSize(file.DefaultMaxMsgSize))
+	var resp *gomapb.LookupFileResp
+	err := retryOnOtherReplica(ctx, "lookupfile", func(ctx context.Context, opts ...grpc.CallOption) error {
+		var err error
+		resp, err = s.Client.LookupFile(ctx, req, append([]grpc.CallOption{grpc.MaxCallRecvMsgSize(file.DefaultMaxMsgSize)}, opts...)...)
+		return err
+	})
 	return resp, wrapError(ctx, "lookupfile", err)
 }
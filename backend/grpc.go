@@ -37,6 +37,10 @@ type GRPC struct {
 	ByteStreamClient bspb.ByteStreamClient
 
 	Auth Auth
+	// RateLimiter limits requests after authentication, if set.
+	RateLimiter httprpc.RateLimiter
+	// Retry is retry policy of calls to backend.
+	Retry rpc.Retry
 	// api key. used for remote backend.
 	APIKey string
 
@@ -48,8 +52,9 @@ type GRPC struct {
 func (g GRPC) httprpcOpts(timeout time.Duration) []httprpc.HandlerOption {
 	return []httprpc.HandlerOption{
 		httprpc.Timeout(timeout),
-		httprpc.WithRetry(rpc.Retry{}),
+		httprpc.WithRetry(g.Retry),
 		httprpc.WithAuth(g.Auth),
+		httprpc.WithRateLimiter(g.RateLimiter),
 		httprpc.WithAPIKey(g.APIKey),
 		httprpc.WithNamespace(g.Namespace),
 		httprpc.WithCluster(g.Cluster),
@@ -89,6 +94,16 @@ func (g GRPC) Exec() http.Handler {
 	return execrpc.Handler(g.ExecServer, g.httprpcOpts(9*time.Minute+50*time.Second)...)
 }
 
+// ExecExt returns http handler for exec request with extensions.
+func (g GRPC) ExecExt() http.Handler {
+	return execrpc.ExtHandler(g.ExecServer, g.httprpcOpts(9*time.Minute+50*time.Second)...)
+}
+
+// ExecStream returns http handler for exec stream request.
+func (g GRPC) ExecStream() http.Handler {
+	return execrpc.StreamHandler(g.ExecServer, g.httprpcOpts(9*time.Minute+50*time.Second)...)
+}
+
 // ByteStream returns http handler for bytestream.
 func (g GRPC) ByteStream() http.Handler {
 	if g.ByteStreamClient == nil {
@@ -66,6 +66,16 @@ func (h HTTPRPC) Exec() http.Handler {
 	return h.proxy
 }
 
+// ExecExt forwards requests to target.
+func (h HTTPRPC) ExecExt() http.Handler {
+	return h.proxy
+}
+
+// ExecStream forwards requests to target.
+func (h HTTPRPC) ExecStream() http.Handler {
+	return h.proxy
+}
+
 // ByteStream forwards requests to target.
 func (h HTTPRPC) ByteStream() http.Handler {
 	return h.proxy
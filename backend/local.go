@@ -15,22 +15,30 @@ import (
 	"go.chromium.org/goma/server/execlog"
 	"go.chromium.org/goma/server/file"
 	pb "go.chromium.org/goma/server/proto/backend"
+	execpb "go.chromium.org/goma/server/proto/exec"
 	filepb "go.chromium.org/goma/server/proto/file"
+	"go.chromium.org/goma/server/rpc"
 	"go.chromium.org/goma/server/server"
 )
 
 // FromLocalBackend creates new GRPC from cfg.
 // returned func would release resources associated with GRPC.
 func FromLocalBackend(ctx context.Context, cfg *pb.LocalBackend, opt Option) (GRPC, func(), error) {
+	retry, err := rpc.NewRetry(cfg.GetRetryPolicy())
+	if err != nil {
+		return GRPC{}, func() {}, fmt.Errorf("retry policy: %v", err)
+	}
 	fileAddr := cfg.FileAddr
 	if fileAddr == "" {
 		fileAddr = "file-server:5050"
 	}
 	fileConn, err := server.DialContext(ctx, fileAddr,
+		replicaDialOption(),
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallSendMsgSize(file.DefaultMaxMsgSize),
-			grpc.MaxCallRecvMsgSize(file.DefaultMaxMsgSize),
-			grpc.FailFast(false)))
+			append([]grpc.CallOption{
+				grpc.MaxCallSendMsgSize(file.DefaultMaxMsgSize),
+				grpc.MaxCallRecvMsgSize(file.DefaultMaxMsgSize),
+			}, callOptions(opt.FileCompressor)...)...))
 	if err != nil {
 		return GRPC{}, func() {}, fmt.Errorf("dial %s: %v", fileAddr, err)
 	}
@@ -41,7 +49,8 @@ func FromLocalBackend(ctx context.Context, cfg *pb.LocalBackend, opt Option) (GR
 	var bsConn *grpc.ClientConn
 	var bsClient bspb.ByteStreamClient
 	if cfg.EnableBytestream {
-		bsConn, err = server.DialContext(ctx, execAddr)
+		bsConn, err = server.DialContext(ctx, execAddr,
+			grpc.WithDefaultCallOptions(callOptions(opt.ExecCompressor)...))
 		if err != nil {
 			fileConn.Close()
 			return GRPC{}, func() {}, fmt.Errorf("dial %s: %v", execAddr, err)
@@ -53,13 +62,35 @@ func FromLocalBackend(ctx context.Context, cfg *pb.LocalBackend, opt Option) (GR
 			grpc.WithDefaultCallOptions(grpc.FailFast(false)),
 		},
 		server.DefaultDialOption()...)
+	execDialOptions := append(
+		[]grpc.DialOption{
+			grpc.WithDefaultCallOptions(callOptions(opt.ExecCompressor)...),
+		},
+		server.DefaultDialOption()...)
 	execlogAddr := cfg.ExeclogAddr
 	if execlogAddr == "" {
 		execlogAddr = "execlog-server:5050"
 	}
+	// exec client dials per call to spread load over replicas behind
+	// service address.  If address resolves to replicas (headless service),
+	// keep connection and let replica balancer spread load, so that
+	// it could retry on other replica.
+	var execConn *grpc.ClientConn
+	var execClient execpb.ExecServiceClient = exec.NewClient(execAddr, execDialOptions...)
+	if isReplicasAddr(execAddr) {
+		execConn, err = grpc.DialContext(ctx, execAddr, append([]grpc.DialOption{replicaDialOption()}, execDialOptions...)...)
+		if err != nil {
+			if bsConn != nil {
+				bsConn.Close()
+			}
+			fileConn.Close()
+			return GRPC{}, func() {}, fmt.Errorf("dial %s: %v", execAddr, err)
+		}
+		execClient = execpb.NewExecServiceClient(execConn)
+	}
 	be := GRPC{
 		ExecServer: ExecServer{
-			Client: exec.NewClient(execAddr, dialOptions...),
+			Client: execClient,
 		},
 		FileServer: FileServer{
 			Client: filepb.NewFileServiceClient(fileConn),
@@ -69,12 +100,17 @@ func FromLocalBackend(ctx context.Context, cfg *pb.LocalBackend, opt Option) (GR
 		},
 		ByteStreamClient: bsClient,
 		Auth:             opt.Auth,
+		RateLimiter:      opt.RateLimiter,
+		Retry:            retry,
 	}
 	if cfg.TraceOption != nil {
 		be.Namespace = cfg.TraceOption.Namespace
 		be.Cluster = cfg.TraceOption.Cluster
 	}
 	return be, func() {
+		if execConn != nil {
+			execConn.Close()
+		}
 		bsConn.Close()
 		fileConn.Close()
 	}, nil
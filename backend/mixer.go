@@ -14,6 +14,7 @@ import (
 	"go.chromium.org/goma/server/auth"
 	"go.chromium.org/goma/server/auth/enduser"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 	pb "go.chromium.org/goma/server/proto/backend"
 )
 
@@ -113,31 +114,35 @@ type Mixer struct {
 
 func (m Mixer) Ping() http.Handler       { return m.dispatcher(Backend.Ping) }
 func (m Mixer) Exec() http.Handler       { return m.dispatcher(Backend.Exec) }
+func (m Mixer) ExecExt() http.Handler    { return m.dispatcher(Backend.ExecExt) }
+func (m Mixer) ExecStream() http.Handler { return m.dispatcher(Backend.ExecStream) }
 func (m Mixer) ByteStream() http.Handler { return m.dispatcher(Backend.ByteStream) }
 func (m Mixer) StoreFile() http.Handler  { return m.dispatcher(Backend.StoreFile) }
 func (m Mixer) LookupFile() http.Handler { return m.dispatcher(Backend.LookupFile) }
 func (m Mixer) Execlog() http.Handler    { return m.dispatcher(Backend.Execlog) }
 
-func (m Mixer) selectBackend(ctx context.Context, group string, q url.Values) (Backend, bool) {
+// selectBackend selects backend for group and query params q.
+// It returns selected backend and its name ("default" for default backend).
+func (m Mixer) selectBackend(ctx context.Context, group string, q url.Values) (Backend, string, bool) {
 	logger := log.FromContext(ctx)
 	key := backendKey(group, q)
 	backend, found := m.backends[key]
 	if found {
 		logger.Infof("backend %s", key)
-		return backend, true
+		return backend, key, true
 	}
 	key = backendKey(group, nil)
 	backend, found = m.backends[key]
 	if found {
 		logger.Infof("backend %s (ignore query param:%s)", key, q)
-		return backend, true
+		return backend, key, true
 	}
 	backend = m.defaultBackend
 	if backend != nil {
 		logger.Infof("backend default for %s", key)
-		return backend, true
+		return backend, "default", true
 	}
-	return nil, false
+	return nil, "", false
 }
 
 func (m Mixer) dispatcher(handler func(Backend) http.Handler) http.Handler {
@@ -168,13 +173,14 @@ func (m Mixer) dispatcher(handler func(Backend) http.Handler) http.Handler {
 			return
 		}
 		q := req.URL.Query()
-		backend, found := m.selectBackend(ctx, user.Group, q)
+		backend, name, found := m.selectBackend(ctx, user.Group, q)
 		if !found {
 			logger.Errorf("no backend config for group:%q query:%q", user.Group, q.Encode())
 			http.Error(w, "no backend config", http.StatusForbidden)
 			return
 		}
+		ctx = metrics.WithBackend(ctx, name)
 		h := handler(backend)
-		h.ServeHTTP(w, req)
+		h.ServeHTTP(w, req.WithContext(ctx))
 	})
 }
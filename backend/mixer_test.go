@@ -122,7 +122,7 @@ func TestMixerSelectBackend(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			backend, found := mixer.selectBackend(ctx, tc.group, q)
+			backend, _, found := mixer.selectBackend(ctx, tc.group, q)
 			if !found {
 				t.Fatal("not found")
 			}
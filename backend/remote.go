@@ -27,12 +27,17 @@ import (
 	execpb "go.chromium.org/goma/server/proto/exec"
 	execlogpb "go.chromium.org/goma/server/proto/execlog"
 	filepb "go.chromium.org/goma/server/proto/file"
+	"go.chromium.org/goma/server/rpc"
 )
 
 // FromRemoteBackend creates new GRPC from cfg.
 // returned func would release resources associated with GRPC.
 func FromRemoteBackend(ctx context.Context, cfg *pb.RemoteBackend, opt Option) (GRPC, func(), error) {
 	logger := log.FromContext(ctx)
+	retry, err := rpc.NewRetry(cfg.GetRetryPolicy())
+	if err != nil {
+		return GRPC{}, func() {}, fmt.Errorf("retry policy: %v", err)
+	}
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
 		grpc.WithStatsHandler(&ocgrpc.ClientHandler{}),
@@ -91,7 +96,9 @@ func FromRemoteBackend(ctx context.Context, cfg *pb.RemoteBackend, opt Option) (
 		// TODO: propagate metadata.
 		ByteStreamClient: bspb.NewByteStreamClient(conn),
 		Auth:             opt.Auth,
+		RateLimiter:      opt.RateLimiter,
 		APIKey:           strings.TrimSpace(string(apiKey)),
+		Retry:            retry,
 	}
 	return be, func() { conn.Close() }, nil
 }
@@ -0,0 +1,119 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// replicaBalancerName is name of grpc balancer that picks ready replicas
+// in round robin, but avoids the replica set in context by avoidReplica.
+const replicaBalancerName = "goma_replica"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(replicaBalancerName, replicaPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// replicaDialOption is dial option to use replica balancer.
+// It is effective when address resolves to multiple replicas,
+// e.g. "dns:///exec-server-headless:5050" for kubernetes headless service.
+func replicaDialOption() grpc.DialOption {
+	return grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q:{}}]}`, replicaBalancerName))
+}
+
+// isReplicasAddr reports whether addr would be resolved to multiple replicas.
+func isReplicasAddr(addr string) bool {
+	return strings.HasPrefix(addr, "dns:///")
+}
+
+type avoidReplicaKey struct{}
+
+// avoidReplica returns new context to avoid replica of addr.
+func avoidReplica(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, avoidReplicaKey{}, addr)
+}
+
+func avoidedReplica(ctx context.Context) string {
+	addr, _ := ctx.Value(avoidReplicaKey{}).(string)
+	return addr
+}
+
+type replicaPickerBuilder struct{}
+
+func (replicaPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &replicaPicker{}
+	for sc, sci := range info.ReadySCs {
+		p.replicas = append(p.replicas, replica{
+			sc:   sc,
+			addr: sci.Address.Addr,
+		})
+	}
+	p.next = rand.Intn(len(p.replicas))
+	return p
+}
+
+type replica struct {
+	sc   balancer.SubConn
+	addr string
+}
+
+type replicaPicker struct {
+	mu       sync.Mutex
+	replicas []replica
+	next     int
+}
+
+func (p *replicaPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	avoid := avoidedReplica(info.Ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for range p.replicas {
+		r := p.replicas[p.next]
+		p.next = (p.next + 1) % len(p.replicas)
+		if len(p.replicas) > 1 && avoid != "" && r.addr == avoid {
+			continue
+		}
+		return balancer.PickResult{SubConn: r.sc}, nil
+	}
+	return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+}
+
+// retryOnOtherReplica calls f, and if it fails with codes.Unavailable,
+// calls f once again avoiding the replica that returned the error.
+// f must be idempotent, and must pass opts to grpc call.
+func retryOnOtherReplica(ctx context.Context, service string, f func(ctx context.Context, opts ...grpc.CallOption) error) error {
+	var p peer.Peer
+	err := f(ctx, grpc.Peer(&p))
+	if status.Code(err) != codes.Unavailable || ctx.Err() != nil {
+		return err
+	}
+	var addr string
+	if p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	logger := log.FromContext(ctx)
+	logger.Warnf("call %s unavailable on replica %q; retry on other replica: %v", service, addr, err)
+	trace.FromContext(ctx).Annotatef([]trace.Attribute{
+		trace.StringAttribute("replica", addr),
+	}, "retry on other replica: %v", err)
+	return f(avoidReplica(ctx, addr))
+}
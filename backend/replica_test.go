@@ -0,0 +1,143 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func TestReplicaPicker(t *testing.T) {
+	info := base.PickerBuildInfo{
+		ReadySCs: map[balancer.SubConn]base.SubConnInfo{},
+	}
+	for _, addr := range []string{"10.0.0.1:5050", "10.0.0.2:5050", "10.0.0.3:5050"} {
+		info.ReadySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{
+			Address: resolver.Address{Addr: addr},
+		}
+	}
+	p := replicaPickerBuilder{}.Build(info)
+
+	picked := map[string]int{}
+	for i := 0; i < 6; i++ {
+		r, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("Pick=%v; want nil error", err)
+		}
+		picked[r.SubConn.(*fakeSubConn).addr]++
+	}
+	for addr, n := range picked {
+		if n != 2 {
+			t.Errorf("picked %s %d times; want 2 (round robin)", addr, n)
+		}
+	}
+
+	ctx := avoidReplica(context.Background(), "10.0.0.2:5050")
+	for i := 0; i < 6; i++ {
+		r, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+		if err != nil {
+			t.Fatalf("Pick=%v; want nil error", err)
+		}
+		if got := r.SubConn.(*fakeSubConn).addr; got == "10.0.0.2:5050" {
+			t.Errorf("Pick=%s; want other replica", got)
+		}
+	}
+}
+
+func TestReplicaPickerSingle(t *testing.T) {
+	sc := &fakeSubConn{addr: "10.0.0.1:5050"}
+	p := replicaPickerBuilder{}.Build(base.PickerBuildInfo{
+		ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+			sc: {Address: resolver.Address{Addr: sc.addr}},
+		},
+	})
+	// no other replica. use the only replica.
+	r, err := p.Pick(balancer.PickInfo{Ctx: avoidReplica(context.Background(), sc.addr)})
+	if err != nil || r.SubConn != sc {
+		t.Errorf("Pick=%v, %v; want %v, nil", r.SubConn, err, sc)
+	}
+
+	p = replicaPickerBuilder{}.Build(base.PickerBuildInfo{})
+	_, err = p.Pick(balancer.PickInfo{Ctx: context.Background()})
+	if err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("Pick with no replica=%v; want %v", err, balancer.ErrNoSubConnAvailable)
+	}
+}
+
+func TestRetryOnOtherReplica(t *testing.T) {
+	ctx := context.Background()
+	replicaAddr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5050}
+
+	for _, tc := range []struct {
+		desc      string
+		errs      []error
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		{
+			desc:      "ok",
+			errs:      []error{nil},
+			wantCalls: 1,
+			wantCode:  codes.OK,
+		},
+		{
+			desc:      "unavailable then ok",
+			errs:      []error{status.Error(codes.Unavailable, "draining"), nil},
+			wantCalls: 2,
+			wantCode:  codes.OK,
+		},
+		{
+			desc:      "unavailable twice",
+			errs:      []error{status.Error(codes.Unavailable, "draining"), status.Error(codes.Unavailable, "draining")},
+			wantCalls: 2,
+			wantCode:  codes.Unavailable,
+		},
+		{
+			desc:      "not retriable",
+			errs:      []error{status.Error(codes.InvalidArgument, "bad request")},
+			wantCalls: 1,
+			wantCode:  codes.InvalidArgument,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var calls int
+			var avoided []string
+			err := retryOnOtherReplica(ctx, "test", func(ctx context.Context, opts ...grpc.CallOption) error {
+				avoided = append(avoided, avoidedReplica(ctx))
+				for _, opt := range opts {
+					if po, ok := opt.(grpc.PeerCallOption); ok {
+						*po.PeerAddr = peer.Peer{Addr: replicaAddr}
+					}
+				}
+				err := tc.errs[calls]
+				calls++
+				return err
+			})
+			if got := status.Code(err); got != tc.wantCode {
+				t.Errorf("retryOnOtherReplica=%v; want code %v", err, tc.wantCode)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("calls=%d; want %d", calls, tc.wantCalls)
+			}
+			if calls == 2 && avoided[1] != replicaAddr.String() {
+				t.Errorf("retry avoided %q; want %q", avoided[1], replicaAddr.String())
+			}
+		})
+	}
+}
@@ -29,12 +29,34 @@ func Exists(ctx context.Context, c pb.ByteStreamClient, resourceName string) err
 	return err
 }
 
+// ReadOption is an option of Open.
+type ReadOption func(*pb.ReadRequest)
+
+// ReadOffset sets offset in the resource to start reading.
+func ReadOffset(offset int64) ReadOption {
+	return func(req *pb.ReadRequest) {
+		req.ReadOffset = offset
+	}
+}
+
+// ReadLimit sets max number of bytes to read.
+// 0 means no limit.
+func ReadLimit(limit int64) ReadOption {
+	return func(req *pb.ReadRequest) {
+		req.ReadLimit = limit
+	}
+}
+
 // Open opens reader on bytestream for resourceName.
 // ctx will be used until Reader is closed.
-func Open(ctx context.Context, c pb.ByteStreamClient, resourceName string) (*Reader, error) {
-	rd, err := c.Read(ctx, &pb.ReadRequest{
+func Open(ctx context.Context, c pb.ByteStreamClient, resourceName string, opts ...ReadOption) (*Reader, error) {
+	req := &pb.ReadRequest{
 		ResourceName: resourceName,
-	})
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	rd, err := c.Read(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -88,13 +110,22 @@ func Create(ctx context.Context, c pb.ByteStreamClient, resourceName string) (*W
 		return nil, err
 	}
 	return &Writer{
+		ctx:     ctx,
+		c:       c,
 		resname: resourceName,
 		wr:      wr,
 	}, nil
 }
 
 // Writer is a writer on bytestream.
+//
+// On transient stream failure, Writer queries committed size of the
+// resource by QueryWriteStatus, and resumes writing from the committed
+// size on new stream, if data after the committed size is still kept
+// in resend buffer (last maxResendBufferBytes).
 type Writer struct {
+	ctx     context.Context
+	c       pb.ByteStreamClient
 	resname string
 	wr      pb.ByteStream_WriteClient
 	offset  int64
@@ -104,9 +135,32 @@ type Writer struct {
 	// then, we don't need to Send rest of data, so Write just returns
 	// success.  Close issues CloseAndRecv and don't check offset.
 	ok bool
+
+	// compressed is true if data is compressed, i.e. written by ZstdWriter.
+	// size is uncompressed size for compressed data.
+	compressed bool
+	size       int64
+
+	// sent keeps data sent to the stream for resume.
+	sent      []sentChunk
+	sentBytes int64
+	resumes   int
+}
+
+type sentChunk struct {
+	offset int64
+	data   []byte
 }
 
-const maxChunkSizeBytes = 2 * 1024 * 1024
+const (
+	maxChunkSizeBytes = 2 * 1024 * 1024
+
+	// maxResendBufferBytes is size of data kept for resume.
+	maxResendBufferBytes = 4 * maxChunkSizeBytes
+
+	// maxResumes is max number of resumes in a Writer.
+	maxResumes = 3
+)
 
 // Write writes data to bytestream.
 // The maximum data chunk size would be determined by server side,
@@ -124,26 +178,136 @@ func (w *Writer) Write(buf []byte) (int, error) {
 		if end > len(buf) {
 			end = len(buf)
 		}
+		err := w.send(buf[i:end])
+		if err != nil {
+			return 0, err
+		}
+		if w.ok {
+			// the blob already stored in CAS.
+			return len(buf), nil
+		}
+		i = end
+	}
+	return len(buf), nil
+}
+
+// send sends data at current offset, and resumes on transient error.
+func (w *Writer) send(data []byte) error {
+	for {
 		err := w.wr.Send(&pb.WriteRequest{
 			ResourceName: w.resname,
 			WriteOffset:  w.offset,
-			Data:         buf[i:end],
+			Data:         data,
 		})
 		if err == io.EOF {
 			_, err = w.wr.CloseAndRecv()
 			if err == nil || status.Convert(err).Code() == codes.AlreadyExists {
-				// the blob already stored in CAS.
 				w.ok = true
-				return len(buf), nil
+				return nil
 			}
 		}
+		if err == nil {
+			break
+		}
+		err = w.resume(err)
 		if err != nil {
-			return 0, err
+			return err
+		}
+		if w.ok {
+			return nil
 		}
-		w.offset += int64(end - i)
-		i = end
 	}
-	return len(buf), nil
+	w.keep(data)
+	w.offset += int64(len(data))
+	return nil
+}
+
+// keep keeps copy of data sent at current offset for resume.
+func (w *Writer) keep(data []byte) {
+	w.sent = append(w.sent, sentChunk{
+		offset: w.offset,
+		data:   append([]byte(nil), data...),
+	})
+	w.sentBytes += int64(len(data))
+	for len(w.sent) > 1 && w.sentBytes-int64(len(w.sent[0].data)) >= maxResendBufferBytes {
+		w.sentBytes -= int64(len(w.sent[0].data))
+		w.sent[0] = sentChunk{}
+		w.sent = w.sent[1:]
+	}
+}
+
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.Internal:
+		return true
+	}
+	return false
+}
+
+// resume resumes write on new stream after stream failure by cause.
+// It returns cause if it could not resume.
+// It sets w.ok if the resource is already complete.
+func (w *Writer) resume(cause error) error {
+	if w.c == nil || !isTransient(cause) || w.ctx.Err() != nil {
+		return cause
+	}
+	if w.resumes >= maxResumes {
+		return cause
+	}
+	w.resumes++
+	st, err := w.c.QueryWriteStatus(w.ctx, &pb.QueryWriteStatusRequest{
+		ResourceName: w.resname,
+	})
+	if err != nil {
+		return resumeError(cause, "query write status: %v", err)
+	}
+	if st.Complete {
+		w.ok = true
+		return nil
+	}
+	committed := st.CommittedSize
+	start := w.offset
+	if len(w.sent) > 0 {
+		start = w.sent[0].offset
+	}
+	if committed < start || committed > w.offset {
+		return resumeError(cause, "can't resume from committed size %d not in [%d, %d]", committed, start, w.offset)
+	}
+	wr, err := w.c.Write(w.ctx)
+	if err != nil {
+		return resumeError(cause, "resume write: %v", err)
+	}
+	w.wr = wr
+	for _, chunk := range w.sent {
+		end := chunk.offset + int64(len(chunk.data))
+		if end <= committed {
+			continue
+		}
+		err := w.wr.Send(&pb.WriteRequest{
+			ResourceName: w.resname,
+			WriteOffset:  committed,
+			Data:         chunk.data[committed-chunk.offset:],
+		})
+		if err == io.EOF {
+			_, err = w.wr.CloseAndRecv()
+			if err == nil || status.Convert(err).Code() == codes.AlreadyExists {
+				w.ok = true
+				return nil
+			}
+		}
+		if err != nil {
+			return w.resume(err)
+		}
+		committed = end
+	}
+	return nil
+}
+
+// resumeError returns error of cause with the same code, annotated
+// with the reason why resume failed.
+func resumeError(cause error, format string, args ...interface{}) error {
+	st := status.Convert(cause)
+	return status.Errorf(st.Code(), "%s; %s", st.Message(), fmt.Sprintf(format, args...))
 }
 
 // Close cloes the writer.
@@ -155,6 +319,33 @@ func (w *Writer) Close() error {
 		w.wr.CloseAndRecv()
 		return nil
 	}
+	var resp *pb.WriteResponse
+	for {
+		var err error
+		resp, err = w.finish()
+		if err == nil {
+			break
+		}
+		err = w.resume(err)
+		if err != nil {
+			return err
+		}
+		if w.ok {
+			return nil
+		}
+	}
+	if resp.CommittedSize != w.offset {
+		// for compressed data, server may respond with
+		// uncompressed size, or -1 if the blob already exists.
+		if w.compressed && (resp.CommittedSize == w.size || resp.CommittedSize == -1) {
+			return nil
+		}
+		return fmt.Errorf("upload committed size %d != offset %d", resp.CommittedSize, w.offset)
+	}
+	return nil
+}
+
+func (w *Writer) finish() (*pb.WriteResponse, error) {
 	// The service will not view the resource as 'complete'
 	// until the client has sent a 'WriteRequest' with 'finish_write'
 	// set to 'true'.
@@ -165,14 +356,14 @@ func (w *Writer) Close() error {
 		// The client may leave 'data' empty.
 	})
 	if err != nil && err != io.EOF {
-		return err
+		return nil, err
 	}
 	resp, err := w.wr.CloseAndRecv()
 	if err != nil && err != io.EOF {
-		return err
+		return nil, err
 	}
-	if resp.CommittedSize != w.offset {
-		return fmt.Errorf("upload committed size %d != offset %d", resp.CommittedSize, w.offset)
+	if resp == nil {
+		resp = &pb.WriteResponse{}
 	}
-	return nil
+	return resp, nil
 }
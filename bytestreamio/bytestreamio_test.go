@@ -27,20 +27,28 @@ type stubByteStreamReadClient struct {
 	resourceName string
 	data         []byte
 	chunksize    int
+	reads        int
 }
 
 func (c *stubByteStreamReadClient) Read(ctx context.Context, req *pb.ReadRequest, opts ...grpc.CallOption) (pb.ByteStream_ReadClient, error) {
 	if req.ResourceName != c.resourceName {
 		return nil, fmt.Errorf("bad resource name: %q; want %q", req.ResourceName, c.resourceName)
 	}
-	if req.ReadOffset != 0 {
-		return nil, fmt.Errorf("bad read offset=%d; want=%d", req.ReadOffset, 0)
+	if req.ReadOffset < 0 || req.ReadOffset > int64(len(c.data)) {
+		return nil, status.Errorf(codes.OutOfRange, "bad read offset=%d; size=%d", req.ReadOffset, len(c.data))
 	}
-	if req.ReadLimit != 0 {
-		return nil, fmt.Errorf("bad read limit=%d; want=%d", req.ReadLimit, 0)
+	if req.ReadLimit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "bad read limit=%d", req.ReadLimit)
 	}
+	end := len(c.data)
+	if req.ReadLimit > 0 && req.ReadOffset+req.ReadLimit < int64(end) {
+		end = int(req.ReadOffset + req.ReadLimit)
+	}
+	c.reads++
 	return &stubReadClient{
-		c: c,
+		c:      c,
+		offset: int(req.ReadOffset),
+		end:    end,
 	}, nil
 }
 
@@ -48,13 +56,14 @@ type stubReadClient struct {
 	pb.ByteStream_ReadClient
 	c      *stubByteStreamReadClient
 	offset int
+	end    int
 }
 
 func (r *stubReadClient) Recv() (*pb.ReadResponse, error) {
-	if r.offset >= len(r.c.data) {
+	if r.offset >= r.end {
 		return nil, io.EOF
 	}
-	data := r.c.data[r.offset:]
+	data := r.c.data[r.offset:r.end]
 	if len(data) > r.c.chunksize {
 		data = data[:r.c.chunksize]
 	}
@@ -101,6 +110,104 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestReaderRange(t *testing.T) {
+	data := make([]byte, 64*1024)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const resourceName = "resource-name"
+	c := &stubByteStreamReadClient{
+		resourceName: resourceName,
+		data:         data,
+		chunksize:    8192,
+	}
+	ctx := context.Background()
+	for _, tc := range []struct {
+		offset, limit int64
+		want          []byte
+	}{
+		{offset: 1000, want: data[1000:]},
+		{offset: 1000, limit: 20000, want: data[1000:21000]},
+		{limit: 10, want: data[:10]},
+		{offset: 60000, limit: 20000, want: data[60000:]},
+	} {
+		r, err := Open(ctx, c, resourceName, ReadOffset(tc.offset), ReadLimit(tc.limit))
+		if err != nil {
+			t.Fatalf("Open(offset=%d, limit=%d)=_, %v; want nil error", tc.offset, tc.limit, err)
+		}
+		var out bytes.Buffer
+		_, err = io.Copy(&out, r)
+		if err != nil {
+			t.Fatalf("read offset=%d limit=%d: %v", tc.offset, tc.limit, err)
+		}
+		if !bytes.Equal(out.Bytes(), tc.want) {
+			t.Errorf("read offset=%d limit=%d: len=%d; want len=%d", tc.offset, tc.limit, out.Len(), len(tc.want))
+		}
+	}
+}
+
+func TestReadSeeker(t *testing.T) {
+	data := make([]byte, 64*1024)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const resourceName = "resource-name"
+	c := &stubByteStreamReadClient{
+		resourceName: resourceName,
+		data:         data,
+		chunksize:    8192,
+	}
+	ctx := context.Background()
+	r := NewReadSeeker(ctx, c, resourceName, int64(len(data)))
+	defer r.Close()
+
+	readAt := func(offset int64, whence int, n int, want []byte) {
+		t.Helper()
+		_, err := r.Seek(offset, whence)
+		if err != nil {
+			t.Fatalf("Seek(%d, %d)=%v; want nil error", offset, whence, err)
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			t.Fatalf("ReadFull after Seek(%d, %d)=%v; want nil error", offset, whence, err)
+		}
+		if !bytes.Equal(buf, want) {
+			t.Errorf("read after Seek(%d, %d) mismatch", offset, whence)
+		}
+	}
+	readAt(100, io.SeekStart, 100, data[100:200])
+	reads := c.reads
+	// continue reading on the same stream.
+	readAt(0, io.SeekCurrent, 100, data[200:300])
+	if c.reads != reads {
+		t.Errorf("reads=%d; want %d", c.reads, reads)
+	}
+	readAt(-100, io.SeekEnd, 100, data[len(data)-100:])
+	readAt(10000, io.SeekStart, 20000, data[10000:30000])
+
+	pos, err := r.Seek(0, io.SeekEnd)
+	if err != nil || pos != int64(len(data)) {
+		t.Errorf("Seek(0, io.SeekEnd)=%d, %v; want %d, nil", pos, err, len(data))
+	}
+	n, err := r.Read(make([]byte, 10))
+	if n != 0 || err != io.EOF {
+		t.Errorf("Read at end=%d, %v; want 0, io.EOF", n, err)
+	}
+	_, err = r.Seek(-1, io.SeekStart)
+	if err == nil {
+		t.Errorf("Seek(-1, io.SeekStart)=nil; want error")
+	}
+
+	r = NewReadSeeker(ctx, c, resourceName, -1)
+	_, err = r.Seek(0, io.SeekEnd)
+	if err == nil {
+		t.Errorf("Seek(0, io.SeekEnd) with unknown size=nil; want error")
+	}
+}
+
 type stubByteStreamServer struct {
 	bpb.ByteStreamServer
 	resourceName             string
@@ -108,9 +215,26 @@ type stubByteStreamServer struct {
 	err                      error
 	finished                 bool
 	earlyReturnCommittedSize int64
+
+	// failAt makes stream fail once with Unavailable when received
+	// data reaches failAt, and drops last uncommitted bytes.
+	failAt      int
+	uncommitted int
+	writes      int
+}
+
+func (s *stubByteStreamServer) QueryWriteStatus(ctx context.Context, req *bpb.QueryWriteStatusRequest) (*bpb.QueryWriteStatusResponse, error) {
+	if req.ResourceName != s.resourceName {
+		return nil, status.Errorf(codes.NotFound, "bad resource name: %q; want %q", req.ResourceName, s.resourceName)
+	}
+	return &bpb.QueryWriteStatusResponse{
+		CommittedSize: int64(s.buf.Len()),
+		Complete:      s.finished,
+	}, nil
 }
 
 func (s *stubByteStreamServer) Write(stream bpb.ByteStream_WriteServer) error {
+	s.writes++
 	for {
 		req, err := stream.Recv()
 		if err != nil {
@@ -132,6 +256,11 @@ func (s *stubByteStreamServer) Write(stream bpb.ByteStream_WriteServer) error {
 		if s.err != nil {
 			return s.err
 		}
+		if s.failAt > 0 && s.buf.Len() >= s.failAt {
+			s.failAt = 0
+			s.buf.Truncate(s.buf.Len() - s.uncommitted)
+			return status.Error(codes.Unavailable, "stream reset")
+		}
 		if s.earlyReturnCommittedSize != 0 {
 			return stream.SendAndClose(&bpb.WriteResponse{CommittedSize: s.earlyReturnCommittedSize})
 		}
@@ -345,3 +474,56 @@ func TestWriterServerError(t *testing.T) {
 		t.Errorf("error not propagated to client: %v", err)
 	}
 }
+
+func TestWriterResume(t *testing.T) {
+	const datasize = 10*1024*1024 + 2048
+	data := make([]byte, datasize)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const resourceName = "resource-name"
+	srv := grpc.NewServer()
+	s := &stubByteStreamServer{
+		resourceName: resourceName,
+		failAt:       3 * 1024 * 1024,
+		uncommitted:  1024*1024 + 512,
+	}
+	bpb.RegisterByteStreamServer(srv, s)
+	addr, serverStop, err := grpctest.StartServer(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverStop()
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := bpb.NewByteStreamClient(conn)
+	ctx := context.Background()
+
+	w, err := Create(ctx, c, resourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(w, bytes.NewReader(data))
+	if err != nil {
+		w.Close()
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.finished {
+		t.Errorf("write not finished")
+	}
+	if s.writes != 2 {
+		t.Errorf("write streams=%d; want 2", s.writes)
+	}
+	if !bytes.Equal(s.buf.Bytes(), data) {
+		t.Errorf("write doesn't match: len=%d; want len=%d", s.buf.Len(), len(data))
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bytestreamio
+
+import (
+	"io"
+)
+
+// PipelineCopy copies from r to w until EOF on r or an error occurs,
+// and returns the number of bytes written to w.
+//
+// Unlike io.Copy, it reads next chunk from r while writing previous
+// chunk to w, so slow source (e.g. disk or file server) and slow sink
+// (e.g. bytestream Write) overlap.  It uses depth+1 buffers of bufSize;
+// depth=1 is double buffering.
+//
+// Note that bytestream doesn't allow concurrent Write streams for
+// the same resource, so large blob can't be split into multiple
+// streams. Pipelining read and write is the way to speed up it.
+//
+// It doesn't return until it finishes reading from r, so caller
+// can safely close r after it returns.
+func PipelineCopy(w io.Writer, r io.Reader, bufSize, depth int) (int64, error) {
+	if bufSize <= 0 {
+		bufSize = maxChunkSizeBytes
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	type chunk struct {
+		buf []byte
+		n   int
+		err error
+	}
+	free := make(chan []byte, depth+1)
+	for i := 0; i < depth+1; i++ {
+		free <- make([]byte, bufSize)
+	}
+	filled := make(chan chunk, depth)
+	done := make(chan struct{})
+	go func() {
+		defer close(filled)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-done:
+				return
+			}
+			n, err := io.ReadFull(r, buf)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			select {
+			case filled <- chunk{buf: buf, n: n, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var written int64
+	var err error
+	for c := range filled {
+		if c.n > 0 {
+			var n int
+			n, err = w.Write(c.buf[:c.n])
+			written += int64(n)
+			if err == nil && n != c.n {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				break
+			}
+		}
+		if c.err != nil {
+			if c.err != io.EOF {
+				err = c.err
+			}
+			break
+		}
+		free <- c.buf
+	}
+	close(done)
+	// wait for reader goroutine to finish.
+	for range filled {
+	}
+	return written, err
+}
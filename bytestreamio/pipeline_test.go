@@ -0,0 +1,67 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bytestreamio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+type errWriter struct {
+	limit int
+	buf   bytes.Buffer
+}
+
+func (w *errWriter) Write(b []byte) (int, error) {
+	if w.buf.Len()+len(b) > w.limit {
+		return 0, errors.New("write error")
+	}
+	return w.buf.Write(b)
+}
+
+func TestPipelineCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("pipeline copy test\n"), 100*1024)
+	for _, tc := range []struct {
+		bufSize, depth int
+	}{
+		{bufSize: 4096, depth: 1},
+		{bufSize: 4096, depth: 3},
+		{bufSize: len(data), depth: 1},
+		{bufSize: len(data) + 1, depth: 1},
+		{bufSize: 0, depth: 0},
+	} {
+		var out bytes.Buffer
+		n, err := PipelineCopy(&out, bytesReader{bytes.NewReader(data)}, tc.bufSize, tc.depth)
+		if err != nil || n != int64(len(data)) {
+			t.Errorf("PipelineCopy(bufSize=%d, depth=%d)=%d, %v; want %d, nil", tc.bufSize, tc.depth, n, err, len(data))
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("PipelineCopy(bufSize=%d, depth=%d): data mismatch", tc.bufSize, tc.depth)
+		}
+	}
+}
+
+func TestPipelineCopyWriteError(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 10*4096)
+	w := &errWriter{limit: 3 * 4096}
+	n, err := PipelineCopy(w, bytesReader{bytes.NewReader(data)}, 4096, 1)
+	if err == nil || n != 3*4096 {
+		t.Errorf("PipelineCopy()=%d, %v; want %d, error", n, err, 3*4096)
+	}
+}
+
+func TestPipelineCopyReadError(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 10*4096)
+	rerr := errors.New("read error")
+	r := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(rerr))
+	var out bytes.Buffer
+	n, err := PipelineCopy(&out, r, 4096, 1)
+	if err != rerr || n != int64(len(data)) {
+		t.Errorf("PipelineCopy()=%d, %v; want %d, %v", n, err, len(data), rerr)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bytestreamio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "google.golang.org/genproto/googleapis/bytestream"
+)
+
+// ReadSeeker is a seekable reader on bytestream for range reads.
+// It opens new Read stream from current offset at the first Read
+// after Seek.
+type ReadSeeker struct {
+	ctx     context.Context
+	c       pb.ByteStreamClient
+	resname string
+	size    int64
+
+	offset int64
+	r      *Reader
+	cancel context.CancelFunc
+}
+
+// NewReadSeeker creates ReadSeeker on bytestream for resourceName.
+// size is the size of the resource, used for io.SeekEnd.
+// size < 0 means unknown size, and io.SeekEnd is not supported.
+// ctx will be used until ReadSeeker is closed.
+func NewReadSeeker(ctx context.Context, c pb.ByteStreamClient, resourceName string, size int64) *ReadSeeker {
+	return &ReadSeeker{
+		ctx:     ctx,
+		c:       c,
+		resname: resourceName,
+		size:    size,
+	}
+}
+
+// Read reads data from current offset.
+func (r *ReadSeeker) Read(buf []byte) (int, error) {
+	if r.size >= 0 && r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.r == nil {
+		ctx, cancel := context.WithCancel(r.ctx)
+		rd, err := Open(ctx, r.c, r.resname, ReadOffset(r.offset))
+		if err != nil {
+			cancel()
+			return 0, err
+		}
+		r.r = rd
+		r.cancel = cancel
+	}
+	n, err := r.r.Read(buf)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Read.
+func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		if r.size < 0 {
+			return r.offset, errors.New("bytestreamio: seek from end with unknown size")
+		}
+		offset += r.size
+	default:
+		return r.offset, fmt.Errorf("bytestreamio: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return r.offset, fmt.Errorf("bytestreamio: negative offset %d", offset)
+	}
+	if offset != r.offset {
+		r.closeStream()
+		r.offset = offset
+	}
+	return r.offset, nil
+}
+
+// Close closes current Read stream.
+func (r *ReadSeeker) Close() error {
+	r.closeStream()
+	return nil
+}
+
+func (r *ReadSeeker) closeStream() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.r = nil
+	r.cancel = nil
+}
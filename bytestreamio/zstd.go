@@ -0,0 +1,120 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bytestreamio
+
+import (
+	"context"
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+	pb "google.golang.org/genproto/googleapis/bytestream"
+)
+
+// OpenZstd opens reader on bytestream for zstd compressed resourceName,
+// i.e. "{instance}/compressed-blobs/zstd/{hash}/{size}".
+// ZstdReader reads decompressed data.
+// ctx will be used until ZstdReader is closed.
+func OpenZstd(ctx context.Context, c pb.ByteStreamClient, resourceName string) (*ZstdReader, error) {
+	r, err := Open(ctx, c, resourceName)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &ZstdReader{
+		r:   r,
+		dec: dec,
+	}, nil
+}
+
+// ZstdReader is a reader on zstd compressed bytestream.
+type ZstdReader struct {
+	r    *Reader
+	dec  *zstd.Decoder
+	size int64
+}
+
+// Read reads decompressed data from bytestream.
+func (r *ZstdReader) Read(buf []byte) (int, error) {
+	if r.dec == nil {
+		return 0, errors.New("bad ZstdReader")
+	}
+	n, err := r.dec.Read(buf)
+	r.size += int64(n)
+	return n, err
+}
+
+// Size reports decompressed size read by Read.
+func (r *ZstdReader) Size() int64 {
+	return r.size
+}
+
+// CompressedSize reports compressed size read from bytestream.
+func (r *ZstdReader) CompressedSize() int64 {
+	return r.r.Size()
+}
+
+// Close closes the reader.
+func (r *ZstdReader) Close() error {
+	if r.dec == nil {
+		return errors.New("bad ZstdReader")
+	}
+	r.dec.Close()
+	r.dec = nil
+	return nil
+}
+
+// CreateZstd creates writer on bytestream for zstd compressed resourceName,
+// i.e. "{instance}/uploads/{uuid}/compressed-blobs/zstd/{hash}/{size}".
+// Data written to ZstdWriter is compressed before sending to bytestream.
+// ctx will be used until ZstdWriter is closed.
+func CreateZstd(ctx context.Context, c pb.ByteStreamClient, resourceName string) (*ZstdWriter, error) {
+	w, err := Create(ctx, c, resourceName)
+	if err != nil {
+		return nil, err
+	}
+	w.compressed = true
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		w.wr.CloseSend()
+		return nil, err
+	}
+	return &ZstdWriter{
+		w:   w,
+		enc: enc,
+	}, nil
+}
+
+// ZstdWriter is a writer on zstd compressed bytestream.
+type ZstdWriter struct {
+	w   *Writer
+	enc *zstd.Encoder
+}
+
+// Write compresses data and writes it to bytestream.
+func (w *ZstdWriter) Write(buf []byte) (int, error) {
+	if w.enc == nil {
+		return 0, errors.New("bad ZstdWriter")
+	}
+	n, err := w.enc.Write(buf)
+	w.w.size += int64(n)
+	return n, err
+}
+
+// Close flushes compressed data and closes the writer.
+func (w *ZstdWriter) Close() error {
+	if w.enc == nil {
+		return errors.New("bad ZstdWriter")
+	}
+	err := w.enc.Close()
+	w.enc = nil
+	if err != nil {
+		w.w.wr.CloseSend()
+		return err
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bytestreamio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"go.chromium.org/goma/server/rpc/grpctest"
+	bpb "google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+)
+
+func TestZstd(t *testing.T) {
+	// compressible data.
+	data := bytes.Repeat([]byte("goma compressed-blobs test data\n"), 256*1024)
+
+	const resourceName = "instance/uploads/uuid/compressed-blobs/zstd/hash/8388608"
+	srv := grpc.NewServer()
+	s := &stubByteStreamServer{resourceName: resourceName}
+	bpb.RegisterByteStreamServer(srv, s)
+	addr, serverStop, err := grpctest.StartServer(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverStop()
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := bpb.NewByteStreamClient(conn)
+	ctx := context.Background()
+
+	w, err := CreateZstd(ctx, c, resourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(w, bytesReader{bytes.NewReader(data)})
+	if err != nil {
+		w.Close()
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.finished {
+		t.Errorf("write not finished")
+	}
+	if s.buf.Len() >= len(data) {
+		t.Errorf("write len=%d; want < %d", s.buf.Len(), len(data))
+	}
+
+	rc := &stubByteStreamReadClient{
+		resourceName: "instance/compressed-blobs/zstd/hash/8388608",
+		data:         s.buf.Bytes(),
+		chunksize:    8192,
+	}
+	r, err := OpenZstd(ctx, rc, rc.resourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var out bytes.Buffer
+	_, err = io.Copy(&out, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("read len=%d doesn't match; want len=%d", out.Len(), len(data))
+	}
+	if got, want := r.Size(), int64(len(data)); got != want {
+		t.Errorf("r.Size()=%d; want %d", got, want)
+	}
+	if got, want := r.CompressedSize(), int64(s.buf.Len()); got != want {
+		t.Errorf("r.CompressedSize()=%d; want %d", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Blob type hints to choose caching policy.
+const (
+	BlobTypeObject  = "object"
+	BlobTypeSource  = "source"
+	BlobTypePCH     = "pch"
+	BlobTypeDepfile = "depfile"
+)
+
+type blobTypeKeyType int
+
+var blobTypeKey blobTypeKeyType
+
+// metadata key of blob type hint, so that clients could supply it,
+// and it is propagated to downstream grpc calls.
+const blobTypeMDKey = "x-goma-blob-type"
+
+// WithBlobType returns a copy of ctx with blob type hint t,
+// used for blobs stored in the context.
+// The hint is propagated to downstream grpc calls in metadata.
+func WithBlobType(ctx context.Context, t string) context.Context {
+	if t == "" {
+		return ctx
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, blobTypeMDKey, t)
+	return context.WithValue(ctx, blobTypeKey, t)
+}
+
+// BlobTypeFromContext returns blob type hint of ctx, set by WithBlobType
+// or supplied by the client in metadata.
+// It returns "" if no hint is given.
+func BlobTypeFromContext(ctx context.Context) string {
+	if t, ok := ctx.Value(blobTypeKey).(string); ok {
+		return t
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	v := md.Get(blobTypeMDKey)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[len(v)-1]
+}
+
+// BlobTypeFromPath infers blob type hint from file path fname.
+// It returns "" if blob type is unknown.
+func BlobTypeFromPath(fname string) string {
+	if i := strings.LastIndexAny(fname, `/\`); i >= 0 {
+		fname = fname[i+1:]
+	}
+	i := strings.LastIndexByte(fname, '.')
+	if i < 0 {
+		return ""
+	}
+	switch strings.ToLower(fname[i:]) {
+	case ".o", ".obj", ".a", ".lib", ".so", ".dll", ".dylib":
+		return BlobTypeObject
+	case ".pch", ".gch", ".pcm":
+		return BlobTypePCH
+	case ".d":
+		return BlobTypeDepfile
+	case ".c", ".cc", ".cpp", ".cxx", ".m", ".mm", ".s", ".h", ".hh", ".hpp", ".hxx", ".inc", ".def":
+		return BlobTypeSource
+	}
+	return ""
+}
@@ -9,11 +9,15 @@ import (
 	"context"
 	"errors"
 	"expvar"
+	"math"
+	"math/rand"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/golang/groupcache/lru"
 	"go.opencensus.io/trace"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
@@ -25,13 +29,70 @@ import (
 // cache is a wrapper around an *lru.Cache that adds synchronization,
 // and counts the size of all keys and values.
 type memcache struct {
-	MaxBytes   int64
+	MaxBytes int64
+
+	// TTL and TTLJitter are the same as in Config.
+	TTL       time.Duration
+	TTLJitter float64
+
+	// now is for testing.
+	now func() time.Time
+
 	mu         sync.RWMutex
 	nbytes     int64 // of all keys and vlaues
 	lru        *lru.Cache
 	nhit, nget int64
 	nevict     int64 // number of evictions
 	nreplace   int64
+	nexpire    int64 // number of expired entries
+}
+
+// memEntry is an entry in memcache.
+type memEntry struct {
+	value []byte
+
+	// expire is the time the entry expires. zero means never expires.
+	expire time.Time
+
+	// delta is time taken to fetch the value from cloud cache.
+	// it is used for probabilistic early expiration.
+	delta time.Duration
+}
+
+// expiresEarly reports whether the entry is considered as expired
+// at now by probabilistic early expiration ("XFetch") with beta.
+// The probability increases as it gets closer to expiry, and is
+// higher for entries that took longer to fetch.
+func (e *memEntry) expiresEarly(now time.Time, beta float64) bool {
+	if e.expire.IsZero() || e.delta <= 0 || beta <= 0 {
+		return false
+	}
+	// -log(rand) is exponentially distributed with mean 1.
+	early := time.Duration(float64(e.delta) * beta * -math.Log(1-rand.Float64()))
+	return !now.Add(early).Before(e.expire)
+}
+
+func (c *memcache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// expireTime returns expiration time of an entry added at now with ttl.
+// 0 ttl means c.TTL.
+// It returns zero time if TTL is not set.
+func (c *memcache) expireTime(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = c.TTL
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	if c.TTLJitter > 0 {
+		ttl = time.Duration(float64(ttl) * (1 + c.TTLJitter*(rand.Float64()*2-1)))
+	}
+	return now.Add(ttl)
 }
 
 var errNoChange = errors.New("cache: no change")
@@ -48,11 +109,21 @@ func (r replaceError) Error() string {
 // It returns errNoChange if key-value pair was already stored.
 // It returns replaceError if value is replaced.
 func (c *memcache) Put(ctx context.Context, key string, value []byte) error {
+	return c.put(ctx, key, value, 0, 0)
+}
+
+// put puts key-value pair in memcache with delta, time taken to fetch
+// the value, and ttl (0 means c.TTL).
+func (c *memcache) put(ctx context.Context, key string, value []byte, delta, ttl time.Duration) error {
 	span := trace.FromContext(ctx)
 	span.Annotatef(nil, "put %s (size:%d)", key, len(value))
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	err := c.add(ctx, key, value)
+	err := c.add(ctx, key, &memEntry{
+		value:  value,
+		expire: c.expireTime(c.timeNow(), ttl),
+		delta:  delta,
+	})
 	if c.MaxBytes == 0 {
 		return err
 	}
@@ -68,25 +139,30 @@ func (c *memcache) Put(ctx context.Context, key string, value []byte) error {
 // add adds key-value pair in memcache.
 // It returns errNoChange if key-value pair already exists in memcache.
 // It returns replaceError if key exists but value differs.
-func (c *memcache) add(ctx context.Context, key string, value []byte) error {
+func (c *memcache) add(ctx context.Context, key string, e *memEntry) error {
 	logger := log.FromContext(ctx)
 
 	if c.lru == nil {
 		c.lru = &lru.Cache{
 			OnEvicted: func(key lru.Key, value interface{}) {
 				logger := log.FromContext(context.Background())
-				logger.Infof("mem.evict %s %d", key.(string), len(value.([]byte)))
-				c.nbytes -= int64(len(key.(string))) + int64(len(value.([]byte)))
+				v := value.(*memEntry).value
+				logger.Infof("mem.evict %s %d", key.(string), len(v))
+				c.nbytes -= int64(len(key.(string))) + int64(len(v))
 				c.nevict++
 			},
 		}
 	}
+	value := e.value
 	var err error
 	vi, ok := c.lru.Get(key)
 	if ok {
-		ov := vi.([]byte)
+		oe := vi.(*memEntry)
+		ov := oe.value
 		if bytes.Equal(ov, value) {
 			logger.Infof("mem.put2  %s %d", key, len(value))
+			oe.expire = e.expire
+			oe.delta = e.delta
 			return errNoChange
 		}
 		logger.Errorf("mem.repl  %s %d <= %d", key, len(value), len(ov))
@@ -97,12 +173,22 @@ func (c *memcache) add(ctx context.Context, key string, value []byte) error {
 	} else {
 		logger.Infof("mem.put   %s %d", key, len(value))
 	}
-	c.lru.Add(key, value)
+	c.lru.Add(key, e)
 	c.nbytes += int64(len(key)) + int64(len(value))
 	return err
 }
 
 func (c *memcache) Get(ctx context.Context, key string) (value []byte, ok bool) {
+	e, ok := c.get(ctx, key)
+	if !ok {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// get gets entry for key. It returns false if entry is not found,
+// or expired.
+func (c *memcache) get(ctx context.Context, key string) (*memEntry, bool) {
 	span := trace.FromContext(ctx)
 	span.Annotatef(nil, "get %s", key)
 	logger := log.FromContext(ctx)
@@ -119,9 +205,18 @@ func (c *memcache) Get(ctx context.Context, key string) (value []byte, ok bool)
 		logger.Infof("mem.miss  %s", key)
 		return nil, false
 	}
+	e := vi.(*memEntry)
+	if !e.expire.IsZero() && !c.timeNow().Before(e.expire) {
+		logger.Infof("mem.expire %s %d", key, len(e.value))
+		// Remove calls OnEvicted, but it is expiration, not eviction.
+		c.lru.Remove(key)
+		c.nevict--
+		c.nexpire++
+		return nil, false
+	}
 	c.nhit++
-	logger.Infof("mem.hit   %s %d", key, len(vi.([]byte)))
-	return vi.([]byte), true
+	logger.Infof("mem.hit   %s %d", key, len(e.value))
+	return e, true
 }
 
 // TODO: use opencensus stats, view.
@@ -134,6 +229,7 @@ type memstats struct {
 	Gets     int64
 	Evicts   int64
 	Replaces int64
+	Expires  int64
 }
 
 func (c *memcache) stats() memstats {
@@ -151,6 +247,7 @@ func (c *memcache) stats() memstats {
 		Gets:     c.nget,
 		Evicts:   c.nevict,
 		Replaces: c.nreplace,
+		Expires:  c.nexpire,
 	}
 }
 
@@ -163,18 +260,87 @@ type Config struct {
 	// MaxDiskBytes int64
 
 	Bucket *storage.BucketHandle
+
+	// TTL is time to live of entries in memory.
+	// 0 means entries never expire, and are evicted only by LRU.
+	TTL time.Duration
+
+	// TTLJitter randomizes TTL of each entry in
+	// [TTL*(1-TTLJitter), TTL*(1+TTLJitter)], so that entries put
+	// at the same time (e.g. after toolchain rollouts) don't expire
+	// at the same time.
+	TTLJitter float64
+
+	// EarlyExpirationBeta enables probabilistic early expiration of
+	// entries fetched from cloud cache, if positive.
+	// Get refetches an entry before it expires with probability
+	// increasing as it gets closer to expiry, so that hot entries
+	// are refreshed by a few requests rather than all requests at
+	// expiry. 1.0 is a good default; larger value refreshes earlier.
+	EarlyExpirationBeta float64
+
+	// Denylist is keys that must not be served nor stored, if set.
+	Denylist *Denylist
+
+	// BlobPolicy is caching policy per blob type hint, if set.
+	BlobPolicy *BlobPolicy
 }
 
 // TODO: put it in Config?
 const writeBackSemaphore = 8
 
+// fetchTimeout is timeout of a fetch from cloud cache shared by
+// concurrent Get requests.
+const fetchTimeout = 1 * time.Minute
+
 // Cache represents key-value cache.
 type Cache struct {
 	cachepb.UnimplementedCacheServiceServer
 	mem memcache
 	gcs *gcs.Cache
 
+	earlyExpirationBeta float64
+
+	denylist *Denylist
+
+	blobPolicy *BlobPolicy
+
+	// sg coalesces concurrent fetches of the same key from cloud cache.
+	sg singleflight.Group
+
 	wbsema chan bool
+
+	nsmu    sync.Mutex
+	nsstats map[string]*NamespaceStats
+}
+
+// NamespaceStats represents stats of a namespace.
+type NamespaceStats struct {
+	Puts int64
+	Gets int64
+	Hits int64
+}
+
+// memKey returns key in memcache for key in namespace.
+func memKey(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return namespace + "/" + key
+}
+
+func (c *Cache) recordNamespace(namespace string, f func(*NamespaceStats)) {
+	c.nsmu.Lock()
+	defer c.nsmu.Unlock()
+	if c.nsstats == nil {
+		c.nsstats = make(map[string]*NamespaceStats)
+	}
+	ns, ok := c.nsstats[namespace]
+	if !ok {
+		ns = &NamespaceStats{}
+		c.nsstats[namespace] = ns
+	}
+	f(ns)
 }
 
 var (
@@ -186,8 +352,13 @@ var (
 func New(c Config) (*Cache, error) {
 	cache := &Cache{
 		mem: memcache{
-			MaxBytes: c.MaxBytes,
+			MaxBytes:  c.MaxBytes,
+			TTL:       c.TTL,
+			TTLJitter: c.TTLJitter,
 		},
+		earlyExpirationBeta: c.EarlyExpirationBeta,
+		denylist:            c.Denylist,
+		blobPolicy:          c.BlobPolicy,
 	}
 
 	if c.Bucket != nil {
@@ -203,17 +374,42 @@ func New(c Config) (*Cache, error) {
 
 // Put puts new key-value pair in memcache (always; i.e. overwrite existing one)
 // and cloud cache (if gcs is configured, and new value is put).
-// It returns error if it fails to put cache in cloud storage.
+// TTL, storage tier and compression are chosen by BlobPolicy for
+// blob type hint of the request.
+// It returns error if it fails to put cache in cloud storage, or key is denied.
 func (c *Cache) Put(ctx context.Context, req *cachepb.PutReq) (*cachepb.PutResp, error) {
-	err := c.mem.Put(ctx, req.Kv.Key, req.Kv.Value)
+	if c.denylist.Contains(req.Kv.Key) {
+		log.FromContext(ctx).Warnf("cache.Put: denied key %s", req.Kv.Key)
+		return nil, grpc.Errorf(codes.FailedPrecondition, "cache.Put: denied key %s", req.Kv.Key)
+	}
+	c.recordNamespace(req.Namespace, func(ns *NamespaceStats) { ns.Puts++ })
+	rule := c.blobPolicy.Rule(req.BlobType)
+	if rule.Compress && !IsCompressed(req.Kv.Value) {
+		v, err := CompressValue(req.Kv.Value)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "cache.Put(%s): %v", req.Kv.Key, err)
+		}
+		if len(v) < len(req.Kv.Value) {
+			req = &cachepb.PutReq{
+				Kv: &cachepb.KV{
+					Key:   req.Kv.Key,
+					Value: v,
+				},
+				WriteBack: req.WriteBack,
+				Namespace: req.Namespace,
+				BlobType:  req.BlobType,
+			}
+		}
+	}
+	err := c.mem.put(ctx, memKey(req.Namespace, req.Kv.Key), req.Kv.Value, 0, time.Duration(rule.TTL))
 
 	if err == errNoChange {
 		return &cachepb.PutResp{}, nil
 	}
-	if c.gcs == nil {
+	if c.gcs == nil || rule.Tier == TierMemory {
 		return &cachepb.PutResp{}, nil
 	}
-	if req.WriteBack {
+	if req.WriteBack || rule.Tier == TierWriteBack {
 		ctx, _ := trace.StartSpanWithRemoteParent(context.Background(), "go.chromium.org/goma/server/cache.Cache.Put.WriteBack", trace.FromContext(ctx).SpanContext())
 		// TODO: pass tag?
 		go func(ctx context.Context) {
@@ -238,39 +434,153 @@ func (c *Cache) Put(ctx context.Context, req *cachepb.PutReq) (*cachepb.PutResp,
 }
 
 // Get gets key-value for requested key.
-// It returns codes.NotFound if value not found in cache.
+// It returns codes.NotFound if value not found in cache, or key is denied.
+// Concurrent requests for the same key missing in memcache are
+// coalesced into one fetch from cloud cache.
 func (c *Cache) Get(ctx context.Context, req *cachepb.GetReq) (*cachepb.GetResp, error) {
-	resp := &cachepb.GetResp{}
-	v, ok := c.mem.Get(ctx, req.Key)
-	if ok {
-		resp.Kv = &cachepb.KV{
-			Key:   req.Key,
-			Value: v,
+	if c.denylist.Contains(req.Key) {
+		log.FromContext(ctx).Warnf("cache.Get: denied key %s", req.Key)
+		return nil, grpc.Errorf(codes.NotFound, "cache.Get: denied key %s", req.Key)
+	}
+	mkey := memKey(req.Namespace, req.Key)
+	e, ok := c.mem.get(ctx, mkey)
+	if ok && (req.Fast || c.gcs == nil || !e.expiresEarly(c.mem.timeNow(), c.earlyExpirationBeta)) {
+		c.recordNamespace(req.Namespace, func(ns *NamespaceStats) {
+			ns.Gets++
+			ns.Hits++
+		})
+		v, err := c.value(req.Key, e.value)
+		if err != nil {
+			return nil, err
 		}
-		resp.InMemory = true
-		return resp, nil
+		return &cachepb.GetResp{
+			Kv: &cachepb.KV{
+				Key:   req.Key,
+				Value: v,
+			},
+			InMemory: true,
+		}, nil
 	}
 
 	if req.Fast || c.gcs == nil {
+		c.recordNamespace(req.Namespace, func(ns *NamespaceStats) { ns.Gets++ })
 		return nil, grpc.Errorf(codes.NotFound, "cache.Get: not found %s", req.Key)
 	}
-	resp, err := c.gcs.Get(ctx, req)
-	if err != nil || resp.Kv == nil {
+	if ok {
+		trace.FromContext(ctx).Annotatef(nil, "early expiration %s", req.Key)
+	}
+	v, err, shared := c.sg.Do(mkey, func() (interface{}, error) {
+		// fetch is shared by concurrent callers, so it must not be
+		// canceled by the caller that happens to start it.
+		ctx, span := trace.StartSpanWithRemoteParent(context.Background(), "go.chromium.org/goma/server/cache.Cache.Get.Fetch", trace.FromContext(ctx).SpanContext())
+		defer span.End()
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		t := time.Now()
+		resp, err := c.gcs.Get(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Kv == nil {
+			return nil, errors.New("no value")
+		}
+		// apply the same TTL as Put by blob type hint recorded
+		// in cloud cache.
+		c.mem.put(ctx, mkey, resp.Kv.Value, time.Since(t), time.Duration(c.blobPolicy.Rule(resp.BlobType).TTL))
+		return resp.Kv.Value, nil
+	})
+	if shared {
+		trace.FromContext(ctx).Annotatef(nil, "shared fetch %s", req.Key)
+	}
+	if err != nil && ok {
+		// early expired entry is still valid.
+		log.FromContext(ctx).Warnf("cache.Get(%s): refresh: %v", req.Key, err)
+		v, err = e.value, nil
+	}
+	if err != nil {
+		c.recordNamespace(req.Namespace, func(ns *NamespaceStats) { ns.Gets++ })
 		return nil, grpc.Errorf(codes.NotFound, "cache.Get(%s): %v", req.Key, err)
 	}
-	c.mem.Put(ctx, req.Key, resp.Kv.Value)
+	c.recordNamespace(req.Namespace, func(ns *NamespaceStats) {
+		ns.Gets++
+		ns.Hits++
+	})
+	value, err := c.value(req.Key, v.([]byte))
+	if err != nil {
+		return nil, err
+	}
+	return &cachepb.GetResp{
+		Kv: &cachepb.KV{
+			Key:   req.Key,
+			Value: value,
+		},
+	}, nil
+}
+
+// value returns value of key to respond.
+// It decompresses value if it has content-encoding marker, even if
+// BlobPolicy no longer compresses values, since it could be compressed
+// by previous policy or by other replicas.
+func (c *Cache) value(key string, value []byte) ([]byte, error) {
+	v, err := DecompressValue(value)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "cache.Get(%s): %v", key, err)
+	}
+	return v, nil
+}
+
+// Exists checks existence of keys in memcache, or in cloud cache
+// if gcs is configured. Denied keys are reported as not exist.
+func (c *Cache) Exists(ctx context.Context, req *cachepb.ExistsReq) (*cachepb.ExistsResp, error) {
+	resp := &cachepb.ExistsResp{
+		Exists: make([]bool, len(req.Keys)),
+	}
+	var missing []string
+	var missingIdx []int
+	for i, key := range req.Keys {
+		if c.denylist.Contains(key) {
+			continue
+		}
+		if _, ok := c.mem.Get(ctx, memKey(req.Namespace, key)); ok {
+			resp.Exists[i] = true
+			continue
+		}
+		missing = append(missing, key)
+		missingIdx = append(missingIdx, i)
+	}
+	if len(missing) == 0 || c.gcs == nil {
+		return resp, nil
+	}
+	gresp, err := c.gcs.Exists(ctx, &cachepb.ExistsReq{
+		Keys:      missing,
+		Namespace: req.Namespace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, ok := range gresp.Exists {
+		resp.Exists[missingIdx[i]] = ok
+	}
 	return resp, nil
 }
 
 type stats struct {
-	Mem memstats
-	GCS gcs.Stats
+	Mem        memstats
+	GCS        gcs.Stats
+	Namespaces map[string]NamespaceStats
 }
 
 func (c *Cache) stats() stats {
+	c.nsmu.Lock()
+	nsstats := make(map[string]NamespaceStats, len(c.nsstats))
+	for k, v := range c.nsstats {
+		nsstats[k] = *v
+	}
+	c.nsmu.Unlock()
 	return stats{
-		Mem: c.mem.stats(),
-		GCS: c.gcs.Stats(),
+		Mem:        c.mem.stats(),
+		GCS:        c.gcs.Stats(),
+		Namespaces: nsstats,
 	}
 }
 
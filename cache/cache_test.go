@@ -6,7 +6,9 @@ package cache
 
 import (
 	"context"
+	"reflect"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -161,3 +163,194 @@ func TestPutReplace(t *testing.T) {
 	}
 
 }
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+	cache, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+	})
+
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+
+	key := "key"
+	c1 := NamespaceClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: cache},
+		Namespace:          "instance1",
+	}
+	c2 := NamespaceClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: cache},
+		Namespace:          "instance2",
+	}
+
+	_, err = c1.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   key,
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("c1.Put(%s): %v", key, err)
+	}
+
+	_, err = c1.Get(ctx, &pb.GetReq{
+		Key: key,
+	})
+	if err != nil {
+		t.Errorf("c1.Get(%s): %v", key, err)
+	}
+
+	_, err = c2.Get(ctx, &pb.GetReq{
+		Key: key,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("c2.Get(%s): got %v, want NotFound error", key, err)
+	}
+
+	st := cache.stats().Namespaces
+	if got, want := st["instance1"], (NamespaceStats{Puts: 1, Gets: 1, Hits: 1}); got != want {
+		t.Errorf("stats[instance1]=%#v; want=%#v", got, want)
+	}
+	if got, want := st["instance2"], (NamespaceStats{Gets: 1}); got != want {
+		t.Errorf("stats[instance2]=%#v; want=%#v", got, want)
+	}
+}
+
+func TestExists(t *testing.T) {
+	ctx := context.Background()
+	cache, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	c1 := NamespaceClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: cache},
+		Namespace:          "instance1",
+	}
+	c2 := NamespaceClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: cache},
+		Namespace:          "instance2",
+	}
+	_, err = c1.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "key1",
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("c1.Put(key1): %v", err)
+	}
+
+	req := &pb.ExistsReq{
+		Keys: []string{"key1", "key2"},
+	}
+	for _, tc := range []struct {
+		name string
+		c    NamespaceClient
+		want []bool
+	}{
+		{
+			name: "c1",
+			c:    c1,
+			want: []bool{true, false},
+		},
+		{
+			name: "c2",
+			c:    c2,
+			want: []bool{false, false},
+		},
+	} {
+		resp, err := tc.c.Exists(ctx, req)
+		if err != nil || !reflect.DeepEqual(resp.GetExists(), tc.want) {
+			t.Errorf("%s.Exists(%q)=%v, %v; want %v, nil", tc.name, req.Keys, resp.GetExists(), err, tc.want)
+		}
+	}
+
+	ok, err := Exists(ctx, c1, "", "key1")
+	if err != nil || !ok {
+		t.Errorf("Exists(c1, key1)=%t, %v; want true, nil", ok, err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, err := New(Config{
+		MaxBytes:  1024 * 1024 * 1024,
+		TTL:       time.Minute,
+		TTLJitter: 0.1,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	now := time.Now()
+	cache.mem.now = func() time.Time { return now }
+
+	key := "key"
+	_, err = cache.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   key,
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("cache.Put(%s): %v", key, err)
+	}
+
+	now = now.Add(50 * time.Second)
+	_, err = cache.Get(ctx, &pb.GetReq{Key: key})
+	if err != nil {
+		t.Errorf("cache.Get(%s) before TTL: %v", key, err)
+	}
+
+	now = now.Add(20 * time.Second)
+	_, err = cache.Get(ctx, &pb.GetReq{Key: key})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("cache.Get(%s) after TTL: %v; want NotFound error", key, err)
+	}
+	st := cache.stats().Mem
+	if st.Expires != 1 || st.Evicts != 0 || st.Bytes != 0 {
+		t.Errorf("Mem.Expires=%d Evicts=%d Bytes=%d; want 1, 0, 0", st.Expires, st.Evicts, st.Bytes)
+	}
+}
+
+func TestExpiresEarly(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		desc string
+		e    *memEntry
+		beta float64
+		want bool
+	}{
+		{
+			desc: "no expire",
+			e:    &memEntry{delta: time.Second},
+			beta: 1,
+		},
+		{
+			desc: "no delta",
+			e:    &memEntry{expire: now.Add(time.Millisecond)},
+			beta: 1,
+		},
+		{
+			desc: "disabled",
+			e:    &memEntry{expire: now, delta: time.Second},
+		},
+		{
+			desc: "expired",
+			e:    &memEntry{expire: now, delta: time.Second},
+			beta: 1,
+			want: true,
+		},
+		{
+			desc: "far from expiry",
+			e:    &memEntry{expire: now.Add(24 * time.Hour), delta: time.Nanosecond},
+			beta: 1,
+		},
+	} {
+		if got := tc.e.expiresEarly(now, tc.beta); got != tc.want {
+			t.Errorf("%s: expiresEarly(now, %f)=%t; want %t", tc.desc, tc.beta, got, tc.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package cache
 import (
 	"context"
 
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 
 	"go.chromium.org/goma/server/rpc"
@@ -65,3 +66,35 @@ func (c Client) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption)
 		})
 	return resp, err
 }
+
+// Exists checks existence of keys.
+// Since keys may be sharded to different backends, it checks each key
+// in parallel.
+func (c Client) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	resp := &pb.ExistsResp{
+		Exists: make([]bool, len(in.Keys)),
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, key := range in.Keys {
+		i, key := i, key
+		eg.Go(func() error {
+			return c.client.Call(ctx, c.client.Shard, key,
+				func(client interface{}) error {
+					r, err := client.(pb.CacheServiceClient).Exists(ctx, &pb.ExistsReq{
+						Keys:      []string{key},
+						Namespace: in.Namespace,
+					}, opts...)
+					if err != nil {
+						return err
+					}
+					resp.Exists[i] = len(r.GetExists()) == 1 && r.Exists[0]
+					return nil
+				})
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
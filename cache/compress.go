@@ -0,0 +1,125 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+// zstdMarker is a content-encoding marker prepended to compressed value.
+// Values stored in cache are serialized protocol buffer messages,
+// which never start with 0x00 (field number 0 is invalid), so values
+// without the marker are treated as uncompressed.
+var zstdMarker = []byte("\x00zst")
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdInit() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdErr
+}
+
+// CompressValue compresses value with zstd and adds content-encoding marker.
+func CompressValue(value []byte) ([]byte, error) {
+	if err := zstdInit(); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, len(zstdMarker), len(zstdMarker)+len(value)/2)
+	copy(buf, zstdMarker)
+	return zstdEncoder.EncodeAll(value, buf), nil
+}
+
+// IsCompressed reports whether value has content-encoding marker.
+func IsCompressed(value []byte) bool {
+	return bytes.HasPrefix(value, zstdMarker)
+}
+
+// DecompressValue decompresses value if it has content-encoding marker.
+// It returns value as is if value is not compressed.
+func DecompressValue(value []byte) ([]byte, error) {
+	if !IsCompressed(value) {
+		return value, nil
+	}
+	if err := zstdInit(); err != nil {
+		return nil, err
+	}
+	v, err := zstdDecoder.DecodeAll(value[len(zstdMarker):], nil)
+	if err != nil {
+		return nil, fmt.Errorf("zstd decode: %v", err)
+	}
+	return v, nil
+}
+
+// CompressClient is a cache service client that compresses values
+// before Put, and decompresses values after Get.
+// Values stored without compression are returned as is, so it could be
+// enabled for existing cache.
+type CompressClient struct {
+	pb.CacheServiceClient
+
+	// MinSize is minimum size of value to compress.
+	// Value smaller than MinSize is stored without compression.
+	MinSize int
+}
+
+// Get gets key-value data for requested key, and decompresses the value.
+func (c CompressClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	resp, err := c.CacheServiceClient.Get(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetKv() == nil {
+		return resp, nil
+	}
+	v, err := DecompressValue(resp.Kv.Value)
+	if err != nil {
+		return nil, fmt.Errorf("cache.Get(%s): %v", in.Key, err)
+	}
+	resp.Kv.Value = v
+	return resp, nil
+}
+
+// Put compresses value and puts key-value data.
+// If compressed value is not smaller than original, it puts original value.
+func (c CompressClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	if in.GetKv() == nil || len(in.Kv.Value) < c.MinSize || IsCompressed(in.Kv.Value) {
+		return c.CacheServiceClient.Put(ctx, in, opts...)
+	}
+	v, err := CompressValue(in.Kv.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) >= len(in.Kv.Value) {
+		return c.CacheServiceClient.Put(ctx, in, opts...)
+	}
+	return c.CacheServiceClient.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   in.Kv.Key,
+			Value: v,
+		},
+		WriteBack: in.WriteBack,
+		Namespace: in.Namespace,
+		BlobType:  in.BlobType,
+	}, opts...)
+}
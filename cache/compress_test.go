@@ -0,0 +1,102 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+func TestCompressClient(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	client := CompressClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: c},
+		MinSize:            16,
+	}
+
+	for _, tc := range []struct {
+		desc           string
+		key            string
+		value          []byte
+		wantCompressed bool
+	}{
+		{
+			desc:  "small",
+			key:   "small",
+			value: []byte("value"),
+		},
+		{
+			desc:           "large",
+			key:            "large",
+			value:          bytes.Repeat([]byte("#include <stdio.h>\n"), 1024),
+			wantCompressed: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := client.Put(ctx, &pb.PutReq{
+				Kv: &pb.KV{
+					Key:   tc.key,
+					Value: tc.value,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Put(%q)=%v; want nil error", tc.key, err)
+			}
+			raw, ok := c.mem.Get(ctx, memKey("", tc.key))
+			if !ok {
+				t.Fatalf("stored %q not found", tc.key)
+			}
+			if got := IsCompressed(raw); got != tc.wantCompressed {
+				t.Errorf("IsCompressed(stored %q)=%t; want %t", tc.key, got, tc.wantCompressed)
+			}
+			resp, err := client.Get(ctx, &pb.GetReq{Key: tc.key})
+			if err != nil {
+				t.Fatalf("Get(%q)=%v; want nil error", tc.key, err)
+			}
+			if !bytes.Equal(resp.Kv.Value, tc.value) {
+				t.Errorf("Get(%q)=%q; want %q", tc.key, resp.Kv.Value, tc.value)
+			}
+		})
+	}
+}
+
+func TestCompressClientUncompressedEntry(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	value := bytes.Repeat([]byte("stored before compression enabled\n"), 100)
+	_, err = c.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "key",
+			Value: value,
+		},
+	})
+	if err != nil {
+		t.Fatalf("cache.Put=%v; want nil error", err)
+	}
+	client := CompressClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: c},
+	}
+	resp, err := client.Get(ctx, &pb.GetReq{Key: "key"})
+	if err != nil {
+		t.Fatalf("Get=%v; want nil error", err)
+	}
+	if !bytes.Equal(resp.Kv.Value, value) {
+		t.Errorf("Get=%q; want %q", resp.Kv.Value, value)
+	}
+}
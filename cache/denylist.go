@@ -0,0 +1,169 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/fswatch"
+	"go.chromium.org/goma/server/log"
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+// Denylist is a list of keys (e.g. digests of poisoned blobs) that
+// must not be served nor stored in cache.
+// A key matches if the key or its last path element (e.g. digest
+// in "cas/<digest>") is in the list.
+// nil Denylist denies nothing.
+type Denylist struct {
+	mu   sync.RWMutex
+	keys map[string]bool
+}
+
+// Set replaces keys in the denylist.
+func (d *Denylist) Set(keys []string) {
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		m[k] = true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = m
+}
+
+// Len returns number of keys in the denylist.
+func (d *Denylist) Len() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.keys)
+}
+
+// Contains reports whether key is denied.
+func (d *Denylist) Contains(key string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.keys) == 0 {
+		return false
+	}
+	return d.keys[key] || d.keys[path.Base(key)]
+}
+
+// Load loads the denylist from fname, which has a key per line.
+// Empty lines and lines starting with '#' are ignored.
+func (d *Denylist) Load(fname string) error {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	d.Set(keys)
+	return nil
+}
+
+// Watch loads the denylist from fname, and reloads it when
+// fname is updated until ctx is done.
+func (d *Denylist) Watch(ctx context.Context, fname string) error {
+	logger := log.FromContext(ctx)
+	err := d.Load(fname)
+	if err != nil {
+		return err
+	}
+	logger.Infof("denylist %s: %d keys", fname, d.Len())
+	watcher, err := fswatch.New(ctx, filepath.Dir(fname))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			ev, err := watcher.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Errorf("denylist watch %s: %v", fname, err)
+				}
+				return
+			}
+			logger.Infof("denylist update: %v", ev)
+			err = d.Load(fname)
+			if err != nil {
+				logger.Errorf("denylist %s: %v", fname, err)
+				continue
+			}
+			logger.Infof("denylist %s: %d keys", fname, d.Len())
+		}
+	}()
+	return nil
+}
+
+// DenylistClient is a cache service client that refuses to get or put
+// keys in Denylist.
+type DenylistClient struct {
+	pb.CacheServiceClient
+
+	Denylist *Denylist
+}
+
+// Get gets key-value data for requested key.
+// It returns codes.NotFound for denied key.
+func (c DenylistClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	if c.Denylist.Contains(in.Key) {
+		log.FromContext(ctx).Warnf("cache.Get: denied key %s", in.Key)
+		return nil, status.Errorf(codes.NotFound, "cache.Get: denied key %s", in.Key)
+	}
+	return c.CacheServiceClient.Get(ctx, in, opts...)
+}
+
+// Put puts key-value data.
+// It returns codes.FailedPrecondition for denied key.
+func (c DenylistClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	if key := in.GetKv().GetKey(); c.Denylist.Contains(key) {
+		log.FromContext(ctx).Warnf("cache.Put: denied key %s", key)
+		return nil, status.Errorf(codes.FailedPrecondition, "cache.Put: denied key %s", key)
+	}
+	return c.CacheServiceClient.Put(ctx, in, opts...)
+}
+
+// Exists checks existence of keys.
+// Denied keys are reported as not exist.
+func (c DenylistClient) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	resp, err := c.CacheServiceClient.Exists(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range in.Keys {
+		if i < len(resp.Exists) && c.Denylist.Contains(key) {
+			resp.Exists[i] = false
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+func TestDenylistLoad(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "denylist")
+	err := os.WriteFile(fname, []byte("# poisoned blobs\n\ndeadbeef\n  cafebabe  \n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Denylist{}
+	err = d.Load(fname)
+	if err != nil {
+		t.Fatalf("Load(%q)=%v; want nil", fname, err)
+	}
+	if got, want := d.Len(), 2; got != want {
+		t.Errorf("Len()=%d; want %d", got, want)
+	}
+	for _, tc := range []struct {
+		key  string
+		want bool
+	}{
+		{key: "deadbeef", want: true},
+		{key: "cafebabe", want: true},
+		{key: "cas/deadbeef", want: true},
+		{key: "# poisoned blobs"},
+		{key: "deadbeef0"},
+		{key: ""},
+	} {
+		if got := d.Contains(tc.key); got != tc.want {
+			t.Errorf("Contains(%q)=%t; want %t", tc.key, got, tc.want)
+		}
+	}
+
+	var nilDenylist *Denylist
+	if nilDenylist.Contains("deadbeef") {
+		t.Errorf("nil denylist Contains(%q)=true; want false", "deadbeef")
+	}
+}
+
+func TestCacheDenylist(t *testing.T) {
+	ctx := context.Background()
+	denylist := &Denylist{}
+	c, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+		Denylist: denylist,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	for _, key := range []string{"poisoned", "good"} {
+		_, err := c.Put(ctx, &pb.PutReq{
+			Kv: &pb.KV{
+				Key:   key,
+				Value: []byte(key),
+			},
+		})
+		if err != nil {
+			t.Fatalf("Put(%q)=%v; want nil", key, err)
+		}
+	}
+	denylist.Set([]string{"poisoned"})
+
+	_, err = c.Get(ctx, &pb.GetReq{Key: "poisoned"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get(poisoned)=_, %v; want NotFound", err)
+	}
+	_, err = c.Get(ctx, &pb.GetReq{Key: "good"})
+	if err != nil {
+		t.Errorf("Get(good)=_, %v; want nil", err)
+	}
+	_, err = c.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "poisoned",
+			Value: []byte("poisoned"),
+		},
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Put(poisoned)=%v; want FailedPrecondition", err)
+	}
+	resp, err := c.Exists(ctx, &pb.ExistsReq{Keys: []string{"poisoned", "good"}})
+	if err != nil {
+		t.Fatalf("Exists=%v; want nil", err)
+	}
+	if resp.Exists[0] || !resp.Exists[1] {
+		t.Errorf("Exists=%v; want [false true]", resp.Exists)
+	}
+}
+
+func TestDenylistClient(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	denylist := &Denylist{}
+	client := DenylistClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: c},
+		Denylist:           denylist,
+	}
+	_, err = client.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "cas/poisoned",
+			Value: []byte("poisoned"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Put=%v; want nil", err)
+	}
+	denylist.Set([]string{"poisoned"})
+
+	_, err = client.Get(ctx, &pb.GetReq{Key: "cas/poisoned"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get(cas/poisoned)=_, %v; want NotFound", err)
+	}
+	_, err = client.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "poisoned",
+			Value: []byte("poisoned"),
+		},
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Put(poisoned)=%v; want FailedPrecondition", err)
+	}
+	resp, err := client.Exists(ctx, &pb.ExistsReq{Keys: []string{"cas/poisoned"}})
+	if err != nil {
+		t.Fatalf("Exists=%v; want nil", err)
+	}
+	if resp.Exists[0] {
+		t.Errorf("Exists=%v; want [false]", resp.Exists)
+	}
+}
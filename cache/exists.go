@@ -0,0 +1,28 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+// Exists reports whether key exists in namespace of c, without
+// fetching its value.
+func Exists(ctx context.Context, c pb.CacheServiceClient, namespace, key string) (bool, error) {
+	resp, err := c.Exists(ctx, &pb.ExistsReq{
+		Keys:      []string{key},
+		Namespace: namespace,
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(resp.GetExists()) != 1 {
+		return false, fmt.Errorf("cache.Exists(%s): unexpected response %d", key, len(resp.GetExists()))
+	}
+	return resp.Exists[0], nil
+}
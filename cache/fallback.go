@@ -0,0 +1,171 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+const (
+	// DefaultRepairConcurrency is default max number of concurrent
+	// repairs of primary cache.
+	DefaultRepairConcurrency = 16
+
+	// fallbackRepairTimeout is timeout to repair an entry in primary cache.
+	fallbackRepairTimeout = 10 * time.Second
+)
+
+// FallbackClient is a cache service client that reads from Fallback
+// when primary cache (e.g. redis) fails, so that outage of primary
+// cache (e.g. Memorystore failover) doesn't fail requests.
+//
+// Get and Exists use Fallback when primary cache returns error other
+// than codes.NotFound, i.e. cache miss in primary cache doesn't fall back.
+// Entries read from Fallback are put in primary cache asynchronously,
+// with blob type hint of the entry so that primary cache applies the
+// same TTL and policy as it was put.
+// Put stores entries in primary cache, and in Fallback only if
+// WriteFallback is set.
+type FallbackClient struct {
+	pb.CacheServiceClient
+
+	Fallback pb.CacheServiceClient
+
+	// WriteFallback makes Put store entries in Fallback too, so that
+	// Fallback (e.g. cloud storage) has all entries as backing store.
+	// Entries are put in Fallback asynchronously not to add latency
+	// of Fallback to Put, or synchronously if primary cache fails.
+	WriteFallback bool
+
+	// RepairConcurrency is max number of concurrent repairs and
+	// asynchronous writes to Fallback.
+	// Ones exceeding it are dropped.
+	// DefaultRepairConcurrency if 0.
+	RepairConcurrency int
+
+	once sync.Once
+	sema chan struct{}
+}
+
+// shouldFallback reports whether err of primary cache should fall back.
+func shouldFallback(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	return status.Code(err) != codes.NotFound
+}
+
+// Get gets key-value data for requested key from primary cache,
+// or from Fallback if primary cache fails.
+func (c *FallbackClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	resp, err := c.CacheServiceClient.Get(ctx, in, opts...)
+	if !shouldFallback(ctx, err) {
+		return resp, err
+	}
+	logger := log.FromContext(ctx)
+	logger.Warnf("cache.Get %s: fallback: %v", in.Key, err)
+	resp, ferr := c.Fallback.Get(ctx, in, opts...)
+	if ferr != nil {
+		if status.Code(ferr) == codes.NotFound {
+			return nil, ferr
+		}
+		logger.Errorf("cache.Get %s: fallback failed: %v", in.Key, ferr)
+		return nil, err
+	}
+	c.repair(ctx, in.Namespace, resp)
+	return resp, nil
+}
+
+// async runs f in background, unless there are too many
+// running already.
+func (c *FallbackClient) async(ctx context.Context, desc string, f func(ctx context.Context) error) {
+	c.once.Do(func() {
+		n := c.RepairConcurrency
+		if n <= 0 {
+			n = DefaultRepairConcurrency
+		}
+		c.sema = make(chan struct{}, n)
+	})
+	logger := log.FromContext(ctx)
+	select {
+	case c.sema <- struct{}{}:
+	default:
+		logger.Warnf("%s: too many in flight. drop", desc)
+		return
+	}
+	go func() {
+		defer func() { <-c.sema }()
+		ctx, cancel := context.WithTimeout(context.Background(), fallbackRepairTimeout)
+		defer cancel()
+		err := f(ctx)
+		if err != nil {
+			logger.Warnf("%s: %v", desc, err)
+		}
+	}()
+}
+
+// repair puts kv of resp in primary cache asynchronously.
+func (c *FallbackClient) repair(ctx context.Context, namespace string, resp *pb.GetResp) {
+	req := &pb.PutReq{
+		Kv:        resp.Kv,
+		Namespace: namespace,
+		BlobType:  resp.BlobType,
+	}
+	c.async(ctx, "cache.Get "+resp.GetKv().GetKey()+": repair", func(ctx context.Context) error {
+		_, err := c.CacheServiceClient.Put(ctx, req)
+		return err
+	})
+}
+
+// Put puts key-value data in primary cache.
+// If WriteFallback is set, it also puts the data in Fallback, and
+// succeeds if the data is stored in either of them.
+func (c *FallbackClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	resp, err := c.CacheServiceClient.Put(ctx, in, opts...)
+	if !c.WriteFallback {
+		return resp, err
+	}
+	if err == nil {
+		c.async(ctx, "cache.Put "+in.GetKv().GetKey()+": fallback", func(ctx context.Context) error {
+			_, err := c.Fallback.Put(ctx, in)
+			return err
+		})
+		return resp, nil
+	}
+	logger := log.FromContext(ctx)
+	_, ferr := c.Fallback.Put(ctx, in, opts...)
+	if ferr != nil {
+		logger.Errorf("cache.Put %s: fallback failed: %v", in.GetKv().GetKey(), ferr)
+		return nil, err
+	}
+	logger.Warnf("cache.Put %s: stored only in fallback: %v", in.GetKv().GetKey(), err)
+	return &pb.PutResp{}, nil
+}
+
+// Exists checks existence of keys in primary cache,
+// or in Fallback if primary cache fails.
+func (c *FallbackClient) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	resp, err := c.CacheServiceClient.Exists(ctx, in, opts...)
+	if !shouldFallback(ctx, err) {
+		return resp, err
+	}
+	logger := log.FromContext(ctx)
+	logger.Warnf("cache.Exists: fallback: %v", err)
+	resp, ferr := c.Fallback.Exists(ctx, in, opts...)
+	if ferr != nil {
+		logger.Errorf("cache.Exists: fallback failed: %v", ferr)
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+// flakyClient is a cache service client that fails to read while down,
+// and fails to put while putDown.
+type flakyClient struct {
+	pb.CacheServiceClient
+	down    int32
+	putDown int32
+}
+
+var errConnReset = errors.New("connection reset by peer")
+
+func (c *flakyClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	if atomic.LoadInt32(&c.down) != 0 {
+		return nil, errConnReset
+	}
+	return c.CacheServiceClient.Get(ctx, in, opts...)
+}
+
+func (c *flakyClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	if atomic.LoadInt32(&c.putDown) != 0 {
+		return nil, errConnReset
+	}
+	return c.CacheServiceClient.Put(ctx, in, opts...)
+}
+
+func (c *flakyClient) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	if atomic.LoadInt32(&c.down) != 0 {
+		return nil, errConnReset
+	}
+	return c.CacheServiceClient.Exists(ctx, in, opts...)
+}
+
+func TestFallbackClient(t *testing.T) {
+	ctx := context.Background()
+	newCache := func() *Cache {
+		t.Helper()
+		c, err := New(Config{
+			MaxBytes: 1024 * 1024,
+		})
+		if err != nil {
+			t.Fatalf("cache.New(...): %v", err)
+		}
+		return c
+	}
+	pc := newCache()
+	fc := newCache()
+	primary := &flakyClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: pc},
+	}
+	client := &FallbackClient{
+		CacheServiceClient: primary,
+		Fallback:           LocalClient{CacheServiceServer: fc},
+		WriteFallback:      true,
+	}
+	waitFor := func(c *Cache, key string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, err := c.Get(ctx, &pb.GetReq{Key: key})
+			if err == nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Get(%s)=%v; want stored", key, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	_, err := client.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "key",
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Put=%v; want nil error", err)
+	}
+	_, err = pc.Get(ctx, &pb.GetReq{Key: "key"})
+	if err != nil {
+		t.Errorf("primary Get(stored)=%v; want nil error", err)
+	}
+	// written to fallback asynchronously.
+	waitFor(fc, "key")
+
+	// miss in primary cache doesn't fall back.
+	_, err = fc.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "fallback-only",
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get(ctx, &pb.GetReq{Key: "fallback-only"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get(fallback-only)=%v; want %v", err, codes.NotFound)
+	}
+
+	// primary cache fails to read, and is repaired by fallback.
+	atomic.StoreInt32(&primary.down, 1)
+	resp, err := client.Get(ctx, &pb.GetReq{Key: "fallback-only"})
+	if err != nil {
+		t.Fatalf("Get(primary down)=%v; want nil error", err)
+	}
+	if got, want := string(resp.Kv.Value), "value"; got != want {
+		t.Errorf("Get(primary down)=%q; want %q", got, want)
+	}
+	waitFor(pc, "fallback-only")
+	eresp, err := client.Exists(ctx, &pb.ExistsReq{Keys: []string{"fallback-only", "unknown"}})
+	if err != nil {
+		t.Fatalf("Exists(primary down)=%v; want nil error", err)
+	}
+	if !eresp.Exists[0] || eresp.Exists[1] {
+		t.Errorf("Exists(primary down)=%v; want [true false]", eresp.Exists)
+	}
+	_, err = client.Get(ctx, &pb.GetReq{Key: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get(unknown)=%v; want %v", err, codes.NotFound)
+	}
+
+	// primary cache fails to put.
+	atomic.StoreInt32(&primary.putDown, 1)
+	_, err = client.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "put-while-down",
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Put(primary down)=%v; want nil error", err)
+	}
+	_, err = fc.Get(ctx, &pb.GetReq{Key: "put-while-down"})
+	if err != nil {
+		t.Errorf("fallback Get(put-while-down)=%v; want nil error", err)
+	}
+}
+
+// recordingClient is a cache service client that records put requests.
+type recordingClient struct {
+	pb.CacheServiceClient
+	puts chan *pb.PutReq
+}
+
+func (c *recordingClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	c.puts <- in
+	return c.CacheServiceClient.Put(ctx, in, opts...)
+}
+
+func TestFallbackClientNoWriteFallback(t *testing.T) {
+	ctx := context.Background()
+	pc, err := New(Config{MaxBytes: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	fallback := &recordingClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: pc},
+		puts:               make(chan *pb.PutReq, 1),
+	}
+	client := &FallbackClient{
+		CacheServiceClient: LocalClient{CacheServiceServer: pc},
+		Fallback:           fallback,
+	}
+	_, err = client.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "key",
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Put=%v; want nil error", err)
+	}
+	select {
+	case req := <-fallback.puts:
+		t.Errorf("fallback Put(%s); want no put without WriteFallback", req.Kv.Key)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// blobTypeClient is a cache service client that returns values
+// with blob type.
+type blobTypeClient struct {
+	pb.CacheServiceClient
+	blobType string
+}
+
+func (c blobTypeClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	resp, err := c.CacheServiceClient.Get(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	resp.BlobType = c.blobType
+	return resp, nil
+}
+
+func TestFallbackClientRepairBlobType(t *testing.T) {
+	ctx := context.Background()
+	newCache := func() *Cache {
+		t.Helper()
+		c, err := New(Config{MaxBytes: 1024 * 1024})
+		if err != nil {
+			t.Fatalf("cache.New(...): %v", err)
+		}
+		return c
+	}
+	pc := newCache()
+	fc := newCache()
+	_, err := fc.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "pch",
+			Value: []byte("value"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := &recordingClient{
+		CacheServiceClient: &flakyClient{
+			CacheServiceClient: LocalClient{CacheServiceServer: pc},
+			down:               1,
+		},
+		puts: make(chan *pb.PutReq, 1),
+	}
+	client := &FallbackClient{
+		CacheServiceClient: primary,
+		Fallback: blobTypeClient{
+			CacheServiceClient: LocalClient{CacheServiceServer: fc},
+			blobType:           BlobTypePCH,
+		},
+	}
+	_, err = client.Get(ctx, &pb.GetReq{Key: "pch"})
+	if err != nil {
+		t.Fatalf("Get(primary down)=%v; want nil error", err)
+	}
+	select {
+	case req := <-primary.puts:
+		if req.Kv.Key != "pch" || req.BlobType != BlobTypePCH {
+			t.Errorf("repair Put(%s, blob_type=%q); want Put(pch, blob_type=%q)", req.Kv.Key, req.BlobType, BlobTypePCH)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("no repair; want repair")
+	}
+}
@@ -15,11 +15,15 @@ import (
 	"hash/crc32"
 	"io"
 	"math/rand"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"go.opencensus.io/trace"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 
 	"go.chromium.org/goma/server/log"
 	pb "go.chromium.org/goma/server/proto/cache"
@@ -34,12 +38,38 @@ type nullAdmissionController struct{}
 
 func (nullAdmissionController) AdmitPut(context.Context, *pb.PutReq) error { return nil }
 
+// Default sizes for large values.
+const (
+	DefaultResumableUploadThreshold = 8 * 1024 * 1024
+	DefaultUploadChunkSize          = googleapi.DefaultUploadChunkSize
+	DefaultParallelReadThreshold    = 32 * 1024 * 1024
+	DefaultReadChunkSize            = 8 * 1024 * 1024
+	DefaultReadParallelism          = 8
+)
+
 // Cache represents key-value cache using google cloud storage.
 type Cache struct {
 	pb.UnimplementedCacheServiceServer
 
 	bkt                 *storage.BucketHandle
 	AdmissionController AdmissionController
+
+	// ResumableUploadThreshold is a size of value to upload with
+	// resumable upload. Value smaller than this is uploaded in
+	// single request.
+	ResumableUploadThreshold int
+	// UploadChunkSize is a chunk size of resumable upload.
+	UploadChunkSize int
+
+	// ParallelReadThreshold is a size of object to read by parallel
+	// ranged reads.
+	ParallelReadThreshold int64
+	// ReadChunkSize is a size of each ranged read.
+	ReadChunkSize int64
+	// ReadParallelism is max number of concurrent ranged reads
+	// for an object.
+	ReadParallelism int
+
 	// should be accessed via stomic pkg.
 	nhit, nget int64
 }
@@ -47,8 +77,13 @@ type Cache struct {
 // New creates new cache.
 func New(bkt *storage.BucketHandle) *Cache {
 	return &Cache{
-		bkt:                 bkt,
-		AdmissionController: nullAdmissionController{},
+		bkt:                      bkt,
+		AdmissionController:      nullAdmissionController{},
+		ResumableUploadThreshold: DefaultResumableUploadThreshold,
+		UploadChunkSize:          DefaultUploadChunkSize,
+		ParallelReadThreshold:    DefaultParallelReadThreshold,
+		ReadChunkSize:            DefaultReadChunkSize,
+		ReadParallelism:          DefaultReadParallelism,
 	}
 }
 
@@ -82,7 +117,12 @@ func checkAttrs(attr *storage.ObjectAttrs, value []byte) error {
 	return nil
 }
 
-func (c *Cache) put(ctx context.Context, obj *storage.ObjectHandle, key string, value []byte, t time.Time) (*pb.PutResp, error) {
+// blobTypeMetadata is a metadata key of object to record blob type hint
+// of PutReq, so that value fetched from cloud storage could be cached
+// with the same policy as it was put.
+const blobTypeMetadata = "goma-blob-type"
+
+func (c *Cache) put(ctx context.Context, obj *storage.ObjectHandle, key string, value []byte, blobType string, t time.Time) (*pb.PutResp, error) {
 	logger := log.FromContext(ctx)
 	attr, err := obj.Attrs(ctx)
 	if err == nil {
@@ -102,15 +142,31 @@ func (c *Cache) put(ctx context.Context, obj *storage.ObjectHandle, key string,
 	w := obj.NewWriter(ctx)
 	w.CRC32C = crc32.Checksum(value, crc32cTable)
 	w.SendCRC32C = true
-	w.ChunkSize = len(value)
-	if w.ChunkSize > googleapi.DefaultUploadChunkSize {
-		w.ChunkSize = googleapi.DefaultUploadChunkSize
+	if blobType != "" {
+		w.Metadata = map[string]string{blobTypeMetadata: blobType}
 	}
-
-	if _, err := w.Write(value); err != nil {
-		w.CloseWithError(err)
-		logger.Errorf("gcs.put   %s %d %s: write:%v", key, len(value), time.Since(t), err)
-		return nil, err
+	// ChunkSize=0 uploads value in single request.
+	w.ChunkSize = 0
+	chunkSize := len(value)
+	if c.ResumableUploadThreshold > 0 && len(value) >= c.ResumableUploadThreshold {
+		// resumable upload: each chunk is sent in separate request
+		// and retried by the storage client on transient failure.
+		chunkSize = c.UploadChunkSize
+		if chunkSize <= 0 {
+			chunkSize = DefaultUploadChunkSize
+		}
+		w.ChunkSize = chunkSize
+	}
+	for off := 0; off < len(value); off += chunkSize {
+		end := off + chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		if _, err := w.Write(value[off:end]); err != nil {
+			w.CloseWithError(err)
+			logger.Errorf("gcs.put   %s %d %s: write at %d:%v", key, len(value), time.Since(t), off, err)
+			return nil, err
+		}
 	}
 	if err := w.Close(); err != nil {
 		logger.Errorf("gcs.put   %s %d %s: close:%v", key, len(value), time.Since(t), err)
@@ -121,19 +177,38 @@ func (c *Cache) put(ctx context.Context, obj *storage.ObjectHandle, key string,
 	return &pb.PutResp{}, nil
 }
 
+// objectName returns object name for key in namespace.
+func objectName(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return namespace + "/" + key
+}
+
 func (c *Cache) Put(ctx context.Context, in *pb.PutReq) (*pb.PutResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/gcs.Cache.Put")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", in.Namespace),
+		trace.StringAttribute("key", in.Kv.Key),
+		trace.Int64Attribute("size", int64(len(in.Kv.Value))),
+	)
 	logger := log.FromContext(ctx)
 	if err := c.AdmissionController.AdmitPut(ctx, in); err != nil {
 		logger.Warnf("admission error: %v", err)
+		span.Annotatef(nil, "admission error: %v", err)
 		return nil, err
 	}
 	key := in.Kv.Key
 	value := in.Kv.Value
 	t := time.Now()
 
-	obj := c.bkt.Object(key)
+	obj := c.bkt.Object(objectName(in.Namespace, key))
 	for retry := 0; ; retry++ {
-		resp, err := c.put(ctx, obj, key, value, t)
+		resp, err := c.put(ctx, obj, key, value, in.BlobType, t)
+		if err != nil {
+			span.Annotatef(nil, "put %d: %v", retry, err)
+		}
 		if err == nil {
 			return resp, err
 		}
@@ -171,38 +246,46 @@ func (c *Cache) Put(ctx context.Context, in *pb.PutReq) (*pb.PutResp, error) {
 }
 
 func (c *Cache) Get(ctx context.Context, in *pb.GetReq) (*pb.GetResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/gcs.Cache.Get")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", in.Namespace),
+		trace.StringAttribute("key", in.Key),
+	)
 	logger := log.FromContext(ctx)
 	key := in.Key
 
 	t := time.Now()
 
 	atomic.AddInt64(&c.nget, 1)
-	obj := c.bkt.Object(key)
+	obj := c.bkt.Object(objectName(in.Namespace, key))
 	attr, err := obj.Attrs(ctx)
 	if err == storage.ErrObjectNotExist {
+		span.Annotatef(nil, "miss")
 		logger.Infof("gcs.miss  %s %s: %v", key, time.Since(t), err)
 		return nil, err
 	}
 	if err != nil {
+		span.Annotatef(nil, "attrs: %v", err)
 		logger.Errorf("gcs.attrs %s %s: %v", key, time.Since(t), err)
 		return nil, err
 	}
+	span.AddAttributes(trace.Int64Attribute("size", attr.Size))
 
-	r, err := obj.NewReader(ctx)
-	if err != nil {
-		logger.Errorf("gcs.miss  %s %s: %v", key, time.Since(t), err)
-		return nil, err
+	var b []byte
+	if c.ParallelReadThreshold > 0 && attr.Size >= c.ParallelReadThreshold {
+		b, err = c.readParallel(ctx, obj.Generation(attr.Generation), attr.Size)
+	} else {
+		b, err = readAll(ctx, obj, attr.Size)
 	}
-	defer r.Close()
-
-	b := make([]byte, attr.Size)
-	_, err = io.ReadFull(r, b)
 	if err != nil {
+		span.Annotatef(nil, "read: %v", err)
 		logger.Errorf("gcs.miss  %s %s: %v", key, time.Since(t), err)
 		return nil, err
 	}
 	err = checkAttrs(attr, b)
 	if err != nil {
+		span.Annotatef(nil, "bad: %v", err)
 		logger.Errorf("gcs.bad   %s %d %s: %v", key, len(b), time.Since(t), err)
 		return nil, fmt.Errorf("key:%s %v", key, err)
 	}
@@ -213,9 +296,146 @@ func (c *Cache) Get(ctx context.Context, in *pb.GetReq) (*pb.GetResp, error) {
 			Key:   key,
 			Value: b,
 		},
+		BlobType: attr.Metadata[blobTypeMetadata],
 	}, nil
 }
 
+// Exists checks existence of keys, by checking object attributes
+// without reading the objects.
+func (c *Cache) Exists(ctx context.Context, in *pb.ExistsReq) (*pb.ExistsResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/gcs.Cache.Exists")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", in.Namespace),
+		trace.Int64Attribute("keys", int64(len(in.Keys))),
+	)
+	resp := &pb.ExistsResp{
+		Exists: make([]bool, len(in.Keys)),
+	}
+	for i, key := range in.Keys {
+		attr, err := c.bkt.Object(objectName(in.Namespace, key)).Attrs(ctx)
+		if err == storage.ErrObjectNotExist {
+			continue
+		}
+		if err != nil {
+			span.Annotatef(nil, "attrs %s: %v", key, err)
+			return nil, err
+		}
+		resp.Exists[i] = attr.Size > 0
+	}
+	return resp, nil
+}
+
+func readAll(ctx context.Context, obj *storage.ObjectHandle, size int64) ([]byte, error) {
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b := make([]byte, size)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readParallel reads object of size by parallel ranged reads.
+// obj should be bound to the generation to read, so that all ranges
+// are read from the same content.
+func (c *Cache) readParallel(ctx context.Context, obj *storage.ObjectHandle, size int64) ([]byte, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/gcs.Cache.readParallel")
+	defer span.End()
+	chunkSize := c.ReadChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultReadChunkSize
+	}
+	parallelism := c.ReadParallelism
+	if parallelism <= 0 {
+		parallelism = DefaultReadParallelism
+	}
+	span.AddAttributes(
+		trace.Int64Attribute("size", size),
+		trace.Int64Attribute("chunk_size", chunkSize),
+		trace.Int64Attribute("parallelism", int64(parallelism)),
+	)
+	b := make([]byte, size)
+	sema := make(chan struct{}, parallelism)
+	eg, ctx := errgroup.WithContext(ctx)
+	for off := int64(0); off < size; off += chunkSize {
+		off := off
+		length := chunkSize
+		if off+length > size {
+			length = size - off
+		}
+		eg.Go(func() error {
+			select {
+			case sema <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sema }()
+			r, err := obj.NewRangeReader(ctx, off, length)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			_, err = io.ReadFull(r, b[off:off+length])
+			if err != nil {
+				return fmt.Errorf("read at %d: %v", off, err)
+			}
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// List calls f for each key in namespace in lexicographical order.
+// If startAfter is not empty, it lists keys after startAfter.
+func (c *Cache) List(ctx context.Context, namespace, startAfter string, f func(key string) error) error {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/gcs.Cache.List")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("namespace", namespace))
+	var nkeys int64
+	defer func() {
+		span.AddAttributes(trace.Int64Attribute("keys", nkeys))
+	}()
+	prefix := objectName(namespace, "")
+	q := &storage.Query{
+		Prefix: prefix,
+	}
+	if startAfter != "" {
+		q.StartOffset = prefix + startAfter
+	}
+	err := q.SetAttrSelection([]string{"Name"})
+	if err != nil {
+		return err
+	}
+	it := c.bkt.Objects(ctx, q)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key := strings.TrimPrefix(attrs.Name, prefix)
+		if key == startAfter || strings.Contains(key, "/") {
+			// StartOffset is inclusive, or key in other namespace.
+			continue
+		}
+		nkeys++
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+}
+
 // Stats represents stats of gcs.Cache.
 // TODO: use opencensus stats, view.
 type Stats struct {
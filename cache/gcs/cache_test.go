@@ -5,9 +5,24 @@
 package gcs
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
+	"fmt"
 	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+	"go.chromium.org/goma/server/testing/fakegcs"
 )
 
 // hash value was retrieved from
@@ -53,3 +68,268 @@ int main(int argc, char *argv[]) {
 		}
 	}
 }
+
+func TestCacheFakeGCS(t *testing.T) {
+	ctx := context.Background()
+	s := fakegcs.NewServer(t)
+	s.CreateBucket("cache")
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint(s.Endpoint()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	c := New(client.Bucket("cache"))
+	c.ResumableUploadThreshold = 1024
+	c.UploadChunkSize = 256 * 1024
+	c.ParallelReadThreshold = 1024
+	c.ReadChunkSize = 300 * 1024
+
+	small := []byte("hello")
+	large := bytes.Repeat([]byte("0123456789"), 100*1024)
+	for _, kv := range []*pb.KV{
+		{Key: "small", Value: small},
+		{Key: "large", Value: large},
+	} {
+		_, err := c.Put(ctx, &pb.PutReq{Namespace: "ns", Kv: kv})
+		if err != nil {
+			t.Fatalf("Put(%s)=_, %v; want nil error", kv.Key, err)
+		}
+		got, ok := s.GetObject("cache", "ns/"+kv.Key)
+		if !ok || !bytes.Equal(got, kv.Value) {
+			t.Errorf("object ns/%s=%d bytes, %t; want %d bytes, true", kv.Key, len(got), ok, len(kv.Value))
+		}
+		resp, err := c.Get(ctx, &pb.GetReq{Namespace: "ns", Key: kv.Key})
+		if err != nil {
+			t.Fatalf("Get(%s)=_, %v; want nil error", kv.Key, err)
+		}
+		if !bytes.Equal(resp.GetKv().GetValue(), kv.Value) {
+			t.Errorf("Get(%s)=%d bytes; want %d bytes", kv.Key, len(resp.GetKv().GetValue()), len(kv.Value))
+		}
+	}
+
+	_, err = c.Get(ctx, &pb.GetReq{Namespace: "ns", Key: "missing"})
+	if err != storage.ErrObjectNotExist {
+		t.Errorf("Get(missing)=_, %v; want %v", err, storage.ErrObjectNotExist)
+	}
+
+	var keys []string
+	err = c.List(ctx, "ns", "", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List=%v; want nil error", err)
+	}
+	if len(keys) != 2 || keys[0] != "large" || keys[1] != "small" {
+		t.Errorf("List=%q; want [large small]", keys)
+	}
+}
+
+func TestCacheBlobType(t *testing.T) {
+	ctx := context.Background()
+	s := fakegcs.NewServer(t)
+	s.CreateBucket("cache")
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint(s.Endpoint()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	c := New(client.Bucket("cache"))
+
+	for _, req := range []*pb.PutReq{
+		{Kv: &pb.KV{Key: "pch", Value: []byte("pch")}, BlobType: "pch"},
+		{Kv: &pb.KV{Key: "unknown", Value: []byte("unknown")}},
+	} {
+		_, err := c.Put(ctx, req)
+		if err != nil {
+			t.Fatalf("Put(%s)=_, %v; want nil error", req.Kv.Key, err)
+		}
+		resp, err := c.Get(ctx, &pb.GetReq{Key: req.Kv.Key})
+		if err != nil || !bytes.Equal(resp.GetKv().GetValue(), req.Kv.Value) || resp.GetBlobType() != req.BlobType {
+			t.Errorf("Get(%s)=%q, %q, %v; want %q, %q, nil", req.Kv.Key, resp.GetKv().GetValue(), resp.GetBlobType(), err, req.Kv.Value, req.BlobType)
+		}
+	}
+}
+
+// recordingGCS is fake GCS server that records upload chunks and
+// ranged reads, and fails ranged reads at failOffset if it is not negative.
+type recordingGCS struct {
+	*fakegcs.Server
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	chunks     []string // Content-Range of resumable upload chunks.
+	ranges     []string // Range of reads.
+	failOffset int64
+}
+
+func newRecordingGCS(t *testing.T) *recordingGCS {
+	s := &recordingGCS{
+		Server:     fakegcs.NewServer(t),
+		failOffset: -1,
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		failOffset := s.failOffset
+		if cr := req.Header.Get("Content-Range"); cr != "" {
+			s.chunks = append(s.chunks, cr)
+		}
+		r := req.Header.Get("Range")
+		if r != "" {
+			s.ranges = append(s.ranges, r)
+		}
+		s.mu.Unlock()
+		if failOffset >= 0 && strings.HasPrefix(r, fmt.Sprintf("bytes=%d-", failOffset)) {
+			http.Error(w, "injected failure", http.StatusForbidden)
+			return
+		}
+		s.Server.ServeHTTP(w, req)
+	}))
+	t.Cleanup(s.srv.Close)
+	s.CreateBucket("cache")
+	return s
+}
+
+func (s *recordingGCS) newCache(ctx context.Context, t *testing.T) *Cache {
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint(s.srv.URL+"/storage/v1/"),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return New(client.Bucket("cache"))
+}
+
+func (s *recordingGCS) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks = nil
+	s.ranges = nil
+}
+
+func testValue(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestCachePutChunks(t *testing.T) {
+	ctx := context.Background()
+	s := newRecordingGCS(t)
+	c := s.newCache(ctx, t)
+	// storage client requires chunk size of multiple of 256KiB.
+	const chunkSize = 256 * 1024
+	c.ResumableUploadThreshold = chunkSize
+	c.UploadChunkSize = chunkSize
+
+	for _, tc := range []struct {
+		size       int
+		wantChunks []string
+	}{
+		{size: chunkSize - 1}, // single request.
+		{
+			size: chunkSize,
+			// client doesn't know it is the last chunk until
+			// it reads EOF, so it finalizes with empty chunk.
+			wantChunks: []string{"bytes 0-262143/*", "bytes */262144"},
+		},
+		{
+			size:       chunkSize + 1,
+			wantChunks: []string{"bytes 0-262143/*", "bytes 262144-262144/262145"},
+		},
+		{
+			size:       2 * chunkSize,
+			wantChunks: []string{"bytes 0-262143/*", "bytes 262144-524287/*", "bytes */524288"},
+		},
+		{
+			size:       2*chunkSize + 1,
+			wantChunks: []string{"bytes 0-262143/*", "bytes 262144-524287/*", "bytes 524288-524288/524289"},
+		},
+	} {
+		s.reset()
+		key := fmt.Sprintf("value-%d", tc.size)
+		value := testValue(tc.size)
+		_, err := c.Put(ctx, &pb.PutReq{Kv: &pb.KV{Key: key, Value: value}})
+		if err != nil {
+			t.Errorf("Put(%s)=_, %v; want nil error", key, err)
+			continue
+		}
+		got, ok := s.GetObject("cache", key)
+		if !ok || !bytes.Equal(got, value) {
+			t.Errorf("object %s=%d bytes, %t; want %d bytes, true", key, len(got), ok, len(value))
+		}
+		s.mu.Lock()
+		chunks := s.chunks
+		s.mu.Unlock()
+		if diff := cmp.Diff(tc.wantChunks, chunks); diff != "" {
+			t.Errorf("Put(%s): chunks diff -want +got:\n%s", key, diff)
+		}
+	}
+}
+
+func TestCacheReadParallel(t *testing.T) {
+	ctx := context.Background()
+	s := newRecordingGCS(t)
+	c := s.newCache(ctx, t)
+	const chunkSize = 1000
+	c.ParallelReadThreshold = 1
+	c.ReadChunkSize = chunkSize
+	c.ReadParallelism = 2
+
+	for _, size := range []int{chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize, 3*chunkSize + 1} {
+		key := fmt.Sprintf("value-%d", size)
+		value := testValue(size)
+		s.PutObject("cache", key, value)
+		s.reset()
+		resp, err := c.Get(ctx, &pb.GetReq{Key: key})
+		if err != nil {
+			t.Errorf("Get(%s)=_, %v; want nil error", key, err)
+			continue
+		}
+		if !bytes.Equal(resp.GetKv().GetValue(), value) {
+			t.Errorf("Get(%s)=%d bytes; want %d bytes", key, len(resp.GetKv().GetValue()), size)
+		}
+		var want []string
+		for off := 0; off < size; off += chunkSize {
+			end := off + chunkSize
+			if end > size {
+				end = size
+			}
+			want = append(want, fmt.Sprintf("bytes=%d-%d", off, end-1))
+		}
+		s.mu.Lock()
+		got := append([]string(nil), s.ranges...)
+		s.mu.Unlock()
+		sort.Strings(got)
+		sort.Strings(want)
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Get(%s): ranges diff -want +got:\n%s", key, diff)
+		}
+	}
+}
+
+func TestCacheReadParallelError(t *testing.T) {
+	ctx := context.Background()
+	s := newRecordingGCS(t)
+	c := s.newCache(ctx, t)
+	const chunkSize = 1000
+	c.ParallelReadThreshold = 1
+	c.ReadChunkSize = chunkSize
+	c.ReadParallelism = 2
+
+	s.PutObject("cache", "value", testValue(5*chunkSize))
+	s.mu.Lock()
+	s.failOffset = 2 * chunkSize
+	s.mu.Unlock()
+	resp, err := c.Get(ctx, &pb.GetReq{Key: "value"})
+	if err == nil {
+		t.Errorf("Get(value)=%d bytes, nil; want error", len(resp.GetKv().GetValue()))
+	}
+}
@@ -26,3 +26,7 @@ func (c LocalClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOp
 func (c LocalClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
 	return c.CacheServiceServer.Put(ctx, in)
 }
+
+func (c LocalClient) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	return c.CacheServiceServer.Exists(ctx, in)
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+// NamespaceClient is a cache service client that sets Namespace
+// to requests without namespace.
+type NamespaceClient struct {
+	pb.CacheServiceClient
+
+	// Namespace is a namespace to partition keys,
+	// e.g. remote instance name or tenant name.
+	Namespace string
+}
+
+// Get gets key-value data for requested key in the namespace.
+func (c NamespaceClient) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	if in.Namespace != "" || c.Namespace == "" {
+		return c.CacheServiceClient.Get(ctx, in, opts...)
+	}
+	return c.CacheServiceClient.Get(ctx, &pb.GetReq{
+		Key:       in.Key,
+		Fast:      in.Fast,
+		Namespace: c.Namespace,
+	}, opts...)
+}
+
+// Put puts new key-value data in the namespace.
+func (c NamespaceClient) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	if in.Namespace != "" || c.Namespace == "" {
+		return c.CacheServiceClient.Put(ctx, in, opts...)
+	}
+	return c.CacheServiceClient.Put(ctx, &pb.PutReq{
+		Kv:        in.Kv,
+		WriteBack: in.WriteBack,
+		Namespace: c.Namespace,
+		BlobType:  in.BlobType,
+	}, opts...)
+}
+
+// Exists checks existence of keys in the namespace.
+func (c NamespaceClient) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	if in.Namespace != "" || c.Namespace == "" {
+		return c.CacheServiceClient.Exists(ctx, in, opts...)
+	}
+	return c.CacheServiceClient.Exists(ctx, &pb.ExistsReq{
+		Keys:      in.Keys,
+		Namespace: c.Namespace,
+	}, opts...)
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Tiers of BlobPolicyRule.
+const (
+	// TierDefault stores entries in memory and in cloud storage
+	// (if configured), as requested by PutReq.WriteBack.
+	TierDefault = ""
+
+	// TierMemory stores entries in memory only.
+	TierMemory = "memory"
+
+	// TierWriteBack stores entries in memory, and writes back to
+	// cloud storage asynchronously.
+	TierWriteBack = "write-back"
+)
+
+// BlobPolicy is caching policy per blob type hint of PutReq,
+// so that storage is spent for blobs with high probability of reuse.
+//
+// It is loaded from JSON config, e.g.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "blob_type": "pch",
+//	      "ttl": "10m",
+//	      "tier": "memory"
+//	    },
+//	    {
+//	      "blob_type": "depfile",
+//	      "compress": true
+//	    },
+//	    {
+//	      "blob_type": "object",
+//	      "ttl": "1h",
+//	      "tier": "write-back",
+//	      "compress": true
+//	    }
+//	  ]
+//	}
+type BlobPolicy struct {
+	// Rules are checked in order, and the first matched rule is applied.
+	Rules []BlobPolicyRule `json:"rules"`
+}
+
+// BlobPolicyRule is a rule of BlobPolicy.
+type BlobPolicyRule struct {
+	// BlobType matches blob type hint. empty matches any blob type,
+	// including unknown blob type.
+	BlobType string `json:"blob_type,omitempty"`
+
+	// TTL is time to live of entries in memory.
+	// 0 means Config.TTL.
+	TTL Duration `json:"ttl,omitempty"`
+
+	// Tier is storage tier of entries. See Tier* constants.
+	Tier string `json:"tier,omitempty"`
+
+	// Compress compresses values with zstd if it reduces size.
+	Compress bool `json:"compress,omitempty"`
+}
+
+// Duration is time.Duration represented in JSON as string, e.g. "10m".
+type Duration time.Duration
+
+// MarshalJSON marshals d as string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON unmarshals d from string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadBlobPolicy loads BlobPolicy from JSON file fname.
+func LoadBlobPolicy(fname string) (*BlobPolicy, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	p := &BlobPolicy{}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return p, nil
+}
+
+// Validate checks p is valid.
+func (p *BlobPolicy) Validate() error {
+	for i, r := range p.Rules {
+		if r.TTL < 0 {
+			return fmt.Errorf("rule %d: negative ttl %s", i, time.Duration(r.TTL))
+		}
+		switch r.Tier {
+		case TierDefault, TierMemory, TierWriteBack:
+		default:
+			return fmt.Errorf("rule %d: unknown tier %q", i, r.Tier)
+		}
+	}
+	return nil
+}
+
+// Rule returns the first rule matched with blobType.
+// It returns zero rule (i.e. default policy) if no rule matches,
+// or p is nil.
+func (p *BlobPolicy) Rule(blobType string) BlobPolicyRule {
+	if p == nil {
+		return BlobPolicyRule{}
+	}
+	for _, r := range p.Rules {
+		if r.BlobType == "" || r.BlobType == blobType {
+			return r
+		}
+	}
+	return BlobPolicyRule{}
+}
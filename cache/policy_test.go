@@ -0,0 +1,272 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+	"go.chromium.org/goma/server/testing/fakegcs"
+)
+
+func TestLoadBlobPolicy(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "policy.json")
+	err := os.WriteFile(fname, []byte(`{
+  "rules": [
+    {"blob_type": "pch", "ttl": "10m", "tier": "memory"},
+    {"blob_type": "depfile", "compress": true},
+    {"ttl": "1h", "tier": "write-back"}
+  ]
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadBlobPolicy(fname)
+	if err != nil {
+		t.Fatalf("LoadBlobPolicy(%q)=_, %v; want nil error", fname, err)
+	}
+	for _, tc := range []struct {
+		blobType string
+		want     BlobPolicyRule
+	}{
+		{
+			blobType: BlobTypePCH,
+			want:     BlobPolicyRule{BlobType: BlobTypePCH, TTL: Duration(10 * time.Minute), Tier: TierMemory},
+		},
+		{
+			blobType: BlobTypeDepfile,
+			want:     BlobPolicyRule{BlobType: BlobTypeDepfile, Compress: true},
+		},
+		{
+			blobType: BlobTypeObject,
+			want:     BlobPolicyRule{TTL: Duration(time.Hour), Tier: TierWriteBack},
+		},
+		{
+			blobType: "",
+			want:     BlobPolicyRule{TTL: Duration(time.Hour), Tier: TierWriteBack},
+		},
+	} {
+		if got := p.Rule(tc.blobType); got != tc.want {
+			t.Errorf("Rule(%q)=%#v; want %#v", tc.blobType, got, tc.want)
+		}
+	}
+
+	var nilPolicy *BlobPolicy
+	if got := nilPolicy.Rule(BlobTypePCH); got != (BlobPolicyRule{}) {
+		t.Errorf("nil policy Rule(%q)=%#v; want zero rule", BlobTypePCH, got)
+	}
+
+	for _, tc := range []string{
+		`{"rules": [{"blob_type": "pch", "tier": "disk"}]}`,
+		`{"rules": [{"blob_type": "pch", "ttl": "-1m"}]}`,
+		`{"rules": [{"blob_type": "pch", "ttl": "10"}]}`,
+	} {
+		fname := filepath.Join(dir, "bad.json")
+		err := os.WriteFile(fname, []byte(tc), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadBlobPolicy(fname)
+		if err == nil {
+			t.Errorf("LoadBlobPolicy(%s)=_, nil; want error", tc)
+		}
+	}
+}
+
+func TestBlobTypeFromPath(t *testing.T) {
+	for _, tc := range []struct {
+		fname string
+		want  string
+	}{
+		{fname: "obj/base/base/time.o", want: BlobTypeObject},
+		{fname: `obj\base\base\time.obj`, want: BlobTypeObject},
+		{fname: "obj/base/base/time.o.d", want: BlobTypeDepfile},
+		{fname: "obj/chrome/precompile.h.gch", want: BlobTypePCH},
+		{fname: "gen/foo.cc", want: BlobTypeSource},
+		{fname: "gen/foo.H", want: BlobTypeSource},
+		{fname: "obj/foo.d/bar", want: ""},
+		{fname: "foo", want: ""},
+	} {
+		if got := BlobTypeFromPath(tc.fname); got != tc.want {
+			t.Errorf("BlobTypeFromPath(%q)=%q; want %q", tc.fname, got, tc.want)
+		}
+	}
+}
+
+func TestBlobTypeFromContext(t *testing.T) {
+	ctx := context.Background()
+	if got := BlobTypeFromContext(ctx); got != "" {
+		t.Errorf("BlobTypeFromContext(background)=%q; want empty", got)
+	}
+	ctx = WithBlobType(ctx, BlobTypePCH)
+	if got := BlobTypeFromContext(ctx); got != BlobTypePCH {
+		t.Errorf("BlobTypeFromContext(ctx)=%q; want %q", got, BlobTypePCH)
+	}
+}
+
+func TestCacheBlobPolicy(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+		TTL:      time.Hour,
+		BlobPolicy: &BlobPolicy{
+			Rules: []BlobPolicyRule{
+				{
+					BlobType: BlobTypePCH,
+					TTL:      Duration(time.Minute),
+					Tier:     TierMemory,
+				},
+				{
+					BlobType: BlobTypeDepfile,
+					Compress: true,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	now := time.Now()
+	c.mem.now = func() time.Time { return now }
+
+	depfile := []byte("obj/foo.o: ../../foo.cc" + strings.Repeat(" \\\n  ../../foo.h", 100) + "\n")
+	for _, req := range []*pb.PutReq{
+		{
+			Kv:       &pb.KV{Key: "pch", Value: []byte("pch")},
+			BlobType: BlobTypePCH,
+		},
+		{
+			Kv:       &pb.KV{Key: "depfile", Value: depfile},
+			BlobType: BlobTypeDepfile,
+		},
+		{
+			Kv: &pb.KV{Key: "object", Value: []byte("object")},
+		},
+	} {
+		_, err := c.Put(ctx, req)
+		if err != nil {
+			t.Fatalf("cache.Put(%s): %v", req.Kv.Key, err)
+		}
+	}
+
+	v, ok := c.mem.Get(ctx, memKey("", "depfile"))
+	if !ok || !IsCompressed(v) {
+		t.Errorf("stored depfile compressed=%t, %t; want true, true", IsCompressed(v), ok)
+	}
+	resp, err := c.Get(ctx, &pb.GetReq{Key: "depfile"})
+	if err != nil || string(resp.GetKv().GetValue()) != string(depfile) {
+		t.Errorf("cache.Get(depfile)=%q, %v; want %q, nil", resp.GetKv().GetValue(), err, depfile)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = c.Get(ctx, &pb.GetReq{Key: "pch"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("cache.Get(pch) after policy TTL: %v; want NotFound error", err)
+	}
+	resp, err = c.Get(ctx, &pb.GetReq{Key: "object"})
+	if err != nil || string(resp.GetKv().GetValue()) != "object" {
+		t.Errorf("cache.Get(object)=%q, %v; want %q, nil", resp.GetKv().GetValue(), err, "object")
+	}
+}
+
+func TestCacheBlobPolicyRefill(t *testing.T) {
+	ctx := context.Background()
+	s := fakegcs.NewServer(t)
+	s.CreateBucket("cache")
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint(s.Endpoint()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	policy := &BlobPolicy{
+		Rules: []BlobPolicyRule{
+			{
+				BlobType: BlobTypeObject,
+				TTL:      Duration(time.Minute),
+			},
+		},
+	}
+	c, err := New(Config{
+		MaxBytes:   1024 * 1024 * 1024,
+		TTL:        time.Hour,
+		Bucket:     client.Bucket("cache"),
+		BlobPolicy: policy,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	_, err = c.Put(ctx, &pb.PutReq{
+		Kv:       &pb.KV{Key: "object", Value: []byte("object")},
+		BlobType: BlobTypeObject,
+	})
+	if err != nil {
+		t.Fatalf("cache.Put(object): %v", err)
+	}
+
+	// other replica fetches it from cloud cache.
+	c, err = New(Config{
+		MaxBytes:   1024 * 1024 * 1024,
+		TTL:        time.Hour,
+		Bucket:     client.Bucket("cache"),
+		BlobPolicy: policy,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	now := time.Now()
+	c.mem.now = func() time.Time { return now }
+	resp, err := c.Get(ctx, &pb.GetReq{Key: "object"})
+	if err != nil || string(resp.GetKv().GetValue()) != "object" {
+		t.Fatalf("cache.Get(object)=%q, %v; want %q, nil", resp.GetKv().GetValue(), err, "object")
+	}
+	if resp.InMemory {
+		t.Errorf("cache.Get(object).InMemory=true; want false")
+	}
+	e, ok := c.mem.get(ctx, memKey("", "object"))
+	if !ok {
+		t.Fatalf("object is not cached in memory")
+	}
+	if got, want := e.expire, now.Add(time.Minute); got.After(want) {
+		t.Errorf("object expires at %s; want before %s by policy TTL", got, want)
+	}
+}
+
+func TestCacheDecompressWithoutPolicy(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(Config{
+		MaxBytes: 1024 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	value := []byte(strings.Repeat("compressed by previous policy. ", 100))
+	compressed, err := CompressValue(value)
+	if err != nil {
+		t.Fatalf("CompressValue(...): %v", err)
+	}
+	_, err = c.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{Key: "key", Value: compressed},
+	})
+	if err != nil {
+		t.Fatalf("cache.Put(key): %v", err)
+	}
+	resp, err := c.Get(ctx, &pb.GetReq{Key: "key"})
+	if err != nil || string(resp.GetKv().GetValue()) != string(value) {
+		t.Errorf("cache.Get(key)=%q, %v; want %q, nil", resp.GetKv().GetValue(), err, value)
+	}
+}
@@ -8,21 +8,53 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 	pb "go.chromium.org/goma/server/proto/cache"
 	"go.chromium.org/goma/server/rpc"
 )
 
+var (
+	opsCount = stats.Int64(
+		"go.chromium.org/goma/server/cache/redis.ops",
+		"redis cache operations",
+		stats.UnitDimensionless)
+
+	namespaceKey = tag.MustNewKey("namespace")
+	opKey        = tag.MustNewKey("op")
+
+	// DefaultViews are the default views provided by this package.
+	// You need to register the view for data to actually be collected.
+	DefaultViews = []*view.View{
+		{
+			Name:        "go.chromium.org/goma/server/cache/redis.ops",
+			Description: "redis cache operations per namespace",
+			Measure:     opsCount,
+			TagKeys: metrics.TagKeys(
+				namespaceKey,
+				opKey,
+			),
+			Aggregation: view.Count(),
+		},
+	}
+)
+
 // Client is cache service client for redis.
 type Client struct {
 	prefix string
@@ -31,6 +63,10 @@ type Client struct {
 	// to workaround pool.wait. maintain active conns.
 	sema chan struct{}
 	ttl  time.Duration
+
+	ttlJitter float64
+
+	cmdTimeout time.Duration
 }
 
 // AddrFromEnv returns redis server address from environment variables.
@@ -49,6 +85,8 @@ func AddrFromEnv() (string, error) {
 // Opts is redis client option.
 type Opts struct {
 	// Prefix is key prefix used by the client.
+	// If request has namespace, key will be
+	// <Prefix><namespace>:<key>.
 	Prefix string
 
 	// MaxIdleConns is max number of idle connections.
@@ -59,6 +97,16 @@ type Opts struct {
 
 	// EntryTTL sets the expiration time of an entry, 0 means entry will never expire.
 	EntryTTL time.Duration
+
+	// EntryTTLJitter randomizes EntryTTL of each entry in
+	// [EntryTTL*(1-EntryTTLJitter), EntryTTL*(1+EntryTTLJitter)],
+	// so that entries put at the same time don't expire at the same time.
+	EntryTTLJitter float64
+
+	// CommandTimeout is timeout of each redis command, including time
+	// to wait for available connection. 0 means no timeout other than
+	// the deadline of the request context.
+	CommandTimeout time.Duration
 }
 
 // default max number of connections.
@@ -83,6 +131,10 @@ func NewClient(ctx context.Context, addr string, opts Opts) Client {
 		},
 		sema: make(chan struct{}, opts.MaxActiveConns),
 		ttl:  opts.EntryTTL,
+
+		ttlJitter: opts.EntryTTLJitter,
+
+		cmdTimeout: opts.CommandTimeout,
 	}
 }
 
@@ -145,6 +197,18 @@ func (c activeConn) Close() error {
 	return c.Conn.Close()
 }
 
+// DoContext sends a command to the server and returns the received reply.
+// If ctx is done before the reply is received, the connection is marked
+// as broken, so it won't be reused by the pool.
+func (c activeConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoContext(c.Conn, ctx, cmd, args...)
+}
+
+// ReceiveContext receives a single reply from the server.
+func (c activeConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redis.ReceiveContext(c.Conn, ctx)
+}
+
 func (c Client) poolGetContext(ctx context.Context) (redis.Conn, error) {
 	t := time.Now()
 	select {
@@ -173,28 +237,132 @@ func (c Client) poolGetContext(ctx context.Context) (redis.Conn, error) {
 	}
 }
 
-// Get fetches value for the key from redis.
-func (c Client) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+// commandTimeout returns timeout of each redis command.
+// rpc policy of rpc.ServiceCache overrides Opts.CommandTimeout, if set.
+func (c Client) commandTimeout() time.Duration {
+	return rpc.PolicyFor(rpc.ServiceCache).TimeoutOr(c.cmdTimeout)
+}
+
+// retry returns retry policy of redis commands.
+func (c Client) retry() rpc.Retry {
+	return rpc.PolicyFor(rpc.ServiceCache).RetryOr(rpc.Retry{
+		MaxRetry: -1,
+	})
+}
+
+// do runs redis command on a connection in the pool.
+// The command is bound by ctx and c.commandTimeout. When it is cancelled
+// or timed out, it abandons the command (even if it is still waiting for
+// available connection), and the connection will be closed instead of
+// returning to the pool.
+func (c Client) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if timeout := c.commandTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := c.poolGetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redis.DoContext(conn, ctx, cmd, args...)
+}
+
+// pipeline runs cmd for each args in a pipeline on a connection in
+// the pool, and returns replies in the same order as args.
+// It is bound by ctx and c.commandTimeout as do.
+func (c Client) pipeline(ctx context.Context, cmd string, args [][]interface{}) ([]interface{}, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if timeout := c.commandTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	conn, err := c.poolGetContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
+	for _, a := range args {
+		err = conn.Send(cmd, a...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = conn.Flush()
+	if err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, 0, len(args))
+	for range args {
+		r, err := redis.ReceiveContext(conn, ctx)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, r)
+	}
+	return replies, nil
+}
+
+// ttlMs returns TTL in milliseconds for an entry, with jitter.
+// It returns 0 if TTL is not set.
+func (c Client) ttlMs() int64 {
+	ttl := c.ttl
+	if ttl > 0 && c.ttlJitter > 0 {
+		ttl = time.Duration(float64(ttl) * (1 + c.ttlJitter*(rand.Float64()*2-1)))
+	}
+	return ttl.Milliseconds()
+}
+
+// key returns redis key for key in namespace.
+func (c Client) key(namespace, key string) string {
+	if namespace == "" {
+		return c.prefix + key
+	}
+	return c.prefix + namespace + ":" + key
+}
+
+func recordOp(ctx context.Context, namespace, op string) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(namespaceKey, namespace),
+		tag.Upsert(opKey, op),
+	}, opsCount.M(1))
+}
+
+// Get fetches value for the key from redis.
+func (c Client) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption) (*pb.GetResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/redis.Client.Get")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", in.Namespace),
+		trace.StringAttribute("key", in.Key),
+	)
+	key := c.key(in.Namespace, in.Key)
 	var v []byte
-	err = rpc.Retry{
-		MaxRetry: -1,
-	}.Do(ctx, func() error {
-		ttlMs := c.ttl.Milliseconds()
+	err := c.retry().Do(ctx, func() error {
+		var err error
+		ttlMs := c.ttlMs()
 		if ttlMs > 0 {
-			v, err = redis.Bytes(conn.Do("GETEX", c.prefix+in.Key, "PX", ttlMs))
+			v, err = redis.Bytes(c.do(ctx, "GETEX", key, "PX", ttlMs))
 		} else {
-			v, err = redis.Bytes(conn.Do("GET", c.prefix+in.Key))
+			v, err = redis.Bytes(c.do(ctx, "GET", key))
 		}
 		return retryErr(err)
 	})
 	if err != nil {
+		op := "get-error"
+		if status.Code(err) == codes.NotFound {
+			op = "miss"
+		}
+		recordOp(ctx, in.Namespace, op)
+		span.Annotatef(nil, "%s: %v", op, err)
 		return nil, err
 	}
+	recordOp(ctx, in.Namespace, "hit")
+	span.AddAttributes(trace.Int64Attribute("size", int64(len(v))))
 	return &pb.GetResp{
 		Kv: &pb.KV{
 			Key:   in.Key,
@@ -206,25 +374,180 @@ func (c Client) Get(ctx context.Context, in *pb.GetReq, opts ...grpc.CallOption)
 
 // Put stores key:value pair on redis.
 func (c Client) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
-	conn, err := c.poolGetContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	err = rpc.Retry{
-		MaxRetry: -1,
-	}.Do(ctx, func() error {
-		args := redis.Args{}.Add(c.prefix+in.Kv.Key, in.Kv.Value)
-		ttlMs := c.ttl.Milliseconds()
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/redis.Client.Put")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", in.Namespace),
+		trace.StringAttribute("key", in.Kv.Key),
+		trace.Int64Attribute("size", int64(len(in.Kv.Value))),
+	)
+	key := c.key(in.Namespace, in.Kv.Key)
+	err := c.retry().Do(ctx, func() error {
+		args := redis.Args{}.Add(key, in.Kv.Value)
+		ttlMs := c.ttlMs()
 		if ttlMs > 0 {
 			args = args.Add("PX", ttlMs)
 		}
-		_, err := conn.Do("SET", args...)
+		_, err := c.do(ctx, "SET", args...)
 
 		return retryErr(err)
 	})
 	if err != nil {
+		recordOp(ctx, in.Namespace, "put-error")
+		span.Annotatef(nil, "put-error: %v", err)
 		return nil, err
 	}
+	recordOp(ctx, in.Namespace, "put")
 	return &pb.PutResp{}, nil
 }
+
+// SetNX sets key in namespace with ttl only if the key doesn't exist,
+// by SET NX command. It reports whether the key has been set.
+// Unlike Put, ttl is not affected by EntryTTL.
+// Note that it may report false for a retried command whose first
+// attempt set the key but failed to get the reply.
+func (c Client) SetNX(ctx context.Context, namespace, key string, ttl time.Duration) (bool, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/redis.Client.SetNX")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", namespace),
+	)
+	rkey := c.key(namespace, key)
+	var ok bool
+	err := c.retry().Do(ctx, func() error {
+		args := redis.Args{}.Add(rkey, 1, "NX")
+		if ttl > 0 {
+			args = args.Add("PX", ttl.Milliseconds())
+		}
+		r, err := c.do(ctx, "SET", args...)
+		if err != nil {
+			return retryErr(err)
+		}
+		// SET NX replies nil if the key already exists.
+		ok = r != nil
+		return nil
+	})
+	if err != nil {
+		recordOp(ctx, namespace, "setnx-error")
+		span.Annotatef(nil, "setnx-error: %v", err)
+		return false, err
+	}
+	if !ok {
+		recordOp(ctx, namespace, "setnx-exists")
+		return false, nil
+	}
+	recordOp(ctx, namespace, "setnx")
+	return true, nil
+}
+
+// Exists checks existence of keys on redis, by pipelined EXISTS commands.
+// It also refreshes TTL of existing keys if TTL is set, as Get does.
+func (c Client) Exists(ctx context.Context, in *pb.ExistsReq, opts ...grpc.CallOption) (*pb.ExistsResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/redis.Client.Exists")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", in.Namespace),
+		trace.Int64Attribute("keys", int64(len(in.Keys))),
+	)
+	cmd := "EXISTS"
+	ttlMs := c.ttlMs()
+	if ttlMs > 0 {
+		// PEXPIRE returns 1 if key exists, 0 otherwise.
+		cmd = "PEXPIRE"
+	}
+	args := make([][]interface{}, 0, len(in.Keys))
+	for _, key := range in.Keys {
+		a := []interface{}{c.key(in.Namespace, key)}
+		if ttlMs > 0 {
+			a = append(a, c.ttlMs())
+		}
+		args = append(args, a)
+	}
+	var replies []interface{}
+	err := c.retry().Do(ctx, func() error {
+		var err error
+		replies, err = c.pipeline(ctx, cmd, args)
+		return retryErr(err)
+	})
+	if err != nil {
+		recordOp(ctx, in.Namespace, "exists-error")
+		span.Annotatef(nil, "exists-error: %v", err)
+		return nil, err
+	}
+	resp := &pb.ExistsResp{
+		Exists: make([]bool, len(in.Keys)),
+	}
+	var hits int64
+	for i, r := range replies {
+		n, err := redis.Int(r, nil)
+		if err != nil {
+			recordOp(ctx, in.Namespace, "exists-error")
+			span.Annotatef(nil, "exists-error %s: %v", in.Keys[i], err)
+			return nil, err
+		}
+		if n == 0 {
+			recordOp(ctx, in.Namespace, "exists-miss")
+			continue
+		}
+		recordOp(ctx, in.Namespace, "exists-hit")
+		resp.Exists[i] = true
+		hits++
+	}
+	span.AddAttributes(trace.Int64Attribute("hits", hits))
+	return resp, nil
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// Scan scans keys in namespace by redis SCAN command.
+// Scan starts with cursor "0", and returns next cursor and keys
+// (without prefix and namespace).
+// Next cursor "0" means scan has been completed.
+// count is a hint of number of keys to return.
+func (c Client) Scan(ctx context.Context, namespace, cursor string, count int) (string, []string, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/cache/redis.Client.Scan")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", namespace),
+		trace.StringAttribute("cursor", cursor),
+		trace.Int64Attribute("count", int64(count)),
+	)
+	prefix := c.key(namespace, "")
+	var next string
+	var keys []string
+	err := c.retry().Do(ctx, func() error {
+		v, err := redis.Values(c.do(ctx, "SCAN", cursor, "MATCH", globEscaper.Replace(prefix)+"*", "COUNT", count))
+		if err != nil {
+			return retryErr(err)
+		}
+		if len(v) != 2 {
+			return fmt.Errorf("unexpected SCAN reply: %q", v)
+		}
+		next, err = redis.String(v[0], nil)
+		if err != nil {
+			return err
+		}
+		keys, err = redis.Strings(v[1], nil)
+		return err
+	})
+	if err != nil {
+		span.Annotatef(nil, "scan: %v", err)
+		return "", nil, err
+	}
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], prefix)
+	}
+	if namespace == "" {
+		// drop keys in other namespaces.
+		var nkeys []string
+		for _, k := range keys {
+			if strings.Contains(k, ":") {
+				continue
+			}
+			nkeys = append(nkeys, k)
+		}
+		keys = nkeys
+	}
+	span.AddAttributes(trace.Int64Attribute("keys", int64(len(keys))))
+	return next, keys, nil
+}
@@ -143,3 +143,208 @@ func TestSetZeroTTL(t *testing.T) {
 		t.Errorf("lastRequest() mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestCommandTimeout(t *testing.T) {
+	log.SetZapLogger(zap.NewNop())
+	s := NewFakeServer(t)
+	s.Delay = 1 * time.Second
+
+	ctx := context.Background()
+	c := NewClient(ctx, s.Addr().String(), Opts{
+		MaxIdleConns:   DefaultMaxIdleConns,
+		MaxActiveConns: DefaultMaxActiveConns,
+		CommandTimeout: 10 * time.Millisecond,
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	t0 := time.Now()
+	_, err := c.Get(ctx, &pb.GetReq{
+		Key: "key",
+	})
+	if err == nil {
+		t.Errorf("Get()=nil error; want error")
+	}
+	if d := time.Since(t0); d >= s.Delay {
+		t.Errorf("Get() took %s; want < %s", d, s.Delay)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	log.SetZapLogger(zap.NewNop())
+	s := NewFakeServer(t)
+	s.Delay = 1 * time.Second
+
+	ctx := context.Background()
+	c := NewClient(ctx, s.Addr().String(), Opts{
+		MaxIdleConns:   DefaultMaxIdleConns,
+		MaxActiveConns: DefaultMaxActiveConns,
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	t0 := time.Now()
+	_, err := c.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "key",
+			Value: []byte("value"),
+		},
+	})
+	if err == nil {
+		t.Errorf("Put()=nil error; want error")
+	}
+	if d := time.Since(t0); d >= s.Delay {
+		t.Errorf("Put() took %s; want < %s", d, s.Delay)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	log.SetZapLogger(zap.NewNop())
+	s := NewFakeServer(t)
+
+	ctx := context.Background()
+	c := NewClient(ctx, s.Addr().String(), Opts{
+		Prefix:         "gomafile:",
+		MaxIdleConns:   DefaultMaxIdleConns,
+		MaxActiveConns: DefaultMaxActiveConns,
+	})
+	defer c.Close()
+
+	_, err := c.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   "key",
+			Value: []byte("value"),
+		},
+		Namespace: "instance1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"SET", "gomafile:instance1:key", "value"}
+	if diff := cmp.Diff(want, s.lastRequest()); diff != "" {
+		t.Errorf("lastRequest() mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = c.Get(ctx, &pb.GetReq{
+		Key:       "key",
+		Namespace: "instance1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"GET", "gomafile:instance1:key"}
+	if diff := cmp.Diff(want, s.lastRequest()); diff != "" {
+		t.Errorf("lastRequest() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	log.SetZapLogger(zap.NewNop())
+	s := NewFakeServer(t)
+
+	ctx := context.Background()
+	c := NewClient(ctx, s.Addr().String(), Opts{
+		MaxIdleConns:   DefaultMaxIdleConns,
+		MaxActiveConns: DefaultMaxActiveConns,
+		EntryTTL:       1 * time.Hour,
+	})
+	defer func() {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ok, err := c.SetNX(ctx, "nonce", "test_key", 5*time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("SetNX(ctx, nonce, test_key, 5m)=%t, %v; want true, nil", ok, err)
+	}
+	want := []string{"SET", "nonce:test_key", "1", "NX", "PX", "300000"}
+	got := s.lastRequest()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("lastRequest() mismatch (-want +got):\n%s", diff)
+	}
+
+	ok, err = c.SetNX(ctx, "nonce", "test_key", 5*time.Minute)
+	if err != nil || ok {
+		t.Errorf("SetNX(ctx, nonce, test_key, 5m)=%t, %v; want false, nil for existing key", ok, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	log.SetZapLogger(zap.NewNop())
+	s := NewFakeServer(t)
+	s.ScanKeys = []string{
+		"gomafile:a",
+		"gomafile:instance1:b",
+		"gomafile:c",
+		"nonce:d",
+		"gomafile:instance1:e",
+	}
+
+	ctx := context.Background()
+	c := NewClient(ctx, s.Addr().String(), Opts{
+		Prefix:         "gomafile:",
+		MaxIdleConns:   DefaultMaxIdleConns,
+		MaxActiveConns: DefaultMaxActiveConns,
+	})
+	defer c.Close()
+
+	scanAll := func(namespace string) []string {
+		t.Helper()
+		var keys []string
+		cursor := "0"
+		for {
+			next, k, err := c.Scan(ctx, namespace, cursor, 2)
+			if err != nil {
+				t.Fatalf("Scan(ctx, %q, %q, 2)=_, _, %v; want nil error", namespace, cursor, err)
+			}
+			keys = append(keys, k...)
+			if next == "0" {
+				return keys
+			}
+			cursor = next
+		}
+	}
+
+	// keys in other namespaces are not in default namespace.
+	if diff := cmp.Diff([]string{"a", "c"}, scanAll("")); diff != "" {
+		t.Errorf("Scan(default namespace) mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"b", "e"}, scanAll("instance1")); diff != "" {
+		t.Errorf("Scan(instance1) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScanGlobEscape(t *testing.T) {
+	log.SetZapLogger(zap.NewNop())
+	s := NewFakeServer(t)
+	s.ScanKeys = []string{
+		`goma*file[1]?\:key`,
+		"gomaXfile1Y:key",
+	}
+
+	ctx := context.Background()
+	c := NewClient(ctx, s.Addr().String(), Opts{
+		Prefix:         `goma*file[1]?\:`,
+		MaxIdleConns:   DefaultMaxIdleConns,
+		MaxActiveConns: DefaultMaxActiveConns,
+	})
+	defer c.Close()
+
+	next, keys, err := c.Scan(ctx, "", "0", 10)
+	if err != nil {
+		t.Fatalf("Scan(ctx, \"\", 0, 10)=_, _, %v; want nil error", err)
+	}
+	want := []string{"SCAN", "0", "MATCH", `goma\*file\[1\]\?\\:*`, "COUNT", "10"}
+	if diff := cmp.Diff(want, s.lastRequest()); diff != "" {
+		t.Errorf("lastRequest() mismatch (-want +got):\n%s", diff)
+	}
+	if next != "0" || len(keys) != 1 || keys[0] != "key" {
+		t.Errorf("Scan(ctx, \"\", 0, 10)=%q, %q, nil; want \"0\", [\"key\"], nil", next, keys)
+	}
+}
@@ -8,14 +8,29 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // FakeServer is a fake redis server for stress test.
 type FakeServer struct {
-	ln   net.Listener
-	tb   testing.TB
+	ln net.Listener
+	tb testing.TB
+
+	mu   sync.Mutex
 	last []string
+	// keys set by SET NX.
+	nx map[string]bool
+
+	// Delay is a delay to respond to each request.
+	// It should be set before sending any requests.
+	Delay time.Duration
+
+	// ScanKeys is keys to be scanned by SCAN.
+	// It should be set before sending any requests.
+	ScanKeys []string
 }
 
 // NewFakeServer starts a new fake redis server.
@@ -58,11 +73,22 @@ func (s *FakeServer) handle(conn net.Conn) {
 		if err != nil {
 			return
 		}
+		s.mu.Lock()
 		s.last = request
+		s.mu.Unlock()
 		s.tb.Logf("request: %q", request)
+		if s.Delay > 0 {
+			time.Sleep(s.Delay)
+		}
 
-		if len(request) > 0 && request[0] == "SET" {
-			conn.Write([]byte("+OK\r\n"))
+		if len(request) > 0 && request[0] == "SCAN" {
+			conn.Write(s.scan(request))
+		} else if len(request) > 0 && request[0] == "SET" {
+			if s.setNX(request) {
+				conn.Write([]byte("+OK\r\n"))
+			} else {
+				conn.Write([]byte("$-1\r\n"))
+			}
 		} else {
 			// assume GET
 			conn.Write([]byte("$10\r\n0123456789\r\n"))
@@ -70,6 +96,79 @@ func (s *FakeServer) handle(conn net.Conn) {
 	}
 }
 
+// setNX handles NX option of SET request, and reports whether
+// the key is set.
+func (s *FakeServer) setNX(request []string) bool {
+	if len(request) < 3 {
+		return true
+	}
+	nx := false
+	for _, a := range request[2:] {
+		if a == "NX" {
+			nx = true
+		}
+	}
+	if !nx {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nx[request[1]] {
+		return false
+	}
+	if s.nx == nil {
+		s.nx = make(map[string]bool)
+	}
+	s.nx[request[1]] = true
+	return true
+}
+
+// scan handles SCAN request with cursor, MATCH and COUNT,
+// and returns its reply.
+// Cursor is index in ScanKeys, and MATCH supports only pattern
+// of escaped prefix followed by "*".
+func (s *FakeServer) scan(request []string) []byte {
+	var cursor, count int
+	var match string
+	if len(request) > 1 {
+		cursor, _ = strconv.Atoi(request[1])
+	}
+	for i := 2; i+1 < len(request); i += 2 {
+		switch request[i] {
+		case "MATCH":
+			match = request[i+1]
+		case "COUNT":
+			count, _ = strconv.Atoi(request[i+1])
+		}
+	}
+	if count <= 0 {
+		count = 10
+	}
+	prefix := strings.TrimSuffix(match, "*")
+	prefix = strings.NewReplacer(`\\`, `\`, `\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]").Replace(prefix)
+	end := cursor + count
+	if end >= len(s.ScanKeys) {
+		end = len(s.ScanKeys)
+	}
+	var keys []string
+	for _, k := range s.ScanKeys[cursor:end] {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	next := end
+	if next == len(s.ScanKeys) {
+		next = 0
+	}
+	var buf bytes.Buffer
+	nc := strconv.Itoa(next)
+	fmt.Fprintf(&buf, "*2\r\n$%d\r\n%s\r\n*%d\r\n", len(nc), nc, len(keys))
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(k), k)
+	}
+	return buf.Bytes()
+}
+
 func (s *FakeServer) readRequest(r *bufio.Reader) ([]string, error) {
 	var line []byte
 	nline, _, err := r.ReadLine()
@@ -116,5 +215,7 @@ func (s *FakeServer) readRequest(r *bufio.Reader) ([]string, error) {
 }
 
 func (s *FakeServer) lastRequest() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.last
 }
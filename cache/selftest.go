@@ -0,0 +1,46 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"time"
+
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+// SelfTest checks c by putting a value and getting it back.
+func SelfTest(ctx context.Context, c pb.CacheServiceClient) error {
+	hostname, _ := os.Hostname()
+	key := fmt.Sprintf("goma-selftest/%s/%d", hostname, time.Now().UnixNano())
+	value := make([]byte, 32)
+	_, err := rand.Read(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.Put(ctx, &pb.PutReq{
+		Kv: &pb.KV{
+			Key:   key,
+			Value: value,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("put %s: %v", key, err)
+	}
+	resp, err := c.Get(ctx, &pb.GetReq{
+		Key: key,
+	})
+	if err != nil {
+		return fmt.Errorf("get %s: %v", key, err)
+	}
+	if !bytes.Equal(resp.GetKv().GetValue(), value) {
+		return fmt.Errorf("get %s: value mismatch", key)
+	}
+	return nil
+}
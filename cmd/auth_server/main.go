@@ -12,6 +12,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"net/http"
+	"os"
 	"path/filepath"
 
 	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
@@ -47,14 +48,27 @@ var (
 	port  = flag.Int("port", 5050, "rpc port")
 	mport = flag.Int("mport", 8081, "monitor port")
 
-	projectID = flag.String("project-id", "", "project id")
+	projectID     = flag.String("project-id", "", "project id")
+	metricsFormat = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint  = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders   = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
 
 	authDBAddr            = flag.String("auth-db-addr", "", "authdb url")
+	authDBRetryPolicy     = flag.String("auth-db-retry-policy", "", `text proto of rpc.RetryPolicy for authdb calls, e.g. "max_attempts: 3 initial_backoff_msec: 100".`)
+	authDBBreakerRate     = flag.Float64("auth-db-circuit-breaker-error-rate", 0, "error rate of authdb calls to stop calling authdb for a while. 0 disables circuit breaker.")
 	aclFile               = flag.String("acl-file", "", "filename of acl proto text message")
 	serviceAccountJSONDir = flag.String("service-account-json-dir", "", "directory for service account jsons")
 
 	remoteexecAddr     = flag.String("remoteexec-addr", "", "use remoteexec API endpoint")
 	remoteInstanceName = flag.String("remote-instance-name", "", "remote instance name.")
+
+	credentialKeyFile = flag.String("credential-key-file", "", "file of HMAC keys to sign and verify credentials issued by enroll, one key per line. the first key is used to sign. empty disables enroll.")
+	credentialTTL     = flag.Duration("credential-ttl", auth.DefaultCredentialTTL, "lifetime of credentials issued by enroll.")
+	clockSkew         = flag.Duration("clock-skew", auth.DefaultClockSkew, "tolerance of clock skew in validating expiration and issued time of credentials. negative disables tolerance.")
+
+	selftest = flag.Bool("selftest", false, "run self-test of dependencies (remoteexec API, acl load, service account tokens), print the report and exit.")
+
+	rpcPolicyConfig = flag.String("rpc-policy-config", "", "text proto file of rpc.PolicyConfig to configure timeout, retry and hedging of calls per target service (auth, authdb, cache, file, remoteexec). overrides per-service flags, e.g. --auth-db-retry-policy.")
 )
 
 var (
@@ -122,23 +136,45 @@ func main() {
 	logger := log.FromContext(ctx)
 	defer logger.Sync()
 
+	if *rpcPolicyConfig != "" {
+		p, err := rpc.LoadPolicies(*rpcPolicyConfig)
+		if err != nil {
+			logger.Fatalf("--rpc-policy-config: %v", err)
+		}
+		rpc.SetPolicies(p)
+		server.EnableFeature("rpc-policy-config")
+	}
+
 	err := server.Init(ctx, *projectID, "auth_server")
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "auth_server", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	err = view.Register(configViews...)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = view.Register(auth.DefaultViews...)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	trace.ApplyConfig(trace.Config{
-		DefaultSampler: server.NewLimitedSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
+		DefaultSampler: server.TraceSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
 	})
 
 	s, err := server.NewGRPC(*port)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	st := &server.SelfTest{Name: "auth_server"}
 	var checkToken func(context.Context, *oauth2.Token, *auth.TokenInfo) (string, *oauth2.Token, error)
 	if *remoteexecAddr != "" {
 		logger.Infof("use remoteexec API: %s", *remoteexecAddr)
@@ -159,16 +195,31 @@ func main() {
 			Instance: *remoteInstanceName,
 		}
 		checkToken = tc.CheckToken
+		st.Add("remoteexec", func(ctx context.Context) error {
+			return server.CheckConn(ctx, reConn)
+		})
 	}
 
 	if *aclFile != "" {
 		var authDB acl.AuthDB
 		if *authDBAddr != "" {
-			authDB = authdb.Client{
+			c := authdb.Client{
 				Client: &httprpc.Client{
 					URL: *authDBAddr,
 				},
 			}
+			retry, err := rpc.ParseRetryPolicy(*authDBRetryPolicy)
+			if err != nil {
+				logger.Fatalf("--auth-db-retry-policy: %v", err)
+			}
+			c.Retry = retry
+			if *authDBBreakerRate > 0 {
+				c.Breaker = &rpc.CircuitBreaker{
+					ErrorRate: *authDBBreakerRate,
+				}
+				server.EnableFeature("authdb-circuit-breaker")
+			}
+			authDB = c
 			logger.Infof("use authdb: %s", *authDBAddr)
 		}
 		a := acl.ACL{
@@ -191,6 +242,8 @@ func main() {
 			logger.Fatalf("acl update failed: %v", err)
 		}
 		recordConfigUpdate(ctx, nil)
+		st.Add("acl", a.Update)
+		st.Add("service-accounts", a.Checker.CheckServiceAccounts)
 		go func() {
 			defer errorreporter.Do(nil, nil)
 			ctx := context.Background()
@@ -241,9 +294,25 @@ func main() {
 		checkToken = a.CheckToken
 	}
 
+	if *selftest {
+		server.RunSelfTest(ctx, st)
+	}
+
 	as := &auth.Service{
 		CheckToken: checkToken,
 	}
+	if *credentialKeyFile != "" {
+		keys, err := auth.ReadCredentialKeys(*credentialKeyFile)
+		if err != nil {
+			logger.Fatalf("credential keys: %v", err)
+		}
+		logger.Infof("enroll enabled: %d credential keys, ttl=%s", len(keys), *credentialTTL)
+		as.Credentials = &auth.Credentials{
+			Keys:      keys,
+			TTL:       *credentialTTL,
+			ClockSkew: *clockSkew,
+		}
+	}
 	pb.RegisterAuthServiceServer(s.Server, as)
 
 	hs := server.NewHTTP(*mport, nil)
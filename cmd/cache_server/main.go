@@ -10,6 +10,7 @@ package main
 import (
 	"context"
 	"flag"
+	"os"
 	"runtime/debug"
 
 	"cloud.google.com/go/storage"
@@ -35,6 +36,19 @@ var (
 	// config = flag.String("config", "", "config file")
 
 	traceProjectID = flag.String("trace-project-id", "", "project id for cloud tracing")
+	metricsFormat  = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint   = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders    = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
+
+	memTTL              = flag.Duration("mem-ttl", 0, "time to live of entries in memory. 0 means entries are evicted only by LRU.")
+	memTTLJitter        = flag.Float64("mem-ttl-jitter", 0.1, "randomize --mem-ttl of each entry by this fraction, so entries put at the same time don't expire at the same time.")
+	earlyExpirationBeta = flag.Float64("early-expiration-beta", 1.0, "beta of probabilistic early expiration of entries fetched from bucket, used with --mem-ttl. 0 disables.")
+
+	denylistFile = flag.String("denylist", "", "file of cache keys, a key per line, that must not be served nor stored, e.g. to quarantine poisoned blobs. reloaded when updated.")
+
+	blobPolicyFile = flag.String("blob-policy", "", `JSON file of caching policy (ttl, storage tier and compression) per blob type hint, e.g. {"rules":[{"blob_type":"pch","ttl":"10m","tier":"memory"}]}.`)
+
+	selftest = flag.Bool("selftest", false, "run self-test of dependencies (cache put/get), print the report and exit.")
 )
 
 func main() {
@@ -52,6 +66,14 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "cache_server", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	var bucketHandle *storage.BucketHandle
 	if *bucket != "" {
@@ -71,13 +93,42 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	var denylist *cache.Denylist
+	if *denylistFile != "" {
+		denylist = &cache.Denylist{}
+		err := denylist.Watch(ctx, *denylistFile)
+		if err != nil {
+			logger.Fatalf("--denylist: %v", err)
+		}
+		server.EnableFeature("denylist")
+	}
+	var blobPolicy *cache.BlobPolicy
+	if *blobPolicyFile != "" {
+		blobPolicy, err = cache.LoadBlobPolicy(*blobPolicyFile)
+		if err != nil {
+			logger.Fatalf("--blob-policy: %v", err)
+		}
+		server.EnableFeature("blob-policy")
+	}
 	c, err := cache.New(cache.Config{
-		MaxBytes: 1 * 1024 * 1024 * 1024,
-		Bucket:   bucketHandle,
+		MaxBytes:            1 * 1024 * 1024 * 1024,
+		Bucket:              bucketHandle,
+		TTL:                 *memTTL,
+		TTLJitter:           *memTTLJitter,
+		EarlyExpirationBeta: *earlyExpirationBeta,
+		Denylist:            denylist,
+		BlobPolicy:          blobPolicy,
 	})
 	if err != nil {
 		logger.Fatalf("failed to create cache client: %v", err)
 	}
+	if *selftest {
+		st := &server.SelfTest{Name: "cache_server"}
+		st.Add("cache", func(ctx context.Context) error {
+			return cache.SelfTest(ctx, cache.LocalClient{CacheServiceServer: c})
+		})
+		server.RunSelfTest(ctx, st)
+	}
 	pb.RegisterCacheServiceServer(s.Server, c)
 
 	hs := server.NewHTTP(*mport, nil)
@@ -0,0 +1,346 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+/*
+Binary cachemigrate copies key-values from one cache backend to another.
+
+It supports redis and cloud storage backends.
+
+	$ cachemigrate --src=redis://10.0.0.1:6379/gomafile: \
+	    --dst=redis://10.0.0.2:6379/gomafile: \
+	    --qps=1000 --checkpoint=/tmp/cachemigrate.checkpoint --verify
+
+	$ cachemigrate --src=gs://old-bucket --dst=gs://new-bucket
+
+For redis, path of the URL is used as key prefix.
+
+Progress is recorded in checkpoint file, so it can resume migration
+from the last checkpoint by running the same command again.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/option"
+
+	"go.chromium.org/goma/server/cache"
+	"go.chromium.org/goma/server/cache/gcs"
+	"go.chromium.org/goma/server/cache/redis"
+	"go.chromium.org/goma/server/log"
+	pb "go.chromium.org/goma/server/proto/cache"
+)
+
+var (
+	src                = flag.String("src", "", "source cache backend. redis://host:port/prefix or gs://bucket")
+	dst                = flag.String("dst", "", "destination cache backend. redis://host:port/prefix or gs://bucket")
+	namespace          = flag.String("namespace", "", "cache namespace to migrate")
+	qps                = flag.Int("qps", 100, "max number of keys to copy per second. 0 means unlimited")
+	concurrency        = flag.Int("concurrency", 16, "number of concurrent copies")
+	batchSize          = flag.Int("batch-size", 100, "number of keys per batch. checkpoint is recorded per batch")
+	checkpoint         = flag.String("checkpoint", "", "checkpoint file to resume migration")
+	verify             = flag.Bool("verify", false, "verify value in destination after copy")
+	serviceAccountFile = flag.String("service-account-file", "", "service account json file for cloud storage")
+)
+
+// backend is cache backend to migrate.
+type backend interface {
+	pb.CacheServiceClient
+
+	// list lists keys from pos, and calls f with batch of keys and
+	// position to resume after the batch.
+	// Empty pos means the beginning, and list finishes when it reaches
+	// the end.
+	list(ctx context.Context, pos string, f func(keys []string, next string) error) error
+}
+
+type redisBackend struct {
+	redis.Client
+	namespace string
+}
+
+func (b redisBackend) list(ctx context.Context, pos string, f func([]string, string) error) error {
+	cursor := pos
+	if cursor == "" {
+		cursor = "0"
+	}
+	for {
+		next, keys, err := b.Client.Scan(ctx, b.namespace, cursor, *batchSize)
+		if err != nil {
+			return err
+		}
+		if next == "0" {
+			// scan completed.
+			next = "done"
+		}
+		if err := f(keys, next); err != nil {
+			return err
+		}
+		if next == "done" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+type gcsBackend struct {
+	cache.LocalClient
+	c         *gcs.Cache
+	namespace string
+}
+
+func (b gcsBackend) list(ctx context.Context, pos string, f func([]string, string) error) error {
+	var keys []string
+	err := b.c.List(ctx, b.namespace, pos, func(key string) error {
+		keys = append(keys, key)
+		if len(keys) < *batchSize {
+			return nil
+		}
+		err := f(keys, key)
+		keys = nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return f(keys, "done")
+}
+
+func newBackend(ctx context.Context, uri string) (backend, func(), error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "redis":
+		c := redis.NewClient(ctx, u.Host, redis.Opts{
+			Prefix:         strings.TrimPrefix(u.Path, "/"),
+			MaxIdleConns:   *concurrency,
+			MaxActiveConns: *concurrency * 2,
+		})
+		return redisBackend{
+			Client:    c,
+			namespace: *namespace,
+		}, func() { c.Close() }, nil
+
+	case "gs":
+		var opts []option.ClientOption
+		if *serviceAccountFile != "" {
+			opts = append(opts, option.WithServiceAccountFile(*serviceAccountFile))
+		}
+		gsclient, err := storage.NewClient(ctx, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		c := gcs.New(gsclient.Bucket(u.Host))
+		return gcsBackend{
+			LocalClient: cache.LocalClient{CacheServiceServer: c},
+			c:           c,
+			namespace:   *namespace,
+		}, func() { gsclient.Close() }, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported backend %q", uri)
+}
+
+func loadCheckpoint(fname string) (string, error) {
+	if fname == "" {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(fname)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func saveCheckpoint(fname, pos string) error {
+	if fname == "" {
+		return nil
+	}
+	tmpname := fname + ".tmp"
+	err := ioutil.WriteFile(tmpname, []byte(pos+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpname, fname)
+}
+
+type migrator struct {
+	src, dst backend
+	tick     <-chan time.Time
+	verify   bool
+
+	ncopied, nmissing, nmismatch, nerror int64
+}
+
+func (m *migrator) copy(ctx context.Context, key string) error {
+	logger := log.FromContext(ctx)
+	resp, err := m.src.Get(ctx, &pb.GetReq{
+		Key:       key,
+		Namespace: *namespace,
+	})
+	if err != nil {
+		// key might be expired since list.
+		logger.Warnf("get %s: %v", key, err)
+		atomic.AddInt64(&m.nmissing, 1)
+		return nil
+	}
+	_, err = m.dst.Put(ctx, &pb.PutReq{
+		Kv:        resp.Kv,
+		Namespace: *namespace,
+	})
+	if err != nil {
+		logger.Errorf("put %s: %v", key, err)
+		atomic.AddInt64(&m.nerror, 1)
+		return err
+	}
+	atomic.AddInt64(&m.ncopied, 1)
+	if !m.verify {
+		return nil
+	}
+	vresp, err := m.dst.Get(ctx, &pb.GetReq{
+		Key:       key,
+		Namespace: *namespace,
+	})
+	if err != nil || !bytes.Equal(vresp.GetKv().GetValue(), resp.Kv.Value) {
+		logger.Errorf("verify %s: mismatch: %v", key, err)
+		atomic.AddInt64(&m.nmismatch, 1)
+		return fmt.Errorf("verify %s failed: %v", key, err)
+	}
+	return nil
+}
+
+func (m *migrator) copyBatch(ctx context.Context, keys []string) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	sema := make(chan struct{}, *concurrency)
+	for _, key := range keys {
+		key := key
+		if m.tick != nil {
+			select {
+			case <-m.tick:
+			case <-ctx.Done():
+				return eg.Wait()
+			}
+		}
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			return eg.Wait()
+		}
+		eg.Go(func() error {
+			defer func() { <-sema }()
+			return m.copy(ctx, key)
+		})
+	}
+	return eg.Wait()
+}
+
+// migrate copies keys from pos in src to dst, and records position
+// to resume in checkpoint file after each batch.
+func (m *migrator) migrate(ctx context.Context, pos, checkpoint string) error {
+	logger := log.FromContext(ctx)
+	start := time.Now()
+	return m.src.list(ctx, pos, func(keys []string, next string) error {
+		err := m.copyBatch(ctx, keys)
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			// some keys in the batch might not be copied.
+			return ctx.Err()
+		}
+		if err := saveCheckpoint(checkpoint, next); err != nil {
+			return err
+		}
+		logger.Infof("copied=%d missing=%d mismatch=%d error=%d %s: next=%q",
+			atomic.LoadInt64(&m.ncopied),
+			atomic.LoadInt64(&m.nmissing),
+			atomic.LoadInt64(&m.nmismatch),
+			atomic.LoadInt64(&m.nerror),
+			time.Since(start),
+			next)
+		return nil
+	})
+}
+
+func main() {
+	flag.Parse()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := log.FromContext(ctx)
+	defer logger.Sync()
+
+	if *src == "" || *dst == "" {
+		logger.Fatal("--src and --dst must be given")
+	}
+	if *src == *dst {
+		logger.Fatalf("--src and --dst must be different: %s", *src)
+	}
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigch
+		logger.Infof("interrupted. stopping after current batch")
+		cancel()
+	}()
+
+	srcBackend, srcClose, err := newBackend(ctx, *src)
+	if err != nil {
+		logger.Fatalf("src %s: %v", *src, err)
+	}
+	defer srcClose()
+	dstBackend, dstClose, err := newBackend(ctx, *dst)
+	if err != nil {
+		logger.Fatalf("dst %s: %v", *dst, err)
+	}
+	defer dstClose()
+
+	pos, err := loadCheckpoint(*checkpoint)
+	if err != nil {
+		logger.Fatalf("checkpoint %s: %v", *checkpoint, err)
+	}
+	if pos == "done" {
+		logger.Infof("migration already completed according to %s", *checkpoint)
+		return
+	}
+	if pos != "" {
+		logger.Infof("resume from %q", pos)
+	}
+
+	m := &migrator{
+		src:    srcBackend,
+		dst:    dstBackend,
+		verify: *verify,
+	}
+	if *qps > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(*qps))
+		defer ticker.Stop()
+		m.tick = ticker.C
+	}
+
+	start := time.Now()
+	err = m.migrate(ctx, pos, *checkpoint)
+	if err != nil {
+		logger.Fatalf("migration failed: %v", err)
+	}
+	logger.Infof("migration completed: copied=%d missing=%d %s", m.ncopied, m.nmissing, time.Since(start))
+}
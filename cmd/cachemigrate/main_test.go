@@ -0,0 +1,282 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	"go.chromium.org/goma/server/cache"
+	"go.chromium.org/goma/server/cache/gcs"
+	"go.chromium.org/goma/server/cache/redis"
+	pb "go.chromium.org/goma/server/proto/cache"
+	"go.chromium.org/goma/server/testing/fakegcs"
+)
+
+// memBackend is in-memory backend, listing keys in lexical order
+// as cloud storage does.
+type memBackend struct {
+	cache.LocalClient
+	keys []string
+}
+
+func newMemBackend(t *testing.T, kvs map[string]string) *memBackend {
+	t.Helper()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cache.New(...): %v", err)
+	}
+	b := &memBackend{
+		LocalClient: cache.LocalClient{CacheServiceServer: c},
+	}
+	for k, v := range kvs {
+		_, err := b.Put(context.Background(), &pb.PutReq{
+			Kv: &pb.KV{Key: k, Value: []byte(v)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.keys = append(b.keys, k)
+	}
+	sort.Strings(b.keys)
+	return b
+}
+
+func (b *memBackend) list(ctx context.Context, pos string, f func([]string, string) error) error {
+	var keys []string
+	for _, key := range b.keys {
+		if key <= pos {
+			continue
+		}
+		keys = append(keys, key)
+		if len(keys) < *batchSize {
+			continue
+		}
+		if err := f(keys, key); err != nil {
+			return err
+		}
+		keys = nil
+	}
+	return f(keys, "done")
+}
+
+// failingBackend fails to put failKey.
+type failingBackend struct {
+	backend
+	failKey string
+}
+
+var errPut = errors.New("put failed")
+
+func (b failingBackend) Put(ctx context.Context, in *pb.PutReq, opts ...grpc.CallOption) (*pb.PutResp, error) {
+	if in.Kv.Key == b.failKey {
+		return nil, errPut
+	}
+	return b.backend.Put(ctx, in, opts...)
+}
+
+func TestMigrateCheckpoint(t *testing.T) {
+	defer func(n int) { *batchSize = n }(*batchSize)
+	*batchSize = 2
+	ctx := context.Background()
+	kvs := map[string]string{
+		"a": "value-a",
+		"b": "value-b",
+		"c": "value-c",
+		"d": "value-d",
+		"e": "value-e",
+	}
+	src := newMemBackend(t, kvs)
+	dst := newMemBackend(t, nil)
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	// fails in 2nd batch.
+	m := &migrator{
+		src:    src,
+		dst:    failingBackend{backend: dst, failKey: "d"},
+		verify: true,
+	}
+	err := m.migrate(ctx, "", checkpoint)
+	if !errors.Is(err, errPut) {
+		t.Fatalf("migrate=%v; want %v", err, errPut)
+	}
+	pos, err := loadCheckpoint(checkpoint)
+	if err != nil || pos != "b" {
+		t.Fatalf("loadCheckpoint=%q, %v; want %q, nil", pos, err, "b")
+	}
+
+	// resume from checkpoint.
+	m = &migrator{
+		src:    src,
+		dst:    dst,
+		verify: true,
+	}
+	err = m.migrate(ctx, pos, checkpoint)
+	if err != nil {
+		t.Fatalf("migrate(resume)=%v; want nil error", err)
+	}
+	if m.ncopied != 3 || m.nmismatch != 0 {
+		t.Errorf("migrate(resume) copied=%d mismatch=%d; want copied=3 mismatch=0", m.ncopied, m.nmismatch)
+	}
+	pos, err = loadCheckpoint(checkpoint)
+	if err != nil || pos != "done" {
+		t.Errorf("loadCheckpoint=%q, %v; want %q, nil", pos, err, "done")
+	}
+	for k, v := range kvs {
+		resp, err := dst.Get(ctx, &pb.GetReq{Key: k})
+		if err != nil || string(resp.GetKv().GetValue()) != v {
+			t.Errorf("dst.Get(%s)=%q, %v; want %q, nil", k, resp.GetKv().GetValue(), err, v)
+		}
+	}
+}
+
+func TestMigrateMissing(t *testing.T) {
+	ctx := context.Background()
+	src := newMemBackend(t, map[string]string{
+		"a": "value-a",
+	})
+	// key expired since list.
+	src.keys = append(src.keys, "b")
+	dst := newMemBackend(t, nil)
+	m := &migrator{
+		src: src,
+		dst: dst,
+	}
+	err := m.migrate(ctx, "", "")
+	if err != nil {
+		t.Fatalf("migrate=%v; want nil error", err)
+	}
+	if m.ncopied != 1 || m.nmissing != 1 {
+		t.Errorf("migrate copied=%d missing=%d; want copied=1 missing=1", m.ncopied, m.nmissing)
+	}
+}
+
+func TestRedisBackendList(t *testing.T) {
+	defer func(n int) { *batchSize = n }(*batchSize)
+	*batchSize = 2
+	ctx := context.Background()
+	s := redis.NewFakeServer(t)
+	s.ScanKeys = []string{
+		"gomafile:a",
+		"gomafile:instance1:b",
+		"gomafile:c",
+		"gomafile:d",
+	}
+	c := redis.NewClient(ctx, s.Addr().String(), redis.Opts{
+		Prefix:         "gomafile:",
+		MaxIdleConns:   1,
+		MaxActiveConns: 1,
+	})
+	defer c.Close()
+	b := redisBackend{Client: c}
+
+	type batch struct {
+		Keys []string
+		Next string
+	}
+	var got []batch
+	err := b.list(ctx, "", func(keys []string, next string) error {
+		got = append(got, batch{Keys: keys, Next: next})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list=%v; want nil error", err)
+	}
+	want := []batch{
+		{Keys: []string{"a"}, Next: "2"},
+		{Keys: []string{"c", "d"}, Next: "done"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+
+	// resume from cursor.
+	got = nil
+	err = b.list(ctx, "2", func(keys []string, next string) error {
+		got = append(got, batch{Keys: keys, Next: next})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list(2)=%v; want nil error", err)
+	}
+	if diff := cmp.Diff(want[1:], got); diff != "" {
+		t.Errorf("list(2) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMigrateGCS(t *testing.T) {
+	defer func(n int) { *batchSize = n }(*batchSize)
+	*batchSize = 2
+	ctx := context.Background()
+	s := fakegcs.NewServer(t)
+	s.CreateBucket("src")
+	s.CreateBucket("dst")
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint(s.Endpoint()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	newGCSBackend := func(bucket string) gcsBackend {
+		c := gcs.New(client.Bucket(bucket))
+		return gcsBackend{
+			LocalClient: cache.LocalClient{CacheServiceServer: c},
+			c:           c,
+		}
+	}
+	kvs := map[string]string{
+		"a": "value-a",
+		"b": "value-b",
+		"c": "value-c",
+	}
+	for k, v := range kvs {
+		s.PutObject("src", k, []byte(v))
+	}
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	m := &migrator{
+		src:    newGCSBackend("src"),
+		dst:    failingBackend{backend: newGCSBackend("dst"), failKey: "c"},
+		verify: true,
+	}
+	err = m.migrate(ctx, "", checkpoint)
+	if !errors.Is(err, errPut) {
+		t.Fatalf("migrate=%v; want %v", err, errPut)
+	}
+	pos, err := loadCheckpoint(checkpoint)
+	if err != nil || pos != "b" {
+		t.Fatalf("loadCheckpoint=%q, %v; want %q, nil", pos, err, "b")
+	}
+
+	m = &migrator{
+		src:    newGCSBackend("src"),
+		dst:    newGCSBackend("dst"),
+		verify: true,
+	}
+	err = m.migrate(ctx, pos, checkpoint)
+	if err != nil {
+		t.Fatalf("migrate(resume)=%v; want nil error", err)
+	}
+	if m.ncopied != 1 || m.nmismatch != 0 {
+		t.Errorf("migrate(resume) copied=%d mismatch=%d; want copied=1 mismatch=0", m.ncopied, m.nmismatch)
+	}
+	for k, v := range kvs {
+		got, ok := s.GetObject("dst", k)
+		if !ok || string(got) != v {
+			t.Errorf("dst object %s=%q, %t; want %q, true", k, got, ok, v)
+		}
+	}
+}
@@ -14,8 +14,10 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"os"
 	"path"
 	"strings"
 	"time"
@@ -32,26 +34,36 @@ import (
 	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 	"go.opencensus.io/zpages"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	bspb "google.golang.org/genproto/googleapis/bytestream"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/protobuf/encoding/prototext"
 
+	"go.chromium.org/goma/server/auth"
+	"go.chromium.org/goma/server/cache"
+	"go.chromium.org/goma/server/cache/gcs"
 	"go.chromium.org/goma/server/cache/redis"
 	"go.chromium.org/goma/server/command"
+	"go.chromium.org/goma/server/command/registry"
+	"go.chromium.org/goma/server/coord"
 	"go.chromium.org/goma/server/exec"
 	"go.chromium.org/goma/server/file"
 	"go.chromium.org/goma/server/log"
 	"go.chromium.org/goma/server/log/errorreporter"
+	"go.chromium.org/goma/server/log/redact"
 	"go.chromium.org/goma/server/profiler"
+	authpb "go.chromium.org/goma/server/proto/auth"
 	cmdpb "go.chromium.org/goma/server/proto/command"
 	pb "go.chromium.org/goma/server/proto/exec"
 	filepb "go.chromium.org/goma/server/proto/file"
 	"go.chromium.org/goma/server/remoteexec"
 	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/remoteexec/provenance"
 	"go.chromium.org/goma/server/rpc"
 	"go.chromium.org/goma/server/server"
+	"go.chromium.org/goma/server/server/healthz"
 )
 
 var (
@@ -61,20 +73,63 @@ var (
 	configMapURI          = flag.String("configmap_uri", "", "deprecated: configmap uri. e.g. gs://$project-toolchain-config/$name.config, text proto of command.ConfigMap.")
 	configMap             = flag.String("configmap", "", "configmap text proto")
 	toolchainConfigBucket = flag.String("toolchain-config-bucket", "", "cloud storage bucket for toolchain config")
+	toolchainConfigDir    = flag.String("toolchain-config-dir", "", "local directory for toolchain config, e.g. mounted volume, in the same layout as --toolchain-config-bucket. watched by fsnotify. for deployments without cloud storage.")
+	toolchainConfigURL    = flag.String("toolchain-config-url", "", "https URL for toolchain config, e.g. raw file URL of git repository. <url>/<runtime>/manifest lists descriptors of the runtime. see command.ConfigMapHTTP.")
+	toolchainConfigPoll   = flag.Duration("toolchain-config-url-poll-interval", command.DefaultHTTPPollInterval, "interval to poll --toolchain-config-url for updates.")
+	coordBucket           = flag.String("coord-bucket", "", "cloud storage bucket to store global state to coordinate active-active clusters: toolchain config rollout led by a cluster holding the lease, and cache namespace version. see package coord.")
+	coordObject           = flag.String("coord-object", "goma-coord.json", "object name of global state in --coord-bucket.")
+	coordCluster          = flag.String("coord-cluster", "", "name of the cluster to coordinate with other clusters by --coord-bucket. cluster name of the GKE cluster if empty.")
+	toolchainConfigK8s    = flag.String("toolchain-config-k8s-object", "", "kubernetes object that has seq of runtimes in data, e.g. configmaps/toolchain-seqs in the namespace of the pod, or API path of custom resource. if set, updates of --toolchain-config-bucket, --toolchain-config-dir or --toolchain-config-url are watched by kubernetes watch API on the object, instead of pubsub or polling. see command.ConfigMapK8s.")
 	configMapFile         = flag.String("configmap_file", "", "filename for configmap text proto")
+	configVerifyTimeout   = flag.Duration("toolchain-config-verify-timeout", 30*time.Second, "timeout to verify notification of --toolchain-config-bucket on startup by inspecting storage notification and pubsub subscription. if verification fails, /healthz reports unhealthy with the reason, instead of silently falling back to hourly polling. 0 disables verification.")
 
 	traceProjectID     = flag.String("trace-project-id", "", "project id for cloud tracing")
+	metricsFormat      = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint       = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders        = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
 	pubsubProjectID    = flag.String("pubsub-project-id", "", "project id for pubsub")
 	serviceAccountFile = flag.String("service-account-file", "", "service account json file")
 
-	remoteexecAddr         = flag.String("remoteexec-addr", "", "use remoteexec API endpoint")
-	remoteInstancePrefix   = flag.String("remote-instance-prefix", "", "remote instance name path prefix.")
-	remoteInstanceBaseName = flag.String("remote-instance-basename", "default_instance", "remote instance basename under remote-instance-prefix")
+	remoteexecAddr            = flag.String("remoteexec-addr", "", "use remoteexec API endpoint")
+	remoteexecConnPoolSize    = flag.Int("remoteexec-conn-pool-size", 1, "number of connections to remoteexec API endpoint. calls are spread over connections in round-robin.")
+	remoteInstancePrefix      = flag.String("remote-instance-prefix", "", "remote instance name path prefix.")
+	remoteInstanceBaseName    = flag.String("remote-instance-basename", "default_instance", "remote instance basename under remote-instance-prefix")
+	remoteInstanceGroups      = flag.String("remote-instance-groups", "", "comma separated list of group=basename to use remote instance basename under remote-instance-prefix for the group, e.g. chrome-bot=ci_instance.")
+	remoteexecRouting         = flag.Bool("remoteexec-routing", false, "route exec requests to multiple remoteexec API endpoints given by targets in toolchain configs (i.e. service_addr of runtimes) in weighted random, with health checking and failover. --remoteexec-addr is still used for capabilities, bytestream and output backfill.")
+	remoteexecRoutingCheck    = flag.Duration("remoteexec-routing-health-check-interval", remoteexec.DefaultRouterHealthCheckInterval, "interval of health checks of remoteexec API endpoints for --remoteexec-routing.")
+	remoteexecRoutingStrategy = flag.String("remoteexec-routing-strategy", "weighted", "strategy to pick remoteexec API endpoint for --remoteexec-routing. weighted: weighted random. sticky-build: route requests of the same build id (or cwd if no build id) to the same endpoint for better input cache hits of remote workers. sticky-cwd: route requests of the same cwd to the same endpoint.")
 
 	// http://b/141901653
-	execMaxRetryCount     = flag.Int("exec-max-retry-count", 5, "max retry count for exec call. 0 is unlimited count, but bound to ctx timtout. Use small number for powerful clients to run local fallback quickly. Use large number for powerless clients to use remote more than local.")
-	execMissingInputLimit = flag.Int("exec-missing-input-limit", 100, "max missing inputs per exec call response. 0 is unlimited, meaning the client will be told about all missing inputs.")
-	execActionTimeout     = flag.Duration("exec-action-timeout", 15*time.Minute, "action timeout after which the execution should be killed.")
+	execMaxRetryCount          = flag.Int("exec-max-retry-count", 5, "max retry count for exec call. 0 is unlimited count, but bound to ctx timtout. Use small number for powerful clients to run local fallback quickly. Use large number for powerless clients to use remote more than local.")
+	execRetryPolicy            = flag.String("exec-retry-policy", "", `text proto of rpc.RetryPolicy for calls to remoteexec API, e.g. "max_attempts: 5 initial_backoff_msec: 100". overrides --exec-max-retry-count if set.`)
+	executeHedgeDelay          = flag.Duration("execute-hedge-delay", 0, "delay to issue hedged Execute if the first Execute doesn't finish, to mitigate long-tail latency of RBE. 0 disables.")
+	cacheHedgeDelay            = flag.Duration("cache-hedge-delay", 0, "delay to issue hedged GetActionResult if the first GetActionResult doesn't finish. 0 disables.")
+	circuitBreakerErrorRate    = flag.Float64("circuit-breaker-error-rate", 0, "error rate of backend calls to stop calling the backend for a while and fail fast. 0 disables circuit breaker.")
+	circuitBreakerOpenDuration = flag.Duration("circuit-breaker-open-duration", rpc.DefaultBreakerOpenDuration, "duration to fail fast after circuit breaker opens, before probing the backend again.")
+	execMissingInputLimit      = flag.Int("exec-missing-input-limit", 100, "max missing inputs per exec call response. 0 is unlimited, meaning the client will be told about all missing inputs.")
+	digestFunction             = flag.String("digest-function", "SHA256", "preferred digest function for RBE CAS. used if RBE backend supports it, otherwise SHA256 or other supported one.")
+	pchMaxSize                 = flag.Int64("pch-max-size", 0, "max size of clang PCH/module output (*.pch, *.gch, *.pcm). larger outputs are rejected and clients will run the compile locally. 0 means no limit.")
+	rejectPCH                  = flag.Bool("reject-pch", false, "reject all clang PCH/module outputs.")
+	executionPriority          = flag.Int("execution-priority", 0, "priority of remote execution, used if RBE backend supports it. 0 means default priority.")
+	cachePriority              = flag.Int("cache-priority", 0, "priority of action cache entries, used if RBE backend supports it. 0 means default priority.")
+	disableCompressedBlobs     = flag.Bool("disable-compressed-blobs", false, "disable zstd compressed bytestream transfers even if RBE backend supports it.")
+	normalizeInputRoot         = flag.Bool("normalize-input-root", false, "map client's input root dir to canonical dir in non relocatable requests, to share action cache among different checkouts.")
+	execActionTimeout          = flag.Duration("exec-action-timeout", 15*time.Minute, "action timeout after which the execution should be killed.")
+	execTimeoutConfig          = flag.String("exec-timeout-config", "", "JSON file of timeout policy to override --exec-action-timeout and --exec-*-timeout per group or command class (compile, link, etc).")
+	execInputLimitConfig       = flag.String("exec-input-limit-config", "", "JSON file of input limit policy to reject requests with too many inputs or too large inputs per group.")
+	execPriorityConfig         = flag.String("exec-priority-config", "", "JSON file of priority policy to map priority hint of requests (INTERACTIVE, BATCH) to RBE execution and cache priority per group. overrides --execution-priority and --cache-priority.")
+	execMinDeadlineBudget      = flag.Duration("exec-min-deadline-budget", remoteexec.DefaultMinDeadlineBudget, "minimum remaining time of the client's timeout to start exec request. exec requests with less remaining time are rejected with DeadlineExceeded.")
+	execMaxConcurrent          = flag.Int("exec-max-concurrent", 0, "max number of concurrent exec requests in total. requests exceeding the limit wait in weighted fair queue per group. 0 means no limit.")
+	execGroupQuotaACL          = flag.String("exec-group-quota-acl", "", "ACL file in text proto to configure max_concurrent_execs and exec_weight per group. reloaded when updated.")
+
+	provenanceSigningKey = flag.String("provenance-signing-key", "", "PEM file of PKCS #8 private key (ed25519, ecdsa or rsa) to sign SLSA provenance attestations of remote outputs. empty disables attestation.")
+	provenanceKeyID      = flag.String("provenance-key-id", "", "key id put in signatures of provenance attestations.")
+	provenanceBuilderID  = flag.String("provenance-builder-id", "", "builder id in provenance attestations, e.g. URI of this server.")
+	provenanceBucket     = flag.String("provenance-bucket", "", "cloud storage bucket to store provenance attestations of remote outputs, keyed by output hash. required for --provenance-signing-key.")
+
+	logRedactConfig = flag.String("log-redact-config", "", "JSON file of patterns to redact sensitive data (e.g. secrets in command lines) in logs and execlog, in addition to default patterns. see go.chromium.org/goma/server/log/redact.")
+
+	rpcPolicyConfig = flag.String("rpc-policy-config", "", "text proto file of rpc.PolicyConfig to configure timeout, retry and hedging of calls per target service (auth, authdb, cache, file, remoteexec). overrides per-service flags, e.g. --exec-retry-policy and --execute-hedge-delay.")
 
 	cmdFilesBucket      = flag.String("cmd-files-bucket", "", "cloud storage bucket for command binary files")
 	fetchConfigParallel = flag.Bool("fetch-config-parallel", true, "fetch toolchain configs in parallel")
@@ -87,6 +142,16 @@ var (
 	// thinlto would upload *.o and *.thinlto.
 	// rbe-staging1 uses 2.2M keys (< 512MB memory usage in redis).
 	maxDigestCacheEntries = flag.Int("max-digest-cache-entries", 2e6, "maximum entries in in-memory digest cache. 0 means unimited")
+	fileMetaCacheEntries  = flag.Int("file-meta-cache-entries", 0, "maximum entries in cache of digests by file metadata hints (filename, mtime, size) from clients. 0 disables.")
+	digestCacheSnapshot   = flag.String("digest-cache-snapshot", "", "file to save in-memory digest cache on shutdown, and to restore it on start. empty disables snapshot.")
+	digestCacheMissingTTL = flag.Duration("digest-cache-missing-ttl", 0, "TTL to remember blobs missing in CAS, to skip checking them again in concurrent requests. 0 disables.")
+
+	missingContinuationEntries = flag.Int("missing-continuation-entries", 0, "maximum entries of requests failed with missing inputs, to skip checking blobs already verified in CAS when the requests are retried. 0 disables.")
+	missingContinuationTTL     = flag.Duration("missing-continuation-ttl", remoteexec.DefaultMissingContinuationTTL, "TTL of blobs verified in CAS for requests failed with missing inputs.")
+
+	requestLogSize               = flag.Int("request-log-size", remoteexec.DefaultRequestLogSize, "maximum number of request records for /debug/requests. 0 disables.")
+	requestLogRetention          = flag.Duration("request-log-retention", remoteexec.DefaultRequestLogRetention, "retention of request records for /debug/requests.")
+	requestLogSuccessSampleRatio = flag.Float64("request-log-success-sample-ratio", 0, "ratio to record succeeded requests for /debug/requests. failed requests are always recorded.")
 
 	// nsjail is applied in hardened request.
 	// note windows and chroot reqs are out of scope for the ratio.
@@ -115,6 +180,36 @@ var (
 
 	redisMaxIdleConns   = flag.Int("redis-max-idle-conns", redis.DefaultMaxIdleConns, "maximum number of idle connections to redis.")
 	redisMaxActiveConns = flag.Int("redis-max-active-conns", redis.DefaultMaxActiveConns, "maximum number of active connections to redis.")
+	redisCommandTimeout = flag.Duration("redis-command-timeout", 0, "timeout of each redis command. 0 means no timeout other than request deadline.")
+
+	minClientCommitTime        = flag.Int64("min-client-commit-time", 0, "reject requests from goma clients whose commit time (unix time) is older than this. 0 means no minimum.")
+	deprecatedClientCommitTime = flag.Int64("deprecated-client-commit-time", 0, "add deprecation warning to responses to goma clients whose commit time (unix time) is older than this. 0 means no deprecation.")
+	clientVersionMessage       = flag.String("client-version-message", "", "additional message for rejected or deprecated goma clients. e.g. how to update goma client.")
+	rejectUnknownClient        = flag.Bool("reject-unknown-client", false, "reject requests from goma clients without valid goma_revision.")
+
+	inventoryAdmins = flag.String("inventory-admins", "", `comma separated emails (or "group:<group>") of users allowed to manage command configs in the inventory at runtime by command.InventoryService. requests are authenticated by auth server at --auth-addr. empty disables the service.`)
+	authAddr        = flag.String("auth-addr", "passthrough:///auth-server:5050", "auth server address, used for --inventory-admins.")
+
+	inventoryAdminBucket       = flag.String("inventory-admin-bucket", "", "cloud storage bucket to store admin changes of the inventory, shared by all exec_server replicas. if empty, admin changes are applied only in the replica that served the admin request.")
+	inventoryAdminObject       = flag.String("inventory-admin-object", "goma-inventory-admin.json", "object name of admin changes in --inventory-admin-bucket.")
+	inventoryAdminSyncInterval = flag.Duration("inventory-admin-sync-interval", exec.DefaultAdminSyncInterval, "interval to sync admin changes from --inventory-admin-bucket.")
+
+	authzPolicyURL        = flag.String("authz-policy-url", "", "URL of OPA data API to authorize exec requests, e.g. http://localhost:8181/v1/data/goma/exec. empty means no authorization policy other than ACL.")
+	authzPolicyFailClosed = flag.Bool("authz-policy-fail-closed", true, "reject exec requests if authorization policy fails to evaluate. false allows them.")
+	authzPolicyCacheTTL   = flag.Duration("authz-policy-cache-ttl", exec.DefaultPolicyCacheTTL, "duration to cache decisions of authorization policy per group and command. 0 disables the cache.")
+
+	journalDir      = flag.String("journal-dir", "", "directory to record in-flight exec requests for crash recovery. empty disables journal.")
+	journalReattach = flag.Bool("journal-reattach", false, "wait for RBE operations of in-flight requests lost by previous crash.")
+
+	warmToolchain            = flag.Bool("warm-toolchain", false, "upload toolchain files to RBE CAS in background after toolchain configs are loaded. requires --cmd-files-bucket.")
+	warmToolchainConcurrency = flag.Int("warm-toolchain-concurrency", remoteexec.DefaultWarmerConcurrency, "concurrency to upload toolchain files to RBE CAS.")
+
+	rbeProbeInterval       = flag.Duration("rbe-probe-interval", 0, "interval to probe RBE instances with CAS round trip and no-op action, to export latency and availability metrics independent of user traffic. 0 disables.")
+	rbeProbeContainerImage = flag.String("rbe-probe-container-image", "", "docker uri of container image to run no-op action of RBE probe.")
+
+	selftest = flag.Bool("selftest", false, "run self-test of dependencies (file server, RBE capabilities, toolchain config load), print the report and exit.")
+
+	cacheNamespace = flag.String("cache-namespace", "", "namespace of cache keys, e.g. remote instance name or tenant. keys are partitioned per namespace in shared cache backend.")
 )
 
 var (
@@ -155,9 +250,15 @@ func configMapToConfigResp(ctx context.Context, cm *cmdpb.ConfigMap) *cmdpb.Conf
 		VersionId: time.Now().UTC().Format(time.RFC3339),
 	}
 	for _, rt := range cm.Runtimes {
+		addr := rt.ServiceAddr
+		if addr == "" {
+			addr = *remoteexecAddr
+		}
 		c := &cmdpb.Config{
 			Target: &cmdpb.Target{
-				Addr: *remoteexecAddr,
+				Addr:           addr,
+				Weight:         rt.ServiceWeight,
+				InstancePrefix: rt.ServiceInstancePrefix,
 			},
 			BuildInfo:          &cmdpb.BuildInfo{},
 			RemoteexecPlatform: &cmdpb.RemoteexecPlatform{},
@@ -188,6 +289,7 @@ func configureByLoader(ctx context.Context, loader *command.ConfigMapLoader, inv
 	if err != nil {
 		return "", err
 	}
+	server.RecordConfigChange(ctx, "toolchain", resp.VersionId)
 	return resp.VersionId, nil
 }
 
@@ -218,7 +320,7 @@ type configServer struct {
 	cancel    func()
 }
 
-func newConfigServer(ctx context.Context, inventory *exec.Inventory, bucket, configMapFile string, cm *cmdpb.ConfigMap, gsclient *storage.Client, opts ...option.ClientOption) (*configServer, error) {
+func newConfigServer(ctx context.Context, inventory *exec.Inventory, bucket, configMapFile string, cm *cmdpb.ConfigMap, gsclient *storage.Client, coordinator *coord.Coordinator, opts ...option.ClientOption) (*configServer, error) {
 	cs := &configServer{
 		inventory: inventory,
 	}
@@ -233,7 +335,7 @@ func newConfigServer(ctx context.Context, inventory *exec.Inventory, bucket, con
 	if err != nil {
 		return nil, fmt.Errorf("pubsub client failed: %v", err)
 	}
-	cs.configmap = command.ConfigMapBucket{
+	configmap := command.ConfigMapBucket{
 		URI:            fmt.Sprintf("gs://%s/", bucket),
 		ConfigMap:      cm,
 		ConfigMapFile:  configMapFile,
@@ -242,17 +344,107 @@ func newConfigServer(ctx context.Context, inventory *exec.Inventory, bucket, con
 		SubscriberID:   fmt.Sprintf("toolchain-config-%s-%s", server.ClusterName(ctx), server.HostName(ctx)),
 		RemoteexecAddr: *remoteexecAddr,
 	}
+	cs.configmap = withCoord(configmap, coordinator)
+	if *configVerifyTimeout > 0 {
+		err = configmap.VerifyNotification(ctx, *configVerifyTimeout)
+		if err != nil {
+			logger := log.FromContext(ctx)
+			logger.Errorf("toolchain config notification: %v", err)
+			healthz.SetUnhealthy(fmt.Sprintf("toolchain config notification: %v", err))
+		}
+	}
 	cs.w = cs.configmap.Watcher(ctx)
 	cs.loader = &command.ConfigMapLoader{
 		ConfigMap: cs.configmap,
 		ConfigLoader: command.ConfigLoader{
 			StorageClient:  stiface.AdaptClient(gsclient),
+			RegistryClient: newRegistryClient(ctx),
 			EnableParallel: *fetchConfigParallel,
 		},
 	}
 	return cs, nil
 }
 
+// newConfigMapServer creates configServer to load toolchain config
+// from configmap without pubsub, i.e. local directory, https endpoint,
+// or configmap watched by kubernetes API.
+func newConfigMapServer(ctx context.Context, inventory *exec.Inventory, configmap command.ConfigMap) *configServer {
+	cs := &configServer{
+		inventory: inventory,
+		configmap: configmap,
+	}
+	cs.w = cs.configmap.Watcher(ctx)
+	cs.loader = &command.ConfigMapLoader{
+		ConfigMap: cs.configmap,
+		ConfigLoader: command.ConfigLoader{
+			RegistryClient: newRegistryClient(ctx),
+			EnableParallel: *fetchConfigParallel,
+		},
+	}
+	return cs
+}
+
+// withCoord wraps configmap to roll out toolchain config coordinated
+// with other clusters, if coordinator is set.
+func withCoord(configmap command.ConfigMap, coordinator *coord.Coordinator) command.ConfigMap {
+	if coordinator == nil {
+		return configmap
+	}
+	return &coord.ConfigMap{
+		ConfigMap:   configmap,
+		Coordinator: coordinator,
+	}
+}
+
+// newCoordinator creates coordinator of active-active clusters if enabled.
+func newCoordinator(ctx context.Context, gsclient *storage.Client) *coord.Coordinator {
+	if *coordBucket == "" {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	cluster := *coordCluster
+	if cluster == "" {
+		cluster = server.ClusterName(ctx)
+	}
+	if cluster == "" {
+		logger.Fatalf("--coord-cluster must be set")
+	}
+	c := &coord.Coordinator{
+		Store: coord.GCSStore{
+			Bucket: gsclient.Bucket(*coordBucket),
+			Object: *coordObject,
+		},
+		Cluster: cluster,
+	}
+	err := c.Sync(ctx)
+	if err != nil {
+		logger.Fatalf("--coord-bucket: %v", err)
+	}
+	state := c.State()
+	logger.Infof("coord: cluster=%s leader=%s cache_namespace_version=%q", cluster, state.Leader, state.CacheNamespaceVersion)
+	server.EnableFeature("coord")
+	go c.Run(ctx)
+	return c
+}
+
+// withK8sWatch wraps configmap to watch seqs in kubernetes object
+// specified by --toolchain-config-k8s-object, if set.
+func withK8sWatch(configmap command.ConfigMap) (command.ConfigMap, error) {
+	if *toolchainConfigK8s == "" {
+		return configmap, nil
+	}
+	client, err := command.NewK8sInClusterClient()
+	if err != nil {
+		return nil, fmt.Errorf("--toolchain-config-k8s-object: %v", err)
+	}
+	server.EnableFeature("toolchain-config-k8s")
+	return command.ConfigMapK8s{
+		ConfigMap: configmap,
+		Client:    client,
+		Path:      client.ObjectPath(*toolchainConfigK8s),
+	}, nil
+}
+
 func (cs *configServer) configure(ctx context.Context, force bool) error {
 	logger := log.FromContext(ctx)
 	id, err := configureByLoader(ctx, cs.loader, cs.inventory, force)
@@ -338,7 +530,7 @@ func (cs *configServer) Shutdown(ctx context.Context) error {
 	return cs.w.Close()
 }
 
-func newDigestCache(ctx context.Context) remoteexec.DigestCache {
+func newDigestCache(ctx context.Context) *digest.Cache {
 	logger := log.FromContext(ctx)
 	addr, err := redis.AddrFromEnv()
 	if err != nil {
@@ -346,11 +538,290 @@ func newDigestCache(ctx context.Context) remoteexec.DigestCache {
 		return digest.NewCache(nil, *maxDigestCacheEntries)
 	}
 	logger.Infof("redis enabled for gomafile-digest: %v idle=%d active=%d", addr, *redisMaxIdleConns, *redisMaxActiveConns)
-	return digest.NewCache(redis.NewClient(ctx, addr, redis.Opts{
-		Prefix:         "gomafile-digest:",
-		MaxIdleConns:   *redisMaxIdleConns,
-		MaxActiveConns: *redisMaxActiveConns,
-	}), *maxDigestCacheEntries)
+	return digest.NewCache(cache.NamespaceClient{
+		CacheServiceClient: redis.NewClient(ctx, addr, redis.Opts{
+			Prefix:         "gomafile-digest:",
+			MaxIdleConns:   *redisMaxIdleConns,
+			MaxActiveConns: *redisMaxActiveConns,
+			CommandTimeout: *redisCommandTimeout,
+		}),
+		Namespace: *cacheNamespace,
+	}, *maxDigestCacheEntries)
+}
+
+// newFileMetaCache creates file metadata cache if enabled.
+func newFileMetaCache() *remoteexec.FileMetaCache {
+	if *fileMetaCacheEntries <= 0 {
+		return nil
+	}
+	server.EnableFeature("file-meta-cache")
+	return remoteexec.NewFileMetaCache(*fileMetaCacheEntries)
+}
+
+// newMissingContinuation creates missing continuation if enabled.
+func newMissingContinuation() *remoteexec.MissingContinuation {
+	if *missingContinuationEntries <= 0 {
+		return nil
+	}
+	server.EnableFeature("missing-continuation")
+	return remoteexec.NewMissingContinuation(*missingContinuationEntries, *missingContinuationTTL)
+}
+
+// newScheduler creates scheduler of exec requests if enabled.
+func newScheduler(ctx context.Context) *remoteexec.Scheduler {
+	if *execMaxConcurrent <= 0 && *execGroupQuotaACL == "" {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	s := &remoteexec.Scheduler{
+		MaxConcurrent: *execMaxConcurrent,
+	}
+	if *execGroupQuotaACL != "" {
+		err := s.Watch(ctx, *execGroupQuotaACL)
+		if err != nil {
+			logger.Fatalf("--exec-group-quota-acl: %v", err)
+		}
+	}
+	server.EnableFeature("exec-scheduler")
+	return s
+}
+
+// newAttestor creates provenance attestor if enabled.
+func newAttestor(ctx context.Context, gsclient *storage.Client) *remoteexec.Attestor {
+	if *provenanceSigningKey == "" {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	if *provenanceBucket == "" {
+		logger.Fatalf("--provenance-bucket must be given for --provenance-signing-key")
+	}
+	signer, err := provenance.LoadSigner(*provenanceSigningKey, *provenanceKeyID)
+	if err != nil {
+		logger.Fatalf("--provenance-signing-key: %v", err)
+	}
+	logger.Infof("provenance attestation: builder=%q key=%q bucket=%q", *provenanceBuilderID, *provenanceKeyID, *provenanceBucket)
+	server.EnableFeature("provenance")
+	return &remoteexec.Attestor{
+		Cache: cache.NamespaceClient{
+			CacheServiceClient: cache.LocalClient{
+				CacheServiceServer: gcs.New(gsclient.Bucket(*provenanceBucket)),
+			},
+			Namespace: *cacheNamespace,
+		},
+		Signer:    signer,
+		BuilderID: *provenanceBuilderID,
+	}
+}
+
+// newRouter creates router to multiple remoteexec API endpoints if enabled.
+func newRouter(ctx context.Context, breaker *rpc.CircuitBreaker) *remoteexec.Router {
+	if !*remoteexecRouting {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	strategy, err := remoteexec.ParseRouteStrategy(*remoteexecRoutingStrategy)
+	if err != nil {
+		logger.Fatalf("--remoteexec-routing-strategy: %v", err)
+	}
+	logger.Infof("remoteexec routing: strategy=%s health check interval=%s", *remoteexecRoutingStrategy, *remoteexecRoutingCheck)
+	server.EnableFeature("remoteexec-routing")
+	return &remoteexec.Router{
+		Dial: func(ctx context.Context, target *cmdpb.Target) (remoteexec.Client, error) {
+			pool, err := remoteexec.DialPool(ctx, target.Addr, *remoteexecConnPoolSize,
+				grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
+				grpc.WithStatsHandler(&ocgrpc.ClientHandler{}))
+			if err != nil {
+				return remoteexec.Client{}, err
+			}
+			retry := newExecRetry(ctx, breaker)
+			retry.Target = target.Addr
+			return remoteexec.Client{
+				Pool:         pool,
+				Retry:        retry,
+				ExecuteHedge: newExecuteHedge(),
+				CacheHedge: rpc.Hedge{
+					Delay: *cacheHedgeDelay,
+				},
+			}, nil
+		},
+		Strategy:            strategy,
+		HealthCheckInterval: *remoteexecRoutingCheck,
+	}
+}
+
+// newRegistryClient creates client to load toolchain configs from
+// registry_ref in runtime configs, e.g. Artifact Registry.
+// It uses access token of the service account as credential,
+// or accesses registries anonymously if no credential is available.
+func newRegistryClient(ctx context.Context) *registry.Client {
+	logger := log.FromContext(ctx)
+	const scope = "https://www.googleapis.com/auth/cloud-platform"
+	var creds *google.Credentials
+	var err error
+	if *serviceAccountFile != "" {
+		var b []byte
+		b, err = ioutil.ReadFile(*serviceAccountFile)
+		if err == nil {
+			creds, err = google.CredentialsFromJSON(ctx, b, scope)
+		}
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, scope)
+	}
+	if err != nil {
+		logger.Warnf("no credential for registry: %v", err)
+		return &registry.Client{}
+	}
+	return &registry.Client{
+		Credential: func(ctx context.Context, registry string) (string, string, error) {
+			token, err := creds.TokenSource.Token()
+			if err != nil {
+				return "", "", err
+			}
+			return "oauth2accesstoken", token.AccessToken, nil
+		},
+	}
+}
+
+// newCircuitBreaker creates circuit breaker for backend calls if enabled.
+func newCircuitBreaker() *rpc.CircuitBreaker {
+	if *circuitBreakerErrorRate <= 0 {
+		return nil
+	}
+	server.EnableFeature("circuit-breaker")
+	return &rpc.CircuitBreaker{
+		ErrorRate:    *circuitBreakerErrorRate,
+		OpenDuration: *circuitBreakerOpenDuration,
+	}
+}
+
+// newExecRetry creates retry policy for calls to remoteexec API.
+func newExecRetry(ctx context.Context, breaker *rpc.CircuitBreaker) rpc.Retry {
+	retry := rpc.Retry{
+		MaxRetry: *execMaxRetryCount,
+	}
+	if *execRetryPolicy != "" {
+		var err error
+		retry, err = rpc.ParseRetryPolicy(*execRetryPolicy)
+		if err != nil {
+			logger := log.FromContext(ctx)
+			logger.Fatalf("--exec-retry-policy: %v", err)
+		}
+	}
+	retry = rpc.PolicyFor(rpc.ServiceRemoteexec).RetryOr(retry)
+	retry.Breaker = breaker
+	retry.Target = *remoteexecAddr
+	return retry
+}
+
+// newExecuteHedge creates hedge policy for Execute calls to remoteexec API.
+// hedge policy in --rpc-policy-config overrides --execute-hedge-delay.
+func newExecuteHedge() rpc.Hedge {
+	if h := rpc.PolicyFor(rpc.ServiceRemoteexec).Hedge; h.Delay > 0 {
+		return h
+	}
+	return rpc.Hedge{
+		Delay: *executeHedgeDelay,
+	}
+}
+
+// newRequestLog creates request log if enabled.
+func newRequestLog() *remoteexec.RequestLog {
+	if *requestLogSize <= 0 {
+		return nil
+	}
+	server.EnableFeature("request-log")
+	return &remoteexec.RequestLog{
+		Size:               *requestLogSize,
+		Retention:          *requestLogRetention,
+		SuccessSampleRatio: *requestLogSuccessSampleRatio,
+	}
+}
+
+// snapshotDigestCache restores dc from *digestCacheSnapshot, and
+// saves dc in it on shutdown.
+func snapshotDigestCache(ctx context.Context, dc *digest.Cache) {
+	if *digestCacheSnapshot == "" {
+		return
+	}
+	logger := log.FromContext(ctx)
+	t := time.Now()
+	n, err := dc.LoadFile(*digestCacheSnapshot)
+	if err != nil {
+		logger.Warnf("digest cache snapshot load %s: %v", *digestCacheSnapshot, err)
+	} else {
+		logger.Infof("digest cache snapshot load %s: %d entries in %s", *digestCacheSnapshot, n, time.Since(t))
+	}
+	server.OnShutdown(func(ctx context.Context) {
+		logger := log.FromContext(ctx)
+		t := time.Now()
+		n, err := dc.SaveFile(*digestCacheSnapshot)
+		if err != nil {
+			logger.Errorf("digest cache snapshot save %s: %v", *digestCacheSnapshot, err)
+			return
+		}
+		logger.Infof("digest cache snapshot save %s: %d entries in %s", *digestCacheSnapshot, n, time.Since(t))
+	})
+}
+
+// newSelfTest returns self-test of exec_server's dependencies.
+func newSelfTest(re *remoteexec.Adapter, fileConn *grpc.ClientConn, gsclient *storage.Client) *server.SelfTest {
+	st := &server.SelfTest{Name: "exec_server"}
+	st.Add("file-server", func(ctx context.Context) error {
+		return server.CheckConn(ctx, fileConn)
+	})
+	st.Add("rbe-capabilities", re.ProbeCapabilities)
+	st.Add("toolchain-config", func(ctx context.Context) error {
+		cm := &cmdpb.ConfigMap{}
+		if *configMap != "" {
+			err := prototext.Unmarshal([]byte(*configMap), cm)
+			if err != nil {
+				return fmt.Errorf("parse configmap %q: %v", *configMap, err)
+			}
+		}
+		var configmap command.ConfigMap
+		switch {
+		case *toolchainConfigBucket != "":
+			configmap = command.ConfigMapBucket{
+				URI:           fmt.Sprintf("gs://%s/", *toolchainConfigBucket),
+				ConfigMap:     cm,
+				ConfigMapFile: *configMapFile,
+				StorageClient: stiface.AdaptClient(gsclient),
+			}
+		case *toolchainConfigDir != "":
+			configmap = command.ConfigMapDir{
+				Dir:           *toolchainConfigDir,
+				ConfigMap:     cm,
+				ConfigMapFile: *configMapFile,
+			}
+		case *toolchainConfigURL != "":
+			configmap = command.ConfigMapHTTP{
+				URL:           *toolchainConfigURL,
+				ConfigMap:     cm,
+				ConfigMapFile: *configMapFile,
+			}
+		default:
+			return re.Inventory.Configure(ctx, configMapToConfigResp(ctx, cm))
+		}
+		// load configs without configmap watcher, which would
+		// create pubsub subscription.
+		loader := &command.ConfigMapLoader{
+			ConfigMap: configmap,
+			ConfigLoader: command.ConfigLoader{
+				StorageClient:  stiface.AdaptClient(gsclient),
+				RegistryClient: newRegistryClient(ctx),
+				EnableParallel: *fetchConfigParallel,
+			},
+		}
+		_, err := loader.Load(ctx, true)
+		return err
+	})
+	if *cmdFilesBucket != "" {
+		st.Add("cmd-files-bucket", func(ctx context.Context) error {
+			_, err := gsclient.Bucket(*cmdFilesBucket).Attrs(ctx)
+			return err
+		})
+	}
+	return st
 }
 
 func main() {
@@ -373,8 +844,25 @@ func main() {
 	logger := log.FromContext(ctx)
 	defer logger.Sync()
 
-	if (*toolchainConfigBucket == "" || *configMapFile == "") && *configMap == "" {
-		logger.Fatalf("--toolchain-config-bucket,--configmap_file or --configmap must be given")
+	if *logRedactConfig != "" {
+		r, err := redact.Load(*logRedactConfig)
+		if err != nil {
+			logger.Fatalf("log redact config: %v", err)
+		}
+		redact.SetDefault(r)
+	}
+
+	if *rpcPolicyConfig != "" {
+		p, err := rpc.LoadPolicies(*rpcPolicyConfig)
+		if err != nil {
+			logger.Fatalf("--rpc-policy-config: %v", err)
+		}
+		rpc.SetPolicies(p)
+		server.EnableFeature("rpc-policy-config")
+	}
+
+	if ((*toolchainConfigBucket == "" && *toolchainConfigDir == "" && *toolchainConfigURL == "") || *configMapFile == "") && *configMap == "" {
+		logger.Fatalf("--toolchain-config-bucket,--toolchain-config-dir,--toolchain-config-url,--configmap_file or --configmap must be given")
 	}
 	if *remoteexecAddr == "" {
 		logger.Fatalf("--remoteexec-addr must be given")
@@ -384,6 +872,14 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "exec_server", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	err = view.Register(configViews...)
 	if err != nil {
@@ -405,8 +901,12 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = view.Register(redis.DefaultViews...)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	trace.ApplyConfig(trace.Config{
-		DefaultSampler: server.NewLimitedSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
+		DefaultSampler: server.TraceSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
 	})
 
 	s, err := server.NewGRPC(*port,
@@ -416,8 +916,14 @@ func main() {
 		logger.Fatal(err)
 	}
 
-	fileConn, err := server.DialContext(ctx, *fileAddr,
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(file.DefaultMaxMsgSize), grpc.MaxCallSendMsgSize(file.DefaultMaxMsgSize)))
+	breaker := newCircuitBreaker()
+	fileDialOpts := []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(file.DefaultMaxMsgSize), grpc.MaxCallSendMsgSize(file.DefaultMaxMsgSize)),
+	}
+	if breaker != nil {
+		fileDialOpts = append(fileDialOpts, grpc.WithUnaryInterceptor(breaker.UnaryClientInterceptor()))
+	}
+	fileConn, err := server.DialContext(ctx, *fileAddr, fileDialOpts...)
 	if err != nil {
 		logger.Fatalf("dial %s: %v", *fileAddr, err)
 	}
@@ -425,8 +931,8 @@ func main() {
 
 	var gsclient *storage.Client
 	var opts []option.ClientOption
-	if *toolchainConfigBucket != "" || *cmdFilesBucket != "" {
-		logger.Infof("toolchain-config-bucket or cmd-files-bucket is specified. use cloud storage")
+	if *toolchainConfigBucket != "" || *cmdFilesBucket != "" || *provenanceBucket != "" || *coordBucket != "" || *inventoryAdminBucket != "" {
+		logger.Infof("toolchain-config-bucket, cmd-files-bucket, provenance-bucket, coord-bucket or inventory-admin-bucket is specified. use cloud storage")
 		if *serviceAccountFile != "" {
 			opts = append(opts, option.WithServiceAccountFile(*serviceAccountFile))
 		}
@@ -438,19 +944,29 @@ func main() {
 	} else {
 		logger.Infof("configmap_uri nor cmd-files-bucket is not specified. don't use cloud storage")
 	}
+	coordinator := newCoordinator(ctx, gsclient)
+	if coordinator != nil {
+		*cacheNamespace = coordinator.CacheNamespace(*cacheNamespace)
+		logger.Infof("coord: cache namespace: %q", *cacheNamespace)
+	}
 
 	logger.Infof("use remoteexec API: %s", *remoteexecAddr)
-	reConn, err := grpc.DialContext(ctx, *remoteexecAddr,
+	logger.Infof("remoteexec API connections: %d", *remoteexecConnPoolSize)
+	rePool, err := remoteexec.DialPool(ctx, *remoteexecAddr, *remoteexecConnPoolSize,
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
 		grpc.WithStatsHandler(&ocgrpc.ClientHandler{}))
 	if err != nil {
 		logger.Fatalf("dial %s: %v", *remoteexecAddr, err)
 	}
-	defer reConn.Close()
+	defer rePool.Close()
 
 	if *remoteInstancePrefix == "" {
 		logger.Fatalf("--remote-instance-prefix must be given for remoteexec API")
 	}
+	groupInstances, err := remoteexec.ParseGroupInstances(*remoteInstanceGroups)
+	if err != nil {
+		logger.Fatalf("--remote-instance-groups: %v", err)
+	}
 
 	if *fileLookupConcurrency == 0 {
 		*fileLookupConcurrency = 1
@@ -458,19 +974,32 @@ func main() {
 	casBlobLookupConcurrency := 20
 	outputFileConcurrency := 20
 	logger.Infof("span timeout = %#v", spanTimeout)
+	digestCache := newDigestCache(ctx)
+	digestCache.MissingTTL = *digestCacheMissingTTL
+	http.Handle("/debug/digestcache", digestCache)
+	snapshotDigestCache(ctx, digestCache)
+	df, err := digest.ParseFunction(*digestFunction)
+	if err != nil {
+		logger.Fatalf("--digest-function: %v", err)
+	}
 	re := &remoteexec.Adapter{
 		InstancePrefix:   *remoteInstancePrefix,
 		InstanceBaseName: *remoteInstanceBaseName,
+		GroupInstances:   groupInstances,
 		ExecTimeout:      *execActionTimeout,
 		SpanTimeout:      spanTimeout,
 		Client: remoteexec.Client{
-			ClientConn: reConn,
-			Retry: rpc.Retry{
-				MaxRetry: *execMaxRetryCount,
+			Pool:         rePool,
+			Retry:        newExecRetry(ctx, breaker),
+			ExecuteHedge: newExecuteHedge(),
+			CacheHedge: rpc.Hedge{
+				Delay: *cacheHedgeDelay,
 			},
 		},
-		GomaFile:    filepb.NewFileServiceClient(fileConn),
-		DigestCache: newDigestCache(ctx),
+		GomaFile:            filepb.NewFileServiceClient(fileConn),
+		DigestCache:         digestCache,
+		FileMetaCache:       newFileMetaCache(),
+		MissingContinuation: newMissingContinuation(),
 		ToolDetails: &rpb.ToolDetails{
 			ToolName:    "goma/exec-server",
 			ToolVersion: "0.0.0-experimental",
@@ -482,8 +1011,130 @@ func main() {
 		NsjailRatio:       *experimentNsjailRatio,
 		DisableHardenings: strings.Split(*disableHardenings, ","),
 		MissingInputLimit: *execMissingInputLimit,
+		DigestFunction:    df,
+		PCHPolicy: remoteexec.PCHPolicy{
+			MaxSize: *pchMaxSize,
+			Reject:  *rejectPCH,
+		},
+		ExecutionPriority:      int32(*executionPriority),
+		CachePriority:          int32(*cachePriority),
+		DisableCompressedBlobs: *disableCompressedBlobs,
+		NormalizeInputRoot:     *normalizeInputRoot,
+		Operations:             &remoteexec.Operations{},
+		RequestLog:             newRequestLog(),
+		VersionPolicy: exec.VersionPolicy{
+			Message:       *clientVersionMessage,
+			RejectUnknown: *rejectUnknownClient,
+		},
+	}
+	if newExecuteHedge().Delay > 0 {
+		server.EnableFeature("execute-hedge")
+	}
+	if *cacheHedgeDelay > 0 {
+		server.EnableFeature("cache-hedge")
+	}
+	http.Handle("/debug/operations", re.Operations)
+	http.Handle("/debug/requests", re.RequestLog)
+	if *minClientCommitTime > 0 {
+		re.VersionPolicy.MinTime = time.Unix(*minClientCommitTime, 0)
+	}
+	if *deprecatedClientCommitTime > 0 {
+		re.VersionPolicy.DeprecatedTime = time.Unix(*deprecatedClientCommitTime, 0)
+	}
+	if *authzPolicyURL != "" {
+		logger.Infof("authorization policy: %s fail-closed=%t cache-ttl=%s", *authzPolicyURL, *authzPolicyFailClosed, *authzPolicyCacheTTL)
+		var policy exec.Policy = exec.OPAPolicy{
+			URL: *authzPolicyURL,
+			Client: &http.Client{
+				Timeout: 5 * time.Second,
+			},
+		}
+		if *authzPolicyCacheTTL > 0 {
+			policy = &exec.CachedPolicy{
+				Policy: policy,
+				TTL:    *authzPolicyCacheTTL,
+			}
+		}
+		re.Policy = policy
+		re.PolicyFailClosed = *authzPolicyFailClosed
+	}
+	if *execTimeoutConfig != "" {
+		p, err := remoteexec.LoadTimeoutPolicy(*execTimeoutConfig)
+		if err != nil {
+			logger.Fatalf("exec timeout config: %v", err)
+		}
+		logger.Infof("exec timeout policy: %d rules", len(p.Rules))
+		re.TimeoutPolicy = p
+	}
+	re.MinDeadlineBudget = *execMinDeadlineBudget
+	re.Scheduler = newScheduler(ctx)
+	re.Attestor = newAttestor(ctx, gsclient)
+	re.Router = newRouter(ctx, breaker)
+	if *execInputLimitConfig != "" {
+		p, err := remoteexec.LoadInputLimitPolicy(*execInputLimitConfig)
+		if err != nil {
+			logger.Fatalf("exec input limit config: %v", err)
+		}
+		logger.Infof("exec input limit policy: %d rules", len(p.Rules))
+		re.InputLimitPolicy = p
+	}
+	if *execPriorityConfig != "" {
+		p, err := remoteexec.LoadPriorityPolicy(*execPriorityConfig)
+		if err != nil {
+			logger.Fatalf("exec priority config: %v", err)
+		}
+		logger.Infof("exec priority policy: %d rules", len(p.Rules))
+		re.PriorityPolicy = p
 	}
 	logger.Infof("hardeniong=%f nsjail=%f", re.HardeningRatio, re.NsjailRatio)
+	server.AddStatuszCheck("file-server", func(ctx context.Context) error {
+		return server.CheckConn(ctx, fileConn)
+	})
+	server.AddStatuszCheck("rbe-capabilities", re.ProbeCapabilities)
+	if *rbeProbeInterval > 0 {
+		platform := &rpb.Platform{
+			Properties: []*rpb.Platform_Property{
+				{
+					Name:  "OSFamily",
+					Value: "Linux",
+				},
+			},
+		}
+		if *rbeProbeContainerImage != "" {
+			platform.Properties = append(platform.Properties, &rpb.Platform_Property{
+				Name:  "container-image",
+				Value: *rbeProbeContainerImage,
+			})
+		}
+		prober := &remoteexec.Prober{
+			Adapter:  re,
+			Platform: platform,
+			Interval: *rbeProbeInterval,
+		}
+		logger.Infof("rbe prober: interval=%s", *rbeProbeInterval)
+		go prober.Run(ctx)
+		server.AddStatuszCheck("rbe-prober", prober.Check)
+	}
+	if *selftest {
+		server.RunSelfTest(ctx, newSelfTest(re, fileConn, gsclient))
+	}
+	err = re.ProbeCapabilities(ctx)
+	if err != nil {
+		// it would be retried at the first Exec.
+		logger.Warnf("probe capabilities: %v", err)
+	}
+	if *journalDir != "" {
+		j, err := remoteexec.NewJournal(*journalDir)
+		if err != nil {
+			logger.Fatalf("journal %s: %v", *journalDir, err)
+		}
+		entries, err := j.Load(ctx)
+		if err != nil {
+			logger.Fatalf("journal %s: %v", *journalDir, err)
+		}
+		re.Journal = j
+		go re.Recover(ctx, entries, *journalReattach)
+	}
 
 	if *cmdFilesBucket == "" {
 		logger.Warnf("--cmd-files-bucket is not given. support only ARBITRARY_TOOLCHAIN_SUPPORT enabled client")
@@ -492,9 +1143,42 @@ func main() {
 		re.CmdStorage = cmdStorageBucket{
 			Bucket: gsclient.Bucket(*cmdFilesBucket),
 		}
+		if *warmToolchain {
+			logger.Infof("warm toolchain files concurrency=%d", *warmToolchainConcurrency)
+			warmer := &remoteexec.Warmer{
+				Adapter:     re,
+				Concurrency: *warmToolchainConcurrency,
+			}
+			defer warmer.Stop()
+			re.Inventory.OnConfigure = warmer.Warm
+		}
+	}
+	if router := re.Router; router != nil {
+		router.HealthCheck = re.CheckBackend
+		onConfigure := re.Inventory.OnConfigure
+		re.Inventory.OnConfigure = func(ctx context.Context, configs []*cmdpb.Config) {
+			router.Configure(ctx, configs)
+			if onConfigure != nil {
+				onConfigure(ctx, configs)
+			}
+		}
+		go router.Run(ctx)
+		server.AddStatuszCheck("remoteexec-routing", router.Check)
 	}
 
 	inventory := &re.Inventory
+	if *inventoryAdminBucket != "" {
+		logger.Infof("inventory admin changes in gs://%s/%s", *inventoryAdminBucket, *inventoryAdminObject)
+		inventory.AdminStore = exec.GCSAdminStore{
+			Bucket: gsclient.Bucket(*inventoryAdminBucket),
+			Object: *inventoryAdminObject,
+		}
+		err = inventory.SyncAdmin(ctx)
+		if err != nil {
+			logger.Fatalf("--inventory-admin-bucket: %v", err)
+		}
+		go inventory.WatchAdmin(ctx, *inventoryAdminSyncInterval)
+	}
 
 	// expose bytestream proxy.
 	bs := &remoteexec.ByteStream{
@@ -522,10 +1206,29 @@ func main() {
 				return
 			}
 			logger.Infof("configure %s", resp.VersionId)
+			server.RecordConfigChange(ctx, "toolchain", resp.VersionId)
 			ready <- nil
 		}()
 		confServer = nullServer{ch: make(chan error)}
 
+	case *toolchainConfigBucket != "" && *toolchainConfigK8s != "":
+		configmap, err := withK8sWatch(command.ConfigMapBucket{
+			URI:            fmt.Sprintf("gs://%s/", *toolchainConfigBucket),
+			ConfigMap:      &cmdpb.ConfigMap{},
+			ConfigMapFile:  *configMapFile,
+			StorageClient:  stiface.AdaptClient(gsclient),
+			RemoteexecAddr: *remoteexecAddr,
+		})
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cs := newConfigMapServer(ctx, inventory, withCoord(configmap, coordinator))
+		cs.loader.ConfigLoader.StorageClient = stiface.AdaptClient(gsclient)
+		go func() {
+			ready <- cs.configure(ctx, true)
+		}()
+		confServer = cs
+
 	case *toolchainConfigBucket != "":
 		cm := &cmdpb.ConfigMap{}
 		if *configMap != "" {
@@ -535,7 +1238,7 @@ func main() {
 				return
 			}
 		}
-		cs, err := newConfigServer(ctx, inventory, *toolchainConfigBucket, *configMapFile, cm, gsclient, opts...)
+		cs, err := newConfigServer(ctx, inventory, *toolchainConfigBucket, *configMapFile, cm, gsclient, coordinator, opts...)
 		if err != nil {
 			logger.Fatalf("configServer: %v", err)
 		}
@@ -543,9 +1246,59 @@ func main() {
 			ready <- cs.configure(ctx, true)
 		}()
 		confServer = cs
+
+	case *toolchainConfigDir != "":
+		configmap, err := withK8sWatch(command.ConfigMapDir{
+			Dir:            *toolchainConfigDir,
+			ConfigMap:      &cmdpb.ConfigMap{},
+			ConfigMapFile:  *configMapFile,
+			RemoteexecAddr: *remoteexecAddr,
+		})
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cs := newConfigMapServer(ctx, inventory, withCoord(configmap, coordinator))
+		go func() {
+			ready <- cs.configure(ctx, true)
+		}()
+		confServer = cs
+
+	case *toolchainConfigURL != "":
+		configmap, err := withK8sWatch(command.ConfigMapHTTP{
+			URL:            *toolchainConfigURL,
+			ConfigMap:      &cmdpb.ConfigMap{},
+			ConfigMapFile:  *configMapFile,
+			PollInterval:   *toolchainConfigPoll,
+			RemoteexecAddr: *remoteexecAddr,
+		})
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cs := newConfigMapServer(ctx, inventory, withCoord(configmap, coordinator))
+		go func() {
+			ready <- cs.configure(ctx, true)
+		}()
+		confServer = cs
 	}
 	http.Handle("/configz", inventory)
 	pb.RegisterExecServiceServer(s.Server, re)
+	if *inventoryAdmins != "" {
+		authConn, err := server.DialContext(ctx, *authAddr)
+		if err != nil {
+			logger.Fatalf("dial %s: %v", *authAddr, err)
+		}
+		defer authConn.Close()
+		admins := strings.Split(*inventoryAdmins, ",")
+		logger.Infof("inventory admins: %q", admins)
+		cmdpb.RegisterInventoryServiceServer(s.Server, &exec.InventoryAdmin{
+			Inventory: inventory,
+			Auth: &auth.Auth{
+				Client: authpb.NewAuthServiceClient(authConn),
+			},
+			Admins: admins,
+		})
+		server.EnableFeature("inventory-admin")
+	}
 
 	// as of Dec 14 2018, it takes about 45 seconds to be ready.
 	// so wait 90-110 seconds with buffer.  b/120394151
@@ -11,14 +11,17 @@ import (
 	"context"
 	"flag"
 	"net/http"
+	"os"
 
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 	"go.opencensus.io/zpages"
+	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 
 	"go.chromium.org/goma/server/execlog"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/log/redact"
 	"go.chromium.org/goma/server/profiler"
 	pb "go.chromium.org/goma/server/proto/execlog"
 	"go.chromium.org/goma/server/server"
@@ -28,7 +31,24 @@ var (
 	port  = flag.Int("port", 5050, "rpc port")
 	mport = flag.Int("mport", 8081, "monitor port")
 
-	projectID = flag.String("project-id", "", "project id")
+	projectID     = flag.String("project-id", "", "project id")
+	metricsFormat = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint  = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders   = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
+
+	bigqueryTable      = flag.String("bigquery-table", "", `BigQuery table to store execlog, as "<project>.<dataset>.<table>". empty disables.`)
+	jsonlFile          = flag.String("jsonl-file", "", "local file to append execlog in JSON lines format. empty disables.")
+	pubsubTopics       = flag.String("pubsub-topics", "", `comma separated Pub/Sub topics to publish execlog, as "projects/<project>/topics/<topic>" or "<topic>" in --project-id. each topic may have batching options, e.g. "<topic>?batch_size=100&flush_interval=1s&queue_size=10000".`)
+	kafkaRESTProxy     = flag.String("kafka-rest-proxy", "", `Kafka REST Proxy URL to produce execlog to --kafka-topics, e.g. "http://kafka-rest:8082".`)
+	kafkaTopics        = flag.String("kafka-topics", "", "comma separated Kafka topics to produce execlog. each topic may have batching options as --pubsub-topics.")
+	batchSize          = flag.Int("batch-size", execlog.DefaultBatchSize, "max number of execlog rows written at once.")
+	flushInterval      = flag.Duration("flush-interval", execlog.DefaultFlushInterval, "max duration to buffer execlog rows.")
+	queueSize          = flag.Int("queue-size", execlog.DefaultQueueSize, "max number of buffered execlog rows. rows are dropped if the buffer is full.")
+	serviceAccountFile = flag.String("service-account-file", "", "service account json file to access BigQuery and Pub/Sub. empty uses default credentials.")
+
+	logRedactConfig = flag.String("log-redact-config", "", "JSON file of patterns to redact sensitive data (e.g. secrets in command lines) in logs and execlog, in addition to default patterns. see go.chromium.org/goma/server/log/redact.")
+
+	selftest = flag.Bool("selftest", false, "run self-test, print the report and exit.")
 )
 
 func main() {
@@ -41,17 +61,33 @@ func main() {
 	logger := log.FromContext(ctx)
 	defer logger.Sync()
 
+	if *logRedactConfig != "" {
+		r, err := redact.Load(*logRedactConfig)
+		if err != nil {
+			logger.Fatalf("log redact config: %v", err)
+		}
+		redact.SetDefault(r)
+	}
+
 	err := server.Init(ctx, *projectID, "execlog_server")
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "execlog_server", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	err = view.Register(execlog.DefaultViews...)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
 	trace.ApplyConfig(trace.Config{
-		DefaultSampler: server.NewLimitedSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
+		DefaultSampler: server.TraceSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
 	})
 
 	s, err := server.NewGRPC(*port,
@@ -59,10 +95,49 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
-	els := &execlog.Service{}
+	sinkConfig := execlog.SinkConfig{
+		BigQueryTable:  *bigqueryTable,
+		JSONLFile:      *jsonlFile,
+		PubSubProject:  *projectID,
+		PubSubTopics:   *pubsubTopics,
+		KafkaRESTProxy: *kafkaRESTProxy,
+		KafkaTopics:    *kafkaTopics,
+		BatchSize:      *batchSize,
+		FlushInterval:  *flushInterval,
+		QueueSize:      *queueSize,
+	}
+	if *serviceAccountFile != "" {
+		sinkConfig.ClientOptions = append(sinkConfig.ClientOptions, option.WithCredentialsFile(*serviceAccountFile))
+	}
+	batchers, err := sinkConfig.NewBatchers(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *selftest {
+		st := &server.SelfTest{Name: "execlog_server"}
+		for _, b := range batchers {
+			for _, s := range b.Sinks {
+				switch s := s.(type) {
+				case *execlog.BigQuery:
+					st.Add(s.String(), s.Check)
+				case *execlog.PubSub:
+					st.Add(s.String(), s.Check)
+				}
+			}
+		}
+		server.RunSelfTest(ctx, st)
+	}
+	els := &execlog.Service{
+		Batchers: batchers,
+	}
 	pb.RegisterLogServiceServer(s.Server, els)
 
 	hs := server.NewHTTP(*mport, nil)
 	zpages.Handle(http.DefaultServeMux, "/debug")
-	server.Run(ctx, s, hs)
+	servers := []server.Server{s, hs}
+	for _, b := range batchers {
+		logger.Infof("execlog sinks: %v", b.Sinks)
+		servers = append(servers, b)
+	}
+	server.Run(ctx, servers...)
 }
@@ -11,11 +11,17 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 	k8sapi "golang.org/x/build/kubernetes/api"
 	"google.golang.org/api/option"
+	bspb "google.golang.org/genproto/googleapis/bytestream"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -23,9 +29,11 @@ import (
 	"go.chromium.org/goma/server/cache"
 	"go.chromium.org/goma/server/cache/gcs"
 	"go.chromium.org/goma/server/cache/redis"
+	"go.chromium.org/goma/server/coord"
 	"go.chromium.org/goma/server/file"
 	"go.chromium.org/goma/server/log"
 	"go.chromium.org/goma/server/profiler"
+	"go.chromium.org/goma/server/rpc"
 	"go.chromium.org/goma/server/server"
 	"go.chromium.org/goma/server/server/healthz"
 
@@ -37,14 +45,43 @@ var (
 	port      = flag.Int("port", 5050, "rpc port")
 	mport     = flag.Int("mport", 8081, "monitor port")
 	cacheAddr = flag.String("file-cache-addr", "", "cache server address")
-	bucket    = flag.String("bucket", "", "backing store bucket")
+	bucket    = flag.String("bucket", "", "backing store bucket. if redis is enabled, it is used as fallback when redis fails.")
 
 	traceProjectID = flag.String("trace-project-id", "", "project id for cloud tracing")
+	metricsFormat  = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint   = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders    = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
 
 	serviceAccountFile = flag.String("service-account-file", "", "service account json file")
 
 	redisMaxIdleConns   = flag.Int("redis-max-idle-conns", redis.DefaultMaxIdleConns, "maximum number of idle connections to redis.")
 	redisMaxActiveConns = flag.Int("redis-max-active-conns", redis.DefaultMaxActiveConns, "maximum number of active connections to redis.")
+	redisCommandTimeout = flag.Duration("redis-command-timeout", 0, "timeout of each redis command. 0 means no timeout other than request deadline.")
+	redisFallbackWrite  = flag.Bool("redis-fallback-write", false, "store file blobs in --bucket too, asynchronously, if redis is enabled. if false, --bucket should be populated by other writers to be useful as fallback.")
+
+	cacheNamespace = flag.String("cache-namespace", "", "namespace of cache keys, e.g. remote instance name or tenant. keys are partitioned per namespace in shared cache backend.")
+	coordBucket    = flag.String("coord-bucket", "", "cloud storage bucket of global state of active-active clusters. cache namespace version in the state is appended to --cache-namespace. see package coord.")
+	coordObject    = flag.String("coord-object", "goma-coord.json", "object name of global state in --coord-bucket.")
+
+	enableByteStream = flag.Bool("bytestream", false, "serve ByteStream API backed by file cache, so RBE-compatible tools can read/write blobs by content digest. implies --index-content.")
+	dedupChunks      = flag.Bool("dedup-chunks", false, "accept chunk ref in StoreFile to dedup chunks by content. see file.FromReaderDedup.")
+	indexContent     = flag.Bool("index-content", false, "record index from content hash to file hash key on StoreFile, to serve them by ByteStream API.")
+
+	verifyHash = flag.Bool("verify-hash", false, "verify SHA-256 of file blobs read from cache, and treat mismatch as cache miss.")
+
+	skipExisting = flag.Bool("skip-existing", false, "skip storing file blobs that already exist in cache. existence is checked without fetching value (redis or cloud storage).")
+
+	denylistFile = flag.String("denylist", "", "file of cache keys (file hash keys or content digests), a key per line, that must not be served nor stored, e.g. to quarantine poisoned blobs. reloaded when updated.")
+
+	compressMinSize = flag.Int("compress-min-size", -1, "compress file blobs with zstd before storing in cache if blob size is larger than or equal to this value. negative value disables compression.")
+
+	groupQuota       = flag.Int64("group-quota", 0, "max bytes stored by StoreFile per end user group in --group-quota-period. 0 means no limit.")
+	groupQuotaPeriod = flag.Duration("group-quota-period", file.DefaultQuotaPeriod, "period to reset usage of --group-quota.")
+	groupQuotas      = flag.String("group-quotas", "", "comma separated list of group=bytes to override --group-quota for the group.")
+
+	selftest = flag.Bool("selftest", false, "run self-test of dependencies (cache put/get), print the report and exit.")
+
+	rpcPolicyConfig = flag.String("rpc-policy-config", "", "text proto file of rpc.PolicyConfig to configure timeout, retry and hedging of calls per target service (auth, authdb, cache, file, remoteexec). overrides per-service flags, e.g. --redis-command-timeout.")
 )
 
 type admissionController struct {
@@ -69,9 +106,69 @@ func (a admissionController) AdmitPut(ctx context.Context, in *cachepb.PutReq) e
 	// TODO: with retryinfo?
 	msg := fmt.Sprintf("memory size %d + req:%d > limit %d: gc->%d", rss, s, a.limit, newRSS)
 	healthz.SetUnhealthy(msg)
+	server.LoadReject(ctx, server.LoadFile)
 	return status.Error(codes.ResourceExhausted, msg)
 }
 
+// coordCacheNamespace returns cache namespace for ns with cache namespace
+// version in global state in --coord-bucket.
+// file server just follows the state, and never holds the lease.
+func coordCacheNamespace(ctx context.Context, ns string) string {
+	logger := log.FromContext(ctx)
+	var opts []option.ClientOption
+	if *serviceAccountFile != "" {
+		opts = append(opts, option.WithServiceAccountFile(*serviceAccountFile))
+	}
+	gsclient, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		logger.Fatalf("storage client failed: %v", err)
+	}
+	defer gsclient.Close()
+	c := &coord.Coordinator{
+		Store: coord.GCSStore{
+			Bucket: gsclient.Bucket(*coordBucket),
+			Object: *coordObject,
+		},
+	}
+	err = c.Sync(ctx)
+	if err != nil {
+		logger.Fatalf("--coord-bucket: %v", err)
+	}
+	server.EnableFeature("coord")
+	ns = c.CacheNamespace(ns)
+	logger.Infof("coord: cache namespace: %q", ns)
+	return ns
+}
+
+// newBucketClient returns cache client of cloud storage bucket
+// and storage client used by the cache.
+func newBucketClient(ctx context.Context, bucket string) (*storage.Client, cachepb.CacheServiceClient) {
+	logger := log.FromContext(ctx)
+	var opts []option.ClientOption
+	if *serviceAccountFile != "" {
+		opts = append(opts, option.WithServiceAccountFile(*serviceAccountFile))
+	}
+	gsclient, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		logger.Fatalf("storage client failed: %v", err)
+	}
+	c := gcs.New(gsclient.Bucket(bucket))
+	limit, err := server.MemoryLimit()
+	if err != nil {
+		logger.Errorf("unknown memory limit: %v", err)
+	} else {
+		margin := int64(2 * file.DefaultMaxMsgSize)
+		a := admissionController{
+			limit: limit - margin,
+		}
+		c.AdmissionController = a
+		limitq := k8sapi.NewQuantity(limit, k8sapi.BinarySI)
+		marginq := k8sapi.NewQuantity(margin, k8sapi.BinarySI)
+		logger.Infof("memory check threshold: limit:%s - mergin:%s = %d", limitq, marginq, a.limit)
+	}
+	return gsclient, cache.LocalClient{CacheServiceServer: c}
+}
+
 func main() {
 	flag.Parse()
 
@@ -82,12 +179,29 @@ func main() {
 	logger := log.FromContext(ctx)
 	defer logger.Sync()
 
+	if *rpcPolicyConfig != "" {
+		p, err := rpc.LoadPolicies(*rpcPolicyConfig)
+		if err != nil {
+			logger.Fatalf("--rpc-policy-config: %v", err)
+		}
+		rpc.SetPolicies(p)
+		server.EnableFeature("rpc-policy-config")
+	}
+
 	err := server.Init(ctx, *traceProjectID, "file_server")
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "file_server", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	trace.ApplyConfig(trace.Config{
-		DefaultSampler: server.NewLimitedSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
+		DefaultSampler: server.TraceSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
 	})
 
 	s, err := server.NewGRPC(*port,
@@ -106,9 +220,21 @@ func main() {
 			Prefix:         "gomafile:",
 			MaxIdleConns:   *redisMaxIdleConns,
 			MaxActiveConns: *redisMaxActiveConns,
+			CommandTimeout: *redisCommandTimeout,
 		})
 		defer c.Close()
 		cclient = c
+		if *bucket != "" {
+			logger.Infof("use cloud storage bucket as fallback of redis: %s", *bucket)
+			gsclient, fallback := newBucketClient(ctx, *bucket)
+			defer gsclient.Close()
+			cclient = &cache.FallbackClient{
+				CacheServiceClient: c,
+				Fallback:           fallback,
+				WriteFallback:      *redisFallbackWrite,
+			}
+			server.EnableFeature("redis-fallback")
+		}
 
 	case *cacheAddr != "":
 		logger.Infof("use cache server: %s", *cacheAddr)
@@ -121,38 +247,103 @@ func main() {
 
 	case *bucket != "":
 		logger.Infof("use cloud storage bucket: %s", *bucket)
-		var opts []option.ClientOption
-		if *serviceAccountFile != "" {
-			opts = append(opts, option.WithServiceAccountFile(*serviceAccountFile))
-		}
-		gsclient, err := storage.NewClient(ctx, opts...)
-		if err != nil {
-			logger.Fatalf("storage client failed: %v", err)
-		}
+		gsclient, c := newBucketClient(ctx, *bucket)
 		defer gsclient.Close()
-		c := gcs.New(gsclient.Bucket(*bucket))
-		limit, err := server.MemoryLimit()
-		if err != nil {
-			logger.Errorf("unknown memory limit: %v", err)
-		} else {
-			margin := int64(2 * file.DefaultMaxMsgSize)
-			a := admissionController{
-				limit: limit - margin,
-			}
-			c.AdmissionController = a
-			limitq := k8sapi.NewQuantity(limit, k8sapi.BinarySI)
-			marginq := k8sapi.NewQuantity(margin, k8sapi.BinarySI)
-			logger.Infof("memory check threshold: limit:%s - mergin:%s = %d", limitq, marginq, a.limit)
-		}
-		cclient = cache.LocalClient{CacheServiceServer: c}
+		cclient = c
 
 	default:
 		logger.Fatal("no cache server")
 	}
+	if *coordBucket != "" {
+		*cacheNamespace = coordCacheNamespace(ctx, *cacheNamespace)
+	}
+	if *cacheNamespace != "" {
+		logger.Infof("cache namespace: %s", *cacheNamespace)
+		cclient = cache.NamespaceClient{
+			CacheServiceClient: cclient,
+			Namespace:          *cacheNamespace,
+		}
+	}
+	if *compressMinSize >= 0 {
+		logger.Infof("compress file blobs >= %d bytes", *compressMinSize)
+		cclient = cache.CompressClient{
+			CacheServiceClient: cclient,
+			MinSize:            *compressMinSize,
+		}
+	}
+	if *denylistFile != "" {
+		denylist := &cache.Denylist{}
+		err := denylist.Watch(ctx, *denylistFile)
+		if err != nil {
+			logger.Fatalf("--denylist: %v", err)
+		}
+		server.EnableFeature("denylist")
+		cclient = cache.DenylistClient{
+			CacheServiceClient: cclient,
+			Denylist:           denylist,
+		}
+	}
+	if *selftest {
+		st := &server.SelfTest{Name: "file_server"}
+		st.Add("cache", func(ctx context.Context) error {
+			return cache.SelfTest(ctx, cclient)
+		})
+		server.RunSelfTest(ctx, st)
+	}
+	err = view.Register(file.DefaultViews...)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	fs := &file.Service{
-		Cache: cclient,
+		Cache:        cclient,
+		VerifyHash:   *verifyHash,
+		IndexContent: *indexContent || *enableByteStream,
+		DedupChunks:  *dedupChunks,
+		SkipExisting: *skipExisting,
+	}
+	quota, err := newQuota(*groupQuota, *groupQuotas, *groupQuotaPeriod)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if quota != nil {
+		logger.Infof("group quota=%d groups=%v per %s", quota.Limit, quota.GroupLimits, quota.Period)
+		fs.Quota = quota
 	}
 	pb.RegisterFileServiceServer(s.Server, fs)
+	if *enableByteStream {
+		logger.Infof("enable bytestream")
+		bspb.RegisterByteStreamServer(s.Server, &file.ByteStream{
+			Service: fs,
+		})
+	}
 	hs := server.NewHTTP(*mport, nil)
 	server.Run(ctx, s, hs)
 }
+
+// newQuota creates file.Quota from flag values.
+// It returns nil if no quota is set.
+func newQuota(limit int64, groupLimits string, period time.Duration) (*file.Quota, error) {
+	if limit <= 0 && groupLimits == "" {
+		return nil, nil
+	}
+	q := &file.Quota{
+		Limit:  limit,
+		Period: period,
+	}
+	if groupLimits == "" {
+		return q, nil
+	}
+	q.GroupLimits = make(map[string]int64)
+	for _, gl := range strings.Split(groupLimits, ",") {
+		i := strings.Index(gl, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("bad group quota %q: want group=bytes", gl)
+		}
+		n, err := strconv.ParseInt(gl[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad group quota %q: %v", gl, err)
+		}
+		q.GroupLimits[gl[:i]] = n
+	}
+	return q, nil
+}
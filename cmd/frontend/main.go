@@ -14,7 +14,9 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
 	"path/filepath"
+	"time"
 
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
@@ -27,8 +29,12 @@ import (
 
 	"go.chromium.org/goma/server/auth"
 	"go.chromium.org/goma/server/backend"
+	"go.chromium.org/goma/server/cache/redis"
 	"go.chromium.org/goma/server/frontend"
+	"go.chromium.org/goma/server/httprpc"
+	authrpc "go.chromium.org/goma/server/httprpc/auth"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/log/redact"
 	"go.chromium.org/goma/server/profiler"
 	"go.chromium.org/goma/server/server"
 	"go.chromium.org/goma/server/server/healthz"
@@ -56,12 +62,38 @@ var (
 	namespace = flag.String("namespace", "", "cluster namespace for trace prefix and label")
 
 	traceProjectID = flag.String("trace-project-id", "", "project id for cloud tracing")
+	metricsFormat  = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint   = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders    = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
+
+	logRedactConfig = flag.String("log-redact-config", "", "JSON file of redact config, e.g. to pseudonymize user identities in metrics. see go.chromium.org/goma/server/log/redact.")
 
 	serviceAccountFile = flag.String("service-account-file", "", "service account json file")
+	authClockSkew      = flag.Duration("auth-clock-skew", auth.DefaultClockSkew, "tolerance of clock skew between auth server and frontend in checking expiration of tokens. negative disables tolerance.")
+
+	credentialKeyFile = flag.String("credential-key-file", "", "file of HMAC keys of credentials issued by auth server's enroll, to verify requests signed by the credentials. if set, credentials must be used with request signature, to protect them from replay. nonces are kept in redis if REDISHOST is set. empty disables.")
+	replayWindow      = flag.Duration("request-replay-window", auth.DefaultReplayWindow, "validity window of timestamp of requests signed by credentials, used with --credential-key-file.")
 
 	memoryMargin = flag.String("memory-margin",
 		k8sapi.NewQuantity(maxMsgSize, k8sapi.BinarySI).String(),
 		`accepts incoming requests if memory is available more than margin (bytes), if this value is positive.  can be kubernetes quantity string. e.g. "100Mi".  will be used if -memory-threshold is not specified.`)
+
+	storeFileIdempotencyTTL = flag.Duration("store-file-idempotency-ttl", frontend.DefaultIdempotencyTTL, "duration to keep StoreFile responses for client retries with the same idempotency key. 0 disables.")
+
+	batchMaxCalls = flag.Int("batch-max-calls", 100, "max number of LookupFile/SaveLog calls in a batch request. 0 disables batch requests.")
+
+	fileCompressor = flag.String("file-server-compression", "", `grpc compression for requests to file server of local backend. "gzip" or "zstd". empty means no compression.`)
+	execCompressor = flag.String("exec-server-compression", "", `grpc compression for requests to exec server of local backend. "gzip" or "zstd". empty means no compression.`)
+
+	ipQPS      = flag.Float64("rate-limit-ip-qps", 0, "max requests per second per client IP. 0 means no limit.")
+	ipBurst    = flag.Int("rate-limit-ip-burst", 100, "burst size of requests per client IP, used with --rate-limit-ip-qps.")
+	ipProxies  = flag.Int("rate-limit-ip-trusted-proxies", 0, "number of trusted proxies that append to X-Forwarded-For, used to get client IP for --rate-limit-ip-qps. 0 uses peer address. 2 for Google Cloud HTTP(S) load balancer. requests with fewer X-Forwarded-For entries use peer address.")
+	groupQPS   = flag.Float64("rate-limit-group-qps", 0, "max requests per second per authenticated group. 0 means no limit.")
+	groupBurst = flag.Int("rate-limit-group-burst", 1000, "burst size of requests per authenticated group, used with --rate-limit-group-qps.")
+
+	noticeFile = flag.String("notice-file", "", `JSON file of notices for developers, e.g. planned maintenance. {"notices":[{"message":"...","severity":"warning","start":"<RFC3339>","end":"<RFC3339>"}]}. served on /notices and in X-Goma-Notice response header. reloaded when updated.`)
+
+	selftest = flag.Bool("selftest", false, "run self-test of dependencies (auth server connection), print the report and exit.")
 )
 
 const maxMsgSize = 64 * 1024 * 1024
@@ -102,6 +134,34 @@ func (mc memoryCheck) Admit(req *http.Request) error {
 	return status.Errorf(codes.Unavailable, "server unavailable")
 }
 
+// redisNonceCache is auth.NonceCache on redis, shared among frontends.
+type redisNonceCache struct {
+	c redis.Client
+}
+
+func (r redisNonceCache) Add(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return r.c.SetNX(ctx, "", key, ttl)
+}
+
+// newNonceCache returns nonce cache on redis if available.
+// It returns nil to use in-memory nonce cache otherwise.
+func newNonceCache(ctx context.Context) auth.NonceCache {
+	logger := log.FromContext(ctx)
+	addr, err := redis.AddrFromEnv()
+	if err != nil {
+		logger.Warnf("redis disabled for request nonce: %v", err)
+		return nil
+	}
+	logger.Infof("redis enabled for request nonce: %v", addr)
+	return redisNonceCache{
+		c: redis.NewClient(ctx, addr, redis.Opts{
+			Prefix:         "goma-nonce:",
+			MaxIdleConns:   redis.DefaultMaxIdleConns,
+			MaxActiveConns: redis.DefaultMaxActiveConns,
+		}),
+	}
+}
+
 func newMainServer(mux *http.ServeMux) server.Server {
 	hsMain := server.NewHTTP(*port, mux)
 	if *port != 443 {
@@ -122,10 +182,26 @@ func main() {
 	logger := log.FromContext(ctx)
 	defer logger.Sync()
 
+	if *logRedactConfig != "" {
+		r, err := redact.Load(*logRedactConfig)
+		if err != nil {
+			logger.Fatalf("log redact config: %v", err)
+		}
+		redact.SetDefault(r)
+	}
+
 	err := server.Init(ctx, *traceProjectID, "frontend")
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "frontend", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	err = view.Register(frontend.DefaultViews...)
 	if err != nil {
 		logger.Fatal(err)
@@ -135,7 +211,7 @@ func main() {
 		logger.Fatal(err)
 	}
 	trace.ApplyConfig(trace.Config{
-		DefaultSampler: server.NewLimitedSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
+		DefaultSampler: server.TraceSampler(server.DefaultTraceFraction, server.DefaultTraceQPS),
 	})
 
 	s, err := server.NewGRPC(*gport,
@@ -150,17 +226,57 @@ func main() {
 		logger.Fatalf("dial %s: %v", *authAddr, err)
 	}
 	defer authConn.Close()
+	server.AddStatuszCheck("auth-server", func(ctx context.Context) error {
+		return server.CheckConn(ctx, authConn)
+	})
+	if *selftest {
+		st := &server.SelfTest{Name: "frontend"}
+		st.Add("auth-server", func(ctx context.Context) error {
+			return server.CheckConn(ctx, authConn)
+		})
+		server.RunSelfTest(ctx, st)
+	}
+
+	for _, c := range []string{*fileCompressor, *execCompressor} {
+		err = server.CheckCompressor(c)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	var groupLimiter httprpc.RateLimiter
+	if *groupQPS > 0 {
+		logger.Infof("rate limit per group: qps=%g burst=%d", *groupQPS, *groupBurst)
+		groupLimiter = frontend.GroupRateLimiter(*groupQPS, *groupBurst)
+	}
 
 	beCfg := &bepb.BackendConfig{}
 	err = prototext.Unmarshal([]byte(*backendConfig), beCfg)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	fa := &auth.Auth{
+		Client:    authpb.NewAuthServiceClient(authConn),
+		ClockSkew: *authClockSkew,
+	}
+	if *credentialKeyFile != "" {
+		keys, err := auth.ReadCredentialKeys(*credentialKeyFile)
+		if err != nil {
+			logger.Fatalf("--credential-key-file: %v", err)
+		}
+		logger.Infof("request signature required for credentials: %d credential keys, window=%s", len(keys), *replayWindow)
+		fa.Credentials = &auth.Credentials{
+			Keys:         keys,
+			ReplayWindow: *replayWindow,
+		}
+		fa.Nonces = newNonceCache(ctx)
+	}
 	be, done, err := backend.FromProto(ctx, beCfg, backend.Option{
-		Auth: &auth.Auth{
-			Client: authpb.NewAuthServiceClient(authConn),
-		},
-		APIKeyDir: filepath.Join(*configDir, "api-keys"),
+		Auth:           fa,
+		APIKeyDir:      filepath.Join(*configDir, "api-keys"),
+		FileCompressor: *fileCompressor,
+		ExecCompressor: *execCompressor,
+		RateLimiter:    groupLimiter,
 	})
 	if err != nil {
 		logger.Fatal(err)
@@ -192,7 +308,27 @@ func main() {
 			// want to use this to compare between clusters,
 			// but not availble yet. http://b/77931512
 		},
+		BatchMaxCalls: *batchMaxCalls,
+	}
+	if *storeFileIdempotencyTTL > 0 {
+		fe.StoreFileIdempotency = &frontend.Idempotency{
+			TTL: *storeFileIdempotencyTTL,
+		}
+	}
+	if *ipQPS > 0 {
+		logger.Infof("rate limit per ip: qps=%g burst=%d trusted-proxies=%d", *ipQPS, *ipBurst, *ipProxies)
+		fe.IPRateLimiter = frontend.IPRateLimiter(*ipQPS, *ipBurst, *ipProxies)
+	}
+	if *noticeFile != "" {
+		notices := &frontend.Notices{}
+		err := notices.Watch(ctx, *noticeFile)
+		if err != nil {
+			logger.Fatalf("--notice-file: %v", err)
+		}
+		server.EnableFeature("notices")
+		fe.Notices = notices
 	}
+	fe.Enroll = authrpc.EnrollHandler(authpb.NewAuthServiceClient(authConn))
 	frontend.Register(mux, fe)
 
 	if be, ok := be.(backend.GRPC); ok {
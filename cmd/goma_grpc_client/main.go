@@ -31,6 +31,7 @@ import (
 	"go.chromium.org/goma/server/auth/enduser"
 	"go.chromium.org/goma/server/log"
 	gomapb "go.chromium.org/goma/server/proto/api"
+	cmdpb "go.chromium.org/goma/server/proto/command"
 	execpb "go.chromium.org/goma/server/proto/exec"
 	execlogpb "go.chromium.org/goma/server/proto/execlog"
 	filepb "go.chromium.org/goma/server/proto/file"
@@ -44,6 +45,8 @@ var (
 	enduserGroup  = flag.String("enduser_group", "", "enduser group")
 	enduserSAJSON = flag.String("enduser_service_account_json", "", "enduser service account json file")
 
+	authorization = flag.String("authorization", "", `authorization metadata, e.g. "Bearer <access token>" for command.InventoryService.`)
+
 	tlsVerify = flag.Bool("tls_verify", true, "verifies the server's certificate chain and hostname.")
 	insecure  = flag.Bool("insecure", false, "insecure connection, i.e. no TLS")
 	verbose   = flag.Bool("v", false, "verbose flag")
@@ -92,6 +95,42 @@ func protoDesc(ctx context.Context, conn *grpc.ClientConn, servMethod string) (d
 			},
 			req: &gomapb.SaveLogReq{},
 		}, nil
+
+	case "command.InventoryService.ListConfigs":
+		client := cmdpb.NewInventoryServiceClient(conn)
+		return desc{
+			method: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return client.ListConfigs(ctx, req.(*cmdpb.ListConfigsReq))
+			},
+			req: &cmdpb.ListConfigsReq{},
+		}, nil
+
+	case "command.InventoryService.AddConfig":
+		client := cmdpb.NewInventoryServiceClient(conn)
+		return desc{
+			method: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return client.AddConfig(ctx, req.(*cmdpb.AddConfigReq))
+			},
+			req: &cmdpb.AddConfigReq{},
+		}, nil
+
+	case "command.InventoryService.DisableConfig":
+		client := cmdpb.NewInventoryServiceClient(conn)
+		return desc{
+			method: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return client.DisableConfig(ctx, req.(*cmdpb.DisableConfigReq))
+			},
+			req: &cmdpb.DisableConfigReq{},
+		}, nil
+
+	case "command.InventoryService.DeleteConfig":
+		client := cmdpb.NewInventoryServiceClient(conn)
+		return desc{
+			method: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return client.DeleteConfig(ctx, req.(*cmdpb.DeleteConfigReq))
+			},
+			req: &cmdpb.DeleteConfigReq{},
+		}, nil
 	default:
 		return desc{}, fmt.Errorf("unknown service: %s", servMethod)
 	}
@@ -213,6 +252,9 @@ func main() {
 		logger.Infof("Using api_key: %s", *apiKey)
 		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("x-api-key", *apiKey))
 	}
+	if *authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", *authorization)
+	}
 	ctx = setEnduser(ctx)
 	md, _ := metadata.FromOutgoingContext(ctx)
 	logger.Debugf("outgoing metatada: %v", md)
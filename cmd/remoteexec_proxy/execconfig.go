@@ -0,0 +1,160 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/prototext"
+
+	"go.chromium.org/goma/server/fswatch"
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+	"go.chromium.org/goma/server/server"
+)
+
+func readConfigResp(fname string) (*cmdpb.ConfigResp, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigResp(b)
+}
+
+func parseConfigResp(b []byte) (*cmdpb.ConfigResp, error) {
+	resp := &cmdpb.ConfigResp{}
+	err := prototext.Unmarshal(b, resp)
+	if err != nil {
+		return nil, err
+	}
+	// fix target address etc.
+	for _, c := range resp.Configs {
+		if c.Target == nil {
+			c.Target = &cmdpb.Target{}
+		}
+		if c.Target.Addr == "" || !*remoteexecRouting {
+			c.Target.Addr = *remoteexecAddr
+		}
+		if c.BuildInfo == nil {
+			c.BuildInfo = &cmdpb.BuildInfo{}
+		}
+	}
+	return resp, nil
+}
+
+// configurer configures exec inventory, i.e. *exec.Inventory.
+type configurer interface {
+	Configure(context.Context, *cmdpb.ConfigResp) error
+}
+
+// execConfig configures exec inventory by config file, and
+// reconfigures it when the file is updated, so toolchain config
+// changes don't need restart that drops in-flight builds.
+type execConfig struct {
+	fname      string
+	configurer configurer
+
+	mu       sync.Mutex
+	hash     string
+	resp     *cmdpb.ConfigResp
+	loadTime time.Time
+	err      error
+}
+
+// load loads config file and configures inventory if it is updated.
+// If it fails, inventory keeps the current config.
+func (c *execConfig) load(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	b, err := ioutil.ReadFile(c.fname)
+	if err != nil {
+		return c.setErr(err)
+	}
+	h := sha256.Sum256(b)
+	hash := hex.EncodeToString(h[:])
+	c.mu.Lock()
+	updated := hash != c.hash
+	if !updated {
+		c.err = nil
+	}
+	c.mu.Unlock()
+	if !updated {
+		return nil
+	}
+	resp, err := parseConfigResp(b)
+	if err != nil {
+		return c.setErr(fmt.Errorf("%s: %v", c.fname, err))
+	}
+	if resp.VersionId == "" {
+		resp.VersionId = "sha256:" + hash[:12]
+	}
+	err = c.configurer.Configure(ctx, resp)
+	if err != nil {
+		return c.setErr(fmt.Errorf("%s: version=%s: %v", c.fname, resp.VersionId, err))
+	}
+	c.mu.Lock()
+	c.hash = hash
+	c.resp = resp
+	c.loadTime = time.Now()
+	c.err = nil
+	c.mu.Unlock()
+	logger.Infof("exec config %s: version=%s", c.fname, resp.VersionId)
+	server.RecordConfigChange(ctx, "exec-config", resp.VersionId)
+	return nil
+}
+
+func (c *execConfig) setErr(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	return err
+}
+
+// Watch reloads config file when it is updated until ctx is done.
+func (c *execConfig) Watch(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	watcher, err := fswatch.New(ctx, filepath.Dir(c.fname))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			ev, err := watcher.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Errorf("exec config watch %s: %v", c.fname, err)
+				}
+				return
+			}
+			logger.Debugf("exec config update: %v", ev)
+			err = c.load(ctx)
+			if err != nil {
+				logger.Errorf("exec config reload: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Check returns error of the last reload, for status page.
+func (c *execConfig) Check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Config returns active config and its load time.
+func (c *execConfig) Config() (*cmdpb.ConfigResp, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resp, c.loadTime
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+type fakeConfigurer struct {
+	configs []*cmdpb.ConfigResp
+	err     error
+}
+
+func (f *fakeConfigurer) Configure(ctx context.Context, resp *cmdpb.ConfigResp) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.configs = append(f.configs, resp)
+	return nil
+}
+
+const testExecConfig = `
+configs {
+  build_info {}
+  remoteexec_platform {
+    properties {
+      name: "container-image"
+      value: "docker://gcr.io/example/image@sha256:0123"
+    }
+  }
+}
+`
+
+func TestExecConfigLoad(t *testing.T) {
+	ctx := context.Background()
+	fname := filepath.Join(t.TempDir(), "exec-config.textproto")
+	writeConfig := func(s string) {
+		t.Helper()
+		err := ioutil.WriteFile(fname, []byte(s), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fc := &fakeConfigurer{}
+	c := &execConfig{
+		fname:      fname,
+		configurer: fc,
+	}
+
+	writeConfig(testExecConfig)
+	err := c.load(ctx)
+	if err != nil {
+		t.Fatalf("load()=%v; want nil", err)
+	}
+	if len(fc.configs) != 1 {
+		t.Fatalf("configure calls=%d; want 1", len(fc.configs))
+	}
+	v1 := fc.configs[0].VersionId
+	if !strings.HasPrefix(v1, "sha256:") {
+		t.Errorf("version=%q; want sha256:...", v1)
+	}
+	if resp, _ := c.Config(); resp != fc.configs[0] {
+		t.Errorf("Config()=%v; want %v", resp, fc.configs[0])
+	}
+
+	t.Logf("same content is not configured again")
+	writeConfig(testExecConfig)
+	err = c.load(ctx)
+	if err != nil {
+		t.Errorf("load()=%v; want nil", err)
+	}
+	if len(fc.configs) != 1 {
+		t.Errorf("configure calls=%d; want 1", len(fc.configs))
+	}
+
+	t.Logf("malformed config keeps the current config")
+	writeConfig("configs {")
+	err = c.load(ctx)
+	if err == nil {
+		t.Errorf("load()=nil; want error")
+	}
+	if err := c.Check(ctx); err == nil {
+		t.Errorf("Check()=nil; want error")
+	}
+	if resp, _ := c.Config(); resp.GetVersionId() != v1 || len(fc.configs) != 1 {
+		t.Errorf("Config()=%v with %d configure calls; want version %q with 1 call", resp, len(fc.configs), v1)
+	}
+
+	t.Logf("configure failure keeps the current config")
+	fc.err = errors.New("bad config")
+	writeConfig(`version_id: "v2"` + testExecConfig)
+	err = c.load(ctx)
+	if err == nil {
+		t.Errorf("load()=nil; want error")
+	}
+	if resp, _ := c.Config(); resp.GetVersionId() != v1 {
+		t.Errorf("Config().VersionId=%q; want %q", resp.GetVersionId(), v1)
+	}
+
+	t.Logf("retry after failure")
+	fc.err = nil
+	err = c.load(ctx)
+	if err != nil {
+		t.Errorf("load()=%v; want nil", err)
+	}
+	if err := c.Check(ctx); err != nil {
+		t.Errorf("Check()=%v; want nil", err)
+	}
+	if resp, _ := c.Config(); resp.GetVersionId() != "v2" || len(fc.configs) != 2 {
+		t.Errorf("Config()=%v with %d configure calls; want version v2 with 2 calls", resp, len(fc.configs))
+	}
+}
@@ -28,9 +28,11 @@ import (
 	"go.opencensus.io/plugin/ocgrpc"
 	"go.opencensus.io/trace"
 	"google.golang.org/api/option"
+	bpb "google.golang.org/genproto/googleapis/bytestream"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
-	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/grpc/status"
 
 	"go.chromium.org/goma/server/auth"
 	"go.chromium.org/goma/server/auth/account"
@@ -38,13 +40,18 @@ import (
 	"go.chromium.org/goma/server/cache"
 	"go.chromium.org/goma/server/cache/gcs"
 	"go.chromium.org/goma/server/cache/redis"
+	"go.chromium.org/goma/server/exec"
+	"go.chromium.org/goma/server/exec/localdocker"
+	"go.chromium.org/goma/server/execlog"
 	"go.chromium.org/goma/server/file"
 	"go.chromium.org/goma/server/frontend"
 	"go.chromium.org/goma/server/httprpc"
+	bytestreamrpc "go.chromium.org/goma/server/httprpc/bytestream"
 	execrpc "go.chromium.org/goma/server/httprpc/exec"
 	execlogrpc "go.chromium.org/goma/server/httprpc/execlog"
 	filerpc "go.chromium.org/goma/server/httprpc/file"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/log/redact"
 	"go.chromium.org/goma/server/profiler"
 	gomapb "go.chromium.org/goma/server/proto/api"
 	authpb "go.chromium.org/goma/server/proto/auth"
@@ -55,6 +62,7 @@ import (
 	filepb "go.chromium.org/goma/server/proto/file"
 	"go.chromium.org/goma/server/remoteexec"
 	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/remoteexec/provenance"
 	"go.chromium.org/goma/server/rpc"
 	"go.chromium.org/goma/server/server"
 )
@@ -62,29 +70,108 @@ import (
 var (
 	port = flag.Int("port", 8090, "listening port (goma api endpoints)")
 
-	remoteexecAddr           = flag.String("remoteexec-addr", "", "remoteexec API endpoint")
-	remoteInstanceName       = flag.String("remote-instance-name", "", "remote instance name")
-	allowedUsers             = flag.String("allowed-users", "", "comma separated list of allowed users. `*@domain` will match any user in domain. if empty, current user is allowed.")
-	serviceAccountJSON       = flag.String("service-account-json", "", "service account json, used to talk to RBE and cloud storage (if --file-cache-bucket is used)")
-	platformContainerImage   = flag.String("platform-container-image", "", "docker uri of platform container image")
-	insecureRemoteexec       = flag.Bool("insecure-remoteexec", false, "insecure grpc for remoteexec API")
-	insecureSkipVerify       = flag.Bool("insecure-skip-verify", false, "insecure skip verifying the server certificate")
-	additionalTLSCertificate = flag.String("additional-tls-certificate", "", "additional TLS root certificate for verifying the server certificate")
-	execMaxRetryCount        = flag.Int("exec-max-retry-count", 5, "max retry count for exec call. 0 is unlimited count, but bound to ctx timtout. Use small number for powerful clients to run local fallback quickly. Use large number for powerless clients to use remote more than local.")
-	execMissingInputLimit    = flag.Int("exec-missing-input-limit", 100, "max missing inputs per exec call response. 0 is unlimited, meaning the client will be told about all missing inputs.")
+	remoteexecAddr             = flag.String("remoteexec-addr", "", "remoteexec API endpoint")
+	remoteexecConnPoolSize     = flag.Int("remoteexec-conn-pool-size", 1, "number of connections to remoteexec API endpoint. calls are spread over connections in round-robin.")
+	remoteInstanceName         = flag.String("remote-instance-name", "", "remote instance name")
+	remoteInstanceGroups       = flag.String("remote-instance-groups", "", "comma separated list of group=basename to use remote instance basename in the same parent of remote-instance-name for the group, e.g. chrome-bot=ci_instance.")
+	remoteexecRouting          = flag.Bool("remoteexec-routing", false, "route exec requests to multiple remoteexec API endpoints given by targets in --exec-config-file in weighted random, with health checking and failover. --remoteexec-addr is used for targets without address, and for capabilities, bytestream and output backfill.")
+	remoteexecRoutingCheck     = flag.Duration("remoteexec-routing-health-check-interval", remoteexec.DefaultRouterHealthCheckInterval, "interval of health checks of remoteexec API endpoints for --remoteexec-routing.")
+	remoteexecRoutingStrategy  = flag.String("remoteexec-routing-strategy", "weighted", "strategy to pick remoteexec API endpoint for --remoteexec-routing. weighted: weighted random. sticky-build: route requests of the same build id (or cwd if no build id) to the same endpoint for better input cache hits of remote workers. sticky-cwd: route requests of the same cwd to the same endpoint.")
+	allowedUsers               = flag.String("allowed-users", "", "comma separated list of allowed users. `*@domain` will match any user in domain. if empty, current user is allowed.")
+	serviceAccountJSON         = flag.String("service-account-json", "", "service account json, used to talk to RBE and cloud storage (if --file-cache-bucket is used)")
+	platformContainerImage     = flag.String("platform-container-image", "", "docker uri of platform container image")
+	insecureRemoteexec         = flag.Bool("insecure-remoteexec", false, "insecure grpc for remoteexec API")
+	insecureSkipVerify         = flag.Bool("insecure-skip-verify", false, "insecure skip verifying the server certificate")
+	additionalTLSCertificate   = flag.String("additional-tls-certificate", "", "additional TLS root certificate for verifying the server certificate")
+	execMaxRetryCount          = flag.Int("exec-max-retry-count", 5, "max retry count for exec call. 0 is unlimited count, but bound to ctx timtout. Use small number for powerful clients to run local fallback quickly. Use large number for powerless clients to use remote more than local.")
+	execRetryPolicy            = flag.String("exec-retry-policy", "", `text proto of rpc.RetryPolicy for calls to remoteexec API, e.g. "max_attempts: 5 initial_backoff_msec: 100". overrides --exec-max-retry-count if set.`)
+	executeHedgeDelay          = flag.Duration("execute-hedge-delay", 0, "delay to issue hedged Execute if the first Execute doesn't finish, to mitigate long-tail latency of RBE. 0 disables.")
+	cacheHedgeDelay            = flag.Duration("cache-hedge-delay", 0, "delay to issue hedged GetActionResult if the first GetActionResult doesn't finish. 0 disables.")
+	circuitBreakerErrorRate    = flag.Float64("circuit-breaker-error-rate", 0, "error rate of backend calls to stop calling the backend for a while and fail fast. 0 disables circuit breaker.")
+	circuitBreakerOpenDuration = flag.Duration("circuit-breaker-open-duration", rpc.DefaultBreakerOpenDuration, "duration to fail fast after circuit breaker opens, before probing the backend again.")
+	execMissingInputLimit      = flag.Int("exec-missing-input-limit", 100, "max missing inputs per exec call response. 0 is unlimited, meaning the client will be told about all missing inputs.")
+	digestFunction             = flag.String("digest-function", "SHA256", "preferred digest function for RBE CAS. used if RBE backend supports it, otherwise SHA256 or other supported one.")
+	pchMaxSize                 = flag.Int64("pch-max-size", 0, "max size of clang PCH/module output (*.pch, *.gch, *.pcm). larger outputs are rejected and clients will run the compile locally. 0 means no limit.")
+	rejectPCH                  = flag.Bool("reject-pch", false, "reject all clang PCH/module outputs.")
+	executionPriority          = flag.Int("execution-priority", 0, "priority of remote execution, used if RBE backend supports it. 0 means default priority.")
+	cachePriority              = flag.Int("cache-priority", 0, "priority of action cache entries, used if RBE backend supports it. 0 means default priority.")
+	disableCompressedBlobs     = flag.Bool("disable-compressed-blobs", false, "disable zstd compressed bytestream transfers even if RBE backend supports it.")
+	normalizeInputRoot         = flag.Bool("normalize-input-root", false, "map client's input root dir to canonical dir in non relocatable requests, to share action cache among different checkouts.")
+
+	authzPolicyURL        = flag.String("authz-policy-url", "", "URL of OPA data API to authorize exec requests, e.g. http://localhost:8181/v1/data/goma/exec. empty means no authorization policy other than ACL.")
+	authzPolicyFailClosed = flag.Bool("authz-policy-fail-closed", true, "reject exec requests if authorization policy fails to evaluate. false allows them.")
+	authzPolicyCacheTTL   = flag.Duration("authz-policy-cache-ttl", exec.DefaultPolicyCacheTTL, "duration to cache decisions of authorization policy per group and command. 0 disables the cache.")
+
+	rbeProbeInterval = flag.Duration("rbe-probe-interval", 0, "interval to probe RBE instances with CAS round trip and no-op action in --platform-container-image, to export latency and availability metrics independent of user traffic. 0 disables.")
+
+	selftest = flag.Bool("selftest", false, "run self-test of dependencies (acl load, service account tokens, cache put/get, RBE capabilities, exec config load), print the report and exit.")
 
 	fileCacheBucket = flag.String("file-cache-bucket", "", "file cache bucking store bucket")
 
-	execConfigFile = flag.String("exec-config-file", "", "exec inventory config file")
+	execConfigFile = flag.String("exec-config-file", "", "exec inventory config file. reloaded when updated.")
+
+	execTimeoutConfig     = flag.String("exec-timeout-config", "", "JSON file of timeout policy to override exec action timeout and --exec-*-timeout per group or command class (compile, link, etc).")
+	execInputLimitConfig  = flag.String("exec-input-limit-config", "", "JSON file of input limit policy to reject requests with too many inputs or too large inputs per group.")
+	execPriorityConfig    = flag.String("exec-priority-config", "", "JSON file of priority policy to map priority hint of requests (INTERACTIVE, BATCH) to RBE execution and cache priority per group. overrides --execution-priority and --cache-priority.")
+	execMinDeadlineBudget = flag.Duration("exec-min-deadline-budget", remoteexec.DefaultMinDeadlineBudget, "minimum remaining time of the client's timeout to start exec request. exec requests with less remaining time are rejected with DeadlineExceeded.")
+	execMaxConcurrent     = flag.Int("exec-max-concurrent", 0, "max number of concurrent exec requests in total. requests exceeding the limit wait in weighted fair queue per group. 0 means no limit.")
+	execGroupQuotaACL     = flag.String("exec-group-quota-acl", "", "ACL file in text proto to configure max_concurrent_execs and exec_weight per group. reloaded when updated.")
+
+	provenanceSigningKey = flag.String("provenance-signing-key", "", "PEM file of PKCS #8 private key (ed25519, ecdsa or rsa) to sign SLSA provenance attestations of remote outputs. empty disables attestation.")
+	provenanceKeyID      = flag.String("provenance-key-id", "", "key id put in signatures of provenance attestations.")
+	provenanceBuilderID  = flag.String("provenance-builder-id", "", "builder id in provenance attestations, e.g. URI of this server.")
+	provenanceBucket     = flag.String("provenance-bucket", "", "cloud storage bucket to store provenance attestations of remote outputs, keyed by output hash. empty stores them in the file cache.")
 
 	maxDigestCacheEntries = flag.Int("max-digest-cache-entries", 2e6, "maximum entries in in-memory digest cache")
+	fileMetaCacheEntries  = flag.Int("file-meta-cache-entries", 0, "maximum entries in cache of digests by file metadata hints (filename, mtime, size) from clients. 0 disables.")
+	digestCacheSnapshot   = flag.String("digest-cache-snapshot", "", "file to save in-memory digest cache on shutdown, and to restore it on start. empty disables snapshot.")
+	digestCacheMissingTTL = flag.Duration("digest-cache-missing-ttl", 0, "TTL to remember blobs missing in CAS, to skip checking them again in concurrent requests. 0 disables.")
+
+	missingContinuationEntries = flag.Int("missing-continuation-entries", 0, "maximum entries of requests failed with missing inputs, to skip checking blobs already verified in CAS when the requests are retried. 0 disables.")
+	missingContinuationTTL     = flag.Duration("missing-continuation-ttl", remoteexec.DefaultMissingContinuationTTL, "TTL of blobs verified in CAS for requests failed with missing inputs.")
+
+	requestLogSize               = flag.Int("request-log-size", remoteexec.DefaultRequestLogSize, "maximum number of request records for /debug/requests. 0 disables.")
+	requestLogRetention          = flag.Duration("request-log-retention", remoteexec.DefaultRequestLogRetention, "retention of request records for /debug/requests.")
+	requestLogSuccessSampleRatio = flag.Float64("request-log-success-sample-ratio", 0, "ratio to record succeeded requests for /debug/requests. failed requests are always recorded.")
 
 	traceProjectID = flag.String("trace-project-id", "", "project id for cloud tracing")
+	metricsFormat  = flag.String("metrics-format", "", `format to export metrics in addition to stackdriver. "prometheus" serves metrics on /metrics of monitoring port.`)
+	otlpEndpoint   = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), `OTLP/HTTP endpoint to export traces and metrics, e.g. "http://otel-collector:4318". empty disables.`)
+	otlpHeaders    = flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "comma separated key=value pairs of http headers sent to --otlp-endpoint.")
 	traceFraction  = flag.Float64("trace-sampling-fraction", 1.0, "sampling fraction for stackdriver trace")
 	traceQPS       = flag.Float64("trace-sampling-qps-limit", 1.0, "sampling qps limit for stackdriver trace")
 
 	redisMaxIdleConns   = flag.Int("redis-max-idle-conns", redis.DefaultMaxIdleConns, "maximum number of idle connections to redis.")
 	redisMaxActiveConns = flag.Int("redis-max-active-conns", redis.DefaultMaxActiveConns, "maximum number of active connections to redis.")
+	redisCommandTimeout = flag.Duration("redis-command-timeout", 0, "timeout of each redis command. 0 means no timeout other than request deadline.")
+
+	backfillOutputMinSize = flag.Int64("backfill-output-min-size", -1, "outputs larger than or equal to this size are fetched from CAS when clients look them up, instead of in exec response. negative disables backfill.")
+
+	execlogBigqueryTable  = flag.String("execlog-bigquery-table", "", `BigQuery table to store compile stats sent by clients, as "<project>.<dataset>.<table>". compile stats are discarded if no --execlog-* sink is set.`)
+	execlogJSONLFile      = flag.String("execlog-jsonl-file", "", "local file to append compile stats sent by clients in JSON lines format.")
+	execlogPubsubTopics   = flag.String("execlog-pubsub-topics", "", `comma separated Pub/Sub topics "projects/<project>/topics/<topic>" to publish compile stats sent by clients. each topic may have batching options, e.g. "<topic>?batch_size=100&flush_interval=1s&queue_size=10000".`)
+	execlogKafkaRESTProxy = flag.String("execlog-kafka-rest-proxy", "", `Kafka REST Proxy URL to produce compile stats to --execlog-kafka-topics, e.g. "http://kafka-rest:8082".`)
+	execlogKafkaTopics    = flag.String("execlog-kafka-topics", "", "comma separated Kafka topics to produce compile stats sent by clients. each topic may have batching options as --execlog-pubsub-topics.")
+
+	journalDir      = flag.String("journal-dir", "", "directory to record in-flight exec requests for crash recovery. empty disables journal.")
+	journalReattach = flag.Bool("journal-reattach", false, "wait for RBE operations of in-flight requests lost by previous crash.")
+
+	localFallbackSandbox     = flag.String("local-fallback-sandbox", "", `sandbox to execute actions on proxy host when RBE is unreachable or retries are exhausted: "docker" or "nsjail". empty disables local fallback.`)
+	localFallbackConcurrency = flag.Int("local-fallback-concurrency", 2, "max number of actions executed on proxy host concurrently by local fallback.")
+	localFallbackDir         = flag.String("local-fallback-dir", "", "directory for working directories of local fallback. empty uses temporary directory.")
+	localFallbackRODirs      = flag.String("local-fallback-readonly-dirs", strings.Join(remoteexec.DefaultLocalReadOnlyDirs, ","), "comma separated host directories visible (read-only) in nsjail sandbox of local fallback, e.g. system libraries and toolchains.")
+
+	localDocker            = flag.Bool("local-docker", false, "run commands in --platform-container-image (or container-image platform property in exec config) on local docker daemon instead of RBE. only linux clients are supported.")
+	localDockerConcurrency = flag.Int("local-docker-concurrency", 4, "max number of commands run on local docker daemon concurrently.")
+	localDockerDir         = flag.String("local-docker-dir", "", "directory for input roots mounted in local docker containers. empty uses temporary directory.")
+
+	logRedactConfig = flag.String("log-redact-config", "", "JSON file of patterns to redact sensitive data (e.g. secrets in command lines) in logs and execlog, in addition to default patterns. see go.chromium.org/goma/server/log/redact.")
+
+	rpcPolicyConfig = flag.String("rpc-policy-config", "", "text proto file of rpc.PolicyConfig to configure timeout, retry and hedging of calls per target service (auth, authdb, cache, file, remoteexec). overrides per-service flags, e.g. --exec-retry-policy and --execute-hedge-delay.")
+
+	cacheNamespace = flag.String("cache-namespace", "", "namespace of cache keys, e.g. remote instance name or tenant. keys are partitioned per namespace in shared cache backend.")
+
+	storeFileIdempotencyTTL = flag.Duration("store-file-idempotency-ttl", frontend.DefaultIdempotencyTTL, "duration to keep StoreFile responses for client retries with the same idempotency key. 0 disables.")
 )
 
 func myEmail(ctx context.Context) string {
@@ -112,6 +199,10 @@ func (c authClient) Auth(ctx context.Context, req *authpb.AuthReq, opts ...grpc.
 	return c.Service.Auth(ctx, req)
 }
 
+func (c authClient) Enroll(ctx context.Context, req *authpb.EnrollReq, opts ...grpc.CallOption) (*authpb.EnrollResp, error) {
+	return c.Service.Enroll(ctx, req)
+}
+
 type fileClient struct {
 	Service filepb.FileServiceServer
 }
@@ -124,6 +215,14 @@ func (c fileClient) LookupFile(ctx context.Context, req *gomapb.LookupFileReq, o
 	return c.Service.LookupFile(ctx, req)
 }
 
+func (c fileClient) StoreFileStream(ctx context.Context, opts ...grpc.CallOption) (filepb.FileService_StoreFileStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "StoreFileStream is not supported")
+}
+
+func (c fileClient) LookupFileStream(ctx context.Context, req *gomapb.LookupFileReq, opts ...grpc.CallOption) (filepb.FileService_LookupFileStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "LookupFileStream is not supported")
+}
+
 type execlogService struct {
 	execlogpb.UnimplementedLogServiceServer
 }
@@ -144,6 +243,10 @@ func (c cacheClient) Put(ctx context.Context, req *cachepb.PutReq, opts ...grpc.
 	return c.Service.Put(ctx, req)
 }
 
+func (c cacheClient) Exists(ctx context.Context, req *cachepb.ExistsReq, opts ...grpc.CallOption) (*cachepb.ExistsResp, error) {
+	return c.Service.Exists(ctx, req)
+}
+
 const gomaClientClientID = "687418631491-r6m1c3pr0lth5atp4ie07f03ae8omefc.apps.googleusercontent.com"
 
 type defaultACL struct {
@@ -170,6 +273,26 @@ func (a defaultACL) Load(ctx context.Context) (*authpb.ACL, error) {
 	}, nil
 }
 
+// proberPlatform returns platform of RBE probe action in containerImage.
+func proberPlatform(containerImage string) *rpb.Platform {
+	platform := &rpb.Platform{
+		Properties: []*rpb.Platform_Property{
+			{
+				Name:  "OSFamily",
+				Value: "Linux",
+			},
+		},
+	}
+	if containerImage != "" {
+		// properties must be sorted by name.
+		platform.Properties = append(platform.Properties, &rpb.Platform_Property{
+			Name:  "container-image",
+			Value: containerImage,
+		})
+	}
+	return platform
+}
+
 type reExecServer struct {
 	execpb.UnimplementedExecServiceServer
 	re *remoteexec.Adapter
@@ -182,6 +305,52 @@ func (r reExecServer) Exec(ctx context.Context, req *gomapb.ExecReq) (*gomapb.Ex
 	return r.re.Exec(ctx, req)
 }
 
+func (r reExecServer) ExecExt(ctx context.Context, req *execpb.ExecExtReq) (*execpb.ExecExtResp, error) {
+	ctx, id := rpc.TagID(ctx, req.GetReq().GetRequesterInfo())
+	logger := log.FromContext(ctx)
+	logger.Infof("call exec ext %s", id)
+	return r.re.ExecExt(ctx, req)
+}
+
+func (r reExecServer) ExecStream(req *execpb.ExecExtReq, stream execpb.ExecService_ExecStreamServer) error {
+	ctx, id := rpc.TagID(stream.Context(), req.GetReq().GetRequesterInfo())
+	logger := log.FromContext(ctx)
+	logger.Infof("call exec stream %s", id)
+	return r.re.ExecStream(req, execStream{ExecService_ExecStreamServer: stream, ctx: ctx})
+}
+
+// execStream is ExecService_ExecStreamServer with tagged context.
+type execStream struct {
+	execpb.ExecService_ExecStreamServer
+	ctx context.Context
+}
+
+func (s execStream) Context() context.Context { return s.ctx }
+
+type dockerExecServer struct {
+	execpb.UnimplementedExecServiceServer
+	s *localdocker.Server
+}
+
+func (d dockerExecServer) Exec(ctx context.Context, req *gomapb.ExecReq) (*gomapb.ExecResp, error) {
+	ctx, id := rpc.TagID(ctx, req.GetRequesterInfo())
+	logger := log.FromContext(ctx)
+	logger.Infof("call exec %s (local docker)", id)
+	return d.s.Exec(ctx, req)
+}
+
+// ExecExt ignores extensions, e.g. file metadata hints, which are not
+// supported by local docker.
+func (d dockerExecServer) ExecExt(ctx context.Context, req *execpb.ExecExtReq) (*execpb.ExecExtResp, error) {
+	resp, err := d.Exec(ctx, req.GetReq())
+	if err != nil {
+		return nil, err
+	}
+	return &execpb.ExecExtResp{
+		Resp: resp,
+	}, nil
+}
+
 type reFileServer struct {
 	filepb.UnimplementedFileServiceServer
 	s filepb.FileServiceServer
@@ -201,10 +370,29 @@ func (r reFileServer) LookupFile(ctx context.Context, req *gomapb.LookupFileReq)
 	return r.s.LookupFile(ctx, req)
 }
 
+func (r reFileServer) StoreFileStream(stream filepb.FileService_StoreFileStreamServer) error {
+	logger := log.FromContext(stream.Context())
+	logger.Infof("call storefilestream")
+	return r.s.StoreFileStream(stream)
+}
+
+func (r reFileServer) LookupFileStream(req *gomapb.LookupFileReq, stream filepb.FileService_LookupFileStreamServer) error {
+	logger := log.FromContext(stream.Context())
+	logger.Infof("call lookupfilestream")
+	return r.s.LookupFileStream(req, stream)
+}
+
 type localBackend struct {
 	ExecService execpb.ExecServiceServer
 	FileService filepb.FileServiceServer
 	Auth        httprpc.Auth
+
+	// ExeclogService handles execlog. execlog is discarded if nil.
+	ExeclogService execlogpb.LogServiceServer
+
+	// ByteStreamClient is bytestream client of RBE CAS in Instance.
+	ByteStreamClient bpb.ByteStreamClient
+	Instance         string
 }
 
 func (b localBackend) Ping() http.Handler {
@@ -226,8 +414,19 @@ func (b localBackend) Exec() http.Handler {
 	return execrpc.Handler(b.ExecService, httprpc.Timeout(5*time.Minute), httprpc.WithAuth(b.Auth))
 }
 
+func (b localBackend) ExecExt() http.Handler {
+	return execrpc.ExtHandler(b.ExecService, httprpc.Timeout(5*time.Minute), httprpc.WithAuth(b.Auth))
+}
+
+func (b localBackend) ExecStream() http.Handler {
+	return execrpc.StreamHandler(b.ExecService, httprpc.Timeout(5*time.Minute), httprpc.WithAuth(b.Auth))
+}
+
 func (b localBackend) ByteStream() http.Handler {
-	return http.HandlerFunc(http.NotFound)
+	if b.ByteStreamClient == nil {
+		return http.HandlerFunc(http.NotFound)
+	}
+	return bytestreamrpc.InstanceHandler(b.ByteStreamClient, b.Instance, httprpc.Timeout(1*time.Minute), httprpc.WithAuth(b.Auth))
 }
 
 func (b localBackend) StoreFile() http.Handler {
@@ -239,30 +438,199 @@ func (b localBackend) LookupFile() http.Handler {
 }
 
 func (b localBackend) Execlog() http.Handler {
-	return execlogrpc.Handler(execlogService{}, httprpc.Timeout(1*time.Minute), httprpc.WithAuth(b.Auth))
+	var s execlogpb.LogServiceServer = execlogService{}
+	if b.ExeclogService != nil {
+		s = b.ExeclogService
+	}
+	return execlogrpc.Handler(s, httprpc.Timeout(1*time.Minute), httprpc.WithAuth(b.Auth))
 }
 
-func readConfigResp(fname string) (*cmdpb.ConfigResp, error) {
-	b, err := ioutil.ReadFile(fname)
-	if err != nil {
-		return nil, err
+// newFileMetaCache creates file metadata cache if enabled.
+func newFileMetaCache() *remoteexec.FileMetaCache {
+	if *fileMetaCacheEntries <= 0 {
+		return nil
+	}
+	server.EnableFeature("file-meta-cache")
+	return remoteexec.NewFileMetaCache(*fileMetaCacheEntries)
+}
+
+// newMissingContinuation creates missing continuation if enabled.
+func newMissingContinuation() *remoteexec.MissingContinuation {
+	if *missingContinuationEntries <= 0 {
+		return nil
+	}
+	server.EnableFeature("missing-continuation")
+	return remoteexec.NewMissingContinuation(*missingContinuationEntries, *missingContinuationTTL)
+}
+
+// newScheduler creates scheduler of exec requests if enabled.
+func newScheduler(ctx context.Context) *remoteexec.Scheduler {
+	if *execMaxConcurrent <= 0 && *execGroupQuotaACL == "" {
+		return nil
 	}
-	resp := &cmdpb.ConfigResp{}
-	err = prototext.Unmarshal(b, resp)
+	logger := log.FromContext(ctx)
+	s := &remoteexec.Scheduler{
+		MaxConcurrent: *execMaxConcurrent,
+	}
+	if *execGroupQuotaACL != "" {
+		err := s.Watch(ctx, *execGroupQuotaACL)
+		if err != nil {
+			logger.Fatalf("--exec-group-quota-acl: %v", err)
+		}
+	}
+	server.EnableFeature("exec-scheduler")
+	return s
+}
+
+// newAttestor creates provenance attestor if enabled.
+// Attestations are stored in c unless --provenance-bucket is given.
+func newAttestor(ctx context.Context, c cachepb.CacheServiceClient) *remoteexec.Attestor {
+	if *provenanceSigningKey == "" {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	signer, err := provenance.LoadSigner(*provenanceSigningKey, *provenanceKeyID)
 	if err != nil {
-		return nil, err
+		logger.Fatalf("--provenance-signing-key: %v", err)
 	}
-	// fix target address etc.
-	for _, c := range resp.Configs {
-		if c.Target == nil {
-			c.Target = &cmdpb.Target{}
+	if *provenanceBucket != "" {
+		var opts []option.ClientOption
+		if *serviceAccountJSON != "" {
+			opts = append(opts, option.WithServiceAccountFile(*serviceAccountJSON))
 		}
-		c.Target.Addr = *remoteexecAddr
-		if c.BuildInfo == nil {
-			c.BuildInfo = &cmdpb.BuildInfo{}
+		gsclient, err := storage.NewClient(ctx, opts...)
+		if err != nil {
+			logger.Fatalf("storage client failed: %v", err)
 		}
+		c = cache.NamespaceClient{
+			CacheServiceClient: cache.LocalClient{
+				CacheServiceServer: gcs.New(gsclient.Bucket(*provenanceBucket)),
+			},
+			Namespace: *cacheNamespace,
+		}
+	}
+	logger.Infof("provenance attestation: builder=%q key=%q bucket=%q", *provenanceBuilderID, *provenanceKeyID, *provenanceBucket)
+	server.EnableFeature("provenance")
+	return &remoteexec.Attestor{
+		Cache:     c,
+		Signer:    signer,
+		BuilderID: *provenanceBuilderID,
+	}
+}
+
+// newRouter creates router to multiple remoteexec API endpoints if enabled.
+func newRouter(ctx context.Context, breaker *rpc.CircuitBreaker, opts ...grpc.DialOption) *remoteexec.Router {
+	if !*remoteexecRouting {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	strategy, err := remoteexec.ParseRouteStrategy(*remoteexecRoutingStrategy)
+	if err != nil {
+		logger.Fatalf("--remoteexec-routing-strategy: %v", err)
+	}
+	logger.Infof("remoteexec routing: strategy=%s health check interval=%s", *remoteexecRoutingStrategy, *remoteexecRoutingCheck)
+	server.EnableFeature("remoteexec-routing")
+	return &remoteexec.Router{
+		Dial: func(ctx context.Context, target *cmdpb.Target) (remoteexec.Client, error) {
+			pool, err := remoteexec.DialPool(ctx, target.Addr, *remoteexecConnPoolSize, opts...)
+			if err != nil {
+				return remoteexec.Client{}, err
+			}
+			retry := newExecRetry(ctx, breaker)
+			retry.Target = target.Addr
+			return remoteexec.Client{
+				Pool:         pool,
+				Retry:        retry,
+				ExecuteHedge: newExecuteHedge(),
+				CacheHedge: rpc.Hedge{
+					Delay: *cacheHedgeDelay,
+				},
+			}, nil
+		},
+		Strategy:            strategy,
+		HealthCheckInterval: *remoteexecRoutingCheck,
+	}
+}
+
+// newCircuitBreaker creates circuit breaker for backend calls if enabled.
+func newCircuitBreaker() *rpc.CircuitBreaker {
+	if *circuitBreakerErrorRate <= 0 {
+		return nil
+	}
+	server.EnableFeature("circuit-breaker")
+	return &rpc.CircuitBreaker{
+		ErrorRate:    *circuitBreakerErrorRate,
+		OpenDuration: *circuitBreakerOpenDuration,
 	}
-	return resp, nil
+}
+
+// newExecRetry creates retry policy for calls to remoteexec API.
+func newExecRetry(ctx context.Context, breaker *rpc.CircuitBreaker) rpc.Retry {
+	retry := rpc.Retry{
+		MaxRetry: *execMaxRetryCount,
+	}
+	if *execRetryPolicy != "" {
+		var err error
+		retry, err = rpc.ParseRetryPolicy(*execRetryPolicy)
+		if err != nil {
+			logger := log.FromContext(ctx)
+			logger.Fatalf("--exec-retry-policy: %v", err)
+		}
+	}
+	retry = rpc.PolicyFor(rpc.ServiceRemoteexec).RetryOr(retry)
+	retry.Breaker = breaker
+	retry.Target = *remoteexecAddr
+	return retry
+}
+
+// newExecuteHedge creates hedge policy for Execute calls to remoteexec API.
+// hedge policy in --rpc-policy-config overrides --execute-hedge-delay.
+func newExecuteHedge() rpc.Hedge {
+	if h := rpc.PolicyFor(rpc.ServiceRemoteexec).Hedge; h.Delay > 0 {
+		return h
+	}
+	return rpc.Hedge{
+		Delay: *executeHedgeDelay,
+	}
+}
+
+// newRequestLog creates request log if enabled.
+func newRequestLog() *remoteexec.RequestLog {
+	if *requestLogSize <= 0 {
+		return nil
+	}
+	server.EnableFeature("request-log")
+	return &remoteexec.RequestLog{
+		Size:               *requestLogSize,
+		Retention:          *requestLogRetention,
+		SuccessSampleRatio: *requestLogSuccessSampleRatio,
+	}
+}
+
+// snapshotDigestCache restores dc from *digestCacheSnapshot, and
+// saves dc in it on shutdown.
+func snapshotDigestCache(ctx context.Context, dc *digest.Cache) {
+	if *digestCacheSnapshot == "" {
+		return
+	}
+	logger := log.FromContext(ctx)
+	t := time.Now()
+	n, err := dc.LoadFile(*digestCacheSnapshot)
+	if err != nil {
+		logger.Warnf("digest cache snapshot load %s: %v", *digestCacheSnapshot, err)
+	} else {
+		logger.Infof("digest cache snapshot load %s: %d entries in %s", *digestCacheSnapshot, n, time.Since(t))
+	}
+	server.OnShutdown(func(ctx context.Context) {
+		logger := log.FromContext(ctx)
+		t := time.Now()
+		n, err := dc.SaveFile(*digestCacheSnapshot)
+		if err != nil {
+			logger.Errorf("digest cache snapshot save %s: %v", *digestCacheSnapshot, err)
+			return
+		}
+		logger.Infof("digest cache snapshot save %s: %d entries in %s", *digestCacheSnapshot, n, time.Since(t))
+	})
 }
 
 func main() {
@@ -284,6 +652,23 @@ func main() {
 	logger := log.FromContext(ctx)
 	defer logger.Sync()
 
+	if *logRedactConfig != "" {
+		r, err := redact.Load(*logRedactConfig)
+		if err != nil {
+			logger.Fatalf("log redact config: %v", err)
+		}
+		redact.SetDefault(r)
+	}
+
+	if *rpcPolicyConfig != "" {
+		p, err := rpc.LoadPolicies(*rpcPolicyConfig)
+		if err != nil {
+			logger.Fatalf("--rpc-policy-config: %v", err)
+		}
+		rpc.SetPolicies(p)
+		server.EnableFeature("rpc-policy-config")
+	}
+
 	if *allowedUsers == "" {
 		*allowedUsers = myEmail(ctx)
 	}
@@ -303,6 +688,14 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	err = server.ExportMetrics(ctx, *metricsFormat)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = server.ExportOTLP(ctx, "remoteexec-proxy", *otlpEndpoint, *otlpHeaders)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	trace.ApplyConfig(trace.Config{
 		DefaultSampler: server.NewLimitedSampler(*traceFraction, *traceQPS),
@@ -364,11 +757,19 @@ func main() {
 			Service: cacheService,
 		}
 	}
+	if *cacheNamespace != "" {
+		logger.Infof("cache namespace: %s", *cacheNamespace)
+		cclient = cache.NamespaceClient{
+			CacheServiceClient: cclient,
+			Namespace:          *cacheNamespace,
+		}
+	}
 
+	fileService := &file.Service{
+		Cache: cclient,
+	}
 	fileServiceClient := fileClient{
-		Service: &file.Service{
-			Cache: cclient,
-		},
+		Service: fileService,
 	}
 
 	certPool, err := x509.SystemCertPool()
@@ -400,39 +801,61 @@ func main() {
 		logger.Warnf("use insecrure remoteexec API")
 	}
 
-	reConn, err := grpc.DialContext(ctx, *remoteexecAddr, opts...)
+	breaker := newCircuitBreaker()
+	rePool, err := remoteexec.DialPool(ctx, *remoteexecAddr, *remoteexecConnPoolSize, opts...)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	defer reConn.Close()
+	defer rePool.Close()
 
-	var digestCache remoteexec.DigestCache
+	var digestCache *digest.Cache
 	redisAddr, err := redis.AddrFromEnv()
 	if err != nil {
 		logger.Warnf("redis disabled for gomafile-digest: %v", err)
 		digestCache = digest.NewCache(nil, *maxDigestCacheEntries)
 	} else {
 		logger.Infof("redis enabled for gomafile-digest: %v idle=%d active=%d", redisAddr, *redisMaxIdleConns, *redisMaxActiveConns)
-		digestCache = digest.NewCache(redis.NewClient(ctx, redisAddr, redis.Opts{
-			Prefix:         "gomafile-digest:",
-			MaxIdleConns:   *redisMaxIdleConns,
-			MaxActiveConns: *redisMaxActiveConns,
-		}), *maxDigestCacheEntries)
+		digestCache = digest.NewCache(cache.NamespaceClient{
+			CacheServiceClient: redis.NewClient(ctx, redisAddr, redis.Opts{
+				Prefix:         "gomafile-digest:",
+				MaxIdleConns:   *redisMaxIdleConns,
+				MaxActiveConns: *redisMaxActiveConns,
+				CommandTimeout: *redisCommandTimeout,
+			}),
+			Namespace: *cacheNamespace,
+		}, *maxDigestCacheEntries)
 	}
+	digestCache.MissingTTL = *digestCacheMissingTTL
+	http.Handle("/debug/digestcache", digestCache)
+	snapshotDigestCache(ctx, digestCache)
 
+	df, err := digest.ParseFunction(*digestFunction)
+	if err != nil {
+		logger.Fatalf("--digest-function: %v", err)
+	}
+	groupInstances, err := remoteexec.ParseGroupInstances(*remoteInstanceGroups)
+	if err != nil {
+		logger.Fatalf("--remote-instance-groups: %v", err)
+	}
 	re := &remoteexec.Adapter{
-		InstancePrefix: path.Dir(*remoteInstanceName),
-		ExecTimeout:    15 * time.Minute,
-		SpanTimeout:    spanTimeout,
+		InstancePrefix:   path.Dir(*remoteInstanceName),
+		InstanceBaseName: path.Base(*remoteInstanceName),
+		GroupInstances:   groupInstances,
+		ExecTimeout:      15 * time.Minute,
+		SpanTimeout:      spanTimeout,
 		Client: remoteexec.Client{
-			ClientConn: reConn,
-			Retry: rpc.Retry{
-				MaxRetry: *execMaxRetryCount,
+			Pool:         rePool,
+			Retry:        newExecRetry(ctx, breaker),
+			ExecuteHedge: newExecuteHedge(),
+			CacheHedge: rpc.Hedge{
+				Delay: *cacheHedgeDelay,
 			},
 		},
-		InsecureClient: *insecureRemoteexec,
-		GomaFile:       fileServiceClient,
-		DigestCache:    digestCache,
+		InsecureClient:      *insecureRemoteexec,
+		GomaFile:            fileServiceClient,
+		DigestCache:         digestCache,
+		FileMetaCache:       newFileMetaCache(),
+		MissingContinuation: newMissingContinuation(),
 		ToolDetails: &rpb.ToolDetails{
 			ToolName:    "remoteexec_proxy",
 			ToolVersion: "0.0.0-experimental",
@@ -440,6 +863,141 @@ func main() {
 		FileLookupSema:    make(chan struct{}, 2),
 		CASBlobLookupSema: make(chan struct{}, 20),
 		MissingInputLimit: *execMissingInputLimit,
+		DigestFunction:    df,
+		PCHPolicy: remoteexec.PCHPolicy{
+			MaxSize: *pchMaxSize,
+			Reject:  *rejectPCH,
+		},
+		ExecutionPriority:      int32(*executionPriority),
+		CachePriority:          int32(*cachePriority),
+		DisableCompressedBlobs: *disableCompressedBlobs,
+		NormalizeInputRoot:     *normalizeInputRoot,
+		Operations:             &remoteexec.Operations{},
+		RequestLog:             newRequestLog(),
+	}
+	if newExecuteHedge().Delay > 0 {
+		server.EnableFeature("execute-hedge")
+	}
+	if *cacheHedgeDelay > 0 {
+		server.EnableFeature("cache-hedge")
+	}
+	http.Handle("/debug/operations", re.Operations)
+	http.Handle("/debug/requests", re.RequestLog)
+	if *backfillOutputMinSize >= 0 {
+		logger.Infof("backfill outputs >= %d bytes", *backfillOutputMinSize)
+		re.OutputBackfill = &remoteexec.OutputBackfill{
+			Cache:   cclient,
+			Client:  re.Client,
+			MinSize: *backfillOutputMinSize,
+		}
+		fileService.Backfiller = re.OutputBackfill
+	}
+	if *localFallbackSandbox != "" {
+		l, err := remoteexec.NewLocalExecutor(*localFallbackSandbox, *localFallbackDir, *localFallbackConcurrency)
+		if err != nil {
+			logger.Fatalf("local fallback: %v", err)
+		}
+		l.ReadOnlyDirs = nil
+		for _, dir := range strings.Split(*localFallbackRODirs, ",") {
+			if dir == "" {
+				continue
+			}
+			l.ReadOnlyDirs = append(l.ReadOnlyDirs, dir)
+		}
+		logger.Infof("local fallback: sandbox=%s concurrency=%d dir=%s readonly=%q", l.Sandbox, cap(l.Sema), l.Dir, l.ReadOnlyDirs)
+		re.LocalFallback = l
+	}
+	if *authzPolicyURL != "" {
+		logger.Infof("authorization policy: %s fail-closed=%t cache-ttl=%s", *authzPolicyURL, *authzPolicyFailClosed, *authzPolicyCacheTTL)
+		var policy exec.Policy = exec.OPAPolicy{
+			URL: *authzPolicyURL,
+			Client: &http.Client{
+				Timeout: 5 * time.Second,
+			},
+		}
+		if *authzPolicyCacheTTL > 0 {
+			policy = &exec.CachedPolicy{
+				Policy: policy,
+				TTL:    *authzPolicyCacheTTL,
+			}
+		}
+		re.Policy = policy
+		re.PolicyFailClosed = *authzPolicyFailClosed
+	}
+	if *execTimeoutConfig != "" {
+		p, err := remoteexec.LoadTimeoutPolicy(*execTimeoutConfig)
+		if err != nil {
+			logger.Fatalf("exec timeout config: %v", err)
+		}
+		logger.Infof("exec timeout policy: %d rules", len(p.Rules))
+		re.TimeoutPolicy = p
+	}
+	re.MinDeadlineBudget = *execMinDeadlineBudget
+	re.Scheduler = newScheduler(ctx)
+	re.Attestor = newAttestor(ctx, cclient)
+	re.Router = newRouter(ctx, breaker, opts...)
+	if *execInputLimitConfig != "" {
+		p, err := remoteexec.LoadInputLimitPolicy(*execInputLimitConfig)
+		if err != nil {
+			logger.Fatalf("exec input limit config: %v", err)
+		}
+		logger.Infof("exec input limit policy: %d rules", len(p.Rules))
+		re.InputLimitPolicy = p
+	}
+	if *execPriorityConfig != "" {
+		p, err := remoteexec.LoadPriorityPolicy(*execPriorityConfig)
+		if err != nil {
+			logger.Fatalf("exec priority config: %v", err)
+		}
+		logger.Infof("exec priority policy: %d rules", len(p.Rules))
+		re.PriorityPolicy = p
+	}
+	server.AddStatuszCheck("rbe-capabilities", re.ProbeCapabilities)
+	if *rbeProbeInterval > 0 {
+		prober := &remoteexec.Prober{
+			Adapter:  re,
+			Platform: proberPlatform(*platformContainerImage),
+			Interval: *rbeProbeInterval,
+		}
+		logger.Infof("rbe prober: interval=%s", *rbeProbeInterval)
+		go prober.Run(ctx)
+		server.AddStatuszCheck("rbe-prober", prober.Check)
+	}
+	if *selftest {
+		st := &server.SelfTest{Name: "remoteexec_proxy"}
+		st.Add("acl", aclCheck.Update)
+		st.Add("service-accounts", aclCheck.Checker.CheckServiceAccounts)
+		st.Add("cache", func(ctx context.Context) error {
+			return cache.SelfTest(ctx, cclient)
+		})
+		st.Add("rbe-capabilities", re.ProbeCapabilities)
+		if *execConfigFile != "" {
+			st.Add("exec-config", func(ctx context.Context) error {
+				c, err := readConfigResp(*execConfigFile)
+				if err != nil {
+					return err
+				}
+				return re.Inventory.Configure(ctx, c)
+			})
+		}
+		server.RunSelfTest(ctx, st)
+	}
+	err = re.ProbeCapabilities(ctx)
+	if err != nil {
+		// it would be retried at the first Exec.
+		logger.Warnf("probe capabilities: %v", err)
+	}
+	if *journalDir != "" {
+		j, err := remoteexec.NewJournal(*journalDir)
+		if err != nil {
+			logger.Fatalf("journal %s: %v", *journalDir, err)
+		}
+		entries, err := j.Load(ctx)
+		if err != nil {
+			logger.Fatalf("journal %s: %v", *journalDir, err)
+		}
+		re.Journal = j
+		go re.Recover(ctx, entries, *journalReattach)
 	}
 
 	configResp := &cmdpb.ConfigResp{
@@ -465,32 +1023,97 @@ func main() {
 			},
 		},
 	}
+	if router := re.Router; router != nil {
+		router.HealthCheck = re.CheckBackend
+		re.Inventory.OnConfigure = router.Configure
+		go router.Run(ctx)
+		server.AddStatuszCheck("remoteexec-routing", router.Check)
+	}
 	// TODO: document config example?
+	execConfigLoader := &execConfig{
+		fname:      *execConfigFile,
+		configurer: &re.Inventory,
+		resp:       configResp,
+		loadTime:   time.Now(),
+	}
 	if *execConfigFile != "" {
-		c, err := readConfigResp(*execConfigFile)
+		err = execConfigLoader.load(ctx)
 		if err != nil {
 			logger.Fatal(err)
 		}
-		configResp = c
+		err = execConfigLoader.Watch(ctx)
+		if err != nil {
+			logger.Fatalf("exec config watch %s: %v", *execConfigFile, err)
+		}
+		server.AddStatuszCheck("exec-config", execConfigLoader.Check)
+	} else {
+		err = re.Inventory.Configure(ctx, configResp)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		server.RecordConfigChange(ctx, "exec-config", configResp.VersionId)
+	}
+	var els execlogpb.LogServiceServer
+	execlogSinkConfig := execlog.SinkConfig{
+		BigQueryTable:  *execlogBigqueryTable,
+		JSONLFile:      *execlogJSONLFile,
+		PubSubTopics:   *execlogPubsubTopics,
+		KafkaRESTProxy: *execlogKafkaRESTProxy,
+		KafkaTopics:    *execlogKafkaTopics,
 	}
-	err = re.Inventory.Configure(ctx, configResp)
+	if *serviceAccountJSON != "" {
+		execlogSinkConfig.ClientOptions = append(execlogSinkConfig.ClientOptions, option.WithServiceAccountFile(*serviceAccountJSON))
+	}
+	execlogBatchers, err := execlogSinkConfig.NewBatchers(ctx)
 	if err != nil {
-		logger.Fatal(err)
+		logger.Fatalf("execlog sinks: %v", err)
+	}
+	if len(execlogBatchers) > 0 {
+		for _, b := range execlogBatchers {
+			logger.Infof("execlog sinks: %v", b.Sinks)
+		}
+		els = &execlog.Service{
+			Batchers: execlogBatchers,
+		}
+	}
+	var storeFileIdempotency *frontend.Idempotency
+	if *storeFileIdempotencyTTL > 0 {
+		storeFileIdempotency = &frontend.Idempotency{
+			TTL: *storeFileIdempotencyTTL,
+		}
+	}
+	var execService execpb.ExecServiceServer = reExecServer{re: re}
+	if *localDocker {
+		logger.Infof("local docker: image=%s concurrency=%d dir=%s", *platformContainerImage, *localDockerConcurrency, *localDockerDir)
+		execService = dockerExecServer{
+			s: &localdocker.Server{
+				Inventory:      &re.Inventory,
+				GomaFile:       fileServiceClient,
+				ContainerImage: *platformContainerImage,
+				Dir:            *localDockerDir,
+				Sema:           make(chan struct{}, *localDockerConcurrency),
+			},
+		}
 	}
 	mux := http.DefaultServeMux
 	frontend.Register(mux, frontend.Frontend{
 		Backend: localBackend{
-			ExecService: reExecServer{re: re},
+			ExecService: execService,
 			FileService: reFileServer{s: fileServiceClient.Service},
 			Auth: &auth.Auth{
 				Client: authClient{Service: authService},
 			},
+			ByteStreamClient: re.ByteStream(),
+			Instance:         re.Instance(),
+			ExeclogService:   els,
 		},
+		StoreFileIdempotency: storeFileIdempotency,
 	})
 
 	mux.Handle("/healthz", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		fmt.Fprintln(w, "ok")
 	}))
+	mux.Handle("/configz", &re.Inventory)
 	tmpl := template.Must(template.New("index").Parse(`
 <html>
 <head>
@@ -507,18 +1130,37 @@ func main() {
 <p><b>redis:</b> {{.RedisAddr}}</p>
 <p><b>file-cache-bucket:</b> {{.FileCacheBucket}}</p>
 
-<p><b>config:</b>
+<p><b>config:</b> {{.ConfigFile}}
+<p><b>config version:</b> {{.ConfigVersion}} (loaded at {{.ConfigLoadTime}})
+{{if .ConfigErr}}<p><b>config reload error:</b> {{.ConfigErr}}</p>{{end}}
 <pre>{{.Config}}</pre>
 
+<h2>RBE capabilities</h2>
+{{with .Capabilities}}
+<p><b>probed at:</b> {{.ProbeTime}}</p>
+{{if .Err}}<p><b>error:</b> {{.Err}}</p>{{end}}
+<p><b>digest function:</b> {{.DigestFunction}} (advertised: {{.DigestFunctions}})</p>
+<p><b>max batch total size bytes:</b> {{.MaxBatchTotalSizeBytes}}</p>
+<p><b>compressors:</b> {{.Compressors}}</p>
+<p><b>cache priorities:</b> {{.CachePriorities}}</p>
+<p><b>execution priorities:</b> {{.ExecutionPriorities}}</p>
+<p><b>exec enabled:</b> {{.ExecEnabled}}</p>
+{{end}}
+
 <hr>
 <p>
+<a href="/configz">/configz</a> |
+<a href="/debug/operations">/debug/operations</a> |
+<a href="/debug/requests">/debug/requests</a> |
 <a href="/debug/tracez">/debug/tracez</a> |
 <a href="/debug/rpcz">/debug/rpcz</a> |
+<a href="/buildz">/buildz</a> |
 <a href="/healthz">/healthz - for health check</a>
 </body>
 </html>`))
 
 	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		config, configLoadTime := execConfigLoader.Config()
 		err := tmpl.Execute(w, struct {
 			Port                   int
 			RemoteexecAddr         string
@@ -528,7 +1170,12 @@ func main() {
 			PlatformContainerImage string
 			RedisAddr              string
 			FileCacheBucket        string
+			ConfigFile             string
+			ConfigVersion          string
+			ConfigLoadTime         time.Time
+			ConfigErr              error
 			Config                 *cmdpb.ConfigResp
+			Capabilities           remoteexec.Capabilities
 		}{
 			Port:                   *port,
 			RemoteexecAddr:         *remoteexecAddr,
@@ -538,7 +1185,12 @@ func main() {
 			PlatformContainerImage: *platformContainerImage,
 			RedisAddr:              redisAddr,
 			FileCacheBucket:        *fileCacheBucket,
-			Config:                 configResp,
+			ConfigFile:             *execConfigFile,
+			ConfigVersion:          re.Inventory.VersionID(),
+			ConfigLoadTime:         configLoadTime,
+			ConfigErr:              execConfigLoader.Check(ctx),
+			Config:                 config,
+			Capabilities:           re.Capabilities(),
 		})
 		if err != nil {
 			logger := log.FromContext(ctx)
@@ -546,5 +1198,9 @@ func main() {
 		}
 	}))
 	hsMain := server.NewHTTP(*port, mux)
-	server.Run(ctx, hsMain)
+	servers := []server.Server{hsMain}
+	for _, b := range execlogBatchers {
+		servers = append(servers, b)
+	}
+	server.Run(ctx, servers...)
 }
@@ -0,0 +1,251 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+/*
+Binary toolchain_config_check validates toolchain config before rolling
+it out, i.e. before bumping seq of runtimes.
+
+It loads configmap and descriptors in the same way as exec_server,
+checks selectors, prebuilt allow/deny rules and platform properties,
+cross-references platform properties with supported node properties
+of RBE instance, and prints diff against the config currently served
+by exec_server.
+
+	$ toolchain_config_check --configmap_file=toolchain-config.textproto \
+	    --toolchain-config-bucket=$project-toolchain-config \
+	    --remoteexec-addr=remotebuildexecution.googleapis.com:443 \
+	    --remote-instance-name=projects/$project/instances/default_instance \
+	    --served-configz=http://exec-server:8081/configz
+
+It exits with non-zero status if it finds any issue.
+*/
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	"go.chromium.org/goma/server/command"
+	"go.chromium.org/goma/server/command/registry"
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+var (
+	configMapFile         = flag.String("configmap_file", "", "filename for configmap text proto to check")
+	toolchainConfigBucket = flag.String("toolchain-config-bucket", "", "cloud storage bucket for toolchain config")
+	toolchainConfigDir    = flag.String("toolchain-config-dir", "", "local directory for toolchain config, in the same layout as --toolchain-config-bucket")
+
+	remoteexecAddr     = flag.String("remoteexec-addr", "", "remoteexec API endpoint. used as service_addr of runtimes without service_addr, and to get capabilities of RBE instance.")
+	remoteInstanceName = flag.String("remote-instance-name", "", "remote instance name to get capabilities. platform properties are not checked against RBE if empty.")
+
+	servedConfigz = flag.String("served-configz", "", "URL of /configz of exec_server, e.g. http://exec-server:8081/configz, to print diff against the config currently served.")
+
+	serviceAccountFile = flag.String("service-account-file", "", "service account json file")
+)
+
+const scope = "https://www.googleapis.com/auth/cloud-platform"
+
+func credentialsFromFlags(ctx context.Context) (*google.Credentials, error) {
+	if *serviceAccountFile != "" {
+		b, err := ioutil.ReadFile(*serviceAccountFile)
+		if err != nil {
+			return nil, err
+		}
+		return google.CredentialsFromJSON(ctx, b, scope)
+	}
+	return google.FindDefaultCredentials(ctx, scope)
+}
+
+// nodeProperties returns supported node properties of RBE instance.
+func nodeProperties(ctx context.Context, creds *google.Credentials) ([]string, error) {
+	conn, err := grpc.DialContext(ctx, *remoteexecAddr,
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	token, err := creds.TokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	c, err := rpb.NewCapabilitiesClient(conn).GetCapabilities(ctx, &rpb.GetCapabilitiesRequest{
+		InstanceName: *remoteInstanceName,
+	}, grpc.PerRPCCredentials(oauth.NewOauthAccess(token)))
+	if err != nil {
+		return nil, fmt.Errorf("GetCapabilities: %v", err)
+	}
+	return c.GetExecutionCapabilities().GetSupportedNodeProperties(), nil
+}
+
+// servedConfigs returns configs currently served by exec_server.
+func servedConfigs(ctx context.Context, configz string) (*cmdpb.ConfigResp, error) {
+	u, err := url.Parse(configz)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("format", "textproto")
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	cr := &cmdpb.ConfigResp{}
+	err = prototext.Unmarshal(b, cr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", u, err)
+	}
+	return cr, nil
+}
+
+func main() {
+	flag.Parse()
+	ctx := context.Background()
+	logger := log.FromContext(ctx)
+	defer logger.Sync()
+
+	if *configMapFile == "" {
+		logger.Fatalf("--configmap_file must be given")
+	}
+	var baseURI string
+	switch {
+	case *toolchainConfigBucket != "":
+		baseURI = "gs://" + *toolchainConfigBucket
+	case *toolchainConfigDir != "":
+		baseURI = "file://" + strings.TrimSuffix(*toolchainConfigDir, "/")
+	default:
+		logger.Fatalf("--toolchain-config-bucket or --toolchain-config-dir must be given")
+	}
+	b, err := ioutil.ReadFile(*configMapFile)
+	if err != nil {
+		logger.Fatalf("--configmap_file: %v", err)
+	}
+	cm := &cmdpb.ConfigMap{}
+	err = prototext.Unmarshal(b, cm)
+	if err != nil {
+		logger.Fatalf("--configmap_file: %v", err)
+	}
+	for _, rc := range cm.Runtimes {
+		if rc.ServiceAddr == "" {
+			rc.ServiceAddr = *remoteexecAddr
+		}
+	}
+
+	var issues []error
+	issues = append(issues, command.CheckConfigMap(cm)...)
+
+	creds, err := credentialsFromFlags(ctx)
+	if err != nil {
+		logger.Warnf("no credential: %v", err)
+	}
+	var props []string
+	if *remoteexecAddr != "" && *remoteInstanceName != "" && creds != nil {
+		props, err = nodeProperties(ctx, creds)
+		if err != nil {
+			logger.Fatalf("capabilities of %s: %v", *remoteInstanceName, err)
+		}
+		fmt.Printf("supported node properties of %s: %q\n", *remoteInstanceName, props)
+	}
+
+	loader := &command.ConfigLoader{
+		EnableParallel: true,
+	}
+	if *toolchainConfigBucket != "" {
+		var opts []option.ClientOption
+		if *serviceAccountFile != "" {
+			opts = append(opts, option.WithServiceAccountFile(*serviceAccountFile))
+		}
+		gsclient, err := storage.NewClient(ctx, opts...)
+		if err != nil {
+			logger.Fatalf("storage client failed: %v", err)
+		}
+		defer gsclient.Close()
+		loader.StorageClient = stiface.AdaptClient(gsclient)
+	}
+	if creds != nil {
+		loader.RegistryClient = &registry.Client{
+			Credential: func(ctx context.Context, registry string) (string, string, error) {
+				token, err := creds.TokenSource.Token()
+				if err != nil {
+					return "", "", err
+				}
+				return "oauth2accesstoken", token.AccessToken, nil
+			},
+		}
+	} else {
+		loader.RegistryClient = &registry.Client{}
+	}
+
+	var confs []*cmdpb.Config
+	for _, rc := range cm.Runtimes {
+		if rc.ServiceAddr == "" {
+			continue
+		}
+		uri := baseURI + "/" + rc.Name
+		if rc.RegistryRef != "" {
+			uri = "oci://" + rc.RegistryRef
+		}
+		rconfs, err := loader.Load(ctx, uri, rc)
+		if err != nil {
+			issues = append(issues, fmt.Errorf("runtime %s: load %s: %v", rc.Name, uri, err))
+			continue
+		}
+		fmt.Printf("runtime %s: %d configs from %s\n", rc.Name, len(rconfs), uri)
+		issues = append(issues, command.CheckConfigs(rc, rconfs, props)...)
+		confs = append(confs, rconfs...)
+	}
+
+	if *servedConfigz != "" {
+		served, err := servedConfigs(ctx, *servedConfigz)
+		if err != nil {
+			logger.Fatalf("--served-configz: %v", err)
+		}
+		diffs := command.DiffConfigs(served.Configs, confs)
+		fmt.Printf("\ndiff against served config (version-id: %s): %d changes\n", served.VersionId, len(diffs))
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+	}
+
+	if len(issues) == 0 {
+		fmt.Println("\nno issues found")
+		return
+	}
+	fmt.Printf("\n%d issues found\n", len(issues))
+	for _, err := range issues {
+		fmt.Println(err)
+	}
+	os.Exit(1)
+}
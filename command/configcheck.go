@@ -0,0 +1,155 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+// CheckConfigMap checks runtime configs in cm, and returns issues
+// that would make toolchain config not served as intended.
+func CheckConfigMap(cm *cmdpb.ConfigMap) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, rc := range cm.GetRuntimes() {
+		name := rc.GetName()
+		if name == "" {
+			errs = append(errs, fmt.Errorf("runtimes[%d]: no name", i))
+			name = fmt.Sprintf("runtimes[%d]", i)
+		} else if seen[name] {
+			errs = append(errs, fmt.Errorf("runtime %s: duplicate name", name))
+		}
+		seen[name] = true
+		if rc.GetServiceAddr() == "" {
+			errs = append(errs, fmt.Errorf("runtime %s: no service_addr. runtime will be ignored", name))
+		}
+		for _, allowed := range rc.GetAllowedPrebuilts() {
+			for _, disallowed := range rc.GetDisallowedPrebuilts() {
+				if strings.HasPrefix(allowed, disallowed) {
+					errs = append(errs, fmt.Errorf("runtime %s: allowed prebuilt %q is disallowed by %q", name, allowed, disallowed))
+				}
+			}
+		}
+		for j, sel := range rc.GetDisallowedCommands() {
+			if sel.GetName() == "" && sel.GetVersion() == "" && sel.GetTarget() == "" && sel.GetBinaryHash() == "" {
+				errs = append(errs, fmt.Errorf("runtime %s: disallowed_commands[%d]: empty selector disallows nothing", name, j))
+			}
+		}
+		props := make(map[string]bool)
+		for j, p := range rc.GetPlatform().GetProperties() {
+			switch {
+			case p.GetName() == "":
+				errs = append(errs, fmt.Errorf("runtime %s: platform.properties[%d]: no name", name, j))
+			case props[p.GetName()]:
+				errs = append(errs, fmt.Errorf("runtime %s: platform property %q: duplicate name", name, p.GetName()))
+			}
+			props[p.GetName()] = true
+		}
+	}
+	return errs
+}
+
+// CheckConfigs checks configs loaded for runtime rc, and returns issues.
+// If nodeProperties is not empty, i.e. supported node properties of
+// RBE instance, platform properties not in nodeProperties are
+// reported.
+func CheckConfigs(rc *cmdpb.RuntimeConfig, confs []*cmdpb.Config, nodeProperties []string) []error {
+	var errs []error
+	name := rc.GetName()
+	supported := make(map[string]bool)
+	for _, p := range nodeProperties {
+		supported[p] = true
+	}
+	unsupported := make(map[string]bool)
+	seen := make(map[string]bool)
+	n := 0
+	for _, c := range confs {
+		for _, p := range c.GetRemoteexecPlatform().GetProperties() {
+			if len(supported) > 0 && !supported[p.GetName()] && !unsupported[p.GetName()] {
+				unsupported[p.GetName()] = true
+				errs = append(errs, fmt.Errorf("runtime %s: platform property %q is not supported by RBE", name, p.GetName()))
+			}
+		}
+		if c.GetCmdDescriptor() == nil {
+			continue
+		}
+		n++
+		sel := c.GetCmdDescriptor().GetSelector()
+		if sel.GetName() == "" || sel.GetBinaryHash() == "" {
+			errs = append(errs, fmt.Errorf("runtime %s: selector %s: no name or binary_hash", name, sel))
+		}
+		key := selectorKey(sel)
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("runtime %s: duplicate selector %s", name, key))
+		}
+		seen[key] = true
+	}
+	if n == 0 && rc.GetPlatformRuntimeConfig() == nil {
+		errs = append(errs, fmt.Errorf("runtime %s: no toolchain config. check prebuilts and allowed_prebuilts", name))
+	}
+	return errs
+}
+
+func selectorKey(sel *cmdpb.Selector) string {
+	return fmt.Sprintf("%s %s %s %s", sel.GetName(), sel.GetVersion(), sel.GetTarget(), sel.GetBinaryHash())
+}
+
+// configKey returns key of config to compare configs.
+func configKey(c *cmdpb.Config) string {
+	if c.GetCmdDescriptor() == nil {
+		return fmt.Sprintf("%s platform %v", c.GetTarget().GetAddr(), c.GetDimensions())
+	}
+	return fmt.Sprintf("%s %s", c.GetTarget().GetAddr(), selectorKey(c.GetCmdDescriptor().GetSelector()))
+}
+
+// DiffConfigs returns human-readable diff from configs from to to,
+// a line per added ("+"), deleted ("-") or changed ("~") config.
+// Build info (e.g. timestamp) is ignored.
+func DiffConfigs(from, to []*cmdpb.Config) []string {
+	oldm := make(map[string]*cmdpb.Config)
+	for _, c := range from {
+		oldm[configKey(c)] = c
+	}
+	newm := make(map[string]*cmdpb.Config)
+	for _, c := range to {
+		newm[configKey(c)] = c
+	}
+	var diffs []string
+	for k, c := range newm {
+		oc, ok := oldm[k]
+		if !ok {
+			diffs = append(diffs, "+ "+k)
+			continue
+		}
+		var changes []string
+		if !proto.Equal(oc.GetCmdDescriptor(), c.GetCmdDescriptor()) {
+			changes = append(changes, "descriptor")
+		}
+		if !proto.Equal(oc.GetRemoteexecPlatform(), c.GetRemoteexecPlatform()) {
+			changes = append(changes, fmt.Sprintf("platform %v -> %v", oc.GetRemoteexecPlatform().GetProperties(), c.GetRemoteexecPlatform().GetProperties()))
+		}
+		if !proto.Equal(oc.GetAcl(), c.GetAcl()) {
+			changes = append(changes, fmt.Sprintf("acl %v -> %v", oc.GetAcl(), c.GetAcl()))
+		}
+		if len(changes) > 0 {
+			diffs = append(diffs, fmt.Sprintf("~ %s: %s", k, strings.Join(changes, ", ")))
+		}
+	}
+	for k := range oldm {
+		if _, ok := newm[k]; !ok {
+			diffs = append(diffs, "- "+k)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i][2:] < diffs[j][2:]
+	})
+	return diffs
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+func errStrings(errs []error) []string {
+	var s []string
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return s
+}
+
+func TestCheckConfigMap(t *testing.T) {
+	cm := &cmdpb.ConfigMap{
+		Runtimes: []*cmdpb.RuntimeConfig{
+			{
+				Name:        "linux",
+				ServiceAddr: "rbe.example.com",
+				Platform: &cmdpb.Platform{
+					Properties: []*cmdpb.Platform_Property{
+						{Name: "container-image", Value: "docker://..."},
+						{Name: "OSFamily", Value: "Linux"},
+					},
+				},
+				AllowedPrebuilts:    []string{"clang"},
+				DisallowedPrebuilts: []string{"gcc"},
+			},
+			{
+				Name:                "linux",
+				AllowedPrebuilts:    []string{"clang-old"},
+				DisallowedPrebuilts: []string{"clang"},
+				DisallowedCommands: []*cmdpb.Selector{
+					{},
+				},
+				Platform: &cmdpb.Platform{
+					Properties: []*cmdpb.Platform_Property{
+						{Name: "OSFamily", Value: "Linux"},
+						{Name: "OSFamily", Value: "Windows"},
+					},
+				},
+			},
+		},
+	}
+	got := errStrings(CheckConfigMap(cm))
+	want := []string{
+		"runtime linux: duplicate name",
+		"runtime linux: no service_addr. runtime will be ignored",
+		`runtime linux: allowed prebuilt "clang-old" is disallowed by "clang"`,
+		"runtime linux: disallowed_commands[0]: empty selector disallows nothing",
+		`runtime linux: platform property "OSFamily": duplicate name`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckConfigMap diff -want +got:\n%s", diff)
+	}
+}
+
+func TestCheckConfigs(t *testing.T) {
+	platform := &cmdpb.RemoteexecPlatform{
+		Properties: []*cmdpb.RemoteexecPlatform_Property{
+			{Name: "container-image", Value: "docker://..."},
+			{Name: "gpu", Value: "none"},
+		},
+	}
+	config := func(name, hash string) *cmdpb.Config {
+		return &cmdpb.Config{
+			CmdDescriptor: &cmdpb.CmdDescriptor{
+				Selector: &cmdpb.Selector{
+					Name:       name,
+					BinaryHash: hash,
+				},
+			},
+			RemoteexecPlatform: platform,
+		}
+	}
+	rc := &cmdpb.RuntimeConfig{
+		Name: "linux",
+	}
+	got := errStrings(CheckConfigs(rc, []*cmdpb.Config{
+		config("clang", "1234"),
+		config("clang", "1234"),
+		config("gcc", "5678"),
+	}, []string{"container-image", "OSFamily"}))
+	want := []string{
+		`runtime linux: platform property "gpu" is not supported by RBE`,
+		"runtime linux: duplicate selector clang   1234",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckConfigs diff -want +got:\n%s", diff)
+	}
+
+	got = errStrings(CheckConfigs(rc, nil, nil))
+	want = []string{
+		"runtime linux: no toolchain config. check prebuilts and allowed_prebuilts",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckConfigs(no configs) diff -want +got:\n%s", diff)
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	config := func(name, hash, image string) *cmdpb.Config {
+		return &cmdpb.Config{
+			Target: &cmdpb.Target{
+				Addr: "rbe.example.com",
+			},
+			CmdDescriptor: &cmdpb.CmdDescriptor{
+				Selector: &cmdpb.Selector{
+					Name:       name,
+					BinaryHash: hash,
+				},
+			},
+			RemoteexecPlatform: &cmdpb.RemoteexecPlatform{
+				Properties: []*cmdpb.RemoteexecPlatform_Property{
+					{Name: "container-image", Value: image},
+				},
+			},
+		}
+	}
+	old := []*cmdpb.Config{
+		config("clang", "1234", "docker://image1"),
+		config("gcc", "5678", "docker://image1"),
+	}
+	cur := []*cmdpb.Config{
+		config("clang", "1234", "docker://image2"),
+		config("clang", "abcd", "docker://image2"),
+	}
+	got := DiffConfigs(old, cur)
+	want := []string{
+		fmt.Sprintf("~ rbe.example.com clang   1234: platform %v -> %v", old[0].RemoteexecPlatform.Properties, cur[0].RemoteexecPlatform.Properties),
+		"+ rbe.example.com clang   abcd",
+		"- rbe.example.com gcc   5678",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffConfigs diff -want +got:\n%s", diff)
+	}
+	if got := DiffConfigs(old, old); len(got) != 0 {
+		t.Errorf("DiffConfigs(old, old)=%q; want no diff", got)
+	}
+}
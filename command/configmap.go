@@ -11,10 +11,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"path"
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/pubsub"
@@ -30,6 +33,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"go.chromium.org/goma/server/command/registry"
 	"go.chromium.org/goma/server/log"
 	cmdpb "go.chromium.org/goma/server/proto/command"
 	"go.chromium.org/goma/server/rpc"
@@ -59,7 +63,8 @@ var (
 // ConfigMap provides Watcher, Seqs, Bucket and RuntimeConfigs.
 //
 // if seq is updated from last load, it will load CmdDescriptor
-// from <bucket>/<runtime>/<prebuilt_item>/descriptors/<descriptorHash>.
+// from <bucket>/<runtime>/<prebuilt_item>/descriptors/<descriptorHash>,
+// or from the OCI artifact of registry_ref in the runtime config.
 type ConfigMapLoader struct {
 	ConfigMap    ConfigMap
 	ConfigLoader ConfigLoader
@@ -74,7 +79,9 @@ type ConfigMap interface {
 	// Seqs returns a map of config name to sequence.
 	Seqs(ctx context.Context) (map[string]string, error)
 
-	// Bucket returns toolchain-config bucket.
+	// Bucket returns toolchain-config bucket,
+	// or URI of toolchain-config location, e.g. file://<dir> or
+	// https://<host>/<path>.
 	Bucket(ctx context.Context) (string, error)
 
 	// RuntimeConfigs returns a map of RuntimeConfigs.
@@ -302,7 +309,9 @@ func (c ConfigMapBucket) Watcher(ctx context.Context) ConfigMapWatcher {
 	}
 }
 
-func (c ConfigMapBucket) pubsubWatcher(ctx context.Context) (ConfigMapWatcher, error) {
+// notificationTopic returns pubsub topic of the storage notification
+// on the bucket.
+func (c ConfigMapBucket) notificationTopic(ctx context.Context) (*pubsub.Topic, error) {
 	bucket, _, err := splitGCSPath(c.URI)
 	if err != nil {
 		return nil, err
@@ -318,11 +327,18 @@ func (c ConfigMapBucket) pubsubWatcher(ctx context.Context) (ConfigMapWatcher, e
 	if !ok || err != nil {
 		return nil, fmt.Errorf("notification topic:%s (notification:%#v): not exist: %v", topic, notification, err)
 	}
+	return topic, nil
+}
+
+// subscription returns subscription of SubscriberID to topic.
+// It creates the subscription if not exist.
+func (c ConfigMapBucket) subscription(ctx context.Context, topic *pubsub.Topic) (*pubsub.Subscription, error) {
+	logger := log.FromContext(ctx)
 	if c.SubscriberID == "" {
 		return nil, errors.New("SubscriberID is not specified")
 	}
 	subscription := c.PubsubClient.Subscription(c.SubscriberID)
-	ok, err = subscription.Exists(ctx)
+	ok, err := subscription.Exists(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("subscription:%s err:%v", c.SubscriberID, err)
 	}
@@ -334,19 +350,31 @@ func (c ConfigMapBucket) pubsubWatcher(ctx context.Context) (ConfigMapWatcher, e
 		if sc.Topic.String() != topic.String() {
 			return nil, fmt.Errorf("topic mismatch? %s != %s. delete subscription:%s", sc.Topic, topic, c.SubscriberID)
 		}
-	} else {
-		logger.Infof("subscriber:%s not found. creating", c.SubscriberID)
-		subscription, err = c.PubsubClient.CreateSubscription(ctx, c.SubscriberID, pubsub.SubscriptionConfig{
-			Topic: topic,
-			// experimental config.
-			// minimum is 1 day
-			// +12 hours margin, to cover summar time switch (+1 hour)
-			// b/112820308
-			ExpirationPolicy: 36 * time.Hour,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("create subscription:%s err:%v", c.SubscriberID, err)
-		}
+		return subscription, nil
+	}
+	logger.Infof("subscriber:%s not found. creating", c.SubscriberID)
+	subscription, err = c.PubsubClient.CreateSubscription(ctx, c.SubscriberID, pubsub.SubscriptionConfig{
+		Topic: topic,
+		// experimental config.
+		// minimum is 1 day
+		// +12 hours margin, to cover summar time switch (+1 hour)
+		// b/112820308
+		ExpirationPolicy: 36 * time.Hour,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create subscription:%s err:%v", c.SubscriberID, err)
+	}
+	return subscription, nil
+}
+
+func (c ConfigMapBucket) pubsubWatcher(ctx context.Context) (ConfigMapWatcher, error) {
+	topic, err := c.notificationTopic(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subscription, err := c.subscription(ctx, topic)
+	if err != nil {
+		return nil, err
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	// TODO: watch configMapFile.
@@ -359,6 +387,67 @@ func (c ConfigMapBucket) pubsubWatcher(ctx context.Context) (ConfigMapWatcher, e
 	return w, nil
 }
 
+// VerifyNotification verifies storage notification on the bucket and
+// pubsub resources to watch it within timeout, by inspecting their
+// configurations with admin API. It doesn't publish nor receive
+// messages, so it has no side effect on the topic and subscriptions.
+// It returns error with hint to fix the configuration, since Watcher
+// falls back to polling with long interval if pubsub is not available.
+func (c ConfigMapBucket) VerifyNotification(ctx context.Context, timeout time.Duration) error {
+	logger := log.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	bucket, _, err := splitGCSPath(c.URI)
+	if err != nil {
+		return err
+	}
+	notification, err := storageNotification(ctx, c.StorageClient, bucket)
+	if err != nil {
+		return fmt.Errorf("%v: create notification by `gsutil notification create -f json gs://%s`, and grant roles/storage.legacyBucketOwner on the bucket to get it", err, bucket)
+	}
+	if len(notification.EventTypes) > 0 && !stringsContain(notification.EventTypes, storage.ObjectFinalizeEvent) {
+		return fmt.Errorf("notification %s on gs://%s: event types %q don't include %s: recreate notification without -e or with -e %s", notification.ID, bucket, notification.EventTypes, storage.ObjectFinalizeEvent, storage.ObjectFinalizeEvent)
+	}
+	topic, err := c.notificationTopic(ctx)
+	if err != nil {
+		return fmt.Errorf("%v: grant roles/pubsub.viewer on the topic", err)
+	}
+	if c.SubscriberID == "" {
+		return errors.New("SubscriberID is not specified")
+	}
+	subscription := c.PubsubClient.Subscription(c.SubscriberID)
+	ok, err := subscription.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("subscription %s: %v: grant roles/pubsub.viewer in the project", subscription, err)
+	}
+	if !ok {
+		// Watcher will create it.
+		logger.Infof("notification %s on gs://%s to %s. subscription %s not found: grant roles/pubsub.editor in the project to create it", notification.ID, bucket, topic, subscription)
+		return nil
+	}
+	sc, err := subscription.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("subscription config %s: %v: grant roles/pubsub.viewer on the subscription", subscription, err)
+	}
+	if sc.Topic == nil || sc.Topic.String() != topic.String() {
+		return fmt.Errorf("subscription %s is attached to %v, not %s: delete subscription %s", subscription, sc.Topic, topic, c.SubscriberID)
+	}
+	if sc.Detached {
+		return fmt.Errorf("subscription %s is detached from %s: delete subscription %s", subscription, topic, c.SubscriberID)
+	}
+	logger.Infof("notification %s on gs://%s to %s, subscribed by %s", notification.ID, bucket, topic, subscription)
+	return nil
+}
+
+func stringsContain(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (c ConfigMapBucket) Seqs(ctx context.Context) (map[string]string, error) {
 	logger := log.FromContext(ctx)
 	bucket, _, err := splitGCSPath(c.URI)
@@ -371,8 +460,18 @@ func (c ConfigMapBucket) Seqs(ctx context.Context) (map[string]string, error) {
 	}
 	m := map[string]string{}
 	for _, r := range cm.Runtimes {
+		if r.RegistryRef != "" {
+			// artifact is pinned by digest, so digest changes
+			// iff configs are changed.
+			ref, err := registry.ParseReference(r.RegistryRef)
+			if err != nil {
+				return nil, fmt.Errorf("runtime %s: %v", r.Name, err)
+			}
+			m[r.Name] = ref.Digest
+			continue
+		}
 		obj := path.Join(r.Name, "seq")
-		buf, err := storageReadAll(ctx, c.StorageClient, bucket, obj)
+		buf, err := storageReadAll(ctx, c.StorageClient, bucket, obj, 0)
 		if err == storage.ErrObjectNotExist {
 			logger.Infof("ignore %s: %v", obj, err)
 			continue
@@ -405,11 +504,25 @@ func (c ConfigMapBucket) RuntimeConfigs(ctx context.Context) (map[string]*cmdpb.
 	return m, nil
 }
 
-// ConfigLoader loads toolchain_config from cloud storage.
+// ConfigLoader loads toolchain_config from cloud storage,
+// local directory, HTTPS endpoint, or from OCI registry.
 type ConfigLoader struct {
-	StorageClient  stiface.Client
+	StorageClient stiface.Client
+
+	// HTTPClient and HTTPHeader are used to load configs from
+	// https:// URI. http.DefaultClient is used if HTTPClient is nil.
+	HTTPClient *http.Client
+	HTTPHeader http.Header
+
+	// RegistryClient is used to load configs from oci://<ref> URI.
+	RegistryClient *registry.Client
+
 	EnableParallel bool
 
+	// descriptors caches descriptors loaded from cloud storage,
+	// so that a seq bump only downloads changed descriptors.
+	descriptors descriptorCache
+
 	// for test
 	versionID func() string
 }
@@ -475,10 +588,16 @@ func (c *ConfigMapLoader) Load(ctx context.Context, force bool) (*cmdpb.ConfigRe
 	for name, seq := range updated {
 		logger.Infof("update config for %s", name)
 		uri := fmt.Sprintf("gs://%s/%s", bucket, name)
+		if strings.Contains(bucket, "://") {
+			uri = strings.TrimSuffix(bucket, "/") + "/" + name
+		}
 		runtime := runtimeConfigs[name]
 		if runtime == nil {
 			return nil, fmt.Errorf("runtime config %s not found", name)
 		}
+		if runtime.RegistryRef != "" {
+			uri = "oci://" + runtime.RegistryRef
+		}
 		addr := runtime.ServiceAddr
 		if addr == "" {
 			logger.Warnf("no addr for %s. ignoring", name)
@@ -517,6 +636,8 @@ func mergePlatformProperties(rbePlatform *cmdpb.RemoteexecPlatform, platform *cm
 }
 
 // Load loads toolchain config from <uri>.
+// <uri> is gs://<bucket>/<runtime>, file://<dir>/<runtime>,
+// https://<host>/<path>/<runtime> or oci://<registry>/<repository>@<digest>.
 // It sets rc.ServiceAddr  as target addr.
 func (c *ConfigLoader) Load(ctx context.Context, uri string, rc *cmdpb.RuntimeConfig) ([]*cmdpb.Config, error) {
 	platform := &cmdpb.RemoteexecPlatform{}
@@ -528,8 +649,23 @@ func (c *ConfigLoader) Load(ctx context.Context, uri string, rc *cmdpb.RuntimeCo
 		})
 	}
 	platform.HasNsjail = rc.GetPlatformRuntimeConfig().GetHasNsjail()
+	platform.DebugPrefixMap = rc.GetDebugPrefixMap()
 
-	confs, err := loadConfigs(ctx, c.StorageClient, uri, rc, platform, parallel)
+	var confs []*cmdpb.Config
+	var err error
+	switch {
+	case strings.HasPrefix(uri, "oci://"):
+		confs, err = loadRegistryConfigs(ctx, c.RegistryClient, uri, rc, platform, parallel)
+	case strings.HasPrefix(uri, "file://"):
+		confs, err = loadDirConfigs(ctx, uri, rc, platform)
+	case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"):
+		confs, err = loadHTTPConfigs(ctx, httpConfigClient{
+			client: c.HTTPClient,
+			header: c.HTTPHeader,
+		}, uri, rc, platform)
+	default:
+		confs, err = loadConfigs(ctx, c.StorageClient, &c.descriptors, uri, rc, platform, parallel)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -616,7 +752,9 @@ func splitGCSPath(uri string) (string, string, error) {
 	return p[0], p[1], nil
 }
 
-func storageReadAll(ctx context.Context, client stiface.Client, bucket, name string) ([]byte, error) {
+// storageReadAll reads object bucket/name.
+// If gen is not 0, it reads the object only if its generation is gen.
+func storageReadAll(ctx context.Context, client stiface.Client, bucket, name string, gen int64) ([]byte, error) {
 	bkt := client.Bucket(bucket)
 	if bkt == nil {
 		return nil, fmt.Errorf("could not find bucket %s", bucket)
@@ -625,6 +763,9 @@ func storageReadAll(ctx context.Context, client stiface.Client, bucket, name str
 	if obj == nil {
 		return nil, fmt.Errorf("could not find object %s/%s", bucket, name)
 	}
+	if gen != 0 {
+		obj = obj.If(storage.Conditions{GenerationMatch: gen})
+	}
 	rd, err := obj.NewReader(ctx)
 	if err != nil {
 		return nil, err
@@ -639,8 +780,8 @@ func storageReadAll(ctx context.Context, client stiface.Client, bucket, name str
 	return buf.Bytes(), nil
 }
 
-func loadDescriptor(ctx context.Context, client stiface.Client, bucket, name string) (*cmdpb.CmdDescriptor, error) {
-	buf, err := storageReadAll(ctx, client, bucket, name)
+func loadDescriptor(ctx context.Context, client stiface.Client, bucket, name string, gen int64) (*cmdpb.CmdDescriptor, error) {
+	buf, err := storageReadAll(ctx, client, bucket, name, gen)
 	if err != nil {
 		return nil, fmt.Errorf("load %s: %v", name, err)
 	}
@@ -652,6 +793,42 @@ func loadDescriptor(ctx context.Context, client stiface.Client, bucket, name str
 	return d, nil
 }
 
+// descriptorCache caches descriptors loaded from cloud storage
+// by object generation.
+type descriptorCache struct {
+	mu sync.Mutex
+	m  map[string]map[string]cachedDescriptor // key: uri, object name
+}
+
+type cachedDescriptor struct {
+	generation int64
+	d          *cmdpb.CmdDescriptor
+}
+
+// get returns the descriptor of object name in uri if it was
+// loaded from the generation gen.
+// The descriptor must not be modified.
+func (c *descriptorCache) get(uri, name string, gen int64) (*cmdpb.CmdDescriptor, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cd, ok := c.m[uri][name]
+	if !ok || gen == 0 || cd.generation != gen {
+		return nil, false
+	}
+	return cd.d, true
+}
+
+// set replaces descriptors cached for uri with m.
+// Descriptors of objects that no longer exist in uri are dropped.
+func (c *descriptorCache) set(uri string, m map[string]cachedDescriptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]map[string]cachedDescriptor)
+	}
+	c.m[uri] = m
+}
+
 func checkPrebuilt(rc *cmdpb.RuntimeConfig, objName string) error {
 	// objName will be <runtime>/<prebuilts>/descriptors/<hash>
 	i := strings.Index(objName, "/descriptors")
@@ -701,7 +878,7 @@ func checkSelector(rc *cmdpb.RuntimeConfig, sel *cmdpb.Selector) error {
 	return nil
 }
 
-func loadConfigs(ctx context.Context, client stiface.Client, uri string, rc *cmdpb.RuntimeConfig, platform *cmdpb.RemoteexecPlatform, parallel bool) ([]*cmdpb.Config, error) {
+func loadConfigs(ctx context.Context, client stiface.Client, cache *descriptorCache, uri string, rc *cmdpb.RuntimeConfig, platform *cmdpb.RemoteexecPlatform, parallel bool) ([]*cmdpb.Config, error) {
 	logger := log.FromContext(ctx)
 	bucket, obj, err := splitGCSPath(uri)
 	if err != nil {
@@ -755,6 +932,8 @@ func loadConfigs(ctx context.Context, client stiface.Client, uri string, rc *cmd
 	// as unit tests using proto.Equal.
 	var eg errgroup.Group
 	confList := make([]*cmdpb.Config, len(attrsList))
+	descList := make([]*cmdpb.CmdDescriptor, len(attrsList))
+	var hits int32
 	sema := make(chan struct{}, concurrent)
 	for i := range attrsList {
 		i := i
@@ -763,44 +942,41 @@ func loadConfigs(ctx context.Context, client stiface.Client, uri string, rc *cmd
 			// Limit number of goroutines.
 			defer func() { <-sema }()
 			attrs := attrsList[i]
-			d, err := loadDescriptor(ctx, client, bucket, attrs.Name)
-			if err != nil {
-				return err
-			}
-			ts := timestamppb.New(attrs.Updated)
-			if err = checkSelector(rc, d.Selector); err != nil {
-				logger.Errorf("selector in %s/%s: %v", bucket, attrs.Name, err)
-				return nil
-			}
-			if d.Setup == nil {
-				logger.Errorf("no setup in %s/%s", bucket, attrs.Name)
-				return nil
-			}
-			if d.Setup.PathType == cmdpb.CmdDescriptor_UNKNOWN_PATH_TYPE {
-				logger.Errorf("unknown path type in %s/%s", bucket, attrs.Name)
-				return nil
-			}
-			// TODO: fix config definition.
-			// BuildInfo is used for key for cache key.
-			//  include cmd_server hash etc?
-			// BuildInfo.Timestamp is used for dedup in exec_server.
-			confList[i] = &cmdpb.Config{
-				Target: &cmdpb.Target{
-					Addr: rc.ServiceAddr,
-				},
-				BuildInfo: &cmdpb.BuildInfo{
-					Timestamp: ts,
-				},
-				CmdDescriptor:      d,
-				RemoteexecPlatform: platform,
-				Acl:                rc.Acl,
+			d, ok := cache.get(uri, attrs.Name, attrs.Generation)
+			if ok {
+				atomic.AddInt32(&hits, 1)
+			} else {
+				// read the generation we listed, so that cache
+				// won't have descriptor of other generation.
+				var err error
+				d, err = loadDescriptor(ctx, client, bucket, attrs.Name, attrs.Generation)
+				if err != nil {
+					return err
+				}
 			}
+			descList[i] = d
+			// config may be modified by caller, so don't share
+			// descriptor with cache.
+			d = proto.Clone(d).(*cmdpb.CmdDescriptor)
+			confList[i] = newConfig(ctx, rc, platform, bucket+"/"+attrs.Name, d, attrs.Updated)
 			return nil
 		})
 	}
 	if err := eg.Wait(); err != nil {
 		return nil, err
 	}
+	cached := make(map[string]cachedDescriptor)
+	for i, attrs := range attrsList {
+		if attrs.Generation == 0 {
+			continue
+		}
+		cached[attrs.Name] = cachedDescriptor{
+			generation: attrs.Generation,
+			d:          descList[i],
+		}
+	}
+	cache.set(uri, cached)
+	logger.Infof("loaded descriptors from %s: %d cached, %d downloaded", uri, hits, int32(len(attrsList))-hits)
 	for i := range attrsList {
 		attrs := attrsList[i]
 		conf := confList[i]
@@ -813,3 +989,133 @@ func loadConfigs(ctx context.Context, client stiface.Client, uri string, rc *cmd
 	logger.Infof("loaded from %s prefix:%s: %d configs using %v", bucket, obj, len(confs), time.Since(start))
 	return confs, nil
 }
+
+// newConfig returns config for descriptor d loaded from src.
+// It returns nil if d is not valid for rc.
+func newConfig(ctx context.Context, rc *cmdpb.RuntimeConfig, platform *cmdpb.RemoteexecPlatform, src string, d *cmdpb.CmdDescriptor, updated time.Time) *cmdpb.Config {
+	logger := log.FromContext(ctx)
+	if err := checkSelector(rc, d.Selector); err != nil {
+		logger.Errorf("selector in %s: %v", src, err)
+		return nil
+	}
+	if d.Setup == nil {
+		logger.Errorf("no setup in %s", src)
+		return nil
+	}
+	if d.Setup.PathType == cmdpb.CmdDescriptor_UNKNOWN_PATH_TYPE {
+		logger.Errorf("unknown path type in %s", src)
+		return nil
+	}
+	// TODO: fix config definition.
+	// BuildInfo is used for key for cache key.
+	//  include cmd_server hash etc?
+	// BuildInfo.Timestamp is used for dedup in exec_server.
+	return &cmdpb.Config{
+		Target: &cmdpb.Target{
+			Addr:           rc.ServiceAddr,
+			Weight:         rc.ServiceWeight,
+			InstancePrefix: rc.ServiceInstancePrefix,
+		},
+		BuildInfo: &cmdpb.BuildInfo{
+			Timestamp: timestamppb.New(updated),
+		},
+		CmdDescriptor:      d,
+		RemoteexecPlatform: platform,
+		Acl:                rc.Acl,
+	}
+}
+
+// loadRegistryConfigs loads configs from OCI artifact at oci://<ref>.
+//
+// Each layer of the artifact is proto CmdDescriptor, and its
+// org.opencontainers.image.title annotation is
+// <prebuilt-item>/descriptors/<descriptorHash>, as in the bucket.
+// org.opencontainers.image.created annotation of the layer or
+// the manifest is used as timestamp of the config.
+func loadRegistryConfigs(ctx context.Context, client *registry.Client, uri string, rc *cmdpb.RuntimeConfig, platform *cmdpb.RemoteexecPlatform, parallel bool) ([]*cmdpb.Config, error) {
+	logger := log.FromContext(ctx)
+	if client == nil {
+		return nil, fmt.Errorf("no registry client for %s", uri)
+	}
+	ref, err := registry.ParseReference(strings.TrimPrefix(uri, "oci://"))
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	manifest, err := client.Manifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	created := func(annotations map[string]string) time.Time {
+		v, ok := annotations[registry.AnnotationCreated]
+		if !ok {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			logger.Warnf("bad created annotation %q in %s: %v", v, ref, err)
+		}
+		return t
+	}
+	updated := created(manifest.Annotations)
+
+	var layers []registry.Descriptor
+	for _, layer := range manifest.Layers {
+		name := layer.Annotations[registry.AnnotationTitle]
+		if err := checkPrebuilt(rc, name); err != nil {
+			logger.Infof("prebuilt %s: %v", name, err)
+			continue
+		}
+		if path.Base(path.Dir(name)) != "descriptors" {
+			logger.Infof("ignore %s", name)
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	logger.Infof("manifest %s: %d layers took %v", ref, len(manifest.Layers), time.Since(start))
+	start = time.Now()
+	concurrent := 1
+	if parallel {
+		concurrent = runtime.NumCPU() * 4
+	}
+	var eg errgroup.Group
+	confList := make([]*cmdpb.Config, len(layers))
+	sema := make(chan struct{}, concurrent)
+	for i := range layers {
+		i := i
+		sema <- struct{}{}
+		eg.Go(func() error {
+			defer func() { <-sema }()
+			layer := layers[i]
+			name := layer.Annotations[registry.AnnotationTitle]
+			buf, err := client.Blob(ctx, ref, layer)
+			if err != nil {
+				return fmt.Errorf("load %s: %v", name, err)
+			}
+			d := &cmdpb.CmdDescriptor{}
+			err = proto.Unmarshal(buf, d)
+			if err != nil {
+				return fmt.Errorf("parse %s: %v", name, err)
+			}
+			ts := updated
+			if t := created(layer.Annotations); !t.IsZero() {
+				ts = t
+			}
+			confList[i] = newConfig(ctx, rc, platform, ref.String()+"/"+name, d, ts)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	var confs []*cmdpb.Config
+	for i, conf := range confList {
+		if conf == nil {
+			continue
+		}
+		confs = append(confs, conf)
+		logger.Infof("%s/%s: %s", ref, layers[i].Annotations[registry.AnnotationTitle], conf.CmdDescriptor.GetSelector())
+	}
+	logger.Infof("loaded from %s: %d configs using %v", ref, len(confs), time.Since(start))
+	return confs, nil
+}
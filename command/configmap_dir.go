@@ -0,0 +1,271 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/command/registry"
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+// ConfigMapDir accesses config in local directory, e.g. mounted volume
+// or k8s ConfigMap, for deployments without cloud storage.
+//
+// in the <dir>, same layout as ConfigMapBucket
+//
+//	<runtime>/
+//	         seq: text, sequence number.
+//	         <prebuilt-item>/descriptors/<descriptorHash>: proto CmdDescriptor
+//
+// Watcher watches <dir>, <dir>/<runtime> and dir of ConfigMapFile
+// with fsnotify.
+// Seqs and RuntimeConfigs will read ConfigMapFile everytime.
+type ConfigMapDir struct {
+	// Dir is root directory of config data.
+	Dir string
+
+	ConfigMap     *cmdpb.ConfigMap
+	ConfigMapFile string
+
+	// Remoteexec API address, if RBE API is used.
+	// Otherwise, use service_addr in RuntimeConfig proto.
+	RemoteexecAddr string
+}
+
+func (c ConfigMapDir) configMap(ctx context.Context) (*cmdpb.ConfigMap, error) {
+	if c.ConfigMapFile == "" {
+		return proto.Clone(c.ConfigMap).(*cmdpb.ConfigMap), nil
+	}
+	buf, err := ioutil.ReadFile(c.ConfigMapFile)
+	if err != nil {
+		return nil, err
+	}
+	cm := &cmdpb.ConfigMap{}
+	err = prototext.Unmarshal(buf, cm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", c.ConfigMapFile, err)
+	}
+	return cm, nil
+}
+
+// watchDirs returns directories to watch.
+func (c ConfigMapDir) watchDirs(ctx context.Context) []string {
+	logger := log.FromContext(ctx)
+	dirs := []string{c.Dir}
+	if c.ConfigMapFile != "" {
+		dirs = append(dirs, filepath.Dir(c.ConfigMapFile))
+	}
+	cm, err := c.configMap(ctx)
+	if err != nil {
+		logger.Warnf("configmap: %v", err)
+		return dirs
+	}
+	for _, r := range cm.Runtimes {
+		if r.RegistryRef != "" {
+			continue
+		}
+		dirs = append(dirs, filepath.Join(c.Dir, r.Name))
+	}
+	return dirs
+}
+
+type configMapDirWatcher struct {
+	c ConfigMapDir
+	w *fsnotify.Watcher
+}
+
+// add adds directories to watch.
+// runtime directories may be created or replaced after the watcher
+// started, so it is called for each event.
+func (w configMapDirWatcher) add(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	for _, dir := range w.c.watchDirs(ctx) {
+		err := w.w.Add(dir)
+		if err != nil {
+			logger.Warnf("watch %s: %v", dir, err)
+		}
+	}
+}
+
+func (w configMapDirWatcher) Next(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case event, ok := <-w.w.Events:
+		if !ok {
+			return ErrWatcherClosed
+		}
+		logger.Infof("configmap dir event: %s", event)
+	case err, ok := <-w.w.Errors:
+		if !ok {
+			return ErrWatcherClosed
+		}
+		// events may be dropped, so trigger to load seqs.
+		logger.Errorf("configmap dir watch error: %v", err)
+	}
+	w.add(ctx)
+	return nil
+}
+
+func (w configMapDirWatcher) Close() error {
+	ctx := context.Background()
+	logger := log.FromContext(ctx)
+	logger.Infof("dir watcher close")
+	return w.w.Close()
+}
+
+// Watcher returns watcher of the config dir.
+// It falls back to polling if fsnotify is not available.
+func (c ConfigMapDir) Watcher(ctx context.Context) ConfigMapWatcher {
+	logger := log.FromContext(ctx)
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("failed to use dir watcher: %v", err)
+		return configMapBucketPoller{
+			baseDelay: 1 * time.Minute,
+			done:      make(chan bool),
+		}
+	}
+	dw := configMapDirWatcher{
+		c: c,
+		w: w,
+	}
+	dw.add(ctx)
+	logger.Infof("use dir watcher on %s", c.Dir)
+	return dw
+}
+
+func (c ConfigMapDir) Seqs(ctx context.Context) (map[string]string, error) {
+	logger := log.FromContext(ctx)
+	cm, err := c.configMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	for _, r := range cm.Runtimes {
+		if r.RegistryRef != "" {
+			ref, err := registry.ParseReference(r.RegistryRef)
+			if err != nil {
+				return nil, fmt.Errorf("runtime %s: %v", r.Name, err)
+			}
+			m[r.Name] = ref.Digest
+			continue
+		}
+		fname := filepath.Join(c.Dir, r.Name, "seq")
+		buf, err := ioutil.ReadFile(fname)
+		if errors.Is(err, fs.ErrNotExist) {
+			logger.Infof("ignore %s: %v", fname, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[r.Name] = string(buf)
+	}
+	return m, nil
+}
+
+// Bucket returns URI of the config dir, i.e. file://<dir>.
+func (c ConfigMapDir) Bucket(ctx context.Context) (string, error) {
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(dir), nil
+}
+
+func (c ConfigMapDir) RuntimeConfigs(ctx context.Context) (map[string]*cmdpb.RuntimeConfig, error) {
+	cm, err := c.configMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]*cmdpb.RuntimeConfig)
+	for _, rt := range cm.Runtimes {
+		if rt.ServiceAddr == "" {
+			rt.ServiceAddr = c.RemoteexecAddr
+		}
+		m[rt.Name] = rt
+	}
+	return m, nil
+}
+
+// loadDirConfigs loads configs from local directory at file://<dir>.
+func loadDirConfigs(ctx context.Context, uri string, rc *cmdpb.RuntimeConfig, platform *cmdpb.RemoteexecPlatform) ([]*cmdpb.Config, error) {
+	logger := log.FromContext(ctx)
+	dir := filepath.FromSlash(strings.TrimPrefix(uri, "file://"))
+	// runtime dir may be symlink, e.g. k8s ConfigMap volume.
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	var confs []*cmdpb.Config
+	err = filepath.WalkDir(root, func(fname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if fname != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, fname)
+		if err != nil {
+			return err
+		}
+		// name will be <runtime>/<prebuilts>/descriptors/<hash>
+		name := path.Join(path.Base(filepath.ToSlash(dir)), filepath.ToSlash(rel))
+		if err := checkPrebuilt(rc, name); err != nil {
+			logger.Infof("prebuilt %s: %v", name, err)
+			return nil
+		}
+		if path.Base(path.Dir(name)) != "descriptors" {
+			logger.Infof("ignore %s", name)
+			return nil
+		}
+		buf, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return fmt.Errorf("load %s: %v", name, err)
+		}
+		desc := &cmdpb.CmdDescriptor{}
+		err = proto.Unmarshal(buf, desc)
+		if err != nil {
+			return fmt.Errorf("parse %s: %v", name, err)
+		}
+		fi, err := os.Stat(fname)
+		if err != nil {
+			return err
+		}
+		conf := newConfig(ctx, rc, platform, fname, desc, fi.ModTime())
+		if conf == nil {
+			return nil
+		}
+		logger.Infof("%s: %s", fname, conf.CmdDescriptor.GetSelector())
+		confs = append(confs, conf)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("loaded from %s: %d configs using %v", dir, len(confs), time.Since(start))
+	return confs, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+func writeFile(t *testing.T, fname string, data []byte) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(fname, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigMapDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	desc := func(name string) []byte {
+		b, err := proto.Marshal(&cmdpb.CmdDescriptor{
+			Selector: &cmdpb.Selector{
+				Name:       name,
+				Version:    "1.0",
+				Target:     "x86_64-linux-gnu",
+				BinaryHash: name + "-hash",
+			},
+			Setup: &cmdpb.CmdDescriptor_Setup{
+				PathType: cmdpb.CmdDescriptor_POSIX,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	writeFile(t, filepath.Join(dir, "linux", "seq"), []byte("1"))
+	writeFile(t, filepath.Join(dir, "linux", "clang", "descriptors", "clang-hash"), desc("clang"))
+	writeFile(t, filepath.Join(dir, "linux", "clang", "README"), []byte("readme"))
+	writeFile(t, filepath.Join(dir, "linux", "gcc", "descriptors", "gcc-hash"), desc("gcc"))
+
+	cm := ConfigMapDir{
+		Dir: dir,
+		ConfigMap: &cmdpb.ConfigMap{
+			Runtimes: []*cmdpb.RuntimeConfig{
+				{
+					Name:             "linux",
+					AllowedPrebuilts: []string{"clang"},
+				},
+			},
+		},
+		RemoteexecAddr: "rbe.example.com",
+	}
+	w := cm.Watcher(ctx)
+	defer w.Close()
+
+	loader := &ConfigMapLoader{
+		ConfigMap: cm,
+	}
+	resp, err := loader.Load(ctx, false)
+	if err != nil {
+		t.Fatalf("Load=%v; want nil error", err)
+	}
+	if len(resp.Configs) != 1 {
+		t.Fatalf("Load=%v; want 1 config", resp.Configs)
+	}
+	if got, want := resp.Configs[0].CmdDescriptor.GetSelector().GetName(), "clang"; got != want {
+		t.Errorf("config selector name=%q; want %q", got, want)
+	}
+	if got, want := resp.Configs[0].Target.GetAddr(), "rbe.example.com"; got != want {
+		t.Errorf("config target addr=%q; want %q", got, want)
+	}
+
+	_, err = loader.Load(ctx, false)
+	if err != ErrNoUpdate {
+		t.Errorf("Load=%v; want %v", err, ErrNoUpdate)
+	}
+
+	writeFile(t, filepath.Join(dir, "linux", "seq"), []byte("2"))
+	wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = w.Next(wctx)
+	if err != nil {
+		t.Fatalf("Next=%v; want nil error", err)
+	}
+	_, err = loader.Load(ctx, false)
+	if err != nil {
+		t.Errorf("Load after seq update=%v; want nil error", err)
+	}
+
+	w.Close()
+	err = w.Next(ctx)
+	if !errors.Is(err, ErrWatcherClosed) {
+		t.Errorf("Next after Close=%v; want %v", err, ErrWatcherClosed)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/command/registry"
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+// DefaultHTTPPollInterval is default interval to poll config on
+// HTTPS endpoint.
+const DefaultHTTPPollInterval = 5 * time.Minute
+
+// ConfigMapHTTP accesses config on HTTPS endpoint, e.g. raw file URL of
+// git repository, so configs can be managed in source control and
+// promoted by code review.
+//
+// <URL> is https://<host>/<path>.
+// under the <URL>
+//
+//	<runtime>/
+//	         manifest: text, a path of descriptor per line, i.e.
+//	                   <prebuilt-item>/descriptors/<descriptorHash>
+//	         <prebuilt-item>/descriptors/<descriptorHash>: proto CmdDescriptor
+//
+// Since HTTP can't list files, manifest lists descriptors of the runtime.
+// Seq of the runtime is ETag of manifest, or SHA-256 of the manifest
+// if the server doesn't provide ETag. e.g. if <URL> is pinned to
+// a commit of git repository, seq changes when <URL> is changed to
+// other commit that modifies the manifest.
+//
+// Watcher polls the endpoint every PollInterval.
+// Seqs and RuntimeConfigs will read ConfigMapFile everytime.
+type ConfigMapHTTP struct {
+	// URL of config data.
+	URL string
+
+	ConfigMap     *cmdpb.ConfigMap
+	ConfigMapFile string
+
+	// HTTPClient is used to access URL. http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	// Header is added to requests, e.g. Authorization.
+	Header http.Header
+
+	// PollInterval is interval to poll the endpoint.
+	// DefaultHTTPPollInterval if 0.
+	PollInterval time.Duration
+
+	// Remoteexec API address, if RBE API is used.
+	// Otherwise, use service_addr in RuntimeConfig proto.
+	RemoteexecAddr string
+}
+
+func (c ConfigMapHTTP) configMap(ctx context.Context) (*cmdpb.ConfigMap, error) {
+	if c.ConfigMapFile == "" {
+		return proto.Clone(c.ConfigMap).(*cmdpb.ConfigMap), nil
+	}
+	buf, err := ioutil.ReadFile(c.ConfigMapFile)
+	if err != nil {
+		return nil, err
+	}
+	cm := &cmdpb.ConfigMap{}
+	err = prototext.Unmarshal(buf, cm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", c.ConfigMapFile, err)
+	}
+	return cm, nil
+}
+
+// Watcher returns poller of the endpoint.
+func (c ConfigMapHTTP) Watcher(ctx context.Context) ConfigMapWatcher {
+	d := c.PollInterval
+	if d <= 0 {
+		d = DefaultHTTPPollInterval
+	}
+	return configMapBucketPoller{
+		baseDelay: d,
+		done:      make(chan bool),
+	}
+}
+
+func (c ConfigMapHTTP) Seqs(ctx context.Context) (map[string]string, error) {
+	logger := log.FromContext(ctx)
+	cm, err := c.configMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := httpConfigClient{
+		client: c.HTTPClient,
+		header: c.Header,
+	}
+	m := map[string]string{}
+	for _, r := range cm.Runtimes {
+		if r.RegistryRef != "" {
+			ref, err := registry.ParseReference(r.RegistryRef)
+			if err != nil {
+				return nil, fmt.Errorf("runtime %s: %v", r.Name, err)
+			}
+			m[r.Name] = ref.Digest
+			continue
+		}
+		u := strings.TrimSuffix(c.URL, "/") + "/" + path.Join(r.Name, "manifest")
+		resp, err := client.get(ctx, u)
+		if errors.Is(err, errHTTPNotFound) {
+			logger.Infof("ignore %s: %v", u, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[r.Name] = resp.seq()
+	}
+	return m, nil
+}
+
+// Bucket returns URL of config data.
+func (c ConfigMapHTTP) Bucket(ctx context.Context) (string, error) {
+	if !strings.HasPrefix(c.URL, "https://") && !strings.HasPrefix(c.URL, "http://") {
+		return "", fmt.Errorf("not http URL: %q", c.URL)
+	}
+	return strings.TrimSuffix(c.URL, "/"), nil
+}
+
+func (c ConfigMapHTTP) RuntimeConfigs(ctx context.Context) (map[string]*cmdpb.RuntimeConfig, error) {
+	cm, err := c.configMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]*cmdpb.RuntimeConfig)
+	for _, rt := range cm.Runtimes {
+		if rt.ServiceAddr == "" {
+			rt.ServiceAddr = c.RemoteexecAddr
+		}
+		m[rt.Name] = rt
+	}
+	return m, nil
+}
+
+var errHTTPNotFound = errors.New("not found")
+
+// httpConfigClient fetches config data on HTTPS endpoint.
+type httpConfigClient struct {
+	client *http.Client
+	header http.Header
+}
+
+type httpConfigResp struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// seq returns seq of the response for change detection.
+func (r httpConfigResp) seq() string {
+	if r.etag != "" {
+		return r.etag
+	}
+	h := sha256.Sum256(r.data)
+	return hex.EncodeToString(h[:])
+}
+
+func (c httpConfigClient) get(ctx context.Context, u string) (httpConfigResp, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return httpConfigResp{}, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return httpConfigResp{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return httpConfigResp{}, fmt.Errorf("%s: %w", u, errHTTPNotFound)
+	default:
+		return httpConfigResp{}, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return httpConfigResp{}, fmt.Errorf("%s: %v", u, err)
+	}
+	r := httpConfigResp{
+		data: data,
+		etag: resp.Header.Get("ETag"),
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		r.lastModified, _ = http.ParseTime(lm)
+	}
+	return r, nil
+}
+
+// parseManifest parses manifest of runtime and returns descriptor names.
+// Empty lines and lines starting with '#' are ignored.
+func parseManifest(data []byte) []string {
+	var names []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names
+}
+
+// loadHTTPConfigs loads configs from HTTPS endpoint at <uri>/manifest.
+func loadHTTPConfigs(ctx context.Context, client httpConfigClient, uri string, rc *cmdpb.RuntimeConfig, platform *cmdpb.RemoteexecPlatform) ([]*cmdpb.Config, error) {
+	logger := log.FromContext(ctx)
+	start := time.Now()
+	manifest, err := client.get(ctx, uri+"/manifest")
+	if err != nil {
+		return nil, err
+	}
+	var confs []*cmdpb.Config
+	for _, name := range parseManifest(manifest.data) {
+		// name will be <prebuilts>/descriptors/<hash>
+		name = path.Clean(name)
+		if path.IsAbs(name) || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("bad descriptor %q in %s/manifest", name, uri)
+		}
+		if err := checkPrebuilt(rc, path.Join(rc.Name, name)); err != nil {
+			logger.Infof("prebuilt %s: %v", name, err)
+			continue
+		}
+		if path.Base(path.Dir(name)) != "descriptors" {
+			logger.Infof("ignore %s", name)
+			continue
+		}
+		u := uri + "/" + name
+		resp, err := client.get(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %v", u, err)
+		}
+		d := &cmdpb.CmdDescriptor{}
+		err = proto.Unmarshal(resp.data, d)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %v", u, err)
+		}
+		updated := resp.lastModified
+		if updated.IsZero() {
+			updated = manifest.lastModified
+		}
+		conf := newConfig(ctx, rc, platform, u, d, updated)
+		if conf == nil {
+			continue
+		}
+		logger.Infof("%s: %s", u, conf.CmdDescriptor.GetSelector())
+		confs = append(confs, conf)
+	}
+	logger.Infof("loaded from %s: %d configs using %v", uri, len(confs), time.Since(start))
+	return confs, nil
+}
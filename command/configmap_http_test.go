@@ -0,0 +1,142 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+func TestConfigMapHTTP(t *testing.T) {
+	ctx := context.Background()
+
+	desc := func(name string) []byte {
+		b, err := proto.Marshal(&cmdpb.CmdDescriptor{
+			Selector: &cmdpb.Selector{
+				Name:       name,
+				Version:    "1.0",
+				Target:     "x86_64-linux-gnu",
+				BinaryHash: name + "-hash",
+			},
+			Setup: &cmdpb.CmdDescriptor_Setup{
+				PathType: cmdpb.CmdDescriptor_POSIX,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	lastModified := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	files := map[string][]byte{
+		"/config/linux/manifest": []byte(`# descriptors of linux runtime
+clang/descriptors/clang-hash
+gcc/descriptors/gcc-hash
+clang/README
+`),
+		"/config/linux/clang/descriptors/clang-hash": desc("clang"),
+		"/config/linux/gcc/descriptors/gcc-hash":     desc("gcc"),
+	}
+	etag := `"v1"`
+	var gotAuth string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		b, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/config/linux/manifest" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Write(b)
+	}))
+	defer s.Close()
+
+	cm := ConfigMapHTTP{
+		URL: s.URL + "/config/",
+		ConfigMap: &cmdpb.ConfigMap{
+			Runtimes: []*cmdpb.RuntimeConfig{
+				{
+					Name:             "linux",
+					AllowedPrebuilts: []string{"clang"},
+				},
+				{
+					Name: "mac",
+				},
+			},
+		},
+		Header: http.Header{
+			"Authorization": []string{"Bearer token"},
+		},
+		RemoteexecAddr: "rbe.example.com",
+	}
+	seqs, err := cm.Seqs(ctx)
+	if err != nil || len(seqs) != 1 || seqs["linux"] != etag {
+		t.Errorf("Seqs=%v, %v; want linux:%s", seqs, err, etag)
+	}
+	if gotAuth != "Bearer token" {
+		t.Errorf("Authorization=%q; want %q", gotAuth, "Bearer token")
+	}
+
+	loader := &ConfigMapLoader{
+		ConfigMap: cm,
+	}
+	resp, err := loader.Load(ctx, false)
+	if err != nil {
+		t.Fatalf("Load=%v; want nil error", err)
+	}
+	if len(resp.Configs) != 1 {
+		t.Fatalf("Load=%v; want 1 config", resp.Configs)
+	}
+	conf := resp.Configs[0]
+	if got, want := conf.CmdDescriptor.GetSelector().GetName(), "clang"; got != want {
+		t.Errorf("config selector name=%q; want %q", got, want)
+	}
+	if got, want := conf.Target.GetAddr(), "rbe.example.com"; got != want {
+		t.Errorf("config target addr=%q; want %q", got, want)
+	}
+	if got := conf.BuildInfo.GetTimestamp().AsTime(); !got.Equal(lastModified) {
+		t.Errorf("config timestamp=%s; want %s", got, lastModified)
+	}
+
+	_, err = loader.Load(ctx, false)
+	if err != ErrNoUpdate {
+		t.Errorf("Load=%v; want %v", err, ErrNoUpdate)
+	}
+
+	etag = `"v2"`
+	_, err = loader.Load(ctx, false)
+	if err != nil {
+		t.Errorf("Load after etag change=%v; want nil error", err)
+	}
+
+	files["/config/linux/manifest"] = []byte("../../etc/passwd\n")
+	etag = `"v3"`
+	_, err = loader.Load(ctx, false)
+	if err == nil {
+		t.Errorf("Load with bad manifest=nil error; want error")
+	}
+}
+
+func TestHTTPConfigRespSeq(t *testing.T) {
+	r := httpConfigResp{data: []byte("foo")}
+	r2 := httpConfigResp{data: []byte("bar")}
+	if r.seq() == r2.seq() {
+		t.Errorf("seq without etag is same for different data: %q", r.seq())
+	}
+	r.etag = `"v1"`
+	if got, want := r.seq(), `"v1"`; got != want {
+		t.Errorf("seq=%q; want %q", got, want)
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.chromium.org/goma/server/command/registry"
+	"go.chromium.org/goma/server/log"
+)
+
+const (
+	// k8sServiceAccountDir is directory of service account credentials
+	// mounted in pod.
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// k8sWatchTimeout is timeout of a watch request.
+	// API server closes watch stream after the timeout, and watcher
+	// will start new watch request from the last resource version.
+	k8sWatchTimeout = 5 * time.Minute
+
+	// k8sWatchRetryDelay is delay to retry watch after error.
+	k8sWatchRetryDelay = 5 * time.Second
+)
+
+// K8sClient is a client of Kubernetes API server.
+type K8sClient struct {
+	// Server is URL of API server, e.g. https://kubernetes.default.svc.
+	Server string
+
+	// HTTPClient is used to access Server. http.DefaultClient if nil.
+	// It should not have timeout, since watch request is long-lived.
+	HTTPClient *http.Client
+
+	// TokenFile is a file of bearer token to access Server.
+	// It is read for each request, since service account token
+	// is rotated.
+	TokenFile string
+
+	// Namespace is namespace of the pod.
+	Namespace string
+}
+
+// NewK8sInClusterClient returns K8sClient to access API server
+// from pod with its service account.
+func NewK8sInClusterClient() (*K8sClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not in kubernetes cluster: KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT is not set")
+	}
+	ca, err := ioutil.ReadFile(path.Join(k8sServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate in %s/ca.crt", k8sServiceAccountDir)
+	}
+	ns, err := ioutil.ReadFile(path.Join(k8sServiceAccountDir, "namespace"))
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs: pool,
+	}
+	return &K8sClient{
+		Server: "https://" + net.JoinHostPort(host, port),
+		HTTPClient: &http.Client{
+			Transport: transport,
+		},
+		TokenFile: path.Join(k8sServiceAccountDir, "token"),
+		Namespace: strings.TrimSpace(string(ns)),
+	}, nil
+}
+
+// ObjectPath returns API path of object name.
+// If name is not absolute path, e.g. "configmaps/toolchain-seqs",
+// it is object in core API group in c.Namespace.
+func (c *K8sClient) ObjectPath(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return path.Join("/api/v1/namespaces", c.Namespace, name)
+}
+
+// k8sObject is a Kubernetes object that has data, e.g. ConfigMap.
+type k8sObject struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+
+	// Code is set in Status object for error.
+	Code int `json:"code"`
+}
+
+// k8sEvent is an event of watch API.
+type k8sEvent struct {
+	Type   string    `json:"type"`
+	Object k8sObject `json:"object"`
+}
+
+var errK8sNotFound = errors.New("not found")
+
+// errK8sGone is returned when watch resource version is too old.
+var errK8sGone = errors.New("resource version too old")
+
+func (c *K8sClient) do(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.Server, "/")+u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.TokenFile != "" {
+		token, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", u, errK8sNotFound)
+	case http.StatusGone:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", u, errK8sGone)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+}
+
+// get gets object at objPath.
+func (c *K8sClient) get(ctx context.Context, objPath string) (k8sObject, error) {
+	resp, err := c.do(ctx, objPath)
+	if err != nil {
+		return k8sObject{}, err
+	}
+	defer resp.Body.Close()
+	var obj k8sObject
+	err = json.NewDecoder(resp.Body).Decode(&obj)
+	if err != nil {
+		return k8sObject{}, fmt.Errorf("%s: %v", objPath, err)
+	}
+	return obj, nil
+}
+
+// watch watches object at objPath from resource version rv,
+// and calls f for each event until watch stream is closed.
+func (c *K8sClient) watch(ctx context.Context, objPath, rv string, f func(k8sEvent) error) error {
+	q := url.Values{}
+	q.Set("watch", "1")
+	q.Set("fieldSelector", "metadata.name="+path.Base(objPath))
+	q.Set("resourceVersion", rv)
+	q.Set("allowWatchBookmarks", "true")
+	q.Set("timeoutSeconds", fmt.Sprint(int(k8sWatchTimeout/time.Second)))
+	resp, err := c.do(ctx, path.Dir(objPath)+"?"+q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	d := json.NewDecoder(resp.Body)
+	for {
+		var ev k8sEvent
+		err := d.Decode(&ev)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("watch %s: %v", objPath, err)
+		}
+		if ev.Type == "ERROR" {
+			if ev.Object.Code == http.StatusGone {
+				return fmt.Errorf("watch %s: %w", objPath, errK8sGone)
+			}
+			return fmt.Errorf("watch %s: error code=%d", objPath, ev.Object.Code)
+		}
+		err = f(ev)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ConfigMapK8s is ConfigMap that watches seqs in Kubernetes object,
+// e.g. ConfigMap or custom resource, by Kubernetes watch API.
+// Seq updates propagate within seconds inside the cluster,
+// without cloud storage notification and pubsub.
+//
+// The object has seq of runtime in data, e.g.
+//
+//	apiVersion: v1
+//	kind: ConfigMap
+//	metadata:
+//	  name: toolchain-seqs
+//	data:
+//	  linux: "20221001-1"
+//
+// so that the config is updated by
+//
+//	kubectl patch configmap toolchain-seqs -p '{"data":{"linux":"20221001-2"}}'
+//
+// after uploading new configs to bucket of ConfigMap.
+// Service account of the pod needs get and watch permission of the object.
+// Bucket and RuntimeConfigs are provided by ConfigMap,
+// e.g. ConfigMapBucket without pubsub.
+type ConfigMapK8s struct {
+	ConfigMap
+
+	// Client is used to access Kubernetes API server.
+	Client *K8sClient
+
+	// Path is API path of the object, e.g.
+	// /api/v1/namespaces/<namespace>/configmaps/<name>.
+	Path string
+}
+
+// Watcher returns watcher of the object.
+func (c ConfigMapK8s) Watcher(ctx context.Context) ConfigMapWatcher {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &configMapK8sWatcher{
+		ch:     make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	go w.run(ctx, c)
+	return w
+}
+
+// Seqs returns seqs of runtimes in data of the object.
+// Runtimes that don't have seq in the object are ignored.
+func (c ConfigMapK8s) Seqs(ctx context.Context) (map[string]string, error) {
+	logger := log.FromContext(ctx)
+	obj, err := c.Client.get(ctx, c.Path)
+	if err != nil {
+		return nil, err
+	}
+	rcs, err := c.ConfigMap.RuntimeConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	for name, r := range rcs {
+		if r.RegistryRef != "" {
+			ref, err := registry.ParseReference(r.RegistryRef)
+			if err != nil {
+				return nil, fmt.Errorf("runtime %s: %v", name, err)
+			}
+			m[name] = ref.Digest
+			continue
+		}
+		seq, ok := obj.Data[name]
+		if !ok {
+			logger.Infof("ignore %s: no seq in %s", name, c.Path)
+			continue
+		}
+		m[name] = seq
+	}
+	return m, nil
+}
+
+type configMapK8sWatcher struct {
+	ch     chan struct{}
+	done   chan struct{}
+	cancel func()
+
+	closeOnce sync.Once
+}
+
+// notify notifies update to Next. pending notification is coalesced.
+func (w *configMapK8sWatcher) notify() {
+	select {
+	case w.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (w *configMapK8sWatcher) run(ctx context.Context, c ConfigMapK8s) {
+	logger := log.FromContext(ctx)
+	logger.Infof("watch start %s", c.Path)
+	var rv string
+	for ctx.Err() == nil {
+		if rv == "" {
+			obj, err := c.Client.get(ctx, c.Path)
+			if err != nil {
+				logger.Errorf("watch %s: %v", c.Path, err)
+				w.wait(ctx, k8sWatchRetryDelay)
+				continue
+			}
+			rv = obj.Metadata.ResourceVersion
+			// object may be updated while it was not watched.
+			w.notify()
+		}
+		err := c.Client.watch(ctx, c.Path, rv, func(ev k8sEvent) error {
+			rv = ev.Object.Metadata.ResourceVersion
+			switch ev.Type {
+			case "ADDED", "MODIFIED", "DELETED":
+				logger.Infof("%s %s resourceVersion:%s", c.Path, ev.Type, rv)
+				w.notify()
+			}
+			return nil
+		})
+		if errors.Is(err, errK8sGone) {
+			logger.Warnf("watch %s: %v", c.Path, err)
+			rv = ""
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Errorf("watch %s: %v", c.Path, err)
+			w.wait(ctx, k8sWatchRetryDelay)
+		}
+	}
+	logger.Infof("watch finished %s", c.Path)
+}
+
+func (w *configMapK8sWatcher) wait(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func (w *configMapK8sWatcher) Next(ctx context.Context) error {
+	select {
+	case <-w.done:
+		return ErrWatcherClosed
+	default:
+	}
+	select {
+	case <-w.ch:
+		return nil
+	case <-w.done:
+		return ErrWatcherClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *configMapK8sWatcher) Close() error {
+	ctx := context.Background()
+	logger := log.FromContext(ctx)
+	w.closeOnce.Do(func() {
+		logger.Infof("watcher close")
+		close(w.done)
+		w.cancel()
+	})
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+// fakeK8sServer serves a ConfigMap object and its watch events.
+type fakeK8sServer struct {
+	t      *testing.T
+	path   string
+	events chan k8sEvent
+
+	mu  sync.Mutex
+	obj k8sObject
+}
+
+func (s *fakeK8sServer) update(data map[string]string, rv string) {
+	s.mu.Lock()
+	s.obj.Data = data
+	s.obj.Metadata.ResourceVersion = rv
+	obj := s.obj
+	s.mu.Unlock()
+	s.events <- k8sEvent{
+		Type:   "MODIFIED",
+		Object: obj,
+	}
+}
+
+func (s *fakeK8sServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if got, want := req.Header.Get("Authorization"), "Bearer token"; got != want {
+		s.t.Errorf("Authorization=%q; want %q", got, want)
+	}
+	switch {
+	case req.URL.Path == s.path:
+		s.mu.Lock()
+		obj := s.obj
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(obj)
+	case req.URL.Path == filepath.Dir(s.path) && req.URL.Query().Get("watch") == "1":
+		if got, want := req.URL.Query().Get("fieldSelector"), "metadata.name="+filepath.Base(s.path); got != want {
+			s.t.Errorf("fieldSelector=%q; want %q", got, want)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case ev := <-s.events:
+				enc.Encode(ev)
+				w.(http.Flusher).Flush()
+			}
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestConfigMapK8s(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	b, err := proto.Marshal(&cmdpb.CmdDescriptor{
+		Selector: &cmdpb.Selector{
+			Name:       "clang",
+			Version:    "1.0",
+			Target:     "x86_64-linux-gnu",
+			BinaryHash: "clang-hash",
+		},
+		Setup: &cmdpb.CmdDescriptor_Setup{
+			PathType: cmdpb.CmdDescriptor_POSIX,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "linux", "clang", "descriptors", "clang-hash"), b)
+	tokenFile := filepath.Join(dir, "token")
+	writeFile(t, tokenFile, []byte("token\n"))
+
+	fake := &fakeK8sServer{
+		t:      t,
+		path:   "/api/v1/namespaces/goma/configmaps/toolchain-seqs",
+		events: make(chan k8sEvent),
+	}
+	fake.obj.Metadata.Name = "toolchain-seqs"
+	fake.obj.Metadata.ResourceVersion = "1"
+	fake.obj.Data = map[string]string{
+		"linux": "1",
+		"other": "1",
+	}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	client := &K8sClient{
+		Server:    s.URL,
+		TokenFile: tokenFile,
+		Namespace: "goma",
+	}
+	cm := ConfigMapK8s{
+		ConfigMap: ConfigMapDir{
+			Dir: dir,
+			ConfigMap: &cmdpb.ConfigMap{
+				Runtimes: []*cmdpb.RuntimeConfig{
+					{
+						Name: "linux",
+					},
+					{
+						Name: "mac",
+					},
+				},
+			},
+			RemoteexecAddr: "rbe.example.com",
+		},
+		Client: client,
+		Path:   client.ObjectPath("configmaps/toolchain-seqs"),
+	}
+	if cm.Path != fake.path {
+		t.Errorf("ObjectPath=%q; want %q", cm.Path, fake.path)
+	}
+	seqs, err := cm.Seqs(ctx)
+	if err != nil || len(seqs) != 1 || seqs["linux"] != "1" {
+		t.Errorf("Seqs=%v, %v; want linux:1", seqs, err)
+	}
+
+	w := cm.Watcher(ctx)
+	defer w.Close()
+	wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	// initial notification after the object is fetched.
+	err = w.Next(wctx)
+	if err != nil {
+		t.Fatalf("Next=%v; want nil error", err)
+	}
+
+	loader := &ConfigMapLoader{
+		ConfigMap: cm,
+	}
+	resp, err := loader.Load(ctx, false)
+	if err != nil {
+		t.Fatalf("Load=%v; want nil error", err)
+	}
+	if len(resp.Configs) != 1 {
+		t.Fatalf("Load=%v; want 1 config", resp.Configs)
+	}
+	_, err = loader.Load(ctx, false)
+	if err != ErrNoUpdate {
+		t.Errorf("Load=%v; want %v", err, ErrNoUpdate)
+	}
+
+	fake.update(map[string]string{"linux": "2"}, "2")
+	err = w.Next(wctx)
+	if err != nil {
+		t.Fatalf("Next=%v; want nil error", err)
+	}
+	_, err = loader.Load(ctx, false)
+	if err != nil {
+		t.Errorf("Load after seq update=%v; want nil error", err)
+	}
+
+	w.Close()
+	err = w.Next(ctx)
+	if !errors.Is(err, ErrWatcherClosed) {
+		t.Errorf("Next after Close=%v; want %v", err, ErrWatcherClosed)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/command/registry"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+	"go.chromium.org/goma/server/testing/fakegcs"
+	"go.chromium.org/goma/server/testing/fakepubsub"
+	"go.chromium.org/goma/server/testing/fakeregistry"
+)
+
+const (
+	notificationTestProject = "project"
+	notificationTestBucket  = "project-toolchain-config"
+)
+
+// setupNotification sets up bucket with storage notification to
+// pubsub topic, and returns ConfigMapBucket to watch it.
+func setupNotification(ctx context.Context, t *testing.T) (ConfigMapBucket, *fakegcs.Server, *fakepubsub.Server) {
+	t.Helper()
+	ps := fakepubsub.NewServer(t)
+	gcs := fakegcs.NewServer(t)
+	gcs.Publisher = ps
+
+	gcs.CreateBucket(notificationTestBucket)
+	gcs.AddNotification(notificationTestBucket, notificationTestProject, notificationTestBucket)
+	ps.CreateTopic(ctx, notificationTestProject, notificationTestBucket)
+
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint(gcs.Endpoint()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return ConfigMapBucket{
+		URI:           "gs://" + notificationTestBucket + "/",
+		PubsubClient:  ps.Client(ctx, notificationTestProject),
+		StorageClient: stiface.AdaptClient(client),
+		SubscriberID:  "test-subscriber",
+	}, gcs, ps
+}
+
+func TestConfigMapBucketNotification(t *testing.T) {
+	ctx := context.Background()
+	c, gcs, ps := setupNotification(ctx, t)
+
+	// subscription will be created by watcher.
+	err := c.VerifyNotification(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatalf("VerifyNotification=%v; want nil error", err)
+	}
+
+	w, err := c.pubsubWatcher(ctx)
+	if err != nil {
+		t.Fatalf("pubsubWatcher=_, %v; want nil error", err)
+	}
+	defer w.Close()
+
+	err = c.VerifyNotification(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatalf("VerifyNotification=%v; want nil error", err)
+	}
+	if msgs := ps.Messages(); len(msgs) != 0 {
+		t.Errorf("VerifyNotification published %d messages; want no messages", len(msgs))
+	}
+
+	gcs.PutObject(notificationTestBucket, "linux/seq", []byte("1"))
+	nctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = w.Next(nctx)
+	if err != nil {
+		t.Errorf("watcher Next=%v; want nil error", err)
+	}
+}
+
+func TestConfigMapBucketNotificationError(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no notification", func(t *testing.T) {
+		c, gcs, _ := setupNotification(ctx, t)
+		gcs.CreateBucket("other-bucket")
+		c.URI = "gs://other-bucket/"
+		err := c.VerifyNotification(ctx, 10*time.Second)
+		if err == nil {
+			t.Errorf("VerifyNotification=nil error; want error")
+		}
+	})
+
+	t.Run("no finalize event", func(t *testing.T) {
+		c, gcs, ps := setupNotification(ctx, t)
+		const bucket = "delete-only"
+		gcs.CreateBucket(bucket)
+		ps.CreateTopic(ctx, notificationTestProject, bucket)
+		_, err := c.StorageClient.Bucket(bucket).AddNotification(ctx, &storage.Notification{
+			TopicProjectID: notificationTestProject,
+			TopicID:        bucket,
+			PayloadFormat:  storage.JSONPayload,
+			EventTypes:     []string{storage.ObjectDeleteEvent},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.URI = "gs://" + bucket + "/"
+		err = c.VerifyNotification(ctx, 10*time.Second)
+		if err == nil {
+			t.Errorf("VerifyNotification=nil error; want error")
+		}
+	})
+
+	t.Run("topic mismatch", func(t *testing.T) {
+		c, _, ps := setupNotification(ctx, t)
+		other := ps.CreateTopic(ctx, notificationTestProject, "other-topic")
+		_, err := c.PubsubClient.CreateSubscription(ctx, c.SubscriberID, pubsub.SubscriptionConfig{
+			Topic: other,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.VerifyNotification(ctx, 10*time.Second)
+		if err == nil {
+			t.Errorf("VerifyNotification=nil error; want error")
+		}
+	})
+}
+
+func TestConfigLoaderRegistry(t *testing.T) {
+	ctx := context.Background()
+	s := fakeregistry.NewServer(t)
+	const repo = "project/toolchain/toolchain-config"
+
+	descriptor := func(name string, pathType cmdpb.CmdDescriptor_PathType) []byte {
+		b, err := proto.Marshal(&cmdpb.CmdDescriptor{
+			Selector: &cmdpb.Selector{
+				Name:       name,
+				BinaryHash: name + "-hash",
+			},
+			Setup: &cmdpb.CmdDescriptor_Setup{
+				PathType: pathType,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	layer := func(title string, data []byte, annotations ...string) registry.Descriptor {
+		d := registry.Descriptor{
+			MediaType: "application/octet-stream",
+			Digest:    s.PutBlob(repo, data),
+			Size:      int64(len(data)),
+			Annotations: map[string]string{
+				registry.AnnotationTitle: title,
+			},
+		}
+		for i := 0; i+1 < len(annotations); i += 2 {
+			d.Annotations[annotations[i]] = annotations[i+1]
+		}
+		return d
+	}
+	digest := s.PutManifest(repo, &registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeImageManifest,
+		Config: registry.Descriptor{
+			MediaType: "application/vnd.oci.empty.v1+json",
+			Digest:    s.PutBlob(repo, []byte("{}")),
+			Size:      2,
+		},
+		Layers: []registry.Descriptor{
+			layer("clang/descriptors/1", descriptor("clang", cmdpb.CmdDescriptor_POSIX)),
+			layer("clang/descriptors/2", descriptor("clang++", cmdpb.CmdDescriptor_POSIX), registry.AnnotationCreated, "2022-10-02T00:00:00Z"),
+			layer("clang/descriptors/3", descriptor("unknown", cmdpb.CmdDescriptor_UNKNOWN_PATH_TYPE)),
+			layer("gcc/descriptors/1", descriptor("gcc", cmdpb.CmdDescriptor_POSIX)),
+			layer("clang/README", []byte("readme")),
+		},
+		Annotations: map[string]string{
+			registry.AnnotationCreated: "2022-10-01T00:00:00Z",
+		},
+	})
+	s.RequireAuth("oauth2accesstoken", "token")
+
+	rc := &cmdpb.RuntimeConfig{
+		Name:             "linux",
+		ServiceAddr:      "rbe.example.com",
+		AllowedPrebuilts: []string{"clang"},
+		RegistryRef:      s.Host() + "/" + repo + "@" + digest,
+	}
+	cm := ConfigMapBucket{
+		URI: "gs://toolchain-config/",
+		ConfigMap: &cmdpb.ConfigMap{
+			Runtimes: []*cmdpb.RuntimeConfig{rc},
+		},
+	}
+	seqs, err := cm.Seqs(ctx)
+	if err != nil || seqs["linux"] != digest {
+		t.Errorf("Seqs=%v, %v; want linux:%s", seqs, err, digest)
+	}
+
+	loader := ConfigLoader{
+		RegistryClient: &registry.Client{
+			HTTPClient: s.Client(),
+			Credential: func(ctx context.Context, registry string) (string, string, error) {
+				return "oauth2accesstoken", "token", nil
+			},
+		},
+		EnableParallel: true,
+	}
+	confs, err := loader.Load(ctx, "oci://"+rc.RegistryRef, rc)
+	if err != nil {
+		t.Fatalf("Load=%v; want nil error", err)
+	}
+	var got []string
+	for _, c := range confs {
+		got = append(got, fmt.Sprintf("%s %s %s", c.CmdDescriptor.GetSelector().GetName(), c.Target.GetAddr(), c.BuildInfo.GetTimestamp().AsTime().Format(time.RFC3339)))
+	}
+	want := []string{
+		"clang rbe.example.com 2022-10-01T00:00:00Z",
+		"clang++ rbe.example.com 2022-10-02T00:00:00Z",
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("Load=%q; want %q", got, want)
+	}
+
+	_, err = loader.Load(ctx, "oci://"+s.Host()+"/"+repo+":latest", rc)
+	if err == nil {
+		t.Errorf("Load(tag)=nil error; want error for not pinned reference")
+	}
+}
+
+func TestConfigLoaderDescriptorCache(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	bkt := s.createBucket("toolchain-config")
+
+	descriptor := func(name string) []byte {
+		t.Helper()
+		b, err := proto.Marshal(&cmdpb.CmdDescriptor{
+			Selector: &cmdpb.Selector{
+				Name: name,
+			},
+			Setup: &cmdpb.CmdDescriptor_Setup{
+				PathType: cmdpb.CmdDescriptor_POSIX,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	ts := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+	bkt.store("linux/clang/descriptors/1", descriptor("clang"), ts)
+	bkt.store("linux/clang/descriptors/2", descriptor("clang++"), ts)
+
+	rc := &cmdpb.RuntimeConfig{
+		Name:        "linux",
+		ServiceAddr: "rbe.example.com",
+	}
+	loader := ConfigLoader{
+		StorageClient:  s,
+		EnableParallel: true,
+	}
+	load := func(want []string) {
+		t.Helper()
+		confs, err := loader.Load(ctx, "gs://toolchain-config/linux", rc)
+		if err != nil {
+			t.Fatalf("Load=%v; want nil error", err)
+		}
+		var got []string
+		for _, c := range confs {
+			got = append(got, c.CmdDescriptor.GetSelector().GetName())
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("Load=%q; want %q", got, want)
+		}
+	}
+	reads := func(name string) int32 {
+		return bkt.objs[name].reads
+	}
+
+	load([]string{"clang", "clang++"})
+	for _, name := range []string{"linux/clang/descriptors/1", "linux/clang/descriptors/2"} {
+		if got, want := reads(name), int32(1); got != want {
+			t.Errorf("reads(%s)=%d; want %d", name, got, want)
+		}
+	}
+
+	bkt.store("linux/clang/descriptors/2", descriptor("clang++-2"), ts.Add(time.Hour))
+	load([]string{"clang", "clang++-2"})
+	if got, want := reads("linux/clang/descriptors/1"), int32(1); got != want {
+		t.Errorf("reads(unchanged)=%d; want %d", got, want)
+	}
+	if got, want := reads("linux/clang/descriptors/2"), int32(1); got != want {
+		t.Errorf("reads(updated)=%d; want %d", got, want)
+	}
+}
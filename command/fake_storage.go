@@ -7,10 +7,12 @@ package command
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -20,17 +22,44 @@ import (
 
 type fakeObject struct {
 	stiface.ObjectHandle
-	data    []byte
-	updated time.Time
+	data       []byte
+	updated    time.Time
+	generation int64
+
+	// reads is number of NewReader calls.
+	reads int32
+}
+
+func (o *fakeObject) If(cond storage.Conditions) stiface.ObjectHandle {
+	return &fakeCondObject{
+		ObjectHandle: o,
+		obj:          o,
+		cond:         cond,
+	}
 }
 
 func (o *fakeObject) NewReader(context.Context) (stiface.Reader, error) {
+	atomic.AddInt32(&o.reads, 1)
 	return &fakeObjectReader{
 		size: len(o.data),
 		rc:   ioutil.NopCloser(bytes.NewReader(o.data)),
 	}, nil
 }
 
+// fakeCondObject is an object handle with preconditions.
+type fakeCondObject struct {
+	stiface.ObjectHandle
+	obj  *fakeObject
+	cond storage.Conditions
+}
+
+func (o *fakeCondObject) NewReader(ctx context.Context) (stiface.Reader, error) {
+	if o.cond.GenerationMatch != 0 && o.cond.GenerationMatch != o.obj.generation {
+		return nil, fmt.Errorf("generation=%d; want %d: precondition failed", o.obj.generation, o.cond.GenerationMatch)
+	}
+	return o.obj.NewReader(ctx)
+}
+
 type fakeObjectReader struct {
 	stiface.Reader
 	size int
@@ -63,7 +92,8 @@ func (o *fakeObjIter) Next() (*storage.ObjectAttrs, error) {
 
 type fakeStorageBucket struct {
 	stiface.BucketHandle
-	objs map[string]*fakeObject
+	objs       map[string]*fakeObject
+	generation int64
 }
 
 func newFakeStorageBucket() *fakeStorageBucket {
@@ -72,10 +102,13 @@ func newFakeStorageBucket() *fakeStorageBucket {
 	}
 }
 
+// store stores data in obj as new generation.
 func (sb *fakeStorageBucket) store(obj string, data []byte, ts time.Time) {
+	sb.generation++
 	sb.objs[obj] = &fakeObject{
-		data:    data,
-		updated: ts,
+		data:       data,
+		updated:    ts,
+		generation: sb.generation,
 	}
 }
 
@@ -106,8 +139,9 @@ func (sb *fakeStorageBucket) Objects(ctx context.Context, query *storage.Query)
 		}
 		obj := sb.objs[name]
 		iter.attrs = append(iter.attrs, &storage.ObjectAttrs{
-			Name:    name,
-			Updated: obj.updated,
+			Name:       name,
+			Updated:    obj.updated,
+			Generation: obj.generation,
 		})
 	}
 	return iter
@@ -0,0 +1,371 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package registry provides a client to pull OCI artifacts from
+// a container registry, by the OCI distribution API.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+//
+// Artifacts are always pulled by digest, and contents are verified
+// with the digest, so a config pinned by digest can't be changed
+// in the registry.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MediaTypeImageManifest is media type of OCI image manifest.
+const MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+
+// Annotation keys.
+// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+const (
+	AnnotationTitle   = "org.opencontainers.image.title"
+	AnnotationCreated = "org.opencontainers.image.created"
+)
+
+// maxManifestSize is max size of manifest to read.
+const maxManifestSize = 4 << 20
+
+// Reference is a reference to an artifact in a registry, pinned by digest.
+type Reference struct {
+	// Registry is host[:port] of the registry.
+	// e.g. us-docker.pkg.dev
+	Registry string
+
+	// Repository is repository name in the registry.
+	// e.g. project/repo/toolchain-config
+	Repository string
+
+	// Digest is digest of the manifest, e.g. sha256:<hex>.
+	Digest string
+}
+
+// String returns reference in <registry>/<repository>@<digest> form.
+func (r Reference) String() string {
+	return fmt.Sprintf("%s/%s@%s", r.Registry, r.Repository, r.Digest)
+}
+
+// ParseReference parses ref in <registry>/<repository>@sha256:<hex> form.
+// It returns error if ref is not pinned by digest, e.g. by tag.
+func ParseReference(ref string) (Reference, error) {
+	i := strings.Index(ref, "@")
+	if i < 0 {
+		return Reference{}, fmt.Errorf("reference %q: not pinned by digest", ref)
+	}
+	name, digest := ref[:i], ref[i+1:]
+	if err := validDigest(digest); err != nil {
+		return Reference{}, fmt.Errorf("reference %q: %v", ref, err)
+	}
+	p := strings.SplitN(name, "/", 2)
+	if len(p) != 2 || p[0] == "" || p[1] == "" {
+		return Reference{}, fmt.Errorf("reference %q: want <registry>/<repository>@<digest>", ref)
+	}
+	if strings.Contains(p[1], ":") {
+		return Reference{}, fmt.Errorf("reference %q: tag is not allowed with digest", ref)
+	}
+	return Reference{
+		Registry:   p[0],
+		Repository: p[1],
+		Digest:     digest,
+	}, nil
+}
+
+func validDigest(digest string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %q: want sha256:<hex>", digest)
+	}
+	h := digest[len("sha256:"):]
+	if len(h) != sha256.Size*2 {
+		return fmt.Errorf("bad digest %q: wrong length", digest)
+	}
+	if _, err := hex.DecodeString(h); err != nil {
+		return fmt.Errorf("bad digest %q: %v", digest, err)
+	}
+	return nil
+}
+
+func verifyDigest(digest string, data []byte) error {
+	h := sha256.Sum256(data)
+	if got := "sha256:" + hex.EncodeToString(h[:]); got != digest {
+		return fmt.Errorf("digest mismatch: got %s, want %s", got, digest)
+	}
+	return nil
+}
+
+// Descriptor describes content in a manifest.
+// https://github.com/opencontainers/image-spec/blob/main/descriptor.md
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+// https://github.com/opencontainers/image-spec/blob/main/manifest.md
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Client is a client of registries.
+type Client struct {
+	// HTTPClient is used to access registries.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Credential returns username and password for registry.
+	// It is used for basic auth, or to get bearer token from
+	// the token server of the registry.
+	// e.g. "oauth2accesstoken" and access token for Artifact Registry.
+	// If nil, access registries anonymously.
+	Credential func(ctx context.Context, registry string) (username, password string, err error)
+
+	mu     sync.Mutex
+	tokens map[string]string // key: registry/repository
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// Manifest fetches manifest of ref.
+func (c *Client) Manifest(ctx context.Context, ref Reference) (*Manifest, error) {
+	buf, err := c.get(ctx, ref, "manifests/"+ref.Digest, maxManifestSize, MediaTypeImageManifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDigest(ref.Digest, buf); err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", ref, err)
+	}
+	m := &Manifest{}
+	err = json.Unmarshal(buf, m)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", ref, err)
+	}
+	if m.SchemaVersion != 2 {
+		return nil, fmt.Errorf("manifest %s: unsupported schema version %d", ref, m.SchemaVersion)
+	}
+	if m.MediaType != "" && m.MediaType != MediaTypeImageManifest {
+		return nil, fmt.Errorf("manifest %s: unsupported media type %q", ref, m.MediaType)
+	}
+	return m, nil
+}
+
+// Blob fetches blob of desc in ref's repository.
+func (c *Client) Blob(ctx context.Context, ref Reference, desc Descriptor) ([]byte, error) {
+	if err := validDigest(desc.Digest); err != nil {
+		return nil, err
+	}
+	buf, err := c.get(ctx, ref, "blobs/"+desc.Digest, desc.Size, "")
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) != desc.Size {
+		return nil, fmt.Errorf("blob %s: size mismatch: got %d, want %d", desc.Digest, len(buf), desc.Size)
+	}
+	if err := verifyDigest(desc.Digest, buf); err != nil {
+		return nil, fmt.Errorf("blob %s: %v", desc.Digest, err)
+	}
+	return buf, nil
+}
+
+// get gets /v2/<repository>/<p> in ref's registry.
+// It reads at most limit bytes.
+func (c *Client) get(ctx context.Context, ref Reference, p string, limit int64, accept string) ([]byte, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.Registry, ref.Repository, p)
+	key := ref.Registry + "/" + ref.Repository
+	resp, err := c.do(ctx, u, accept, c.authorization(key))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+		auth, err := c.authorize(ctx, ref, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", u, err)
+		}
+		c.mu.Lock()
+		if c.tokens == nil {
+			c.tokens = make(map[string]string)
+		}
+		c.tokens[key] = auth
+		c.mu.Unlock()
+		resp, err = c.do(ctx, u, accept, auth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s: %s", u, resp.Status, bytes.TrimSpace(msg))
+	}
+	// read one more byte to detect too large response.
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", u, err)
+	}
+	if int64(len(buf)) > limit {
+		return nil, fmt.Errorf("%s: too large response: > %d", u, limit)
+	}
+	return buf, nil
+}
+
+func (c *Client) authorization(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[key]
+}
+
+func (c *Client) do(ctx context.Context, u, accept, auth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return c.httpClient().Do(req)
+}
+
+// authorize returns Authorization header value for the challenge.
+// https://distribution.github.io/distribution/spec/auth/token/
+func (c *Client) authorize(ctx context.Context, ref Reference, challenge string) (string, error) {
+	var username, password string
+	if c.Credential != nil {
+		var err error
+		username, password, err = c.Credential(ctx, ref.Registry)
+		if err != nil {
+			return "", fmt.Errorf("credential for %s: %v", ref.Registry, err)
+		}
+	}
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.Credential == nil {
+			return "", errors.New("basic auth required, but no credential")
+		}
+		req := &http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(username, password)
+		return req.Header.Get("Authorization"), nil
+
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return "", fmt.Errorf("no realm in challenge %q", challenge)
+		}
+		u, err := url.Parse(realm)
+		if err != nil {
+			return "", fmt.Errorf("bad realm in challenge %q: %v", challenge, err)
+		}
+		q := u.Query()
+		if service := params["service"]; service != "" {
+			q.Set("service", service)
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+		}
+		q.Set("scope", scope)
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if c.Credential != nil {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token %s: %s", realm, resp.Status)
+		}
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token)
+		if err != nil {
+			return "", fmt.Errorf("token %s: %v", realm, err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return "", fmt.Errorf("token %s: empty token", realm)
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", fmt.Errorf("unsupported auth challenge %q", challenge)
+}
+
+// parseChallenge parses WWW-Authenticate header value, e.g.
+//
+//	Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(challenge string) (string, map[string]string) {
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, nil
+	}
+	scheme, s := challenge[:i], challenge[i+1:]
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return scheme, params
+		}
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return scheme, params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = s[i+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			j := strings.Index(s[1:], `"`)
+			if j < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:j+1], s[j+2:]
+			}
+		} else {
+			j := strings.Index(s, ",")
+			if j < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:j], s[j:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.chromium.org/goma/server/testing/fakeregistry"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := fakeregistry.Digest([]byte("manifest"))
+	for _, tc := range []struct {
+		ref     string
+		want    Reference
+		wantErr bool
+	}{
+		{
+			ref: "us-docker.pkg.dev/project/repo/toolchain-config@" + digest,
+			want: Reference{
+				Registry:   "us-docker.pkg.dev",
+				Repository: "project/repo/toolchain-config",
+				Digest:     digest,
+			},
+		},
+		{
+			ref: "localhost:5000/toolchain@" + digest,
+			want: Reference{
+				Registry:   "localhost:5000",
+				Repository: "toolchain",
+				Digest:     digest,
+			},
+		},
+		{
+			ref:     "us-docker.pkg.dev/project/repo/toolchain-config:latest",
+			wantErr: true,
+		},
+		{
+			ref:     "us-docker.pkg.dev/project/repo/toolchain-config:latest@" + digest,
+			wantErr: true,
+		},
+		{
+			ref:     "toolchain-config@" + digest,
+			wantErr: true,
+		},
+		{
+			ref:     "us-docker.pkg.dev/toolchain-config@sha256:1234",
+			wantErr: true,
+		},
+		{
+			ref:     "us-docker.pkg.dev/toolchain-config@md5:d41d8cd98f00b204e9800998ecf8427e",
+			wantErr: true,
+		},
+	} {
+		got, err := ParseReference(tc.ref)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseReference(%q)=%v, nil; want error", tc.ref, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseReference(%q)=%v, %v; want %v, nil", tc.ref, got, err, tc.want)
+		}
+		if got.String() != tc.ref {
+			t.Errorf("ParseReference(%q).String()=%q; want %q", tc.ref, got.String(), tc.ref)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := fakeregistry.NewServer(t)
+	const repo = "project/repo/toolchain-config"
+	layer := []byte("cmd descriptor")
+	manifest := &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		Config: Descriptor{
+			MediaType: "application/vnd.oci.empty.v1+json",
+			Digest:    s.PutBlob(repo, []byte("{}")),
+			Size:      2,
+		},
+		Layers: []Descriptor{
+			{
+				MediaType: "application/octet-stream",
+				Digest:    s.PutBlob(repo, layer),
+				Size:      int64(len(layer)),
+				Annotations: map[string]string{
+					AnnotationTitle: "clang/descriptors/1234",
+				},
+			},
+		},
+	}
+	ref := Reference{
+		Registry:   s.Host(),
+		Repository: repo,
+		Digest:     s.PutManifest(repo, manifest),
+	}
+	s.RequireAuth("oauth2accesstoken", "access-token")
+
+	anonymous := &Client{HTTPClient: s.Client()}
+	_, err := anonymous.Manifest(ctx, ref)
+	if err == nil {
+		t.Errorf("Manifest(%s) without credential=nil error; want error", ref)
+	}
+
+	tokenRequests := func() int {
+		n := 0
+		for _, p := range s.Requests() {
+			if p == "/token" {
+				n++
+			}
+		}
+		return n
+	}
+	anonymousTokenRequests := tokenRequests()
+
+	c := &Client{
+		HTTPClient: s.Client(),
+		Credential: func(ctx context.Context, registry string) (string, string, error) {
+			if registry != s.Host() {
+				return "", "", errors.New("unknown registry")
+			}
+			return "oauth2accesstoken", "access-token", nil
+		},
+	}
+	got, err := c.Manifest(ctx, ref)
+	if err != nil {
+		t.Fatalf("Manifest(%s)=%v; want nil error", ref, err)
+	}
+	if !cmp.Equal(got, manifest) {
+		t.Errorf("Manifest(%s)=%#v; want %#v", ref, got, manifest)
+	}
+	buf, err := c.Blob(ctx, ref, got.Layers[0])
+	if err != nil || string(buf) != string(layer) {
+		t.Errorf("Blob(%s)=%q, %v; want %q, nil", got.Layers[0].Digest, buf, err, layer)
+	}
+	if n := tokenRequests() - anonymousTokenRequests; n != 1 {
+		t.Errorf("token requests=%d; want 1 (token should be reused). requests=%q", n, s.Requests())
+	}
+
+	bad := got.Layers[0]
+	bad.Digest = s.PutBlob(repo, []byte("other"))
+	_, err = c.Blob(ctx, ref, bad)
+	if err == nil {
+		t.Errorf("Blob(%s) with wrong size=nil error; want error", bad.Digest)
+	}
+
+	missing := ref
+	missing.Digest = fakeregistry.Digest([]byte("missing"))
+	_, err = c.Manifest(ctx, missing)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Manifest(%s)=%v; want not found error", missing, err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`)
+	if scheme != "Bearer" {
+		t.Errorf("scheme=%q; want Bearer", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull",
+	}
+	if !cmp.Equal(params, want) {
+		t.Errorf("params=%v; want %v", params, want)
+	}
+}
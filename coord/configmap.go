@@ -0,0 +1,103 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package coord
+
+import (
+	"context"
+	"sync"
+
+	"go.chromium.org/goma/server/command"
+	"go.chromium.org/goma/server/log"
+)
+
+// ConfigMap is command.ConfigMap to roll out toolchain config
+// coordinated with other clusters.
+//
+// If the cluster is the leader, Seqs publishes seqs of ConfigMap to
+// State. Otherwise, Seqs holds back seq of a runtime until the leader
+// publishes the same seq, so that all clusters roll out the same
+// toolchain config. If no seq is published for a runtime (e.g. no
+// leader), seq of ConfigMap is used.
+//
+// Watcher is also notified when seqs are published by the leader.
+type ConfigMap struct {
+	command.ConfigMap
+	Coordinator *Coordinator
+
+	mu       sync.Mutex
+	accepted map[string]string
+}
+
+// Watcher returns watcher of ConfigMap and State.
+func (c *ConfigMap) Watcher(ctx context.Context) command.ConfigMapWatcher {
+	return configMapWatcher{
+		w: c.ConfigMap.Watcher(ctx),
+		c: c.Coordinator,
+	}
+}
+
+// Seqs returns seqs to roll out.
+func (c *ConfigMap) Seqs(ctx context.Context) (map[string]string, error) {
+	logger := log.FromContext(ctx)
+	seqs, err := c.ConfigMap.Seqs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.Coordinator.IsLeader() {
+		err = c.Coordinator.PublishConfigSeqs(ctx, seqs)
+		if err == nil {
+			return seqs, nil
+		}
+		logger.Warnf("coord: failed to publish config seqs: %v", err)
+	}
+	published := c.Coordinator.State().ConfigSeqs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accepted == nil {
+		c.accepted = make(map[string]string)
+	}
+	m := make(map[string]string)
+	for name, seq := range seqs {
+		pseq, ok := published[name]
+		if !ok || pseq == seq {
+			c.accepted[name] = seq
+			m[name] = seq
+			continue
+		}
+		aseq, ok := c.accepted[name]
+		if !ok {
+			logger.Infof("coord: %s seq %s is not rolled out yet (published:%s)", name, seq, pseq)
+			continue
+		}
+		logger.Infof("coord: %s holds seq %s until %s is rolled out (published:%s)", name, aseq, seq, pseq)
+		m[name] = aseq
+	}
+	return m, nil
+}
+
+type configMapWatcher struct {
+	w command.ConfigMapWatcher
+	c *Coordinator
+}
+
+func (w configMapWatcher) Next(ctx context.Context) error {
+	updated := w.c.Updated()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- w.w.Next(ctx)
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-updated:
+		return nil
+	}
+}
+
+func (w configMapWatcher) Close() error {
+	return w.w.Close()
+}
@@ -0,0 +1,294 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+/*
+Package coord coordinates active-active goma clusters.
+
+Clusters share global State in a Store (e.g. cloud storage object),
+updated with optimistic concurrency control.
+A cluster holding the lease is the leader, which rolls out toolchain
+config to all clusters: other clusters follow config seqs published
+by the leader, so that clusters in different regions won't serve
+different toolchains (split-brain) while a rollout is in progress.
+State also has cache namespace version, to invalidate cache in all
+clusters at once.
+
+State in GCSStore is a JSON object, so operators can edit it with
+gsutil, e.g. to bump cache_namespace_version. Servers pick up new
+cache namespace version when restarted.
+*/
+package coord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// DefaultLeaseDuration is default duration of leader's lease.
+const DefaultLeaseDuration = 1 * time.Minute
+
+// State is global state shared by clusters.
+type State struct {
+	// Leader is a cluster that holds the lease.
+	Leader string `json:"leader,omitempty"`
+
+	// LeaseExpire is expiration time of the lease.
+	LeaseExpire time.Time `json:"lease_expire,omitempty"`
+
+	// ConfigSeqs is toolchain config seqs per runtime
+	// rolled out by the leader.
+	ConfigSeqs map[string]string `json:"config_seqs,omitempty"`
+
+	// CacheNamespaceVersion is version of cache namespace.
+	// Bumping it invalidates cache of all clusters.
+	CacheNamespaceVersion string `json:"cache_namespace_version,omitempty"`
+}
+
+// ErrConflict indicates state was updated by others.
+var ErrConflict = errors.New("coord: state conflict")
+
+// Store stores State with optimistic concurrency control.
+type Store interface {
+	// Get gets current state and its generation.
+	// It returns zero State and 0 generation if no state is stored.
+	Get(ctx context.Context) (State, int64, error)
+
+	// Put puts state if current generation is gen.
+	// It returns ErrConflict if generation doesn't match.
+	Put(ctx context.Context, state State, gen int64) error
+}
+
+// Coordinator coordinates the cluster with other clusters by State
+// in Store.
+type Coordinator struct {
+	Store Store
+
+	// Cluster is name of the cluster. Servers in the same cluster
+	// share the lease.
+	// If empty, it never becomes the leader, and just follows State.
+	Cluster string
+
+	// LeaseDuration is duration of the lease.
+	// DefaultLeaseDuration if 0.
+	LeaseDuration time.Duration
+
+	// for test
+	now func() time.Time
+
+	mu      sync.Mutex
+	state   State
+	updated chan struct{}
+}
+
+func (c *Coordinator) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Coordinator) leaseDuration() time.Duration {
+	if c.LeaseDuration > 0 {
+		return c.LeaseDuration
+	}
+	return DefaultLeaseDuration
+}
+
+// State returns latest State synced from Store.
+func (c *Coordinator) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// IsLeader reports whether the cluster holds the lease.
+func (c *Coordinator) IsLeader() bool {
+	if c.Cluster == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Leader == c.Cluster && c.timeNow().Before(c.state.LeaseExpire)
+}
+
+// Updated returns a channel that is closed when ConfigSeqs
+// in State is updated.
+func (c *Coordinator) Updated() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.updated == nil {
+		c.updated = make(chan struct{})
+	}
+	return c.updated
+}
+
+func (c *Coordinator) setState(state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := !equalSeqs(c.state.ConfigSeqs, state.ConfigSeqs)
+	c.state = state
+	if changed && c.updated != nil {
+		close(c.updated)
+		c.updated = nil
+	}
+}
+
+func equalSeqs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrNoChange is returned by f of Coordinator.Update if State
+// needs no update.
+var ErrNoChange = errors.New("coord: no change")
+
+// Update updates State in Store by f.
+// f may be called more than once if State is updated by others
+// concurrently. If f returns error, Update returns it without
+// updating State, or nil if the error is ErrNoChange.
+func (c *Coordinator) Update(ctx context.Context, f func(*State) error) error {
+	for {
+		state, gen, err := c.Store.Get(ctx)
+		if err != nil {
+			return err
+		}
+		err = f(&state)
+		if errors.Is(err, ErrNoChange) {
+			c.setState(state)
+			return nil
+		}
+		if err != nil {
+			c.setState(state)
+			return err
+		}
+		err = c.Store.Put(ctx, state, gen)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.setState(state)
+		return nil
+	}
+}
+
+var errNotLeader = errors.New("coord: not leader")
+
+// Sync syncs State from Store, and acquires or renews the lease
+// if the lease is not held by other clusters.
+func (c *Coordinator) Sync(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	if c.Cluster == "" {
+		state, _, err := c.Store.Get(ctx)
+		if err != nil {
+			return err
+		}
+		c.setState(state)
+		return nil
+	}
+	err := c.Update(ctx, func(state *State) error {
+		now := c.timeNow()
+		if state.Leader != "" && state.Leader != c.Cluster && now.Before(state.LeaseExpire) {
+			return errNotLeader
+		}
+		if state.Leader != c.Cluster {
+			logger.Infof("coord: %s acquires lease from %q (expire:%s)", c.Cluster, state.Leader, state.LeaseExpire)
+		}
+		state.Leader = c.Cluster
+		state.LeaseExpire = now.Add(c.leaseDuration())
+		return nil
+	})
+	if errors.Is(err, errNotLeader) {
+		return nil
+	}
+	return err
+}
+
+// Release releases the lease if the cluster holds it.
+func (c *Coordinator) Release(ctx context.Context) error {
+	if !c.IsLeader() {
+		return nil
+	}
+	err := c.Update(ctx, func(state *State) error {
+		if state.Leader != c.Cluster {
+			return errNotLeader
+		}
+		state.Leader = ""
+		state.LeaseExpire = time.Time{}
+		return nil
+	})
+	if errors.Is(err, errNotLeader) {
+		return nil
+	}
+	return err
+}
+
+// Run syncs State periodically until ctx is done.
+// Lease is renewed every third of LeaseDuration, and released
+// when ctx is done.
+func (c *Coordinator) Run(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	t := time.NewTicker(c.leaseDuration() / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			err := c.Release(context.Background())
+			if err != nil {
+				logger.Errorf("coord: release lease: %v", err)
+			}
+			return
+		case <-t.C:
+			err := c.Sync(ctx)
+			if err != nil {
+				logger.Errorf("coord: sync: %v", err)
+			}
+		}
+	}
+}
+
+// PublishConfigSeqs publishes toolchain config seqs if the cluster
+// is the leader.
+func (c *Coordinator) PublishConfigSeqs(ctx context.Context, seqs map[string]string) error {
+	if !c.IsLeader() {
+		return errNotLeader
+	}
+	return c.Update(ctx, func(state *State) error {
+		if state.Leader != c.Cluster {
+			return errNotLeader
+		}
+		if equalSeqs(state.ConfigSeqs, seqs) {
+			return ErrNoChange
+		}
+		state.ConfigSeqs = make(map[string]string, len(seqs))
+		for k, v := range seqs {
+			state.ConfigSeqs[k] = v
+		}
+		return nil
+	})
+}
+
+// CacheNamespace returns cache namespace for ns with
+// CacheNamespaceVersion, i.e. "<ns>@<version>".
+// It returns ns if CacheNamespaceVersion is empty.
+func (c *Coordinator) CacheNamespace(ns string) string {
+	v := c.State().CacheNamespaceVersion
+	if v == "" {
+		return ns
+	}
+	return fmt.Sprintf("%s@%s", ns, v)
+}
@@ -0,0 +1,218 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package coord
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.chromium.org/goma/server/command"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+type memStore struct {
+	mu    sync.Mutex
+	state State
+	gen   int64
+}
+
+func (s *memStore) Get(ctx context.Context) (State, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state
+	if s.state.ConfigSeqs != nil {
+		state.ConfigSeqs = make(map[string]string)
+		for k, v := range s.state.ConfigSeqs {
+			state.ConfigSeqs[k] = v
+		}
+	}
+	return state, s.gen, nil
+}
+
+func (s *memStore) Put(ctx context.Context, state State, gen int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen != gen {
+		return ErrConflict
+	}
+	s.state = state
+	s.gen++
+	return nil
+}
+
+func TestCoordinatorLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1600000000, 0)
+	timeNow := func() time.Time { return now }
+	store := &memStore{}
+	c1 := &Coordinator{
+		Store:   store,
+		Cluster: "us-central1",
+		now:     timeNow,
+	}
+	c2 := &Coordinator{
+		Store:   store,
+		Cluster: "asia-northeast1",
+		now:     timeNow,
+	}
+
+	for _, c := range []*Coordinator{c1, c2} {
+		err := c.Sync(ctx)
+		if err != nil {
+			t.Fatalf("%s: Sync=%v; want nil error", c.Cluster, err)
+		}
+	}
+	if !c1.IsLeader() || c2.IsLeader() {
+		t.Errorf("IsLeader=%t, %t; want true, false", c1.IsLeader(), c2.IsLeader())
+	}
+	if got, want := c2.State().Leader, c1.Cluster; got != want {
+		t.Errorf("%s: leader=%q; want %q", c2.Cluster, got, want)
+	}
+
+	// lease is expired without renewal.
+	now = now.Add(2 * DefaultLeaseDuration)
+	err := c2.Sync(ctx)
+	if err != nil {
+		t.Fatalf("%s: Sync=%v; want nil error", c2.Cluster, err)
+	}
+	if !c2.IsLeader() {
+		t.Errorf("%s: IsLeader=false after lease expired; want true", c2.Cluster)
+	}
+	err = c1.Sync(ctx)
+	if err != nil {
+		t.Fatalf("%s: Sync=%v; want nil error", c1.Cluster, err)
+	}
+	if c1.IsLeader() {
+		t.Errorf("%s: IsLeader=true; want false", c1.Cluster)
+	}
+
+	err = c2.Release(ctx)
+	if err != nil {
+		t.Fatalf("%s: Release=%v; want nil error", c2.Cluster, err)
+	}
+	err = c1.Sync(ctx)
+	if err != nil {
+		t.Fatalf("%s: Sync=%v; want nil error", c1.Cluster, err)
+	}
+	if !c1.IsLeader() {
+		t.Errorf("%s: IsLeader=false after released; want true", c1.Cluster)
+	}
+}
+
+func TestCoordinatorCacheNamespace(t *testing.T) {
+	ctx := context.Background()
+	c := &Coordinator{
+		Store: &memStore{},
+	}
+	if got, want := c.CacheNamespace("tenant"), "tenant"; got != want {
+		t.Errorf("CacheNamespace=%q; want %q", got, want)
+	}
+	err := c.Update(ctx, func(state *State) error {
+		state.CacheNamespaceVersion = "2"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update=%v; want nil error", err)
+	}
+	if got, want := c.CacheNamespace("tenant"), "tenant@2"; got != want {
+		t.Errorf("CacheNamespace=%q; want %q", got, want)
+	}
+
+	store := c.Store.(*memStore)
+	gen := store.gen
+	err = c.Update(ctx, func(state *State) error {
+		return ErrNoChange
+	})
+	if err != nil || store.gen != gen {
+		t.Errorf("Update with ErrNoChange=%v, gen=%d; want nil error, gen=%d", err, store.gen, gen)
+	}
+}
+
+type fakeConfigMap struct {
+	command.ConfigMap
+	seqs map[string]string
+}
+
+func (c fakeConfigMap) Seqs(ctx context.Context) (map[string]string, error) {
+	return c.seqs, nil
+}
+
+func (c fakeConfigMap) RuntimeConfigs(ctx context.Context) (map[string]*cmdpb.RuntimeConfig, error) {
+	return nil, nil
+}
+
+func TestConfigMap(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	leader := &Coordinator{
+		Store:   store,
+		Cluster: "us-central1",
+	}
+	follower := &Coordinator{
+		Store:   store,
+		Cluster: "asia-northeast1",
+	}
+	for _, c := range []*Coordinator{leader, follower} {
+		err := c.Sync(ctx)
+		if err != nil {
+			t.Fatalf("%s: Sync=%v; want nil error", c.Cluster, err)
+		}
+	}
+	lcm := &ConfigMap{
+		ConfigMap: fakeConfigMap{
+			seqs: map[string]string{"linux": "1", "win": "1"},
+		},
+		Coordinator: leader,
+	}
+	fcm := &ConfigMap{
+		ConfigMap: fakeConfigMap{
+			seqs: map[string]string{"linux": "1", "win": "1"},
+		},
+		Coordinator: follower,
+	}
+
+	check := func(cm *ConfigMap, want map[string]string) {
+		t.Helper()
+		got, err := cm.Seqs(ctx)
+		if err != nil {
+			t.Fatalf("%s: Seqs=%v; want nil error", cm.Coordinator.Cluster, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: Seqs diff -want +got:\n%s", cm.Coordinator.Cluster, diff)
+		}
+	}
+	check(lcm, map[string]string{"linux": "1", "win": "1"})
+	err := follower.Sync(ctx)
+	if err != nil {
+		t.Fatalf("%s: Sync=%v; want nil error", follower.Cluster, err)
+	}
+	check(fcm, map[string]string{"linux": "1", "win": "1"})
+
+	// follower sees new seq before leader rolls out.
+	fcm.ConfigMap = fakeConfigMap{
+		seqs: map[string]string{"linux": "2", "win": "1", "mac": "1"},
+	}
+	check(fcm, map[string]string{"linux": "1", "win": "1", "mac": "1"})
+
+	updated := follower.Updated()
+	lcm.ConfigMap = fakeConfigMap{
+		seqs: map[string]string{"linux": "2", "win": "1", "mac": "1"},
+	}
+	check(lcm, map[string]string{"linux": "2", "win": "1", "mac": "1"})
+	err = follower.Sync(ctx)
+	if err != nil {
+		t.Fatalf("%s: Sync=%v; want nil error", follower.Cluster, err)
+	}
+	select {
+	case <-updated:
+	default:
+		t.Errorf("%s: not notified config seqs update", follower.Cluster)
+	}
+	check(fcm, map[string]string{"linux": "2", "win": "1", "mac": "1"})
+}
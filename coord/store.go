@@ -0,0 +1,71 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package coord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// GCSStore is a Store in a cloud storage object in JSON.
+// It uses object generation for optimistic concurrency control.
+type GCSStore struct {
+	Bucket *storage.BucketHandle
+	Object string
+}
+
+// Get gets current state and its generation from the object.
+func (s GCSStore) Get(ctx context.Context) (State, int64, error) {
+	r, err := s.Bucket.Object(s.Object).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return State{}, 0, nil
+	}
+	if err != nil {
+		return State{}, 0, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return State{}, 0, err
+	}
+	var state State
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return State{}, 0, fmt.Errorf("%s: %v", s.Object, err)
+	}
+	return state, r.Attrs.Generation, nil
+}
+
+// Put puts state in the object if its generation is gen.
+func (s GCSStore) Put(ctx context.Context, state State, gen int64) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	cond := storage.Conditions{GenerationMatch: gen}
+	if gen == 0 {
+		cond = storage.Conditions{DoesNotExist: true}
+	}
+	w := s.Bucket.Object(s.Object).If(cond).NewWriter(ctx)
+	w.ContentType = "application/json"
+	_, err = w.Write(b)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	err = w.Close()
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s: %w", s.Object, ErrConflict)
+	}
+	return err
+}
@@ -0,0 +1,479 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	"go.chromium.org/goma/server/command/normalizer"
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+// maxAuditLog is max number of audit entries kept in the inventory.
+const maxAuditLog = 100
+
+// AuditEntry is an audit log entry of admin change in the inventory.
+type AuditEntry struct {
+	Time   time.Time
+	User   string
+	Op     string
+	Key    string
+	Reason string
+}
+
+func (e AuditEntry) String() string {
+	return fmt.Sprintf("%s user=%s op=%s key=%s reason=%q", e.Time.Format(time.RFC3339), e.User, e.Op, e.Key, e.Reason)
+}
+
+// adminChanges is admin changes in the inventory.
+type adminChanges struct {
+	added    map[configKey]*cmdpb.Config
+	disabled map[configKey]bool
+	// deleted is cleared when new version is configured.
+	deleted map[configKey]bool
+
+	auditLog []AuditEntry
+}
+
+func (ac adminChanges) clone() adminChanges {
+	c := adminChanges{
+		auditLog: append([]AuditEntry(nil), ac.auditLog...),
+	}
+	if len(ac.added) > 0 {
+		c.added = make(map[configKey]*cmdpb.Config)
+		for k, v := range ac.added {
+			c.added[k] = v
+		}
+	}
+	if len(ac.disabled) > 0 {
+		c.disabled = make(map[configKey]bool)
+		for k, v := range ac.disabled {
+			c.disabled[k] = v
+		}
+	}
+	if len(ac.deleted) > 0 {
+		c.deleted = make(map[configKey]bool)
+		for k, v := range ac.deleted {
+			c.deleted[k] = v
+		}
+	}
+	return c
+}
+
+// audit records admin change in audit log.
+func (ac *adminChanges) audit(ctx context.Context, user, op string, k configKey, reason string) {
+	e := AuditEntry{
+		Time:   time.Now(),
+		User:   user,
+		Op:     op,
+		Key:    k.String(),
+		Reason: reason,
+	}
+	logger := log.FromContext(ctx)
+	logger.Infof("inventory audit: %s", e)
+	ac.auditLog = append(ac.auditLog, e)
+	if len(ac.auditLog) > maxAuditLog {
+		ac.auditLog = ac.auditLog[len(ac.auditLog)-maxAuditLog:]
+	}
+}
+
+// exists reports whether config for k exists in base with ac.
+func (ac *adminChanges) exists(base map[string]map[selector]*cmdpb.Config, k configKey) bool {
+	if ac.added[k] != nil {
+		return true
+	}
+	if ac.deleted[k] {
+		return false
+	}
+	_, ok := base[k.addr][k.sel]
+	return ok
+}
+
+// AuditLog returns recent admin changes in the inventory.
+func (in *Inventory) AuditLog() []AuditEntry {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return append([]AuditEntry(nil), in.admin.auditLog...)
+}
+
+// errConfigNotFound is returned if config is not found in the inventory.
+var errConfigNotFound = errors.New("config not found")
+
+// List returns version id and all command configs in the inventory,
+// including disabled configs.
+func (in *Inventory) List() (string, []*cmdpb.InventoryConfig) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	var keys []configKey
+	sources := make(map[configKey]cmdpb.InventoryConfig_Source)
+	configs := make(map[configKey]*cmdpb.Config)
+	for addr, m := range in.baseConfigsMap {
+		for sel, cfg := range m {
+			k := configKey{addr: addr, sel: sel}
+			if in.admin.deleted[k] {
+				continue
+			}
+			keys = append(keys, k)
+			sources[k] = cmdpb.InventoryConfig_CONFIGMAP
+			configs[k] = cfg
+		}
+	}
+	for k, cfg := range in.admin.added {
+		if _, found := sources[k]; !found {
+			keys = append(keys, k)
+		}
+		sources[k] = cmdpb.InventoryConfig_ADMIN
+		configs[k] = cfg
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	var resp []*cmdpb.InventoryConfig
+	for _, k := range keys {
+		resp = append(resp, &cmdpb.InventoryConfig{
+			Config:   proto.Clone(configs[k]).(*cmdpb.Config),
+			Source:   sources[k],
+			Disabled: in.admin.disabled[k],
+		})
+	}
+	return in.versionID, resp
+}
+
+// AddConfig adds cfg in the inventory, or replaces the config of the same
+// selector and target address, by user.
+// Added configs are kept across Configure.
+func (in *Inventory) AddConfig(ctx context.Context, user string, cfg *cmdpb.Config, reason string) error {
+	if cfg == nil {
+		return errors.New("no config")
+	}
+	sel, err := configSelector(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	k := configKey{addr: cfg.Target.Addr, sel: sel}
+	cfg = proto.Clone(cfg).(*cmdpb.Config)
+	return in.change(ctx, func(ac *adminChanges) error {
+		if ac.added == nil {
+			ac.added = make(map[configKey]*cmdpb.Config)
+		}
+		ac.added[k] = cfg
+		ac.audit(ctx, user, "add", k, reason)
+		return nil
+	})
+}
+
+// DisableConfig disables the config for key by user, or re-enables it
+// if enable is true.
+// Disabled configs are kept disabled across Configure.
+func (in *Inventory) DisableConfig(ctx context.Context, user string, key *cmdpb.ConfigKey, enable bool, reason string) error {
+	k, err := fromConfigKeyProto(key)
+	if err != nil {
+		return err
+	}
+	return in.change(ctx, func(ac *adminChanges) error {
+		if enable {
+			if !ac.disabled[k] {
+				return fmt.Errorf("%s: %w", k, errConfigNotFound)
+			}
+			delete(ac.disabled, k)
+			ac.audit(ctx, user, "enable", k, reason)
+			return nil
+		}
+		if !ac.exists(in.baseConfigsMap, k) {
+			return fmt.Errorf("%s: %w", k, errConfigNotFound)
+		}
+		if ac.disabled == nil {
+			ac.disabled = make(map[configKey]bool)
+		}
+		ac.disabled[k] = true
+		ac.audit(ctx, user, "disable", k, reason)
+		return nil
+	})
+}
+
+// DeleteConfig deletes the config for key by user.
+// Deleted config set by Configure comes back when new version is
+// configured.
+func (in *Inventory) DeleteConfig(ctx context.Context, user string, key *cmdpb.ConfigKey, reason string) error {
+	k, err := fromConfigKeyProto(key)
+	if err != nil {
+		return err
+	}
+	return in.change(ctx, func(ac *adminChanges) error {
+		if !ac.exists(in.baseConfigsMap, k) {
+			return fmt.Errorf("%s: %w", k, errConfigNotFound)
+		}
+		if ac.added[k] != nil {
+			delete(ac.added, k)
+		} else {
+			if ac.deleted == nil {
+				ac.deleted = make(map[configKey]bool)
+			}
+			ac.deleted[k] = true
+		}
+		delete(ac.disabled, k)
+		ac.audit(ctx, user, "delete", k, reason)
+		return nil
+	})
+}
+
+// maxAdminRetry is max number of retries of admin change when
+// AdminStore is updated by other replicas concurrently.
+const maxAdminRetry = 5
+
+// change runs f to make admin change, and applies the change.
+// If AdminStore is set, the change is made on admin changes in the
+// store, and stored so that other replicas apply it by SyncAdmin.
+func (in *Inventory) change(ctx context.Context, f func(ac *adminChanges) error) error {
+	if in.AdminStore == nil {
+		in.mu.Lock()
+		ac := in.admin.clone()
+		err := f(&ac)
+		if err != nil {
+			in.mu.Unlock()
+			return err
+		}
+		in.admin = ac
+		configs := in.apply()
+		in.mu.Unlock()
+		in.onConfigure(ctx, configs)
+		return nil
+	}
+	for i := 0; ; i++ {
+		data, gen, err := in.AdminStore.Get(ctx)
+		if err != nil {
+			return fmt.Errorf("admin store: %v", err)
+		}
+		in.mu.RLock()
+		versionID := in.versionID
+		ac, err := unmarshalAdminChanges(data, versionID)
+		if err == nil {
+			err = f(&ac)
+		}
+		in.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		data, err = ac.marshal(versionID)
+		if err != nil {
+			return err
+		}
+		err = in.AdminStore.Put(ctx, data, gen)
+		if errors.Is(err, ErrAdminConflict) && i < maxAdminRetry {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("admin store: %v", err)
+		}
+		in.mu.Lock()
+		in.admin = ac
+		in.adminData = data
+		configs := in.apply()
+		in.mu.Unlock()
+		in.onConfigure(ctx, configs)
+		return nil
+	}
+}
+
+func (in *Inventory) onConfigure(ctx context.Context, configs []*cmdpb.Config) {
+	if in.OnConfigure != nil {
+		in.OnConfigure(ctx, configs)
+	}
+}
+
+// SyncAdmin loads admin changes from AdminStore, and applies them
+// if they were changed, e.g. by other replicas.
+func (in *Inventory) SyncAdmin(ctx context.Context) error {
+	if in.AdminStore == nil {
+		return nil
+	}
+	data, _, err := in.AdminStore.Get(ctx)
+	if err != nil {
+		return err
+	}
+	in.mu.Lock()
+	if in.adminData != nil && bytes.Equal(data, in.adminData) {
+		in.mu.Unlock()
+		return nil
+	}
+	ac, err := unmarshalAdminChanges(data, in.versionID)
+	if err != nil {
+		in.mu.Unlock()
+		return err
+	}
+	in.admin = ac
+	in.adminData = data
+	if in.adminData == nil {
+		in.adminData = []byte{}
+	}
+	if in.versionID == "" {
+		// not configured yet. admin changes will be applied
+		// by Configure.
+		in.mu.Unlock()
+		return nil
+	}
+	configs := in.apply()
+	in.mu.Unlock()
+	logger := log.FromContext(ctx)
+	logger.Infof("inventory admin: synced %d bytes", len(data))
+	in.onConfigure(ctx, configs)
+	return nil
+}
+
+// WatchAdmin runs SyncAdmin every interval until ctx is done.
+func (in *Inventory) WatchAdmin(ctx context.Context, interval time.Duration) {
+	logger := log.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := in.SyncAdmin(ctx)
+		if err != nil {
+			logger.Warnf("inventory admin: sync failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func fromConfigKeyProto(key *cmdpb.ConfigKey) (configKey, error) {
+	if key.GetAddr() == "" || key.GetSelector() == nil {
+		return configKey{}, fmt.Errorf("invalid config key: %v", key)
+	}
+	selpb, err := normalizer.Selector(key.Selector)
+	if err != nil {
+		return configKey{}, fmt.Errorf("invalid config key: %v: %v", key, err)
+	}
+	return configKey{
+		addr: key.Addr,
+		sel:  fromSelectorProto(selpb),
+	}, nil
+}
+
+// AuthChecker checks authorization header of the request.
+type AuthChecker interface {
+	Check(context.Context, *http.Request) (*enduser.EndUser, error)
+}
+
+// InventoryAdmin is inventory service to manage inventory at runtime.
+type InventoryAdmin struct {
+	cmdpb.UnimplementedInventoryServiceServer
+
+	Inventory *Inventory
+
+	// Auth checks authorization metadata of the request.
+	Auth AuthChecker
+
+	// Admins are emails of users allowed to use the service.
+	// "group:<group>" allows users in the group.
+	Admins []string
+}
+
+// authorize authenticates the request, and returns email of the admin user.
+func (s *InventoryAdmin) authorize(ctx context.Context) (string, error) {
+	if s.Auth == nil {
+		return "", status.Error(codes.Unauthenticated, "no auth configured")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+	if len(authorization) == 0 {
+		return "", status.Error(codes.Unauthenticated, "no authorization")
+	}
+	req := &http.Request{
+		Header: make(http.Header),
+	}
+	req.Header.Set("Authorization", authorization[0])
+	u, err := s.Auth.Check(ctx, req)
+	if err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "auth failed: %v", err)
+	}
+	email := string(u.Email)
+	for _, a := range s.Admins {
+		if a == email {
+			return email, nil
+		}
+		if g := strings.TrimPrefix(a, "group:"); g != a && g == u.Group {
+			return email, nil
+		}
+	}
+	logger := log.FromContext(ctx)
+	logger.Warnf("inventory admin: permission denied for %s (group %s)", email, u.Group)
+	return "", status.Errorf(codes.PermissionDenied, "%s is not inventory admin", email)
+}
+
+func adminError(err error) error {
+	if errors.Is(err, errConfigNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// ListConfigs lists command configs in the inventory.
+func (s *InventoryAdmin) ListConfigs(ctx context.Context, req *cmdpb.ListConfigsReq) (*cmdpb.ListConfigsResp, error) {
+	_, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versionID, configs := s.Inventory.List()
+	return &cmdpb.ListConfigsResp{
+		VersionId: versionID,
+		Configs:   configs,
+	}, nil
+}
+
+// AddConfig adds a command config in the inventory.
+func (s *InventoryAdmin) AddConfig(ctx context.Context, req *cmdpb.AddConfigReq) (*cmdpb.AddConfigResp, error) {
+	user, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Inventory.AddConfig(ctx, user, req.GetConfig(), req.GetReason())
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &cmdpb.AddConfigResp{}, nil
+}
+
+// DisableConfig disables (or re-enables) a command config in the inventory.
+func (s *InventoryAdmin) DisableConfig(ctx context.Context, req *cmdpb.DisableConfigReq) (*cmdpb.DisableConfigResp, error) {
+	user, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Inventory.DisableConfig(ctx, user, req.GetKey(), req.GetEnable(), req.GetReason())
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &cmdpb.DisableConfigResp{}, nil
+}
+
+// DeleteConfig deletes a command config in the inventory.
+func (s *InventoryAdmin) DeleteConfig(ctx context.Context, req *cmdpb.DeleteConfigReq) (*cmdpb.DeleteConfigResp, error) {
+	user, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Inventory.DeleteConfig(ctx, user, req.GetKey(), req.GetReason())
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &cmdpb.DeleteConfigResp{}, nil
+}
@@ -0,0 +1,358 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+func newTestConfig(name, binaryHash, addr string) *cmdpb.Config {
+	return &cmdpb.Config{
+		Target: &cmdpb.Target{
+			Addr: addr,
+		},
+		CmdDescriptor: &cmdpb.CmdDescriptor{
+			Selector: &cmdpb.Selector{
+				Name:       name,
+				Version:    "1.0",
+				Target:     "x86_64-linux-gnu",
+				BinaryHash: binaryHash,
+			},
+			Setup: &cmdpb.CmdDescriptor_Setup{
+				PathType: cmdpb.CmdDescriptor_POSIX,
+			},
+		},
+	}
+}
+
+func inventoryState(in *Inventory) map[string]string {
+	_, configs := in.List()
+	m := make(map[string]string)
+	for _, c := range configs {
+		state := c.Source.String()
+		if c.Disabled {
+			state += ",disabled"
+		}
+		m[c.Config.CmdDescriptor.Selector.BinaryHash] = state
+	}
+	return m
+}
+
+func pickable(ctx context.Context, in *Inventory, cfg *cmdpb.Config) bool {
+	sel, err := configSelector(cfg)
+	if err != nil {
+		return false
+	}
+	_, _, err = in.pickCmd(ctx, sel, nil)
+	return err == nil
+}
+
+func TestInventoryAdmin(t *testing.T) {
+	ctx := context.Background()
+	gcc := newTestConfig("gcc", "gcc-hash", "rbe1")
+	clang := newTestConfig("clang", "clang-hash", "rbe1")
+	clangNew := newTestConfig("clang", "clang-new-hash", "rbe1")
+
+	var onConfigure []*cmdpb.Config
+	in := &Inventory{
+		OnConfigure: func(ctx context.Context, configs []*cmdpb.Config) {
+			onConfigure = configs
+		},
+	}
+	err := in.Configure(ctx, &cmdpb.ConfigResp{
+		VersionId: "v1",
+		Configs:   []*cmdpb.Config{gcc, clang},
+	})
+	if err != nil {
+		t.Fatalf("Configure(v1)=%v; want nil", err)
+	}
+
+	err = in.AddConfig(ctx, "admin@example.com", clangNew, "new clang")
+	if err != nil {
+		t.Fatalf("AddConfig(clang-new)=%v; want nil", err)
+	}
+	if !pickable(ctx, in, clangNew) {
+		t.Errorf("clang-new is not pickable after AddConfig")
+	}
+	if len(onConfigure) != 3 {
+		t.Errorf("OnConfigure called with %d configs; want 3", len(onConfigure))
+	}
+
+	clangKey := &cmdpb.ConfigKey{
+		Selector: clang.CmdDescriptor.Selector,
+		Addr:     "rbe1",
+	}
+	err = in.DisableConfig(ctx, "admin@example.com", clangKey, false, "broken")
+	if err != nil {
+		t.Fatalf("DisableConfig(clang)=%v; want nil", err)
+	}
+	if pickable(ctx, in, clang) {
+		t.Errorf("clang is pickable after DisableConfig")
+	}
+
+	gccKey := &cmdpb.ConfigKey{
+		Selector: gcc.CmdDescriptor.Selector,
+		Addr:     "rbe1",
+	}
+	err = in.DeleteConfig(ctx, "admin@example.com", gccKey, "unused")
+	if err != nil {
+		t.Fatalf("DeleteConfig(gcc)=%v; want nil", err)
+	}
+	if pickable(ctx, in, gcc) {
+		t.Errorf("gcc is pickable after DeleteConfig")
+	}
+	err = in.DeleteConfig(ctx, "admin@example.com", gccKey, "unused")
+	if !errors.Is(err, errConfigNotFound) {
+		t.Errorf("DeleteConfig(gcc) again=%v; want %v", err, errConfigNotFound)
+	}
+
+	got := inventoryState(in)
+	want := map[string]string{
+		"clang-hash":     "CONFIGMAP,disabled",
+		"clang-new-hash": "ADMIN",
+	}
+	if len(got) != len(want) {
+		t.Errorf("List()=%v; want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("List()[%q]=%q; want %q", k, got[k], v)
+		}
+	}
+
+	// same version: admin changes are kept.
+	err = in.Configure(ctx, &cmdpb.ConfigResp{
+		VersionId: "v1",
+		Configs:   []*cmdpb.Config{gcc, clang},
+	})
+	if err != nil {
+		t.Fatalf("Configure(v1)=%v; want nil", err)
+	}
+	if pickable(ctx, in, gcc) || pickable(ctx, in, clang) || !pickable(ctx, in, clangNew) {
+		t.Errorf("admin changes are not kept in the same version")
+	}
+
+	// new version: deleted config comes back, but disabled config
+	// is kept disabled.
+	err = in.Configure(ctx, &cmdpb.ConfigResp{
+		VersionId: "v2",
+		Configs:   []*cmdpb.Config{gcc, clang},
+	})
+	if err != nil {
+		t.Fatalf("Configure(v2)=%v; want nil", err)
+	}
+	if !pickable(ctx, in, gcc) {
+		t.Errorf("deleted gcc didn't come back in new version")
+	}
+	if pickable(ctx, in, clang) {
+		t.Errorf("disabled clang is pickable in new version")
+	}
+	if !pickable(ctx, in, clangNew) {
+		t.Errorf("added clang-new is not pickable in new version")
+	}
+
+	err = in.DisableConfig(ctx, "admin@example.com", clangKey, true, "fixed")
+	if err != nil {
+		t.Fatalf("DisableConfig(clang, enable)=%v; want nil", err)
+	}
+	if !pickable(ctx, in, clang) {
+		t.Errorf("clang is not pickable after re-enabled")
+	}
+
+	if got, want := len(in.AuditLog()), 4; got != want {
+		t.Errorf("len(AuditLog())=%d; want %d", got, want)
+	}
+	for _, e := range in.AuditLog() {
+		if e.User != "admin@example.com" {
+			t.Errorf("audit log user=%q; want %q", e.User, "admin@example.com")
+		}
+	}
+}
+
+type fakeAuthChecker struct {
+	users map[string]*enduser.EndUser
+}
+
+func (a fakeAuthChecker) Check(ctx context.Context, req *http.Request) (*enduser.EndUser, error) {
+	u, ok := a.users[req.Header.Get("Authorization")]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return u, nil
+}
+
+func TestInventoryAdminAuthorize(t *testing.T) {
+	s := &InventoryAdmin{
+		Inventory: &Inventory{},
+		Auth: fakeAuthChecker{
+			users: map[string]*enduser.EndUser{
+				"Bearer admin":  enduser.New("admin@example.com", "", nil),
+				"Bearer oncall": enduser.New("oncall@example.com", "goma-oncall", nil),
+				"Bearer user":   enduser.New("user@example.com", "goma-users", nil),
+			},
+		},
+		Admins: []string{"admin@example.com", "group:goma-oncall"},
+	}
+	for _, tc := range []struct {
+		authorization string
+		want          codes.Code
+	}{
+		{authorization: "Bearer admin", want: codes.OK},
+		{authorization: "Bearer oncall", want: codes.OK},
+		{authorization: "Bearer user", want: codes.PermissionDenied},
+		{authorization: "Bearer unknown", want: codes.Unauthenticated},
+		{want: codes.Unauthenticated},
+	} {
+		ctx := context.Background()
+		if tc.authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tc.authorization))
+		}
+		_, err := s.ListConfigs(ctx, &cmdpb.ListConfigsReq{})
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("ListConfigs with %q=%v; want %v", tc.authorization, err, tc.want)
+		}
+	}
+}
+
+// memAdminStore is in-memory AdminStore.
+type memAdminStore struct {
+	mu   sync.Mutex
+	data []byte
+	gen  int64
+
+	// conflicts is number of Put to fail with ErrAdminConflict.
+	conflicts int
+}
+
+func (s *memAdminStore) Get(ctx context.Context) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, s.gen, nil
+}
+
+func (s *memAdminStore) Put(ctx context.Context, data []byte, gen int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conflicts > 0 {
+		s.conflicts--
+		return ErrAdminConflict
+	}
+	if gen != s.gen {
+		return ErrAdminConflict
+	}
+	s.data = data
+	s.gen++
+	return nil
+}
+
+func TestInventoryAdminStore(t *testing.T) {
+	ctx := context.Background()
+	gcc := newTestConfig("gcc", "gcc-hash", "rbe1")
+	clang := newTestConfig("clang", "clang-hash", "rbe1")
+	clangNew := newTestConfig("clang", "clang-new-hash", "rbe1")
+
+	store := &memAdminStore{}
+	newInventory := func(t *testing.T) *Inventory {
+		t.Helper()
+		in := &Inventory{
+			AdminStore: store,
+		}
+		err := in.SyncAdmin(ctx)
+		if err != nil {
+			t.Fatalf("SyncAdmin=%v; want nil", err)
+		}
+		err = in.Configure(ctx, &cmdpb.ConfigResp{
+			VersionId: "v1",
+			Configs:   []*cmdpb.Config{gcc, clang},
+		})
+		if err != nil {
+			t.Fatalf("Configure(v1)=%v; want nil", err)
+		}
+		return in
+	}
+	in1 := newInventory(t)
+	in2 := newInventory(t)
+
+	clangKey := &cmdpb.ConfigKey{
+		Selector: clang.CmdDescriptor.Selector,
+		Addr:     "rbe1",
+	}
+	gccKey := &cmdpb.ConfigKey{
+		Selector: gcc.CmdDescriptor.Selector,
+		Addr:     "rbe1",
+	}
+	err := in1.AddConfig(ctx, "admin@example.com", clangNew, "new clang")
+	if err != nil {
+		t.Fatalf("in1.AddConfig(clang-new)=%v; want nil", err)
+	}
+	// in2 makes change on admin changes made by in1, even if it
+	// conflicts with concurrent change.
+	store.conflicts = 1
+	err = in2.DisableConfig(ctx, "oncall@example.com", clangKey, false, "broken")
+	if err != nil {
+		t.Fatalf("in2.DisableConfig(clang)=%v; want nil", err)
+	}
+	err = in2.DeleteConfig(ctx, "oncall@example.com", gccKey, "unused")
+	if err != nil {
+		t.Fatalf("in2.DeleteConfig(gcc)=%v; want nil", err)
+	}
+	if pickable(ctx, in1, clangNew) != true || pickable(ctx, in1, clang) != true {
+		t.Errorf("in1 applied changes by in2 before sync")
+	}
+
+	err = in1.SyncAdmin(ctx)
+	if err != nil {
+		t.Fatalf("in1.SyncAdmin=%v; want nil", err)
+	}
+	want := map[string]string{
+		"clang-hash":     "CONFIGMAP,disabled",
+		"clang-new-hash": "ADMIN",
+	}
+	for name, in := range map[string]*Inventory{"in1": in1, "in2": in2} {
+		if diff := cmp.Diff(want, inventoryState(in)); diff != "" {
+			t.Errorf("%s: List() diff -want +got:\n%s", name, diff)
+		}
+		if pickable(ctx, in, gcc) || pickable(ctx, in, clang) || !pickable(ctx, in, clangNew) {
+			t.Errorf("%s: admin changes are not applied", name)
+		}
+		if got, want := len(in.AuditLog()), 3; got != want {
+			t.Errorf("%s: len(AuditLog())=%d; want %d", name, got, want)
+		}
+	}
+
+	// new replica loads admin changes.
+	in3 := newInventory(t)
+	if diff := cmp.Diff(want, inventoryState(in3)); diff != "" {
+		t.Errorf("in3: List() diff -want +got:\n%s", diff)
+	}
+
+	// new version: deleted config comes back.
+	err = in3.Configure(ctx, &cmdpb.ConfigResp{
+		VersionId: "v2",
+		Configs:   []*cmdpb.Config{gcc, clang},
+	})
+	if err != nil {
+		t.Fatalf("in3.Configure(v2)=%v; want nil", err)
+	}
+	err = in3.SyncAdmin(ctx)
+	if err != nil {
+		t.Fatalf("in3.SyncAdmin=%v; want nil", err)
+	}
+	if !pickable(ctx, in3, gcc) || pickable(ctx, in3, clang) {
+		t.Errorf("in3: gcc pickable=%t clang pickable=%t in v2; want true, false", pickable(ctx, in3, gcc), pickable(ctx, in3, clang))
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+// ErrAdminConflict is returned by AdminStore.Put if admin changes
+// were updated by others.
+var ErrAdminConflict = errors.New("admin changes conflict")
+
+// AdminStore stores admin changes of the inventory shared by
+// replicas of exec server, so that admin change made in a replica is
+// applied in all replicas.
+type AdminStore interface {
+	// Get gets data and its generation.
+	// It returns nil data and 0 generation if no data is stored.
+	Get(ctx context.Context) ([]byte, int64, error)
+
+	// Put puts data if current generation is gen.
+	// It returns error wrapping ErrAdminConflict if generation
+	// doesn't match.
+	Put(ctx context.Context, data []byte, gen int64) error
+}
+
+// DefaultAdminSyncInterval is default interval to sync admin changes
+// from AdminStore.
+const DefaultAdminSyncInterval = 30 * time.Second
+
+// GCSAdminStore is an AdminStore in a cloud storage object.
+// It uses object generation for optimistic concurrency control.
+type GCSAdminStore struct {
+	Bucket *storage.BucketHandle
+	Object string
+}
+
+// Get gets data and its generation from the object.
+func (s GCSAdminStore) Get(ctx context.Context) ([]byte, int64, error) {
+	r, err := s.Bucket.Object(s.Object).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b, r.Attrs.Generation, nil
+}
+
+// Put puts data in the object if its generation is gen.
+func (s GCSAdminStore) Put(ctx context.Context, data []byte, gen int64) error {
+	cond := storage.Conditions{GenerationMatch: gen}
+	if gen == 0 {
+		cond = storage.Conditions{DoesNotExist: true}
+	}
+	w := s.Bucket.Object(s.Object).If(cond).NewWriter(ctx)
+	w.ContentType = "application/json"
+	_, err := w.Write(data)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	err = w.Close()
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s: %w", s.Object, ErrAdminConflict)
+	}
+	return err
+}
+
+// adminState is admin changes stored in AdminStore in JSON.
+// configs and keys are in protojson.
+type adminState struct {
+	Added    []json.RawMessage `json:"added,omitempty"`
+	Disabled []json.RawMessage `json:"disabled,omitempty"`
+	// Deleted are deleted configs in DeletedVersion.
+	// They are ignored in other versions.
+	Deleted        []json.RawMessage `json:"deleted,omitempty"`
+	DeletedVersion string            `json:"deleted_version,omitempty"`
+	AuditLog       []AuditEntry      `json:"audit_log,omitempty"`
+}
+
+func sortedKeys(m map[configKey]bool) []configKey {
+	var keys []configKey
+	for k, v := range m {
+		if v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+func marshalConfigKeys(keys []configKey) ([]json.RawMessage, error) {
+	var r []json.RawMessage
+	for _, k := range keys {
+		b, err := protojson.Marshal(&cmdpb.ConfigKey{
+			Addr:     k.addr,
+			Selector: k.sel.Proto(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, b)
+	}
+	return r, nil
+}
+
+func unmarshalConfigKeys(msgs []json.RawMessage) (map[configKey]bool, error) {
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	m := make(map[configKey]bool)
+	for _, msg := range msgs {
+		key := &cmdpb.ConfigKey{}
+		err := protojson.Unmarshal(msg, key)
+		if err != nil {
+			return nil, err
+		}
+		k, err := fromConfigKeyProto(key)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = true
+	}
+	return m, nil
+}
+
+// marshal marshals ac for AdminStore, with deleted configs in versionID.
+func (ac adminChanges) marshal(versionID string) ([]byte, error) {
+	var state adminState
+	added := make(map[configKey]bool)
+	for k := range ac.added {
+		added[k] = true
+	}
+	for _, k := range sortedKeys(added) {
+		b, err := protojson.Marshal(ac.added[k])
+		if err != nil {
+			return nil, err
+		}
+		state.Added = append(state.Added, b)
+	}
+	var err error
+	state.Disabled, err = marshalConfigKeys(sortedKeys(ac.disabled))
+	if err != nil {
+		return nil, err
+	}
+	state.Deleted, err = marshalConfigKeys(sortedKeys(ac.deleted))
+	if err != nil {
+		return nil, err
+	}
+	if len(state.Deleted) > 0 {
+		state.DeletedVersion = versionID
+	}
+	state.AuditLog = ac.auditLog
+	return json.Marshal(state)
+}
+
+// unmarshalAdminChanges unmarshals data in AdminStore for versionID.
+func unmarshalAdminChanges(data []byte, versionID string) (adminChanges, error) {
+	var ac adminChanges
+	if len(data) == 0 {
+		return ac, nil
+	}
+	var state adminState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return ac, fmt.Errorf("admin changes: %v", err)
+	}
+	for _, msg := range state.Added {
+		cfg := &cmdpb.Config{}
+		err := protojson.Unmarshal(msg, cfg)
+		if err != nil {
+			return ac, fmt.Errorf("admin changes: added: %v", err)
+		}
+		sel, err := configSelector(cfg)
+		if err != nil {
+			return ac, fmt.Errorf("admin changes: added: %v", err)
+		}
+		if ac.added == nil {
+			ac.added = make(map[configKey]*cmdpb.Config)
+		}
+		ac.added[configKey{addr: cfg.Target.GetAddr(), sel: sel}] = cfg
+	}
+	ac.disabled, err = unmarshalConfigKeys(state.Disabled)
+	if err != nil {
+		return ac, fmt.Errorf("admin changes: disabled: %v", err)
+	}
+	if state.DeletedVersion == versionID {
+		ac.deleted, err = unmarshalConfigKeys(state.Deleted)
+		if err != nil {
+			return ac, fmt.Errorf("admin changes: deleted: %v", err)
+		}
+	}
+	ac.auditLog = state.AuditLog
+	return ac, nil
+}
@@ -66,3 +66,65 @@ func (c Client) Exec(ctx context.Context, in *gomapb.ExecReq, opts ...grpc.CallO
 
 	return resp, err
 }
+
+// ExecExt handles goma Exec requests with extensions of goma server.
+func (c Client) ExecExt(ctx context.Context, in *pb.ExecExtReq, opts ...grpc.CallOption) (*pb.ExecExtResp, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/exec.Client.ExecExt")
+	defer span.End()
+	conn, err := grpc.DialContext(ctx, c.addr,
+		append([]grpc.DialOption{
+			grpc.WithBlock(),
+		}, c.dialOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := pb.NewExecServiceClient(conn).ExecExt(ctx, in,
+		append([]grpc.CallOption{
+			grpc.MaxCallSendMsgSize(DefaultMaxReqMsgSize),
+			grpc.MaxCallRecvMsgSize(DefaultMaxRespMsgSize),
+		}, opts...)...)
+
+	return resp, err
+}
+
+// ExecStream handles goma Exec requests with extensions of goma server,
+// and streams progress.
+// Caller must call Recv until it returns error (io.EOF at the end)
+// to release the connection.
+func (c Client) ExecStream(ctx context.Context, in *pb.ExecExtReq, opts ...grpc.CallOption) (pb.ExecService_ExecStreamClient, error) {
+	conn, err := grpc.DialContext(ctx, c.addr,
+		append([]grpc.DialOption{
+			grpc.WithBlock(),
+		}, c.dialOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := pb.NewExecServiceClient(conn).ExecStream(ctx, in,
+		append([]grpc.CallOption{
+			grpc.MaxCallSendMsgSize(DefaultMaxReqMsgSize),
+			grpc.MaxCallRecvMsgSize(DefaultMaxRespMsgSize),
+		}, opts...)...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return execStreamClient{
+		ExecService_ExecStreamClient: stream,
+		conn:                         conn,
+	}, nil
+}
+
+type execStreamClient struct {
+	pb.ExecService_ExecStreamClient
+	conn *grpc.ClientConn
+}
+
+func (s execStreamClient) Recv() (*pb.ExecProgress, error) {
+	m, err := s.ExecService_ExecStreamClient.Recv()
+	if err != nil {
+		s.conn.Close()
+	}
+	return m, err
+}
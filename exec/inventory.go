@@ -17,6 +17,7 @@ import (
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
+	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
 
 	"go.chromium.org/goma/server/auth/enduser"
@@ -24,6 +25,7 @@ import (
 	"go.chromium.org/goma/server/command/descriptor/winpath"
 	"go.chromium.org/goma/server/command/normalizer"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 	gomapb "go.chromium.org/goma/server/proto/api"
 	cmdpb "go.chromium.org/goma/server/proto/command"
 )
@@ -42,10 +44,10 @@ var (
 	DefaultToolchainViews = []*view.View{
 		{
 			Description: `counts toolchain selection. result is "used", "found", "requested" or "missed"`,
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				selectorKey,
 				resultKey,
-			},
+			),
 			Measure:     toolchainSelects,
 			Aggregation: view.Count(),
 		},
@@ -114,6 +116,9 @@ func recordToolchainSelect(ctx context.Context, s selector, result resultValue)
 
 // Inventory holds available command configs.
 type Inventory struct {
+	// OnConfigure is called with new configs after Configure succeeded.
+	OnConfigure func(ctx context.Context, configs []*cmdpb.Config)
+
 	mu        sync.RWMutex
 	versionID string
 	// map from selector -> slice of addresses.
@@ -122,6 +127,19 @@ type Inventory struct {
 	configs map[string]map[selector]*cmdpb.Config
 	// config for arbitrary toolchain support.
 	platformConfigs []*platformConfig
+
+	// configs set by Configure, before admin changes are applied.
+	baseConfigs    []*cmdpb.Config
+	baseAddrs      map[selector][]string
+	baseConfigsMap map[string]map[selector]*cmdpb.Config
+
+	// AdminStore stores admin changes shared by replicas.
+	// If it is nil, admin changes are kept only in this inventory.
+	AdminStore AdminStore
+
+	admin adminChanges
+	// adminData is data in AdminStore that admin is loaded from.
+	adminData []byte
 }
 
 type selector struct {
@@ -153,6 +171,16 @@ func (s selector) String() string {
 	return s.Proto().String()
 }
 
+// configKey identifies a config in the inventory.
+type configKey struct {
+	addr string
+	sel  selector
+}
+
+func (k configKey) String() string {
+	return fmt.Sprintf("%s@%s", k.sel, k.addr)
+}
+
 type byName []selector
 
 func (s byName) Len() int      { return len(s) }
@@ -202,26 +230,9 @@ func (in *Inventory) Configure(ctx context.Context, cfgs *cmdpb.ConfigResp) erro
 			continue
 		}
 
-		if cfg.Target == nil {
-			logger.Warnf("no target in %s", cfg)
-			continue
-		}
-		if cfg.Target.Addr == "" {
-			logger.Warnf("no target address in %s", cfg)
-			continue
-		}
-		if cfg.CmdDescriptor == nil || cfg.CmdDescriptor.Selector == nil {
-			logger.Warnf("no cmd descriptor in %s", cfg)
-			continue
-		}
-		selpb, err := normalizer.Selector(cfg.CmdDescriptor.Selector)
+		sel, err := configSelector(cfg)
 		if err != nil {
-			logger.Errorf("failed to normalize selector in %s", cfg)
-			continue
-		}
-		sel := fromSelectorProto(selpb)
-		if cfg.CmdDescriptor.GetSetup().GetPathType() == cmdpb.CmdDescriptor_UNKNOWN_PATH_TYPE {
-			logger.Errorf("unknown path type in %s %s", sel, cfg)
+			logger.Warnf("%v in %s", err, cfg)
 			continue
 		}
 		addr := cfg.Target.Addr
@@ -234,11 +245,48 @@ func (in *Inventory) Configure(ctx context.Context, cfgs *cmdpb.ConfigResp) erro
 		m[sel] = cfg
 		logger.Infof("configure %s: %s => %v", sel, addr, cfg)
 	}
+	configs, err := in.configure(ctx, cfgs.VersionId, cfgs.Configs, newAddrs, newConfigs, newPlatformConfigs)
+	if err != nil {
+		return err
+	}
+	if in.OnConfigure != nil {
+		in.OnConfigure(ctx, configs)
+	}
+	return nil
+}
+
+// configSelector returns normalized selector of cfg.
+// It returns error if cfg is not valid command config.
+func configSelector(cfg *cmdpb.Config) (selector, error) {
+	if cfg.Target == nil {
+		return selector{}, errors.New("no target")
+	}
+	if cfg.Target.Addr == "" {
+		return selector{}, errors.New("no target address")
+	}
+	if cfg.CmdDescriptor == nil || cfg.CmdDescriptor.Selector == nil {
+		return selector{}, errors.New("no cmd descriptor")
+	}
+	selpb, err := normalizer.Selector(cfg.CmdDescriptor.Selector)
+	if err != nil {
+		return selector{}, fmt.Errorf("failed to normalize selector: %v", err)
+	}
+	sel := fromSelectorProto(selpb)
+	if cfg.CmdDescriptor.GetSetup().GetPathType() == cmdpb.CmdDescriptor_UNKNOWN_PATH_TYPE {
+		return selector{}, fmt.Errorf("unknown path type for %s", sel)
+	}
+	return sel, nil
+}
+
+// configure sets new configs, and returns configs with admin changes
+// applied.
+func (in *Inventory) configure(ctx context.Context, versionID string, cfgs []*cmdpb.Config, newAddrs map[selector][]string, newConfigs map[string]map[selector]*cmdpb.Config, newPlatformConfigs []*platformConfig) ([]*cmdpb.Config, error) {
+	logger := log.FromContext(ctx)
 	in.mu.Lock()
 	defer in.mu.Unlock()
-	n0 := numConfigs(in.configs)
+	n0 := numConfigs(in.baseConfigsMap)
 	n1 := numConfigs(newConfigs)
-	logger.Infof("configure %s:%d -> %s:%d", in.versionID, n0, cfgs.VersionId, n1)
+	logger.Infof("configure %s:%d -> %s:%d", in.versionID, n0, versionID, n1)
 	if diff := n0 - n1; n0 != 0 && 100*diff/n0 > 1 {
 		ratio := 100 * diff / n0
 		// mitigate for https://bugs.chromium.org/p/chromium/issues/detail?id=1243381
@@ -246,16 +294,84 @@ func (in *Inventory) Configure(ctx context.Context, cfgs *cmdpb.ConfigResp) erro
 		// retry load.
 		// if it is a real removal, restaring server can forget
 		// the old one.
-		return fmt.Errorf("too many configs will be removed: %d -> %d: -%d%%. keep old ones.  Please restart the server if the config removal is intended", n0, n1, ratio)
+		return nil, fmt.Errorf("too many configs will be removed: %d -> %d: -%d%%. keep old ones.  Please restart the server if the config removal is intended", n0, n1, ratio)
+	}
+	if versionID != in.versionID {
+		in.admin.deleted = nil
+		// deleted configs in AdminStore may be for the new version.
+		if ac, err := unmarshalAdminChanges(in.adminData, versionID); err == nil {
+			in.admin.deleted = ac.deleted
+		}
 	}
-	in.versionID = cfgs.VersionId
-	in.addrs = newAddrs
-	in.configs = newConfigs
+	in.versionID = versionID
+	in.baseConfigs = cfgs
+	in.baseAddrs = newAddrs
+	in.baseConfigsMap = newConfigs
 	in.platformConfigs = newPlatformConfigs
-	if len(in.configs) == 0 && len(in.platformConfigs) == 0 {
-		return fmt.Errorf("no available config in %s", cfgs.VersionId)
+	configs := in.apply()
+	if len(in.baseConfigsMap) == 0 && len(in.platformConfigs) == 0 {
+		return nil, fmt.Errorf("no available config in %s", versionID)
 	}
-	return nil
+	return configs, nil
+}
+
+// apply applies admin changes to configs set by Configure, and
+// returns configs to be used.
+// in.mu must be held.
+func (in *Inventory) apply() []*cmdpb.Config {
+	ac := &in.admin
+	if len(ac.added) == 0 && len(ac.disabled) == 0 && len(ac.deleted) == 0 {
+		in.addrs = in.baseAddrs
+		in.configs = in.baseConfigsMap
+		return in.baseConfigs
+	}
+	in.addrs = make(map[selector][]string)
+	in.configs = make(map[string]map[selector]*cmdpb.Config)
+	var configs []*cmdpb.Config
+	for _, cfg := range in.baseConfigs {
+		sel, err := configSelector(cfg)
+		if err != nil {
+			// platform configs etc.
+			configs = append(configs, cfg)
+			continue
+		}
+		k := configKey{addr: cfg.Target.Addr, sel: sel}
+		if ac.added[k] != nil || ac.disabled[k] || ac.deleted[k] {
+			continue
+		}
+		configs = append(configs, cfg)
+		in.add(k, cfg)
+	}
+	// sort for stable order of addrs.
+	var keys []configKey
+	for k := range ac.added {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		if ac.disabled[k] {
+			continue
+		}
+		configs = append(configs, ac.added[k])
+		in.add(k, ac.added[k])
+	}
+	return configs
+}
+
+// add adds cfg for k in in.addrs and in.configs.
+// in.mu must be held.
+func (in *Inventory) add(k configKey, cfg *cmdpb.Config) {
+	m, ok := in.configs[k.addr]
+	if !ok {
+		m = make(map[selector]*cmdpb.Config)
+		in.configs[k.addr] = m
+	}
+	if _, found := m[k.sel]; !found {
+		in.addrs[k.sel] = append(in.addrs[k.sel], k.addr)
+	}
+	m[k.sel] = cfg
 }
 
 func (in *Inventory) VersionID() string {
@@ -658,12 +774,36 @@ func fromSubprogramSpec(spec *gomapb.SubprogramSpec) selector {
 	}
 }
 
+// ServeHTTP serves current configs.
+// With format=textproto, it serves configs as text proto of
+// ConfigResp, e.g. for toolchain_config_check.
 func (in *Inventory) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	versionID, resp := in.status()
 	w.Header().Set("Content-Type", "text/plain")
+	if req.FormValue("format") == "textproto" {
+		b, err := prototext.MarshalOptions{Multiline: true}.Marshal(&cmdpb.ConfigResp{
+			VersionId: versionID,
+			Configs:   resp,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+		return
+	}
 	fmt.Fprintf(w, "version-id: %s\n", versionID)
 	fmt.Fprintln(w)
 	for _, cfg := range resp {
 		fmt.Fprintf(w, "%v\n", cfg)
 	}
+	auditLog := in.AuditLog()
+	if len(auditLog) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "audit log:")
+	for _, e := range auditLog {
+		fmt.Fprintf(w, "%s\n", e)
+	}
 }
@@ -0,0 +1,506 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+/*
+Package localdocker provides goma exec service that runs commands in
+docker containers on the local docker daemon, so that goma backend can
+be self-hosted without any REAPI service.
+*/
+package localdocker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	gomaexec "go.chromium.org/goma/server/exec"
+	"go.chromium.org/goma/server/file"
+	"go.chromium.org/goma/server/log"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+	execpb "go.chromium.org/goma/server/proto/exec"
+	fpb "go.chromium.org/goma/server/proto/file"
+)
+
+// CmdStorage is a storage of toolchain files.
+type CmdStorage interface {
+	Open(ctx context.Context, hash string) (io.ReadCloser, error)
+}
+
+// DefaultTimeout is default timeout of a command.
+const DefaultTimeout = 15 * time.Minute
+
+// inputConcurrency is concurrency to fetch inputs from file service
+// in a request.
+const inputConcurrency = 16
+
+// Server is an exec service that runs commands in docker containers.
+//
+// Inputs are read from file service, and outputs are stored in file
+// service. Commands run in the container image with input root
+// bind-mounted at the same path as in the client, so requests don't
+// need to be relocatable.
+// Toolchain files not included in request are read from CmdStorage
+// if they are in the input root, or should exist in the container image.
+//
+// Only linux (posix) clients are supported.
+type Server struct {
+	execpb.UnimplementedExecServiceServer
+
+	// Inventory picks command config and toolchain files for requests.
+	Inventory *gomaexec.Inventory
+
+	// GomaFile is used to read inputs and to store outputs.
+	GomaFile fpb.FileServiceClient
+
+	// CmdStorage provides toolchain files if set.
+	CmdStorage CmdStorage
+
+	// ContainerImage is docker image to run commands, used if
+	// command config doesn't have "container-image" platform property.
+	ContainerImage string
+
+	// Dir is a directory to create input roots.
+	// os.TempDir() if empty.
+	Dir string
+
+	// Sema limits concurrent executions if set.
+	Sema chan struct{}
+
+	// Timeout is timeout of a command. DefaultTimeout if zero.
+	Timeout time.Duration
+
+	// Docker is path of docker command. "docker" if empty.
+	Docker string
+}
+
+func badRequest(resp *gomapb.ExecResp, format string, args ...interface{}) *gomapb.ExecResp {
+	resp.Error = gomapb.ExecResp_BAD_REQUEST.Enum()
+	resp.ErrorMessage = append(resp.ErrorMessage, fmt.Sprintf(format, args...))
+	return resp
+}
+
+// Exec handles goma Exec request.
+func (s *Server) Exec(ctx context.Context, req *gomapb.ExecReq) (*gomapb.ExecResp, error) {
+	logger := log.FromContext(ctx)
+	resp := &gomapb.ExecResp{}
+	cmdConfig, cmdFiles, err := s.Inventory.Pick(ctx, req, resp)
+	if err != nil {
+		logger.Errorf("Inventory.Pick failed: %v", err)
+		return resp, nil
+	}
+	if resp.Result == nil {
+		resp.Result = &gomapb.ExecResult{
+			ExitStatus: proto.Int32(-1),
+		}
+	}
+	if cmdConfig.GetCmdDescriptor().GetSetup().GetPathType() == cmdpb.CmdDescriptor_WINDOWS || cmdConfig.GetCmdDescriptor().GetCross().GetWindowsCross() {
+		return badRequest(resp, "windows client is not supported"), nil
+	}
+	image := s.image(cmdConfig)
+	if image == "" {
+		return badRequest(resp, "no container image for %s", cmdConfig.GetCmdDescriptor().GetSelector()), nil
+	}
+	if len(cmdFiles) == 0 || len(req.GetArg()) == 0 {
+		return badRequest(resp, "no command"), nil
+	}
+	a, err := newAction(req, cmdFiles)
+	if err != nil {
+		return badRequest(resp, "%v", err), nil
+	}
+
+	if s.Sema != nil {
+		select {
+		case s.Sema <- struct{}{}:
+			defer func() { <-s.Sema }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	workDir, err := ioutil.TempDir(s.Dir, "goma-localdocker")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+	a.root = workDir
+
+	missing, reasons, err := a.writeInputs(ctx, s.GomaFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		logger.Infof("missing %d inputs out of %d", len(missing), len(req.GetInput()))
+		resp.MissingInput = missing
+		resp.MissingReason = reasons
+		return resp, nil
+	}
+	err = a.writeCmdFiles(ctx, s.CmdStorage)
+	if err != nil {
+		return nil, err
+	}
+	err = a.prepareOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	docker := s.Docker
+	if docker == "" {
+		docker = "docker"
+	}
+	cmd := exec.CommandContext(cctx, docker, a.dockerArgs(image)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	t := time.Now()
+	err = cmd.Run()
+	var exitCode int
+	if err != nil {
+		var eerr *exec.ExitError
+		if !errors.As(err, &eerr) || cctx.Err() != nil {
+			return nil, fmt.Errorf("docker run: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		exitCode = eerr.ExitCode()
+	}
+	logger.Infof("docker run %s exit=%d in %s", image, exitCode, time.Since(t))
+
+	resp.CacheHit = gomapb.ExecResp_NO_CACHE.Enum()
+	resp.Result.ExitStatus = proto.Int32(int32(exitCode))
+	resp.Result.StdoutBuffer = stdout.Bytes()
+	resp.Result.StderrBuffer = stderr.Bytes()
+	resp.Result.Output, err = a.outputs(ctx, s.GomaFile)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) image(cmdConfig *cmdpb.Config) string {
+	for _, p := range cmdConfig.GetRemoteexecPlatform().GetProperties() {
+		if p.Name == "container-image" {
+			return strings.TrimPrefix(p.Value, "docker://")
+		}
+	}
+	return strings.TrimPrefix(s.ContainerImage, "docker://")
+}
+
+// action is a command to run in a container.
+type action struct {
+	req      *gomapb.ExecReq
+	cmdFiles []*cmdpb.FileSpec
+
+	// cwd is client's working directory.
+	cwd string
+	// rootDir is client's directory mounted in a container.
+	rootDir string
+	// root is local directory for rootDir.
+	root string
+}
+
+func newAction(req *gomapb.ExecReq, cmdFiles []*cmdpb.FileSpec) (*action, error) {
+	cwd := path.Clean(req.GetCwd())
+	if !path.IsAbs(cwd) {
+		return nil, fmt.Errorf("cwd is not absolute: %q", req.GetCwd())
+	}
+	a := &action{
+		req:      req,
+		cmdFiles: cmdFiles,
+		cwd:      cwd,
+	}
+	paths := []string{cwd}
+	for _, input := range req.GetInput() {
+		paths = append(paths, path.Dir(a.abs(input.GetFilename())))
+	}
+	for _, f := range req.GetExpectedOutputFiles() {
+		paths = append(paths, path.Dir(a.abs(f)))
+	}
+	for _, d := range req.GetExpectedOutputDirs() {
+		paths = append(paths, a.abs(d))
+	}
+	a.rootDir = commonDir(paths)
+	if a.rootDir == "/" {
+		return nil, fmt.Errorf("no input root other than / for cwd=%s", cwd)
+	}
+	return a, nil
+}
+
+// abs returns absolute path of client's fname.
+func (a *action) abs(fname string) string {
+	if path.IsAbs(fname) {
+		return path.Clean(fname)
+	}
+	return path.Join(a.cwd, fname)
+}
+
+// local returns local path of client's fname, and reports
+// whether it is in rootDir.
+func (a *action) local(fname string) (string, bool) {
+	p := a.abs(fname)
+	if p != a.rootDir && !strings.HasPrefix(p, a.rootDir+"/") {
+		return "", false
+	}
+	return filepath.Join(a.root, filepath.FromSlash(strings.TrimPrefix(p, a.rootDir))), true
+}
+
+// commonDir returns common ancestor directory of absolute paths.
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return "/"
+	}
+	dir := paths[0]
+	for _, p := range paths[1:] {
+		for dir != "/" && p != dir && !strings.HasPrefix(p, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// writeInputs writes request inputs in root.
+// It returns missing inputs, which are not in request nor in file service.
+func (a *action) writeInputs(ctx context.Context, fc fpb.FileServiceClient) ([]string, []string, error) {
+	executables := make(map[string]bool)
+	for _, ts := range a.req.GetToolchainSpecs() {
+		if ts.GetIsExecutable() {
+			executables[a.abs(ts.GetPath())] = true
+		}
+	}
+	inputs := a.req.GetInput()
+	missing := make([]bool, len(inputs))
+	errs := make([]error, len(inputs))
+	sema := make(chan struct{}, inputConcurrency)
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		sema <- struct{}{}
+		go func(i int, input *gomapb.ExecReq_Input) {
+			defer wg.Done()
+			defer func() { <-sema }()
+			fname, ok := a.local(input.GetFilename())
+			if !ok {
+				// never happen. rootDir is computed from inputs.
+				errs[i] = fmt.Errorf("input %s is out of root %s", input.GetFilename(), a.rootDir)
+				return
+			}
+			blob := input.GetContent()
+			if !file.IsValid(blob) && input.GetHashKey() == "" {
+				// client may omit hash_key of the file by
+				// metadata hints, which is not supported here.
+				// client will retry with hash_key or content.
+				missing[i] = true
+				return
+			}
+			if !file.IsValid(blob) {
+				lresp, err := fc.LookupFile(ctx, &gomapb.LookupFileReq{
+					HashKey:       []string{input.GetHashKey()},
+					RequesterInfo: a.req.GetRequesterInfo(),
+				})
+				if err != nil {
+					errs[i] = fmt.Errorf("lookup %s %s: %v", input.GetFilename(), input.GetHashKey(), err)
+					return
+				}
+				if len(lresp.Blob) == 0 || !file.IsValid(lresp.Blob[0]) {
+					missing[i] = true
+					return
+				}
+				blob = lresp.Blob[0]
+			}
+			err := os.MkdirAll(filepath.Dir(fname), 0755)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			err = file.ToLocal(ctx, fc, blob, fname)
+			if err != nil {
+				errs[i] = fmt.Errorf("input %s: %v", input.GetFilename(), err)
+				return
+			}
+			if executables[a.abs(input.GetFilename())] {
+				errs[i] = os.Chmod(fname, 0755)
+			}
+		}(i, input)
+	}
+	wg.Wait()
+	var missingInputs, missingReasons []string
+	for i, input := range inputs {
+		if errs[i] != nil {
+			return nil, nil, errs[i]
+		}
+		if missing[i] {
+			missingInputs = append(missingInputs, input.GetFilename())
+			missingReasons = append(missingReasons, "input: not found")
+		}
+	}
+	return missingInputs, missingReasons, nil
+}
+
+// writeCmdFiles writes toolchain files not included in request inputs.
+func (a *action) writeCmdFiles(ctx context.Context, cmdStorage CmdStorage) error {
+	logger := log.FromContext(ctx)
+	inputs := make(map[string]bool)
+	for _, input := range a.req.GetInput() {
+		inputs[a.abs(input.GetFilename())] = true
+	}
+	for _, fs := range a.cmdFiles {
+		if inputs[a.abs(fs.Path)] {
+			continue
+		}
+		fname, ok := a.local(fs.Path)
+		if !ok {
+			// expect it in the container image.
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(fname), 0755)
+		if err != nil {
+			return err
+		}
+		if fs.Symlink != "" {
+			err = os.Symlink(fs.Symlink, fname)
+			if err != nil && !os.IsExist(err) {
+				return err
+			}
+			continue
+		}
+		if cmdStorage == nil {
+			logger.Warnf("no cmd storage for %s", fs.Path)
+			continue
+		}
+		err = writeCmdFile(ctx, cmdStorage, fs, fname)
+		if err != nil {
+			return fmt.Errorf("cmd file %s: %v", fs.Path, err)
+		}
+	}
+	return nil
+}
+
+func writeCmdFile(ctx context.Context, cmdStorage CmdStorage, fs *cmdpb.FileSpec, fname string) error {
+	rd, err := cmdStorage.Open(ctx, fs.Hash)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	var mode os.FileMode = 0644
+	if fs.IsExecutable {
+		mode = 0755
+	}
+	w, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rd)
+	cerr := w.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// prepareOutputs creates directories for outputs, and
+// system include dirs that are in the input root.
+func (a *action) prepareOutputs() error {
+	var dirs []string
+	for _, f := range a.req.GetExpectedOutputFiles() {
+		dirs = append(dirs, path.Dir(a.abs(f)))
+	}
+	dirs = append(dirs, a.req.GetExpectedOutputDirs()...)
+	dirs = append(dirs, a.req.GetCommandSpec().GetCxxSystemIncludePath()...)
+	dirs = append(dirs, a.req.GetCommandSpec().GetSystemIncludePath()...)
+	dirs = append(dirs, a.req.GetCommandSpec().GetSystemFrameworkPath()...)
+	dirs = append(dirs, a.cwd)
+	for _, d := range dirs {
+		dir, ok := a.local(d)
+		if !ok {
+			continue
+		}
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dockerArgs returns args of docker command to run the action in image.
+func (a *action) dockerArgs(image string) []string {
+	args := []string{
+		"run", "--rm",
+		"--network", "none",
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--volume", a.root + ":" + a.rootDir,
+		"--workdir", a.cwd,
+	}
+	for _, e := range a.req.GetEnv() {
+		args = append(args, "--env", e)
+	}
+	args = append(args, image, a.cmdFiles[0].Path)
+	args = append(args, a.req.GetArg()[1:]...)
+	return args
+}
+
+// outputs stores outputs in file service, and returns them.
+func (a *action) outputs(ctx context.Context, fc fpb.FileServiceClient) ([]*gomapb.ExecResult_Output, error) {
+	var outputs []*gomapb.ExecResult_Output
+	add := func(name, fname string) error {
+		blob := &gomapb.FileBlob{}
+		fi, err := file.FromLocal(ctx, fc, fname, blob)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, &gomapb.ExecResult_Output{
+			Filename:     proto.String(name),
+			Blob:         blob,
+			IsExecutable: proto.Bool(fi.Mode()&0100 != 0),
+		})
+		return nil
+	}
+	for _, f := range a.req.GetExpectedOutputFiles() {
+		fname, _ := a.local(f)
+		fi, err := os.Stat(fname)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		err = add(f, fname)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %v", f, err)
+		}
+	}
+	for _, d := range a.req.GetExpectedOutputDirs() {
+		dname, _ := a.local(d)
+		err := filepath.Walk(dname, func(fname string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dname, fname)
+			if err != nil {
+				return err
+			}
+			return add(path.Join(d, filepath.ToSlash(rel)), fname)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("output dir %s: %v", d, err)
+		}
+	}
+	return outputs, nil
+}
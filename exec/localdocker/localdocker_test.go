@@ -0,0 +1,222 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package localdocker
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+	fpb "go.chromium.org/goma/server/proto/file"
+)
+
+func TestCommonDir(t *testing.T) {
+	for _, tc := range []struct {
+		paths []string
+		want  string
+	}{
+		{
+			paths: nil,
+			want:  "/",
+		},
+		{
+			paths: []string{"/b/c/src/out/Release"},
+			want:  "/b/c/src/out/Release",
+		},
+		{
+			paths: []string{
+				"/b/c/src/out/Release",
+				"/b/c/src/base",
+				"/b/c/src/out/Release/gen",
+			},
+			want: "/b/c/src",
+		},
+		{
+			paths: []string{
+				"/b/c/src/out",
+				"/b/c/src-internal",
+			},
+			want: "/b/c",
+		},
+		{
+			paths: []string{
+				"/b/c/src",
+				"/usr/include",
+			},
+			want: "/",
+		},
+	} {
+		got := commonDir(tc.paths)
+		if got != tc.want {
+			t.Errorf("commonDir(%q)=%q; want %q", tc.paths, got, tc.want)
+		}
+	}
+}
+
+func TestNewAction(t *testing.T) {
+	req := &gomapb.ExecReq{
+		Cwd: proto.String("/b/c/src/out/Release"),
+		Arg: []string{"../../third_party/llvm-build/bin/clang++", "-c", "../../base/foo.cc", "-o", "obj/base/foo.o"},
+		Env: []string{"PWD=/b/c/src/out/Release"},
+		Input: []*gomapb.ExecReq_Input{
+			{Filename: proto.String("../../base/foo.cc")},
+			{Filename: proto.String("/b/c/src/base/foo.h")},
+		},
+		ExpectedOutputFiles: []string{"obj/base/foo.o"},
+	}
+	cmdFiles := []*cmdpb.FileSpec{
+		{Path: "../../third_party/llvm-build/bin/clang++"},
+	}
+	a, err := newAction(req, cmdFiles)
+	if err != nil {
+		t.Fatalf("newAction(req, cmdFiles)=_, %v; want nil err", err)
+	}
+	if got, want := a.rootDir, "/b/c/src"; got != want {
+		t.Errorf("rootDir=%q; want %q", got, want)
+	}
+	a.root = filepath.FromSlash("/tmp/goma-localdocker")
+
+	for _, tc := range []struct {
+		fname  string
+		want   string
+		wantOK bool
+	}{
+		{
+			fname:  "../../base/foo.cc",
+			want:   filepath.FromSlash("/tmp/goma-localdocker/base/foo.cc"),
+			wantOK: true,
+		},
+		{
+			fname:  "obj/base/foo.o",
+			want:   filepath.FromSlash("/tmp/goma-localdocker/out/Release/obj/base/foo.o"),
+			wantOK: true,
+		},
+		{
+			fname: "/usr/include/stdio.h",
+		},
+		{
+			fname: "/b/c/src-internal/foo.h",
+		},
+	} {
+		got, ok := a.local(tc.fname)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("local(%q)=%q, %t; want %q, %t", tc.fname, got, ok, tc.want, tc.wantOK)
+		}
+	}
+
+	args := a.dockerArgs("gcr.io/goma/image@sha256:0123")
+	// drop "--user" value, which depends on the test runner.
+	for i, arg := range args {
+		if arg == "--user" {
+			args = append(args[:i+1], args[i+2:]...)
+			break
+		}
+	}
+	want := []string{
+		"run", "--rm",
+		"--network", "none",
+		"--user",
+		"--volume", "/tmp/goma-localdocker:/b/c/src",
+		"--workdir", "/b/c/src/out/Release",
+		"--env", "PWD=/b/c/src/out/Release",
+		"gcr.io/goma/image@sha256:0123",
+		"../../third_party/llvm-build/bin/clang++", "-c", "../../base/foo.cc", "-o", "obj/base/foo.o",
+	}
+	if diff := cmp.Diff(want, args); diff != "" {
+		t.Errorf("dockerArgs diff -want +got:\n%s", diff)
+	}
+}
+
+func TestNewActionNoRoot(t *testing.T) {
+	req := &gomapb.ExecReq{
+		Cwd: proto.String("/b/c/src/out/Release"),
+		Arg: []string{"clang++", "-c", "/tmp/foo.cc"},
+		Input: []*gomapb.ExecReq_Input{
+			{Filename: proto.String("/tmp/foo.cc")},
+		},
+	}
+	_, err := newAction(req, []*cmdpb.FileSpec{{Path: "clang++"}})
+	if err == nil {
+		t.Errorf("newAction(req, cmdFiles)=_, nil; want error")
+	}
+}
+
+func TestImage(t *testing.T) {
+	s := &Server{
+		ContainerImage: "docker://gcr.io/goma/default@sha256:0123",
+	}
+	for _, tc := range []struct {
+		cfg  *cmdpb.Config
+		want string
+	}{
+		{
+			cfg:  &cmdpb.Config{},
+			want: "gcr.io/goma/default@sha256:0123",
+		},
+		{
+			cfg: &cmdpb.Config{
+				RemoteexecPlatform: &cmdpb.RemoteexecPlatform{
+					Properties: []*cmdpb.RemoteexecPlatform_Property{
+						{Name: "OSFamily", Value: "Linux"},
+						{Name: "container-image", Value: "docker://gcr.io/goma/clang@sha256:4567"},
+					},
+				},
+			},
+			want: "gcr.io/goma/clang@sha256:4567",
+		},
+	} {
+		got := s.image(tc.cfg)
+		if got != tc.want {
+			t.Errorf("image(%v)=%q; want %q", tc.cfg, got, tc.want)
+		}
+	}
+}
+
+type noLookupFileClient struct {
+	fpb.FileServiceClient
+	t *testing.T
+}
+
+func (c noLookupFileClient) LookupFile(ctx context.Context, req *gomapb.LookupFileReq, opts ...grpc.CallOption) (*gomapb.LookupFileResp, error) {
+	c.t.Errorf("LookupFile(%q) called", req.GetHashKey())
+	return nil, errors.New("unexpected LookupFile")
+}
+
+func TestWriteInputsNoHashKey(t *testing.T) {
+	ctx := context.Background()
+	req := &gomapb.ExecReq{
+		Cwd: proto.String("/b/c/src/out/Release"),
+		Arg: []string{"clang++", "-c", "../../base/foo.cc"},
+		Input: []*gomapb.ExecReq_Input{
+			{
+				// hash_key omitted by metadata hints.
+				Filename: proto.String("../../base/foo.cc"),
+				HashKey:  proto.String(""),
+			},
+		},
+	}
+	a, err := newAction(req, nil)
+	if err != nil {
+		t.Fatalf("newAction(req, nil)=_, %v; want nil err", err)
+	}
+	a.root = t.TempDir()
+	missing, reasons, err := a.writeInputs(ctx, noLookupFileClient{t: t})
+	if err != nil {
+		t.Fatalf("writeInputs=_, _, %v; want nil err", err)
+	}
+	if diff := cmp.Diff([]string{"../../base/foo.cc"}, missing); diff != "" {
+		t.Errorf("missing inputs diff -want +got:\n%s", diff)
+	}
+	if len(reasons) != 1 {
+		t.Errorf("missing reasons=%q; want 1 reason", reasons)
+	}
+}
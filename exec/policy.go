@@ -0,0 +1,301 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	"go.chromium.org/goma/server/log"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// PolicyInput is an input of authorization policy for exec request.
+type PolicyInput struct {
+	// Email and Group are the end user's email and the ACL group
+	// the user's token matched.
+	Email string `json:"email"`
+	Group string `json:"group"`
+
+	// Requester is requester info of the request.
+	Requester PolicyRequester `json:"requester"`
+
+	// Command is the command selector of the request.
+	Command PolicyCommand `json:"command"`
+}
+
+// PolicyRequester is requester attributes in PolicyInput.
+type PolicyRequester struct {
+	Username      string   `json:"username,omitempty"`
+	CompilerProxy string   `json:"compiler_proxy_id,omitempty"`
+	GomaRevision  string   `json:"goma_revision,omitempty"`
+	BuildID       string   `json:"build_id,omitempty"`
+	Dimensions    []string `json:"dimensions,omitempty"`
+	PathStyle     string   `json:"path_style,omitempty"`
+}
+
+// PolicyCommand is command selector in PolicyInput.
+type PolicyCommand struct {
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Target     string `json:"target,omitempty"`
+	BinaryHash string `json:"binary_hash,omitempty"`
+}
+
+// NewPolicyInput creates PolicyInput for req.
+func NewPolicyInput(ctx context.Context, req *gomapb.ExecReq) PolicyInput {
+	var in PolicyInput
+	if u, ok := enduser.FromContext(ctx); ok {
+		in.Email = string(u.Email)
+		in.Group = u.Group
+	}
+	ri := req.GetRequesterInfo()
+	in.Requester = PolicyRequester{
+		Username:      ri.GetUsername(),
+		CompilerProxy: ri.GetCompilerProxyId(),
+		GomaRevision:  ri.GetGomaRevision(),
+		BuildID:       ri.GetBuildId(),
+		Dimensions:    ri.GetDimensions(),
+	}
+	if ri != nil && ri.PathStyle != nil {
+		in.Requester.PathStyle = ri.GetPathStyle().String()
+	}
+	cs := req.GetCommandSpec()
+	in.Command = PolicyCommand{
+		Name:       cs.GetName(),
+		Version:    cs.GetVersion(),
+		Target:     cs.GetTarget(),
+		BinaryHash: fmt.Sprintf("%x", cs.GetBinaryHash()),
+	}
+	return in
+}
+
+// Decision is a decision of authorization policy.
+type Decision struct {
+	Allow bool `json:"allow"`
+	// Reason is a message why the request is denied.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Policy is an authorization policy of exec request,
+// in addition to group matching in ACL.
+type Policy interface {
+	Authorize(ctx context.Context, in PolicyInput) (Decision, error)
+}
+
+// Default config of CachedPolicy.
+const (
+	DefaultPolicyCacheTTL        = 10 * time.Second
+	DefaultPolicyCacheMaxEntries = 10000
+)
+
+// CachedPolicy caches decisions of Policy per group and command for
+// a short time, so that the policy is not evaluated for every request.
+// Decisions must depend only on group and command while cached,
+// since other attributes of PolicyInput are not in the cache key.
+// Errors are not cached.
+type CachedPolicy struct {
+	Policy Policy
+
+	// TTL is duration to keep decisions.
+	// 0 means DefaultPolicyCacheTTL.
+	TTL time.Duration
+
+	// MaxEntries is max number of decisions to keep.
+	// 0 means DefaultPolicyCacheMaxEntries.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries *lru.Cache // policyCacheKey -> policyCacheEntry
+
+	// for test.
+	now func() time.Time
+}
+
+type policyCacheKey struct {
+	Group   string
+	Command PolicyCommand
+}
+
+type policyCacheEntry struct {
+	d      Decision
+	expire time.Time
+}
+
+// Authorize authorizes in by cached decision if it is not expired,
+// or by the policy.
+func (p *CachedPolicy) Authorize(ctx context.Context, in PolicyInput) (Decision, error) {
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	key := policyCacheKey{Group: in.Group, Command: in.Command}
+	p.mu.Lock()
+	if p.entries == nil {
+		maxEntries := p.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = DefaultPolicyCacheMaxEntries
+		}
+		p.entries = lru.New(maxEntries)
+	}
+	v, ok := p.entries.Get(key)
+	p.mu.Unlock()
+	if ok {
+		e := v.(policyCacheEntry)
+		if now().Before(e.expire) {
+			return e.d, nil
+		}
+	}
+	d, err := p.Policy.Authorize(ctx, in)
+	if err != nil {
+		return d, err
+	}
+	ttl := p.TTL
+	if ttl <= 0 {
+		ttl = DefaultPolicyCacheTTL
+	}
+	p.mu.Lock()
+	p.entries.Add(key, policyCacheEntry{d: d, expire: now().Add(ttl)})
+	p.mu.Unlock()
+	return d, nil
+}
+
+// policy result
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+	policyError = "error"
+)
+
+// Authorize authorizes req by policy.
+// It returns BAD_REQUEST response if req is denied by the policy,
+// or nil if the request can be processed.
+// nil policy allows all requests.
+// If the policy fails to evaluate, req is allowed unless failClosed.
+func Authorize(ctx context.Context, policy Policy, failClosed bool, req *gomapb.ExecReq) *gomapb.ExecResp {
+	if policy == nil {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	in := NewPolicyInput(ctx, req)
+	d, err := policy.Authorize(ctx, in)
+	var result string
+	switch {
+	case err != nil:
+		result = policyError
+		logger.Errorf("authorization policy error for %s: %v", in.Group, err)
+		if !failClosed {
+			recordPolicyDecision(ctx, result)
+			return nil
+		}
+		d = Decision{Reason: "authorization policy is not available"}
+	case d.Allow:
+		result = policyAllow
+	default:
+		result = policyDeny
+	}
+	recordPolicyDecision(ctx, result)
+	if d.Allow {
+		return nil
+	}
+	msg := fmt.Sprintf("%s is not allowed for group %s", in.Command.Name, in.Group)
+	if d.Reason != "" {
+		msg += ": " + d.Reason
+	}
+	logger.Warnf("reject by policy: %s", msg)
+	return &gomapb.ExecResp{
+		Error:        gomapb.ExecResp_BAD_REQUEST.Enum(),
+		ErrorMessage: []string{msg},
+	}
+}
+
+func recordPolicyDecision(ctx context.Context, result string) {
+	err := stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(policyResultKey, result)}, policyDecisions.M(1))
+	if err != nil {
+		logger := log.FromContext(ctx)
+		logger.Errorf("failed to record policy decision: %v", err)
+	}
+}
+
+// OPAPolicy is a Policy evaluated by Open Policy Agent.
+// It queries OPA data API with PolicyInput as input, and
+// expects result is a boolean, or an object with "allow" and
+// optional "reason".
+// https://www.openpolicyagent.org/docs/latest/rest-api/#get-a-document-with-input
+type OPAPolicy struct {
+	// URL is an URL of OPA data API of the decision,
+	// e.g. http://localhost:8181/v1/data/goma/exec.
+	URL string
+
+	// Client is http client to access OPA.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Authorize authorizes in by OPA.
+func (p OPAPolicy) Authorize(ctx context.Context, in PolicyInput) (Decision, error) {
+	body, err := json.Marshal(struct {
+		Input PolicyInput `json:"input"`
+	}{
+		Input: in,
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Decision{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("opa %s: %s: %s", p.URL, resp.Status, b)
+	}
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return Decision{}, fmt.Errorf("opa %s: bad response %q: %v", p.URL, b, err)
+	}
+	if len(r.Result) == 0 {
+		// undefined decision.
+		return Decision{}, fmt.Errorf("opa %s: no result", p.URL)
+	}
+	var allow bool
+	if json.Unmarshal(r.Result, &allow) == nil {
+		return Decision{Allow: allow}, nil
+	}
+	var d Decision
+	err = json.Unmarshal(r.Result, &d)
+	if err != nil {
+		return Decision{}, fmt.Errorf("opa %s: bad result %s: %v", p.URL, r.Result, err)
+	}
+	return d, nil
+}
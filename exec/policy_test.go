@@ -0,0 +1,226 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestOPAPolicy(t *testing.T) {
+	// policy: interns may only use clang.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var r struct {
+			Input PolicyInput `json:"input"`
+		}
+		err := json.NewDecoder(req.Body).Decode(&r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch r.Input.Group {
+		case "intern":
+			if r.Input.Command.Name == "clang" {
+				fmt.Fprint(w, `{"result": {"allow": true}}`)
+				return
+			}
+			fmt.Fprint(w, `{"result": {"allow": false, "reason": "interns may only use clang"}}`)
+		case "staff":
+			fmt.Fprint(w, `{"result": true}`)
+		case "undefined":
+			fmt.Fprint(w, `{}`)
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+	p := OPAPolicy{URL: s.URL}
+
+	for _, tc := range []struct {
+		group   string
+		command string
+		want    Decision
+		wantErr bool
+	}{
+		{
+			group:   "intern",
+			command: "clang",
+			want:    Decision{Allow: true},
+		},
+		{
+			group:   "intern",
+			command: "gcc",
+			want:    Decision{Reason: "interns may only use clang"},
+		},
+		{
+			group:   "staff",
+			command: "gcc",
+			want:    Decision{Allow: true},
+		},
+		{
+			group:   "undefined",
+			command: "gcc",
+			wantErr: true,
+		},
+		{
+			group:   "error",
+			command: "gcc",
+			wantErr: true,
+		},
+	} {
+		in := PolicyInput{
+			Group: tc.group,
+			Command: PolicyCommand{
+				Name: tc.command,
+			},
+		}
+		got, err := p.Authorize(context.Background(), in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Authorize(%q, %q)=%v, nil; want error", tc.group, tc.command, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("Authorize(%q, %q)=%v, %v; want %v, nil", tc.group, tc.command, got, err, tc.want)
+		}
+	}
+}
+
+type fakePolicy struct {
+	in  PolicyInput
+	d   Decision
+	err error
+}
+
+func (p *fakePolicy) Authorize(ctx context.Context, in PolicyInput) (Decision, error) {
+	p.in = in
+	return p.d, p.err
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := enduser.NewContext(context.Background(), enduser.New("intern@example.com", "intern", nil))
+	req := &gomapb.ExecReq{
+		CommandSpec: &gomapb.CommandSpec{
+			Name:    proto.String("gcc"),
+			Version: proto.String("4.8"),
+			Target:  proto.String("x86_64-linux-gnu"),
+		},
+		RequesterInfo: &gomapb.RequesterInfo{
+			GomaRevision: proto.String("0123456789abcdef@1577836800"),
+		},
+	}
+
+	if resp := Authorize(ctx, nil, true, req); resp != nil {
+		t.Errorf("Authorize(nil policy)=%v; want nil", resp)
+	}
+
+	p := &fakePolicy{d: Decision{Allow: true}}
+	if resp := Authorize(ctx, p, true, req); resp != nil {
+		t.Errorf("Authorize(allow)=%v; want nil", resp)
+	}
+	want := PolicyInput{
+		Email: "intern@example.com",
+		Group: "intern",
+		Requester: PolicyRequester{
+			GomaRevision: "0123456789abcdef@1577836800",
+		},
+		Command: PolicyCommand{
+			Name:    "gcc",
+			Version: "4.8",
+			Target:  "x86_64-linux-gnu",
+		},
+	}
+	if fmt.Sprint(p.in) != fmt.Sprint(want) {
+		t.Errorf("policy input=%v; want %v", p.in, want)
+	}
+
+	p = &fakePolicy{d: Decision{Reason: "interns may only use clang"}}
+	resp := Authorize(ctx, p, false, req)
+	if resp.GetError() != gomapb.ExecResp_BAD_REQUEST {
+		t.Errorf("Authorize(deny)=%v; want BAD_REQUEST", resp)
+	}
+
+	p = &fakePolicy{err: errors.New("policy unavailable")}
+	if resp := Authorize(ctx, p, false, req); resp != nil {
+		t.Errorf("Authorize(error, fail open)=%v; want nil", resp)
+	}
+	resp = Authorize(ctx, p, true, req)
+	if resp.GetError() != gomapb.ExecResp_BAD_REQUEST {
+		t.Errorf("Authorize(error, fail closed)=%v; want BAD_REQUEST", resp)
+	}
+}
+
+type countPolicy struct {
+	n   int
+	err error
+}
+
+func (p *countPolicy) Authorize(ctx context.Context, in PolicyInput) (Decision, error) {
+	p.n++
+	if p.err != nil {
+		return Decision{}, p.err
+	}
+	return Decision{Allow: in.Command.Name == "clang"}, nil
+}
+
+func TestCachedPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cp := &countPolicy{}
+	p := &CachedPolicy{
+		Policy: cp,
+		now:    func() time.Time { return now },
+	}
+	input := func(group, command, email string) PolicyInput {
+		return PolicyInput{
+			Email:   email,
+			Group:   group,
+			Command: PolicyCommand{Name: command},
+		}
+	}
+	authorize := func(in PolicyInput, want Decision, wantCalls int) {
+		t.Helper()
+		d, err := p.Authorize(ctx, in)
+		if err != nil || d != want {
+			t.Errorf("Authorize(%v)=%v, %v; want %v, nil", in, d, err, want)
+		}
+		if cp.n != wantCalls {
+			t.Errorf("policy calls=%d; want %d", cp.n, wantCalls)
+		}
+	}
+
+	authorize(input("intern", "clang", "a@example.com"), Decision{Allow: true}, 1)
+	authorize(input("intern", "clang", "b@example.com"), Decision{Allow: true}, 1)
+	authorize(input("intern", "gcc", "a@example.com"), Decision{}, 2)
+	authorize(input("staff", "clang", "a@example.com"), Decision{Allow: true}, 3)
+	authorize(input("intern", "gcc", "a@example.com"), Decision{}, 3)
+
+	now = now.Add(DefaultPolicyCacheTTL)
+	authorize(input("intern", "clang", "a@example.com"), Decision{Allow: true}, 4)
+
+	t.Logf("errors are not cached")
+	cp.err = errors.New("policy unavailable")
+	in := input("intern", "cl.exe", "a@example.com")
+	for i := 0; i < 2; i++ {
+		if _, err := p.Authorize(ctx, in); err == nil {
+			t.Errorf("Authorize(%v)=_, nil; want error", in)
+		}
+	}
+	if cp.n != 6 {
+		t.Errorf("policy calls=%d; want 6", cp.n)
+	}
+}
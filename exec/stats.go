@@ -13,6 +13,7 @@ import (
 	"go.opencensus.io/tag"
 
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 	gomapb "go.chromium.org/goma/server/proto/api"
 )
 
@@ -25,35 +26,61 @@ var (
 		"go.chromium.org/goma/server/exec.client-retry",
 		"exec request per client retry",
 		stats.UnitDimensionless)
+	clientVersions = stats.Int64(
+		"go.chromium.org/goma/server/exec.client-version",
+		"exec request per client version",
+		stats.UnitDimensionless)
+	policyDecisions = stats.Int64(
+		"go.chromium.org/goma/server/exec.policy-decision",
+		"exec request per authorization policy decision",
+		stats.UnitDimensionless)
 
-	apiErrorKey    = tag.MustNewKey("api-error")
-	clientRetryKey = tag.MustNewKey("client-retry")
+	apiErrorKey            = tag.MustNewKey("api-error")
+	clientRetryKey         = tag.MustNewKey("client-retry")
+	clientVersionStatusKey = tag.MustNewKey("client-version-status")
+	policyResultKey        = tag.MustNewKey("policy-result")
 
 	// DefaultViews are the default views provided by this package.
 	// You need to register the view for data to actually be collected.
 	DefaultViews = []*view.View{
 		{
 			Description: "exec request api-error",
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				apiErrorKey,
-			},
+			),
 			Measure:     apiErrors,
 			Aggregation: view.Count(),
 		},
 		{
 			Description: "exec request client retry",
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				clientRetryKey,
-			},
+			),
 			Measure:     clientRetries,
 			Aggregation: view.Count(),
 		},
+		{
+			Description: `exec request per client version. status is "ok", "unknown", "deprecated" or "rejected"`,
+			TagKeys: metrics.TagKeys(
+				clientVersionStatusKey,
+			),
+			Measure:     clientVersions,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: `exec request per authorization policy decision. result is "allow", "deny" or "error"`,
+			TagKeys: metrics.TagKeys(
+				policyResultKey,
+			),
+			Measure:     policyDecisions,
+			Aggregation: view.Count(),
+		},
 		{
 			Description: `counts toolchain selection. result is "used", "found", "requested" or "missed"`,
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				selectorKey,
 				resultKey,
-			},
+			),
 			Measure:     toolchainSelects,
 			Aggregation: view.Count(),
 		},
@@ -0,0 +1,153 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// ClientVersion is a version of goma client.
+type ClientVersion struct {
+	// Hash is commit hash of the client.
+	Hash string
+	// Time is commit time of the client.
+	Time time.Time
+}
+
+func (v ClientVersion) String() string {
+	return fmt.Sprintf("%s@%d", v.Hash, v.Time.Unix())
+}
+
+// ParseClientVersion parses goma client version in requester info.
+// goma_revision is "<commitHash>@<commitTime>", same as in user-agent.
+func ParseClientVersion(reqInfo *gomapb.RequesterInfo) (ClientVersion, error) {
+	rev := reqInfo.GetGomaRevision()
+	i := strings.IndexByte(rev, '@')
+	if i <= 0 {
+		return ClientVersion{}, fmt.Errorf("bad goma_revision %q", rev)
+	}
+	t, err := strconv.ParseInt(rev[i+1:], 10, 64)
+	if err != nil {
+		return ClientVersion{}, fmt.Errorf("bad goma_revision %q: %v", rev, err)
+	}
+	return ClientVersion{
+		Hash: rev[:i],
+		Time: time.Unix(t, 0),
+	}, nil
+}
+
+// VersionPolicy is a policy on goma client versions.
+// Zero value accepts all clients.
+type VersionPolicy struct {
+	// MinTime is the minimum commit time of clients.
+	// Requests from older clients are rejected with BAD_REQUEST.
+	MinTime time.Time
+
+	// DeprecatedTime is the commit time before which clients are
+	// deprecated. Responses to deprecated clients have
+	// a deprecation warning in stderr.
+	DeprecatedTime time.Time
+
+	// Message is an additional message for rejected or deprecated clients,
+	// e.g. how to upgrade.
+	Message string
+
+	// RejectUnknown rejects requests from clients without valid version.
+	RejectUnknown bool
+}
+
+// version status
+const (
+	versionOK         = "ok"
+	versionUnknown    = "unknown"
+	versionDeprecated = "deprecated"
+	versionRejected   = "rejected"
+)
+
+func (p VersionPolicy) check(v ClientVersion, err error) string {
+	if err != nil {
+		if p.RejectUnknown {
+			return versionRejected
+		}
+		return versionUnknown
+	}
+	if !p.MinTime.IsZero() && v.Time.Before(p.MinTime) {
+		return versionRejected
+	}
+	if !p.DeprecatedTime.IsZero() && v.Time.Before(p.DeprecatedTime) {
+		return versionDeprecated
+	}
+	return versionOK
+}
+
+func (p VersionPolicy) message(msg string) string {
+	if p.Message == "" {
+		return msg
+	}
+	return msg + ": " + p.Message
+}
+
+// Check checks client version of req.
+// It returns BAD_REQUEST response if the client is rejected by the policy,
+// or nil if the request can be processed.
+func (p VersionPolicy) Check(ctx context.Context, req *gomapb.ExecReq) *gomapb.ExecResp {
+	logger := log.FromContext(ctx)
+	v, err := ParseClientVersion(req.GetRequesterInfo())
+	s := p.check(v, err)
+	recordClientVersion(ctx, v, s)
+	if s != versionRejected {
+		return nil
+	}
+	var msg string
+	if err != nil {
+		msg = fmt.Sprintf("unknown goma client version: %v", err)
+	} else {
+		msg = fmt.Sprintf("goma client %s is too old. need goma client built after %s", v, p.MinTime.UTC().Format(time.RFC3339))
+	}
+	logger.Warnf("reject client: %s", msg)
+	return &gomapb.ExecResp{
+		Error:        gomapb.ExecResp_BAD_REQUEST.Enum(),
+		ErrorMessage: []string{p.message(msg)},
+	}
+}
+
+// Annotate adds deprecation warning to stderr in resp
+// if the client of req is deprecated by the policy.
+func (p VersionPolicy) Annotate(ctx context.Context, req *gomapb.ExecReq, resp *gomapb.ExecResp) {
+	v, err := ParseClientVersion(req.GetRequesterInfo())
+	if p.check(v, err) != versionDeprecated {
+		return
+	}
+	if resp.GetResult() == nil {
+		return
+	}
+	msg := fmt.Sprintf("goma: warning: goma client %s is deprecated. please update goma client built after %s", v, p.DeprecatedTime.UTC().Format(time.RFC3339))
+	resp.Result.StderrBuffer = append([]byte(p.message(msg)+"\n"), resp.Result.StderrBuffer...)
+}
+
+func recordClientVersion(ctx context.Context, v ClientVersion, s string) {
+	mutators := []tag.Mutator{
+		tag.Upsert(clientVersionStatusKey, s),
+	}
+	if v.Hash != "" {
+		mutators = append(mutators, tag.Upsert(metrics.ClientVersionKey, v.Hash))
+	}
+	err := stats.RecordWithTags(ctx, mutators, clientVersions.M(1))
+	if err != nil {
+		logger := log.FromContext(ctx)
+		logger.Errorf("failed to record client version: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestParseClientVersion(t *testing.T) {
+	v, err := ParseClientVersion(&gomapb.RequesterInfo{
+		GomaRevision: proto.String("0123abcd@1536051887"),
+	})
+	if err != nil {
+		t.Fatalf("ParseClientVersion(...)=%v, %v; want nil error", v, err)
+	}
+	want := ClientVersion{Hash: "0123abcd", Time: time.Unix(1536051887, 0)}
+	if v != want {
+		t.Errorf("ParseClientVersion(...)=%v; want %v", v, want)
+	}
+
+	for _, rev := range []string{"", "0123abcd", "@1536051887", "0123abcd@now"} {
+		v, err := ParseClientVersion(&gomapb.RequesterInfo{
+			GomaRevision: proto.String(rev),
+		})
+		if err == nil {
+			t.Errorf("ParseClientVersion(%q)=%v, nil; want error", rev, v)
+		}
+	}
+}
+
+func TestVersionPolicy(t *testing.T) {
+	ctx := context.Background()
+	p := VersionPolicy{
+		MinTime:        time.Unix(1000, 0),
+		DeprecatedTime: time.Unix(2000, 0),
+		Message:        "run update",
+	}
+	newReq := func(rev string) *gomapb.ExecReq {
+		return &gomapb.ExecReq{
+			RequesterInfo: &gomapb.RequesterInfo{
+				GomaRevision: proto.String(rev),
+			},
+		}
+	}
+	newResp := func() *gomapb.ExecResp {
+		return &gomapb.ExecResp{
+			Result: &gomapb.ExecResult{
+				StderrBuffer: []byte("stderr"),
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		rev            string
+		wantReject     bool
+		wantDeprecated bool
+	}{
+		{rev: "aaaa@999", wantReject: true},
+		{rev: "aaaa@1000", wantDeprecated: true},
+		{rev: "aaaa@2000"},
+		{rev: "unknown"},
+	} {
+		req := newReq(tc.rev)
+		resp := p.Check(ctx, req)
+		if (resp != nil) != tc.wantReject {
+			t.Errorf("Check(%q)=%v; want reject=%t", tc.rev, resp, tc.wantReject)
+		}
+		if resp != nil {
+			if resp.GetError() != gomapb.ExecResp_BAD_REQUEST || len(resp.ErrorMessage) == 0 || !strings.Contains(resp.ErrorMessage[0], "run update") {
+				t.Errorf("Check(%q)=%v; want BAD_REQUEST with message", tc.rev, resp)
+			}
+			continue
+		}
+		resp = newResp()
+		p.Annotate(ctx, req, resp)
+		stderr := string(resp.GetResult().GetStderrBuffer())
+		if got := strings.HasPrefix(stderr, "goma: warning:"); got != tc.wantDeprecated {
+			t.Errorf("Annotate(%q): stderr=%q; want deprecation warning=%t", tc.rev, stderr, tc.wantDeprecated)
+		}
+		if !strings.HasSuffix(stderr, "stderr") {
+			t.Errorf("Annotate(%q): stderr=%q; want original stderr preserved", tc.rev, stderr)
+		}
+	}
+
+	p.RejectUnknown = true
+	if resp := p.Check(ctx, newReq("unknown")); resp == nil {
+		t.Errorf("Check(unknown)=nil with RejectUnknown; want BAD_REQUEST")
+	}
+}
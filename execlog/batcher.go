@@ -0,0 +1,212 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+)
+
+const (
+	// DefaultBatchSize is default number of rows written to sinks at once.
+	DefaultBatchSize = 500
+
+	// DefaultFlushInterval is default interval to write buffered rows.
+	DefaultFlushInterval = 10 * time.Second
+
+	// DefaultQueueSize is default max number of buffered rows.
+	DefaultQueueSize = 100000
+
+	sinkWriteTimeout = 1 * time.Minute
+)
+
+var (
+	sinkRows = stats.Int64(
+		"go.chromium.org/goma/execlog/sink_rows",
+		"number of rows written to sink",
+		stats.UnitDimensionless)
+
+	sinkKey   = tag.MustNewKey("sink")
+	resultKey = tag.MustNewKey("result")
+)
+
+// Batcher buffers rows and writes them to sinks in batches.
+//
+// It implements server.Server, so it could be run with other servers,
+// and it flushes remaining rows at shutdown.
+type Batcher struct {
+	Sinks []Sink
+
+	// BatchSize is max number of rows written to sinks at once.
+	// DefaultBatchSize if zero.
+	BatchSize int
+
+	// FlushInterval is max duration rows are kept in the buffer.
+	// DefaultFlushInterval if zero.
+	FlushInterval time.Duration
+
+	// QueueSize is max number of buffered rows.  rows are dropped
+	// if the buffer is full, e.g. sinks are too slow.
+	// DefaultQueueSize if zero.
+	QueueSize int
+
+	initOnce sync.Once
+	flushCh  chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+
+	mu    sync.Mutex
+	queue []*Row
+}
+
+func (b *Batcher) init() {
+	b.initOnce.Do(func() {
+		b.flushCh = make(chan struct{}, 1)
+		b.quit = make(chan struct{})
+		b.done = make(chan struct{})
+	})
+}
+
+func (b *Batcher) batchSize() int {
+	if b.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return b.BatchSize
+}
+
+func (b *Batcher) flushInterval() time.Duration {
+	if b.FlushInterval <= 0 {
+		return DefaultFlushInterval
+	}
+	return b.FlushInterval
+}
+
+func (b *Batcher) queueSize() int {
+	if b.QueueSize <= 0 {
+		return DefaultQueueSize
+	}
+	return b.QueueSize
+}
+
+// Add adds rows to the buffer.
+// It never blocks; rows exceeding the queue size are dropped.
+func (b *Batcher) Add(ctx context.Context, rows []*Row) {
+	b.init()
+	b.mu.Lock()
+	n := len(rows)
+	if room := b.queueSize() - len(b.queue); n > room {
+		n = room
+		if n < 0 {
+			n = 0
+		}
+	}
+	b.queue = append(b.queue, rows[:n]...)
+	full := len(b.queue) >= b.batchSize()
+	b.mu.Unlock()
+
+	if dropped := len(rows) - n; dropped > 0 {
+		logger := log.FromContext(ctx)
+		logger.Warnf("execlog queue full: dropped %d rows", dropped)
+		stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(sinkKey, "queue"),
+			tag.Upsert(resultKey, "dropped"),
+		}, sinkRows.M(int64(dropped)))
+	}
+	if full {
+		select {
+		case b.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ListenAndServe writes buffered rows to sinks until Shutdown is called.
+func (b *Batcher) ListenAndServe() error {
+	b.init()
+	defer close(b.done)
+	ctx := context.Background()
+	logger := log.FromContext(ctx)
+	t := time.NewTicker(b.flushInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-b.quit:
+			b.flush(ctx, true)
+			for _, s := range b.Sinks {
+				c, ok := s.(io.Closer)
+				if !ok {
+					continue
+				}
+				err := c.Close()
+				if err != nil {
+					logger.Errorf("close %s: %v", s.Name(), err)
+				}
+			}
+			return nil
+		case <-t.C:
+			b.flush(ctx, true)
+		case <-b.flushCh:
+			b.flush(ctx, false)
+		}
+	}
+}
+
+// Shutdown flushes buffered rows and stops ListenAndServe.
+func (b *Batcher) Shutdown(ctx context.Context) error {
+	b.init()
+	close(b.quit)
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush writes buffered rows to sinks in batches.
+// If all is false, it writes full batches only.
+func (b *Batcher) flush(ctx context.Context, all bool) {
+	bs := b.batchSize()
+	for {
+		b.mu.Lock()
+		n := len(b.queue)
+		if n == 0 || (!all && n < bs) {
+			b.mu.Unlock()
+			return
+		}
+		if n > bs {
+			n = bs
+		}
+		rows := b.queue[:n:n]
+		b.queue = b.queue[n:]
+		b.mu.Unlock()
+		b.write(ctx, rows)
+	}
+}
+
+func (b *Batcher) write(ctx context.Context, rows []*Row) {
+	logger := log.FromContext(ctx)
+	for _, s := range b.Sinks {
+		wctx, cancel := context.WithTimeout(ctx, sinkWriteTimeout)
+		err := s.Write(wctx, rows)
+		cancel()
+		result := "ok"
+		if err != nil {
+			logger.Errorf("write %d rows to %s: %v", len(rows), s.Name(), err)
+			result = "error"
+		}
+		stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(sinkKey, s.Name()),
+			tag.Upsert(resultKey, result),
+		}, sinkRows.M(int64(len(rows))))
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][]*Row
+	closed  bool
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) Write(ctx context.Context, rows []*Row) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, rows)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSink) numRows() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, b := range s.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestBatcher(t *testing.T) {
+	ctx := context.Background()
+	sink := &fakeSink{}
+	b := &Batcher{
+		Sinks:         []Sink{sink},
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		QueueSize:     10,
+	}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- b.ListenAndServe()
+	}()
+
+	s := &Service{Batchers: []*Batcher{b}}
+	req := &gomapb.SaveLogReq{}
+	for i := 0; i < 4; i++ {
+		req.ExecLog = append(req.ExecLog, &gomapb.ExecLog{
+			Nodename:               proto.String("build1"),
+			CompilerProxyStartTime: proto.Int32(1600000000),
+			TaskId:                 proto.Int32(int32(i)),
+			CacheHit:               proto.Bool(i%2 == 0),
+		})
+	}
+	_, err := s.SaveLog(ctx, req)
+	if err != nil {
+		t.Fatalf("SaveLog(ctx, req)=_, %v; want nil error", err)
+	}
+
+	// full batch is written without waiting FlushInterval.
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.numRows() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("full batch not written: %d rows", sink.numRows())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := sink.numRows(), 3; got != want {
+		t.Errorf("rows before shutdown=%d; want %d", got, want)
+	}
+
+	// exceeds QueueSize.
+	rows := make([]*Row, 20)
+	for i := range rows {
+		rows[i] = &Row{}
+	}
+	b.Add(ctx, rows)
+
+	err = b.Shutdown(ctx)
+	if err != nil {
+		t.Errorf("Shutdown=%v; want nil error", err)
+	}
+	if err := <-errch; err != nil {
+		t.Errorf("ListenAndServe=%v; want nil error", err)
+	}
+	// 3 rows written, 1 row remaining + 9 rows added, 11 rows dropped.
+	if got, want := sink.numRows(), 3+1+9; got != want {
+		t.Errorf("rows after shutdown=%d; want %d", got, want)
+	}
+	if !sink.closed {
+		t.Errorf("sink is not closed at shutdown")
+	}
+	for _, batch := range sink.batches {
+		if len(batch) > 3 {
+			t.Errorf("batch size=%d; want <= 3", len(batch))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+// TopicSpec is a topic and its batching options, specified as
+//
+//	<topic>[?batch_size=<n>&flush_interval=<duration>&queue_size=<n>]
+//
+// Zero options use defaults of SinkConfig.
+type TopicSpec struct {
+	Topic         string
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+}
+
+// ParseTopicSpecs parses comma separated topic specs.
+func ParseTopicSpecs(s string) ([]TopicSpec, error) {
+	var specs []TopicSpec
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		var spec TopicSpec
+		topic, query := v, ""
+		if i := strings.Index(v, "?"); i >= 0 {
+			topic, query = v[:i], v[i+1:]
+		}
+		if topic == "" {
+			return nil, fmt.Errorf("no topic in %q", v)
+		}
+		spec.Topic = topic
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", v, err)
+		}
+		for k, vals := range q {
+			val := vals[len(vals)-1]
+			switch k {
+			case "batch_size":
+				spec.BatchSize, err = strconv.Atoi(val)
+			case "flush_interval":
+				spec.FlushInterval, err = time.ParseDuration(val)
+			case "queue_size":
+				spec.QueueSize, err = strconv.Atoi(val)
+			default:
+				err = fmt.Errorf("unknown option %q", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", v, err)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// SinkConfig configures execlog sinks.
+type SinkConfig struct {
+	// BigQueryTable is "<project>.<dataset>.<table>" to store rows.
+	BigQueryTable string
+
+	// JSONLFile is local file to append rows.
+	JSONLFile string
+
+	// PubSubProject is default project of PubSubTopics.
+	PubSubProject string
+	// PubSubTopics are comma separated topic specs to publish rows.
+	// topic is "projects/<project>/topics/<topic>" or "<topic>" in PubSubProject.
+	PubSubTopics string
+
+	// KafkaRESTProxy is base URL of Kafka REST Proxy.
+	KafkaRESTProxy string
+	// KafkaTopics are comma separated topic specs to produce rows.
+	KafkaTopics string
+
+	// ClientOptions are used to access BigQuery and Pub/Sub.
+	ClientOptions []option.ClientOption
+
+	// default batching options.
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+}
+
+// NewBatchers creates batchers for sinks in c.
+// BigQuery and JSONL file share one batcher, and each topic has its own
+// batcher, so slow topic won't block other sinks.
+// It returns no batcher if no sink is configured.
+func (c SinkConfig) NewBatchers(ctx context.Context) ([]*Batcher, error) {
+	var batchers []*Batcher
+	// closeAll closes sinks created so far on error.
+	closeAll := func() {
+		for _, b := range batchers {
+			for _, s := range b.Sinks {
+				if cl, ok := s.(io.Closer); ok {
+					cl.Close()
+				}
+			}
+		}
+	}
+	var sinks []Sink
+	if c.BigQueryTable != "" {
+		bq, err := NewBigQuery(ctx, c.BigQueryTable, c.ClientOptions...)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, bq)
+	}
+	if c.JSONLFile != "" {
+		f, err := OpenJSONLFile(c.JSONLFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, f)
+	}
+	if len(sinks) > 0 {
+		batchers = append(batchers, c.batcher(TopicSpec{}, sinks...))
+	}
+
+	specs, err := ParseTopicSpecs(c.PubSubTopics)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("pubsub topics: %v", err)
+	}
+	for _, spec := range specs {
+		ps, err := NewPubSub(ctx, c.PubSubProject, spec.Topic, c.ClientOptions...)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		batchers = append(batchers, c.batcher(spec, ps))
+	}
+
+	specs, err = ParseTopicSpecs(c.KafkaTopics)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("kafka topics: %v", err)
+	}
+	if len(specs) > 0 && c.KafkaRESTProxy == "" {
+		closeAll()
+		return nil, fmt.Errorf("kafka topics %q without REST proxy", c.KafkaTopics)
+	}
+	for _, spec := range specs {
+		batchers = append(batchers, c.batcher(spec, &Kafka{
+			RESTProxy: c.KafkaRESTProxy,
+			Topic:     spec.Topic,
+		}))
+	}
+	return batchers, nil
+}
+
+func (c SinkConfig) batcher(spec TopicSpec, sinks ...Sink) *Batcher {
+	b := &Batcher{
+		Sinks:         sinks,
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		QueueSize:     c.QueueSize,
+	}
+	if spec.BatchSize > 0 {
+		b.BatchSize = spec.BatchSize
+	}
+	if spec.FlushInterval > 0 {
+		b.FlushInterval = spec.FlushInterval
+	}
+	if spec.QueueSize > 0 {
+		b.QueueSize = spec.QueueSize
+	}
+	return b
+}
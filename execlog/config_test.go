@@ -0,0 +1,82 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTopicSpecs(t *testing.T) {
+	got, err := ParseTopicSpecs("execlog, projects/p/topics/stats?batch_size=100&flush_interval=1s&queue_size=5000,")
+	if err != nil {
+		t.Fatalf("ParseTopicSpecs=_, %v; want nil error", err)
+	}
+	want := []TopicSpec{
+		{Topic: "execlog"},
+		{
+			Topic:         "projects/p/topics/stats",
+			BatchSize:     100,
+			FlushInterval: 1 * time.Second,
+			QueueSize:     5000,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseTopicSpecs: diff -want +got:\n%s", diff)
+	}
+
+	for _, s := range []string{
+		"?batch_size=100",
+		"execlog?batch_size=many",
+		"execlog?unknown=1",
+	} {
+		if _, err := ParseTopicSpecs(s); err == nil {
+			t.Errorf("ParseTopicSpecs(%q)=_, nil; want error", s)
+		}
+	}
+}
+
+func TestSinkConfigNewBatchers(t *testing.T) {
+	ctx := context.Background()
+	c := SinkConfig{
+		KafkaRESTProxy: "http://kafka-rest:8082",
+		KafkaTopics:    "execlog,execlog-sampled?batch_size=10",
+		BatchSize:      200,
+	}
+	batchers, err := c.NewBatchers(ctx)
+	if err != nil {
+		t.Fatalf("NewBatchers=_, %v; want nil error", err)
+	}
+	if len(batchers) != 2 {
+		t.Fatalf("len(batchers)=%d; want 2 (batcher per topic)", len(batchers))
+	}
+	for i, want := range []struct {
+		topic     string
+		batchSize int
+	}{
+		{topic: "execlog", batchSize: 200},
+		{topic: "execlog-sampled", batchSize: 10},
+	} {
+		b := batchers[i]
+		k, ok := b.Sinks[0].(*Kafka)
+		if !ok || k.Topic != want.topic {
+			t.Errorf("batchers[%d].Sinks=%v; want kafka:%s", i, b.Sinks, want.topic)
+		}
+		if b.BatchSize != want.batchSize {
+			t.Errorf("batchers[%d].BatchSize=%d; want %d", i, b.BatchSize, want.batchSize)
+		}
+	}
+
+	c = SinkConfig{
+		KafkaTopics: "execlog",
+	}
+	_, err = c.NewBatchers(ctx)
+	if err == nil {
+		t.Errorf("NewBatchers without kafka REST proxy=_, nil; want error")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Kafka is a sink to produce rows to Kafka topic via Kafka REST Proxy
+// (v2 API), so that it doesn't need Kafka client library.
+// Each row is produced as a JSON record, keyed by compile task id
+// if available.
+type Kafka struct {
+	// RESTProxy is base URL of Kafka REST Proxy, e.g. "http://kafka-rest:8082".
+	RESTProxy string
+	Topic     string
+
+	// HTTPClient is used to access REST Proxy.
+	// http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Name returns "kafka".
+func (k *Kafka) Name() string { return "kafka" }
+
+func (k *Kafka) String() string {
+	return "kafka:" + k.Topic
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value *Row   `json:"value"`
+}
+
+type kafkaProduceReq struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaProduceResp struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode int    `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (k *Kafka) httpClient() *http.Client {
+	if k.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return k.HTTPClient
+}
+
+// Write produces rows to the topic.
+func (k *Kafka) Write(ctx context.Context, rows []*Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	req := kafkaProduceReq{}
+	for _, r := range rows {
+		req.Records = append(req.Records, kafkaRecord{
+			Key:   r.insertID,
+			Value: r,
+		})
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(k.RESTProxy, "/") + "/topics/" + url.PathEscape(k.Topic)
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	hreq.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.httpClient().Do(hreq)
+	if err != nil {
+		return fmt.Errorf("%s: %v", k, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %v", k, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s: %s", k, resp.Status, bytes.TrimSpace(body))
+	}
+	presp := kafkaProduceResp{}
+	err = json.Unmarshal(body, &presp)
+	if err != nil {
+		return fmt.Errorf("%s: bad response %q: %v", k, body, err)
+	}
+	var nerr int
+	var firstErr string
+	for _, o := range presp.Offsets {
+		if o.ErrorCode == 0 && o.Error == "" {
+			continue
+		}
+		nerr++
+		if firstErr == "" {
+			firstErr = fmt.Sprintf("%d: %s", o.ErrorCode, o.Error)
+		}
+	}
+	if nerr > 0 {
+		return fmt.Errorf("%s: %d/%d rows failed: %s", k, nerr, len(rows), firstErr)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+)
+
+// PubSub is a sink to publish rows to Pub/Sub topic.
+// Each row is published as a message of JSON, with "insert_id" attribute
+// to deduplicate in downstream pipelines.
+type PubSub struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+// NewPubSub creates PubSub sink for topic, either "projects/<project>/topics/<topic>"
+// or "<topic>" in projectID.
+func NewPubSub(ctx context.Context, projectID, topic string, opts ...option.ClientOption) (*PubSub, error) {
+	if strings.HasPrefix(topic, "projects/") {
+		p := strings.Split(topic, "/")
+		if len(p) != 4 || p[2] != "topics" {
+			return nil, fmt.Errorf("bad pubsub topic %q: want projects/<project>/topics/<topic>", topic)
+		}
+		projectID, topic = p[1], p[3]
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("no project for pubsub topic %q", topic)
+	}
+	client, err := pubsub.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t := client.Topic(topic)
+	// Batcher already batches rows, so publish them without delay.
+	t.PublishSettings.DelayThreshold = 0
+	t.PublishSettings.CountThreshold = pubsub.MaxPublishRequestCount
+	t.PublishSettings.FlowControlSettings.LimitExceededBehavior = pubsub.FlowControlBlock
+	return &PubSub{
+		client: client,
+		topic:  t,
+	}, nil
+}
+
+// Name returns "pubsub".
+func (p *PubSub) Name() string { return "pubsub" }
+
+func (p *PubSub) String() string {
+	return "pubsub:" + p.topic.String()
+}
+
+// Check checks the topic exists.
+func (p *PubSub) Check(ctx context.Context) error {
+	ok, err := p.topic.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s: not found", p)
+	}
+	return nil
+}
+
+// Write publishes rows and waits for them to be published.
+func (p *PubSub) Write(ctx context.Context, rows []*Row) error {
+	results := make([]*pubsub.PublishResult, 0, len(rows))
+	for _, r := range rows {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		msg := &pubsub.Message{
+			Data: b,
+		}
+		if r.insertID != "" {
+			msg.Attributes = map[string]string{
+				"insert_id": r.insertID,
+			}
+		}
+		results = append(results, p.topic.Publish(ctx, msg))
+	}
+	var nerr int
+	var firstErr error
+	for _, res := range results {
+		_, err := res.Get(ctx)
+		if err != nil {
+			nerr++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if nerr > 0 {
+		return fmt.Errorf("%s: %d/%d rows failed: %v", p, nerr, len(rows), firstErr)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the client.
+func (p *PubSub) Close() error {
+	p.topic.Stop()
+	return p.client.Close()
+}
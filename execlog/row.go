@@ -0,0 +1,135 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"fmt"
+	"time"
+
+	"go.chromium.org/goma/server/log/redact"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// Row is a compile stats entry derived from client's ExecLog, stored in sinks.
+// JSON field names are used as column names, e.g. in BigQuery table.
+// Times are in milliseconds unless otherwise noted.
+type Row struct {
+	// ReceiveTime is time when the server received the entry.
+	ReceiveTime time.Time `json:"receive_time"`
+	// StartTime is time when compiler_proxy started the task.
+	StartTime time.Time `json:"start_time"`
+
+	Username         string `json:"username,omitempty"`
+	Nodename         string `json:"nodename,omitempty"`
+	BuildID          string `json:"build_id,omitempty"`
+	ServiceAccountID string `json:"service_account_id,omitempty"`
+	UserAgent        string `json:"compiler_proxy_user_agent,omitempty"`
+	OSFamily         string `json:"os_family"`
+
+	CommandVersion string `json:"command_version,omitempty"`
+	CommandTarget  string `json:"command_target,omitempty"`
+
+	CacheHit           bool   `json:"cache_hit"`
+	CacheSource        string `json:"cache_source,omitempty"`
+	DepscacheUsed      bool   `json:"depscache_used"`
+	GomaError          bool   `json:"goma_error"`
+	CompilerProxyError bool   `json:"compiler_proxy_error"`
+	NetworkFailureType string `json:"network_failure_type,omitempty"`
+	ExecExitStatus     int32  `json:"exec_exit_status"`
+	ExecRequestRetry   int32  `json:"exec_request_retry"`
+	LocalRun           bool   `json:"local_run"`
+	LocalRunReason     string `json:"local_run_reason,omitempty"`
+
+	HandlerTime                 int32 `json:"handler_time"`
+	PendingTime                 int32 `json:"pending_time"`
+	CompilerInfoProcessTime     int32 `json:"compiler_info_process_time"`
+	IncludePreprocessTime       int32 `json:"include_preprocess_time"`
+	IncludeProcessorWaitTime    int32 `json:"include_processor_wait_time"`
+	IncludeProcessorRunTime     int32 `json:"include_processor_run_time"`
+	IncludePreprocessTotalFiles int32 `json:"include_preprocess_total_files"`
+	IncludeFileloadTime         int32 `json:"include_fileload_time"`
+	NumTotalInputFile           int32 `json:"num_total_input_file"`
+	TotalInputFileSize          int64 `json:"total_input_file_size"`
+	RPCCallTime                 int64 `json:"rpc_call_time"`
+	RPCThrottleTime             int64 `json:"rpc_throttle_time"`
+	RPCPendingTime              int64 `json:"rpc_pending_time"`
+	RPCWaitTime                 int64 `json:"rpc_wait_time"`
+	FileResponseTime            int32 `json:"file_response_time"`
+	NumOutputFile               int32 `json:"num_output_file"`
+	LocalDelayTime              int32 `json:"local_delay_time"`
+	LocalPendingTime            int32 `json:"local_pending_time"`
+	LocalRunTime                int32 `json:"local_run_time"`
+
+	// insertID identifies the compile task, used to deduplicate
+	// entries sent more than once.
+	insertID string
+}
+
+func sum(v []int32) int64 {
+	var s int64
+	for _, x := range v {
+		s += int64(x)
+	}
+	return s
+}
+
+// NewRow creates new Row from ExecLog e received at t.
+// Repeated times (e.g. per rpc retry) are summed up.
+// Free-form strings sent by clients are redacted, and user identities
+// are pseudonymized by default redactor.
+func NewRow(e *gomapb.ExecLog, t time.Time) *Row {
+	r := &Row{
+		ReceiveTime:      t,
+		StartTime:        time.Unix(int64(e.GetStartTime()), 0),
+		Username:         redact.Identity(e.GetUsername()),
+		Nodename:         e.GetNodename(),
+		BuildID:          redact.String(e.GetBuildId()),
+		ServiceAccountID: redact.Identity(e.GetServiceAccountId()),
+		UserAgent:        redact.String(e.GetCompilerProxyUserAgent()),
+		OSFamily:         osFamily(e),
+
+		CommandVersion: redact.String(e.GetCommandVersion()),
+		CommandTarget:  redact.String(e.GetCommandTarget()),
+
+		CacheHit:           e.GetCacheHit(),
+		DepscacheUsed:      e.GetDepscacheUsed(),
+		GomaError:          e.GetGomaError(),
+		CompilerProxyError: e.GetCompilerProxyError(),
+		ExecExitStatus:     e.GetExecExitStatus(),
+		ExecRequestRetry:   e.GetExecRequestRetry(),
+		LocalRun:           e.GetLocalRunTime() > 0,
+		LocalRunReason:     redact.String(e.GetLocalRunReason()),
+
+		HandlerTime:                 e.GetHandlerTime(),
+		PendingTime:                 e.GetPendingTime(),
+		CompilerInfoProcessTime:     e.GetCompilerInfoProcessTime(),
+		IncludePreprocessTime:       e.GetIncludePreprocessTime(),
+		IncludeProcessorWaitTime:    e.GetIncludeProcessorWaitTime(),
+		IncludeProcessorRunTime:     e.GetIncludeProcessorRunTime(),
+		IncludePreprocessTotalFiles: e.GetIncludePreprocessTotalFiles(),
+		IncludeFileloadTime:         e.GetIncludeFileloadTime(),
+		NumTotalInputFile:           e.GetNumTotalInputFile(),
+		TotalInputFileSize:          e.GetTotalInputFileSize(),
+		RPCCallTime:                 sum(e.GetRpcCallTime()),
+		RPCThrottleTime:             sum(e.GetRpcThrottleTime()),
+		RPCPendingTime:              sum(e.GetRpcPendingTime()),
+		RPCWaitTime:                 sum(e.GetRpcWaitTime()),
+		FileResponseTime:            e.GetFileResponseTime(),
+		NumOutputFile:               e.GetNumOutputFile(),
+		LocalDelayTime:              e.GetLocalDelayTime(),
+		LocalPendingTime:            e.GetLocalPendingTime(),
+		LocalRunTime:                e.GetLocalRunTime(),
+	}
+	if e.CacheSource != nil {
+		r.CacheSource = e.GetCacheSource().String()
+	}
+	if e.NetworkFailureType != nil {
+		r.NetworkFailureType = e.GetNetworkFailureType().String()
+	}
+	if e.GetNodename() != "" && e.GetCompilerProxyStartTime() != 0 {
+		r.insertID = fmt.Sprintf("%s:%d:%d:%d", e.GetNodename(), e.GetPort(), e.GetCompilerProxyStartTime(), e.GetTaskId())
+	}
+	return r
+}
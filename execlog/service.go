@@ -7,6 +7,7 @@ package execlog
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
@@ -199,12 +200,23 @@ var (
 			Measure:     localRunTime,
 			Aggregation: defaultLatencyDistribution,
 		},
+		{
+			TagKeys: []tag.Key{
+				sinkKey,
+				resultKey,
+			},
+			Measure:     sinkRows,
+			Aggregation: view.Sum(),
+		},
 	}
 )
 
 // Service represents goma execlog service.
 type Service struct {
 	execlogpb.UnimplementedLogServiceServer
+
+	// Batchers store execlog entries as rows.
+	Batchers []*Batcher
 }
 
 func osFamily(e *gomapb.ExecLog) string {
@@ -221,16 +233,24 @@ func osFamily(e *gomapb.ExecLog) string {
 	}
 }
 
-// SaveLog emits some metrics.
+// SaveLog emits some metrics, and stores entries in s.Batchers.
 //   - go.chromium.org/goma/execlog/requests
 //     {os_family, ,goma_error, compiler_proxy_error,
 //     cache_hit, depscache_used, local_run,
 //     exec_exit_status, exec_request_retry}
 //   - go.chromium.org/goma/execlog/handler_time
-//
-// TODO: implement saving logic to GCS?
-func (Service) SaveLog(ctx context.Context, req *gomapb.SaveLogReq) (*gomapb.SaveLogResp, error) {
+func (s *Service) SaveLog(ctx context.Context, req *gomapb.SaveLogReq) (*gomapb.SaveLogResp, error) {
 	logger := log.FromContext(ctx)
+	if len(s.Batchers) > 0 && len(req.GetExecLog()) > 0 {
+		now := time.Now()
+		rows := make([]*Row, 0, len(req.GetExecLog()))
+		for _, e := range req.GetExecLog() {
+			rows = append(rows, NewRow(e, now))
+		}
+		for _, b := range s.Batchers {
+			b.Add(ctx, rows)
+		}
+	}
 	for _, e := range req.GetExecLog() {
 		os := osFamily(e)
 		serviceAccount := e.GetServiceAccountId()
@@ -0,0 +1,173 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// Sink stores rows.
+type Sink interface {
+	// Name is sink name used in metrics.
+	Name() string
+
+	// Write writes rows to the sink.
+	Write(ctx context.Context, rows []*Row) error
+}
+
+// BigQuery is a sink to stream rows into BigQuery table.
+// The table should have columns named as Row's json field names.
+type BigQuery struct {
+	ProjectID string
+	DatasetID string
+	TableID   string
+
+	s *bigquery.Service
+}
+
+// NewBigQuery creates BigQuery sink for table, specified as
+// "<project>.<dataset>.<table>".
+func NewBigQuery(ctx context.Context, table string, opts ...option.ClientOption) (*BigQuery, error) {
+	p := strings.Split(table, ".")
+	if len(p) != 3 || p[0] == "" || p[1] == "" || p[2] == "" {
+		return nil, fmt.Errorf("bad bigquery table %q: want <project>.<dataset>.<table>", table)
+	}
+	s, err := bigquery.NewService(ctx, append([]option.ClientOption{option.WithScopes(bigquery.BigqueryScope)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &BigQuery{
+		ProjectID: p[0],
+		DatasetID: p[1],
+		TableID:   p[2],
+		s:         s,
+	}, nil
+}
+
+// Name returns "bigquery".
+func (b *BigQuery) Name() string { return "bigquery" }
+
+func (b *BigQuery) String() string {
+	return fmt.Sprintf("bigquery:%s.%s.%s", b.ProjectID, b.DatasetID, b.TableID)
+}
+
+// Check checks the table is accessible.
+func (b *BigQuery) Check(ctx context.Context) error {
+	_, err := b.s.Tables.Get(b.ProjectID, b.DatasetID, b.TableID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("%s: %v", b, err)
+	}
+	return nil
+}
+
+// Write inserts rows by streaming insert.
+// Invalid rows are skipped, and reported as error.
+func (b *BigQuery) Write(ctx context.Context, rows []*Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	req := &bigquery.TableDataInsertAllRequest{
+		SkipInvalidRows:     true,
+		IgnoreUnknownValues: true,
+	}
+	for _, r := range rows {
+		v, err := jsonValue(r)
+		if err != nil {
+			return err
+		}
+		req.Rows = append(req.Rows, &bigquery.TableDataInsertAllRequestRows{
+			InsertId: r.insertID,
+			Json:     v,
+		})
+	}
+	resp, err := b.s.Tabledata.InsertAll(b.ProjectID, b.DatasetID, b.TableID, req).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("%s: insert %d rows: %v", b, len(rows), err)
+	}
+	if len(resp.InsertErrors) > 0 {
+		ie := resp.InsertErrors[0]
+		var msgs []string
+		for _, e := range ie.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", e.Reason, e.Message))
+		}
+		return fmt.Errorf("%s: %d/%d rows failed: row %d: %s", b, len(resp.InsertErrors), len(rows), ie.Index, strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// jsonValue converts r to BigQuery's json row.
+func jsonValue(r *Row) (map[string]bigquery.JsonValue, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	v := make(map[string]bigquery.JsonValue)
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// JSONLFile is a sink to append rows in a local file in JSON lines format.
+type JSONLFile struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// OpenJSONLFile opens fname to append rows.
+func OpenJSONLFile(fname string) (*JSONLFile, error) {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLFile{
+		f: f,
+		w: bufio.NewWriter(f),
+	}, nil
+}
+
+// Name returns "jsonl".
+func (j *JSONLFile) Name() string { return "jsonl" }
+
+func (j *JSONLFile) String() string {
+	return "jsonl:" + j.f.Name()
+}
+
+// Write appends rows to the file, one JSON object per line.
+func (j *JSONLFile) Write(ctx context.Context, rows []*Row) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	enc := json.NewEncoder(j.w)
+	for _, r := range rows {
+		err := enc.Encode(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", j.f.Name(), err)
+		}
+	}
+	return j.w.Flush()
+}
+
+// Close closes the file.
+func (j *JSONLFile) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.w.Flush()
+	cerr := j.f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package execlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestNewRow(t *testing.T) {
+	now := time.Now()
+	r := NewRow(&gomapb.ExecLog{
+		Nodename:               proto.String("build1"),
+		Port:                   proto.Int32(8088),
+		CompilerProxyStartTime: proto.Int32(1600000000),
+		TaskId:                 proto.Int32(42),
+		CacheHit:               proto.Bool(true),
+		CacheSource:            gomapb.ExecLog_STORAGE_CACHE.Enum(),
+		RpcWaitTime:            []int32{100, 200},
+		LocalRunTime:           proto.Int32(0),
+		LocalRunReason:         proto.String("should run local: -DAPI_KEY=secret"),
+		OsInfo: &gomapb.OSInfo{
+			OsInfoOneof: &gomapb.OSInfo_LinuxInfo_{
+				LinuxInfo: &gomapb.OSInfo_LinuxInfo{},
+			},
+		},
+	}, now)
+	if !r.CacheHit || r.CacheSource != "STORAGE_CACHE" {
+		t.Errorf("cache_hit=%t cache_source=%q; want true STORAGE_CACHE", r.CacheHit, r.CacheSource)
+	}
+	if got, want := r.RPCWaitTime, int64(300); got != want {
+		t.Errorf("rpc_wait_time=%d; want %d", got, want)
+	}
+	if got, want := r.OSFamily, "Linux"; got != want {
+		t.Errorf("os_family=%q; want %q", got, want)
+	}
+	if r.LocalRun {
+		t.Errorf("local_run=true; want false")
+	}
+	if got, want := r.LocalRunReason, "should run local: -DAPI_KEY=[REDACTED]"; got != want {
+		t.Errorf("local_run_reason=%q; want %q", got, want)
+	}
+	if got, want := r.insertID, "build1:8088:1600000000:42"; got != want {
+		t.Errorf("insertID=%q; want %q", got, want)
+	}
+}
+
+func TestJSONLFile(t *testing.T) {
+	ctx := context.Background()
+	fname := filepath.Join(t.TempDir(), "execlog.jsonl")
+	f, err := OpenJSONLFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Write(ctx, []*Row{
+		{Username: "alice", CacheHit: true},
+		{Username: "bob", HandlerTime: 1234},
+	})
+	if err != nil {
+		t.Errorf("Write=%v; want nil error", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Errorf("Close=%v; want nil error", err)
+	}
+
+	r, err := os.Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []Row
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		var row Row
+		err := json.Unmarshal(s.Bytes(), &row)
+		if err != nil {
+			t.Errorf("unmarshal %q: %v", s.Text(), err)
+		}
+		got = append(got, row)
+	}
+	if len(got) != 2 || got[0].Username != "alice" || !got[0].CacheHit || got[1].HandlerTime != 1234 {
+		t.Errorf("rows=%v; want alice, bob", got)
+	}
+}
+
+func TestBigQueryWrite(t *testing.T) {
+	ctx := context.Background()
+	var got struct {
+		Rows []struct {
+			InsertID string                 `json:"insertId"`
+			JSON     map[string]interface{} `json:"json"`
+		} `json:"rows"`
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasSuffix(req.URL.Path, "/projects/p/datasets/d/tables/t/insertAll") {
+			http.NotFound(w, req)
+			return
+		}
+		err := json.NewDecoder(req.Body).Decode(&got)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind": "bigquery#tableDataInsertAllResponse"}`))
+	}))
+	defer s.Close()
+
+	bq, err := NewBigQuery(ctx, "p.d.t", option.WithEndpoint(s.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bq.Write(ctx, []*Row{
+		{Username: "alice", insertID: "build1:8088:1600000000:1"},
+	})
+	if err != nil {
+		t.Errorf("Write=%v; want nil error", err)
+	}
+	if len(got.Rows) != 1 {
+		t.Fatalf("inserted rows=%d; want 1", len(got.Rows))
+	}
+	if got, want := got.Rows[0].InsertID, "build1:8088:1600000000:1"; got != want {
+		t.Errorf("insertId=%q; want %q", got, want)
+	}
+	if got, want := got.Rows[0].JSON["username"], "alice"; got != want {
+		t.Errorf("username=%v; want %q", got, want)
+	}
+
+	if _, err := NewBigQuery(ctx, "dataset.table"); err == nil {
+		t.Errorf("NewBigQuery(ctx, %q)=_, nil; want error", "dataset.table")
+	}
+}
+
+func TestKafkaWrite(t *testing.T) {
+	ctx := context.Background()
+	var got kafkaProduceReq
+	var contentType string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/topics/execlog" {
+			http.NotFound(w, req)
+			return
+		}
+		contentType = req.Header.Get("Content-Type")
+		err := json.NewDecoder(req.Body).Decode(&got)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.kafka.v2+json")
+		if len(got.Records) > 1 {
+			w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 1}, {"partition": 0, "offset": -1, "error_code": 50002, "error": "broker unavailable"}]}`))
+			return
+		}
+		w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 1}]}`))
+	}))
+	defer s.Close()
+
+	k := &Kafka{
+		RESTProxy: s.URL + "/",
+		Topic:     "execlog",
+	}
+	err := k.Write(ctx, []*Row{
+		{Username: "alice", insertID: "build1:8088:1600000000:1"},
+	})
+	if err != nil {
+		t.Errorf("Write=%v; want nil error", err)
+	}
+	if got, want := contentType, "application/vnd.kafka.json.v2+json"; got != want {
+		t.Errorf("content-type=%q; want %q", got, want)
+	}
+	if len(got.Records) != 1 || got.Records[0].Key != "build1:8088:1600000000:1" || got.Records[0].Value.Username != "alice" {
+		t.Errorf("records=%v; want alice's record", got.Records)
+	}
+
+	err = k.Write(ctx, []*Row{{Username: "alice"}, {Username: "bob"}})
+	if err == nil {
+		t.Errorf("Write=nil; want error for partially failed records")
+	}
+}
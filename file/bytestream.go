@@ -0,0 +1,303 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"go.opencensus.io/trace"
+	bspb "google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/hash"
+	"go.chromium.org/goma/server/log"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	cachepb "go.chromium.org/goma/server/proto/cache"
+	filepb "go.chromium.org/goma/server/proto/file"
+	"go.chromium.org/goma/server/remoteexec/cas"
+)
+
+const (
+	// DefaultMaxWriteSize is default max size of blob written by ByteStream.
+	DefaultMaxWriteSize = 256 * 1024 * 1024
+
+	// max data size in a ReadResponse.
+	readChunkSize = 1024 * 1024
+
+	// key prefix of index from content digest to goma hash key.
+	contentIndexPrefix = "cas/"
+)
+
+// ByteStream is a ByteStream server backed by goma file service,
+// so RBE-compatible tools (e.g. bazel, recc) can read blobs uploaded
+// by goma clients, and write blobs that goma clients can read.
+//
+// Resource name is "{instance}/blobs/{hash}/{size}" for Read,
+// and "{instance}/uploads/{uuid}/blobs/{hash}/{size}" for Write,
+// where hash is SHA-256 of the content. instance is ignored.
+//
+// Since goma hash key is a hash of serialized FileBlob, not of the
+// content, it keeps index from content hash to goma hash key in Cache.
+// The index is updated by Write, and by StoreFile if
+// Service.IndexContent is set. FILE_META blobs stored by StoreFile
+// are not indexed, since its content hash is not known.
+type ByteStream struct {
+	bspb.UnimplementedByteStreamServer
+
+	Service *Service
+
+	// MaxWriteSize is max size of blob to write.
+	// 0 means DefaultMaxWriteSize.
+	MaxWriteSize int64
+}
+
+// putContentIndex records index from content hash to goma hash key.
+func (s *Service) putContentIndex(ctx context.Context, contentHash, hashKey string) error {
+	_, err := s.Cache.Put(ctx, &cachepb.PutReq{
+		Kv: &cachepb.KV{
+			Key:   contentIndexPrefix + contentHash,
+			Value: []byte(hashKey),
+		},
+	})
+	return err
+}
+
+// getContentIndex returns goma hash key for content hash.
+func (s *Service) getContentIndex(ctx context.Context, contentHash string) (string, error) {
+	resp, err := s.Cache.Get(ctx, &cachepb.GetReq{
+		Key: contentIndexPrefix + contentHash,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(resp.GetKv().GetValue()), nil
+}
+
+func (s *Service) lookupBlob(ctx context.Context, hashKey string) (*gomapb.FileBlob, error) {
+	resp, err := s.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Blob) == 0 || !IsValid(resp.Blob[0]) {
+		return nil, status.Errorf(codes.NotFound, "blob %s not found", hashKey)
+	}
+	return resp.Blob[0], nil
+}
+
+// rangeSender sends data in [offset, offset+limit) of stream.
+type rangeSender struct {
+	s      bspb.ByteStream_ReadServer
+	offset int64
+	// remaining bytes to send. negative means no limit.
+	limit int64
+}
+
+func (r *rangeSender) done() bool {
+	return r.limit == 0
+}
+
+func (r *rangeSender) send(data []byte) error {
+	if r.offset >= int64(len(data)) {
+		r.offset -= int64(len(data))
+		return nil
+	}
+	data = data[r.offset:]
+	r.offset = 0
+	if r.limit >= 0 && int64(len(data)) > r.limit {
+		data = data[:r.limit]
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > readChunkSize {
+			n = readChunkSize
+		}
+		err := r.s.Send(&bspb.ReadResponse{
+			Data: data[:n],
+		})
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		if r.limit > 0 {
+			r.limit -= int64(n)
+		}
+	}
+	return nil
+}
+
+// Read reads blob content.
+func (bs *ByteStream) Read(req *bspb.ReadRequest, s bspb.ByteStream_ReadServer) error {
+	ctx := s.Context()
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/file.ByteStream.Read")
+	defer span.End()
+	logger := log.FromContext(ctx)
+
+	d, err := cas.ParseResName(req.ResourceName)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.ReadOffset < 0 || req.ReadOffset > d.SizeBytes {
+		return status.Errorf(codes.OutOfRange, "read offset %d out of range: size=%d", req.ReadOffset, d.SizeBytes)
+	}
+	if req.ReadLimit < 0 {
+		return status.Errorf(codes.InvalidArgument, "negative read limit %d", req.ReadLimit)
+	}
+	hashKey, err := bs.Service.getContentIndex(ctx, d.Hash)
+	if err != nil {
+		logger.Infof("read %s: not indexed: %v", req.ResourceName, err)
+		return status.Errorf(codes.NotFound, "%s not found", req.ResourceName)
+	}
+	blob, err := bs.Service.lookupBlob(ctx, hashKey)
+	if err != nil {
+		logger.Warnf("read %s: lookup %s: %v", req.ResourceName, hashKey, err)
+		return status.Errorf(codes.NotFound, "%s not found: %v", req.ResourceName, err)
+	}
+	if blob.GetFileSize() != d.SizeBytes {
+		return status.Errorf(codes.NotFound, "%s size mismatch: %d", req.ResourceName, blob.GetFileSize())
+	}
+	rs := &rangeSender{
+		s:      s,
+		offset: req.ReadOffset,
+		limit:  -1,
+	}
+	if req.ReadLimit > 0 {
+		rs.limit = req.ReadLimit
+	}
+	switch blob.GetBlobType() {
+	case gomapb.FileBlob_FILE:
+		return rs.send(blob.GetContent())
+
+	case gomapb.FileBlob_FILE_META:
+		for i, hk := range blob.GetHashKey() {
+			if rs.done() {
+				return nil
+			}
+			chunk, err := bs.Service.lookupBlob(ctx, hk)
+			if err != nil {
+				return status.Errorf(codes.DataLoss, "%s: chunk %d %s: %v", req.ResourceName, i, hk, err)
+			}
+			if chunk.GetBlobType() != gomapb.FileBlob_FILE_CHUNK {
+				return status.Errorf(codes.DataLoss, "%s: chunk %d %s: wrong blob type %v", req.ResourceName, i, hk, chunk.GetBlobType())
+			}
+			err = rs.send(chunk.GetContent())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return status.Errorf(codes.Internal, "%s: unexpected blob type %v", req.ResourceName, blob.GetBlobType())
+}
+
+// Write writes blob content.
+// It doesn't support resumable write.
+func (bs *ByteStream) Write(s bspb.ByteStream_WriteServer) error {
+	ctx := s.Context()
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/file.ByteStream.Write")
+	defer span.End()
+	logger := log.FromContext(ctx)
+
+	maxSize := bs.MaxWriteSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxWriteSize
+	}
+	var resname string
+	var buf bytes.Buffer
+	for {
+		req, err := s.Recv()
+		if err == io.EOF {
+			return status.Errorf(codes.InvalidArgument, "%s: write not finished", resname)
+		}
+		if err != nil {
+			return err
+		}
+		if resname == "" {
+			resname = req.ResourceName
+		}
+		if req.WriteOffset != int64(buf.Len()) {
+			return status.Errorf(codes.InvalidArgument, "%s: unexpected write offset %d; want %d", resname, req.WriteOffset, buf.Len())
+		}
+		if int64(buf.Len()+len(req.Data)) > maxSize {
+			return status.Errorf(codes.ResourceExhausted, "%s: too large blob > %d", resname, maxSize)
+		}
+		buf.Write(req.Data)
+		if req.FinishWrite {
+			break
+		}
+	}
+	d, err := cas.ParseResName(resname)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if int64(buf.Len()) != d.SizeBytes {
+		return status.Errorf(codes.InvalidArgument, "%s: size mismatch: %d", resname, buf.Len())
+	}
+	if h := hash.SHA256Content(buf.Bytes()); h != d.Hash {
+		return status.Errorf(codes.InvalidArgument, "%s: hash mismatch: %s", resname, h)
+	}
+	blob := &gomapb.FileBlob{
+		FileSize: proto.Int64(d.SizeBytes),
+	}
+	fc := serviceClient{s: bs.Service}
+	err = FromReader(ctx, fc, bytes.NewReader(buf.Bytes()), blob)
+	if err != nil {
+		logger.Errorf("write %s: %v", resname, err)
+		return err
+	}
+	if blob.GetBlobType() == gomapb.FileBlob_FILE {
+		// FromReader doesn't store FILE blob.
+		resp, err := fc.StoreFile(ctx, &gomapb.StoreFileReq{
+			Blob: []*gomapb.FileBlob{blob},
+		})
+		if err != nil {
+			logger.Errorf("write %s: %v", resname, err)
+			return err
+		}
+		if len(resp.HashKey) == 0 || resp.HashKey[0] == "" {
+			return status.Errorf(codes.Internal, "%s: failed to store", resname)
+		}
+	}
+	hashKey, err := Key(blob)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s: %v", resname, err)
+	}
+	err = bs.Service.putContentIndex(ctx, d.Hash, hashKey)
+	if err != nil {
+		logger.Errorf("write %s: index %s: %v", resname, hashKey, err)
+		return err
+	}
+	logger.Infof("write %s: %s", resname, hashKey)
+	return s.SendAndClose(&bspb.WriteResponse{
+		CommittedSize: d.SizeBytes,
+	})
+}
+
+// serviceClient is a FileServiceClient calling Service directly.
+type serviceClient struct {
+	s *Service
+}
+
+func (c serviceClient) StoreFile(ctx context.Context, req *gomapb.StoreFileReq, opts ...grpc.CallOption) (*gomapb.StoreFileResp, error) {
+	return c.s.StoreFile(ctx, req)
+}
+
+func (c serviceClient) LookupFile(ctx context.Context, req *gomapb.LookupFileReq, opts ...grpc.CallOption) (*gomapb.LookupFileResp, error) {
+	return c.s.LookupFile(ctx, req)
+}
+
+func (c serviceClient) StoreFileStream(ctx context.Context, opts ...grpc.CallOption) (filepb.FileService_StoreFileStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "StoreFileStream is not supported in serviceClient")
+}
+
+func (c serviceClient) LookupFileStream(ctx context.Context, req *gomapb.LookupFileReq, opts ...grpc.CallOption) (filepb.FileService_LookupFileStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "LookupFileStream is not supported in serviceClient")
+}
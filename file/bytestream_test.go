@@ -0,0 +1,116 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	bspb "google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/bytestreamio"
+	"go.chromium.org/goma/server/cache"
+	"go.chromium.org/goma/server/hash"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	"go.chromium.org/goma/server/remoteexec/cas"
+	"go.chromium.org/goma/server/rpc/grpctest"
+)
+
+func TestByteStream(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 32 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Cache:        cache.LocalClient{CacheServiceServer: c},
+		IndexContent: true,
+	}
+	server := grpc.NewServer()
+	bspb.RegisterByteStreamServer(server, &ByteStream{Service: s})
+	addr, stop, err := grpctest.StartServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := bspb.NewByteStreamClient(conn)
+
+	readBlob := func(d *rpb.Digest) ([]byte, error) {
+		rd, err := bytestreamio.Open(ctx, client, cas.ResName("instance", d))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(rd)
+	}
+
+	t.Run("StoreFile", func(t *testing.T) {
+		content := []byte("int main() {}\n")
+		_, err := s.StoreFile(ctx, &gomapb.StoreFileReq{
+			Blob: []*gomapb.FileBlob{
+				{
+					BlobType: gomapb.FileBlob_FILE.Enum(),
+					Content:  content,
+					FileSize: proto.Int64(int64(len(content))),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := &rpb.Digest{
+			Hash:      hash.SHA256Content(content),
+			SizeBytes: int64(len(content)),
+		}
+		got, err := readBlob(d)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("read %v=%q, %v; want %q, nil", d, got, err, content)
+		}
+	})
+
+	for _, size := range []int{0, 1024, LargeFileThreshold + 1024} {
+		t.Run(fmt.Sprintf("Write-%d", size), func(t *testing.T) {
+			content := bytes.Repeat([]byte{'a'}, size)
+			d := &rpb.Digest{
+				Hash:      hash.SHA256Content(content),
+				SizeBytes: int64(size),
+			}
+			err := cas.UploadDigest(ctx, client, "instance", d, bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("upload %v: %v", d, err)
+			}
+			got, err := readBlob(d)
+			if err != nil || !bytes.Equal(got, content) {
+				t.Errorf("read %v=%d bytes, %v; want %d bytes, nil", d, len(got), err, len(content))
+			}
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		content := []byte("not found")
+		d := &rpb.Digest{
+			Hash:      hash.SHA256Content(content),
+			SizeBytes: int64(len(content)),
+		}
+		_, err := readBlob(d)
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("read %v: %v; want %v", d, err, codes.NotFound)
+		}
+	})
+}
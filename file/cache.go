@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
 	"go.chromium.org/goma/server/hash"
@@ -141,3 +143,21 @@ func (c LocalCache) StoreFile(ctx context.Context, req *gomapb.StoreFileReq, opt
 	}
 	return resp, nil
 }
+
+// StoreFileStream calls c.Client's StoreFileStream.
+// It doesn't store the file in local disk.
+func (c LocalCache) StoreFileStream(ctx context.Context, opts ...grpc.CallOption) (filepb.FileService_StoreFileStreamClient, error) {
+	if c.Client == nil {
+		return nil, status.Error(codes.Unimplemented, "StoreFileStream is not supported without client")
+	}
+	return c.Client.StoreFileStream(ctx, opts...)
+}
+
+// LookupFileStream calls c.Client's LookupFileStream.
+// It doesn't use local disk cache.
+func (c LocalCache) LookupFileStream(ctx context.Context, req *gomapb.LookupFileReq, opts ...grpc.CallOption) (filepb.FileService_LookupFileStreamClient, error) {
+	if c.Client == nil {
+		return nil, status.Error(codes.Unimplemented, "LookupFileStream is not supported without client")
+	}
+	return c.Client.LookupFileStream(ctx, req, opts...)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"io"
+)
+
+// content-defined chunking parameters.
+// chunk boundary is determined by gear hash of content, so
+// insertion/deletion in a file changes only chunks around the edit.
+const (
+	cdcMinSize = 256 * 1024
+	cdcMaxSize = FileChunkSize
+	// average chunk size is cdcMinSize + 1MiB.
+	// use high bits, which depend on the last 64 bytes.
+	cdcMask = (1<<20 - 1) << 44
+)
+
+// gearTable is a table of random numbers for gear hash.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	// splitmix64 with fixed seed, so chunk boundaries are stable
+	// across processes.
+	x := uint64(0x676f6d61) // "goma"
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// cdcBoundary returns size of the first chunk in data.
+func cdcBoundary(data []byte) int {
+	if len(data) <= cdcMinSize {
+		return len(data)
+	}
+	end := len(data)
+	if end > cdcMaxSize {
+		end = cdcMaxSize
+	}
+	var h uint64
+	for i := cdcMinSize; i < end; i++ {
+		h = h<<1 + gearTable[data[i]]
+		if h&cdcMask == 0 {
+			return i + 1
+		}
+	}
+	return end
+}
+
+// chunker splits content read from r into content-defined chunks.
+type chunker struct {
+	r   io.Reader
+	buf []byte
+	eof bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{
+		r:   r,
+		buf: make([]byte, 0, cdcMaxSize),
+	}
+}
+
+// next returns next chunk. It returns io.EOF if no more chunk.
+func (c *chunker) next() ([]byte, error) {
+	for len(c.buf) < cap(c.buf) && !c.eof {
+		n, err := c.r.Read(c.buf[len(c.buf):cap(c.buf)])
+		c.buf = c.buf[:len(c.buf)+n]
+		if err == io.EOF {
+			c.eof = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	n := cdcBoundary(c.buf)
+	chunk := append([]byte(nil), c.buf[:n]...)
+	c.buf = c.buf[:copy(c.buf, c.buf[n:])]
+	return chunk, nil
+}
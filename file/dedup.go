@@ -0,0 +1,165 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/hash"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	cachepb "go.chromium.org/goma/server/proto/cache"
+	filepb "go.chromium.org/goma/server/proto/file"
+)
+
+// key prefix of index from chunk content hash to FILE_CHUNK hash key.
+const chunkIndexPrefix = "chunk/"
+
+// isChunkRef reports whether blob is chunk ref.
+func isChunkRef(blob *gomapb.FileBlob) bool {
+	return blob.GetBlobType() == gomapb.FileBlob_FILE_CHUNK && blob.Content == nil && len(blob.GetHashKey()) == 1
+}
+
+// storeChunkRef returns FILE_CHUNK blob for chunk ref to store.
+func (s *Service) storeChunkRef(ctx context.Context, ref *gomapb.FileBlob) (*gomapb.FileBlob, error) {
+	if !s.DedupChunks {
+		return nil, errors.New("chunk dedup is not enabled")
+	}
+	return s.resolveChunkRef(ctx, ref)
+}
+
+// resolveChunkRef returns FILE_CHUNK blob for chunk ref.
+func (s *Service) resolveChunkRef(ctx context.Context, ref *gomapb.FileBlob) (*gomapb.FileBlob, error) {
+	contentHash := ref.GetHashKey()[0]
+	resp, err := s.Cache.Get(ctx, &cachepb.GetReq{
+		Key: chunkIndexPrefix + contentHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := s.lookupBlob(ctx, string(resp.GetKv().GetValue()))
+	if err != nil {
+		return nil, err
+	}
+	if chunk.GetBlobType() != gomapb.FileBlob_FILE_CHUNK || hash.SHA256Content(chunk.GetContent()) != contentHash {
+		return nil, fmt.Errorf("chunk %s: stale index", contentHash)
+	}
+	return &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+		Offset:   ref.Offset,
+		Content:  chunk.GetContent(),
+		FileSize: ref.FileSize,
+	}, nil
+}
+
+// putChunkIndex records index from chunk content hash to hash key.
+func (s *Service) putChunkIndex(ctx context.Context, chunk *gomapb.FileBlob, hashKey string) error {
+	_, err := s.Cache.Put(ctx, &cachepb.PutReq{
+		Kv: &cachepb.KV{
+			Key:   chunkIndexPrefix + hash.SHA256Content(chunk.GetContent()),
+			Value: []byte(hashKey),
+		},
+	})
+	return err
+}
+
+// FromReaderDedup is like FromReader, but splits large content into
+// content-defined chunks, and uploads only chunks whose content is not
+// known by file service.
+//
+// FILE_CHUNK hash key depends on its offset, so the same content at
+// different offset would need to be uploaded again. To avoid it, it
+// first sends chunk ref, which is FILE_CHUNK blob without content,
+// and with SHA-256 of the content in hash_key.
+// If Service.DedupChunks is set, file service resolves chunk ref by
+// index from content hash to hash key of chunk stored before, and
+// stores FILE_CHUNK with the content at the requested offset.
+// If chunk ref can't be resolved, it sends the chunk content.
+// fc must not be nil.
+func FromReaderDedup(ctx context.Context, fc filepb.FileServiceClient, r io.Reader, blob *gomapb.FileBlob) error {
+	if blob.FileSize == nil {
+		return errors.New("FileSize is not set")
+	}
+	if blob.GetFileSize() < LargeFileThreshold {
+		return FromReader(ctx, fc, r, blob)
+	}
+
+	blob.BlobType = gomapb.FileBlob_FILE_META.Enum()
+	c := newChunker(r)
+	var offset int64
+	for offset < blob.GetFileSize() {
+		content, err := c.next()
+		if err != nil {
+			return fmt.Errorf("read chunk offset=%d: %v", offset, err)
+		}
+		chunk := &gomapb.FileBlob{
+			BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+			FileSize: blob.FileSize,
+			Offset:   proto.Int64(offset),
+			Content:  content,
+		}
+		hk, err := storeChunkDedup(ctx, fc, chunk)
+		if err != nil {
+			return err
+		}
+		blob.HashKey = append(blob.HashKey, hk)
+		offset += int64(len(content))
+	}
+	if offset != blob.GetFileSize() {
+		return fmt.Errorf("size mismatch: read=%d file_size=%d", offset, blob.GetFileSize())
+	}
+	cresp, err := fc.StoreFile(ctx, &gomapb.StoreFileReq{
+		Blob: []*gomapb.FileBlob{blob},
+	})
+	if err != nil {
+		return err
+	}
+	if len(cresp.HashKey) == 0 || cresp.HashKey[0] == "" {
+		return fmt.Errorf("failed to store file_meta filesize=%d", blob.GetFileSize())
+	}
+	return nil
+}
+
+// storeChunkDedup stores chunk by chunk ref if possible,
+// or by its content.
+func storeChunkDedup(ctx context.Context, fc filepb.FileServiceClient, chunk *gomapb.FileBlob) (string, error) {
+	hk, err := hash.SHA256Proto(chunk)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute hash of chunk offset=%d: %v", chunk.GetOffset(), err)
+	}
+	ref := &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+		FileSize: chunk.FileSize,
+		Offset:   chunk.Offset,
+		HashKey:  []string{hash.SHA256Content(chunk.GetContent())},
+	}
+	cresp, err := fc.StoreFile(ctx, &gomapb.StoreFileReq{
+		Blob: []*gomapb.FileBlob{ref},
+	})
+	// file service that doesn't support chunk ref would store ref
+	// as is, so check the hash key.
+	if err == nil && len(cresp.HashKey) == 1 && cresp.HashKey[0] == hk {
+		return hk, nil
+	}
+	if err != nil && status.Code(err) != codes.NotFound {
+		return "", err
+	}
+	cresp, err = fc.StoreFile(ctx, &gomapb.StoreFileReq{
+		Blob: []*gomapb.FileBlob{chunk},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(cresp.HashKey) == 0 || cresp.HashKey[0] == "" {
+		return "", fmt.Errorf("failed to store chunk offset=%d size=%d", chunk.GetOffset(), len(chunk.GetContent()))
+	}
+	return cresp.HashKey[0], nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/cache"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// countingClient counts FILE_CHUNK blobs stored with content.
+type countingClient struct {
+	serviceClient
+	chunks int
+}
+
+func (c *countingClient) StoreFile(ctx context.Context, req *gomapb.StoreFileReq, opts ...grpc.CallOption) (*gomapb.StoreFileResp, error) {
+	for _, blob := range req.Blob {
+		if blob.GetBlobType() == gomapb.FileBlob_FILE_CHUNK && blob.Content != nil {
+			c.chunks++
+		}
+	}
+	return c.serviceClient.StoreFile(ctx, req, opts...)
+}
+
+func TestFromReaderDedup(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 64 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Cache:       cache.LocalClient{CacheServiceServer: c},
+		DedupChunks: true,
+	}
+	fc := &countingClient{serviceClient: serviceClient{s: s}}
+
+	data := make([]byte, 6*1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	upload := func(data []byte) *gomapb.FileBlob {
+		t.Helper()
+		fc.chunks = 0
+		blob := &gomapb.FileBlob{
+			FileSize: proto.Int64(int64(len(data))),
+		}
+		err := FromReaderDedup(ctx, fc, bytes.NewReader(data), blob)
+		if err != nil {
+			t.Fatalf("FromReaderDedup(...)=%v; want nil error", err)
+		}
+		fname := filepath.Join(t.TempDir(), "out")
+		err = ToLocal(ctx, fc, blob, fname)
+		if err != nil {
+			t.Fatalf("ToLocal(...)=%v; want nil error", err)
+		}
+		got, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("ToLocal(FromReaderDedup(data)) != data")
+		}
+		return blob
+	}
+
+	blob := upload(data)
+	if fc.chunks != len(blob.HashKey) {
+		t.Errorf("first upload: uploaded %d chunks; want %d", fc.chunks, len(blob.HashKey))
+	}
+
+	// insert some bytes at the beginning.
+	modified := append([]byte("// generated header\n"), data...)
+	blob = upload(modified)
+	if fc.chunks >= len(blob.HashKey) || fc.chunks > 2 {
+		t.Errorf("modified upload: uploaded %d chunks out of %d; want <= 2", fc.chunks, len(blob.HashKey))
+	}
+
+	// without dedup in service, it should upload all chunks.
+	s.DedupChunks = false
+	modified = append([]byte("/* other header */\n"), data...)
+	blob = upload(modified)
+	if fc.chunks != len(blob.HashKey) {
+		t.Errorf("upload without dedup: uploaded %d chunks; want %d", fc.chunks, len(blob.HashKey))
+	}
+}
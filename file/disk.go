@@ -93,6 +93,10 @@ func toLocal(ctx context.Context, fc filepb.FileServiceClient, blob *gomapb.File
 
 // FromLocal reads fname and fills in blob, and stores it in FileServiceClient.
 func FromLocal(ctx context.Context, fc filepb.FileServiceClient, fname string, blob *gomapb.FileBlob) (os.FileInfo, error) {
+	return fromLocal(ctx, fc, fname, blob, FromReader)
+}
+
+func fromLocal(ctx context.Context, fc filepb.FileServiceClient, fname string, blob *gomapb.FileBlob, fromReader func(context.Context, filepb.FileServiceClient, io.Reader, *gomapb.FileBlob) error) (os.FileInfo, error) {
 	f, err := os.Open(fname)
 	if err != nil {
 		return nil, err
@@ -100,7 +104,7 @@ func FromLocal(ctx context.Context, fc filepb.FileServiceClient, fname string, b
 	defer f.Close()
 	fi, err := f.Stat()
 	blob.FileSize = proto.Int64(fi.Size())
-	return fi, FromReader(ctx, fc, f, blob)
+	return fi, fromReader(ctx, fc, f, blob)
 }
 
 // FromReader reads contents from r and fills in blob, and stores it in FileServiceClient if fc != nil.
@@ -212,6 +216,9 @@ func (b *BlobSpec) Init(ctx context.Context, client filepb.FileServiceClient) er
 // Disk provides convenient methods to convert between local file and FileBlob in goma file service.
 type Disk struct {
 	Client filepb.FileServiceClient
+
+	// DedupChunks uploads large files by FromReaderDedup.
+	DedupChunks bool
 }
 
 // TODO: hard linkable cache.
@@ -234,7 +241,11 @@ func (d Disk) FromLocal(ctx context.Context, fname string, spec *BlobSpec) error
 	spec.Blob = &gomapb.FileBlob{
 		BlobType: gomapb.FileBlob_FILE_UNSPECIFIED.Enum(),
 	}
-	fi, err := FromLocal(ctx, d.Client, fname, spec.Blob)
+	fromReader := FromReader
+	if d.DedupChunks {
+		fromReader = FromReaderDedup
+	}
+	fi, err := fromLocal(ctx, d.Client, fname, spec.Blob, fromReader)
 	if err != nil {
 		return err
 	}
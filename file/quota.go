@@ -0,0 +1,125 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/auth/enduser"
+)
+
+// DefaultQuotaPeriod is default period to reset quota usage.
+const DefaultQuotaPeriod = 1 * time.Hour
+
+// Quota limits bytes stored by StoreFile per group of end user in
+// a period.
+// Usage is tracked in memory of each file server, so the limit is
+// per server instance.
+type Quota struct {
+	// Limit is max bytes to store per group in a period.
+	// 0 or negative means no limit.
+	Limit int64
+
+	// GroupLimits overrides Limit for the group.
+	GroupLimits map[string]int64
+
+	// Period is a period to reset usage.
+	// If it is 0, DefaultQuotaPeriod is used.
+	Period time.Duration
+
+	// now is for testing.
+	now func() time.Time
+
+	mu    sync.Mutex
+	start time.Time
+	usage map[string]int64
+}
+
+func (q *Quota) timeNow() time.Time {
+	if q.now != nil {
+		return q.now()
+	}
+	return time.Now()
+}
+
+func (q *Quota) period() time.Duration {
+	if q.Period > 0 {
+		return q.Period
+	}
+	return DefaultQuotaPeriod
+}
+
+func (q *Quota) limit(group string) int64 {
+	if l, ok := q.GroupLimits[group]; ok {
+		return l
+	}
+	return q.Limit
+}
+
+// quotaGroup returns group of end user in ctx.
+func quotaGroup(ctx context.Context) string {
+	u, _ := enduser.FromContext(ctx)
+	return u.Group
+}
+
+// Reserve reserves size bytes for the group of end user in ctx.
+// It returns error with codes.ResourceExhausted if the group exceeds
+// its quota in current period.
+func (q *Quota) Reserve(ctx context.Context, size int64) error {
+	if q == nil {
+		return nil
+	}
+	group := quotaGroup(ctx)
+	limit := q.limit(group)
+	if limit <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.timeNow()
+	if q.usage == nil || now.Sub(q.start) >= q.period() {
+		q.start = now
+		q.usage = make(map[string]int64)
+	}
+	if q.usage[group]+size > limit {
+		return status.Errorf(codes.ResourceExhausted, "group %q exceeds storage quota: usage=%d size=%d limit=%d per %s", group, q.usage[group], size, limit, q.period())
+	}
+	q.usage[group] += size
+	return nil
+}
+
+// Release releases size bytes reserved by Reserve, e.g. when it failed
+// to store.
+func (q *Quota) Release(ctx context.Context, size int64) {
+	if q == nil {
+		return
+	}
+	group := quotaGroup(ctx)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.usage[group] < size {
+		// usage has been reset.
+		return
+	}
+	q.usage[group] -= size
+}
+
+// Usage returns bytes stored by the group in current period.
+func (q *Quota) Usage(group string) int64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.usage == nil || q.timeNow().Sub(q.start) >= q.period() {
+		return 0
+	}
+	return q.usage[group]
+}
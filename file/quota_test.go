@@ -0,0 +1,95 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	"go.chromium.org/goma/server/cache"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	ctxA := enduser.NewContext(ctx, enduser.New("a@example.com", "group-a", nil))
+	ctxB := enduser.NewContext(ctx, enduser.New("b@example.com", "group-b", nil))
+
+	now := time.Now()
+	q := &Quota{
+		Limit: 100,
+		GroupLimits: map[string]int64{
+			"group-b": 0,
+		},
+		Period: time.Minute,
+		now: func() time.Time {
+			return now
+		},
+	}
+	err := q.Reserve(ctxA, 60)
+	if err != nil {
+		t.Errorf("Reserve(group-a, 60)=%v; want nil", err)
+	}
+	err = q.Reserve(ctxA, 60)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Reserve(group-a, 60)=%v; want %v", err, codes.ResourceExhausted)
+	}
+	err = q.Reserve(ctxB, 1000)
+	if err != nil {
+		t.Errorf("Reserve(group-b, 1000)=%v; want nil (no limit)", err)
+	}
+	q.Release(ctxA, 60)
+	if got := q.Usage("group-a"); got != 0 {
+		t.Errorf("Usage(group-a)=%d; want 0", got)
+	}
+	err = q.Reserve(ctxA, 100)
+	if err != nil {
+		t.Errorf("Reserve(group-a, 100)=%v; want nil", err)
+	}
+
+	now = now.Add(time.Minute)
+	if got := q.Usage("group-a"); got != 0 {
+		t.Errorf("Usage(group-a) after period=%d; want 0", got)
+	}
+	err = q.Reserve(ctxA, 100)
+	if err != nil {
+		t.Errorf("Reserve(group-a, 100) after period=%v; want nil", err)
+	}
+}
+
+func TestStoreFileQuota(t *testing.T) {
+	ctx := enduser.NewContext(context.Background(), enduser.New("a@example.com", "group-a", nil))
+	c, err := cache.New(cache.Config{
+		MaxBytes: 1 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Cache: cache.LocalClient{CacheServiceServer: c},
+		Quota: &Quota{
+			Limit: 100,
+		},
+	}
+	req := &gomapb.StoreFileReq{
+		Blob: []*gomapb.FileBlob{
+			{
+				BlobType: gomapb.FileBlob_FILE.Enum(),
+				Content:  make([]byte, 200),
+				FileSize: proto.Int64(200),
+			},
+		},
+	}
+	resp, err := s.StoreFile(ctx, req)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("StoreFile(200 bytes)=%v, %v; want %v", resp, err, codes.ResourceExhausted)
+	}
+}
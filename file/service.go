@@ -7,16 +7,21 @@ package file
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"go.chromium.org/goma/server/cache"
 	"go.chromium.org/goma/server/hash"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 
 	gomapb "go.chromium.org/goma/server/proto/api"
 	cachepb "go.chromium.org/goma/server/proto/cache"
@@ -35,13 +40,58 @@ type Service struct {
 	filepb.UnimplementedFileServiceServer
 	// Cache is a fileblob storage.
 	Cache cachepb.CacheServiceClient
+
+	// VerifyHash verifies SHA-256 of blobs read from Cache
+	// against requested hash key. Blob with mismatched hash is
+	// treated as cache miss, so client will upload it again.
+	VerifyHash bool
+
+	// IndexContent records index from content hash to hash key for
+	// FILE blobs, so ByteStream can serve them by content digest.
+	IndexContent bool
+
+	// Backfiller fetches blobs missing in Cache, if set.
+	Backfiller Backfiller
+
+	// DedupChunks enables chunk ref in StoreFile, and records index
+	// from content hash to hash key for FILE_CHUNK blobs.
+	// See FromReaderDedup.
+	DedupChunks bool
+
+	// SkipExisting skips Put in StoreFile if the hash key already
+	// exists in Cache, checked by Exists rpc.
+	// Blobs are stored as usual if Cache doesn't support Exists rpc.
+	SkipExisting bool
+
+	// Quota limits bytes stored per group of end user, if set.
+	Quota *Quota
+
+	// corrupted records hash keys detected as corrupted in LookupFile,
+	// so StoreFile overwrites them even if SkipExisting is set.
+	corrupted sync.Map
+}
+
+// Backfiller fetches blob that is not stored in Cache yet.
+type Backfiller interface {
+	// Backfill returns FILE blob for hashKey, which is SHA-256 of
+	// the content. It returns error with codes.NotFound if hashKey
+	// is unknown.
+	Backfill(ctx context.Context, hashKey string) (*gomapb.FileBlob, error)
 }
 
 // StoreFile stores FileBlob.
 func (s *Service) StoreFile(ctx context.Context, req *gomapb.StoreFileReq) (*gomapb.StoreFileResp, error) {
-	span := trace.FromContext(ctx)
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/file.Service.StoreFile")
+	defer span.End()
 
 	span.AddAttributes(trace.Int64Attribute("store_num", int64(len(req.GetBlob()))))
+	var storeBytes, skipBytes int64
+	defer func() {
+		span.AddAttributes(
+			trace.Int64Attribute("store_bytes", atomic.LoadInt64(&storeBytes)),
+			trace.Int64Attribute("skip_bytes", atomic.LoadInt64(&skipBytes)),
+		)
+	}()
 
 	logger := log.FromContext(ctx)
 	start := time.Now()
@@ -59,6 +109,18 @@ func (s *Service) StoreFile(ctx context.Context, req *gomapb.StoreFileReq) (*gom
 		i, blob := i, blob
 		// TODO: limit goroutine if cache server is overloaded or many request consume many memory.
 		errg.Go(func() error {
+			if isChunkRef(blob) {
+				chunk, err := s.storeChunkRef(ctx, blob)
+				if err != nil {
+					span.Annotatef(nil, "%d: chunk ref %s: %v", i, blob.GetHashKey()[0], err)
+					logger.Infof("%d: chunk ref %s: %v", i, blob.GetHashKey()[0], err)
+					if single {
+						return status.Errorf(codes.NotFound, "chunk ref %s: %v", blob.GetHashKey()[0], err)
+					}
+					return nil
+				}
+				blob = chunk
+			}
 			if !IsValid(blob) {
 				span.Annotatef(nil, "%d: invalid blob", i)
 				logger.Errorf("%d: invalid blob", i)
@@ -80,25 +142,56 @@ func (s *Service) StoreFile(ctx context.Context, req *gomapb.StoreFileReq) (*gom
 			hashKey := hash.SHA256Content(b)
 			hashTime := time.Since(t)
 			t = time.Now()
-			_, err = s.Cache.Put(ctx, &cachepb.PutReq{
-				Kv: &cachepb.KV{
-					Key:   hashKey,
-					Value: b,
-				},
-			})
-			putTime := time.Since(t)
-			span.Annotatef(nil, "%d hashKey=%s: %v", i, hashKey, err)
-			if err != nil {
-				logger.Errorf("%d: cache.Put %s: %v", i, hashKey, err)
-				if single || status.Code(err) == codes.ResourceExhausted {
-					// when resource exhausted, fail whole request, not fail of individual blob.
+			if s.SkipExisting && s.exists(ctx, hashKey) {
+				span.Annotatef(nil, "%d hashKey=%s: exists", i, hashKey)
+				atomic.AddInt64(&skipBytes, int64(len(b)))
+				stats.Record(ctx, existingBlobs.M(1))
+			} else {
+				err = s.Quota.Reserve(ctx, int64(len(b)))
+				if err != nil {
+					span.Annotatef(nil, "%d hashKey=%s: %v", i, hashKey, err)
+					logger.Warnf("%d: quota %s: %v", i, hashKey, err)
+					stats.RecordWithTags(ctx, []tag.Mutator{
+						tag.Upsert(metrics.GroupKey, quotaGroup(ctx)),
+					}, quotaExceeded.M(1))
 					return err
 				}
-				// TODO: report individual error.
-				// client will get empty HashKey for failed blobs.
-				return nil
+				_, err = s.Cache.Put(ctx, &cachepb.PutReq{
+					Kv: &cachepb.KV{
+						Key:   hashKey,
+						Value: b,
+					},
+					BlobType: cache.BlobTypeFromContext(ctx),
+				})
+				span.Annotatef(nil, "%d hashKey=%s: %v", i, hashKey, err)
+				if err != nil {
+					s.Quota.Release(ctx, int64(len(b)))
+					logger.Errorf("%d: cache.Put %s: %v", i, hashKey, err)
+					if single || status.Code(err) == codes.ResourceExhausted {
+						// when resource exhausted, fail whole request, not fail of individual blob.
+						return err
+					}
+					// TODO: report individual error.
+					// client will get empty HashKey for failed blobs.
+					return nil
+				}
+				s.corrupted.Delete(hashKey)
+				atomic.AddInt64(&storeBytes, int64(len(b)))
 			}
+			putTime := time.Since(t)
 			resp.HashKey[i] = hashKey
+			if s.IndexContent && blob.GetBlobType() == gomapb.FileBlob_FILE {
+				err = s.putContentIndex(ctx, hash.SHA256Content(blob.GetContent()), hashKey)
+				if err != nil {
+					logger.Warnf("%d: index %s: %v", i, hashKey, err)
+				}
+			}
+			if s.DedupChunks && blob.GetBlobType() == gomapb.FileBlob_FILE_CHUNK {
+				err = s.putChunkIndex(ctx, blob, hashKey)
+				if err != nil {
+					logger.Warnf("%d: chunk index %s: %v", i, hashKey, err)
+				}
+			}
 			logger.Infof("%d: cache.Put %s: marshal:%s hash:%s put:%s", i, hashKey, marshalTime, hashTime, putTime)
 			return nil
 		})
@@ -113,8 +206,10 @@ func (s *Service) StoreFile(ctx context.Context, req *gomapb.StoreFileReq) (*gom
 
 // LookupFile looks up FileBlob.
 func (s *Service) LookupFile(ctx context.Context, req *gomapb.LookupFileReq) (*gomapb.LookupFileResp, error) {
-	span := trace.FromContext(ctx)
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/file.Service.LookupFile")
+	defer span.End()
 	span.AddAttributes(trace.Int64Attribute("lookup_num", int64(len(req.GetHashKey()))))
+	var foundNum, lookupBytes int64
 
 	logger := log.FromContext(ctx)
 
@@ -141,6 +236,20 @@ func (s *Service) LookupFile(ctx context.Context, req *gomapb.LookupFileReq) (*g
 			})
 			getTime := time.Since(t)
 			t = time.Now()
+			if s.Backfiller != nil && (status.Code(err) == codes.NotFound || (err == nil && len(r.Kv.Value) == 0)) {
+				blob, err := s.backfill(ctx, hashKey)
+				if err != nil {
+					span.Annotatef(nil, "%d: hashKey=%s backfill: %v", i, hashKey, err)
+					if status.Code(err) != codes.NotFound {
+						logger.Warnf("%d: backfill %s: %v", i, hashKey, err)
+					}
+					return
+				}
+				resp.Blob[i] = blob
+				atomic.AddInt64(&foundNum, 1)
+				logger.Infof("%d: backfill %s: %s", i, hashKey, time.Since(t))
+				return
+			}
 			if err != nil {
 				span.Annotatef(nil, "%d: hashKey=%s: %v", i, hashKey, err)
 				logger.Warnf("%d: cache.Get %s: %v", i, hashKey, err)
@@ -151,6 +260,15 @@ func (s *Service) LookupFile(ctx context.Context, req *gomapb.LookupFileReq) (*g
 				logger.Errorf("%d: cache.Get %s: no value", i, hashKey)
 				return
 			}
+			if s.VerifyHash {
+				if h := hash.SHA256Content(r.Kv.Value); h != hashKey && !isBackfilled(hashKey, r.Kv.Value) {
+					span.Annotatef(nil, "%d: hashKey=%s corrupted: %s", i, hashKey, h)
+					logger.Errorf("%d: cache.Get %s: corrupted blob: hash=%s size=%d", i, hashKey, h, len(r.Kv.Value))
+					stats.Record(ctx, corruptedBlobs.M(1))
+					s.corrupted.Store(hashKey, true)
+					return
+				}
+			}
 			err = proto.Unmarshal(r.Kv.Value, resp.Blob[i])
 			unmarshalTime := time.Since(t)
 			if err != nil {
@@ -158,12 +276,76 @@ func (s *Service) LookupFile(ctx context.Context, req *gomapb.LookupFileReq) (*g
 				logger.Errorf("%d: proto.Unmarshal %s: %v", i, hashKey, err)
 				return
 			}
+			atomic.AddInt64(&foundNum, 1)
+			atomic.AddInt64(&lookupBytes, int64(len(r.Kv.Value)))
 			logger.Infof("%d: cache.Get %s: get:%s unmarshal:%s", i, hashKey, getTime, unmarshalTime)
 		}(i, hashKey)
 	}
 	logger.Debugf("waiting lookup %d blobs", len(req.GetHashKey()))
 	wg.Wait()
 	logger.Debugf("lookup %d blobs %s", len(req.GetHashKey()), time.Since(start))
+	span.AddAttributes(
+		trace.Int64Attribute("found_num", foundNum),
+		trace.Int64Attribute("lookup_bytes", lookupBytes),
+	)
 
 	return resp, nil
 }
+
+// exists reports whether hashKey exists in s.Cache.
+// It returns false if hashKey was detected as corrupted, or it fails
+// to check, so the blob will be stored.
+func (s *Service) exists(ctx context.Context, hashKey string) bool {
+	if _, ok := s.corrupted.Load(hashKey); ok {
+		return false
+	}
+	ok, err := cache.Exists(ctx, s.Cache, "", hashKey)
+	if err != nil {
+		if status.Code(err) != codes.Unimplemented {
+			logger := log.FromContext(ctx)
+			logger.Warnf("exists %s: %v", hashKey, err)
+		}
+		return false
+	}
+	return ok
+}
+
+// backfill fetches blob for hashKey by s.Backfiller, and stores it in
+// s.Cache with hashKey.
+func (s *Service) backfill(ctx context.Context, hashKey string) (*gomapb.FileBlob, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/file.Service.backfill")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("hash_key", hashKey))
+	blob, err := s.Backfiller.Backfill(ctx, hashKey)
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.Marshal(blob)
+	if err != nil {
+		return nil, err
+	}
+	span.AddAttributes(trace.Int64Attribute("size", int64(len(b))))
+	_, err = s.Cache.Put(ctx, &cachepb.PutReq{
+		Kv: &cachepb.KV{
+			Key:   hashKey,
+			Value: b,
+		},
+		BlobType: cache.BlobTypeFromContext(ctx),
+	})
+	if err != nil {
+		// still returns blob for this request.
+		logger := log.FromContext(ctx)
+		logger.Warnf("backfill %s: cache.Put: %v", hashKey, err)
+	}
+	return blob, nil
+}
+
+// isBackfilled reports whether serialized blob b is FILE blob
+// stored by backfill, whose hashKey is SHA-256 of the content.
+func isBackfilled(hashKey string, b []byte) bool {
+	blob := &gomapb.FileBlob{}
+	if err := proto.Unmarshal(b, blob); err != nil {
+		return false
+	}
+	return blob.GetBlobType() == gomapb.FileBlob_FILE && hash.SHA256Content(blob.GetContent()) == hashKey
+}
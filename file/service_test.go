@@ -0,0 +1,173 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/cache"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	cachepb "go.chromium.org/goma/server/proto/cache"
+)
+
+func TestLookupFileVerifyHash(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 1 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cclient := cache.LocalClient{CacheServiceServer: c}
+	s := &Service{
+		Cache:      cclient,
+		VerifyHash: true,
+	}
+	blob := &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE.Enum(),
+		Content:  []byte("int main() {}\n"),
+		FileSize: proto.Int64(14),
+	}
+	sresp, err := s.StoreFile(ctx, &gomapb.StoreFileReq{
+		Blob: []*gomapb.FileBlob{blob},
+	})
+	if err != nil {
+		t.Fatalf("StoreFile(...)=%v, %v; want nil error", sresp, err)
+	}
+	hashKey := sresp.HashKey[0]
+
+	resp, err := s.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	})
+	if err != nil {
+		t.Fatalf("LookupFile(%q)=%v, %v; want nil error", hashKey, resp, err)
+	}
+	if got, want := resp.Blob[0].GetBlobType(), gomapb.FileBlob_FILE; got != want {
+		t.Errorf("LookupFile(%q).Blob[0].BlobType=%v; want %v", hashKey, got, want)
+	}
+
+	// corrupt the entry.
+	corrupted := proto.Clone(blob).(*gomapb.FileBlob)
+	corrupted.Content = []byte("int main() {]\n")
+	b, err := proto.Marshal(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cclient.Put(ctx, &cachepb.PutReq{
+		Kv: &cachepb.KV{
+			Key:   hashKey,
+			Value: b,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = s.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	})
+	if err != nil {
+		t.Fatalf("LookupFile(%q)=%v, %v; want nil error", hashKey, resp, err)
+	}
+	if got, want := resp.Blob[0].GetBlobType(), gomapb.FileBlob_FILE_UNSPECIFIED; got != want {
+		t.Errorf("LookupFile(%q).Blob[0].BlobType=%v; want %v for corrupted entry", hashKey, got, want)
+	}
+
+	s.VerifyHash = false
+	resp, err = s.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	})
+	if err != nil {
+		t.Fatalf("LookupFile(%q)=%v, %v; want nil error", hashKey, resp, err)
+	}
+	if got, want := resp.Blob[0].GetBlobType(), gomapb.FileBlob_FILE; got != want {
+		t.Errorf("LookupFile(%q).Blob[0].BlobType=%v; want %v without verification", hashKey, got, want)
+	}
+}
+
+// putCountingCache counts Put calls.
+type putCountingCache struct {
+	cache.LocalClient
+	puts int
+}
+
+func (c *putCountingCache) Put(ctx context.Context, in *cachepb.PutReq, opts ...grpc.CallOption) (*cachepb.PutResp, error) {
+	c.puts++
+	return c.LocalClient.Put(ctx, in, opts...)
+}
+
+func TestStoreFileSkipExisting(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 1 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cclient := &putCountingCache{
+		LocalClient: cache.LocalClient{CacheServiceServer: c},
+	}
+	s := &Service{
+		Cache:        cclient,
+		VerifyHash:   true,
+		SkipExisting: true,
+	}
+	blob := &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE.Enum(),
+		Content:  []byte("int main() {}\n"),
+		FileSize: proto.Int64(14),
+	}
+	store := func() string {
+		t.Helper()
+		resp, err := s.StoreFile(ctx, &gomapb.StoreFileReq{
+			Blob: []*gomapb.FileBlob{blob},
+		})
+		if err != nil || len(resp.HashKey) != 1 || resp.HashKey[0] == "" {
+			t.Fatalf("StoreFile(...)=%v, %v; want hash key", resp, err)
+		}
+		return resp.HashKey[0]
+	}
+	hashKey := store()
+	if cclient.puts != 1 {
+		t.Errorf("puts=%d; want 1", cclient.puts)
+	}
+	if got := store(); got != hashKey {
+		t.Errorf("StoreFile(...)=%q; want %q", got, hashKey)
+	}
+	if cclient.puts != 1 {
+		t.Errorf("puts=%d; want 1 for existing blob", cclient.puts)
+	}
+
+	// corrupt the entry, and detect it by LookupFile.
+	_, err = cclient.LocalClient.Put(ctx, &cachepb.PutReq{
+		Kv: &cachepb.KV{
+			Key:   hashKey,
+			Value: []byte("corrupted"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	})
+	if err != nil || resp.Blob[0].GetBlobType() != gomapb.FileBlob_FILE_UNSPECIFIED {
+		t.Fatalf("LookupFile(%q)=%v, %v; want miss for corrupted entry", hashKey, resp, err)
+	}
+	store()
+	if cclient.puts != 2 {
+		t.Errorf("puts=%d; want 2 to overwrite corrupted blob", cclient.puts)
+	}
+	resp, err = s.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	})
+	if err != nil || resp.Blob[0].GetBlobType() != gomapb.FileBlob_FILE {
+		t.Errorf("LookupFile(%q)=%v, %v; want FILE blob", hashKey, resp, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+
+	"go.chromium.org/goma/server/metrics"
+)
+
+var (
+	corruptedBlobs = stats.Int64(
+		"go.chromium.org/goma/server/file.corrupted-blobs",
+		"Number of blobs in cache whose content doesn't match hash key",
+		stats.UnitDimensionless)
+
+	existingBlobs = stats.Int64(
+		"go.chromium.org/goma/server/file.existing-blobs",
+		"Number of blobs not stored in StoreFile since they already exist in cache",
+		stats.UnitDimensionless)
+
+	quotaExceeded = stats.Int64(
+		"go.chromium.org/goma/server/file.quota-exceeded",
+		"Number of blobs rejected in StoreFile since group exceeds storage quota",
+		stats.UnitDimensionless)
+
+	// DefaultViews are the default views provided by this package.
+	// You need to register the view for data to actually be collected.
+	DefaultViews = []*view.View{
+		{
+			Description: "Number of blobs in cache whose content doesn't match hash key",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     corruptedBlobs,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of blobs not stored in StoreFile since they already exist in cache",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     existingBlobs,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of blobs rejected in StoreFile since group exceeds storage quota",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     quotaExceeded,
+			Aggregation: view.Count(),
+		},
+	}
+)
@@ -0,0 +1,360 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/log"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	filepb "go.chromium.org/goma/server/proto/file"
+)
+
+// StreamChunkSize is max content size of FILE_CHUNK blob in a message
+// of StoreFileStream and LookupFileStream.
+const StreamChunkSize = FileChunkSize
+
+// checkStreamChunk checks blob is FILE_CHUNK at offset of file size.
+func checkStreamChunk(blob *gomapb.FileBlob, size, offset int64) error {
+	if blob.GetBlobType() != gomapb.FileBlob_FILE_CHUNK {
+		return status.Errorf(codes.InvalidArgument, "offset=%d: unexpected blob type %v", offset, blob.GetBlobType())
+	}
+	if blob.GetFileSize() != size {
+		return status.Errorf(codes.InvalidArgument, "offset=%d: file size mismatch %d; want %d", offset, blob.GetFileSize(), size)
+	}
+	if blob.GetOffset() != offset {
+		return status.Errorf(codes.InvalidArgument, "unexpected offset %d; want %d", blob.GetOffset(), offset)
+	}
+	if offset+int64(len(blob.GetContent())) > size {
+		return status.Errorf(codes.InvalidArgument, "offset=%d: content %d exceeds file size %d", offset, len(blob.GetContent()), size)
+	}
+	return nil
+}
+
+// streamBlob returns a blob in a message of StoreFileStream.
+func streamBlob(req *gomapb.StoreFileReq) (*gomapb.FileBlob, error) {
+	if len(req.GetBlob()) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "want 1 blob in a message; got %d", len(req.GetBlob()))
+	}
+	return req.Blob[0], nil
+}
+
+// chunkReader reads content of FILE_CHUNK blobs received by recv.
+type chunkReader struct {
+	recv func() (*gomapb.StoreFileReq, error)
+	size int64
+	// offset of next chunk.
+	offset int64
+	buf    []byte
+}
+
+func (r *chunkReader) Read(buf []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		req, err := r.recv()
+		if err == io.EOF {
+			return 0, status.Errorf(codes.InvalidArgument, "stream finished at %d; want %d", r.offset, r.size)
+		}
+		if err != nil {
+			return 0, err
+		}
+		blob, err := streamBlob(req)
+		if err != nil {
+			return 0, err
+		}
+		err = checkStreamChunk(blob, r.size, r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = blob.GetContent()
+		r.offset += int64(len(r.buf))
+	}
+	n := copy(buf, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// finish checks no more message in stream.
+func (r *chunkReader) finish() error {
+	req, err := r.recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return status.Errorf(codes.InvalidArgument, "unexpected message after file end: %d blobs", len(req.GetBlob()))
+}
+
+// StoreFileStream stores a file sent in FILE_CHUNK blobs.
+// It stores the file as FILE_META and FILE_CHUNK blobs if it is large,
+// as FromReader does.
+func (s *Service) StoreFileStream(stream filepb.FileService_StoreFileStreamServer) error {
+	ctx, span := trace.StartSpan(stream.Context(), "go.chromium.org/goma/server/file.Service.StoreFileStream")
+	defer span.End()
+	logger := log.FromContext(ctx)
+
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "no blob")
+	}
+	if err != nil {
+		return err
+	}
+	first, err := streamBlob(req)
+	if err != nil {
+		return err
+	}
+	size := first.GetFileSize()
+	err = checkStreamChunk(first, size, 0)
+	if err != nil {
+		return err
+	}
+	span.AddAttributes(trace.Int64Attribute("size", size))
+	r := &chunkReader{
+		recv:   stream.Recv,
+		size:   size,
+		offset: int64(len(first.GetContent())),
+		buf:    first.GetContent(),
+	}
+	blob := &gomapb.FileBlob{
+		FileSize: proto.Int64(size),
+	}
+	h := sha256.New()
+	fc := serviceClient{s: s}
+	err = FromReader(ctx, fc, io.TeeReader(r, h), blob)
+	if err != nil {
+		logger.Errorf("store stream size=%d: %v", size, err)
+		return err
+	}
+	err = r.finish()
+	if err != nil {
+		return err
+	}
+	var hashKey string
+	switch blob.GetBlobType() {
+	case gomapb.FileBlob_FILE:
+		// FromReader doesn't store FILE blob.
+		resp, err := s.StoreFile(ctx, &gomapb.StoreFileReq{
+			Blob:          []*gomapb.FileBlob{blob},
+			RequesterInfo: req.GetRequesterInfo(),
+		})
+		if err != nil {
+			return err
+		}
+		if len(resp.HashKey) == 0 || resp.HashKey[0] == "" {
+			return status.Errorf(codes.Internal, "failed to store file size=%d", size)
+		}
+		hashKey = resp.HashKey[0]
+	default:
+		hashKey, err = Key(blob)
+		if err != nil {
+			return status.Errorf(codes.Internal, "size=%d: %v", size, err)
+		}
+		if s.IndexContent {
+			err = s.putContentIndex(ctx, hex.EncodeToString(h.Sum(nil)), hashKey)
+			if err != nil {
+				logger.Warnf("store stream: index %s: %v", hashKey, err)
+			}
+		}
+	}
+	span.AddAttributes(trace.StringAttribute("hash_key", hashKey))
+	logger.Infof("store stream %s size=%d", hashKey, size)
+	return stream.SendAndClose(&gomapb.StoreFileResp{
+		HashKey: []string{hashKey},
+	})
+}
+
+// chunkSender sends content in FILE_CHUNK blobs by send.
+type chunkSender struct {
+	send   func(*gomapb.LookupFileResp) error
+	size   int64
+	offset int64
+}
+
+func (c *chunkSender) sendContent(data []byte) error {
+	for len(data) > 0 || c.size == 0 {
+		n := len(data)
+		if n > StreamChunkSize {
+			n = StreamChunkSize
+		}
+		err := c.send(&gomapb.LookupFileResp{
+			Blob: []*gomapb.FileBlob{
+				{
+					BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+					FileSize: proto.Int64(c.size),
+					Offset:   proto.Int64(c.offset),
+					Content:  data[:n],
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if c.size == 0 {
+			return nil
+		}
+		data = data[n:]
+		c.offset += int64(n)
+	}
+	return nil
+}
+
+// LookupFileStream looks up a file and sends its content in
+// FILE_CHUNK blobs.
+func (s *Service) LookupFileStream(req *gomapb.LookupFileReq, stream filepb.FileService_LookupFileStreamServer) error {
+	ctx, span := trace.StartSpan(stream.Context(), "go.chromium.org/goma/server/file.Service.LookupFileStream")
+	defer span.End()
+	logger := log.FromContext(ctx)
+
+	if len(req.GetHashKey()) != 1 {
+		return status.Errorf(codes.InvalidArgument, "want 1 hash key; got %d", len(req.GetHashKey()))
+	}
+	hashKey := req.HashKey[0]
+	span.AddAttributes(trace.StringAttribute("hash_key", hashKey))
+	blob, err := s.lookupBlob(ctx, hashKey)
+	if err != nil {
+		return err
+	}
+	span.AddAttributes(trace.Int64Attribute("size", blob.GetFileSize()))
+	cs := &chunkSender{
+		send: stream.Send,
+		size: blob.GetFileSize(),
+	}
+	switch blob.GetBlobType() {
+	case gomapb.FileBlob_FILE:
+		err = cs.sendContent(blob.GetContent())
+		if err != nil {
+			return err
+		}
+
+	case gomapb.FileBlob_FILE_META:
+		for i, hk := range blob.GetHashKey() {
+			chunk, err := s.lookupBlob(ctx, hk)
+			if err != nil {
+				return status.Errorf(codes.DataLoss, "%s: chunk %d %s: %v", hashKey, i, hk, err)
+			}
+			if chunk.GetBlobType() != gomapb.FileBlob_FILE_CHUNK || chunk.GetOffset() != cs.offset {
+				return status.Errorf(codes.DataLoss, "%s: chunk %d %s: unexpected chunk %v offset=%d; want offset=%d", hashKey, i, hk, chunk.GetBlobType(), chunk.GetOffset(), cs.offset)
+			}
+			err = cs.sendContent(chunk.GetContent())
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return status.Errorf(codes.InvalidArgument, "%s: unexpected blob type %v", hashKey, blob.GetBlobType())
+	}
+	if cs.offset != cs.size {
+		return status.Errorf(codes.DataLoss, "%s: sent %d; want %d", hashKey, cs.offset, cs.size)
+	}
+	logger.Infof("lookup stream %s size=%d", hashKey, cs.size)
+	return nil
+}
+
+// StoreStream stores content of size read from r by StoreFileStream,
+// and returns its hash key.
+func StoreStream(ctx context.Context, fc filepb.FileServiceClient, r io.Reader, size int64, opts ...grpc.CallOption) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := fc.StoreFileStream(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	var offset int64
+	buf := make([]byte, StreamChunkSize)
+	for offset < size || size == 0 {
+		n := size - offset
+		if n > StreamChunkSize {
+			n = StreamChunkSize
+		}
+		_, err := io.ReadFull(r, buf[:n])
+		if err != nil {
+			return "", err
+		}
+		err = stream.Send(&gomapb.StoreFileReq{
+			Blob: []*gomapb.FileBlob{
+				{
+					BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+					FileSize: proto.Int64(size),
+					Offset:   proto.Int64(offset),
+					Content:  buf[:n],
+				},
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		if size == 0 {
+			break
+		}
+		offset += n
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	if len(resp.GetHashKey()) == 0 || resp.HashKey[0] == "" {
+		return "", fmt.Errorf("failed to store file size=%d", size)
+	}
+	return resp.HashKey[0], nil
+}
+
+// LookupStream writes content of hashKey to w by LookupFileStream,
+// and returns its size.
+func LookupStream(ctx context.Context, fc filepb.FileServiceClient, hashKey string, w io.Writer, opts ...grpc.CallOption) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := fc.LookupFileStream(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{hashKey},
+	}, opts...)
+	if err != nil {
+		return 0, err
+	}
+	var offset int64
+	size := int64(-1)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return offset, err
+		}
+		if len(resp.GetBlob()) != 1 {
+			return offset, fmt.Errorf("%s: want 1 blob in a message; got %d", hashKey, len(resp.GetBlob()))
+		}
+		blob := resp.Blob[0]
+		if size < 0 {
+			size = blob.GetFileSize()
+		}
+		err = checkStreamChunk(blob, size, offset)
+		if err != nil {
+			return offset, fmt.Errorf("%s: %v", hashKey, err)
+		}
+		n, err := w.Write(blob.GetContent())
+		offset += int64(n)
+		if err != nil {
+			return offset, err
+		}
+	}
+	if offset != size {
+		return offset, fmt.Errorf("%s: received %d; want %d", hashKey, offset, size)
+	}
+	return offset, nil
+}
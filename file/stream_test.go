@@ -0,0 +1,220 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/cache"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	filepb "go.chromium.org/goma/server/proto/file"
+)
+
+// fakeStoreFileStream is a StoreFileStream client calling
+// Service.StoreFileStream in memory.
+type fakeStoreFileStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	s    *Service
+	reqs []*gomapb.StoreFileReq
+}
+
+func (f *fakeStoreFileStream) Send(req *gomapb.StoreFileReq) error {
+	f.reqs = append(f.reqs, proto.Clone(req).(*gomapb.StoreFileReq))
+	return nil
+}
+
+func (f *fakeStoreFileStream) CloseAndRecv() (*gomapb.StoreFileResp, error) {
+	ss := &fakeStoreFileStreamServer{ctx: f.ctx, reqs: f.reqs}
+	err := f.s.StoreFileStream(ss)
+	return ss.resp, err
+}
+
+type fakeStoreFileStreamServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs []*gomapb.StoreFileReq
+	resp *gomapb.StoreFileResp
+}
+
+func (f *fakeStoreFileStreamServer) Context() context.Context { return f.ctx }
+
+func (f *fakeStoreFileStreamServer) Recv() (*gomapb.StoreFileReq, error) {
+	if len(f.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := f.reqs[0]
+	f.reqs = f.reqs[1:]
+	return req, nil
+}
+
+func (f *fakeStoreFileStreamServer) SendAndClose(resp *gomapb.StoreFileResp) error {
+	f.resp = resp
+	return nil
+}
+
+// fakeLookupFileStream is a LookupFileStream server, and client
+// to receive responses sent to the server.
+type fakeLookupFileStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	resps []*gomapb.LookupFileResp
+}
+
+func (f *fakeLookupFileStream) Context() context.Context { return f.ctx }
+
+func (f *fakeLookupFileStream) Send(resp *gomapb.LookupFileResp) error {
+	f.resps = append(f.resps, proto.Clone(resp).(*gomapb.LookupFileResp))
+	return nil
+}
+
+type fakeLookupFileStreamClient struct {
+	grpc.ClientStream
+	resps []*gomapb.LookupFileResp
+}
+
+func (f *fakeLookupFileStreamClient) Recv() (*gomapb.LookupFileResp, error) {
+	if len(f.resps) == 0 {
+		return nil, io.EOF
+	}
+	resp := f.resps[0]
+	f.resps = f.resps[1:]
+	return resp, nil
+}
+
+// streamClient is a FileServiceClient supporting streaming methods
+// with fake streams.
+type streamClient struct {
+	serviceClient
+}
+
+func (c streamClient) StoreFileStream(ctx context.Context, opts ...grpc.CallOption) (filepb.FileService_StoreFileStreamClient, error) {
+	return &fakeStoreFileStream{ctx: ctx, s: c.s}, nil
+}
+
+func (c streamClient) LookupFileStream(ctx context.Context, req *gomapb.LookupFileReq, opts ...grpc.CallOption) (filepb.FileService_LookupFileStreamClient, error) {
+	stream := &fakeLookupFileStream{ctx: ctx}
+	err := c.s.LookupFileStream(req, stream)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeLookupFileStreamClient{resps: stream.resps}, nil
+}
+
+func TestFileStream(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 64 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Cache: cache.LocalClient{CacheServiceServer: c},
+	}
+	fc := streamClient{serviceClient{s: s}}
+
+	for _, size := range []int{0, 1024, 2*StreamChunkSize + 1024} {
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		hashKey, err := StoreStream(ctx, fc, bytes.NewReader(data), int64(size))
+		if err != nil {
+			t.Fatalf("StoreStream(size=%d)=%q, %v; want nil error", size, hashKey, err)
+		}
+		blob := &gomapb.FileBlob{
+			FileSize: proto.Int64(int64(size)),
+		}
+		err = FromReader(ctx, nil, bytes.NewReader(data), blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := Key(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashKey != want {
+			t.Errorf("StoreStream(size=%d)=%q; want %q", size, hashKey, want)
+		}
+
+		var buf bytes.Buffer
+		n, err := LookupStream(ctx, fc, hashKey, &buf)
+		if err != nil || n != int64(size) {
+			t.Errorf("LookupStream(%q)=%d, %v; want %d, nil", hashKey, n, err, size)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("LookupStream(%q): data mismatch", hashKey)
+		}
+	}
+}
+
+func TestStoreFileStreamInvalid(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.New(cache.Config{
+		MaxBytes: 1 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Cache: cache.LocalClient{CacheServiceServer: c},
+	}
+	chunk := func(size, offset int64, content string) *gomapb.StoreFileReq {
+		return &gomapb.StoreFileReq{
+			Blob: []*gomapb.FileBlob{
+				{
+					BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+					FileSize: proto.Int64(size),
+					Offset:   proto.Int64(offset),
+					Content:  []byte(content),
+				},
+			},
+		}
+	}
+	for _, tc := range []struct {
+		desc string
+		reqs []*gomapb.StoreFileReq
+	}{
+		{
+			desc: "no blob",
+		},
+		{
+			desc: "short",
+			reqs: []*gomapb.StoreFileReq{chunk(6, 0, "foo")},
+		},
+		{
+			desc: "wrong offset",
+			reqs: []*gomapb.StoreFileReq{chunk(6, 0, "foo"), chunk(6, 2, "bar")},
+		},
+		{
+			desc: "wrong size",
+			reqs: []*gomapb.StoreFileReq{chunk(6, 0, "foo"), chunk(7, 3, "bar")},
+		},
+		{
+			desc: "too large",
+			reqs: []*gomapb.StoreFileReq{chunk(6, 0, "foo"), chunk(6, 3, "barbaz")},
+		},
+		{
+			desc: "extra",
+			reqs: []*gomapb.StoreFileReq{chunk(3, 0, "foo"), chunk(3, 3, "")},
+		},
+	} {
+		stream := &fakeStoreFileStream{
+			ctx:  ctx,
+			s:    s,
+			reqs: tc.reqs,
+		}
+		resp, err := stream.CloseAndRecv()
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: StoreFileStream()=%v, %v; want %v", tc.desc, resp, err, codes.InvalidArgument)
+		}
+	}
+}
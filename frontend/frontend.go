@@ -22,6 +22,8 @@ import (
 	"go.chromium.org/goma/server/httprpc"
 	"go.chromium.org/goma/server/log"
 	"go.chromium.org/goma/server/log/errorreporter"
+	"go.chromium.org/goma/server/metrics"
+	"go.chromium.org/goma/server/server"
 )
 
 const (
@@ -50,19 +52,51 @@ var (
 	// see https://chromium.googlesource.com/infra/goma/client/+/70685d6cbb19c108d8abf2235edd2d02bed8dded/client/generate_compiler_proxy_info.py#87
 	userAgentRE = regexp.MustCompile(`compiler-proxy built by \S+ at ([[:xdigit:]]+)@([[:digit:]]+) on .*`)
 
+	idempotentRequests = stats.Int64(
+		"go.chromium.org/goma/server/frontend.idempotent_requests",
+		"Number of requests with idempotency key",
+		stats.UnitDimensionless)
+
+	idempotencyResultKey = tag.MustNewKey("result")
+
+	rateLimitedRequests = stats.Int64(
+		"go.chromium.org/goma/server/frontend.rate_limited_requests",
+		"Number of requests rejected by rate limiter",
+		stats.UnitDimensionless)
+
+	rateLimitKindKey = tag.MustNewKey("kind")
+
 	// DefaultViews are the default views provided by this package.
 	// You need to register he view for data to actually be collected.
 	DefaultViews = []*view.View{
 		{
 			Name:        "go.chromium.org/goma/server/frontend.ping_count_by_useragent",
 			Description: "ping request count by user-agent",
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				userAgentCommitHashKey,
 				userAgentCommitTimeKey,
-			},
+			),
 			Measure:     pingRequests,
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        "go.chromium.org/goma/server/frontend.idempotent_requests",
+			Description: "Number of requests with idempotency key",
+			TagKeys: metrics.TagKeys(
+				idempotencyResultKey,
+			),
+			Measure:     idempotentRequests,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        "go.chromium.org/goma/server/frontend.rate_limited_requests",
+			Description: "Number of requests rejected by rate limiter",
+			TagKeys: metrics.TagKeys(
+				rateLimitKindKey,
+			),
+			Measure:     rateLimitedRequests,
+			Aggregation: view.Count(),
+		},
 	}
 )
 
@@ -110,6 +144,8 @@ func checkUserAgent(ctx context.Context, req *http.Request) error {
 type Backend interface {
 	Ping() http.Handler
 	Exec() http.Handler
+	ExecExt() http.Handler
+	ExecStream() http.Handler
 	ByteStream() http.Handler
 	StoreFile() http.Handler
 	LookupFile() http.Handler
@@ -123,15 +159,51 @@ type Frontend struct {
 
 	TraceLabels map[string]string
 
+	// StoreFileIdempotency replays StoreFile responses for client
+	// retries with the same idempotency key, if set.
+	StoreFileIdempotency *Idempotency
+
+	// IPRateLimiter limits requests per client IP, if set.
+	// Rate limit per group is applied by backend after authentication.
+	// See GroupRateLimiter.
+	IPRateLimiter *RateLimiter
+
+	// Enroll handles enrollment of bots, if set.
+	// Bots exchange OAuth2 access token for short-lived credential
+	// to be used in subsequent requests.
+	Enroll http.Handler
+
+	// BatchMaxCalls is max number of calls in a batch request,
+	// which carries several LookupFile and SaveLog calls in one
+	// http request. 0 disables batch requests.
+	BatchMaxCalls int
+
+	// Notices are notices pushed by operators, if set.
+	// Active notices are served on /notices, and set in NoticeHeader
+	// of all responses, so that clients can show them to developers.
+	Notices *Notices
+
 	// TODO: health status?
 	// TODO: downloadurl?
 	// TODO: compilers? - drop support?
 }
 
+// withTags sets common metrics tags for api on the request context.
+func withTags(api string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := metrics.WithAPI(req.Context(), api)
+		commitHash, _, err := parseUserAgent(req.Header.Get("User-Agent"))
+		if err == nil {
+			ctx = metrics.WithClientVersion(ctx, commitHash)
+		}
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
 // Handler creates http.Handler from Frontend.
 func Handler(f Frontend) http.Handler {
 	mux := http.NewServeMux()
-	mux.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	mux.Handle("/ping", withTags("ping", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/frontend.Handler.ping")
 		defer span.End()
@@ -149,18 +221,66 @@ func Handler(f Frontend) http.Handler {
 		}
 
 		f.Backend.Ping().ServeHTTP(w, req)
-	}))
-	mux.Handle("/e", f.Backend.Exec())
-	mux.Handle("/blobs/", f.Backend.ByteStream())
-	mux.Handle("/s", f.Backend.StoreFile())
-	mux.Handle("/l", f.Backend.LookupFile())
-	mux.Handle("/sl", f.Backend.Execlog())
+	})))
+	mux.Handle("/e", withTags("exec", f.Backend.Exec()))
+	mux.Handle("/ex", withTags("exec_ext", f.Backend.ExecExt()))
+	mux.Handle("/es", withTags("exec_stream", f.Backend.ExecStream()))
+	mux.Handle("/blobs/", withTags("bytestream", f.Backend.ByteStream()))
+	mux.Handle("/s", withTags("store_file", f.StoreFileIdempotency.Handler("store_file", f.Backend.StoreFile())))
+	lookupFile := withTags("lookup_file", f.Backend.LookupFile())
+	mux.Handle("/l", lookupFile)
+	execlog := withTags("execlog", f.Backend.Execlog())
+	mux.Handle("/sl", execlog)
+	if f.Enroll != nil {
+		mux.Handle("/enroll", withTags("enroll", f.Enroll))
+	}
+	if f.BatchMaxCalls > 0 {
+		mux.Handle("/batch", withTags("batch", httprpc.BatchHandler(map[string]http.Handler{
+			"/l":  lookupFile,
+			"/sl": execlog,
+		}, f.BatchMaxCalls)))
+	}
+	if f.Notices != nil {
+		mux.Handle("/notices", withTags("notices", f.Notices))
+	}
 	// TODO: /downloadurl etc?
 
-	h := httprpc.AdmissionControl(f.AC, mux)
+	var h http.Handler = mux
+	if f.Notices != nil {
+		h = noticeHandler(f.Notices, h)
+	}
+	if f.IPRateLimiter != nil {
+		h = httprpc.RateLimitControl(f.IPRateLimiter, h)
+	}
+	if f.AC != nil {
+		h = httprpc.AdmissionControl(loadAdmission{f.AC}, h)
+	}
+	h = loadHandler(h)
 	return h
 }
 
+// loadAdmission reports requests denied by admission controller
+// as admission rejections of server.LoadFrontend.
+type loadAdmission struct {
+	httprpc.AdmissionController
+}
+
+func (a loadAdmission) Admit(req *http.Request) error {
+	err := a.AdmissionController.Admit(req)
+	if err != nil {
+		server.LoadReject(req.Context(), server.LoadFrontend)
+	}
+	return err
+}
+
+// loadHandler reports in-flight requests of server.LoadFrontend.
+func loadHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer server.LoadStart(req.Context(), server.LoadFrontend)()
+		h.ServeHTTP(w, req)
+	})
+}
+
 type reportingResponseWriter struct {
 	http.ResponseWriter
 	er  errorreporter.ErrorReporter
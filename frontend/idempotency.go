@@ -0,0 +1,206 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package frontend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+)
+
+const (
+	// IdempotencyKeyHeader is HTTP header for client's idempotency key.
+	// Requests with the same key are considered as retries of
+	// the same request.
+	IdempotencyKeyHeader = "X-Goma-Idempotency-Key"
+
+	// DefaultIdempotencyTTL is default duration to keep responses.
+	DefaultIdempotencyTTL = 1 * time.Minute
+
+	// DefaultIdempotencyMaxEntries is default max number of
+	// responses to keep.
+	DefaultIdempotencyMaxEntries = 10000
+)
+
+// Idempotency keeps responses of requests with idempotency key
+// for a short time, and replays the response for retries of the same
+// request, so client retries after network blips won't process
+// large request again.
+// Concurrent retries wait for the in-flight request.
+//
+// Only successful responses are kept.
+// Nil Idempotency doesn't keep any response.
+type Idempotency struct {
+	// TTL is duration to keep responses.
+	// 0 means DefaultIdempotencyTTL.
+	TTL time.Duration
+
+	// MaxEntries is max number of responses to keep.
+	// 0 means DefaultIdempotencyMaxEntries.
+	MaxEntries int
+
+	mu    sync.Mutex
+	calls *lru.Cache
+}
+
+// idempotentCall is a call for an idempotency key.
+type idempotentCall struct {
+	done   chan struct{}
+	expire time.Time
+
+	// response. valid after done is closed.
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Handler returns handler for api that replays responses for
+// requests with the same idempotency key.
+func (c *Idempotency) Handler(api string, h http.Handler) http.Handler {
+	if c == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+		// key is chosen by client, so partition it by credential
+		// not to replay response to other users.
+		cred := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+		key = api + "/" + hex.EncodeToString(cred[:]) + "/" + key
+
+		call, ok := c.get(key)
+		if ok {
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				http.Error(w, ctx.Err().Error(), http.StatusServiceUnavailable)
+				return
+			}
+			if call.status == http.StatusOK {
+				recordIdempotency(req, "replay")
+				for k, v := range call.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(call.status)
+				w.Write(call.body)
+				return
+			}
+			// in-flight call failed. process it by itself.
+			recordIdempotency(req, "retry")
+			h.ServeHTTP(w, req)
+			return
+		}
+		recordIdempotency(req, "new")
+		rw := &recordingResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		defer func() {
+			call.status = rw.status
+			call.header = rw.header
+			call.body = rw.body.Bytes()
+			if call.status != http.StatusOK {
+				c.remove(key, call)
+			}
+			close(call.done)
+		}()
+		h.ServeHTTP(rw, req)
+		logger := log.FromContext(ctx)
+		logger.Debugf("idempotency key %s: %d", key, rw.status)
+	})
+}
+
+// get gets call for key. It returns false with new call if there is
+// no call for key, or the call was expired.
+func (c *Idempotency) get(key string) (*idempotentCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		maxEntries := c.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = DefaultIdempotencyMaxEntries
+		}
+		c.calls = lru.New(maxEntries)
+	}
+	now := time.Now()
+	if v, ok := c.calls.Get(key); ok {
+		call := v.(*idempotentCall)
+		if now.Before(call.expire) {
+			return call, true
+		}
+		// expired, but it might be still in-flight.
+		select {
+		case <-call.done:
+		default:
+			return call, true
+		}
+	}
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	call := &idempotentCall{
+		done:   make(chan struct{}),
+		expire: now.Add(ttl),
+	}
+	c.calls.Add(key, call)
+	return call, false
+}
+
+// remove removes call for key, if it is still registered.
+func (c *Idempotency) remove(key string, call *idempotentCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.calls.Get(key)
+	if ok && v.(*idempotentCall) == call {
+		c.calls.Remove(key)
+	}
+}
+
+// recordingResponseWriter is http.ResponseWriter that records response.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = statusCode
+	w.header = w.ResponseWriter.Header().Clone()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func recordIdempotency(req *http.Request, result string) {
+	stats.RecordWithTags(req.Context(), []tag.Mutator{
+		tag.Upsert(idempotencyResultKey, result),
+	}, idempotentRequests.M(1))
+}
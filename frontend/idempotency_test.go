@@ -0,0 +1,125 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package frontend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyHandler(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	h := (&Idempotency{}).Handler("store_file", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "binary/x-protocol-buffer")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "resp %d", calls)
+	}))
+
+	call := func(key, auth string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/s", strings.NewReader("req"))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		resp := rec.Result()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resp.Header.Get("Content-Type"), "binary/x-protocol-buffer"; got != want {
+			t.Errorf("Content-Type=%q; want %q", got, want)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		key        string
+		auth       string
+		status     int
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			desc:       "no key",
+			auth:       "Bearer a",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   "resp 1",
+		},
+		{
+			desc:       "new key",
+			key:        "k1",
+			auth:       "Bearer a",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   "resp 2",
+		},
+		{
+			desc:       "retry",
+			key:        "k1",
+			auth:       "Bearer a",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   "resp 2",
+		},
+		{
+			desc:       "same key by other user",
+			key:        "k1",
+			auth:       "Bearer b",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   "resp 3",
+		},
+		{
+			desc:       "error",
+			key:        "k2",
+			auth:       "Bearer a",
+			status:     http.StatusServiceUnavailable,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "resp 4",
+		},
+		{
+			desc:       "retry after error",
+			key:        "k2",
+			auth:       "Bearer a",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   "resp 5",
+		},
+	} {
+		status = tc.status
+		gotStatus, gotBody := call(tc.key, tc.auth)
+		if gotStatus != tc.wantStatus || gotBody != tc.wantBody {
+			t.Errorf("%s: call(%q, %q)=%d, %q; want %d, %q", tc.desc, tc.key, tc.auth, gotStatus, gotBody, tc.wantStatus, tc.wantBody)
+		}
+	}
+}
+
+func TestIdempotencyExpire(t *testing.T) {
+	calls := 0
+	h := (&Idempotency{TTL: time.Nanosecond}).Handler("store_file", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+	}))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/s", nil)
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		time.Sleep(time.Millisecond)
+	}
+	if calls != 2 {
+		t.Errorf("calls=%d; want 2 after expired", calls)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.chromium.org/goma/server/fswatch"
+	"go.chromium.org/goma/server/log"
+)
+
+// NoticeHeader is http response header to carry active notices
+// to clients, a header value per notice.
+const NoticeHeader = "X-Goma-Notice"
+
+// Notice is a human-readable notice for developers using goma,
+// e.g. planned maintenance or degraded RBE region.
+type Notice struct {
+	// Message is a message to show to developers.
+	Message string `json:"message"`
+
+	// Severity is severity of the notice, e.g. "info", "warning".
+	Severity string `json:"severity,omitempty"`
+
+	// URL is a link to details of the notice, if any.
+	URL string `json:"url,omitempty"`
+
+	// Start and End is a period to show the notice.
+	// The notice is active from Start (if set) until End (if set).
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+}
+
+// active reports whether the notice is active at t.
+func (n Notice) active(t time.Time) bool {
+	if !n.Start.IsZero() && t.Before(n.Start) {
+		return false
+	}
+	if !n.End.IsZero() && !t.Before(n.End) {
+		return false
+	}
+	return true
+}
+
+// String returns a single line of the notice.
+func (n Notice) String() string {
+	var sb strings.Builder
+	if n.Severity != "" {
+		fmt.Fprintf(&sb, "[%s] ", n.Severity)
+	}
+	sb.WriteString(strings.Join(strings.Fields(n.Message), " "))
+	if n.URL != "" {
+		fmt.Fprintf(&sb, " (%s)", n.URL)
+	}
+	return sb.String()
+}
+
+// Notices holds notices pushed by operators.
+// nil Notices has no notice.
+type Notices struct {
+	mu      sync.RWMutex
+	notices []Notice
+
+	// for test
+	now func() time.Time
+}
+
+// noticesFile is a format of notices config file.
+type noticesFile struct {
+	Notices []Notice `json:"notices"`
+}
+
+// Set replaces notices.
+func (n *Notices) Set(notices []Notice) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notices = append([]Notice(nil), notices...)
+}
+
+// Active returns notices active now.
+func (n *Notices) Active() []Notice {
+	if n == nil {
+		return nil
+	}
+	now := time.Now()
+	if n.now != nil {
+		now = n.now()
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	var notices []Notice
+	for _, notice := range n.notices {
+		if notice.active(now) {
+			notices = append(notices, notice)
+		}
+	}
+	return notices
+}
+
+// Load loads notices from fname, JSON object of
+//
+//	{"notices": [{"message": "...", "severity": "warning",
+//	              "url": "https://...",
+//	              "start": "2022-10-01T00:00:00Z",
+//	              "end": "2022-10-01T02:00:00Z"}]}
+func (n *Notices) Load(fname string) error {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	var f noticesFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fname, err)
+	}
+	for i, notice := range f.Notices {
+		if strings.TrimSpace(notice.Message) == "" {
+			return fmt.Errorf("%s: notices[%d]: empty message", fname, i)
+		}
+	}
+	n.Set(f.Notices)
+	return nil
+}
+
+// Watch loads notices from fname, and reloads it when
+// fname is updated until ctx is done.
+func (n *Notices) Watch(ctx context.Context, fname string) error {
+	logger := log.FromContext(ctx)
+	err := n.Load(fname)
+	if err != nil {
+		return err
+	}
+	logger.Infof("notices %s: %v", fname, n.Active())
+	watcher, err := fswatch.New(ctx, filepath.Dir(fname))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			ev, err := watcher.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Errorf("notices watch %s: %v", fname, err)
+				}
+				return
+			}
+			logger.Infof("notices update: %v", ev)
+			err = n.Load(fname)
+			if err != nil {
+				logger.Errorf("notices %s: %v", fname, err)
+				continue
+			}
+			logger.Infof("notices %s: %v", fname, n.Active())
+		}
+	}()
+	return nil
+}
+
+// ServeHTTP serves active notices in JSON.
+func (n *Notices) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	notices := n.Active()
+	if notices == nil {
+		notices = []Notice{}
+	}
+	b, err := json.Marshal(noticesFile{Notices: notices})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// noticeHandler sets active notices in NoticeHeader of responses.
+func noticeHandler(n *Notices, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, notice := range n.Active() {
+			w.Header().Add(NoticeHeader, notice.String())
+		}
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package frontend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNotices(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "notices.json")
+	err := ioutil.WriteFile(fname, []byte(`{"notices": [
+ {"message": "RBE in asia-northeast1 is degraded.", "severity": "warning"},
+ {"message": "planned maintenance\nof goma backend",
+  "url": "https://example.com/maintenance",
+  "start": "2022-10-01T00:00:00Z", "end": "2022-10-01T02:00:00Z"}
+]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, time.September, 30, 23, 0, 0, 0, time.UTC)
+	n := &Notices{
+		now: func() time.Time { return now },
+	}
+	err = n.Load(fname)
+	if err != nil {
+		t.Fatalf("Load=%v; want nil error", err)
+	}
+
+	h := noticeHandler(n, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	check := func(want []string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/e", nil))
+		if diff := cmp.Diff(want, rec.Header().Values(NoticeHeader)); diff != "" {
+			t.Errorf("%s diff -want +got:\n%s", NoticeHeader, diff)
+		}
+	}
+	check([]string{
+		"[warning] RBE in asia-northeast1 is degraded.",
+	})
+
+	now = time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
+	check([]string{
+		"[warning] RBE in asia-northeast1 is degraded.",
+		"planned maintenance of goma backend (https://example.com/maintenance)",
+	})
+
+	rec := httptest.NewRecorder()
+	n.ServeHTTP(rec, httptest.NewRequest("GET", "/notices", nil))
+	var resp struct {
+		Notices []Notice `json:"notices"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("/notices: %v", err)
+	}
+	if len(resp.Notices) != 2 || resp.Notices[1].URL != "https://example.com/maintenance" {
+		t.Errorf("/notices=%s; want 2 notices", rec.Body.String())
+	}
+
+	now = time.Date(2022, time.October, 1, 2, 0, 0, 0, time.UTC)
+	n.Set(nil)
+	check(nil)
+
+	err = ioutil.WriteFile(fname, []byte(`{"notices": [{"severity": "info"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Load(fname)
+	if err == nil {
+		t.Errorf("Load(empty message)=nil error; want error")
+	}
+}
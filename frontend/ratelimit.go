@@ -0,0 +1,169 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	"go.chromium.org/goma/server/server"
+)
+
+// maxBuckets is max number of buckets to keep in a RateLimiter.
+// When it exceeds, least recently used bucket is removed.
+const maxBuckets = 10000
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits requests by token bucket per key,
+// e.g. per client IP or per group of end user.
+type RateLimiter struct {
+	// QPS is rate of tokens added to a bucket per second.
+	// 0 or negative means no limit.
+	QPS float64
+
+	// Burst is size of a bucket. If it is less than 1, 1 is used.
+	Burst int
+
+	// Key returns bucket key of the request.
+	Key func(ctx context.Context, req *http.Request) string
+
+	// Name is used for metrics and logging, e.g. "ip" or "group".
+	Name string
+
+	// now is for testing.
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets *lru.Cache
+}
+
+// IPRateLimiter returns rate limiter per client IP.
+// trustedProxies is number of trusted proxies in front of frontend
+// that append to X-Forwarded-For header. e.g. 2 for Google Cloud
+// HTTP(S) load balancer, which appends "<client-ip>,<load-balancer-ip>".
+// If it is 0, peer address of the connection is used as client IP.
+func IPRateLimiter(qps float64, burst, trustedProxies int) *RateLimiter {
+	return &RateLimiter{
+		QPS:   qps,
+		Burst: burst,
+		Key:   clientIPKey(trustedProxies),
+		Name:  "ip",
+	}
+}
+
+// GroupRateLimiter returns rate limiter per group of authenticated
+// end user.
+func GroupRateLimiter(qps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		QPS:   qps,
+		Burst: burst,
+		Key:   endUserGroup,
+		Name:  "group",
+	}
+}
+
+// clientIPKey returns Key to get client IP of the request.
+// Unlike httprpc.RemoteAddr, it doesn't use the first entry of
+// X-Forwarded-For, which client can set to arbitrary value, but uses
+// the entry added by the outermost trusted proxy.
+func clientIPKey(trustedProxies int) func(context.Context, *http.Request) string {
+	return func(ctx context.Context, req *http.Request) string {
+		addr := req.RemoteAddr
+		if trustedProxies > 0 {
+			forwards := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+			// if request didn't come through all proxies,
+			// entries may be set by client, so use peer address.
+			i := len(forwards) - trustedProxies
+			if i >= 0 {
+				if ip := strings.TrimSpace(forwards[i]); ip != "" {
+					addr = ip
+				}
+			}
+		}
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return host
+		}
+		return addr
+	}
+}
+
+func endUserGroup(ctx context.Context, req *http.Request) string {
+	u, _ := enduser.FromContext(ctx)
+	return u.Group
+}
+
+func (l *RateLimiter) timeNow() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+func (l *RateLimiter) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// Allow takes a token from the bucket for the request.
+// If no token is available, it returns false with duration until
+// next token is available.
+func (l *RateLimiter) Allow(ctx context.Context, req *http.Request) (bool, time.Duration) {
+	if l == nil || l.QPS <= 0 {
+		return true, 0
+	}
+	key := l.Key(ctx, req)
+	ok, retryAfter := l.take(key)
+	if !ok {
+		stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(rateLimitKindKey, l.Name),
+		}, rateLimitedRequests.M(1))
+		server.LoadReject(ctx, server.LoadFrontend)
+	}
+	return ok, retryAfter
+}
+
+func (l *RateLimiter) take(key string) (bool, time.Duration) {
+	now := l.timeNow()
+	burst := l.burst()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = lru.New(maxBuckets)
+	}
+	var b *bucket
+	if v, ok := l.buckets.Get(key); ok {
+		b = v.(*bucket)
+	} else {
+		b = &bucket{
+			tokens: burst,
+			last:   now,
+		}
+		l.buckets.Add(key, b)
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.QPS)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.QPS * float64(time.Second))
+}
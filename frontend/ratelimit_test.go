@@ -0,0 +1,176 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	"go.chromium.org/goma/server/httprpc"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := IPRateLimiter(2, 2, 0)
+	l.now = func() time.Time { return now }
+
+	req := func(addr string) *http.Request {
+		req := httptest.NewRequest("POST", "/e", nil)
+		req.RemoteAddr = addr
+		return req
+	}
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow(ctx, req("192.0.2.1:1234"))
+		if !ok {
+			t.Errorf("%d: Allow(192.0.2.1)=false; want true", i)
+		}
+	}
+	ok, retryAfter := l.Allow(ctx, req("192.0.2.1:5678"))
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("Allow(192.0.2.1)=%t, %s; want false, 500ms", ok, retryAfter)
+	}
+	ok, _ = l.Allow(ctx, req("192.0.2.2:1234"))
+	if !ok {
+		t.Errorf("Allow(192.0.2.2)=false; want true")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow(ctx, req("192.0.2.1:1234"))
+	if !ok {
+		t.Errorf("Allow(192.0.2.1) after 500ms=false; want true")
+	}
+}
+
+func TestIPRateLimiterXForwardedFor(t *testing.T) {
+	ctx := context.Background()
+	l := IPRateLimiter(1, 1, 2)
+	l.now = func() time.Time { return time.Unix(0, 0) }
+
+	req := func(forwards string) *http.Request {
+		req := httptest.NewRequest("POST", "/e", nil)
+		req.RemoteAddr = "35.191.0.1:1234"
+		if forwards != "" {
+			req.Header.Set("X-Forwarded-For", forwards)
+		}
+		return req
+	}
+	// load balancer appends "<client-ip>,<load-balancer-ip>".
+	if ok, _ := l.Allow(ctx, req("192.0.2.1, 130.211.0.1")); !ok {
+		t.Errorf("Allow(192.0.2.1)=false; want true")
+	}
+	// client can't bypass the limit by rotating X-Forwarded-For.
+	for _, spoof := range []string{"198.51.100.1", "198.51.100.2", "192.0.2.2"} {
+		if ok, _ := l.Allow(ctx, req(spoof+", 192.0.2.1, 130.211.0.1")); ok {
+			t.Errorf("Allow(%s, 192.0.2.1)=true; want false", spoof)
+		}
+	}
+	// nor exhaust other client's bucket.
+	if ok, _ := l.Allow(ctx, req("192.0.2.2, 130.211.0.1")); !ok {
+		t.Errorf("Allow(192.0.2.2)=false; want true")
+	}
+	// request not through the load balancer is limited by peer
+	// address, since all entries are set by client.
+	if ok, _ := l.Allow(ctx, req("192.0.2.3")); !ok {
+		t.Errorf("Allow(192.0.2.3)=false; want true")
+	}
+	for _, spoof := range []string{"", "192.0.2.4", "192.0.2.5"} {
+		if ok, _ := l.Allow(ctx, req(spoof)); ok {
+			t.Errorf("Allow(%q)=true; want false", spoof)
+		}
+	}
+}
+
+func TestIPRateLimiterPeerAddress(t *testing.T) {
+	ctx := context.Background()
+	l := IPRateLimiter(1, 1, 0)
+	l.now = func() time.Time { return time.Unix(0, 0) }
+
+	req := func(peer, forwards string) *http.Request {
+		req := httptest.NewRequest("POST", "/e", nil)
+		req.RemoteAddr = peer
+		req.Header.Set("X-Forwarded-For", forwards)
+		return req
+	}
+	if ok, _ := l.Allow(ctx, req("192.0.2.1:1234", "198.51.100.1")); !ok {
+		t.Errorf("Allow(192.0.2.1:1234)=false; want true")
+	}
+	if ok, _ := l.Allow(ctx, req("192.0.2.1:5678", "198.51.100.2")); ok {
+		t.Errorf("Allow(192.0.2.1:5678)=true; want false")
+	}
+	if ok, _ := l.Allow(ctx, req("192.0.2.2:1234", "198.51.100.1")); !ok {
+		t.Errorf("Allow(192.0.2.2:1234)=false; want true")
+	}
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	ctx := context.Background()
+	l := IPRateLimiter(1, 1, 2)
+	l.now = func() time.Time { return time.Unix(0, 0) }
+	req := func(ip string) *http.Request {
+		req := httptest.NewRequest("POST", "/e", nil)
+		req.Header.Set("X-Forwarded-For", ip+", 130.211.0.1")
+		return req
+	}
+	for i := 0; i < maxBuckets+100; i++ {
+		l.Allow(ctx, req(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)))
+		if i == 0 {
+			// keep 10.0.0.0 recently used.
+			continue
+		}
+		l.Allow(ctx, req("10.0.0.0"))
+	}
+	if got := l.buckets.Len(); got != maxBuckets {
+		t.Errorf("buckets=%d; want %d", got, maxBuckets)
+	}
+	if ok, _ := l.Allow(ctx, req("10.0.0.0")); ok {
+		t.Errorf("Allow(10.0.0.0)=true; want false for recently used bucket")
+	}
+	if ok, _ := l.Allow(ctx, req("10.0.0.1")); !ok {
+		t.Errorf("Allow(10.0.0.1)=false; want true for evicted bucket")
+	}
+}
+
+func TestGroupRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := GroupRateLimiter(1, 1)
+	l.now = func() time.Time { return time.Unix(0, 0) }
+	req := httptest.NewRequest("POST", "/e", nil)
+
+	ctxA := enduser.NewContext(ctx, enduser.New("a@example.com", "group-a", nil))
+	ctxB := enduser.NewContext(ctx, enduser.New("b@example.com", "group-b", nil))
+	if ok, _ := l.Allow(ctxA, req); !ok {
+		t.Errorf("Allow(group-a)=false; want true")
+	}
+	if ok, _ := l.Allow(ctxA, req); ok {
+		t.Errorf("Allow(group-a)=true; want false")
+	}
+	if ok, _ := l.Allow(ctxB, req); !ok {
+		t.Errorf("Allow(group-b)=false; want true")
+	}
+}
+
+func TestRateLimitControl(t *testing.T) {
+	l := IPRateLimiter(1, 1, 0)
+	l.now = func() time.Time { return time.Unix(0, 0) }
+	h := httprpc.RateLimitControl(l, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/e", nil))
+		if rec.Code != want {
+			t.Errorf("status=%d; want %d", rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After=%q; want %q", rec.Header().Get("Retry-After"), "1")
+		}
+	}
+}
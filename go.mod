@@ -22,6 +22,7 @@ require (
 	github.com/googleapis/gax-go/v2 v2.5.1
 	github.com/googleapis/google-cloud-go-testing v0.0.0-20190904031503-2d24dde44ba5
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
+	github.com/klauspost/compress v1.12.3
 	github.com/pborman/uuid v1.2.1 // indirect
 	go.opencensus.io v0.23.0
 	go.uber.org/atomic v1.10.0 // indirect
@@ -0,0 +1,39 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package auth implements auth service for goma httprpc.
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/httprpc"
+	pb "go.chromium.org/goma/server/proto/auth"
+)
+
+type authorizationKey struct{}
+
+// EnrollHandler returns enroll service handler.
+// If EnrollReq doesn't have authorization, authorization header
+// of the request is used.
+func EnrollHandler(c pb.AuthServiceClient, opts ...httprpc.HandlerOption) http.Handler {
+	h := httprpc.Handler(
+		"AuthService.Enroll",
+		&pb.EnrollReq{}, &pb.EnrollResp{},
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			r := req.(*pb.EnrollReq)
+			if r.Authorization == "" {
+				r.Authorization, _ = ctx.Value(authorizationKey{}).(string)
+			}
+			resp, err := c.Enroll(ctx, r)
+			return resp, err
+		}, opts...)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), authorizationKey{}, req.Header.Get("Authorization"))
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
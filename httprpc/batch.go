@@ -0,0 +1,127 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package httprpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/log"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// BatchHandler returns http.Handler to serve batched API requests.
+// Request is gomapb.BatchReq, and each call in it is dispatched to
+// handler for its path in handlers, as if it were an individual
+// http request with the same headers, concurrently.
+// Response is gomapb.BatchResp, which has status and response of
+// each call in the same order.
+// Batch request with more than maxCalls calls is rejected.
+func BatchHandler(handlers map[string]http.Handler, maxCalls int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trace.StartSpan(r.Context(), "go.chromium.org/goma/server/httprpc.BatchHandler")
+		defer span.End()
+		logger := log.FromContext(ctx)
+
+		req := &gomapb.BatchReq{}
+		_, err := parseFromHTTPServerRequest(ctx, r, req)
+		if err != nil {
+			code := http.StatusBadRequest
+			http.Error(w, "bad request", code)
+			logger.Errorf("incoming parse error %s: %d %s: %v", r.URL.Path, code, http.StatusText(code), err)
+			return
+		}
+		if len(req.Call) > maxCalls {
+			code := http.StatusBadRequest
+			http.Error(w, fmt.Sprintf("too many calls: %d > %d", len(req.Call), maxCalls), code)
+			logger.Errorf("too many calls %s: %d > %d", r.URL.Path, len(req.Call), maxCalls)
+			return
+		}
+		span.AddAttributes(trace.Int64Attribute("calls", int64(len(req.Call))))
+
+		resp := &gomapb.BatchResp{
+			Result: make([]*gomapb.BatchResp_Result, len(req.Call)),
+		}
+		var wg sync.WaitGroup
+		for i, call := range req.Call {
+			wg.Add(1)
+			go func(i int, call *gomapb.BatchReq_Call) {
+				defer wg.Done()
+				resp.Result[i] = batchCall(ctx, r, handlers, call)
+			}(i, call)
+		}
+		wg.Wait()
+
+		acceptEncoding := encodingFromHeader(r.Header.Get("Accept-Encoding"))
+		_, err = serializeToResponseWriter(ctx, w, resp, acceptEncoding, 0)
+		if err != nil {
+			logger.Errorf("outgoing serialize error %s: %v", r.URL.Path, err)
+		}
+	})
+}
+
+// batchCall dispatches call in batch request r to handler for its path.
+func batchCall(ctx context.Context, r *http.Request, handlers map[string]http.Handler, call *gomapb.BatchReq_Call) *gomapb.BatchResp_Result {
+	h, ok := handlers[call.GetPath()]
+	if !ok {
+		return &gomapb.BatchResp_Result{
+			Status:   proto.Int32(http.StatusNotFound),
+			Response: []byte(fmt.Sprintf("unknown api %q", call.GetPath())),
+		}
+	}
+	req := r.Clone(ctx)
+	req.URL.Path = call.GetPath()
+	req.Body = ioutil.NopCloser(bytes.NewReader(call.GetRequest()))
+	req.ContentLength = int64(len(call.GetRequest()))
+	// call request is not compressed, and response should not be
+	// compressed either, since batch response will be compressed.
+	req.Header.Del("Content-Encoding")
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Content-Type", "binary/x-protocol-buffer")
+
+	w := &batchResponseWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+	h.ServeHTTP(w, req)
+	return &gomapb.BatchResp_Result{
+		Status:   proto.Int32(int32(w.status)),
+		Response: w.body.Bytes(),
+	}
+}
+
+// batchResponseWriter is http.ResponseWriter for a call in batch request.
+type batchResponseWriter struct {
+	header      http.Header
+	wroteHeader bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = statusCode
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(b)
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package httprpc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestBatchHandler(t *testing.T) {
+	health := Handler(
+		"Health",
+		&healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{},
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			if req.(*healthpb.HealthCheckRequest).GetService() == "unknown" {
+				return nil, status.Error(codes.NotFound, "unknown service")
+			}
+			return &healthpb.HealthCheckResponse{
+				Status: healthpb.HealthCheckResponse_SERVING,
+			}, nil
+		})
+	s := httptest.NewServer(BatchHandler(map[string]http.Handler{
+		"/health": health,
+	}, 3))
+	defer s.Close()
+
+	call := func(path, service string) *gomapb.BatchReq_Call {
+		b, err := proto.Marshal(&healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &gomapb.BatchReq_Call{
+			Path:    proto.String(path),
+			Request: b,
+		}
+	}
+	post := func(req *gomapb.BatchReq) (*http.Response, []byte) {
+		t.Helper()
+		b, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(s.URL, "binary/x-protocol-buffer", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("http.Post err: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		return resp, body
+	}
+
+	resp, body := post(&gomapb.BatchReq{
+		Call: []*gomapb.BatchReq_Call{
+			call("/health", "goma"),
+			call("/health", "unknown"),
+			call("/unknown", "goma"),
+		},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d; want %d", resp.StatusCode, http.StatusOK)
+	}
+	bresp := &gomapb.BatchResp{}
+	err := proto.Unmarshal(body, bresp)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(bresp.Result) != 3 {
+		t.Fatalf("results=%d; want 3", len(bresp.Result))
+	}
+	if got, want := bresp.Result[0].GetStatus(), int32(http.StatusOK); got != want {
+		t.Errorf("result[0].status=%d; want %d", got, want)
+	}
+	hresp := &healthpb.HealthCheckResponse{}
+	err = proto.Unmarshal(bresp.Result[0].GetResponse(), hresp)
+	if err != nil || hresp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("result[0].response=%v, %v; want SERVING", hresp, err)
+	}
+	if got, want := bresp.Result[1].GetStatus(), int32(http.StatusNotFound); got != want {
+		t.Errorf("result[1].status=%d; want %d", got, want)
+	}
+	if got, want := bresp.Result[2].GetStatus(), int32(http.StatusNotFound); got != want {
+		t.Errorf("result[2].status=%d; want %d", got, want)
+	}
+
+	resp, _ = post(&gomapb.BatchReq{
+		Call: []*gomapb.BatchReq_Call{
+			call("/health", "a"),
+			call("/health", "b"),
+			call("/health", "c"),
+			call("/health", "d"),
+		},
+	})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status for too many calls=%d; want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
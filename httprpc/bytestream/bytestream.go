@@ -9,11 +9,16 @@ import (
 	"compress/gzip"
 	"compress/zlib"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/google/uuid"
 	pb "google.golang.org/genproto/googleapis/bytestream"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -25,21 +30,75 @@ import (
 
 const bufsize = 2 * 1024 * 1024
 
+// bufferPool is a pool of *[]byte of bufsize, used to copy blob
+// content between bytestream and http, so that memory usage doesn't
+// grow with number of concurrent requests or size of blobs.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, bufsize)
+		return &b
+	},
+}
+
+// copyBuffer copies from rd to wr using a buffer from bufferPool.
+func copyBuffer(wr io.Writer, rd io.Reader) (int64, error) {
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
+	return io.CopyBuffer(wr, rd, *buf)
+}
+
 // Handler returns http.Handler to serve bytestream API.
+// URL path is used as resource name.
 func Handler(c pb.ByteStreamClient, opts ...httprpc.HandlerOption) http.Handler {
+	return handler(c, func(r *http.Request) (string, error) {
+		return byteStreamResourceName(r), nil
+	}, opts...)
+}
+
+// InstanceHandler returns http.Handler to serve bytestream API
+// for blobs in RBE instance.
+// URL path "/blobs/{hash}/{size}" is mapped to resource name
+// "{instance}/blobs/{hash}/{size}" for read, and
+// "{instance}/uploads/{uuid}/blobs/{hash}/{size}" for write.
+func InstanceHandler(c pb.ByteStreamClient, instance string, opts ...httprpc.HandlerOption) http.Handler {
+	return handler(c, func(r *http.Request) (string, error) {
+		name := byteStreamResourceName(r)
+		if !strings.HasPrefix(name, "blobs/") {
+			return "", status.Errorf(codes.InvalidArgument, "bad resource name %q", name)
+		}
+		if r.Method == http.MethodPost {
+			return path.Join(instance, "uploads", uuid.New().String(), name), nil
+		}
+		return path.Join(instance, name), nil
+	}, opts...)
+}
+
+func handler(c pb.ByteStreamClient, resourceName func(*http.Request) (string, error), opts ...httprpc.HandlerOption) http.Handler {
 	return httprpc.StreamHandler(
 		"Bytestream",
 		func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 			logger := log.FromContext(ctx)
 			switch r.Method {
 			case http.MethodGet:
-				return byteStreamGet(ctx, c, w, r)
+				resname, err := resourceName(r)
+				if err != nil {
+					return err
+				}
+				return byteStreamGet(ctx, c, w, r, resname)
 
 			case http.MethodPost:
-				return byteStreamPost(ctx, c, w, r)
+				resname, err := resourceName(r)
+				if err != nil {
+					return err
+				}
+				return byteStreamPost(ctx, c, w, r, resname)
 
 			case http.MethodHead:
-				return byteStreamHead(ctx, c, w, r)
+				resname, err := resourceName(r)
+				if err != nil {
+					return err
+				}
+				return byteStreamHead(ctx, c, w, r, resname)
 
 			}
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -52,16 +111,109 @@ func byteStreamResourceName(r *http.Request) string {
 	return strings.TrimLeft(path.Clean(r.URL.Path), "/")
 }
 
-func byteStreamGet(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWriter, r *http.Request) error {
-	resname := byteStreamResourceName(r)
+// resourceSize returns size of the blob in resname,
+// i.e. "{instance}/blobs/{hash}/{size}".
+func resourceSize(resname string) (int64, bool) {
+	pc := strings.Split(resname, "/")
+	for i := len(pc) - 3; i >= 0; i-- {
+		if pc[i] != "blobs" {
+			continue
+		}
+		size, err := strconv.ParseInt(pc[i+2], 10, 64)
+		if err != nil || size < 0 {
+			return 0, false
+		}
+		return size, true
+	}
+	return 0, false
+}
+
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// parseRange parses single byte range in Range header value for
+// content of size, and returns offset and length of the range.
+// It returns ok=false if the header is empty or not supported
+// (e.g. multiple ranges), in which case full content should be served.
+func parseRange(s string, size int64) (offset, length int64, ok bool, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(s, prefix))
+	if strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, false, nil
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if first == "" {
+		// suffix range: last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, 0, false, nil
+		}
+		if n <= 0 {
+			return 0, 0, false, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+	offset, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, false, nil
+	}
+	if offset >= size {
+		return 0, 0, false, errUnsatisfiableRange
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < offset {
+			return 0, 0, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return offset, end - offset + 1, true, nil
+}
+
+func byteStreamGet(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWriter, r *http.Request, resname string) error {
 
-	rd, err := bytestreamio.Open(ctx, c, resname)
+	var opts []bytestreamio.ReadOption
+	var contentRange string
+	var contentLength int64
+	if size, ok := resourceSize(resname); ok && r.Header.Get("Range") != "" {
+		offset, length, ok, err := parseRange(r.Header.Get("Range"), size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+		if ok {
+			opts = append(opts, bytestreamio.ReadOffset(offset), bytestreamio.ReadLimit(length))
+			contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size)
+			contentLength = length
+		}
+	}
+
+	rd, err := bytestreamio.Open(ctx, c, resname, opts...)
 	if err != nil {
 		return err
 	}
-	buf := make([]byte, bufsize)
 	var wr io.Writer = w
 	switch {
+	case contentRange != "":
+		// range is on uncompressed content, so don't compress
+		// partial content.
+		w.Header().Set("Content-Range", contentRange)
+		w.Header().Set("Content-Length", strconv.FormatInt(contentLength, 10))
+		w.WriteHeader(http.StatusPartialContent)
+
 	case strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"):
 		wr, err = gzip.NewWriterLevel(w, gzip.BestSpeed)
 		if err != nil {
@@ -80,7 +232,7 @@ func byteStreamGet(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWr
 		}
 		w.Header().Set("Content-Encoding", "deflate")
 	}
-	_, err = io.CopyBuffer(wr, rd, buf)
+	_, err = copyBuffer(wr, rd)
 	if err != nil {
 		return err
 	}
@@ -90,13 +242,11 @@ func byteStreamGet(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWr
 	return err
 }
 
-func byteStreamPost(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWriter, r *http.Request) error {
-	resname := byteStreamResourceName(r)
+func byteStreamPost(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWriter, r *http.Request, resname string) error {
 	wr, err := bytestreamio.Create(ctx, c, resname)
 	if err != nil {
 		return err
 	}
-	buf := make([]byte, bufsize)
 	var rd io.Reader = r.Body
 	switch r.Header.Get("Content-Encoding") {
 	case "gzip":
@@ -117,7 +267,7 @@ func byteStreamPost(ctx context.Context, c pb.ByteStreamClient, w http.ResponseW
 			return status.Errorf(codes.InvalidArgument, "zlib error: %v", err)
 		}
 	}
-	_, err = io.CopyBuffer(wr, rd, buf)
+	_, err = copyBuffer(wr, rd)
 	if err != nil {
 		wr.Close()
 		return err
@@ -130,8 +280,7 @@ func byteStreamPost(ctx context.Context, c pb.ByteStreamClient, w http.ResponseW
 	return nil
 }
 
-func byteStreamHead(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWriter, r *http.Request) error {
-	resname := byteStreamResourceName(r)
+func byteStreamHead(ctx context.Context, c pb.ByteStreamClient, w http.ResponseWriter, r *http.Request, resname string) error {
 
 	err := bytestreamio.Exists(ctx, c, resname)
 	if err != nil {
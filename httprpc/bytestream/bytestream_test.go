@@ -9,12 +9,15 @@ import (
 	"compress/gzip"
 	"compress/zlib"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	pb "google.golang.org/genproto/googleapis/bytestream"
 	"google.golang.org/grpc"
@@ -25,6 +28,10 @@ import (
 type fakeByteStreamClient struct {
 	pb.ByteStreamClient
 	m map[string]string
+
+	// chunksize is size of data in each read response.
+	// 16 if zero.
+	chunksize int
 }
 
 func (c fakeByteStreamClient) Read(ctx context.Context, req *pb.ReadRequest, opts ...grpc.CallOption) (pb.ByteStream_ReadClient, error) {
@@ -64,7 +71,10 @@ func (c *fakeByteStreamReadClient) Recv() (*pb.ReadResponse, error) {
 	if len(c.data) == 0 {
 		return nil, io.EOF
 	}
-	const chunksize = 16
+	chunksize := c.c.chunksize
+	if chunksize == 0 {
+		chunksize = 16
+	}
 	v := c.data
 	if len(v) > chunksize {
 		v = v[:chunksize]
@@ -155,6 +165,124 @@ func TestGet(t *testing.T) {
 	}
 }
 
+// largeBlob returns blob larger than bufsize, filled by pattern of seed.
+func largeBlob(seed int) string {
+	b := make([]byte, 2*bufsize+123)
+	for i := range b {
+		b[i] = byte(seed + i%251)
+	}
+	return string(b)
+}
+
+func TestGetLarge(t *testing.T) {
+	const resname = `blobs/hash/size`
+	data := largeBlob(0)
+	c := fakeByteStreamClient{
+		m: map[string]string{
+			resname: data,
+		},
+		chunksize: 64 * 1024,
+	}
+	handler := Handler(c)
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/" + resname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET %s=%d %s; want=%d", resname, resp.StatusCode, resp.Status, http.StatusOK)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != data {
+		t.Errorf("GET %s=%d bytes; want=%d bytes of the blob", resname, len(buf), len(data))
+	}
+}
+
+func TestGetConcurrent(t *testing.T) {
+	const n = 8
+	c := fakeByteStreamClient{
+		m:         map[string]string{},
+		chunksize: 64 * 1024,
+	}
+	for i := 0; i < n; i++ {
+		c.m[fmt.Sprintf("blobs/hash%d/size", i)] = largeBlob(i)
+	}
+	handler := Handler(c)
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resname := fmt.Sprintf("blobs/hash%d/size", i)
+			resp, err := http.Get(s.URL + "/" + resname)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+			buf, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if resp.StatusCode != http.StatusOK || string(buf) != c.m[resname] {
+				errs[i] = fmt.Errorf("GET %s=%d %d bytes; want=%d %d bytes of the blob", resname, resp.StatusCode, len(buf), http.StatusOK, len(c.m[resname]))
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// slowWriter writes to buf after delay, so that concurrent copies
+// would overwrite the data being written if they shared a buffer.
+type slowWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return w.buf.Write(p)
+}
+
+func TestCopyBufferConcurrent(t *testing.T) {
+	const n = 8
+	var wg sync.WaitGroup
+	ws := make([]*slowWriter, n)
+	for i := 0; i < n; i++ {
+		ws[i] = &slowWriter{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// hide WriterTo of strings.Reader to use buffer.
+			_, err := copyBuffer(ws[i], struct{ io.Reader }{strings.NewReader(largeBlob(i))})
+			if err != nil {
+				t.Errorf("copyBuffer(%d)=_, %v; want nil err", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, w := range ws {
+		if got, want := w.buf.String(), largeBlob(i); got != want {
+			t.Errorf("copyBuffer(%d) wrote %d bytes; want the blob of %d bytes", i, len(got), len(want))
+		}
+	}
+}
+
 func TestGetDeflate(t *testing.T) {
 	const resname = `blobs/hash/size`
 	const data = `blob data`
@@ -253,6 +381,88 @@ func TestGetGzip(t *testing.T) {
 	}
 }
 
+func TestGetRange(t *testing.T) {
+	const resname = `blobs/hash/9`
+	const data = `blob data`
+	c := fakeByteStreamClient{
+		m: map[string]string{
+			resname: data,
+		},
+	}
+	handler := Handler(c)
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	for _, tc := range []struct {
+		rangeHeader      string
+		wantCode         int
+		wantContentRange string
+		want             string
+	}{
+		{
+			rangeHeader:      "bytes=0-3",
+			wantCode:         http.StatusPartialContent,
+			wantContentRange: "bytes 0-3/9",
+			want:             "blob",
+		},
+		{
+			rangeHeader:      "bytes=5-",
+			wantCode:         http.StatusPartialContent,
+			wantContentRange: "bytes 5-8/9",
+			want:             "data",
+		},
+		{
+			rangeHeader:      "bytes=-4",
+			wantCode:         http.StatusPartialContent,
+			wantContentRange: "bytes 5-8/9",
+			want:             "data",
+		},
+		{
+			rangeHeader:      "bytes=5-100",
+			wantCode:         http.StatusPartialContent,
+			wantContentRange: "bytes 5-8/9",
+			want:             "data",
+		},
+		{
+			rangeHeader: "bytes=0-1,3-4",
+			wantCode:    http.StatusOK,
+			want:        data,
+		},
+		{
+			rangeHeader:      "bytes=20-",
+			wantCode:         http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: "bytes */9",
+		},
+	} {
+		req, err := http.NewRequest("GET", s.URL+"/"+resname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", tc.rangeHeader)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.wantCode {
+			t.Errorf("GET %s Range:%s=%d %s; want=%d", resname, tc.rangeHeader, resp.StatusCode, resp.Status, tc.wantCode)
+		}
+		if got := resp.Header.Get("Content-Range"); got != tc.wantContentRange {
+			t.Errorf("GET %s Range:%s: content-range=%q; want=%q", resname, tc.rangeHeader, got, tc.wantContentRange)
+		}
+		if tc.wantCode == http.StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if got := string(buf); got != tc.want {
+			t.Errorf("GET %s Range:%s=%q; want=%q", resname, tc.rangeHeader, got, tc.want)
+		}
+	}
+}
+
 func TestGetNotFound(t *testing.T) {
 	const resname = `blobs/hash/size`
 	c := fakeByteStreamClient{
@@ -363,6 +573,29 @@ func TestPost(t *testing.T) {
 	}
 }
 
+func TestPostLarge(t *testing.T) {
+	const resname = `blobs/hash/size`
+	data := largeBlob(0)
+	c := fakeByteStreamClient{
+		m: map[string]string{},
+	}
+	handler := Handler(c)
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	resp, err := http.Post(s.URL+"/"+resname, "application/octet-stream", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST %s=%d %s; want=%d", resname, resp.StatusCode, resp.Status, http.StatusOK)
+	}
+	if got := c.m[resname]; got != data {
+		t.Errorf("POST %s stored %d bytes; want=%d bytes of the blob", resname, len(got), len(data))
+	}
+}
+
 func TestPostDeflate(t *testing.T) {
 	const resname = `blobs/hash/size`
 	const data = `blob data`
@@ -488,6 +721,59 @@ func TestPostAlreadyExists(t *testing.T) {
 	}
 }
 
+func TestInstanceHandler(t *testing.T) {
+	const instance = "projects/p/instances/default_instance"
+	const data = `blob data`
+	c := fakeByteStreamClient{
+		m: map[string]string{
+			instance + "/blobs/hash/9": data,
+		},
+	}
+	handler := InstanceHandler(c, instance)
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/blobs/hash/9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(buf) != data {
+		t.Errorf("GET /blobs/hash/9=%d %q; want=%d %q", resp.StatusCode, buf, http.StatusOK, data)
+	}
+
+	resp, err = http.Post(s.URL+"/blobs/hash2/4", "application/octet-stream", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST /blobs/hash2/4=%d %s; want=%d", resp.StatusCode, resp.Status, http.StatusOK)
+	}
+	var uploaded []string
+	for k, v := range c.m {
+		if strings.HasPrefix(k, instance+"/uploads/") && strings.HasSuffix(k, "/blobs/hash2/4") && v == "data" {
+			uploaded = append(uploaded, k)
+		}
+	}
+	if len(uploaded) != 1 {
+		t.Errorf("POST /blobs/hash2/4: uploaded=%q; want one upload in %s/uploads/", uploaded, instance)
+	}
+
+	resp, err = http.Get(s.URL + "/operations/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /operations/foo=%d %s; want=%d", resp.StatusCode, resp.Status, http.StatusBadRequest)
+	}
+}
+
 func TestBadMethod(t *testing.T) {
 	const resname = `blobs/hash/size`
 	c := fakeByteStreamClient{
@@ -90,7 +90,7 @@ func serializeToHTTPRequest(ctx context.Context, url string, req proto.Message,
 	post = post.WithContext(ctx)
 	post.Header.Set("Content-Type", "binary/x-protocol-buffer")
 	post.ContentLength = len
-	post.Header.Set("Accept-Encoding", "gzip, deflate")
+	post.Header.Set("Accept-Encoding", "zstd, gzip, deflate")
 	post.Header.Set("Content-Encoding", contentEncoding)
 	return post, nil
 }
@@ -163,6 +163,7 @@ func parseFromHTTPResponse(ctx context.Context, response *http.Response, resp pr
 		// but goma client just used "deflate" compressed data
 		// for "Content-Encoding: deflate" wrongly.
 		r = flate.NewReader(response.Body)
+	case "zstd":
 	default:
 		return status.Errorf(codes.InvalidArgument, "unknown content-encoding: %s", response.Header.Get("Content-Encoding"))
 	}
@@ -170,6 +171,12 @@ func parseFromHTTPResponse(ctx context.Context, response *http.Response, resp pr
 	if err != nil {
 		return err
 	}
+	if response.Header.Get("Content-Encoding") == "zstd" {
+		respMsg, err = zstdDecoder.DecodeAll(respMsg, nil)
+		if err != nil {
+			return err
+		}
+	}
 	err = proto.Unmarshal(respMsg, resp)
 	if err != nil {
 		return err
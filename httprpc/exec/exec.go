@@ -9,8 +9,10 @@ package exec
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
+	"google.golang.org/grpc"
 	"google.golang.org/protobuf/proto"
 
 	"go.chromium.org/goma/server/httprpc"
@@ -18,8 +20,17 @@ import (
 	execpb "go.chromium.org/goma/server/proto/exec"
 )
 
+// DefaultCompressionThreshold is default minimum size of ExecResp to compress.
+// ExecResp may embed outputs, so compression saves egress bandwidth,
+// but small response doesn't benefit from compression.
+const DefaultCompressionThreshold = 1024
+
 // Handler returns exec service handler.
+// ExecResp is compressed if it is larger than DefaultCompressionThreshold
+// and client accepts compression, unless httprpc.CompressionThreshold
+// is given in opts.
 func Handler(s execpb.ExecServiceServer, opts ...httprpc.HandlerOption) http.Handler {
+	opts = append([]httprpc.HandlerOption{httprpc.CompressionThreshold(DefaultCompressionThreshold)}, opts...)
 	return httprpc.Handler(
 		"ExecService.Exec",
 		&pb.ExecReq{}, &pb.ExecResp{},
@@ -28,3 +39,52 @@ func Handler(s execpb.ExecServiceServer, opts ...httprpc.HandlerOption) http.Han
 			return resp, err
 		}, opts...)
 }
+
+// ExtHandler returns exec service handler for ExecExt.
+// Compression of ExecExtResp is the same as ExecResp in Handler.
+func ExtHandler(s execpb.ExecServiceServer, opts ...httprpc.HandlerOption) http.Handler {
+	opts = append([]httprpc.HandlerOption{httprpc.CompressionThreshold(DefaultCompressionThreshold)}, opts...)
+	return httprpc.Handler(
+		"ExecService.ExecExt",
+		&execpb.ExecExtReq{}, &execpb.ExecExtResp{},
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			resp, err := s.ExecExt(ctx, req.(*execpb.ExecExtReq))
+			return resp, err
+		}, opts...)
+}
+
+// StreamHandler returns exec stream service handler.
+// It streams ExecProgress of the request in chunked response.
+// See httprpc.ServerStreamHandler for wire format.
+func StreamHandler(s execpb.ExecServiceServer, opts ...httprpc.HandlerOption) http.Handler {
+	return httprpc.ServerStreamHandler(
+		"ExecService.ExecStream",
+		&execpb.ExecExtReq{},
+		func(ctx context.Context, req proto.Message, send func(proto.Message) error) error {
+			return s.ExecStream(req.(*execpb.ExecExtReq), execStream{
+				ctx:  ctx,
+				send: send,
+			})
+		}, opts...)
+}
+
+// execStream is execpb.ExecService_ExecStreamServer on httprpc.
+type execStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	send func(proto.Message) error
+}
+
+func (s execStream) Context() context.Context { return s.ctx }
+
+func (s execStream) Send(m *execpb.ExecProgress) error {
+	return s.send(m)
+}
+
+func (s execStream) SendMsg(m interface{}) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	return s.send(msg)
+}
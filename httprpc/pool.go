@@ -0,0 +1,88 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package httprpc
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is max capacity of buffer to return to bufferPool,
+// so that rare large messages don't keep large memory in the pool.
+const maxPooledBufferSize = 4 * 1024 * 1024
+
+// bufferPool is a pool of *[]byte, used for serialized messages in
+// hot path, i.e. request body and response body.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBufferSize {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// readAllInto reads data from r until EOF, appending to buf.
+func readAllInto(buf []byte, r io.Reader) ([]byte, error) {
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
+
+var (
+	flateWriterPool sync.Pool
+	gzipWriterPool  sync.Pool
+)
+
+// getFlateWriter returns flate writer to w from the pool.
+func getFlateWriter(w io.Writer) (*flate.Writer, error) {
+	if v := flateWriterPool.Get(); v != nil {
+		fw := v.(*flate.Writer)
+		fw.Reset(w)
+		return fw, nil
+	}
+	return flate.NewWriter(w, deflateCompressionLevel)
+}
+
+func putFlateWriter(fw *flate.Writer) {
+	fw.Reset(nil)
+	flateWriterPool.Put(fw)
+}
+
+// getGzipWriter returns gzip writer to w from the pool.
+func getGzipWriter(w io.Writer) (*gzip.Writer, error) {
+	if v := gzipWriterPool.Get(); v != nil {
+		gw := v.(*gzip.Writer)
+		gw.Reset(w)
+		return gw, nil
+	}
+	return gzip.NewWriterLevel(w, gzipCompressionLevel)
+}
+
+func putGzipWriter(gw *gzip.Writer) {
+	gw.Reset(nil)
+	gzipWriterPool.Put(gw)
+}
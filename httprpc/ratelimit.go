@@ -0,0 +1,64 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package httprpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// RateLimiter limits rate of requests.
+type RateLimiter interface {
+	// Allow reports whether the request is allowed.
+	// ctx has enduser info if the request is authenticated.
+	// If not allowed, it also returns duration to wait before retry.
+	Allow(ctx context.Context, req *http.Request) (bool, time.Duration)
+}
+
+// WithRateLimiter sets rate limiter to the handler.
+// It is checked once per request, after the request is authenticated.
+func WithRateLimiter(l RateLimiter) HandlerOption {
+	return func(o *option) {
+		o.rateLimiter = l
+	}
+}
+
+var errRateLimited = errors.New("rate limited")
+
+// writeRateLimited writes 429 Too Many Requests with Retry-After.
+func writeRateLimited(w http.ResponseWriter, req *http.Request, retryAfter time.Duration) {
+	secs := int64((retryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	code := http.StatusTooManyRequests
+	http.Error(w, fmt.Sprintf("rate limited %s: retry after %ds", RemoteAddr(req), secs), code)
+}
+
+// RateLimitControl adds rate limiter to h.
+// It is used for rate limiting before authentication, e.g. per client IP.
+func RateLimitControl(l RateLimiter, h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		ok, retryAfter := l.Allow(ctx, req)
+		if !ok {
+			writeRateLimited(w, req, retryAfter)
+			logger := log.FromContext(ctx)
+			logger.Warnf("rate limited %s %s: retry after %s", req.URL.Path, RemoteAddr(req), retryAfter)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
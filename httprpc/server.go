@@ -8,13 +8,15 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -29,10 +31,20 @@ import (
 var (
 	deflateCompressionLevel = flate.BestSpeed
 	gzipCompressionLevel    = gzip.BestSpeed
+
+	// zstdEncoder and zstdDecoder are shared for EncodeAll/DecodeAll,
+	// which are safe for concurrent use.
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	zstdDecoder, _ = zstd.NewReader(nil)
 )
 
 const (
 	httpHeader = `X-Cloud-Trace-Context`
+
+	// TimeoutHeader is http request header for the client's timeout
+	// of the request, in seconds (e.g. "30", "1.5") or in duration
+	// (e.g. "30s").
+	TimeoutHeader = `X-Goma-Timeout`
 )
 
 type encodingType int
@@ -41,6 +53,7 @@ const (
 	noEncoding encodingType = iota
 	encodingDeflate
 	encodingGzip
+	encodingZstd
 	unknownEncoding
 )
 
@@ -52,6 +65,8 @@ func (e encodingType) String() string {
 		return "deflate"
 	case encodingGzip:
 		return "gzip"
+	case encodingZstd:
+		return "zstd"
 	default:
 		return fmt.Sprintf("unknownEncoding[%d]", e)
 	}
@@ -59,6 +74,8 @@ func (e encodingType) String() string {
 
 func encodingFromHeader(header string) encodingType {
 	switch {
+	case strings.Contains(header, "zstd"):
+		return encodingZstd
 	case strings.Contains(header, "gzip"):
 		return encodingGzip
 	case strings.Contains(header, "deflate"):
@@ -90,66 +107,114 @@ func parseFromHTTPServerRequest(ctx context.Context, req *http.Request, msg prot
 		if err != nil {
 			return 0, status.Errorf(codes.InvalidArgument, "gzip %v", err)
 		}
+	case encodingZstd:
+		r = req.Body
 	case unknownEncoding:
 		return 0, status.Errorf(codes.InvalidArgument, "unknown encoding: %s", req.Header.Get("Content-Encoding"))
 	}
-	data, err := ioutil.ReadAll(r)
+	// proto.Unmarshal doesn't alias data, so buffers could be
+	// reused after it returns.
+	bufp := getBuffer()
+	defer putBuffer(bufp)
+	if req.ContentLength > int64(cap(*bufp)) && req.ContentLength <= maxPooledBufferSize {
+		*bufp = make([]byte, 0, req.ContentLength)
+	}
+	data, err := readAllInto((*bufp)[:0], r)
+	*bufp = data
 	if err != nil {
 		return 0, err
 	}
+	if contentEncoding == encodingZstd {
+		dbufp := getBuffer()
+		defer putBuffer(dbufp)
+		data, err = zstdDecoder.DecodeAll(data, (*dbufp)[:0])
+		if err != nil {
+			return 0, status.Errorf(codes.InvalidArgument, "zstd %v", err)
+		}
+		*dbufp = data
+	}
 	return len(data), proto.Unmarshal(data, msg)
 }
 
 // serializeToResponseWriter serialize msg to w.
+// msg smaller than compressThreshold is sent without compression.
 // it returns raw message size, so might differ to actual size if compressed.
-func serializeToResponseWriter(ctx context.Context, w http.ResponseWriter, msg proto.Message, acceptEncoding encodingType) (n int, err error) {
+func serializeToResponseWriter(ctx context.Context, w http.ResponseWriter, msg proto.Message, acceptEncoding encodingType, compressThreshold int) (n int, err error) {
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/httprpc.serializeToResponseWriter")
 	defer span.End()
 	w.Header().Set("Content-Type", "binary/x-protocol-buffer")
 	// Accept-Encoding: deflate only if client didn't say gzip,
 	// since old goma client only recognizes "Accept-Encoding: deflate".
 	// TODO: always accept gzip, deflate once new goma client released.
-	if acceptEncoding == encodingGzip {
+	switch acceptEncoding {
+	case encodingZstd:
+		w.Header().Set("Accept-Encoding", "zstd, gzip, deflate")
+	case encodingGzip:
 		w.Header().Set("Accept-Encoding", "gzip, deflate")
-	} else {
+	default:
 		w.Header().Set("Accept-Encoding", "deflate")
 	}
 
-	resp, err := proto.Marshal(msg)
+	bufp := getBuffer()
+	defer putBuffer(bufp)
+	resp, err := proto.MarshalOptions{}.MarshalAppend((*bufp)[:0], msg)
 	if err != nil {
 		return 0, err
 	}
+	*bufp = resp
+	span.AddAttributes(trace.Int64Attribute("size", int64(len(resp))))
 	var wr io.Writer
 	wr = w
 	if len(resp) > 0 {
-		switch acceptEncoding {
+		encoding := acceptEncoding
+		if len(resp) < compressThreshold {
+			encoding = noEncoding
+		}
+		span.AddAttributes(trace.StringAttribute("encoding", encoding.String()))
+		switch encoding {
 		case noEncoding, unknownEncoding:
 			wr = w
 			w.Header().Set("Content-Encoding", "identity")
 		case encodingDeflate:
-			wr, err = flate.NewWriter(w, deflateCompressionLevel)
+			var fw *flate.Writer
+			fw, err = getFlateWriter(w)
 			if err != nil {
 				return 0, err
 			}
 			defer func() {
-				ferr := wr.(*flate.Writer).Close()
+				ferr := fw.Close()
+				putFlateWriter(fw)
 				if err == nil {
 					err = ferr
 				}
 			}()
+			wr = fw
 			w.Header().Set("Content-Encoding", "deflate")
 		case encodingGzip:
-			wr, err = gzip.NewWriterLevel(w, gzipCompressionLevel)
+			var gw *gzip.Writer
+			gw, err = getGzipWriter(w)
 			if err != nil {
 				return 0, err
 			}
 			defer func() {
-				ferr := wr.(*gzip.Writer).Close()
+				ferr := gw.Close()
+				putGzipWriter(gw)
 				if err == nil {
 					err = ferr
 				}
 			}()
+			wr = gw
 			w.Header().Set("Content-Encoding", "gzip")
+		case encodingZstd:
+			w.Header().Set("Content-Encoding", "zstd")
+			zbufp := getBuffer()
+			defer putBuffer(zbufp)
+			*zbufp = zstdEncoder.EncodeAll(resp, (*zbufp)[:0])
+			_, err = w.Write(*zbufp)
+			if err != nil {
+				return 0, err
+			}
+			return len(resp), nil
 		}
 	}
 	return wr.Write(resp)
@@ -169,6 +234,38 @@ func RemoteAddr(req *http.Request) string {
 	return ip
 }
 
+// ClientTimeout returns the client's timeout of the request
+// given in TimeoutHeader, if any.
+func ClientTimeout(req *http.Request) (time.Duration, bool) {
+	v := strings.TrimSpace(req.Header.Get(TimeoutHeader))
+	if v == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		sec, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(sec * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// requestContext returns context for the request, bounded by the
+// handler's timeout and the client's timeout if the client gave
+// shorter timeout than the handler's.
+func requestContext(req *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := req.Context()
+	if d, ok := ClientTimeout(req); ok && d < timeout {
+		return rpc.WithClientDeadline(ctx, d)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 type option struct {
 	timeout   time.Duration
 	retry     rpc.Retry
@@ -176,6 +273,10 @@ type option struct {
 	cluster   string
 	namespace string
 	Auth      Auth
+
+	rateLimiter RateLimiter
+
+	compressThreshold int
 }
 
 // HandlerOption sets option for handler.
@@ -221,6 +322,15 @@ type Auth interface {
 	Auth(context.Context, *http.Request) (context.Context, error)
 }
 
+// CompressionThreshold sets minimum size of response to compress.
+// Smaller response is sent without compression, even if client
+// accepts compressed response. Default is 0 (compress all responses).
+func CompressionThreshold(size int) HandlerOption {
+	return func(o *option) {
+		o.compressThreshold = size
+	}
+}
+
 // WithAuth sets auth to the handler.
 func WithAuth(a Auth) HandlerOption {
 	return func(o *option) {
@@ -307,7 +417,7 @@ func Handler(name string, req, resp proto.Message, h func(context.Context, proto
 	}
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), opt.timeout)
+		ctx, cancel := requestContext(r, opt.timeout)
 		defer cancel()
 
 		if opt.apiKey != "" {
@@ -347,8 +457,15 @@ func Handler(name string, req, resp proto.Message, h func(context.Context, proto
 		timeouts := []time.Duration{50 * time.Second, 90 * time.Second, 3 * time.Minute, 5 * time.Minute}
 		var resp proto.Message
 		authOK := false
+		rateChecked, rateLimited := false, false
 		err = opt.retry.Do(ctx, func() error {
 			pctx := ctx
+			// longer timeout doesn't help if the attempt is bounded
+			// by caller's deadline (e.g. client's timeout).
+			escalatable := true
+			if d, ok := pctx.Deadline(); ok && time.Until(d) <= timeouts[0] {
+				escalatable = false
+			}
 			ctx, cancel := context.WithTimeout(ctx, timeouts[0])
 			defer cancel()
 			// TODO: hard fail if opt.Auth == nil?
@@ -369,6 +486,16 @@ func Handler(name string, req, resp proto.Message, h func(context.Context, proto
 				}
 				authOK = true
 			}
+			if opt.rateLimiter != nil && !rateChecked {
+				rateChecked = true
+				ok, retryAfter := opt.rateLimiter.Allow(ctx, r)
+				if !ok {
+					writeRateLimited(w, r, retryAfter)
+					logger.Warnf("rate limited %s: retry after %s", r.URL.Path, retryAfter)
+					rateLimited = true
+					return errRateLimited
+				}
+			}
 			resp, err = h(ctx, req)
 			if err != nil {
 				logger.Warnf("handler error %v; ctx.Err()=%v", err, ctx.Err())
@@ -379,7 +506,7 @@ func Handler(name string, req, resp proto.Message, h func(context.Context, proto
 					Err: err,
 				}
 			}
-			if ((err != nil && ctx.Err() == context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded) && pctx.Err() == nil {
+			if ((err != nil && ctx.Err() == context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded) && pctx.Err() == nil && escalatable {
 				// api call is timed out, but caller's context is not.
 				// it would happen
 				// a) timeout was short; api call actually needs more time.
@@ -397,6 +524,14 @@ func Handler(name string, req, resp proto.Message, h func(context.Context, proto
 			}
 			return err
 		})
+		if rateLimited {
+			// response has been written.
+			span.SetStatus(trace.Status{
+				Code:    int32(codes.ResourceExhausted),
+				Message: err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			span.SetStatus(trace.Status{
 				Code:    int32(grpc.Code(err)),
@@ -413,7 +548,7 @@ func Handler(name string, req, resp proto.Message, h func(context.Context, proto
 			return
 		}
 
-		_, err = serializeToResponseWriter(ctx, w, resp, acceptEncoding)
+		_, err = serializeToResponseWriter(ctx, w, resp, acceptEncoding, opt.compressThreshold)
 
 		if err != nil {
 			logger.Errorf("outgoing serialize error %s: %v", r.URL.Path, err)
@@ -434,7 +569,7 @@ func StreamHandler(name string, h func(ctx context.Context, w http.ResponseWrite
 	}
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), opt.timeout)
+		ctx, cancel := requestContext(r, opt.timeout)
 		defer cancel()
 
 		ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/httprpc.StreamHandler:"+name)
@@ -455,3 +590,111 @@ func StreamHandler(name string, h func(ctx context.Context, w http.ResponseWrite
 	})
 	return handler
 }
+
+// ServerStreamContentType is content type of response of
+// ServerStreamHandler.
+const ServerStreamContentType = "binary/x-protocol-buffer-stream"
+
+// ServerStreamHandler returns http.Handler to serve server streaming rpc.
+// Request is parsed as req, and h is called with send func to send
+// response messages.
+// Response messages are sent in chunked response, each of which is
+// serialized message prefixed by 4 bytes big endian length, and
+// flushed to client immediately.
+// If h fails before sending any message, error status is returned.
+// Otherwise, error is logged and the response is terminated, so client
+// will see incomplete stream.
+func ServerStreamHandler(name string, req proto.Message, h func(ctx context.Context, req proto.Message, send func(proto.Message) error) error, opts ...HandlerOption) http.Handler {
+	opt := &option{
+		timeout: 1 * time.Minute,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := requestContext(r, opt.timeout)
+		defer cancel()
+
+		if opt.apiKey != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", opt.apiKey)
+		}
+
+		ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/httprpc.ServerStreamHandler:"+name)
+		defer span.End()
+		span.AddAttributes(
+			trace.StringAttribute("clueter", opt.cluster),
+			trace.StringAttribute("namespace", opt.namespace),
+		)
+		logger := log.FromContext(ctx)
+
+		req := proto.Clone(req)
+		_, err := parseFromHTTPServerRequest(ctx, r, req)
+		if err != nil {
+			code := http.StatusBadRequest
+			http.Error(w, "bad request", code)
+			logger.Errorf("incoming parse error %s: %d %s: %v", r.URL.Path, code, http.StatusText(code), err)
+			return
+		}
+		if opt.Auth != nil {
+			ctx, err = opt.Auth.Auth(ctx, r)
+			if err != nil {
+				code := http.StatusUnauthorized
+				http.Error(w, fmt.Sprintf("auth failed %s: %v", RemoteAddr(r), err), code)
+				logger.Errorf("auth error %s: %d %s: %v", r.URL.Path, code, http.StatusText(code), err)
+				return
+			}
+		}
+		if opt.rateLimiter != nil {
+			ok, retryAfter := opt.rateLimiter.Allow(ctx, r)
+			if !ok {
+				writeRateLimited(w, r, retryAfter)
+				logger.Warnf("rate limited %s: retry after %s", r.URL.Path, retryAfter)
+				return
+			}
+		}
+
+		flusher, _ := w.(http.Flusher)
+		sent := 0
+		err = h(ctx, req, func(msg proto.Message) error {
+			b, err := proto.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			if sent == 0 {
+				w.Header().Set("Content-Type", ServerStreamContentType)
+				w.WriteHeader(http.StatusOK)
+			}
+			var hdr [4]byte
+			binary.BigEndian.PutUint32(hdr[:], uint32(len(b)))
+			_, err = w.Write(hdr[:])
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			if err != nil {
+				return err
+			}
+			sent++
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			span.SetStatus(trace.Status{
+				Code:    int32(status.Code(err)),
+				Message: err.Error(),
+			})
+			if sent > 0 {
+				logger.Errorf("server error %s after %d messages: %v", r.URL.Path, sent, err)
+				return
+			}
+			code, msg := httpStatus(err)
+			http.Error(w, msg, code)
+			logger.Errorf("server error %s: %d %s: %v", r.URL.Path, code, msg, err)
+			return
+		}
+	})
+	return handler
+}
@@ -5,18 +5,27 @@
 package httprpc
 
 import (
+	"bytes"
 	"compress/flate"
 	"compress/gzip"
 	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/protobuf/proto"
 
+	gomapb "go.chromium.org/goma/server/proto/api"
 	pb "go.chromium.org/goma/server/proto/auth"
+	cachepb "go.chromium.org/goma/server/proto/cache"
 )
 
 func TestSeralizeToResponseWriterDeflate(t *testing.T) {
@@ -24,7 +33,7 @@ func TestSeralizeToResponseWriterDeflate(t *testing.T) {
 		Email: "goma-dev@google.com",
 	}
 	rw := httptest.NewRecorder()
-	_, err := serializeToResponseWriter(context.Background(), rw, want, encodingDeflate)
+	_, err := serializeToResponseWriter(context.Background(), rw, want, encodingDeflate, 0)
 	if err != nil {
 		t.Errorf("serializeToResponseWriter()=_, %v; want=_, nil", err)
 	}
@@ -47,7 +56,7 @@ func TestSeralizeToResponseWriterGzip(t *testing.T) {
 		Email: "goma-dev@google.com",
 	}
 	rw := httptest.NewRecorder()
-	_, err := serializeToResponseWriter(context.Background(), rw, want, encodingGzip)
+	_, err := serializeToResponseWriter(context.Background(), rw, want, encodingGzip, 0)
 	if err != nil {
 		t.Errorf("serializeToResponseWriter()=_, %v; want=_, nil", err)
 	}
@@ -69,6 +78,65 @@ func TestSeralizeToResponseWriterGzip(t *testing.T) {
 	}
 }
 
+func TestSeralizeToResponseWriterZstd(t *testing.T) {
+	want := &pb.AuthResp{
+		Email: "goma-dev@google.com",
+	}
+	rw := httptest.NewRecorder()
+	_, err := serializeToResponseWriter(context.Background(), rw, want, encodingZstd, 0)
+	if err != nil {
+		t.Errorf("serializeToResponseWriter()=_, %v; want=_, nil", err)
+	}
+	if got, want := rw.Result().Header.Get("Content-Encoding"), "zstd"; got != want {
+		t.Errorf("Content-Encoding=%q; want %q", got, want)
+	}
+	b, err := ioutil.ReadAll(rw.Result().Body)
+	if err != nil {
+		t.Errorf("serialize response read: %v", err)
+	}
+	gotBytes, err := zstdDecoder.DecodeAll(b, nil)
+	if err != nil {
+		t.Errorf("zstd %v", err)
+	}
+	got := &pb.AuthResp{}
+	err = proto.Unmarshal(gotBytes, got)
+	if err != nil {
+		t.Errorf("unmarshal: %v", err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
+func TestSeralizeToResponseWriterThreshold(t *testing.T) {
+	want := &pb.AuthResp{
+		Email: "goma-dev@google.com",
+	}
+	rw := httptest.NewRecorder()
+	_, err := serializeToResponseWriter(context.Background(), rw, want, encodingGzip, 1024)
+	if err != nil {
+		t.Errorf("serializeToResponseWriter()=_, %v; want=_, nil", err)
+	}
+	if got, want := rw.Result().Header.Get("Content-Encoding"), "identity"; got != want {
+		t.Errorf("Content-Encoding=%q; want %q", got, want)
+	}
+	if got, want := rw.Result().Header.Get("Accept-Encoding"), "gzip, deflate"; got != want {
+		t.Errorf("Accept-Encoding=%q; want %q", got, want)
+	}
+	gotBytes, err := ioutil.ReadAll(rw.Result().Body)
+	if err != nil {
+		t.Errorf("serialize response read: %v", err)
+	}
+	got := &pb.AuthResp{}
+	err = proto.Unmarshal(gotBytes, got)
+	if err != nil {
+		t.Errorf("unmarshal: %v", err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
 func TestHandler(t *testing.T) {
 	var opts []HandlerOption
 
@@ -87,3 +155,264 @@ func TestHandler(t *testing.T) {
 		t.Errorf("http.Get err: %v", err)
 	}
 }
+
+func TestClientTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{header: ""},
+		{header: "30", want: 30 * time.Second, ok: true},
+		{header: "1.5", want: 1500 * time.Millisecond, ok: true},
+		{header: "2m", want: 2 * time.Minute, ok: true},
+		{header: "0"},
+		{header: "-1s"},
+		{header: "bad"},
+	} {
+		req := httptest.NewRequest("POST", "/exec", nil)
+		if tc.header != "" {
+			req.Header.Set(TimeoutHeader, tc.header)
+		}
+		got, ok := ClientTimeout(req)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("ClientTimeout(%q)=%s, %t; want %s, %t", tc.header, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestServerStreamHandler(t *testing.T) {
+	statuses := []healthpb.HealthCheckResponse_ServingStatus{
+		healthpb.HealthCheckResponse_NOT_SERVING,
+		healthpb.HealthCheckResponse_SERVING,
+	}
+	handler := ServerStreamHandler(
+		"Health",
+		&healthpb.HealthCheckRequest{},
+		func(ctx context.Context, req proto.Message, send func(proto.Message) error) error {
+			if got, want := req.(*healthpb.HealthCheckRequest).GetService(), "test"; got != want {
+				t.Errorf("req.Service=%q; want %q", got, want)
+			}
+			for _, st := range statuses {
+				err := send(&healthpb.HealthCheckResponse{Status: st})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	b, err := proto.Marshal(&healthpb.HealthCheckRequest{Service: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(s.URL, "binary/x-protocol-buffer", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("http.Post err: %v", err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.Header.Get("Content-Type"), ServerStreamContentType; got != want {
+		t.Errorf("Content-Type=%q; want %q", got, want)
+	}
+	for _, want := range statuses {
+		var hdr [4]byte
+		_, err := io.ReadFull(resp.Body, hdr[:])
+		if err != nil {
+			t.Fatalf("read header: %v", err)
+		}
+		buf := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		_, err = io.ReadFull(resp.Body, buf)
+		if err != nil {
+			t.Fatalf("read message: %v", err)
+		}
+		got := &healthpb.HealthCheckResponse{}
+		err = proto.Unmarshal(buf, got)
+		if err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if got.GetStatus() != want {
+			t.Errorf("status=%v; want %v", got.GetStatus(), want)
+		}
+	}
+	rest, err := ioutil.ReadAll(resp.Body)
+	if err != nil || len(rest) > 0 {
+		t.Errorf("rest=%q, %v; want empty, nil", rest, err)
+	}
+}
+
+func TestReadAllInto(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1024)
+	for _, size := range []int{0, 1, 100, len(data)} {
+		buf := make([]byte, 0, size)
+		got, err := readAllInto(buf, iotest.OneByteReader(bytes.NewReader(data)))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("readAllInto(cap=%d)=%d bytes, %v; want %d bytes, nil", size, len(got), err, len(data))
+		}
+	}
+}
+
+func BenchmarkSerializeToResponseWriter(b *testing.B) {
+	msg := &pb.AuthResp{
+		Email: strings.Repeat("goma-dev@google.com", 1024),
+	}
+	for _, encoding := range []encodingType{noEncoding, encodingDeflate, encodingGzip, encodingZstd} {
+		b.Run(encoding.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rw := httptest.NewRecorder()
+				_, err := serializeToResponseWriter(context.Background(), rw, msg, encoding, 0)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// hotMessages returns messages that dominate frontend traffic,
+// in typical sizes.
+func hotMessages() []struct {
+	name   string
+	msg    proto.Message
+	newMsg func() proto.Message
+} {
+	execReq := &gomapb.ExecReq{
+		CommandSpec: &gomapb.CommandSpec{
+			Name:    proto.String("clang"),
+			Version: proto.String("4.2.1[clang version 16.0.0]"),
+			Target:  proto.String("x86_64-unknown-linux-gnu"),
+		},
+		Cwd: proto.String("/b/s/w/ir/cache/builder/src/out/Release"),
+	}
+	for i := 0; i < 50; i++ {
+		execReq.Arg = append(execReq.Arg, fmt.Sprintf("-I../../third_party/include%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		execReq.Input = append(execReq.Input, &gomapb.ExecReq_Input{
+			Filename: proto.String(fmt.Sprintf("../../third_party/include%d/header%d.h", i%50, i)),
+			HashKey:  proto.String(fmt.Sprintf("%064x", i)),
+		})
+	}
+	execResp := &gomapb.ExecResp{
+		Result: &gomapb.ExecResult{
+			ExitStatus: proto.Int32(0),
+		},
+	}
+	for i := 0; i < 2; i++ {
+		execResp.Result.Output = append(execResp.Result.Output, &gomapb.ExecResult_Output{
+			Filename: proto.String(fmt.Sprintf("obj/foo%d.o", i)),
+			Blob: &gomapb.FileBlob{
+				BlobType: gomapb.FileBlob_FILE.Enum(),
+				Content:  bytes.Repeat([]byte{byte(i)}, 512*1024),
+				FileSize: proto.Int64(512 * 1024),
+			},
+		})
+	}
+	storeFileReq := &gomapb.StoreFileReq{
+		Blob: []*gomapb.FileBlob{
+			{
+				BlobType: gomapb.FileBlob_FILE_CHUNK.Enum(),
+				Content:  bytes.Repeat([]byte("x"), 2*1024*1024),
+				Offset:   proto.Int64(0),
+				FileSize: proto.Int64(4 * 1024 * 1024),
+			},
+		},
+	}
+	kv := &cachepb.KV{
+		Key:   fmt.Sprintf("%064x", 1),
+		Value: bytes.Repeat([]byte("v"), 256*1024),
+	}
+	return []struct {
+		name   string
+		msg    proto.Message
+		newMsg func() proto.Message
+	}{
+		{name: "ExecReq", msg: execReq, newMsg: func() proto.Message { return &gomapb.ExecReq{} }},
+		{name: "ExecResp", msg: execResp, newMsg: func() proto.Message { return &gomapb.ExecResp{} }},
+		{name: "StoreFileReq", msg: storeFileReq, newMsg: func() proto.Message { return &gomapb.StoreFileReq{} }},
+		{name: "KV", msg: kv, newMsg: func() proto.Message { return &cachepb.KV{} }},
+	}
+}
+
+// discardResponseWriter is http.ResponseWriter that discards body.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
+
+// Benchmarks of parse and serialize of hot messages, with and without
+// pooled buffers, to compare buffer allocations with proto
+// marshal/unmarshal cost of the messages.
+func BenchmarkParseFromHTTPServerRequest(b *testing.B) {
+	ctx := context.Background()
+	for _, tc := range hotMessages() {
+		data, err := proto.Marshal(tc.msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		req := &http.Request{
+			Header:        make(http.Header),
+			ContentLength: int64(len(data)),
+		}
+		b.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req.Body = ioutil.NopCloser(bytes.NewReader(data))
+				_, err := parseFromHTTPServerRequest(ctx, req, tc.newMsg())
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(tc.name+"/nopool", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf, err := ioutil.ReadAll(bytes.NewReader(data))
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = proto.Unmarshal(buf, tc.newMsg())
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSerializeHotMessages(b *testing.B) {
+	ctx := context.Background()
+	w := discardResponseWriter{header: make(http.Header)}
+	for _, tc := range hotMessages() {
+		size := proto.Size(tc.msg)
+		b.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := serializeToResponseWriter(ctx, w, tc.msg, noEncoding, 0)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(tc.name+"/nopool", func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := proto.Marshal(tc.msg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				w.Write(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// IdentityConfig is a config to pseudonymize user identities.
+type IdentityConfig struct {
+	// Mode is one of
+	//  "" or "exact": keep identities as is.
+	//  "hmac": replace identities with keyed HMAC-SHA256 of them.
+	Mode string `json:"mode,omitempty"`
+
+	// KeyFile is a file of HMAC key for "hmac" mode.
+	// The same key gives the same pseudonym for the same identity,
+	// so identities can be joined across metrics and execlogs,
+	// but not reversed without the key.
+	KeyFile string `json:"key_file,omitempty"`
+
+	// KeepDomain keeps domain part of email, e.g.
+	// "alice@example.com" to "id-0123456789abcdef@example.com",
+	// to aggregate by company in multi-company deployments.
+	KeepDomain bool `json:"keep_domain,omitempty"`
+}
+
+// identityPrefix is a prefix of pseudonymized identity.
+const identityPrefix = "id-"
+
+type identity struct {
+	key        []byte
+	keepDomain bool
+}
+
+func newIdentity(config IdentityConfig) (identity, error) {
+	switch config.Mode {
+	case "", "exact":
+		return identity{}, nil
+	case "hmac":
+	default:
+		return identity{}, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+	if config.KeyFile == "" {
+		return identity{}, errors.New("no key_file for hmac mode")
+	}
+	key, err := ioutil.ReadFile(config.KeyFile)
+	if err != nil {
+		return identity{}, err
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return identity{}, fmt.Errorf("empty key in %s", config.KeyFile)
+	}
+	return identity{
+		key:        key,
+		keepDomain: config.KeepDomain,
+	}, nil
+}
+
+func (i identity) pseudonym(id string) string {
+	if len(i.key) == 0 || id == "" {
+		return id
+	}
+	var domain string
+	if i.keepDomain {
+		if j := strings.LastIndexByte(id, '@'); j >= 0 {
+			domain = id[j:]
+		}
+	}
+	h := hmac.New(sha256.New, i.key)
+	h.Write([]byte(id))
+	// 64 bits is enough to distinguish users in a deployment.
+	return identityPrefix + hex.EncodeToString(h.Sum(nil)[:8]) + domain
+}
+
+// Identity returns user identity id (e.g. email or username)
+// pseudonymized as configured.
+// Use it for identities in metrics, traces and execlogs, but not in
+// audit logs that need exact identities.
+// nil Redactor returns id as is.
+func (r *Redactor) Identity(id string) string {
+	if r == nil {
+		return id
+	}
+	return r.identity.pseudonym(id)
+}
@@ -0,0 +1,12 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+/*
+Package metrics provides common opencensus tags used in goma server.
+
+Views in goma server packages should include CommonTagKeys, so that
+dashboards could join metrics of different modules on the same dimensions.
+The tags are set in frontend, and propagated to backend servers via gRPC.
+*/
+package metrics
@@ -0,0 +1,88 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+)
+
+var (
+	// GroupKey is a tag key for authenticated group of the request.
+	GroupKey = tag.MustNewKey("group")
+
+	// APIKey is a tag key for goma API of the request,
+	// e.g. "exec", "lookup_file", "store_file".
+	APIKey = tag.MustNewKey("api")
+
+	// BackendKey is a tag key for backend selected for the request.
+	BackendKey = tag.MustNewKey("backend")
+
+	// ClientVersionKey is a tag key for goma client version.
+	// the value of this tag can be controlled by the client,
+	// so you need to watch out for potentially generating high-cardinality
+	// labels in your metrics backend.
+	ClientVersionKey = tag.MustNewKey("client_version")
+
+	// CommonTagKeys are tag keys that should be used in all views.
+	CommonTagKeys = []tag.Key{
+		GroupKey,
+		APIKey,
+		BackendKey,
+		ClientVersionKey,
+	}
+)
+
+// TagKeys returns CommonTagKeys followed by keys.
+// Keys that are already in the list are skipped, since opencensus
+// doesn't check duplicate tag keys in a view, and such view would
+// be rejected by some exporters.
+func TagKeys(keys ...tag.Key) []tag.Key {
+	r := make([]tag.Key, 0, len(CommonTagKeys)+len(keys))
+	seen := make(map[string]bool)
+	for _, ks := range [][]tag.Key{CommonTagKeys, keys} {
+		for _, k := range ks {
+			if seen[k.Name()] {
+				continue
+			}
+			seen[k.Name()] = true
+			r = append(r, k)
+		}
+	}
+	return r
+}
+
+func upsert(ctx context.Context, key tag.Key, value string) context.Context {
+	tctx, err := tag.New(ctx, tag.Upsert(key, value))
+	if err != nil {
+		logger := log.FromContext(ctx)
+		logger.Errorf("tag %s=%q: %v", key.Name(), value, err)
+		return ctx
+	}
+	return tctx
+}
+
+// WithGroup returns new context with group tag.
+func WithGroup(ctx context.Context, group string) context.Context {
+	return upsert(ctx, GroupKey, group)
+}
+
+// WithAPI returns new context with api tag.
+func WithAPI(ctx context.Context, api string) context.Context {
+	return upsert(ctx, APIKey, api)
+}
+
+// WithBackend returns new context with backend tag.
+func WithBackend(ctx context.Context, backend string) context.Context {
+	return upsert(ctx, BackendKey, backend)
+}
+
+// WithClientVersion returns new context with client_version tag.
+func WithClientVersion(ctx context.Context, version string) context.Context {
+	return upsert(ctx, ClientVersionKey, version)
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/tag"
+)
+
+func TestTagKeys(t *testing.T) {
+	opKey := tag.MustNewKey("op")
+	keyCmp := cmp.Comparer(func(x, y tag.Key) bool { return x.Name() == y.Name() })
+	got := TagKeys(opKey)
+	want := []tag.Key{GroupKey, APIKey, BackendKey, ClientVersionKey, opKey}
+	if diff := cmp.Diff(want, got, keyCmp); diff != "" {
+		t.Errorf("TagKeys(op) diff -want +got:\n%s", diff)
+	}
+
+	got = TagKeys(GroupKey, ClientVersionKey, tag.MustNewKey("api"), opKey, opKey)
+	want = []tag.Key{GroupKey, APIKey, BackendKey, ClientVersionKey, opKey}
+	if diff := cmp.Diff(want, got, keyCmp); diff != "" {
+		t.Errorf("TagKeys(group, client_version, api, op, op) diff -want +got:\n%s", diff)
+	}
+}
+
+func TestWithTags(t *testing.T) {
+	ctx := context.Background()
+	ctx = WithGroup(ctx, "chrome-bot")
+	ctx = WithAPI(ctx, "exec")
+	ctx = WithBackend(ctx, "default")
+	ctx = WithClientVersion(ctx, "0123abcd")
+
+	m := tag.FromContext(ctx)
+	for _, tc := range []struct {
+		key  tag.Key
+		want string
+	}{
+		{GroupKey, "chrome-bot"},
+		{APIKey, "exec"},
+		{BackendKey, "default"},
+		{ClientVersionKey, "0123abcd"},
+	} {
+		got, ok := m.Value(tc.key)
+		if !ok || got != tc.want {
+			t.Errorf("tag %s=%q, %t; want %q", tc.key.Name(), got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//
+// proto definitions for batched goma API requests.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.21.5
+// source: api/goma_batch.proto
+
+package api
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// BatchReq carries several small API requests in one HTTP request.
+type BatchReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Call []*BatchReq_Call `protobuf:"bytes,1,rep,name=call" json:"call,omitempty"`
+}
+
+func (x *BatchReq) Reset() {
+	*x = BatchReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_goma_batch_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchReq) ProtoMessage() {}
+
+func (x *BatchReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_goma_batch_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchReq.ProtoReflect.Descriptor instead.
+func (*BatchReq) Descriptor() ([]byte, []int) {
+	return file_api_goma_batch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *BatchReq) GetCall() []*BatchReq_Call {
+	if x != nil {
+		return x.Call
+	}
+	return nil
+}
+
+type BatchResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// results in the same order as BatchReq.call.
+	Result []*BatchResp_Result `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (x *BatchResp) Reset() {
+	*x = BatchResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_goma_batch_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResp) ProtoMessage() {}
+
+func (x *BatchResp) ProtoReflect() protoreflect.Message {
+	mi := &file_api_goma_batch_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResp.ProtoReflect.Descriptor instead.
+func (*BatchResp) Descriptor() ([]byte, []int) {
+	return file_api_goma_batch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BatchResp) GetResult() []*BatchResp_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+type BatchReq_Call struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// path of API, e.g. "/l" for LookupFile or "/sl" for SaveLog.
+	Path *string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// serialized request message of the API.
+	Request []byte `protobuf:"bytes,2,opt,name=request" json:"request,omitempty"`
+}
+
+func (x *BatchReq_Call) Reset() {
+	*x = BatchReq_Call{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_goma_batch_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchReq_Call) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchReq_Call) ProtoMessage() {}
+
+func (x *BatchReq_Call) ProtoReflect() protoreflect.Message {
+	mi := &file_api_goma_batch_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchReq_Call.ProtoReflect.Descriptor instead.
+func (*BatchReq_Call) Descriptor() ([]byte, []int) {
+	return file_api_goma_batch_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *BatchReq_Call) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *BatchReq_Call) GetRequest() []byte {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type BatchResp_Result struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// HTTP status code of the call.
+	Status *int32 `protobuf:"varint,1,opt,name=status" json:"status,omitempty"`
+	// serialized response message of the API if status is 200,
+	// error message otherwise.
+	Response []byte `protobuf:"bytes,2,opt,name=response" json:"response,omitempty"`
+}
+
+func (x *BatchResp_Result) Reset() {
+	*x = BatchResp_Result{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_goma_batch_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchResp_Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResp_Result) ProtoMessage() {}
+
+func (x *BatchResp_Result) ProtoReflect() protoreflect.Message {
+	mi := &file_api_goma_batch_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResp_Result.ProtoReflect.Descriptor instead.
+func (*BatchResp_Result) Descriptor() ([]byte, []int) {
+	return file_api_goma_batch_proto_rawDescGZIP(), []int{1, 0}
+}
+
+func (x *BatchResp_Result) GetStatus() int32 {
+	if x != nil && x.Status != nil {
+		return *x.Status
+	}
+	return 0
+}
+
+func (x *BatchResp_Result) GetResponse() []byte {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+var File_api_goma_batch_proto protoreflect.FileDescriptor
+
+var file_api_goma_batch_proto_rawDesc = []byte{
+	0x0a, 0x14, 0x61, 0x70, 0x69, 0x2f, 0x67, 0x6f, 0x6d, 0x61, 0x5f, 0x62, 0x61, 0x74, 0x63, 0x68,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0d, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73,
+	0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x22, 0x72, 0x0a, 0x08, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65,
+	0x71, 0x12, 0x30, 0x0a, 0x04, 0x63, 0x61, 0x6c, 0x6c, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x1c, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x2e, 0x43, 0x61, 0x6c, 0x6c, 0x52, 0x04, 0x63,
+	0x61, 0x6c, 0x6c, 0x1a, 0x34, 0x0a, 0x04, 0x43, 0x61, 0x6c, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x70,
+	0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12,
+	0x18, 0x0a, 0x07, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x07, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x82, 0x01, 0x0a, 0x09, 0x42, 0x61,
+	0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x12, 0x37, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c,
+	0x74, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f,
+	0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73,
+	0x70, 0x2e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x1a, 0x3c, 0x0a, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x27,
+	0x5a, 0x25, 0x67, 0x6f, 0x2e, 0x63, 0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72,
+	0x67, 0x2f, 0x67, 0x6f, 0x6d, 0x61, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x32,
+}
+
+var (
+	file_api_goma_batch_proto_rawDescOnce sync.Once
+	file_api_goma_batch_proto_rawDescData = file_api_goma_batch_proto_rawDesc
+)
+
+func file_api_goma_batch_proto_rawDescGZIP() []byte {
+	file_api_goma_batch_proto_rawDescOnce.Do(func() {
+		file_api_goma_batch_proto_rawDescData = protoimpl.X.CompressGZIP(file_api_goma_batch_proto_rawDescData)
+	})
+	return file_api_goma_batch_proto_rawDescData
+}
+
+var file_api_goma_batch_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_api_goma_batch_proto_goTypes = []interface{}{
+	(*BatchReq)(nil),         // 0: devtools_goma.BatchReq
+	(*BatchResp)(nil),        // 1: devtools_goma.BatchResp
+	(*BatchReq_Call)(nil),    // 2: devtools_goma.BatchReq.Call
+	(*BatchResp_Result)(nil), // 3: devtools_goma.BatchResp.Result
+}
+var file_api_goma_batch_proto_depIdxs = []int32{
+	2, // 0: devtools_goma.BatchReq.call:type_name -> devtools_goma.BatchReq.Call
+	3, // 1: devtools_goma.BatchResp.result:type_name -> devtools_goma.BatchResp.Result
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_api_goma_batch_proto_init() }
+func file_api_goma_batch_proto_init() {
+	if File_api_goma_batch_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_api_goma_batch_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_goma_batch_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_goma_batch_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchReq_Call); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_goma_batch_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchResp_Result); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_api_goma_batch_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_api_goma_batch_proto_goTypes,
+		DependencyIndexes: file_api_goma_batch_proto_depIdxs,
+		MessageInfos:      file_api_goma_batch_proto_msgTypes,
+	}.Build()
+	File_api_goma_batch_proto = out.File
+	file_api_goma_batch_proto_rawDesc = nil
+	file_api_goma_batch_proto_goTypes = nil
+	file_api_goma_batch_proto_depIdxs = nil
+}
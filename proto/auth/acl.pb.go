@@ -47,6 +47,12 @@ type Group struct {
 	ServiceAccount string `protobuf:"bytes,6,opt,name=service_account,json=serviceAccount,proto3" json:"service_account,omitempty"`
 	// If reject is true, deny access from this group.
 	Reject bool `protobuf:"varint,7,opt,name=reject,proto3" json:"reject,omitempty"`
+	// max number of concurrent exec requests from this group in
+	// an exec server. 0 means no limit.
+	MaxConcurrentExecs int32 `protobuf:"varint,8,opt,name=max_concurrent_execs,json=maxConcurrentExecs,proto3" json:"max_concurrent_execs,omitempty"`
+	// weight of this group to share concurrency of an exec server
+	// with other groups in weighted fair queue. 0 means 1.
+	ExecWeight int32 `protobuf:"varint,9,opt,name=exec_weight,json=execWeight,proto3" json:"exec_weight,omitempty"`
 }
 
 func (x *Group) Reset() {
@@ -130,6 +136,20 @@ func (x *Group) GetReject() bool {
 	return false
 }
 
+func (x *Group) GetMaxConcurrentExecs() int32 {
+	if x != nil {
+		return x.MaxConcurrentExecs
+	}
+	return 0
+}
+
+func (x *Group) GetExecWeight() int32 {
+	if x != nil {
+		return x.ExecWeight
+	}
+	return 0
+}
+
 type ACL struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -182,7 +202,7 @@ var File_auth_acl_proto protoreflect.FileDescriptor
 
 var file_auth_acl_proto_rawDesc = []byte{
 	0x0a, 0x0e, 0x61, 0x75, 0x74, 0x68, 0x2f, 0x61, 0x63, 0x6c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x12, 0x04, 0x61, 0x75, 0x74, 0x68, 0x22, 0xc8, 0x01, 0x0a, 0x05, 0x47, 0x72, 0x6f, 0x75, 0x70,
+	0x12, 0x04, 0x61, 0x75, 0x74, 0x68, 0x22, 0x9b, 0x02, 0x0a, 0x05, 0x47, 0x72, 0x6f, 0x75, 0x70,
 	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64,
 	0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18,
 	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69,
@@ -195,12 +215,18 @@ var file_auth_acl_proto_rawDesc = []byte{
 	0x75, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x73, 0x65, 0x72, 0x76, 0x69,
 	0x63, 0x65, 0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x6a,
 	0x65, 0x63, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x72, 0x65, 0x6a, 0x65, 0x63,
-	0x74, 0x22, 0x2a, 0x0a, 0x03, 0x41, 0x43, 0x4c, 0x12, 0x23, 0x0a, 0x06, 0x67, 0x72, 0x6f, 0x75,
-	0x70, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x61, 0x75, 0x74, 0x68, 0x2e,
-	0x47, 0x72, 0x6f, 0x75, 0x70, 0x52, 0x06, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x42, 0x28, 0x5a,
-	0x26, 0x67, 0x6f, 0x2e, 0x63, 0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72, 0x67,
-	0x2f, 0x67, 0x6f, 0x6d, 0x61, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x2f, 0x61, 0x75, 0x74, 0x68, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x74, 0x12, 0x30, 0x0a, 0x14, 0x6d, 0x61, 0x78, 0x5f, 0x63, 0x6f, 0x6e, 0x63, 0x75, 0x72, 0x72,
+	0x65, 0x6e, 0x74, 0x5f, 0x65, 0x78, 0x65, 0x63, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x12, 0x6d, 0x61, 0x78, 0x43, 0x6f, 0x6e, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x45, 0x78,
+	0x65, 0x63, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x78, 0x65, 0x63, 0x5f, 0x77, 0x65, 0x69, 0x67,
+	0x68, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x57, 0x65,
+	0x69, 0x67, 0x68, 0x74, 0x22, 0x2a, 0x0a, 0x03, 0x41, 0x43, 0x4c, 0x12, 0x23, 0x0a, 0x06, 0x67,
+	0x72, 0x6f, 0x75, 0x70, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x61, 0x75,
+	0x74, 0x68, 0x2e, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x52, 0x06, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x73,
+	0x42, 0x28, 0x5a, 0x26, 0x67, 0x6f, 0x2e, 0x63, 0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e,
+	0x6f, 0x72, 0x67, 0x2f, 0x67, 0x6f, 0x6d, 0x61, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x61, 0x75, 0x74, 0x68, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
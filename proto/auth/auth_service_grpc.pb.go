@@ -19,6 +19,9 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type AuthServiceClient interface {
 	Auth(ctx context.Context, in *AuthReq, opts ...grpc.CallOption) (*AuthResp, error)
+	// Enroll exchanges OAuth2 access token for short-lived credential,
+	// which can be verified without tokeninfo.
+	Enroll(ctx context.Context, in *EnrollReq, opts ...grpc.CallOption) (*EnrollResp, error)
 }
 
 type authServiceClient struct {
@@ -38,11 +41,23 @@ func (c *authServiceClient) Auth(ctx context.Context, in *AuthReq, opts ...grpc.
 	return out, nil
 }
 
+func (c *authServiceClient) Enroll(ctx context.Context, in *EnrollReq, opts ...grpc.CallOption) (*EnrollResp, error) {
+	out := new(EnrollResp)
+	err := c.cc.Invoke(ctx, "/auth.AuthService/Enroll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AuthServiceServer is the server API for AuthService service.
 // All implementations must embed UnimplementedAuthServiceServer
 // for forward compatibility
 type AuthServiceServer interface {
 	Auth(context.Context, *AuthReq) (*AuthResp, error)
+	// Enroll exchanges OAuth2 access token for short-lived credential,
+	// which can be verified without tokeninfo.
+	Enroll(context.Context, *EnrollReq) (*EnrollResp, error)
 	mustEmbedUnimplementedAuthServiceServer()
 }
 
@@ -53,6 +68,9 @@ type UnimplementedAuthServiceServer struct {
 func (UnimplementedAuthServiceServer) Auth(context.Context, *AuthReq) (*AuthResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Auth not implemented")
 }
+func (UnimplementedAuthServiceServer) Enroll(context.Context, *EnrollReq) (*EnrollResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Enroll not implemented")
+}
 func (UnimplementedAuthServiceServer) mustEmbedUnimplementedAuthServiceServer() {}
 
 // UnsafeAuthServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -84,6 +102,24 @@ func _AuthService_Auth_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AuthService_Enroll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnrollReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Enroll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.AuthService/Enroll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Enroll(ctx, req.(*EnrollReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AuthService_ServiceDesc is the grpc.ServiceDesc for AuthService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -95,6 +131,10 @@ var AuthService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Auth",
 			Handler:    _AuthService_Auth_Handler,
 		},
+		{
+			MethodName: "Enroll",
+			Handler:    _AuthService_Enroll_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "auth/auth_service.proto",
@@ -84,8 +84,9 @@ type GetReq struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Key  string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Fast bool   `protobuf:"varint,2,opt,name=fast,proto3" json:"fast,omitempty"`
+	Key       string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Fast      bool   `protobuf:"varint,2,opt,name=fast,proto3" json:"fast,omitempty"`
+	Namespace string `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
 }
 
 func (x *GetReq) Reset() {
@@ -134,6 +135,13 @@ func (x *GetReq) GetFast() bool {
 	return false
 }
 
+func (x *GetReq) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
 type GetResp struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -141,6 +149,9 @@ type GetResp struct {
 
 	Kv       *KV  `protobuf:"bytes,1,opt,name=kv,proto3" json:"kv,omitempty"`
 	InMemory bool `protobuf:"varint,2,opt,name=in_memory,json=inMemory,proto3" json:"in_memory,omitempty"`
+	// blob_type is a blob type hint of PutReq that stored the value,
+	// if known.
+	BlobType string `protobuf:"bytes,3,opt,name=blob_type,json=blobType,proto3" json:"blob_type,omitempty"`
 }
 
 func (x *GetResp) Reset() {
@@ -189,13 +200,22 @@ func (x *GetResp) GetInMemory() bool {
 	return false
 }
 
+func (x *GetResp) GetBlobType() string {
+	if x != nil {
+		return x.BlobType
+	}
+	return ""
+}
+
 type PutReq struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Kv        *KV  `protobuf:"bytes,1,opt,name=kv,proto3" json:"kv,omitempty"`
-	WriteBack bool `protobuf:"varint,2,opt,name=write_back,json=writeBack,proto3" json:"write_back,omitempty"`
+	Kv        *KV    `protobuf:"bytes,1,opt,name=kv,proto3" json:"kv,omitempty"`
+	WriteBack bool   `protobuf:"varint,2,opt,name=write_back,json=writeBack,proto3" json:"write_back,omitempty"`
+	Namespace string `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	BlobType  string `protobuf:"bytes,4,opt,name=blob_type,json=blobType,proto3" json:"blob_type,omitempty"`
 }
 
 func (x *PutReq) Reset() {
@@ -244,6 +264,20 @@ func (x *PutReq) GetWriteBack() bool {
 	return false
 }
 
+func (x *PutReq) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *PutReq) GetBlobType() string {
+	if x != nil {
+		return x.BlobType
+	}
+	return ""
+}
+
 type PutResp struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -282,6 +316,111 @@ func (*PutResp) Descriptor() ([]byte, []int) {
 	return file_cache_cache_proto_rawDescGZIP(), []int{4}
 }
 
+type ExistsReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Keys []string `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	// namespace partitions keys, e.g. per remote instance or per tenant.
+	// empty namespace is default namespace.
+	Namespace string `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+}
+
+func (x *ExistsReq) Reset() {
+	*x = ExistsReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cache_cache_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExistsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExistsReq) ProtoMessage() {}
+
+func (x *ExistsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_cache_cache_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExistsReq.ProtoReflect.Descriptor instead.
+func (*ExistsReq) Descriptor() ([]byte, []int) {
+	return file_cache_cache_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExistsReq) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *ExistsReq) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+type ExistsResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// exists[i] reports whether keys[i] exists.
+	Exists []bool `protobuf:"varint,1,rep,packed,name=exists,proto3" json:"exists,omitempty"`
+}
+
+func (x *ExistsResp) Reset() {
+	*x = ExistsResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cache_cache_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExistsResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExistsResp) ProtoMessage() {}
+
+func (x *ExistsResp) ProtoReflect() protoreflect.Message {
+	mi := &file_cache_cache_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExistsResp.ProtoReflect.Descriptor instead.
+func (*ExistsResp) Descriptor() ([]byte, []int) {
+	return file_cache_cache_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExistsResp) GetExists() []bool {
+	if x != nil {
+		return x.Exists
+	}
+	return nil
+}
+
 var File_cache_cache_proto protoreflect.FileDescriptor
 
 var file_cache_cache_proto_rawDesc = []byte{
@@ -289,22 +428,36 @@ var file_cache_cache_proto_rawDesc = []byte{
 	0x6f, 0x74, 0x6f, 0x12, 0x05, 0x63, 0x61, 0x63, 0x68, 0x65, 0x22, 0x2c, 0x0a, 0x02, 0x4b, 0x56,
 	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
 	0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x2e, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x52,
+	0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x4c, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x52,
 	0x65, 0x71, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
 	0x03, 0x6b, 0x65, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x61, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x08, 0x52, 0x04, 0x66, 0x61, 0x73, 0x74, 0x22, 0x41, 0x0a, 0x07, 0x47, 0x65, 0x74, 0x52,
-	0x65, 0x73, 0x70, 0x12, 0x19, 0x0a, 0x02, 0x6b, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x09, 0x2e, 0x63, 0x61, 0x63, 0x68, 0x65, 0x2e, 0x4b, 0x56, 0x52, 0x02, 0x6b, 0x76, 0x12, 0x1b,
-	0x0a, 0x09, 0x69, 0x6e, 0x5f, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x08, 0x52, 0x08, 0x69, 0x6e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x22, 0x42, 0x0a, 0x06, 0x50,
-	0x75, 0x74, 0x52, 0x65, 0x71, 0x12, 0x19, 0x0a, 0x02, 0x6b, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x09, 0x2e, 0x63, 0x61, 0x63, 0x68, 0x65, 0x2e, 0x4b, 0x56, 0x52, 0x02, 0x6b, 0x76,
-	0x12, 0x1d, 0x0a, 0x0a, 0x77, 0x72, 0x69, 0x74, 0x65, 0x5f, 0x62, 0x61, 0x63, 0x6b, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x77, 0x72, 0x69, 0x74, 0x65, 0x42, 0x61, 0x63, 0x6b, 0x22,
-	0x09, 0x0a, 0x07, 0x50, 0x75, 0x74, 0x52, 0x65, 0x73, 0x70, 0x42, 0x29, 0x5a, 0x27, 0x67, 0x6f,
-	0x2e, 0x63, 0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72, 0x67, 0x2f, 0x67, 0x6f,
-	0x6d, 0x61, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f,
-	0x63, 0x61, 0x63, 0x68, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x28, 0x08, 0x52, 0x04, 0x66, 0x61, 0x73, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x6e, 0x61, 0x6d, 0x65,
+	0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6e, 0x61, 0x6d,
+	0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x22, 0x5e, 0x0a, 0x07, 0x47, 0x65, 0x74, 0x52, 0x65, 0x73,
+	0x70, 0x12, 0x19, 0x0a, 0x02, 0x6b, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x09, 0x2e,
+	0x63, 0x61, 0x63, 0x68, 0x65, 0x2e, 0x4b, 0x56, 0x52, 0x02, 0x6b, 0x76, 0x12, 0x1b, 0x0a, 0x09,
+	0x69, 0x6e, 0x5f, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x08, 0x69, 0x6e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x12, 0x1b, 0x0a, 0x09, 0x62, 0x6c, 0x6f,
+	0x62, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x62, 0x6c,
+	0x6f, 0x62, 0x54, 0x79, 0x70, 0x65, 0x22, 0x7d, 0x0a, 0x06, 0x50, 0x75, 0x74, 0x52, 0x65, 0x71,
+	0x12, 0x19, 0x0a, 0x02, 0x6b, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x09, 0x2e, 0x63,
+	0x61, 0x63, 0x68, 0x65, 0x2e, 0x4b, 0x56, 0x52, 0x02, 0x6b, 0x76, 0x12, 0x1d, 0x0a, 0x0a, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x5f, 0x62, 0x61, 0x63, 0x6b, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x09, 0x77, 0x72, 0x69, 0x74, 0x65, 0x42, 0x61, 0x63, 0x6b, 0x12, 0x1c, 0x0a, 0x09, 0x6e, 0x61,
+	0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6e,
+	0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x62, 0x6c, 0x6f, 0x62,
+	0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x62, 0x6c, 0x6f,
+	0x62, 0x54, 0x79, 0x70, 0x65, 0x22, 0x09, 0x0a, 0x07, 0x50, 0x75, 0x74, 0x52, 0x65, 0x73, 0x70,
+	0x22, 0x3d, 0x0a, 0x09, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x52, 0x65, 0x71, 0x12, 0x12, 0x0a,
+	0x04, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x6b, 0x65, 0x79,
+	0x73, 0x12, 0x1c, 0x0a, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x22,
+	0x24, 0x0a, 0x0a, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x12, 0x16, 0x0a,
+	0x06, 0x65, 0x78, 0x69, 0x73, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x08, 0x52, 0x06, 0x65,
+	0x78, 0x69, 0x73, 0x74, 0x73, 0x42, 0x29, 0x5a, 0x27, 0x67, 0x6f, 0x2e, 0x63, 0x68, 0x72, 0x6f,
+	0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72, 0x67, 0x2f, 0x67, 0x6f, 0x6d, 0x61, 0x2f, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x63, 0x61, 0x63, 0x68, 0x65,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -319,13 +472,15 @@ func file_cache_cache_proto_rawDescGZIP() []byte {
 	return file_cache_cache_proto_rawDescData
 }
 
-var file_cache_cache_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_cache_cache_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_cache_cache_proto_goTypes = []interface{}{
-	(*KV)(nil),      // 0: cache.KV
-	(*GetReq)(nil),  // 1: cache.GetReq
-	(*GetResp)(nil), // 2: cache.GetResp
-	(*PutReq)(nil),  // 3: cache.PutReq
-	(*PutResp)(nil), // 4: cache.PutResp
+	(*KV)(nil),         // 0: cache.KV
+	(*GetReq)(nil),     // 1: cache.GetReq
+	(*GetResp)(nil),    // 2: cache.GetResp
+	(*PutReq)(nil),     // 3: cache.PutReq
+	(*PutResp)(nil),    // 4: cache.PutResp
+	(*ExistsReq)(nil),  // 5: cache.ExistsReq
+	(*ExistsResp)(nil), // 6: cache.ExistsResp
 }
 var file_cache_cache_proto_depIdxs = []int32{
 	0, // 0: cache.GetResp.kv:type_name -> cache.KV
@@ -403,6 +558,30 @@ func file_cache_cache_proto_init() {
 				return nil
 			}
 		}
+		file_cache_cache_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExistsReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cache_cache_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExistsResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -410,7 +589,7 @@ func file_cache_cache_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_cache_cache_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
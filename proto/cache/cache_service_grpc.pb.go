@@ -20,6 +20,8 @@ const _ = grpc.SupportPackageIsVersion7
 type CacheServiceClient interface {
 	Get(ctx context.Context, in *GetReq, opts ...grpc.CallOption) (*GetResp, error)
 	Put(ctx context.Context, in *PutReq, opts ...grpc.CallOption) (*PutResp, error)
+	// Exists checks existence of keys without fetching values.
+	Exists(ctx context.Context, in *ExistsReq, opts ...grpc.CallOption) (*ExistsResp, error)
 }
 
 type cacheServiceClient struct {
@@ -48,12 +50,23 @@ func (c *cacheServiceClient) Put(ctx context.Context, in *PutReq, opts ...grpc.C
 	return out, nil
 }
 
+func (c *cacheServiceClient) Exists(ctx context.Context, in *ExistsReq, opts ...grpc.CallOption) (*ExistsResp, error) {
+	out := new(ExistsResp)
+	err := c.cc.Invoke(ctx, "/cache.CacheService/Exists", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CacheServiceServer is the server API for CacheService service.
 // All implementations must embed UnimplementedCacheServiceServer
 // for forward compatibility
 type CacheServiceServer interface {
 	Get(context.Context, *GetReq) (*GetResp, error)
 	Put(context.Context, *PutReq) (*PutResp, error)
+	// Exists checks existence of keys without fetching values.
+	Exists(context.Context, *ExistsReq) (*ExistsResp, error)
 	mustEmbedUnimplementedCacheServiceServer()
 }
 
@@ -67,6 +80,9 @@ func (UnimplementedCacheServiceServer) Get(context.Context, *GetReq) (*GetResp,
 func (UnimplementedCacheServiceServer) Put(context.Context, *PutReq) (*PutResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
 }
+func (UnimplementedCacheServiceServer) Exists(context.Context, *ExistsReq) (*ExistsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exists not implemented")
+}
 func (UnimplementedCacheServiceServer) mustEmbedUnimplementedCacheServiceServer() {}
 
 // UnsafeCacheServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -116,6 +132,24 @@ func _CacheService_Put_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CacheService_Exists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExistsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).Exists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cache.CacheService/Exists",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).Exists(ctx, req.(*ExistsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // CacheService_ServiceDesc is the grpc.ServiceDesc for CacheService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -131,6 +165,10 @@ var CacheService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Put",
 			Handler:    _CacheService_Put_Handler,
 		},
+		{
+			MethodName: "Exists",
+			Handler:    _CacheService_Exists_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "cache/cache_service.proto",
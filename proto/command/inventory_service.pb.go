@@ -0,0 +1,859 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.21.5
+// source: command/inventory_service.proto
+
+package command
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InventoryConfig_Source int32
+
+const (
+	InventoryConfig_UNKNOWN InventoryConfig_Source = 0
+	// config is loaded from toolchain config map.
+	InventoryConfig_CONFIGMAP InventoryConfig_Source = 1
+	// config is added by InventoryService.AddConfig.
+	InventoryConfig_ADMIN InventoryConfig_Source = 2
+)
+
+// Enum value maps for InventoryConfig_Source.
+var (
+	InventoryConfig_Source_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "CONFIGMAP",
+		2: "ADMIN",
+	}
+	InventoryConfig_Source_value = map[string]int32{
+		"UNKNOWN":   0,
+		"CONFIGMAP": 1,
+		"ADMIN":     2,
+	}
+)
+
+func (x InventoryConfig_Source) Enum() *InventoryConfig_Source {
+	p := new(InventoryConfig_Source)
+	*p = x
+	return p
+}
+
+func (x InventoryConfig_Source) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (InventoryConfig_Source) Descriptor() protoreflect.EnumDescriptor {
+	return file_command_inventory_service_proto_enumTypes[0].Descriptor()
+}
+
+func (InventoryConfig_Source) Type() protoreflect.EnumType {
+	return &file_command_inventory_service_proto_enumTypes[0]
+}
+
+func (x InventoryConfig_Source) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use InventoryConfig_Source.Descriptor instead.
+func (InventoryConfig_Source) EnumDescriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{1, 0}
+}
+
+// ConfigKey identifies a command config in the inventory.
+type ConfigKey struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Selector *Selector `protobuf:"bytes,1,opt,name=selector,proto3" json:"selector,omitempty"`
+	// address of the target.
+	Addr string `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+}
+
+func (x *ConfigKey) Reset() {
+	*x = ConfigKey{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ConfigKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigKey) ProtoMessage() {}
+
+func (x *ConfigKey) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigKey.ProtoReflect.Descriptor instead.
+func (*ConfigKey) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ConfigKey) GetSelector() *Selector {
+	if x != nil {
+		return x.Selector
+	}
+	return nil
+}
+
+func (x *ConfigKey) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+// InventoryConfig is a command config in the inventory.
+type InventoryConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Config *Config                `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	Source InventoryConfig_Source `protobuf:"varint,2,opt,name=source,proto3,enum=command.InventoryConfig_Source" json:"source,omitempty"`
+	// disabled config is not used for requests.
+	Disabled bool `protobuf:"varint,3,opt,name=disabled,proto3" json:"disabled,omitempty"`
+}
+
+func (x *InventoryConfig) Reset() {
+	*x = InventoryConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InventoryConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InventoryConfig) ProtoMessage() {}
+
+func (x *InventoryConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InventoryConfig.ProtoReflect.Descriptor instead.
+func (*InventoryConfig) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *InventoryConfig) GetConfig() *Config {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *InventoryConfig) GetSource() InventoryConfig_Source {
+	if x != nil {
+		return x.Source
+	}
+	return InventoryConfig_UNKNOWN
+}
+
+func (x *InventoryConfig) GetDisabled() bool {
+	if x != nil {
+		return x.Disabled
+	}
+	return false
+}
+
+type ListConfigsReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListConfigsReq) Reset() {
+	*x = ListConfigsReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListConfigsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConfigsReq) ProtoMessage() {}
+
+func (x *ListConfigsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConfigsReq.ProtoReflect.Descriptor instead.
+func (*ListConfigsReq) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{2}
+}
+
+type ListConfigsResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VersionId string             `protobuf:"bytes,1,opt,name=version_id,json=versionId,proto3" json:"version_id,omitempty"`
+	Configs   []*InventoryConfig `protobuf:"bytes,2,rep,name=configs,proto3" json:"configs,omitempty"`
+}
+
+func (x *ListConfigsResp) Reset() {
+	*x = ListConfigsResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListConfigsResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConfigsResp) ProtoMessage() {}
+
+func (x *ListConfigsResp) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConfigsResp.ProtoReflect.Descriptor instead.
+func (*ListConfigsResp) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListConfigsResp) GetVersionId() string {
+	if x != nil {
+		return x.VersionId
+	}
+	return ""
+}
+
+func (x *ListConfigsResp) GetConfigs() []*InventoryConfig {
+	if x != nil {
+		return x.Configs
+	}
+	return nil
+}
+
+type AddConfigReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Config *Config `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	// reason of the change, recorded in audit log.
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *AddConfigReq) Reset() {
+	*x = AddConfigReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AddConfigReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddConfigReq) ProtoMessage() {}
+
+func (x *AddConfigReq) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddConfigReq.ProtoReflect.Descriptor instead.
+func (*AddConfigReq) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AddConfigReq) GetConfig() *Config {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *AddConfigReq) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type AddConfigResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *AddConfigResp) Reset() {
+	*x = AddConfigResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AddConfigResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddConfigResp) ProtoMessage() {}
+
+func (x *AddConfigResp) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddConfigResp.ProtoReflect.Descriptor instead.
+func (*AddConfigResp) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{5}
+}
+
+type DisableConfigReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Key *ConfigKey `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// enable re-enables the disabled config.
+	Enable bool `protobuf:"varint,2,opt,name=enable,proto3" json:"enable,omitempty"`
+	// reason of the change, recorded in audit log.
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *DisableConfigReq) Reset() {
+	*x = DisableConfigReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DisableConfigReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DisableConfigReq) ProtoMessage() {}
+
+func (x *DisableConfigReq) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DisableConfigReq.ProtoReflect.Descriptor instead.
+func (*DisableConfigReq) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DisableConfigReq) GetKey() *ConfigKey {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *DisableConfigReq) GetEnable() bool {
+	if x != nil {
+		return x.Enable
+	}
+	return false
+}
+
+func (x *DisableConfigReq) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type DisableConfigResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DisableConfigResp) Reset() {
+	*x = DisableConfigResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DisableConfigResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DisableConfigResp) ProtoMessage() {}
+
+func (x *DisableConfigResp) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DisableConfigResp.ProtoReflect.Descriptor instead.
+func (*DisableConfigResp) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{7}
+}
+
+type DeleteConfigReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Key *ConfigKey `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// reason of the change, recorded in audit log.
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *DeleteConfigReq) Reset() {
+	*x = DeleteConfigReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteConfigReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteConfigReq) ProtoMessage() {}
+
+func (x *DeleteConfigReq) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteConfigReq.ProtoReflect.Descriptor instead.
+func (*DeleteConfigReq) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteConfigReq) GetKey() *ConfigKey {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *DeleteConfigReq) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type DeleteConfigResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DeleteConfigResp) Reset() {
+	*x = DeleteConfigResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_command_inventory_service_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteConfigResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteConfigResp) ProtoMessage() {}
+
+func (x *DeleteConfigResp) ProtoReflect() protoreflect.Message {
+	mi := &file_command_inventory_service_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteConfigResp.ProtoReflect.Descriptor instead.
+func (*DeleteConfigResp) Descriptor() ([]byte, []int) {
+	return file_command_inventory_service_proto_rawDescGZIP(), []int{9}
+}
+
+var File_command_inventory_service_proto protoreflect.FileDescriptor
+
+var file_command_inventory_service_proto_rawDesc = []byte{
+	0x0a, 0x1f, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2f, 0x69, 0x6e, 0x76, 0x65, 0x6e, 0x74,
+	0x6f, 0x72, 0x79, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x12, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x1a, 0x15, 0x63, 0x6f, 0x6d, 0x6d,
+	0x61, 0x6e, 0x64, 0x2f, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x22, 0x4e, 0x0a, 0x09, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x4b, 0x65, 0x79, 0x12, 0x2d,
+	0x0a, 0x08, 0x73, 0x65, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x53, 0x65, 0x6c, 0x65, 0x63,
+	0x74, 0x6f, 0x72, 0x52, 0x08, 0x73, 0x65, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x12, 0x0a,
+	0x04, 0x61, 0x64, 0x64, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61, 0x64, 0x64,
+	0x72, 0x22, 0xc0, 0x01, 0x0a, 0x0f, 0x49, 0x6e, 0x76, 0x65, 0x6e, 0x74, 0x6f, 0x72, 0x79, 0x43,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x27, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x37,
+	0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1f,
+	0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x49, 0x6e, 0x76, 0x65, 0x6e, 0x74, 0x6f,
+	0x72, 0x79, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52,
+	0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x69, 0x73, 0x61, 0x62,
+	0x6c, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x64, 0x69, 0x73, 0x61, 0x62,
+	0x6c, 0x65, 0x64, 0x22, 0x2f, 0x0a, 0x06, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x0b, 0x0a,
+	0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x43, 0x4f,
+	0x4e, 0x46, 0x49, 0x47, 0x4d, 0x41, 0x50, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x41, 0x44, 0x4d,
+	0x49, 0x4e, 0x10, 0x02, 0x22, 0x10, 0x0a, 0x0e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x73, 0x52, 0x65, 0x71, 0x22, 0x64, 0x0a, 0x0f, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x73, 0x52, 0x65, 0x73, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x32, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x63, 0x6f, 0x6d, 0x6d,
+	0x61, 0x6e, 0x64, 0x2e, 0x49, 0x6e, 0x76, 0x65, 0x6e, 0x74, 0x6f, 0x72, 0x79, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x22, 0x4f, 0x0a, 0x0c,
+	0x41, 0x64, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x71, 0x12, 0x27, 0x0a, 0x06,
+	0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x63,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x06, 0x63,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x0f, 0x0a,
+	0x0d, 0x41, 0x64, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x73, 0x70, 0x22, 0x68,
+	0x0a, 0x10, 0x44, 0x69, 0x73, 0x61, 0x62, 0x6c, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52,
+	0x65, 0x71, 0x12, 0x24, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x12, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x4b, 0x65, 0x79, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x6e, 0x61, 0x62,
+	0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x65, 0x6e, 0x61, 0x62, 0x6c, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x13, 0x0a, 0x11, 0x44, 0x69, 0x73, 0x61,
+	0x62, 0x6c, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x73, 0x70, 0x22, 0x4f, 0x0a,
+	0x0f, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x71,
+	0x12, 0x24, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e,
+	0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x4b, 0x65,
+	0x79, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x12,
+	0x0a, 0x10, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65,
+	0x73, 0x70, 0x32, 0xa5, 0x02, 0x0a, 0x10, 0x49, 0x6e, 0x76, 0x65, 0x6e, 0x74, 0x6f, 0x72, 0x79,
+	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x42, 0x0a, 0x0b, 0x4c, 0x69, 0x73, 0x74, 0x43,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x12, 0x17, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64,
+	0x2e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x52, 0x65, 0x71, 0x1a,
+	0x18, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x73, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x3c, 0x0a, 0x09, 0x41,
+	0x64, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x15, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61,
+	0x6e, 0x64, 0x2e, 0x41, 0x64, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x71, 0x1a,
+	0x16, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x41, 0x64, 0x64, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x48, 0x0a, 0x0d, 0x44, 0x69, 0x73,
+	0x61, 0x62, 0x6c, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x19, 0x2e, 0x63, 0x6f, 0x6d,
+	0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x44, 0x69, 0x73, 0x61, 0x62, 0x6c, 0x65, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x52, 0x65, 0x71, 0x1a, 0x1a, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e,
+	0x44, 0x69, 0x73, 0x61, 0x62, 0x6c, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x73,
+	0x70, 0x22, 0x00, 0x12, 0x45, 0x0a, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x12, 0x18, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x44, 0x65,
+	0x6c, 0x65, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x71, 0x1a, 0x19, 0x2e,
+	0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29, 0x67, 0x6f,
+	0x2e, 0x63, 0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72, 0x67, 0x2f, 0x67, 0x6f,
+	0x6d, 0x61, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f,
+	0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_command_inventory_service_proto_rawDescOnce sync.Once
+	file_command_inventory_service_proto_rawDescData = file_command_inventory_service_proto_rawDesc
+)
+
+func file_command_inventory_service_proto_rawDescGZIP() []byte {
+	file_command_inventory_service_proto_rawDescOnce.Do(func() {
+		file_command_inventory_service_proto_rawDescData = protoimpl.X.CompressGZIP(file_command_inventory_service_proto_rawDescData)
+	})
+	return file_command_inventory_service_proto_rawDescData
+}
+
+var file_command_inventory_service_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_command_inventory_service_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_command_inventory_service_proto_goTypes = []interface{}{
+	(InventoryConfig_Source)(0), // 0: command.InventoryConfig.Source
+	(*ConfigKey)(nil),           // 1: command.ConfigKey
+	(*InventoryConfig)(nil),     // 2: command.InventoryConfig
+	(*ListConfigsReq)(nil),      // 3: command.ListConfigsReq
+	(*ListConfigsResp)(nil),     // 4: command.ListConfigsResp
+	(*AddConfigReq)(nil),        // 5: command.AddConfigReq
+	(*AddConfigResp)(nil),       // 6: command.AddConfigResp
+	(*DisableConfigReq)(nil),    // 7: command.DisableConfigReq
+	(*DisableConfigResp)(nil),   // 8: command.DisableConfigResp
+	(*DeleteConfigReq)(nil),     // 9: command.DeleteConfigReq
+	(*DeleteConfigResp)(nil),    // 10: command.DeleteConfigResp
+	(*Selector)(nil),            // 11: command.Selector
+	(*Config)(nil),              // 12: command.Config
+}
+var file_command_inventory_service_proto_depIdxs = []int32{
+	11, // 0: command.ConfigKey.selector:type_name -> command.Selector
+	12, // 1: command.InventoryConfig.config:type_name -> command.Config
+	0,  // 2: command.InventoryConfig.source:type_name -> command.InventoryConfig.Source
+	2,  // 3: command.ListConfigsResp.configs:type_name -> command.InventoryConfig
+	12, // 4: command.AddConfigReq.config:type_name -> command.Config
+	1,  // 5: command.DisableConfigReq.key:type_name -> command.ConfigKey
+	1,  // 6: command.DeleteConfigReq.key:type_name -> command.ConfigKey
+	3,  // 7: command.InventoryService.ListConfigs:input_type -> command.ListConfigsReq
+	5,  // 8: command.InventoryService.AddConfig:input_type -> command.AddConfigReq
+	7,  // 9: command.InventoryService.DisableConfig:input_type -> command.DisableConfigReq
+	9,  // 10: command.InventoryService.DeleteConfig:input_type -> command.DeleteConfigReq
+	4,  // 11: command.InventoryService.ListConfigs:output_type -> command.ListConfigsResp
+	6,  // 12: command.InventoryService.AddConfig:output_type -> command.AddConfigResp
+	8,  // 13: command.InventoryService.DisableConfig:output_type -> command.DisableConfigResp
+	10, // 14: command.InventoryService.DeleteConfig:output_type -> command.DeleteConfigResp
+	11, // [11:15] is the sub-list for method output_type
+	7,  // [7:11] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_command_inventory_service_proto_init() }
+func file_command_inventory_service_proto_init() {
+	if File_command_inventory_service_proto != nil {
+		return
+	}
+	file_command_command_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_command_inventory_service_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ConfigKey); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InventoryConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListConfigsReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListConfigsResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AddConfigReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AddConfigResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DisableConfigReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DisableConfigResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteConfigReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_command_inventory_service_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteConfigResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_command_inventory_service_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_command_inventory_service_proto_goTypes,
+		DependencyIndexes: file_command_inventory_service_proto_depIdxs,
+		EnumInfos:         file_command_inventory_service_proto_enumTypes,
+		MessageInfos:      file_command_inventory_service_proto_msgTypes,
+	}.Build()
+	File_command_inventory_service_proto = out.File
+	file_command_inventory_service_proto_rawDesc = nil
+	file_command_inventory_service_proto_goTypes = nil
+	file_command_inventory_service_proto_depIdxs = nil
+}
@@ -14,6 +14,7 @@ import (
 	api "go.chromium.org/goma/server/proto/api"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 )
@@ -97,33 +98,705 @@ func (ExecServiceApplicationError) EnumDescriptor() ([]byte, []int) {
 	return file_exec_exec_service_proto_rawDescGZIP(), []int{0}
 }
 
+// Priority hint of the request.
+type ExecExtReq_Priority int32
+
+const (
+	ExecExtReq_DEFAULT_PRIORITY ExecExtReq_Priority = 0
+	ExecExtReq_INTERACTIVE      ExecExtReq_Priority = 1 // interactive developer build.
+	ExecExtReq_BATCH            ExecExtReq_Priority = 2 // CI batch build.
+)
+
+// Enum value maps for ExecExtReq_Priority.
+var (
+	ExecExtReq_Priority_name = map[int32]string{
+		0: "DEFAULT_PRIORITY",
+		1: "INTERACTIVE",
+		2: "BATCH",
+	}
+	ExecExtReq_Priority_value = map[string]int32{
+		"DEFAULT_PRIORITY": 0,
+		"INTERACTIVE":      1,
+		"BATCH":            2,
+	}
+)
+
+func (x ExecExtReq_Priority) Enum() *ExecExtReq_Priority {
+	p := new(ExecExtReq_Priority)
+	*p = x
+	return p
+}
+
+func (x ExecExtReq_Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExecExtReq_Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_exec_exec_service_proto_enumTypes[1].Descriptor()
+}
+
+func (ExecExtReq_Priority) Type() protoreflect.EnumType {
+	return &file_exec_exec_service_proto_enumTypes[1]
+}
+
+func (x ExecExtReq_Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *ExecExtReq_Priority) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = ExecExtReq_Priority(num)
+	return nil
+}
+
+// Deprecated: Use ExecExtReq_Priority.Descriptor instead.
+func (ExecExtReq_Priority) EnumDescriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// Stage is stage of remote execution.
+// Values are the same as ExecutionStage of REAPI.
+type ExecProgress_Stage int32
+
+const (
+	ExecProgress_UNKNOWN ExecProgress_Stage = 0
+	// Checking the result against the cache.
+	ExecProgress_CACHE_CHECK ExecProgress_Stage = 1
+	// Currently idle, awaiting a free machine to execute.
+	ExecProgress_QUEUED ExecProgress_Stage = 2
+	// Currently being executed by a worker.
+	ExecProgress_EXECUTING ExecProgress_Stage = 3
+	// Finished execution.
+	ExecProgress_COMPLETED ExecProgress_Stage = 4
+)
+
+// Enum value maps for ExecProgress_Stage.
+var (
+	ExecProgress_Stage_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "CACHE_CHECK",
+		2: "QUEUED",
+		3: "EXECUTING",
+		4: "COMPLETED",
+	}
+	ExecProgress_Stage_value = map[string]int32{
+		"UNKNOWN":     0,
+		"CACHE_CHECK": 1,
+		"QUEUED":      2,
+		"EXECUTING":   3,
+		"COMPLETED":   4,
+	}
+)
+
+func (x ExecProgress_Stage) Enum() *ExecProgress_Stage {
+	p := new(ExecProgress_Stage)
+	*p = x
+	return p
+}
+
+func (x ExecProgress_Stage) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExecProgress_Stage) Descriptor() protoreflect.EnumDescriptor {
+	return file_exec_exec_service_proto_enumTypes[2].Descriptor()
+}
+
+func (ExecProgress_Stage) Type() protoreflect.EnumType {
+	return &file_exec_exec_service_proto_enumTypes[2]
+}
+
+func (x ExecProgress_Stage) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *ExecProgress_Stage) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = ExecProgress_Stage(num)
+	return nil
+}
+
+// Deprecated: Use ExecProgress_Stage.Descriptor instead.
+func (ExecProgress_Stage) EnumDescriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{5, 0}
+}
+
+// ExecExtReq is ExecReq with extensions used only by goma server.
+// ExecReq is defined by goma client, so such fields are defined here
+// rather than in ExecReq.
+type ExecExtReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Req *api.ExecReq `protobuf:"bytes,1,opt,name=req" json:"req,omitempty"`
+	// file metadata hints of req.input, in the same order as req.input.
+	// if client sets them, client may set empty hash_key for the file
+	// unchanged since previous request, and server reuses digest of the
+	// file computed for previous request from the same client with the
+	// same filename, mtime and size.
+	// if server doesn't know the file, it is reported as missing input,
+	// and client should retry with hash_key (and content).
+	InputMeta []*InputMeta `protobuf:"bytes,2,rep,name=input_meta,json=inputMeta" json:"input_meta,omitempty"`
+	// priority hint of the request, e.g. interactive developer build or
+	// CI batch build. server maps it to priority of remote execution
+	// per group.
+	Priority *ExecExtReq_Priority `protobuf:"varint,3,opt,name=priority,enum=devtools_goma.ExecExtReq_Priority" json:"priority,omitempty"`
+}
+
+func (x *ExecExtReq) Reset() {
+	*x = ExecExtReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exec_exec_service_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExecExtReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecExtReq) ProtoMessage() {}
+
+func (x *ExecExtReq) ProtoReflect() protoreflect.Message {
+	mi := &file_exec_exec_service_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecExtReq.ProtoReflect.Descriptor instead.
+func (*ExecExtReq) Descriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExecExtReq) GetReq() *api.ExecReq {
+	if x != nil {
+		return x.Req
+	}
+	return nil
+}
+
+func (x *ExecExtReq) GetInputMeta() []*InputMeta {
+	if x != nil {
+		return x.InputMeta
+	}
+	return nil
+}
+
+func (x *ExecExtReq) GetPriority() ExecExtReq_Priority {
+	if x != nil && x.Priority != nil {
+		return *x.Priority
+	}
+	return ExecExtReq_DEFAULT_PRIORITY
+}
+
+// InputMeta is file metadata hints of ExecReq.Input.
+type InputMeta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Mtime *int64 `protobuf:"varint,1,opt,name=mtime" json:"mtime,omitempty"` // modification time in unix nanoseconds.
+	Size  *int64 `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`   // file size in bytes.
+}
+
+func (x *InputMeta) Reset() {
+	*x = InputMeta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exec_exec_service_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InputMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InputMeta) ProtoMessage() {}
+
+func (x *InputMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_exec_exec_service_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InputMeta.ProtoReflect.Descriptor instead.
+func (*InputMeta) Descriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *InputMeta) GetMtime() int64 {
+	if x != nil && x.Mtime != nil {
+		return *x.Mtime
+	}
+	return 0
+}
+
+func (x *InputMeta) GetSize() int64 {
+	if x != nil && x.Size != nil {
+		return *x.Size
+	}
+	return 0
+}
+
+// ExecutionMetadata is metadata of RBE execution.
+// This is a subset of ExecutedActionMetadata of REAPI, in addition to
+// ExecResp.execution_stats.
+type ExecutionMetadata struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name of the RBE operation.
+	OperationName *string `protobuf:"bytes,1,opt,name=operation_name,json=operationName" json:"operation_name,omitempty"`
+	// The name of the worker which ran the execution.
+	Worker *string `protobuf:"bytes,2,opt,name=worker" json:"worker,omitempty"`
+	// When the action was added to the queue.
+	QueuedTimestamp *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=queued_timestamp,json=queuedTimestamp" json:"queued_timestamp,omitempty"`
+	// When the worker received the action.
+	WorkerStartTimestamp *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=worker_start_timestamp,json=workerStartTimestamp" json:"worker_start_timestamp,omitempty"`
+	// When the worker completed the action, including all stages.
+	WorkerCompletedTimestamp *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=worker_completed_timestamp,json=workerCompletedTimestamp" json:"worker_completed_timestamp,omitempty"`
+}
+
+func (x *ExecutionMetadata) Reset() {
+	*x = ExecutionMetadata{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exec_exec_service_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExecutionMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecutionMetadata) ProtoMessage() {}
+
+func (x *ExecutionMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_exec_exec_service_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecutionMetadata.ProtoReflect.Descriptor instead.
+func (*ExecutionMetadata) Descriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ExecutionMetadata) GetOperationName() string {
+	if x != nil && x.OperationName != nil {
+		return *x.OperationName
+	}
+	return ""
+}
+
+func (x *ExecutionMetadata) GetWorker() string {
+	if x != nil && x.Worker != nil {
+		return *x.Worker
+	}
+	return ""
+}
+
+func (x *ExecutionMetadata) GetQueuedTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.QueuedTimestamp
+	}
+	return nil
+}
+
+func (x *ExecutionMetadata) GetWorkerStartTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.WorkerStartTimestamp
+	}
+	return nil
+}
+
+func (x *ExecutionMetadata) GetWorkerCompletedTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.WorkerCompletedTimestamp
+	}
+	return nil
+}
+
+// ExecProvenance is provenance of an execution, to attribute its
+// outputs to the worker and the toolchain config, e.g. for build
+// provenance records.
+type ExecProvenance struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// RBE instance name where the action was executed.
+	Instance *string `protobuf:"bytes,1,opt,name=instance" json:"instance,omitempty"`
+	// Digest of the RBE action, in "<hash>/<size_bytes>".
+	ActionDigest *string `protobuf:"bytes,2,opt,name=action_digest,json=actionDigest" json:"action_digest,omitempty"`
+	// The name of the worker which ran the execution.
+	Worker *string `protobuf:"bytes,3,opt,name=worker" json:"worker,omitempty"`
+	// Container image of the execution platform.
+	ContainerImage *string `protobuf:"bytes,4,opt,name=container_image,json=containerImage" json:"container_image,omitempty"`
+	// Toolchain of the command config used for the execution.
+	Toolchain *string `protobuf:"bytes,5,opt,name=toolchain" json:"toolchain,omitempty"`
+	// Serialized build.bazel.remote.execution.v2.ExecutedActionMetadata
+	// reported by RBE.
+	ExecutedActionMetadata []byte `protobuf:"bytes,6,opt,name=executed_action_metadata,json=executedActionMetadata" json:"executed_action_metadata,omitempty"`
+}
+
+func (x *ExecProvenance) Reset() {
+	*x = ExecProvenance{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exec_exec_service_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExecProvenance) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecProvenance) ProtoMessage() {}
+
+func (x *ExecProvenance) ProtoReflect() protoreflect.Message {
+	mi := &file_exec_exec_service_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecProvenance.ProtoReflect.Descriptor instead.
+func (*ExecProvenance) Descriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ExecProvenance) GetInstance() string {
+	if x != nil && x.Instance != nil {
+		return *x.Instance
+	}
+	return ""
+}
+
+func (x *ExecProvenance) GetActionDigest() string {
+	if x != nil && x.ActionDigest != nil {
+		return *x.ActionDigest
+	}
+	return ""
+}
+
+func (x *ExecProvenance) GetWorker() string {
+	if x != nil && x.Worker != nil {
+		return *x.Worker
+	}
+	return ""
+}
+
+func (x *ExecProvenance) GetContainerImage() string {
+	if x != nil && x.ContainerImage != nil {
+		return *x.ContainerImage
+	}
+	return ""
+}
+
+func (x *ExecProvenance) GetToolchain() string {
+	if x != nil && x.Toolchain != nil {
+		return *x.Toolchain
+	}
+	return ""
+}
+
+func (x *ExecProvenance) GetExecutedActionMetadata() []byte {
+	if x != nil {
+		return x.ExecutedActionMetadata
+	}
+	return nil
+}
+
+// ExecExtResp is ExecResp with extensions used only by goma server.
+type ExecExtResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Resp *api.ExecResp `protobuf:"bytes,1,opt,name=resp" json:"resp,omitempty"`
+	// metadata of RBE execution, if executed (or cached) in RBE.
+	ExecutionMetadata *ExecutionMetadata `protobuf:"bytes,2,opt,name=execution_metadata,json=executionMetadata" json:"execution_metadata,omitempty"`
+	// provenance of the execution in RBE.
+	Provenance *ExecProvenance `protobuf:"bytes,3,opt,name=provenance" json:"provenance,omitempty"`
+}
+
+func (x *ExecExtResp) Reset() {
+	*x = ExecExtResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exec_exec_service_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExecExtResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecExtResp) ProtoMessage() {}
+
+func (x *ExecExtResp) ProtoReflect() protoreflect.Message {
+	mi := &file_exec_exec_service_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecExtResp.ProtoReflect.Descriptor instead.
+func (*ExecExtResp) Descriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExecExtResp) GetResp() *api.ExecResp {
+	if x != nil {
+		return x.Resp
+	}
+	return nil
+}
+
+func (x *ExecExtResp) GetExecutionMetadata() *ExecutionMetadata {
+	if x != nil {
+		return x.ExecutionMetadata
+	}
+	return nil
+}
+
+func (x *ExecExtResp) GetProvenance() *ExecProvenance {
+	if x != nil {
+		return x.Provenance
+	}
+	return nil
+}
+
+// ExecProgress is a progress of exec, streamed by ExecStream.
+type ExecProgress struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Stage *ExecProgress_Stage `protobuf:"varint,1,opt,name=stage,enum=devtools_goma.ExecProgress_Stage" json:"stage,omitempty"`
+	// name of remote execution operation.
+	OperationName *string `protobuf:"bytes,2,opt,name=operation_name,json=operationName" json:"operation_name,omitempty"`
+	// response of exec. set only in the last message of the stream.
+	Resp *ExecExtResp `protobuf:"bytes,3,opt,name=resp" json:"resp,omitempty"`
+}
+
+func (x *ExecProgress) Reset() {
+	*x = ExecProgress{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exec_exec_service_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExecProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecProgress) ProtoMessage() {}
+
+func (x *ExecProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_exec_exec_service_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecProgress.ProtoReflect.Descriptor instead.
+func (*ExecProgress) Descriptor() ([]byte, []int) {
+	return file_exec_exec_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExecProgress) GetStage() ExecProgress_Stage {
+	if x != nil && x.Stage != nil {
+		return *x.Stage
+	}
+	return ExecProgress_UNKNOWN
+}
+
+func (x *ExecProgress) GetOperationName() string {
+	if x != nil && x.OperationName != nil {
+		return *x.OperationName
+	}
+	return ""
+}
+
+func (x *ExecProgress) GetResp() *ExecExtResp {
+	if x != nil {
+		return x.Resp
+	}
+	return nil
+}
+
 var File_exec_exec_service_proto protoreflect.FileDescriptor
 
 var file_exec_exec_service_proto_rawDesc = []byte{
 	0x0a, 0x17, 0x65, 0x78, 0x65, 0x63, 0x2f, 0x65, 0x78, 0x65, 0x63, 0x5f, 0x73, 0x65, 0x72, 0x76,
 	0x69, 0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0d, 0x64, 0x65, 0x76, 0x74, 0x6f,
 	0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x1a, 0x13, 0x61, 0x70, 0x69, 0x2f, 0x67, 0x6f,
-	0x6d, 0x61, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2a, 0xc3, 0x01,
-	0x0a, 0x1b, 0x45, 0x78, 0x65, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x41, 0x70, 0x70,
-	0x6c, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x18, 0x0a,
-	0x0b, 0x42, 0x41, 0x44, 0x5f, 0x52, 0x45, 0x51, 0x55, 0x45, 0x53, 0x54, 0x10, 0xff, 0xff, 0xff,
-	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x45, 0x58, 0x45, 0x43, 0x5f,
-	0x4f, 0x4b, 0x10, 0x00, 0x12, 0x18, 0x0a, 0x14, 0x45, 0x58, 0x45, 0x43, 0x55, 0x54, 0x41, 0x42,
-	0x4c, 0x45, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x52, 0x45, 0x41, 0x44, 0x59, 0x10, 0x01, 0x12, 0x11,
-	0x0a, 0x0d, 0x44, 0x49, 0x53, 0x4b, 0x5f, 0x45, 0x58, 0x43, 0x45, 0x45, 0x44, 0x45, 0x44, 0x10,
-	0x02, 0x12, 0x17, 0x0a, 0x13, 0x45, 0x58, 0x45, 0x43, 0x5f, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x4e,
-	0x41, 0x4c, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x03, 0x12, 0x17, 0x0a, 0x13, 0x45, 0x58,
-	0x45, 0x43, 0x55, 0x54, 0x4f, 0x52, 0x5f, 0x49, 0x53, 0x5f, 0x4c, 0x4f, 0x41, 0x44, 0x49, 0x4e,
-	0x47, 0x10, 0x04, 0x12, 0x1e, 0x0a, 0x1a, 0x45, 0x58, 0x45, 0x43, 0x55, 0x54, 0x4f, 0x52, 0x5f,
-	0x4d, 0x45, 0x4d, 0x4f, 0x52, 0x59, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x45, 0x4e, 0x4f, 0x55, 0x47,
-	0x48, 0x10, 0x05, 0x32, 0x48, 0x0a, 0x0b, 0x45, 0x78, 0x65, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69,
-	0x63, 0x65, 0x12, 0x39, 0x0a, 0x04, 0x45, 0x78, 0x65, 0x63, 0x12, 0x16, 0x2e, 0x64, 0x65, 0x76,
+	0x6d, 0x61, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xed,
+	0x01, 0x0a, 0x0a, 0x45, 0x78, 0x65, 0x63, 0x45, 0x78, 0x74, 0x52, 0x65, 0x71, 0x12, 0x28, 0x0a,
+	0x03, 0x72, 0x65, 0x71, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x64, 0x65, 0x76,
 	0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x52,
-	0x65, 0x71, 0x1a, 0x17, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f,
-	0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x42, 0x31, 0x5a,
-	0x26, 0x67, 0x6f, 0x2e, 0x63, 0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72, 0x67,
-	0x2f, 0x67, 0x6f, 0x6d, 0x61, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x2f, 0x65, 0x78, 0x65, 0x63, 0x80, 0x01, 0x00, 0x88, 0x01, 0x00, 0x90, 0x01, 0x00,
+	0x65, 0x71, 0x52, 0x03, 0x72, 0x65, 0x71, 0x12, 0x37, 0x0a, 0x0a, 0x69, 0x6e, 0x70, 0x75, 0x74,
+	0x5f, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x64, 0x65,
+	0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x49, 0x6e, 0x70, 0x75,
+	0x74, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x09, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x4d, 0x65, 0x74, 0x61,
+	0x12, 0x3e, 0x0a, 0x08, 0x70, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x22, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f,
+	0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x45, 0x78, 0x74, 0x52, 0x65, 0x71, 0x2e, 0x50, 0x72,
+	0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x52, 0x08, 0x70, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79,
+	0x22, 0x3c, 0x0a, 0x08, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x14, 0x0a, 0x10,
+	0x44, 0x45, 0x46, 0x41, 0x55, 0x4c, 0x54, 0x5f, 0x50, 0x52, 0x49, 0x4f, 0x52, 0x49, 0x54, 0x59,
+	0x10, 0x00, 0x12, 0x0f, 0x0a, 0x0b, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x41, 0x43, 0x54, 0x49, 0x56,
+	0x45, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x42, 0x41, 0x54, 0x43, 0x48, 0x10, 0x02, 0x22, 0x35,
+	0x0a, 0x09, 0x49, 0x6e, 0x70, 0x75, 0x74, 0x4d, 0x65, 0x74, 0x61, 0x12, 0x14, 0x0a, 0x05, 0x6d,
+	0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x6d, 0x74, 0x69, 0x6d,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x04, 0x73, 0x69, 0x7a, 0x65, 0x22, 0xc5, 0x02, 0x0a, 0x11, 0x45, 0x78, 0x65, 0x63, 0x75, 0x74,
+	0x69, 0x6f, 0x6e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x25, 0x0a, 0x0e, 0x6f,
+	0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0d, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x12, 0x45, 0x0a, 0x10, 0x71, 0x75,
+	0x65, 0x75, 0x65, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x52, 0x0f, 0x71, 0x75, 0x65, 0x75, 0x65, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x12, 0x50, 0x0a, 0x16, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x5f, 0x73, 0x74, 0x61, 0x72,
+	0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x14, 0x77,
+	0x6f, 0x72, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x12, 0x58, 0x0a, 0x1a, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x5f, 0x63, 0x6f,
+	0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x52, 0x18, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x43, 0x6f, 0x6d, 0x70, 0x6c,
+	0x65, 0x74, 0x65, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0xea, 0x01,
+	0x0a, 0x0e, 0x45, 0x78, 0x65, 0x63, 0x50, 0x72, 0x6f, 0x76, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x23, 0x0a, 0x0d,
+	0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0c, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x44, 0x69, 0x67, 0x65, 0x73,
+	0x74, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x12, 0x27, 0x0a, 0x0f, 0x63, 0x6f, 0x6e,
+	0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0e, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x6d, 0x61,
+	0x67, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x6f, 0x6f, 0x6c, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x74, 0x6f, 0x6f, 0x6c, 0x63, 0x68, 0x61, 0x69, 0x6e,
+	0x12, 0x38, 0x0a, 0x18, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x16, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x65, 0x64, 0x41, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x22, 0xca, 0x01, 0x0a, 0x0b, 0x45,
+	0x78, 0x65, 0x63, 0x45, 0x78, 0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2b, 0x0a, 0x04, 0x72, 0x65,
+	0x73, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f,
+	0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x52, 0x65, 0x73,
+	0x70, 0x52, 0x04, 0x72, 0x65, 0x73, 0x70, 0x12, 0x4f, 0x0a, 0x12, 0x65, 0x78, 0x65, 0x63, 0x75,
+	0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67,
+	0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x65, 0x74,
+	0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x11, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e,
+	0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x3d, 0x0a, 0x0a, 0x70, 0x72, 0x6f, 0x76,
+	0x65, 0x6e, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x64,
+	0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65,
+	0x63, 0x50, 0x72, 0x6f, 0x76, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x65, 0x52, 0x0a, 0x70, 0x72, 0x6f,
+	0x76, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x65, 0x22, 0xef, 0x01, 0x0a, 0x0c, 0x45, 0x78, 0x65, 0x63,
+	0x50, 0x72, 0x6f, 0x67, 0x72, 0x65, 0x73, 0x73, 0x12, 0x37, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x67,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x21, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f,
+	0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x50, 0x72, 0x6f, 0x67,
+	0x72, 0x65, 0x73, 0x73, 0x2e, 0x53, 0x74, 0x61, 0x67, 0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x67,
+	0x65, 0x12, 0x25, 0x0a, 0x0e, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x6f, 0x70, 0x65, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x2e, 0x0a, 0x04, 0x72, 0x65, 0x73, 0x70,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c,
+	0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x45, 0x78, 0x74, 0x52, 0x65,
+	0x73, 0x70, 0x52, 0x04, 0x72, 0x65, 0x73, 0x70, 0x22, 0x4f, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x67,
+	0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0f,
+	0x0a, 0x0b, 0x43, 0x41, 0x43, 0x48, 0x45, 0x5f, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x10, 0x01, 0x12,
+	0x0a, 0x0a, 0x06, 0x51, 0x55, 0x45, 0x55, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0d, 0x0a, 0x09, 0x45,
+	0x58, 0x45, 0x43, 0x55, 0x54, 0x49, 0x4e, 0x47, 0x10, 0x03, 0x12, 0x0d, 0x0a, 0x09, 0x43, 0x4f,
+	0x4d, 0x50, 0x4c, 0x45, 0x54, 0x45, 0x44, 0x10, 0x04, 0x2a, 0xc3, 0x01, 0x0a, 0x1b, 0x45, 0x78,
+	0x65, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x41, 0x70, 0x70, 0x6c, 0x69, 0x63, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x18, 0x0a, 0x0b, 0x42, 0x41, 0x44,
+	0x5f, 0x52, 0x45, 0x51, 0x55, 0x45, 0x53, 0x54, 0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x45, 0x58, 0x45, 0x43, 0x5f, 0x4f, 0x4b, 0x10, 0x00,
+	0x12, 0x18, 0x0a, 0x14, 0x45, 0x58, 0x45, 0x43, 0x55, 0x54, 0x41, 0x42, 0x4c, 0x45, 0x5f, 0x4e,
+	0x4f, 0x54, 0x5f, 0x52, 0x45, 0x41, 0x44, 0x59, 0x10, 0x01, 0x12, 0x11, 0x0a, 0x0d, 0x44, 0x49,
+	0x53, 0x4b, 0x5f, 0x45, 0x58, 0x43, 0x45, 0x45, 0x44, 0x45, 0x44, 0x10, 0x02, 0x12, 0x17, 0x0a,
+	0x13, 0x45, 0x58, 0x45, 0x43, 0x5f, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x4e, 0x41, 0x4c, 0x5f, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x10, 0x03, 0x12, 0x17, 0x0a, 0x13, 0x45, 0x58, 0x45, 0x43, 0x55, 0x54,
+	0x4f, 0x52, 0x5f, 0x49, 0x53, 0x5f, 0x4c, 0x4f, 0x41, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x04, 0x12,
+	0x1e, 0x0a, 0x1a, 0x45, 0x58, 0x45, 0x43, 0x55, 0x54, 0x4f, 0x52, 0x5f, 0x4d, 0x45, 0x4d, 0x4f,
+	0x52, 0x59, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x45, 0x4e, 0x4f, 0x55, 0x47, 0x48, 0x10, 0x05, 0x32,
+	0xd6, 0x01, 0x0a, 0x0b, 0x45, 0x78, 0x65, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12,
+	0x39, 0x0a, 0x04, 0x45, 0x78, 0x65, 0x63, 0x12, 0x16, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f,
+	0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x52, 0x65, 0x71, 0x1a,
+	0x17, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e,
+	0x45, 0x78, 0x65, 0x63, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x42, 0x0a, 0x07, 0x45, 0x78,
+	0x65, 0x63, 0x45, 0x78, 0x74, 0x12, 0x19, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73,
+	0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x45, 0x78, 0x74, 0x52, 0x65, 0x71,
+	0x1a, 0x1a, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61,
+	0x2e, 0x45, 0x78, 0x65, 0x63, 0x45, 0x78, 0x74, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x48,
+	0x0a, 0x0a, 0x45, 0x78, 0x65, 0x63, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x19, 0x2e, 0x64,
+	0x65, 0x76, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65,
+	0x63, 0x45, 0x78, 0x74, 0x52, 0x65, 0x71, 0x1a, 0x1b, 0x2e, 0x64, 0x65, 0x76, 0x74, 0x6f, 0x6f,
+	0x6c, 0x73, 0x5f, 0x67, 0x6f, 0x6d, 0x61, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x50, 0x72, 0x6f, 0x67,
+	0x72, 0x65, 0x73, 0x73, 0x22, 0x00, 0x30, 0x01, 0x42, 0x31, 0x5a, 0x26, 0x67, 0x6f, 0x2e, 0x63,
+	0x68, 0x72, 0x6f, 0x6d, 0x69, 0x75, 0x6d, 0x2e, 0x6f, 0x72, 0x67, 0x2f, 0x67, 0x6f, 0x6d, 0x61,
+	0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x65, 0x78,
+	0x65, 0x63, 0x80, 0x01, 0x00, 0x88, 0x01, 0x00, 0x90, 0x01, 0x00,
 }
 
 var (
@@ -138,20 +811,45 @@ func file_exec_exec_service_proto_rawDescGZIP() []byte {
 	return file_exec_exec_service_proto_rawDescData
 }
 
-var file_exec_exec_service_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_exec_exec_service_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_exec_exec_service_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_exec_exec_service_proto_goTypes = []interface{}{
 	(ExecServiceApplicationError)(0), // 0: devtools_goma.ExecServiceApplicationError
-	(*api.ExecReq)(nil),              // 1: devtools_goma.ExecReq
-	(*api.ExecResp)(nil),             // 2: devtools_goma.ExecResp
+	(ExecExtReq_Priority)(0),         // 1: devtools_goma.ExecExtReq.Priority
+	(ExecProgress_Stage)(0),          // 2: devtools_goma.ExecProgress.Stage
+	(*ExecExtReq)(nil),               // 3: devtools_goma.ExecExtReq
+	(*InputMeta)(nil),                // 4: devtools_goma.InputMeta
+	(*ExecutionMetadata)(nil),        // 5: devtools_goma.ExecutionMetadata
+	(*ExecProvenance)(nil),           // 6: devtools_goma.ExecProvenance
+	(*ExecExtResp)(nil),              // 7: devtools_goma.ExecExtResp
+	(*ExecProgress)(nil),             // 8: devtools_goma.ExecProgress
+	(*api.ExecReq)(nil),              // 9: devtools_goma.ExecReq
+	(*timestamppb.Timestamp)(nil),    // 10: google.protobuf.Timestamp
+	(*api.ExecResp)(nil),             // 11: devtools_goma.ExecResp
 }
 var file_exec_exec_service_proto_depIdxs = []int32{
-	1, // 0: devtools_goma.ExecService.Exec:input_type -> devtools_goma.ExecReq
-	2, // 1: devtools_goma.ExecService.Exec:output_type -> devtools_goma.ExecResp
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	9,  // 0: devtools_goma.ExecExtReq.req:type_name -> devtools_goma.ExecReq
+	4,  // 1: devtools_goma.ExecExtReq.input_meta:type_name -> devtools_goma.InputMeta
+	1,  // 2: devtools_goma.ExecExtReq.priority:type_name -> devtools_goma.ExecExtReq.Priority
+	10, // 3: devtools_goma.ExecutionMetadata.queued_timestamp:type_name -> google.protobuf.Timestamp
+	10, // 4: devtools_goma.ExecutionMetadata.worker_start_timestamp:type_name -> google.protobuf.Timestamp
+	10, // 5: devtools_goma.ExecutionMetadata.worker_completed_timestamp:type_name -> google.protobuf.Timestamp
+	11, // 6: devtools_goma.ExecExtResp.resp:type_name -> devtools_goma.ExecResp
+	5,  // 7: devtools_goma.ExecExtResp.execution_metadata:type_name -> devtools_goma.ExecutionMetadata
+	6,  // 8: devtools_goma.ExecExtResp.provenance:type_name -> devtools_goma.ExecProvenance
+	2,  // 9: devtools_goma.ExecProgress.stage:type_name -> devtools_goma.ExecProgress.Stage
+	7,  // 10: devtools_goma.ExecProgress.resp:type_name -> devtools_goma.ExecExtResp
+	9,  // 11: devtools_goma.ExecService.Exec:input_type -> devtools_goma.ExecReq
+	3,  // 12: devtools_goma.ExecService.ExecExt:input_type -> devtools_goma.ExecExtReq
+	3,  // 13: devtools_goma.ExecService.ExecStream:input_type -> devtools_goma.ExecExtReq
+	11, // 14: devtools_goma.ExecService.Exec:output_type -> devtools_goma.ExecResp
+	7,  // 15: devtools_goma.ExecService.ExecExt:output_type -> devtools_goma.ExecExtResp
+	8,  // 16: devtools_goma.ExecService.ExecStream:output_type -> devtools_goma.ExecProgress
+	14, // [14:17] is the sub-list for method output_type
+	11, // [11:14] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_exec_exec_service_proto_init() }
@@ -159,19 +857,94 @@ func file_exec_exec_service_proto_init() {
 	if File_exec_exec_service_proto != nil {
 		return
 	}
+	if !protoimpl.UnsafeEnabled {
+		file_exec_exec_service_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExecExtReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exec_exec_service_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InputMeta); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exec_exec_service_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExecutionMetadata); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exec_exec_service_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExecProvenance); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exec_exec_service_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExecExtResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exec_exec_service_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExecProgress); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_exec_exec_service_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   0,
+			NumEnums:      3,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_exec_exec_service_proto_goTypes,
 		DependencyIndexes: file_exec_exec_service_proto_depIdxs,
 		EnumInfos:         file_exec_exec_service_proto_enumTypes,
+		MessageInfos:      file_exec_exec_service_proto_msgTypes,
 	}.Build()
 	File_exec_exec_service_proto = out.File
 	file_exec_exec_service_proto_rawDesc = nil
@@ -20,6 +20,11 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ExecServiceClient interface {
 	Exec(ctx context.Context, in *api.ExecReq, opts ...grpc.CallOption) (*api.ExecResp, error)
+	// ExecExt is the same as Exec, but with extensions of goma server.
+	ExecExt(ctx context.Context, in *ExecExtReq, opts ...grpc.CallOption) (*ExecExtResp, error)
+	// ExecStream is the same as ExecExt, but streams progress of execution
+	// before the final message that has ExecExtResp.
+	ExecStream(ctx context.Context, in *ExecExtReq, opts ...grpc.CallOption) (ExecService_ExecStreamClient, error)
 }
 
 type execServiceClient struct {
@@ -39,11 +44,57 @@ func (c *execServiceClient) Exec(ctx context.Context, in *api.ExecReq, opts ...g
 	return out, nil
 }
 
+func (c *execServiceClient) ExecExt(ctx context.Context, in *ExecExtReq, opts ...grpc.CallOption) (*ExecExtResp, error) {
+	out := new(ExecExtResp)
+	err := c.cc.Invoke(ctx, "/devtools_goma.ExecService/ExecExt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *execServiceClient) ExecStream(ctx context.Context, in *ExecExtReq, opts ...grpc.CallOption) (ExecService_ExecStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ExecService_ServiceDesc.Streams[0], "/devtools_goma.ExecService/ExecStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &execServiceExecStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ExecService_ExecStreamClient interface {
+	Recv() (*ExecProgress, error)
+	grpc.ClientStream
+}
+
+type execServiceExecStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *execServiceExecStreamClient) Recv() (*ExecProgress, error) {
+	m := new(ExecProgress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ExecServiceServer is the server API for ExecService service.
 // All implementations must embed UnimplementedExecServiceServer
 // for forward compatibility
 type ExecServiceServer interface {
 	Exec(context.Context, *api.ExecReq) (*api.ExecResp, error)
+	// ExecExt is the same as Exec, but with extensions of goma server.
+	ExecExt(context.Context, *ExecExtReq) (*ExecExtResp, error)
+	// ExecStream is the same as ExecExt, but streams progress of execution
+	// before the final message that has ExecExtResp.
+	ExecStream(*ExecExtReq, ExecService_ExecStreamServer) error
 	mustEmbedUnimplementedExecServiceServer()
 }
 
@@ -54,6 +105,12 @@ type UnimplementedExecServiceServer struct {
 func (UnimplementedExecServiceServer) Exec(context.Context, *api.ExecReq) (*api.ExecResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Exec not implemented")
 }
+func (UnimplementedExecServiceServer) ExecExt(context.Context, *ExecExtReq) (*ExecExtResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecExt not implemented")
+}
+func (UnimplementedExecServiceServer) ExecStream(*ExecExtReq, ExecService_ExecStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExecStream not implemented")
+}
 func (UnimplementedExecServiceServer) mustEmbedUnimplementedExecServiceServer() {}
 
 // UnsafeExecServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -85,6 +142,45 @@ func _ExecService_Exec_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ExecService_ExecExt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecExtReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecServiceServer).ExecExt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/devtools_goma.ExecService/ExecExt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecServiceServer).ExecExt(ctx, req.(*ExecExtReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExecService_ExecStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExecExtReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExecServiceServer).ExecStream(m, &execServiceExecStreamServer{stream})
+}
+
+type ExecService_ExecStreamServer interface {
+	Send(*ExecProgress) error
+	grpc.ServerStream
+}
+
+type execServiceExecStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *execServiceExecStreamServer) Send(m *ExecProgress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // ExecService_ServiceDesc is the grpc.ServiceDesc for ExecService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -96,7 +192,17 @@ var ExecService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Exec",
 			Handler:    _ExecService_Exec_Handler,
 		},
+		{
+			MethodName: "ExecExt",
+			Handler:    _ExecService_ExecExt_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExecStream",
+			Handler:       _ExecService_ExecStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "exec/exec_service.proto",
 }
@@ -21,6 +21,16 @@ const _ = grpc.SupportPackageIsVersion7
 type FileServiceClient interface {
 	StoreFile(ctx context.Context, in *api.StoreFileReq, opts ...grpc.CallOption) (*api.StoreFileResp, error)
 	LookupFile(ctx context.Context, in *api.LookupFileReq, opts ...grpc.CallOption) (*api.LookupFileResp, error)
+	// StoreFileStream stores a file larger than max message size.
+	// Each StoreFileReq has one FILE_CHUNK blob with file_size of the
+	// whole file, offset and content, in order of offset.
+	// It returns hash key of the whole file (FILE or FILE_META blob).
+	StoreFileStream(ctx context.Context, opts ...grpc.CallOption) (FileService_StoreFileStreamClient, error)
+	// LookupFileStream looks up a file by one hash key, and returns
+	// its content in chunks.
+	// Each LookupFileResp has one FILE_CHUNK blob with file_size of the
+	// whole file, offset and content, in order of offset.
+	LookupFileStream(ctx context.Context, in *api.LookupFileReq, opts ...grpc.CallOption) (FileService_LookupFileStreamClient, error)
 }
 
 type fileServiceClient struct {
@@ -49,12 +59,88 @@ func (c *fileServiceClient) LookupFile(ctx context.Context, in *api.LookupFileRe
 	return out, nil
 }
 
+func (c *fileServiceClient) StoreFileStream(ctx context.Context, opts ...grpc.CallOption) (FileService_StoreFileStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[0], "/devtools_goma.FileService/StoreFileStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileServiceStoreFileStreamClient{stream}
+	return x, nil
+}
+
+type FileService_StoreFileStreamClient interface {
+	Send(*api.StoreFileReq) error
+	CloseAndRecv() (*api.StoreFileResp, error)
+	grpc.ClientStream
+}
+
+type fileServiceStoreFileStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileServiceStoreFileStreamClient) Send(m *api.StoreFileReq) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *fileServiceStoreFileStreamClient) CloseAndRecv() (*api.StoreFileResp, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(api.StoreFileResp)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileServiceClient) LookupFileStream(ctx context.Context, in *api.LookupFileReq, opts ...grpc.CallOption) (FileService_LookupFileStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[1], "/devtools_goma.FileService/LookupFileStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileServiceLookupFileStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileService_LookupFileStreamClient interface {
+	Recv() (*api.LookupFileResp, error)
+	grpc.ClientStream
+}
+
+type fileServiceLookupFileStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileServiceLookupFileStreamClient) Recv() (*api.LookupFileResp, error) {
+	m := new(api.LookupFileResp)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // FileServiceServer is the server API for FileService service.
 // All implementations must embed UnimplementedFileServiceServer
 // for forward compatibility
 type FileServiceServer interface {
 	StoreFile(context.Context, *api.StoreFileReq) (*api.StoreFileResp, error)
 	LookupFile(context.Context, *api.LookupFileReq) (*api.LookupFileResp, error)
+	// StoreFileStream stores a file larger than max message size.
+	// Each StoreFileReq has one FILE_CHUNK blob with file_size of the
+	// whole file, offset and content, in order of offset.
+	// It returns hash key of the whole file (FILE or FILE_META blob).
+	StoreFileStream(FileService_StoreFileStreamServer) error
+	// LookupFileStream looks up a file by one hash key, and returns
+	// its content in chunks.
+	// Each LookupFileResp has one FILE_CHUNK blob with file_size of the
+	// whole file, offset and content, in order of offset.
+	LookupFileStream(*api.LookupFileReq, FileService_LookupFileStreamServer) error
 	mustEmbedUnimplementedFileServiceServer()
 }
 
@@ -68,6 +154,12 @@ func (UnimplementedFileServiceServer) StoreFile(context.Context, *api.StoreFileR
 func (UnimplementedFileServiceServer) LookupFile(context.Context, *api.LookupFileReq) (*api.LookupFileResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method LookupFile not implemented")
 }
+func (UnimplementedFileServiceServer) StoreFileStream(FileService_StoreFileStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method StoreFileStream not implemented")
+}
+func (UnimplementedFileServiceServer) LookupFileStream(*api.LookupFileReq, FileService_LookupFileStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method LookupFileStream not implemented")
+}
 func (UnimplementedFileServiceServer) mustEmbedUnimplementedFileServiceServer() {}
 
 // UnsafeFileServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -117,6 +209,53 @@ func _FileService_LookupFile_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FileService_StoreFileStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileServiceServer).StoreFileStream(&fileServiceStoreFileStreamServer{stream})
+}
+
+type FileService_StoreFileStreamServer interface {
+	SendAndClose(*api.StoreFileResp) error
+	Recv() (*api.StoreFileReq, error)
+	grpc.ServerStream
+}
+
+type fileServiceStoreFileStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileServiceStoreFileStreamServer) SendAndClose(m *api.StoreFileResp) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *fileServiceStoreFileStreamServer) Recv() (*api.StoreFileReq, error) {
+	m := new(api.StoreFileReq)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _FileService_LookupFileStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(api.LookupFileReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).LookupFileStream(m, &fileServiceLookupFileStreamServer{stream})
+}
+
+type FileService_LookupFileStreamServer interface {
+	Send(*api.LookupFileResp) error
+	grpc.ServerStream
+}
+
+type fileServiceLookupFileStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileServiceLookupFileStreamServer) Send(m *api.LookupFileResp) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // FileService_ServiceDesc is the grpc.ServiceDesc for FileService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -133,6 +272,17 @@ var FileService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _FileService_LookupFile_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StoreFileStream",
+			Handler:       _FileService_StoreFileStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "LookupFileStream",
+			Handler:       _FileService_LookupFileStream_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "file/file_service.proto",
 }
@@ -21,8 +21,10 @@ import (
 	"go.opencensus.io/stats"
 	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 
@@ -34,6 +36,7 @@ import (
 	fpb "go.chromium.org/goma/server/proto/file"
 	"go.chromium.org/goma/server/remoteexec/cas"
 	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/rpc"
 	"go.chromium.org/goma/server/server"
 )
 
@@ -42,6 +45,14 @@ type DigestCache interface {
 	Get(context.Context, string, digest.Source) (digest.Data, error)
 }
 
+// missingDigestCache is a DigestCache that also remembers blobs known
+// to be missing in CAS.
+type missingDigestCache interface {
+	KnownMissing(ctx context.Context, instance string, blobs []*rpb.Digest) (missing, unknown []*rpb.Digest)
+	SetMissing(instance string, blobs []*rpb.Digest)
+	ClearMissing(instance string, blobs []*rpb.Digest)
+}
+
 // SpanTimeout specifies Timeout for exec span.
 // 0 is no time out.
 type SpanTimeout struct {
@@ -79,22 +90,64 @@ type Adapter struct {
 	// If emtpy, use "default_instance".
 	InstanceBaseName string
 
+	// GroupInstances maps end user's group to RBE instance basename
+	// under InstancePrefix, so one adapter can serve multiple RBE
+	// instances. It takes precedence over basename in command config.
+	GroupInstances map[string]string
+
 	Inventory exec.Inventory
+	// VersionPolicy is a policy on goma client versions.
+	VersionPolicy exec.VersionPolicy
+	// Policy is an authorization policy of exec requests.
+	// nil allows all requests.
+	Policy exec.Policy
+	// PolicyFailClosed rejects requests if Policy fails to evaluate.
+	PolicyFailClosed bool
 	// ExecTimeout is timeout of Action in RBE.
 	ExecTimeout time.Duration
 	// SpanTimeout is timeout of each span in a Goma Exec request.
 	SpanTimeout SpanTimeout
+	// TimeoutPolicy overrides ExecTimeout and SpanTimeout per group
+	// or command class if set.
+	TimeoutPolicy *TimeoutPolicy
+	// MinDeadlineBudget is minimum remaining time of the client's
+	// deadline to start handling a request. If the client gave its
+	// timeout, span timeouts are fit in the remaining time, and
+	// requests with less remaining time are rejected with
+	// DeadlineExceeded. DefaultMinDeadlineBudget if zero.
+	MinDeadlineBudget time.Duration
+	// InputLimitPolicy limits number of inputs and total input size
+	// per request for each group if set.
+	InputLimitPolicy *InputLimitPolicy
+	// PriorityPolicy maps priority hint of requests to priority
+	// of execution and action cache entries per group if set.
+	PriorityPolicy *PriorityPolicy
+	// Scheduler limits concurrent exec requests per group if set.
+	Scheduler *Scheduler
 
 	// Client is remoteexec API client.
 	Client         Client
 	InsecureClient bool
 
+	// Router routes requests to multiple RBE backends, if set.
+	// Client is used if Router has no backends.
+	Router *Router
+
 	// GomaFile handles output files from remoteexec's cas to goma's FileBlob.
 	GomaFile fpb.FileServiceClient
 
 	// key: goma file hash.
 	DigestCache DigestCache
 
+	// FileMetaCache maps file metadata hints from clients to digests,
+	// if set.
+	FileMetaCache *FileMetaCache
+
+	// MissingContinuation remembers blobs verified to exist in CAS
+	// for requests failed with missing inputs, so that retries of
+	// the requests skip checking them again, if set.
+	MissingContinuation *MissingContinuation
+
 	// CmdStorage is a storage for command files.
 	CmdStorage CmdStorage
 
@@ -120,13 +173,62 @@ type Adapter struct {
 	// sha256 file hash to disable hardening.
 	DisableHardenings []string
 
+	// Journal records in-flight requests for crash recovery if set.
+	Journal *Journal
+
+	// OutputBackfill defers storing outputs in goma file service
+	// until clients look them up, if set.
+	OutputBackfill *OutputBackfill
+
+	// Attestor generates signed provenance attestations of outputs
+	// of remote execution, if set.
+	Attestor *Attestor
+
+	// LocalFallback executes actions locally when RBE is unavailable,
+	// if set.
+	LocalFallback *LocalExecutor
+
+	// Operations tracks in-flight RBE operations for debugging, if set.
+	Operations *Operations
+
+	// RequestLog keeps records of recent requests for debugging
+	// failures, if set.
+	RequestLog *RequestLog
+
+	// PCHPolicy is a policy for PCH/module outputs.
+	PCHPolicy PCHPolicy
+
+	// DigestFunction is preferred digest function.
+	// It is used if RBE backend advertises it in capabilities.
+	// UNKNOWN means SHA256.
+	DigestFunction rpb.DigestFunction_Value
+
 	// MissingInputLimit is the maximum number of missing inputs to list in
 	// a response. If there are more, the server randomly picks this many
 	// inputs to respond with. 0 indicates no limit.
 	MissingInputLimit int
 
+	// ExecutionPriority is priority of execution, used if RBE backend
+	// supports it. 0 means default priority.
+	ExecutionPriority int32
+
+	// CachePriority is priority of action cache entries, used if
+	// RBE backend supports it. 0 means default priority.
+	CachePriority int32
+
+	// DisableCompressedBlobs disables compressed bytestream transfers
+	// even if RBE backend supports zstd compression.
+	DisableCompressedBlobs bool
+
+	// NormalizeInputRoot maps client's input root dir to canonical dir
+	// in non relocatable requests, so that requests from different
+	// checkouts share action cache.
+	NormalizeInputRoot bool
+
 	capMu        sync.Mutex
 	capabilities *rpb.ServerCapabilities
+	capTime      time.Time
+	capErr       error
 }
 
 func (f *Adapter) withRequestMetadata(ctx context.Context, reqInfo *gomapb.RequesterInfo) (context.Context, error) {
@@ -197,12 +299,25 @@ func requesterInfo(ctx context.Context) *gomapb.RequesterInfo {
 }
 
 func (f *Adapter) client(ctx context.Context) Client {
+	return f.withCredentials(ctx, f.Client)
+}
+
+// backendClient returns client for backend b, or Client if b is nil.
+func (f *Adapter) backendClient(ctx context.Context, b *Backend) Client {
+	if b == nil {
+		return f.client(ctx)
+	}
+	return f.withCredentials(ctx, b.Client)
+}
+
+// withCredentials returns client that calls RPC with end user's
+// credentials in ctx.
+func (f *Adapter) withCredentials(ctx context.Context, client Client) Client {
 	// grpc rejects call on insecure connection if credential is set.
 	if f.InsecureClient {
-		return f.Client
+		return client
 	}
 	user, _ := enduser.FromContext(ctx)
-	client := f.Client
 	token := user.Token()
 	if token.AccessToken == "" {
 		return client
@@ -227,23 +342,45 @@ func (f *Adapter) Instance() string {
 	return path.Join(f.InstancePrefix, name)
 }
 
-func (f *Adapter) ensureCapabilities(ctx context.Context) {
-	f.capMu.Lock()
-	defer f.capMu.Unlock()
+// instanceName returns full RBE instance name for basename.
+// basename may be full instance name under InstancePrefix.
+func (f *Adapter) instanceName(basename string) string {
+	basename = strings.Trim(basename, "/")
+	if basename == "" {
+		return f.Instance()
+	}
+	if f.InstancePrefix != "" && strings.HasPrefix(basename, strings.Trim(f.InstancePrefix, "/")+"/") {
+		return basename
+	}
+	return path.Join(f.InstancePrefix, basename)
+}
 
-	if f.capabilities != nil {
-		return
+// ParseGroupInstances parses comma separated list of "group=basename"
+// for Adapter.GroupInstances.
+func ParseGroupInstances(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
 	}
-	logger := log.FromContext(ctx)
-	var err error
-	f.capabilities, err = f.client(ctx).GetCapabilities(ctx, &rpb.GetCapabilitiesRequest{
-		InstanceName: f.Instance(),
-	})
-	if err != nil {
-		logger.Errorf("GetCapabilities: %v", err)
-		return
+	m := make(map[string]string)
+	for _, v := range strings.Split(s, ",") {
+		i := strings.Index(v, "=")
+		if i <= 0 || i == len(v)-1 {
+			return nil, fmt.Errorf("bad group instance %q: want group=basename", v)
+		}
+		group, basename := v[:i], v[i+1:]
+		if _, ok := m[group]; ok {
+			return nil, fmt.Errorf("duplicate group %q", group)
+		}
+		m[group] = basename
+	}
+	return m, nil
+}
+
+func (f *Adapter) minDeadlineBudget() time.Duration {
+	if f.MinDeadlineBudget == 0 {
+		return DefaultMinDeadlineBudget
 	}
-	logger.Infof("serverCapabilities: %v", f.capabilities)
+	return f.MinDeadlineBudget
 }
 
 func (f *Adapter) newRequest(ctx context.Context, gomaReq *gomapb.ExecReq) *request {
@@ -254,19 +391,31 @@ func (f *Adapter) newRequest(ctx context.Context, gomaReq *gomapb.ExecReq) *requ
 		userGroup = endUser.Group
 	}
 	gs := digest.NewStore()
-	timeout := f.ExecTimeout
+	timeout, spanTimeout := f.TimeoutPolicy.Apply(userGroup, commandClass(gomaReq), f.ExecTimeout, f.SpanTimeout)
 	if timeout == 0 {
 		timeout = 600 * time.Second
 	}
-	client := f.client(ctx)
+	route := RouteRequest{
+		Group:   userGroup,
+		BuildID: gomaReq.GetRequesterInfo().GetBuildId(),
+		Cwd:     gomaReq.GetCwd(),
+	}
+	backend := f.Router.Pick(route)
+	client := f.backendClient(ctx, backend)
 	r := &request{
-		f:         f,
-		userGroup: userGroup,
-		client:    client,
+		f:           f,
+		userGroup:   userGroup,
+		spanTimeout: spanTimeout,
+		inputLimit:  f.InputLimitPolicy.Limit(userGroup),
+		priority:    f.PriorityPolicy.Priority(userGroup, execExtFromContext(ctx).GetPriority()),
+		route:       route,
+		backend:     backend,
+		client:      client,
 		cas: &cas.CAS{
 			Client:            client,
 			Store:             gs,
 			CacheCapabilities: f.capabilities.GetCacheCapabilities(),
+			Compressor:        f.compressor(),
 		},
 		gomaReq: gomaReq,
 		gomaResp: &gomapb.ExecResp{
@@ -276,16 +425,19 @@ func (f *Adapter) newRequest(ctx context.Context, gomaReq *gomapb.ExecReq) *requ
 		},
 		digestStore: gs,
 		input: &gomaInput{
-			gomaFile:    f.GomaFile,
-			sema:        f.FileLookupSema,
-			digestCache: f.DigestCache,
+			gomaFile:      f.GomaFile,
+			sema:          f.FileLookupSema,
+			digestCache:   f.DigestCache,
+			fileMetaCache: f.FileMetaCache,
+			client:        clientID(endUser, gomaReq.GetRequesterInfo()),
+			inputMeta:     inputMetaMap(execExtFromContext(ctx)),
 		},
 		action: &rpb.Action{
 			Timeout:    durationpb.New(timeout),
 			DoNotCache: doNotCache(gomaReq),
 		},
 	}
-	logger.Infof("%s: new request group:%q", r.ID(), userGroup)
+	logger.Infof("%s: new request group:%q timeout:%s", r.ID(), userGroup, timeout)
 	return r
 }
 
@@ -298,6 +450,7 @@ type execSpan struct {
 }
 
 var spanMeasures = map[string]*stats.Float64Measure{
+	"schedule":      execScheduleTime,
 	"inventory":     execInventoryTime,
 	"input tree":    execInputTreeTime,
 	"setup":         execSetupTime,
@@ -336,6 +489,46 @@ func (s *execSpan) Do(ctx context.Context, desc string, d time.Duration, f func(
 	return duration
 }
 
+// execute executes r's action in RBE.
+// It returns non-nil ExecResp if it fails fast for missing inputs.
+func (f *Adapter) execute(ctx context.Context, espan *execSpan, r *request) (*rpb.ExecuteResponse, *gomapb.ExecResp, error) {
+	logger := log.FromContext(ctx)
+	var blobs []*rpb.Digest
+	var err error
+	espan.Do(ctx, "check missing", r.spanTimeout.CheckMissing, func(ctx context.Context) {
+		blobs, err = r.missingBlobs(ctx)
+	})
+	if err != nil {
+		logger.Errorf("exec call: error in check missing blobs: %v", err)
+		return nil, nil, err
+	}
+
+	var resp *gomapb.ExecResp
+	espan.Do(ctx, "upload blobs", r.spanTimeout.UploadBlobs, func(ctx context.Context) {
+		resp, err = r.uploadBlobs(ctx, blobs)
+	})
+	if err != nil {
+		logger.Errorf("exec call: error in upload blobs: %v", err)
+		return nil, nil, err
+	}
+	if resp != nil {
+		logger.Infof("fail fast for uploading missing blobs: %v", resp)
+		f.MissingContinuation.save(r.instanceName(), r.actionDigest, r.verified)
+		return nil, resp, nil
+	}
+	f.MissingContinuation.done(r.instanceName(), r.actionDigest)
+
+	var eresp *rpb.ExecuteResponse
+	espan.Do(ctx, "execute", r.spanTimeout.Execute, func(ctx context.Context) {
+		eresp, err = r.executeAction(ctx)
+	})
+	if err != nil {
+		logger.Errorf("exec call: execute err=%v", err)
+		return nil, nil, err
+	}
+	return eresp, nil, nil
+}
+
 // Exec handles goma Exec requests with remoteexec backend.
 //
 //  1. compute input tree and Action.
@@ -372,21 +565,67 @@ func (f *Adapter) Exec(ctx context.Context, req *gomapb.ExecReq) (resp *gomapb.E
 	if err != nil {
 		logger.Errorf("failed to record stats: %v", err)
 	}
+	if resp := f.VersionPolicy.Check(ctx, req); resp != nil {
+		return resp, nil
+	}
+	if resp := exec.Authorize(ctx, f.Policy, f.PolicyFailClosed, req); resp != nil {
+		return resp, nil
+	}
+	defer func() {
+		if err != nil {
+			return
+		}
+		f.VersionPolicy.Annotate(ctx, req, resp)
+	}()
 
 	// Use this to collect all timestamps and then print on one line,
 	// regardless of where this function returns.
 	espan := &execSpan{t0: time.Now()}
+	defer func() {
+		f.RequestLog.record(espan, resp, err)
+	}()
 	defer espan.Close(ctx)
 
 	adjustExecReq(req)
 	ctx = f.outgoingContext(ctx, req.GetRequesterInfo())
 	f.ensureCapabilities(ctx)
 
+	deadline, hasDeadline := rpc.ClientDeadline(ctx)
+	if hasDeadline {
+		if remaining, minBudget := time.Until(deadline), f.minDeadlineBudget(); remaining < minBudget {
+			logger.Warnf("insufficient deadline budget: %s < %s", remaining, minBudget)
+			return nil, status.Errorf(codes.DeadlineExceeded, "insufficient deadline budget: %s < %s", remaining, minBudget)
+		}
+	}
+
 	r := f.newRequest(ctx, req)
 	defer r.Close()
 	espan.req = r
+	if hasDeadline {
+		r.spanTimeout = r.spanTimeout.budget(time.Until(deadline))
+		logger.Infof("span timeout in client deadline budget: %+v", r.spanTimeout)
+	}
+	if msg := r.inputLimit.checkInputs(r.userGroup, len(req.Input)); msg != "" {
+		logger.Warnf("bad input: %s", msg)
+		r.gomaResp.Error = gomapb.ExecResp_BAD_REQUEST.Enum()
+		r.gomaResp.ErrorMessage = append(r.gomaResp.ErrorMessage, msg)
+		return r.gomaResp, nil
+	}
+	var release func()
+	var serr error
+	dur := espan.Do(ctx, "schedule", 0, func(ctx context.Context) {
+		release, serr = f.Scheduler.Acquire(ctx, r.userGroup)
+	})
+	if serr != nil {
+		logger.Warnf("schedule %s: %v in %s", r.userGroup, serr, dur)
+		return nil, serr
+	}
+	defer release()
+	defer server.LoadStart(ctx, server.LoadExec)()
+	r.journal = f.Journal.Begin(ctx, r.ID())
+	defer r.journal.Done(ctx)
 
-	dur := espan.Do(ctx, "inventory", f.SpanTimeout.Inventory, func(ctx context.Context) {
+	dur = espan.Do(ctx, "inventory", r.spanTimeout.Inventory, func(ctx context.Context) {
 		resp = r.getInventoryData(ctx)
 	})
 	if resp != nil {
@@ -394,7 +633,7 @@ func (f *Adapter) Exec(ctx context.Context, req *gomapb.ExecReq) (resp *gomapb.E
 		return resp, nil
 	}
 
-	dur = espan.Do(ctx, "input tree", f.SpanTimeout.InputTree, func(ctx context.Context) {
+	dur = espan.Do(ctx, "input tree", r.spanTimeout.InputTree, func(ctx context.Context) {
 		resp = r.newInputTree(ctx)
 	})
 	if resp != nil {
@@ -402,47 +641,48 @@ func (f *Adapter) Exec(ctx context.Context, req *gomapb.ExecReq) (resp *gomapb.E
 		return resp, nil
 	}
 
-	espan.Do(ctx, "setup", f.SpanTimeout.Setup, func(ctx context.Context) {
+	espan.Do(ctx, "setup", r.spanTimeout.Setup, func(ctx context.Context) {
 		r.setupNewAction(ctx)
 	})
+	r.journal.Update(ctx, func(e *JournalEntry) {
+		e.Phase = journalSetup
+		e.Instance = r.instanceName()
+		e.ActionDigest = fmt.Sprintf("%s/%d", r.actionDigest.GetHash(), r.actionDigest.GetSizeBytes())
+	})
 
 	eresp := &rpb.ExecuteResponse{}
 	var cached bool
-	espan.Do(ctx, "check cache", f.SpanTimeout.CheckCache, func(ctx context.Context) {
+	espan.Do(ctx, "check cache", r.spanTimeout.CheckCache, func(ctx context.Context) {
 		eresp.Result, cached = r.checkCache(ctx)
 	})
 	if !cached {
-		var blobs []*rpb.Digest
-		var err error
-		espan.Do(ctx, "check missing", f.SpanTimeout.CheckMissing, func(ctx context.Context) {
-			blobs, err = r.missingBlobs(ctx)
-		})
-		if err != nil {
-			logger.Errorf("exec call: error in check missing blobs: %v", err)
-			return nil, err
+		eresp, resp, err = f.execute(ctx, espan, r)
+		if b := f.Router.Failover(ctx, r.route, r.backend, err); b != nil {
+			f.Router.Report(ctx, r.backend, err)
+			r.setBackend(ctx, b)
+			eresp, resp, err = f.execute(ctx, espan, r)
+		}
+		f.Router.Report(ctx, r.backend, err)
+		if err != nil && f.LocalFallback.fallbackable(ctx, r) {
+			logger.Warnf("exec call: execute locally for %v", err)
+			var lerr error
+			espan.Do(ctx, "local execute", 0, func(ctx context.Context) {
+				eresp, lerr = f.LocalFallback.run(ctx, r)
+			})
+			if lerr != nil {
+				logger.Errorf("exec call: local execute err=%v", lerr)
+			} else {
+				err = nil
+			}
 		}
-
-		espan.Do(ctx, "upload blobs", f.SpanTimeout.UploadBlobs, func(ctx context.Context) {
-			resp, err = r.uploadBlobs(ctx, blobs)
-		})
 		if err != nil {
-			logger.Errorf("exec call: error in upload blobs: %v", err)
 			return nil, err
 		}
 		if resp != nil {
-			logger.Infof("fail fast for uploading missing blobs: %v", resp)
 			return resp, nil
 		}
-
-		espan.Do(ctx, "execute", f.SpanTimeout.Execute, func(ctx context.Context) {
-			eresp, err = r.executeAction(ctx)
-		})
-		if err != nil {
-			logger.Errorf("exec call: execute err=%v", err)
-			return nil, err
-		}
 	}
-	espan.Do(ctx, "response", f.SpanTimeout.Response, func(ctx context.Context) {
+	espan.Do(ctx, "response", r.spanTimeout.Response, func(ctx context.Context) {
 		resp, err = r.newResp(ctx, eresp, cached)
 	})
 	if err != nil {
@@ -625,6 +625,86 @@ func TestAdapterHandleOutputs(t *testing.T) {
 	}
 }
 
+func TestAdapterCancelOperation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cluster := &fakeCluster{
+		rbe: newFakeRBE(),
+	}
+	err := cluster.setup(ctx, cluster.rbe.instancePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.teardown()
+
+	clang := newFakeClang(&cluster.cmdStorage, "1234", "x86-64-linux-gnu")
+
+	err = cluster.pushToolchains(ctx, clang)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var localFiles fakeLocalFiles
+	localFiles.Add("/b/c/w/src/hello.cc", randomSize())
+
+	started := make(chan struct{}, 1)
+	cluster.rbe.fakeExec = func(ctx context.Context, req *rpb.ExecuteRequest) (*rpb.ExecuteResponse, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	req := &gomapb.ExecReq{
+		CommandSpec: clang.CommandSpec("clang", "bin/clang"),
+		Arg: []string{
+			"bin/clang", "-c", "../../src/hello.cc",
+		},
+		Env: []string{},
+		Cwd: proto.String("/b/c/w/out/Release"),
+		Input: []*gomapb.ExecReq_Input{
+			localFiles.mustInput(ctx, t, cluster.adapter.GomaFile, "/b/c/w/src/hello.cc", "../../src/hello.cc"),
+		},
+		Subprogram:          []*gomapb.SubprogramSpec{},
+		RequesterInfo:       &gomapb.RequesterInfo{},
+		HermeticMode:        proto.Bool(true),
+		ExpectedOutputFiles: []string{"hello.o"},
+	}
+
+	// to know when adapter received operation name.
+	cluster.adapter.Operations = &Operations{}
+
+	execCtx, execCancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cluster.adapter.Exec(execCtx, req)
+	}()
+	select {
+	case <-started:
+	case <-ctx.Done():
+		t.Fatalf("execution not started: %v", ctx.Err())
+	}
+	// operation name is sent before execution, but adapter might not
+	// have received it yet.
+	for len(cluster.adapter.Operations.List()) == 0 {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatalf("operation not started: %v", ctx.Err())
+		}
+	}
+	execCancel()
+	<-done
+
+	if got := cluster.rbe.ops.Canceled(); len(got) != 1 {
+		t.Errorf("canceled operations=%q; want 1 operation", got)
+	}
+}
+
 func TestAdapterHandleOutputsWithoutExpectedOutputs(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -1372,3 +1452,75 @@ func TestAdapterNsjailHardening(t *testing.T) {
 		t.Errorf("platform.Properties diff want->got\n%s", diff)
 	}
 }
+
+func TestRequestInstanceName(t *testing.T) {
+	f := &Adapter{
+		InstancePrefix:   "projects/p/instances",
+		InstanceBaseName: "default_instance",
+		GroupInstances: map[string]string{
+			"chrome-bot": "ci_instance",
+		},
+	}
+	for _, tc := range []struct {
+		group    string
+		basename string
+		want     string
+	}{
+		{
+			group: "user",
+			want:  "projects/p/instances/default_instance",
+		},
+		{
+			group:    "user",
+			basename: "windows",
+			want:     "projects/p/instances/windows",
+		},
+		{
+			group:    "user",
+			basename: "projects/p/instances/windows",
+			want:     "projects/p/instances/windows",
+		},
+		{
+			group:    "chrome-bot",
+			basename: "windows",
+			want:     "projects/p/instances/ci_instance",
+		},
+	} {
+		r := &request{
+			f:         f,
+			userGroup: tc.group,
+			cmdConfig: &cmdpb.Config{
+				RemoteexecPlatform: &cmdpb.RemoteexecPlatform{
+					RbeInstanceBasename: tc.basename,
+				},
+			},
+		}
+		if got := r.instanceName(); got != tc.want {
+			t.Errorf("instanceName() group=%q basename=%q: %q; want %q", tc.group, tc.basename, got, tc.want)
+		}
+	}
+}
+
+func TestParseGroupInstances(t *testing.T) {
+	got, err := ParseGroupInstances("chrome-bot=ci_instance,dev=dev_instance")
+	if err != nil {
+		t.Fatalf("ParseGroupInstances(...)=_, %v; want nil error", err)
+	}
+	want := map[string]string{
+		"chrome-bot": "ci_instance",
+		"dev":        "dev_instance",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseGroupInstances(...) diff -want +got:\n%s", diff)
+	}
+	got, err = ParseGroupInstances("")
+	if err != nil || got != nil {
+		t.Errorf(`ParseGroupInstances("")=%v, %v; want nil, nil`, got, err)
+	}
+	for _, s := range []string{"chrome-bot", "=ci", "chrome-bot=", "a=b,a=c"} {
+		_, err := ParseGroupInstances(s)
+		if err == nil {
+			t.Errorf("ParseGroupInstances(%q)=_, nil; want error", s)
+		}
+	}
+}
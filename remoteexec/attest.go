@@ -0,0 +1,116 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+
+	cachepb "go.chromium.org/goma/server/proto/cache"
+	"go.chromium.org/goma/server/remoteexec/cas"
+	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/remoteexec/provenance"
+)
+
+// key prefix of provenance attestation.
+const attestKeyPrefix = "provenance/"
+
+// Attestor generates signed SLSA provenance attestations for outputs
+// of remote execution, and stores them in Cache.
+// Attestation is stored as DSSE envelope in JSON keyed by
+// "provenance/<digest hash of output>", so it is found next to the
+// output by its hash key.
+type Attestor struct {
+	Cache cachepb.CacheServiceClient
+
+	Signer *provenance.Signer
+
+	// BuilderID is id of builder in provenance, e.g.
+	// URI of the goma server.
+	BuilderID string
+}
+
+// digestAlgorithm returns algorithm name of current digest function
+// used in in-toto digest set.
+func digestAlgorithm() string {
+	return strings.ToLower(digest.Function().String())
+}
+
+// Attest signs provenance statement about outputs with predicate,
+// and stores it for each output.
+func (a *Attestor) Attest(ctx context.Context, outputs []provenance.Subject, predicate provenance.Predicate) error {
+	if a == nil || len(outputs) == 0 {
+		return nil
+	}
+	predicate.Builder.ID = a.BuilderID
+	env, err := a.Signer.Sign(provenance.NewStatement(outputs, predicate))
+	if err != nil {
+		return fmt.Errorf("sign provenance: %v", err)
+	}
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	algo := digestAlgorithm()
+	for _, s := range outputs {
+		_, err = a.Cache.Put(ctx, &cachepb.PutReq{
+			Kv: &cachepb.KV{
+				Key:   attestKeyPrefix + s.Digest[algo],
+				Value: b,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("store provenance of %s: %v", s.Name, err)
+		}
+	}
+	stats.Record(ctx, provenanceAttested.M(int64(len(outputs))))
+	return nil
+}
+
+// Lookup returns provenance attestation of output whose digest hash
+// is hashKey.
+func (a *Attestor) Lookup(ctx context.Context, hashKey string) (*provenance.Envelope, error) {
+	resp, err := a.Cache.Get(ctx, &cachepb.GetReq{
+		Key: attestKeyPrefix + hashKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	env := &provenance.Envelope{}
+	err = json.Unmarshal(resp.GetKv().GetValue(), env)
+	if err != nil {
+		return nil, fmt.Errorf("provenance of %s: %v", hashKey, err)
+	}
+	return env, nil
+}
+
+// provenanceMaterial returns material of blob of digest d in instance.
+func provenanceMaterial(instance string, d *rpb.Digest) provenance.Material {
+	return provenance.Material{
+		URI: cas.ResName(instance, d),
+		Digest: provenance.DigestSet{
+			digestAlgorithm(): d.GetHash(),
+		},
+	}
+}
+
+// imageMaterial returns material of container image, e.g.
+// "docker://gcr.io/foo/bar@sha256:<hex>".
+func imageMaterial(image string) provenance.Material {
+	m := provenance.Material{
+		URI: image,
+	}
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		if algo := strings.SplitN(image[i+1:], ":", 2); len(algo) == 2 {
+			m.Digest = provenance.DigestSet{algo[0]: algo[1]}
+		}
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+
+	"go.chromium.org/goma/server/cache"
+	"go.chromium.org/goma/server/remoteexec/provenance"
+)
+
+func TestAttestor(t *testing.T) {
+	ctx := context.Background()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(cache.Config{
+		MaxBytes: 1 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Attestor{
+		Cache: cache.LocalClient{
+			CacheServiceServer: c,
+		},
+		Signer: &provenance.Signer{
+			KeyID: "key-1",
+			Key:   key,
+		},
+		BuilderID: "https://goma.example.com/remoteexec",
+	}
+	outputs := []provenance.Subject{
+		{
+			Name:   "out/foo.o",
+			Digest: provenance.DigestSet{"sha256": "1234"},
+		},
+		{
+			Name:   "out/foo.d",
+			Digest: provenance.DigestSet{"sha256": "5678"},
+		},
+	}
+	predicate := provenance.Predicate{
+		Materials: []provenance.Material{
+			provenanceMaterial("projects/p/instances/default_instance", &rpb.Digest{Hash: "abcd", SizeBytes: 10}),
+			imageMaterial("docker://gcr.io/foo/bar@sha256:ef01"),
+		},
+	}
+	err = a.Attest(ctx, outputs, predicate)
+	if err != nil {
+		t.Fatalf("Attest=%v; want nil error", err)
+	}
+
+	want := provenance.NewStatement(outputs, provenance.Predicate{
+		Builder: provenance.Builder{
+			ID: "https://goma.example.com/remoteexec",
+		},
+		Materials: []provenance.Material{
+			{
+				URI:    "projects/p/instances/default_instance/blobs/abcd/10",
+				Digest: provenance.DigestSet{"sha256": "abcd"},
+			},
+			{
+				URI:    "docker://gcr.io/foo/bar@sha256:ef01",
+				Digest: provenance.DigestSet{"sha256": "ef01"},
+			},
+		},
+	})
+	for _, hashKey := range []string{"1234", "5678"} {
+		env, err := a.Lookup(ctx, hashKey)
+		if err != nil {
+			t.Fatalf("Lookup(%s)=_, %v; want nil error", hashKey, err)
+		}
+		got, err := provenance.Verify(env, pub)
+		if err != nil {
+			t.Fatalf("Verify(%s)=_, %v; want nil error", hashKey, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("statement of %s diff -want +got:\n%s", hashKey, diff)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/file"
+	"go.chromium.org/goma/server/hash"
+	"go.chromium.org/goma/server/log"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	cachepb "go.chromium.org/goma/server/proto/cache"
+	"go.chromium.org/goma/server/remoteexec/cas"
+	"go.chromium.org/goma/server/remoteexec/digest"
+)
+
+const (
+	// DefaultBackfillConcurrency is default concurrency of CAS downloads
+	// in OutputBackfill.
+	DefaultBackfillConcurrency = 16
+
+	// key prefix of backfill record.
+	backfillKeyPrefix = "backfill/"
+
+	// key prefix of backfill record for PCH/module outputs.
+	// they are recorded separately so cache backend can manage
+	// them (e.g. expire early) apart from other outputs.
+	pchBackfillKeyPrefix = "backfill-pch/"
+)
+
+// OutputBackfill defers conversion of remote outputs to goma file blobs
+// until clients look them up.
+//
+// Output file whose size is in [MinSize, file.LargeFileThreshold] is
+// returned to client as FILE_REF blob, whose hash key is SHA-256 of its
+// content, without downloading it from CAS. The CAS resource name is
+// recorded in Cache, and the goma file service fetches the content from
+// CAS on first LookupFile miss of the hash key (see file.Backfiller).
+//
+// Cache must be the cache used by the goma file service.
+type OutputBackfill struct {
+	Cache cachepb.CacheServiceClient
+
+	// Client is used to read blobs from CAS.
+	Client Client
+
+	// MinSize is minimum size of output to backfill.
+	// smaller outputs are embedded in response.
+	MinSize int64
+
+	// Concurrency is number of concurrent CAS downloads.
+	// 0 means DefaultBackfillConcurrency.
+	Concurrency int
+
+	initOnce sync.Once
+	sema     chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*backfillCall
+}
+
+// backfillCall is an in-flight backfill for a hash key.
+type backfillCall struct {
+	done chan struct{}
+	blob *gomapb.FileBlob
+	err  error
+}
+
+func (b *OutputBackfill) init() {
+	b.initOnce.Do(func() {
+		concurrency := b.Concurrency
+		if concurrency <= 0 {
+			concurrency = DefaultBackfillConcurrency
+		}
+		b.sema = make(chan struct{}, concurrency)
+		b.inflight = make(map[string]*backfillCall)
+	})
+}
+
+// lazy reports whether output of digest d should be backfilled.
+func (b *OutputBackfill) lazy(d *rpb.Digest) bool {
+	if b == nil {
+		return false
+	}
+	// backfilled blob is keyed by SHA-256 of the content.
+	if digest.Function() != rpb.DigestFunction_SHA256 {
+		return false
+	}
+	return d.GetSizeBytes() >= b.MinSize && d.GetSizeBytes() <= file.LargeFileThreshold
+}
+
+// register records output of digest d in instance, and returns
+// FILE_REF blob for it.
+// keyPrefix is prefix of backfill record key.
+func (b *OutputBackfill) register(ctx context.Context, instance, keyPrefix string, d *rpb.Digest) (*gomapb.FileBlob, error) {
+	_, err := b.Cache.Put(ctx, &cachepb.PutReq{
+		Kv: &cachepb.KV{
+			Key:   keyPrefix + d.Hash,
+			Value: []byte(cas.ResName(instance, d)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Record(ctx, backfillRegistered.M(1))
+	return &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE_REF.Enum(),
+		FileSize: proto.Int64(d.SizeBytes),
+		HashKey:  []string{d.Hash},
+	}, nil
+}
+
+// Backfill fetches FILE blob for hashKey from CAS.
+// It returns error with codes.NotFound if hashKey is not registered.
+// Concurrent calls for the same hashKey share one CAS download.
+func (b *OutputBackfill) Backfill(ctx context.Context, hashKey string) (*gomapb.FileBlob, error) {
+	b.init()
+	b.mu.Lock()
+	c, ok := b.inflight[hashKey]
+	if !ok {
+		c = &backfillCall{
+			done: make(chan struct{}),
+		}
+		b.inflight[hashKey] = c
+	}
+	b.mu.Unlock()
+	if ok {
+		select {
+		case <-c.done:
+			return c.blob, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	c.blob, c.err = b.backfill(ctx, hashKey)
+	b.mu.Lock()
+	delete(b.inflight, hashKey)
+	b.mu.Unlock()
+	close(c.done)
+	return c.blob, c.err
+}
+
+func (b *OutputBackfill) backfill(ctx context.Context, hashKey string) (*gomapb.FileBlob, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/remoteexec.OutputBackfill.Backfill")
+	defer span.End()
+	logger := log.FromContext(ctx)
+	start := time.Now()
+
+	resp, err := b.Cache.Get(ctx, &cachepb.GetReq{
+		Key: backfillKeyPrefix + hashKey,
+	})
+	if status.Code(err) == codes.NotFound {
+		resp, err = b.Cache.Get(ctx, &cachepb.GetReq{
+			Key: pchBackfillKeyPrefix + hashKey,
+		})
+	}
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			recordBackfill(ctx, "error")
+		}
+		return nil, err
+	}
+	resname := string(resp.GetKv().GetValue())
+	d, err := cas.ParseResName(resname)
+	if err != nil {
+		recordBackfill(ctx, "error")
+		return nil, status.Errorf(codes.Internal, "backfill %s: %v", hashKey, err)
+	}
+
+	select {
+	case b.sema <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-b.sema }()
+
+	var buf bytes.Buffer
+	err = retryCAS(ctx, outputTimeout(d.SizeBytes), func(ctx context.Context) error {
+		buf.Reset()
+		_, err := cas.Download(ctx, b.Client.ByteStream(), &buf, resname)
+		return err
+	})
+	if err != nil {
+		logger.Warnf("backfill %s from %s: %v", hashKey, resname, err)
+		recordBackfill(ctx, "error")
+		return nil, err
+	}
+	if h := hash.SHA256Content(buf.Bytes()); h != hashKey {
+		recordBackfill(ctx, "error")
+		return nil, status.Errorf(codes.DataLoss, "backfill %s from %s: hash mismatch %s", hashKey, resname, h)
+	}
+	logger.Infof("backfill %s from %s: %s", hashKey, resname, time.Since(start))
+	recordBackfill(ctx, "ok")
+	return &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE.Enum(),
+		Content:  buf.Bytes(),
+		FileSize: proto.Int64(d.SizeBytes),
+	}, nil
+}
+
+func recordBackfill(ctx context.Context, result string) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(backfillResultKey, result),
+	}, backfillFetches.M(1))
+}
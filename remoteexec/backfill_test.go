@@ -0,0 +1,98 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestOutputBackfill(t *testing.T) {
+	ctx := context.Background()
+
+	cluster := &fakeCluster{
+		rbe: newFakeRBE(),
+	}
+	err := cluster.setup(ctx, cluster.rbe.instancePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.teardown()
+
+	small := makeFileNode("a")
+	f := makeFileNode("backfilled-output")
+	cluster.rbe.cas.Set(small.data)
+	cluster.rbe.cas.Set(f.data)
+
+	b := &OutputBackfill{
+		Cache:   cluster.gomafile.Cache,
+		Client:  cluster.adapter.Client,
+		MinSize: 2,
+	}
+	cluster.gomafile.Backfiller = b
+	gout := gomaOutput{
+		bs:       cluster.adapter.Client,
+		instance: path.Join(cluster.rbe.instancePrefix, "default_instance"),
+		gomaFile: cluster.adapter.GomaFile,
+		backfill: b,
+	}
+
+	blob, err := gout.toFileBlob(ctx, &rpb.OutputFile{
+		Path:   small.name,
+		Digest: small.node.Digest,
+	})
+	if err != nil {
+		t.Fatalf("toFileBlob(%s)=_, %v; want nil error", small.name, err)
+	}
+	if diff := cmp.Diff(makeFileBlob(small.name), blob, cmp.Comparer(proto.Equal)); diff != "" {
+		t.Errorf("toFileBlob(%s) diff -want +got:\n%s", small.name, diff)
+	}
+
+	blob, err = gout.toFileBlob(ctx, &rpb.OutputFile{
+		Path:   f.name,
+		Digest: f.node.Digest,
+	})
+	if err != nil {
+		t.Fatalf("toFileBlob(%s)=_, %v; want nil error", f.name, err)
+	}
+	wantRef := &gomapb.FileBlob{
+		BlobType: gomapb.FileBlob_FILE_REF.Enum(),
+		FileSize: proto.Int64(int64(len(f.name))),
+		HashKey:  []string{f.node.Digest.Hash},
+	}
+	if diff := cmp.Diff(wantRef, blob, cmp.Comparer(proto.Equal)); diff != "" {
+		t.Errorf("toFileBlob(%s) diff -want +got:\n%s", f.name, diff)
+	}
+
+	// first lookup backfills from CAS, and second lookup hits cache.
+	for i := 0; i < 2; i++ {
+		resp, err := cluster.adapter.GomaFile.LookupFile(ctx, &gomapb.LookupFileReq{
+			HashKey: blob.HashKey,
+		})
+		if err != nil {
+			t.Fatalf("%d: LookupFile(%q)=_, %v; want nil error", i, blob.HashKey, err)
+		}
+		if diff := cmp.Diff([]*gomapb.FileBlob{makeFileBlob(f.name)}, resp.Blob, cmp.Comparer(proto.Equal)); diff != "" {
+			t.Errorf("%d: LookupFile(%q) diff -want +got:\n%s", i, blob.HashKey, diff)
+		}
+	}
+
+	resp, err := cluster.adapter.GomaFile.LookupFile(ctx, &gomapb.LookupFileReq{
+		HashKey: []string{small.node.Digest.Hash},
+	})
+	if err != nil {
+		t.Fatalf("LookupFile(%q)=_, %v; want nil error", small.node.Digest.Hash, err)
+	}
+	if got, want := resp.Blob[0].GetBlobType(), gomapb.FileBlob_FILE_UNSPECIFIED; got != want {
+		t.Errorf("LookupFile(%q).Blob[0].BlobType=%v; want %v for unregistered key", small.node.Digest.Hash, got, want)
+	}
+}
@@ -11,7 +11,8 @@ import (
 
 	"github.com/google/uuid"
 	"go.opencensus.io/trace"
-	pb "google.golang.org/genproto/googleapis/bytestream"
+	bpb "google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
 )
 
 // ByteStream is a proxy that reads/writes data to/from a server, as defined in
@@ -26,14 +27,14 @@ type ByteStream struct {
 }
 
 // Read proxies bytestream Read stream.
-func (bs *ByteStream) Read(req *pb.ReadRequest, s pb.ByteStream_ReadServer) error {
+func (bs *ByteStream) Read(req *bpb.ReadRequest, s bpb.ByteStream_ReadServer) error {
 	ctx := s.Context()
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/remoteexec.Adapter.Read")
 	defer span.End()
 
 	ctx = bs.Adapter.outgoingContext(ctx, nil)
 
-	rd, err := bs.Adapter.client(ctx).ByteStream().Read(ctx, &pb.ReadRequest{
+	rd, err := bs.Adapter.ByteStream().Read(ctx, &bpb.ReadRequest{
 		ResourceName: path.Join(bs.InstanceName, req.ResourceName),
 		ReadOffset:   req.ReadOffset,
 		ReadLimit:    req.ReadLimit,
@@ -58,14 +59,14 @@ func (bs *ByteStream) Read(req *pb.ReadRequest, s pb.ByteStream_ReadServer) erro
 }
 
 // Write proxies bytestream Write stream.
-func (bs *ByteStream) Write(s pb.ByteStream_WriteServer) error {
+func (bs *ByteStream) Write(s bpb.ByteStream_WriteServer) error {
 	ctx := s.Context()
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/remoteexec.Adapter.Write")
 	defer span.End()
 
 	ctx = bs.Adapter.outgoingContext(ctx, nil)
 	uuid := uuid.New()
-	wr, err := bs.Adapter.client(ctx).ByteStream().Write(ctx)
+	wr, err := bs.Adapter.ByteStream().Write(ctx)
 	if err != nil {
 		return err
 	}
@@ -78,7 +79,7 @@ func (bs *ByteStream) Write(s pb.ByteStream_WriteServer) error {
 			wr.CloseAndRecv()
 			return nil
 		}
-		err = wr.Send(&pb.WriteRequest{
+		err = wr.Send(&bpb.WriteRequest{
 			ResourceName: path.Join(bs.InstanceName, "uploads", uuid.String(), req.ResourceName),
 			WriteOffset:  req.WriteOffset,
 			FinishWrite:  req.FinishWrite,
@@ -96,14 +97,37 @@ func (bs *ByteStream) Write(s pb.ByteStream_WriteServer) error {
 	return s.SendAndClose(resp)
 }
 
-// Write proxies bytestream QueryWriteStatus call.
-func (bs *ByteStream) QueryWriteStatus(ctx context.Context, req *pb.QueryWriteStatusRequest) (*pb.QueryWriteStatusResponse, error) {
+// QueryWriteStatus proxies bytestream QueryWriteStatus call.
+func (bs *ByteStream) QueryWriteStatus(ctx context.Context, req *bpb.QueryWriteStatusRequest) (*bpb.QueryWriteStatusResponse, error) {
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/remoteexec.Adapter.QueryWriteStatus")
 	defer span.End()
 
 	ctx = bs.Adapter.outgoingContext(ctx, nil)
 
-	return bs.Adapter.client(ctx).ByteStream().QueryWriteStatus(ctx, &pb.QueryWriteStatusRequest{
+	return bs.Adapter.ByteStream().QueryWriteStatus(ctx, &bpb.QueryWriteStatusRequest{
 		ResourceName: path.Join(bs.InstanceName, req.ResourceName),
 	})
 }
+
+// ByteStream returns bytestream client of RBE CAS, which calls
+// with end user's credentials in context, as Exec does.
+// Resource names should be full names including RBE instance name.
+func (f *Adapter) ByteStream() bpb.ByteStreamClient {
+	return adapterByteStream{f: f}
+}
+
+type adapterByteStream struct {
+	f *Adapter
+}
+
+func (b adapterByteStream) Read(ctx context.Context, in *bpb.ReadRequest, opts ...grpc.CallOption) (bpb.ByteStream_ReadClient, error) {
+	return b.f.client(ctx).Read(ctx, in, opts...)
+}
+
+func (b adapterByteStream) Write(ctx context.Context, opts ...grpc.CallOption) (bpb.ByteStream_WriteClient, error) {
+	return b.f.client(ctx).Write(ctx, opts...)
+}
+
+func (b adapterByteStream) QueryWriteStatus(ctx context.Context, in *bpb.QueryWriteStatusRequest, opts ...grpc.CallOption) (*bpb.QueryWriteStatusResponse, error) {
+	return b.f.client(ctx).QueryWriteStatus(ctx, in, opts...)
+}
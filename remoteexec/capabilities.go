@@ -0,0 +1,236 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/remoteexec/cas"
+	"go.chromium.org/goma/server/remoteexec/digest"
+)
+
+// Capabilities is a summary of RBE backend capabilities probed by Adapter.
+type Capabilities struct {
+	// ProbeTime is the time of the last probe.
+	// zero if not probed yet.
+	ProbeTime time.Time
+	// Err is error of the last probe.
+	Err error
+
+	// DigestFunction is digest function negotiated with the backend.
+	DigestFunction rpb.DigestFunction_Value
+	// DigestFunctions are digest functions advertised by the backend.
+	DigestFunctions []rpb.DigestFunction_Value
+
+	// MaxBatchTotalSizeBytes is max size of batch requests.
+	MaxBatchTotalSizeBytes int64
+
+	// Compressors are names of compressors supported by the backend.
+	Compressors []string
+
+	// CachePriorities are ranges of cache priority supported
+	// by the backend. empty if cache priority is not supported.
+	CachePriorities []*rpb.PriorityCapabilities_PriorityRange
+	// ExecutionPriorities are ranges of execution priority supported
+	// by the backend. empty if execution priority is not supported.
+	ExecutionPriorities []*rpb.PriorityCapabilities_PriorityRange
+
+	// ExecEnabled reports whether the backend supports remote execution.
+	ExecEnabled bool
+}
+
+// ProbeCapabilities gets capabilities of the RBE backend, and adapts
+// behavior to them, i.e. digest function, max batch size and priorities.
+//
+// If it is not called, capabilities are probed at the first Exec.
+// It is better to call it at startup to detect backend with different
+// limits early.
+func (f *Adapter) ProbeCapabilities(ctx context.Context) error {
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	return f.probeCapabilities(ctx)
+}
+
+func (f *Adapter) ensureCapabilities(ctx context.Context) {
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+
+	if f.capabilities != nil {
+		return
+	}
+	err := f.probeCapabilities(ctx)
+	if err != nil {
+		logger := log.FromContext(ctx)
+		logger.Errorf("capabilities: %v", err)
+	}
+}
+
+// probeCapabilities probes capabilities. f.capMu must be held.
+func (f *Adapter) probeCapabilities(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	f.capTime = time.Now()
+	c, err := f.client(ctx).GetCapabilities(ctx, &rpb.GetCapabilitiesRequest{
+		InstanceName: f.Instance(),
+	})
+	if err != nil {
+		f.capErr = fmt.Errorf("GetCapabilities: %v", err)
+		return f.capErr
+	}
+	f.capabilities = c
+	logger.Infof("serverCapabilities: %v", c)
+	df, err := digest.Negotiate(f.DigestFunction, c.GetCacheCapabilities().GetDigestFunctions())
+	if err == nil {
+		err = digest.SetFunction(df)
+	}
+	if err != nil {
+		f.capErr = fmt.Errorf("digest function: %v", err)
+		return f.capErr
+	}
+	f.capErr = nil
+	logger.Infof("digest function: %v", df)
+	if f.ExecutionPriority != 0 && !priorityInRange(f.ExecutionPriority, c.GetExecutionCapabilities().GetExecutionPriorityCapabilities()) {
+		logger.Warnf("execution priority %d is not supported: %v", f.ExecutionPriority, c.GetExecutionCapabilities().GetExecutionPriorityCapabilities())
+	}
+	if f.CachePriority != 0 && !priorityInRange(f.CachePriority, c.GetCacheCapabilities().GetCachePriorityCapabilities()) {
+		logger.Warnf("cache priority %d is not supported: %v", f.CachePriority, c.GetCacheCapabilities().GetCachePriorityCapabilities())
+	}
+	return nil
+}
+
+// CheckBackend checks RBE backend b is available by getting its
+// capabilities. It is intended to be used for Router.HealthCheck.
+func (f *Adapter) CheckBackend(ctx context.Context, b *Backend) error {
+	_, err := f.backendClient(ctx, b).GetCapabilities(ctx, &rpb.GetCapabilitiesRequest{
+		InstanceName: b.instanceName(f.InstancePrefix, f.Instance()),
+	})
+	return err
+}
+
+// Capabilities returns summary of RBE backend capabilities.
+func (f *Adapter) Capabilities() Capabilities {
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	c := Capabilities{
+		ProbeTime: f.capTime,
+		Err:       f.capErr,
+	}
+	if f.capabilities == nil {
+		return c
+	}
+	cc := f.capabilities.GetCacheCapabilities()
+	c.DigestFunction = digest.Function()
+	c.DigestFunctions = cc.GetDigestFunctions()
+	c.MaxBatchTotalSizeBytes = cc.GetMaxBatchTotalSizeBytes()
+	if c.MaxBatchTotalSizeBytes == 0 {
+		c.MaxBatchTotalSizeBytes = cas.DefaultBatchByteLimit
+	}
+	c.Compressors = supportedCompressors(cc)
+	c.CachePriorities = cc.GetCachePriorityCapabilities().GetPriorities()
+	c.ExecutionPriorities = f.capabilities.GetExecutionCapabilities().GetExecutionPriorityCapabilities().GetPriorities()
+	c.ExecEnabled = f.capabilities.GetExecutionCapabilities().GetExecEnabled()
+	return c
+}
+
+// executionPolicy returns execution policy for ExecuteRequest with
+// priority p, or nil if default policy should be used.
+func (f *Adapter) executionPolicy(p PriorityRule) *rpb.ExecutionPolicy {
+	priority := p.ExecutionPriority
+	if priority == 0 {
+		priority = f.ExecutionPriority
+	}
+	if priority == 0 {
+		return nil
+	}
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	if !priorityInRange(priority, f.capabilities.GetExecutionCapabilities().GetExecutionPriorityCapabilities()) {
+		return nil
+	}
+	return &rpb.ExecutionPolicy{
+		Priority: priority,
+	}
+}
+
+// resultsCachePolicy returns results cache policy for ExecuteRequest
+// with priority p, or nil if default policy should be used.
+func (f *Adapter) resultsCachePolicy(p PriorityRule) *rpb.ResultsCachePolicy {
+	priority := p.CachePriority
+	if priority == 0 {
+		priority = f.CachePriority
+	}
+	if priority == 0 {
+		return nil
+	}
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	if !priorityInRange(priority, f.capabilities.GetCacheCapabilities().GetCachePriorityCapabilities()) {
+		return nil
+	}
+	return &rpb.ResultsCachePolicy{
+		Priority: priority,
+	}
+}
+
+// compressor returns compressor for bytestream transfers.
+// It uses zstd if the backend supports it, unless DisableCompressedBlobs.
+func (f *Adapter) compressor() cas.Compressor {
+	if f.DisableCompressedBlobs {
+		return cas.Identity
+	}
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	for _, c := range supportedCompressors(f.capabilities.GetCacheCapabilities()) {
+		if c == "ZSTD" {
+			return cas.Zstd
+		}
+	}
+	return cas.Identity
+}
+
+// priorityInRange reports whether priority p is supported by pc.
+func priorityInRange(p int32, pc *rpb.PriorityCapabilities) bool {
+	for _, r := range pc.GetPriorities() {
+		if r.GetMinPriority() <= p && p <= r.GetMaxPriority() {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedCompressors returns names of compressors in cc.
+// It uses proto reflection since the field was renamed
+// across remote-apis versions.
+func supportedCompressors(cc *rpb.CacheCapabilities) []string {
+	if cc == nil {
+		return nil
+	}
+	m := cc.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	var names []string
+	for _, name := range []protoreflect.Name{"supported_compressors", "supported_compressor"} {
+		fd := fields.ByName(name)
+		if fd == nil || !fd.IsList() || fd.Kind() != protoreflect.EnumKind {
+			continue
+		}
+		l := m.Get(fd).List()
+		for i := 0; i < l.Len(); i++ {
+			n := l.Get(i).Enum()
+			v := fd.Enum().Values().ByNumber(n)
+			if v == nil {
+				names = append(names, fmt.Sprintf("%d", n))
+				continue
+			}
+			names = append(names, string(v.Name()))
+		}
+		break
+	}
+	return names
+}
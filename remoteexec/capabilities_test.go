@@ -0,0 +1,73 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+func TestAdapterProbeCapabilities(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cluster := &fakeCluster{
+		rbe: newFakeRBE(),
+	}
+	cluster.rbe.ServerCapabilities.CacheCapabilities.MaxBatchTotalSizeBytes = 1024 * 1024
+	cluster.rbe.ServerCapabilities.CacheCapabilities.CachePriorityCapabilities = &rpb.PriorityCapabilities{
+		Priorities: []*rpb.PriorityCapabilities_PriorityRange{
+			{MinPriority: -10, MaxPriority: 10},
+		},
+	}
+	err := cluster.setup(ctx, cluster.rbe.instancePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.teardown()
+
+	adapter := &cluster.adapter
+	adapter.CachePriority = 5
+	adapter.ExecutionPriority = 5
+
+	if got := adapter.Capabilities(); !got.ProbeTime.IsZero() {
+		t.Errorf("Capabilities().ProbeTime=%v; want zero before probe", got.ProbeTime)
+	}
+	err = adapter.ProbeCapabilities(ctx)
+	if err != nil {
+		t.Fatalf("ProbeCapabilities(ctx)=%v; want nil error", err)
+	}
+	c := adapter.Capabilities()
+	if c.ProbeTime.IsZero() || c.Err != nil {
+		t.Errorf("Capabilities()=%v, %v; want probed without error", c.ProbeTime, c.Err)
+	}
+	if got, want := c.DigestFunction, rpb.DigestFunction_SHA256; got != want {
+		t.Errorf("Capabilities().DigestFunction=%v; want %v", got, want)
+	}
+	if got, want := c.MaxBatchTotalSizeBytes, int64(1024*1024); got != want {
+		t.Errorf("Capabilities().MaxBatchTotalSizeBytes=%d; want %d", got, want)
+	}
+	if !c.ExecEnabled {
+		t.Errorf("Capabilities().ExecEnabled=false; want true")
+	}
+
+	if got := adapter.resultsCachePolicy(PriorityRule{}); got.GetPriority() != 5 {
+		t.Errorf("resultsCachePolicy()=%v; want priority 5", got)
+	}
+	if got := adapter.resultsCachePolicy(PriorityRule{CachePriority: -3}); got.GetPriority() != -3 {
+		t.Errorf("resultsCachePolicy(-3)=%v; want priority -3", got)
+	}
+	// fake RBE doesn't advertise execution priority.
+	if got := adapter.executionPolicy(PriorityRule{}); got != nil {
+		t.Errorf("executionPolicy()=%v; want nil", got)
+	}
+	adapter.CachePriority = 20
+	if got := adapter.resultsCachePolicy(PriorityRule{}); got != nil {
+		t.Errorf("resultsCachePolicy()=%v; want nil for out of range priority", got)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cas
+
+import (
+	"context"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/remoteexec/datasource"
+	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/rpc"
+)
+
+// per blob overhead in BatchReadBlobsResponse, other than hash and data.
+// digest (tag, length, size_bytes), data (tag, length), status.
+const batchReadBlobOverhead = 32
+
+// BatchDownload downloads blobs in instance by BatchReadBlobs.
+// Blobs are batched so that total size of a batch doesn't exceed
+// byteLimit. 0 byteLimit means DefaultBatchByteLimit.
+// Blobs larger than byteLimit are not downloaded.
+//
+// It returns store of downloaded blobs. Blobs failed to download
+// individually are not in the store, so caller should download them
+// by bytestream.
+func BatchDownload(ctx context.Context, c rpb.ContentAddressableStorageClient, instance string, blobs []*rpb.Digest, byteLimit int64) (*digest.Store, error) {
+	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/remoteexec/cas.BatchDownload")
+	defer span.End()
+	logger := log.FromContext(ctx)
+	if byteLimit <= 0 {
+		byteLimit = DefaultBatchByteLimit
+	}
+	t := time.Now()
+	store := digest.NewStore()
+	var batch []*rpb.Digest
+	var size int64
+	n := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var resp *rpb.BatchReadBlobsResponse
+		err := rpc.Retry{}.Do(ctx, func() error {
+			var err error
+			resp, err = c.BatchReadBlobs(ctx, &rpb.BatchReadBlobsRequest{
+				InstanceName: instance,
+				Digests:      batch,
+			})
+			return fixRBEInternalError(err)
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.GetResponses() {
+			if st := status.FromProto(r.GetStatus()); st.Code() != codes.OK {
+				span.Annotatef(nil, "batch read blob %v: %v", r.GetDigest(), st)
+				continue
+			}
+			if int64(len(r.GetData())) != r.GetDigest().GetSizeBytes() {
+				logger.Warnf("batch read blob %v: size mismatch %d", r.GetDigest(), len(r.GetData()))
+				continue
+			}
+			store.Set(digest.New(datasource.Bytes(ResName(instance, r.GetDigest()), r.GetData()), r.GetDigest()))
+			n++
+		}
+		batch = nil
+		size = 0
+		return nil
+	}
+	for _, d := range blobs {
+		blobSize := d.GetSizeBytes() + int64(len(d.GetHash())) + batchReadBlobOverhead
+		if blobSize > byteLimit {
+			continue
+		}
+		if size+blobSize > byteLimit || len(batch) >= batchBlobLimit {
+			err := flush()
+			if err != nil {
+				return nil, err
+			}
+		}
+		batch = append(batch, d)
+		size += blobSize
+	}
+	err := flush()
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("batch read %d out of %d blobs in %s", n, len(blobs), time.Since(t))
+	return store, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cas
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/grpc"
+
+	"go.chromium.org/goma/server/remoteexec/datasource"
+)
+
+// countingCASClient counts BatchReadBlobs calls.
+type countingCASClient struct {
+	rpb.ContentAddressableStorageClient
+	batchReads int
+}
+
+func (c *countingCASClient) BatchReadBlobs(ctx context.Context, req *rpb.BatchReadBlobsRequest, opts ...grpc.CallOption) (*rpb.BatchReadBlobsResponse, error) {
+	c.batchReads++
+	return c.ContentAddressableStorageClient.BatchReadBlobs(ctx, req, opts...)
+}
+
+func TestBatchDownload(t *testing.T) {
+	instance := "instance"
+	fc, err := newFakeCASClient(0, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fc.teardown()
+
+	present := []*blobData{
+		makeBlobData("5WGm1JJ1x77KSrlRgzxL"),
+		makeBlobData("ZJ0BiCaayupcdD2nRTmXXrre772lCF"),
+		makeBlobData("o2JzZO7qr6dwwR2CmXZtWDJ65ZkT885aruPAe0nm"),
+	}
+	for _, blob := range present {
+		fc.server.cas.Put(blob.data)
+	}
+	missing := makeBlobData("not in cas")
+	large := makeBlobData(strings.Repeat("x", 200))
+
+	c := &countingCASClient{
+		ContentAddressableStorageClient: fc.CAS(),
+	}
+	ctx := context.Background()
+	// each batch can hold two present blobs, but not large blob.
+	byteLimit := int64(len(present[2].data)+len(present[1].data)) + 2*(64+batchReadBlobOverhead)
+	blobs := append(getDigests(present), missing.digest, large.digest)
+	store, err := BatchDownload(ctx, c, instance, blobs, byteLimit)
+	if err != nil {
+		t.Fatalf("BatchDownload(...)=_, %v; want nil error", err)
+	}
+	if c.batchReads != 2 {
+		t.Errorf("batchReads=%d; want 2", c.batchReads)
+	}
+	for _, blob := range present {
+		data, ok := store.Get(blob.digest)
+		if !ok {
+			t.Errorf("store.Get(%v)=_, false; want true", blob.digest)
+			continue
+		}
+		b, err := datasource.ReadAll(ctx, data)
+		if err != nil || string(b) != string(blob.data) {
+			t.Errorf("ReadAll(%v)=%q, %v; want %q, nil", blob.digest, b, err, blob.data)
+		}
+	}
+	for _, blob := range []*blobData{missing, large} {
+		if _, ok := store.Get(blob.digest); ok {
+			t.Errorf("store.Get(%v)=_, true; want false", blob.digest)
+		}
+	}
+}
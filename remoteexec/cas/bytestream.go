@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"path"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/google/uuid"
 	"go.opencensus.io/trace"
 	bpb "google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"go.chromium.org/goma/server/bytestreamio"
@@ -33,6 +35,10 @@ var bufPool = sync.Pool{
 	},
 }
 
+// pipelineThresholdBytes is a blob size to upload by bytestreamio.PipelineCopy,
+// i.e. reads next chunk from source while sending previous chunk.
+const pipelineThresholdBytes = 4 * maxChunkSizeBytes
+
 func ioCopyBuffer(wr io.Writer, rd io.Reader) (int64, error) {
 	buf := bufPool.Get().([]byte)
 	defer bufPool.Put(buf)
@@ -70,16 +76,42 @@ func ParseResName(name string) (*rpb.Digest, error) {
 	return nil, fmt.Errorf("%q: not resource name", name)
 }
 
+// Compressor is a compressor of blobs in bytestream transfers.
+// It is used as compressor name in resource name of compressed blobs.
+type Compressor string
+
+const (
+	// Identity is no compression.
+	Identity Compressor = ""
+
+	// Zstd is zstd compression.
+	Zstd Compressor = "zstd"
+)
+
 func UploadDigest(ctx context.Context, bs bpb.ByteStreamClient, instance string, digest *rpb.Digest, rd io.Reader) error {
-	resname := UploadResName(instance, digest)
-	return Upload(ctx, bs, resname, digest.SizeBytes, rd)
+	return UploadDigestCompressed(ctx, bs, instance, digest, rd, Identity)
+}
+
+// UploadDigestCompressed uploads blob of digest from rd, compressed by comp.
+func UploadDigestCompressed(ctx context.Context, bs bpb.ByteStreamClient, instance string, digest *rpb.Digest, rd io.Reader, comp Compressor) error {
+	resname := UploadCompressedResName(instance, comp, digest)
+	return upload(ctx, bs, resname, comp, digest.SizeBytes, rd)
 }
 
 // UploadResName returns resource name of digest in instance to upload.
 // https://github.com/bazelbuild/remote-apis/blob/c1c1ad2c97ed18943adb55f06657440daa60d833/build/bazel/remote/execution/v2/remote_execution.proto#L187
 func UploadResName(instance string, digest *rpb.Digest) string {
+	return UploadCompressedResName(instance, Identity, digest)
+}
+
+// UploadCompressedResName returns resource name of digest in instance
+// to upload compressed by comp.
+func UploadCompressedResName(instance string, comp Compressor, digest *rpb.Digest) string {
 	uuid := uuid.New()
-	return path.Join(instance, "uploads", uuid.String(), "blobs", digest.Hash, strconv.FormatInt(digest.SizeBytes, 10))
+	if comp == Identity {
+		return path.Join(instance, "uploads", uuid.String(), "blobs", digest.Hash, strconv.FormatInt(digest.SizeBytes, 10))
+	}
+	return path.Join(instance, "uploads", uuid.String(), "compressed-blobs", string(comp), digest.Hash, strconv.FormatInt(digest.SizeBytes, 10))
 }
 
 type ioReader struct {
@@ -88,19 +120,39 @@ type ioReader struct {
 
 // Upload uploads blob specified by resname from rd.
 func Upload(ctx context.Context, bs bpb.ByteStreamClient, resname string, size int64, rd io.Reader) error {
+	return upload(ctx, bs, resname, Identity, size, rd)
+}
+
+func createWriter(ctx context.Context, bs bpb.ByteStreamClient, resname string, comp Compressor) (io.WriteCloser, error) {
+	switch comp {
+	case Identity:
+		return bytestreamio.Create(ctx, bs, resname)
+	case Zstd:
+		return bytestreamio.CreateZstd(ctx, bs, resname)
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unsupported compressor %q", comp)
+}
+
+func upload(ctx context.Context, bs bpb.ByteStreamClient, resname string, comp Compressor, size int64, rd io.Reader) error {
 	span := trace.FromContext(ctx)
 	logger := log.FromContext(ctx)
 	logger.Infof("upload %s", resname)
 	span.AddAttributes(trace.StringAttribute("resname", resname))
 
-	wr, err := bytestreamio.Create(ctx, bs, resname)
+	wr, err := createWriter(ctx, bs, resname, comp)
 	if err != nil {
 		s := status.Convert(err)
 		return status.Errorf(s.Code(), "upload write %s: %v", resname, s.Message())
 	}
 	t0 := time.Now()
-	// drop WriteTo method in rd.
-	written, err := ioCopyBuffer(wr, ioReader{rd})
+	var written int64
+	if size >= pipelineThresholdBytes {
+		span.Annotatef(nil, "pipeline copy %d", size)
+		written, err = bytestreamio.PipelineCopy(wr, rd, maxChunkSizeBytes, 1)
+	} else {
+		// drop WriteTo method in rd.
+		written, err = ioCopyBuffer(wr, ioReader{rd})
+	}
 	if err != nil {
 		wr.Close()
 		logger.Warnf("upload failed %s %d in %s: %v", resname, written, time.Since(t0), err)
@@ -118,8 +170,14 @@ func Upload(ctx context.Context, bs bpb.ByteStreamClient, resname string, size i
 
 // DownloadDigest downloads blob specified resname/digest into w.
 func DownloadDigest(ctx context.Context, bs bpb.ByteStreamClient, wr io.Writer, instance string, digest *rpb.Digest) error {
-	resname := ResName(instance, digest)
-	size, err := Download(ctx, bs, wr, resname)
+	return DownloadDigestCompressed(ctx, bs, wr, instance, digest, Identity)
+}
+
+// DownloadDigestCompressed downloads blob of digest compressed by comp,
+// and writes decompressed data into w.
+func DownloadDigestCompressed(ctx context.Context, bs bpb.ByteStreamClient, wr io.Writer, instance string, digest *rpb.Digest, comp Compressor) error {
+	resname := CompressedResName(instance, comp, digest)
+	size, err := download(ctx, bs, wr, resname, comp)
 	if err != nil {
 		return err
 	}
@@ -135,23 +193,52 @@ func ResName(instance string, digest *rpb.Digest) string {
 	return path.Join(instance, "blobs", digest.Hash, strconv.FormatInt(digest.SizeBytes, 10))
 }
 
+// CompressedResName returns resource name of digest in instance
+// compressed by comp.
+// https://github.com/bazelbuild/remote-apis/blob/6c32c3b917cc5d3cfee680c03179d7552832bb3f/build/bazel/remote/execution/v2/remote_execution.proto#L256
+func CompressedResName(instance string, comp Compressor, digest *rpb.Digest) string {
+	if comp == Identity {
+		return ResName(instance, digest)
+	}
+	return path.Join(instance, "compressed-blobs", string(comp), digest.Hash, strconv.FormatInt(digest.SizeBytes, 10))
+}
+
 type ioWriter struct {
 	io.Writer
 }
 
 // Download downloads blob specified by resname into w.
 func Download(ctx context.Context, bs bpb.ByteStreamClient, wr io.Writer, resname string) (int64, error) {
+	return download(ctx, bs, wr, resname, Identity)
+}
+
+func openReader(ctx context.Context, bs bpb.ByteStreamClient, resname string, comp Compressor) (io.ReadCloser, error) {
+	switch comp {
+	case Identity:
+		rd, err := bytestreamio.Open(ctx, bs, resname)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(rd), nil
+	case Zstd:
+		return bytestreamio.OpenZstd(ctx, bs, resname)
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unsupported compressor %q", comp)
+}
+
+func download(ctx context.Context, bs bpb.ByteStreamClient, wr io.Writer, resname string, comp Compressor) (int64, error) {
 	span := trace.FromContext(ctx)
 	logger := log.FromContext(ctx)
 	t := time.Now()
 	logger.Infof("download %s", resname)
 	span.AddAttributes(trace.StringAttribute("resname", resname))
 
-	rd, err := bytestreamio.Open(ctx, bs, resname)
+	rd, err := openReader(ctx, bs, resname, comp)
 	if err != nil {
 		s := status.Convert(err)
 		return 0, status.Errorf(s.Code(), "download read: %s: %v", resname, s.Message())
 	}
+	defer rd.Close()
 	// drop ReadFrom method in wr
 	written, err := ioCopyBuffer(ioWriter{wr}, rd)
 	if err != nil {
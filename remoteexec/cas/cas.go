@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -61,6 +62,9 @@ type CAS struct {
 	*digest.Store
 
 	CacheCapabilities *rpb.CacheCapabilities
+
+	// Compressor is used to upload large blobs by bytestream.
+	Compressor Compressor
 }
 
 // TODO: unit test
@@ -301,42 +305,60 @@ func (c CAS) Upload(ctx context.Context, instance string, sema chan struct{}, bl
 	}
 
 	batchReqs := createBatchUpdateBlobsRequests(blobReqs, instance, byteLimit)
-	for _, batchReq := range batchReqs {
-		uploaded := false
-		for !uploaded {
-			t := time.Now()
-			span.Annotatef(nil, "batch update %d blobs", len(batchReq.Requests))
-			// TODO: should we report rpc error as missing input too?
-			var batchResp *rpb.BatchUpdateBlobsResponse
-			err := rpc.Retry{}.Do(ctx, func() error {
-				var err error
-				batchResp, err = c.Client.CAS().BatchUpdateBlobs(ctx, batchReq)
-				return fixRBEInternalError(err)
-			})
-			if err != nil {
-				if grpc.Code(err) == codes.ResourceExhausted {
-					// gRPC returns ResourceExhausted if request message is larger than max.
-					logger.Warnf("upload by batch %d blobs: %v", len(batchReq.Requests), err)
+	for len(batchReqs) > 0 {
+		batchReq := batchReqs[0]
+		batchReqs = batchReqs[1:]
+		t := time.Now()
+		span.Annotatef(nil, "batch update %d blobs", len(batchReq.Requests))
+		// TODO: should we report rpc error as missing input too?
+		var batchResp *rpb.BatchUpdateBlobsResponse
+		err := rpc.Retry{}.Do(ctx, func() error {
+			var err error
+			batchResp, err = c.Client.CAS().BatchUpdateBlobs(ctx, batchReq)
+			if isMessageTooLarge(err) {
+				// no need to retry with the same request.
+				return errBatchTooLarge{err: err}
+			}
+			return fixRBEInternalError(err)
+		})
+		if err != nil {
+			var tooLarge errBatchTooLarge
+			if errors.As(err, &tooLarge) || grpc.Code(err) == codes.ResourceExhausted {
+				// gRPC returns ResourceExhausted if request message is larger than max.
+				// server's max message size might be smaller than
+				// max_batch_total_size_bytes.
+				logger.Warnf("upload by batch %d blobs: %v", len(batchReq.Requests), err)
+				n := len(batchReq.Requests)
+				if n == 1 {
 					// try with bytestream.
-					// TODO: retry with fewer blobs?
+					largeBlobs = append(largeBlobs, batchReq.Requests[0].Digest)
 					continue
 				}
-
-				return grpc.Errorf(grpc.Code(err), "batch update blobs: %v", err)
-			}
-			for _, res := range batchResp.Responses {
-				st := status.FromProto(res.GetStatus())
-				if st.Code() != codes.OK {
-					span.Annotatef(nil, "batch update blob %v: %v", res.Digest, res.Status)
-					missing.Blobs = append(missing.Blobs, MissingBlob{
-						Digest: res.Digest,
-						Err:    grpc.Errorf(st.Code(), "batch update blob: %v", res.Status),
+				// retry with fewer blobs.
+				batchReqs = append(batchReqs,
+					&rpb.BatchUpdateBlobsRequest{
+						InstanceName: instance,
+						Requests:     batchReq.Requests[:n/2],
+					},
+					&rpb.BatchUpdateBlobsRequest{
+						InstanceName: instance,
+						Requests:     batchReq.Requests[n/2:],
 					})
-				}
+				continue
+			}
+			return grpc.Errorf(grpc.Code(err), "batch update blobs: %v", err)
+		}
+		for _, res := range batchResp.Responses {
+			st := status.FromProto(res.GetStatus())
+			if st.Code() != codes.OK {
+				span.Annotatef(nil, "batch update blob %v: %v", res.Digest, res.Status)
+				missing.Blobs = append(missing.Blobs, MissingBlob{
+					Digest: res.Digest,
+					Err:    grpc.Errorf(st.Code(), "batch update blob: %v", res.Status),
+				})
 			}
-			uploaded = true
-			logger.Infof("upload by batch %d blobs (missing:%d) in %s", len(batchReq.Requests), len(missing.Blobs), time.Since(t))
 		}
+		logger.Infof("upload by batch %d blobs (missing:%d) in %s", len(batchReq.Requests), len(missing.Blobs), time.Since(t))
 	}
 	logger.Infof("upload by streaming from %d out of %d", len(largeBlobs), len(blobs))
 	t := time.Now()
@@ -356,7 +378,7 @@ func (c CAS) Upload(ctx context.Context, instance string, sema chan struct{}, bl
 				span.Annotatef(nil, "upload open %v: %v", blob, err)
 				return err
 			}
-			err = UploadDigest(ctx, c.Client.ByteStream(), instance, blob, rd)
+			err = UploadDigestCompressed(ctx, c.Client.ByteStream(), instance, blob, rd, c.Compressor)
 			if err != nil {
 				rd.Close()
 				return fixRBEInternalError(err)
@@ -380,6 +402,22 @@ func (c CAS) Upload(ctx context.Context, instance string, sema chan struct{}, bl
 	return nil
 }
 
+// errBatchTooLarge is an error for batch request larger than
+// max message size.
+type errBatchTooLarge struct {
+	err error
+}
+
+func (e errBatchTooLarge) Error() string {
+	return fmt.Sprintf("batch too large: %v", e.err)
+}
+
+// isMessageTooLarge reports whether err is gRPC error for message larger
+// than max message size, either on client side or on server side.
+func isMessageTooLarge(err error) bool {
+	return status.Code(err) == codes.ResourceExhausted && strings.Contains(status.Convert(err).Message(), "larger than max")
+}
+
 func fixRBEInternalError(err error) error {
 	if status.Code(err) == codes.Internal {
 		return status.Errorf(codes.Unavailable, "%v", err)
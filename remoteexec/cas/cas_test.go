@@ -15,6 +15,9 @@ import (
 	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/testing/protocmp"
 
 	"go.chromium.org/goma/server/remoteexec/digest"
@@ -515,6 +518,90 @@ func TestUpload(t *testing.T) {
 	}
 }
 
+// smallMsgCASClient rejects BatchUpdateBlobs with more than maxBlobs
+// blobs, as if message is larger than max message size.
+type smallMsgCASClient struct {
+	rpb.ContentAddressableStorageClient
+	maxBlobs int
+}
+
+func (c smallMsgCASClient) BatchUpdateBlobs(ctx context.Context, req *rpb.BatchUpdateBlobsRequest, opts ...grpc.CallOption) (*rpb.BatchUpdateBlobsResponse, error) {
+	if len(req.Requests) > c.maxBlobs {
+		return nil, status.Errorf(codes.ResourceExhausted, "grpc: trying to send message larger than max (%d blobs vs. %d blobs)", len(req.Requests), c.maxBlobs)
+	}
+	return c.ContentAddressableStorageClient.BatchUpdateBlobs(ctx, req, opts...)
+}
+
+func TestUploadBatchTooLarge(t *testing.T) {
+	blobs := []*blobData{
+		makeBlobData("5WGm1JJ1x77KSrlRgzxL"),
+		makeBlobData("ZJ0BiCaayupcdD2nRTmXXrre772lCF"),
+		makeBlobData("o2JzZO7qr6dwwR2CmXZtWDJ65ZkT885aruPAe0nm"),
+		makeBlobData("iUuNpPDjQ4Or5dWlgqhPGqV7rG0lFSyFpRkqgeF1x5Mv"),
+		makeBlobData("RkqgeF1x5Mv"),
+	}
+	store := digest.NewStore()
+	for _, blob := range blobs {
+		store.Set(makeFakeDigestData(blob.digest, blob.data))
+	}
+
+	for _, tc := range []struct {
+		maxBlobs                int
+		wantNumBatchUpdates     int
+		wantNumByteStreamWrites int
+	}{
+		{
+			// 5 -> 2 + 3 -> 2 + (1 + 2)
+			maxBlobs:            2,
+			wantNumBatchUpdates: 3,
+		},
+		{
+			maxBlobs:                0,
+			wantNumByteStreamWrites: 5,
+		},
+	} {
+		t.Run(fmt.Sprintf("maxBlobs=%d", tc.maxBlobs), func(t *testing.T) {
+			instance := "instance"
+			fc, err := newFakeCASClient(0, instance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fc.teardown()
+			fc.casClient = smallMsgCASClient{
+				ContentAddressableStorageClient: fc.casClient,
+				maxBlobs:                        tc.maxBlobs,
+			}
+
+			cas := CAS{
+				Client: fc,
+				Store:  store,
+			}
+			ctx := context.Background()
+			sema := make(chan struct{}, 100)
+			err = cas.Upload(ctx, instance, sema, getDigests(blobs)...)
+			if err != nil {
+				t.Errorf("Upload(...)=%v; want nil error", err)
+			}
+			casSrv := fc.server.cas
+			if got, want := casSrv.BatchReqs(), tc.wantNumBatchUpdates; got != want {
+				t.Errorf("casSrv.BatchReqs()=%d; want %d", got, want)
+			}
+			if got, want := casSrv.WriteReqs(), tc.wantNumByteStreamWrites; got != want {
+				t.Errorf("casSrv.WriteReqs()=%d; want %d", got, want)
+			}
+			for _, blob := range blobs {
+				_, ok := casSrv.Get(rdigest.Digest{
+					Hash: blob.digest.Hash,
+					Size: blob.digest.SizeBytes,
+				})
+				if !ok {
+					t.Errorf("blob %v not stored", blob.digest)
+				}
+			}
+		})
+	}
+}
+
 func toBatchReqs(bds []*blobData) []*rpb.BatchUpdateBlobsRequest_Request {
 	var result []*rpb.BatchUpdateBlobsRequest_Request
 	for _, bd := range bds {
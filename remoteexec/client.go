@@ -6,6 +6,7 @@ package remoteexec
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
@@ -15,6 +16,7 @@ import (
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
@@ -22,7 +24,8 @@ import (
 	"go.chromium.org/goma/server/rpc"
 )
 
-// Client is a remoteexec API client to ClientConn.
+// Client is a remoteexec API client to ClientConn, or to connections
+// in Pool if Pool is set.
 // CallOptions will be added when calling RPC.
 //
 //	prcred, _ := oauth.NewApplicationDefault(ctx,
@@ -35,6 +38,23 @@ type Client struct {
 	*grpc.ClientConn
 	CallOptions []grpc.CallOption
 	Retry       rpc.Retry
+
+	// ExecuteHedge and CacheHedge are policies to issue hedged
+	// Execute and GetActionResult to mitigate long-tail latency of RBE.
+	ExecuteHedge rpc.Hedge
+	CacheHedge   rpc.Hedge
+
+	// Pool is a pool of connections used instead of ClientConn
+	// if set.
+	Pool *ConnPool
+}
+
+// conn returns connection to call RPC.
+func (c Client) conn() *grpc.ClientConn {
+	if c.Pool != nil {
+		return c.Pool.Conn()
+	}
+	return c.ClientConn
 }
 
 func (c Client) callOptions(opts ...grpc.CallOption) []grpc.CallOption {
@@ -48,13 +68,29 @@ func (c Client) Cache() rpb.ActionCacheClient {
 }
 
 // GetActionResult retrieves a cached execution result.
+// It issues hedged requests if CacheHedge is set.
 func (c Client) GetActionResult(ctx context.Context, req *rpb.GetActionResultRequest, opts ...grpc.CallOption) (*rpb.ActionResult, error) {
-	return rpb.NewActionCacheClient(c.ClientConn).GetActionResult(ctx, req, c.callOptions(opts...)...)
+	if c.CacheHedge.Delay <= 0 {
+		return rpb.NewActionCacheClient(c.conn()).GetActionResult(ctx, req, c.callOptions(opts...)...)
+	}
+	var mu sync.Mutex
+	results := make(map[int]*rpb.ActionResult)
+	attempts, winner, err := c.CacheHedge.Do(ctx, func(ctx context.Context, attempt int) error {
+		resp, err := rpb.NewActionCacheClient(c.conn()).GetActionResult(ctx, req, c.callOptions(opts...)...)
+		mu.Lock()
+		defer mu.Unlock()
+		results[attempt] = resp
+		return err
+	})
+	recordHedge(ctx, "get_action_result", attempts, winner)
+	mu.Lock()
+	defer mu.Unlock()
+	return results[winner], err
 }
 
 // UpdateActionResult uploads a new execution result.
 func (c Client) UpdateActionResult(ctx context.Context, req *rpb.UpdateActionResultRequest, opts ...grpc.CallOption) (*rpb.ActionResult, error) {
-	return rpb.NewActionCacheClient(c.ClientConn).UpdateActionResult(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewActionCacheClient(c.conn()).UpdateActionResult(ctx, req, c.callOptions(opts...)...)
 }
 
 // Exec returns execution client.
@@ -65,12 +101,23 @@ func (c Client) Exec() rpb.ExecutionClient {
 
 // Execute executes an action remotely.
 func (c Client) Execute(ctx context.Context, req *rpb.ExecuteRequest, opts ...grpc.CallOption) (rpb.Execution_ExecuteClient, error) {
-	return rpb.NewExecutionClient(c.ClientConn).Execute(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewExecutionClient(c.conn()).Execute(ctx, req, c.callOptions(opts...)...)
 }
 
 // WaitExecution waits for an execution operation to complete.
 func (c Client) WaitExecution(ctx context.Context, req *rpb.WaitExecutionRequest, opts ...grpc.CallOption) (rpb.Execution_WaitExecutionClient, error) {
-	return rpb.NewExecutionClient(c.ClientConn).WaitExecution(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewExecutionClient(c.conn()).WaitExecution(ctx, req, c.callOptions(opts...)...)
+}
+
+// Operations returns long-running operations client.
+func (c Client) Operations() lpb.OperationsClient {
+	return lpb.NewOperationsClient(c.conn())
+}
+
+// CancelOperation cancels an operation.
+func (c Client) CancelOperation(ctx context.Context, req *lpb.CancelOperationRequest, opts ...grpc.CallOption) error {
+	_, err := c.Operations().CancelOperation(ctx, req, c.callOptions(opts...)...)
+	return err
 }
 
 // CAS returns content addressable storage client.
@@ -81,22 +128,22 @@ func (c Client) CAS() rpb.ContentAddressableStorageClient {
 
 // FindMissingBlobs determines if blobs are present in the CAS.
 func (c Client) FindMissingBlobs(ctx context.Context, req *rpb.FindMissingBlobsRequest, opts ...grpc.CallOption) (*rpb.FindMissingBlobsResponse, error) {
-	return rpb.NewContentAddressableStorageClient(c.ClientConn).FindMissingBlobs(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewContentAddressableStorageClient(c.conn()).FindMissingBlobs(ctx, req, c.callOptions(opts...)...)
 }
 
 // BatchUpdateBlobs uploads many blobs at once.
 func (c Client) BatchUpdateBlobs(ctx context.Context, req *rpb.BatchUpdateBlobsRequest, opts ...grpc.CallOption) (*rpb.BatchUpdateBlobsResponse, error) {
-	return rpb.NewContentAddressableStorageClient(c.ClientConn).BatchUpdateBlobs(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewContentAddressableStorageClient(c.conn()).BatchUpdateBlobs(ctx, req, c.callOptions(opts...)...)
 }
 
 // BatchReadBlobs downloads many blobs at once.
 func (c Client) BatchReadBlobs(ctx context.Context, req *rpb.BatchReadBlobsRequest, opts ...grpc.CallOption) (*rpb.BatchReadBlobsResponse, error) {
-	return rpb.NewContentAddressableStorageClient(c.ClientConn).BatchReadBlobs(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewContentAddressableStorageClient(c.conn()).BatchReadBlobs(ctx, req, c.callOptions(opts...)...)
 }
 
 // GetTree fetches the entire directory tree rooted at a node.
 func (c Client) GetTree(ctx context.Context, req *rpb.GetTreeRequest, opts ...grpc.CallOption) (rpb.ContentAddressableStorage_GetTreeClient, error) {
-	return rpb.NewContentAddressableStorageClient(c.ClientConn).GetTree(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewContentAddressableStorageClient(c.conn()).GetTree(ctx, req, c.callOptions(opts...)...)
 }
 
 // ByteStream returns byte stream client.
@@ -107,19 +154,19 @@ func (c Client) ByteStream() bpb.ByteStreamClient {
 
 // Read is used to retrieve the contents of a resource as a sequence of bytes.
 func (c Client) Read(ctx context.Context, in *bpb.ReadRequest, opts ...grpc.CallOption) (bpb.ByteStream_ReadClient, error) {
-	return bpb.NewByteStreamClient(c.ClientConn).Read(ctx, in, c.callOptions(opts...)...)
+	return bpb.NewByteStreamClient(c.conn()).Read(ctx, in, c.callOptions(opts...)...)
 }
 
 // Write is used to send the contents of a resource as a sequence of bytes.
 func (c Client) Write(ctx context.Context, opts ...grpc.CallOption) (bpb.ByteStream_WriteClient, error) {
-	return bpb.NewByteStreamClient(c.ClientConn).Write(ctx, c.callOptions(opts...)...)
+	return bpb.NewByteStreamClient(c.conn()).Write(ctx, c.callOptions(opts...)...)
 }
 
 // QueryWriteStatus is used to find the committed_size for a resource
 // that is being written, which can be then be used as the write_offset
 // for the next Write call.
 func (c Client) QueryWriteStatus(ctx context.Context, in *bpb.QueryWriteStatusRequest, opts ...grpc.CallOption) (*bpb.QueryWriteStatusResponse, error) {
-	return bpb.NewByteStreamClient(c.ClientConn).QueryWriteStatus(ctx, in, c.callOptions(opts...)...)
+	return bpb.NewByteStreamClient(c.conn()).QueryWriteStatus(ctx, in, c.callOptions(opts...)...)
 }
 
 // Capabilities returns capabilities client.
@@ -129,26 +176,67 @@ func (c Client) Capabilities() rpb.CapabilitiesClient {
 
 // GetCapabilities returns the server capabilities configuration.
 func (c Client) GetCapabilities(ctx context.Context, req *rpb.GetCapabilitiesRequest, opts ...grpc.CallOption) (*rpb.ServerCapabilities, error) {
-	return rpb.NewCapabilitiesClient(c.ClientConn).GetCapabilities(ctx, req, c.callOptions(opts...)...)
+	return rpb.NewCapabilitiesClient(c.conn()).GetCapabilities(ctx, req, c.callOptions(opts...)...)
 }
 
-func logOpMetadata(logger log.Logger, op *lpb.Operation) {
+// logOpMetadata logs metadata of op, and returns it.
+// It returns nil if op has no valid metadata.
+func logOpMetadata(logger log.Logger, op *lpb.Operation) *rpb.ExecuteOperationMetadata {
 	if op.GetMetadata() == nil {
 		logger.Infof("operation update: no metadata")
-		return
+		return nil
 	}
 	md := &rpb.ExecuteOperationMetadata{}
 	err := op.GetMetadata().UnmarshalTo(md)
 	if err != nil {
 		logger.Warnf("operation update: %s: metadata bad type %T: %v", op.GetName(), op.GetMetadata(), err)
-		return
+		return nil
 	}
 	logger.Infof("operation update: %s: %v", op.GetName(), md)
+	return md
 }
 
 // ExecuteAndWait executes and action remotely and wait its response.
 // it returns operation name, response and error.
 func ExecuteAndWait(ctx context.Context, c Client, req *rpb.ExecuteRequest, opts ...grpc.CallOption) (string, *rpb.ExecuteResponse, error) {
+	return executeAndWait(ctx, c, req, nil, opts...)
+}
+
+// executeAndWait is ExecuteAndWait, but calls onUpdate with operation name
+// and nil metadata when operation starts, and with metadata whenever
+// operation metadata is updated, if onUpdate is not nil.
+// It issues hedged Execute if c.ExecuteHedge is set, so onUpdate may be called
+// for several operations concurrently.
+func executeAndWait(ctx context.Context, c Client, req *rpb.ExecuteRequest, onUpdate func(string, *rpb.ExecuteOperationMetadata), opts ...grpc.CallOption) (string, *rpb.ExecuteResponse, error) {
+	if c.ExecuteHedge.Delay <= 0 {
+		return executeAndWaitOnce(ctx, c, req, onUpdate, opts...)
+	}
+	type result struct {
+		opName string
+		resp   *rpb.ExecuteResponse
+	}
+	var mu sync.Mutex
+	results := make(map[int]result)
+	attempts, winner, err := c.ExecuteHedge.Do(ctx, func(ctx context.Context, attempt int) error {
+		opName, resp, err := executeAndWaitOnce(ctx, c, req, onUpdate, opts...)
+		mu.Lock()
+		defer mu.Unlock()
+		results[attempt] = result{
+			opName: opName,
+			resp:   resp,
+		}
+		return err
+	})
+	recordHedge(ctx, "execute", attempts, winner)
+	mu.Lock()
+	defer mu.Unlock()
+	r := results[winner]
+	return r.opName, r.resp, err
+}
+
+// executeAndWaitOnce executes an action remotely and wait its response
+// without hedging.
+func executeAndWaitOnce(ctx context.Context, c Client, req *rpb.ExecuteRequest, onUpdate func(string, *rpb.ExecuteOperationMetadata), opts ...grpc.CallOption) (string, *rpb.ExecuteResponse, error) {
 	logger := log.FromContext(ctx)
 	logger.Infof("execute action")
 
@@ -196,9 +284,16 @@ func ExecuteAndWait(ctx context.Context, c Client, req *rpb.ExecuteRequest, opts
 			if opName == "" {
 				opName = op.GetName()
 				logger.Infof("operation starts: %s", opName)
+				if onUpdate != nil {
+					onUpdate(opName, nil)
+				}
 			}
 			if !op.GetDone() {
-				logOpMetadata(logger, op)
+				md := logOpMetadata(logger, op)
+				reportProgress(ctx, opName, md)
+				if onUpdate != nil && md != nil {
+					onUpdate(opName, md)
+				}
 				waitReq = &rpb.WaitExecutionRequest{
 					Name: opName,
 				}
@@ -215,12 +310,38 @@ func ExecuteAndWait(ctx context.Context, c Client, req *rpb.ExecuteRequest, opts
 		}
 	})
 	recordRemoteExecFinish(ctx)
+	if err != nil && opName != "" && ctx.Err() != nil {
+		// client dropped the request, so no one waits for the result.
+		cancelOperation(ctx, c, opName)
+	}
 	if err == nil {
 		err = status.FromProto(resp.GetStatus()).Err()
 	}
 	return opName, resp, err
 }
 
+// cancelOperation cancels RBE operation opName abandoned by ctx,
+// so that it won't keep consuming remote workers.
+func cancelOperation(ctx context.Context, c Client, opName string) {
+	logger := log.FromContext(ctx)
+	// ctx is already done, so use new context with the same request
+	// metadata.
+	cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		cctx = metadata.NewOutgoingContext(cctx, md)
+	}
+	err := c.CancelOperation(cctx, &lpb.CancelOperationRequest{
+		Name: opName,
+	})
+	if err != nil {
+		logger.Warnf("cancel operation %s: %v", opName, err)
+	} else {
+		logger.Infof("canceled operation %s: %v", opName, ctx.Err())
+	}
+	recordCancelOperation(ctx, err)
+}
+
 // erespErr returns codes.Unavailable if it has retriable failure result.
 // returns nil otherwise (to terminates retrying, even if eresp contains
 // error status).
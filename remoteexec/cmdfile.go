@@ -8,8 +8,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"runtime"
 
 	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"golang.org/x/sync/errgroup"
 
 	pb "go.chromium.org/goma/server/proto/command"
 	"go.chromium.org/goma/server/remoteexec/digest"
@@ -22,7 +24,9 @@ type CmdStorage interface {
 }
 
 // fileSpecToEntry converts filespec to merkletree entry.
-func fileSpecToEntry(ctx context.Context, fs *pb.FileSpec, cmdStorage CmdStorage) (merkletree.Entry, error) {
+// FileSpec hash is SHA-256, so digest is computed from cmdStorage
+// (and cached in digestCache if not nil) if digest function is not SHA256.
+func fileSpecToEntry(ctx context.Context, fs *pb.FileSpec, cmdStorage CmdStorage, digestCache DigestCache) (merkletree.Entry, error) {
 	if fs.HashKey != "" || fs.Blob != nil {
 		return merkletree.Entry{}, fmt.Errorf("%s: fileSpecToEntry used for goma input? %s %s", fs.Path, fs.HashKey, fs.Blob.GetBlobType())
 	}
@@ -42,14 +46,31 @@ func fileSpecToEntry(ctx context.Context, fs *pb.FileSpec, cmdStorage CmdStorage
 			Name: fs.Path,
 		}, nil
 	}
-	d := &rpb.Digest{
-		Hash:      fs.Hash,
-		SizeBytes: fs.Size,
-	}
 	src := cmdFileObj{
 		storage: cmdStorage,
 		hash:    fs.Hash,
 	}
+	if digest.Function() != rpb.DigestFunction_SHA256 {
+		var data digest.Data
+		var err error
+		if digestCache != nil {
+			data, err = digestCache.Get(ctx, src.String(), src)
+		} else {
+			data, err = digest.FromSource(ctx, src)
+		}
+		if err != nil {
+			return merkletree.Entry{}, fmt.Errorf("%s: digest: %v", fs.Path, err)
+		}
+		return merkletree.Entry{
+			Name:         fs.Path,
+			Data:         data,
+			IsExecutable: fs.IsExecutable,
+		}, nil
+	}
+	d := &rpb.Digest{
+		Hash:      fs.Hash,
+		SizeBytes: fs.Size,
+	}
 	return merkletree.Entry{
 		Name:         fs.Path,
 		Data:         digest.New(src, d),
@@ -57,6 +78,38 @@ func fileSpecToEntry(ctx context.Context, fs *pb.FileSpec, cmdStorage CmdStorage
 	}, nil
 }
 
+// fileSpecsToEntries converts filespecs to merkletree entries.
+// Digests of independent files are computed concurrently, bounded by
+// the number of CPUs, as hashing large toolchain files is CPU-bound.
+// The entries are returned in the same order as fss.
+func fileSpecsToEntries(ctx context.Context, fss []*pb.FileSpec, cmdStorage CmdStorage, digestCache DigestCache) ([]merkletree.Entry, error) {
+	entries := make([]merkletree.Entry, len(fss))
+	sema := make(chan struct{}, runtime.NumCPU())
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, fs := range fss {
+		i, fs := i, fs
+		eg.Go(func() error {
+			select {
+			case sema <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sema }()
+			e, err := fileSpecToEntry(ctx, fs, cmdStorage, digestCache)
+			if err != nil {
+				return err
+			}
+			entries[i] = e
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
 type cmdFileObj struct {
 	storage CmdStorage
 	hash    string
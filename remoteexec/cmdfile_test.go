@@ -138,7 +138,7 @@ func TestFileSpecToEntry(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		entry, err := fileSpecToEntry(context.Background(), test.input, dummyCmdStorage{})
+		entry, err := fileSpecToEntry(context.Background(), test.input, dummyCmdStorage{}, nil)
 		if !reflect.DeepEqual(entry, test.wantEntry) || test.wantErr != (err != nil) {
 			t.Errorf("fileSpecToEntry(ctx, %v, dummyCmdStorage)=%v, %v, want=%v, wantErr=%v", test.input,
 				entry, err, test.wantEntry, test.wantErr)
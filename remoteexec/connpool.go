@@ -0,0 +1,67 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// ConnPool is a pool of connections to the same target.
+// Single connection could be a bottleneck at high concurrency due to
+// HTTP/2 max concurrent streams limit, so Client spreads calls over
+// connections in the pool in round-robin.
+type ConnPool struct {
+	conns []*grpc.ClientConn
+	next  uint32
+}
+
+// DialPool dials size connections to target.
+// size less than 1 is treated as 1.
+func DialPool(ctx context.Context, target string, size int, opts ...grpc.DialOption) (*ConnPool, error) {
+	if size < 1 {
+		size = 1
+	}
+	p := &ConnPool{}
+	for i := 0; i < size; i++ {
+		conn, err := grpc.DialContext(ctx, target, opts...)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	return p, nil
+}
+
+// NewConnPool creates a pool of conns.
+func NewConnPool(conns ...*grpc.ClientConn) *ConnPool {
+	return &ConnPool{conns: conns}
+}
+
+// Conn returns a connection in round-robin.
+func (p *ConnPool) Conn() *grpc.ClientConn {
+	n := atomic.AddUint32(&p.next, 1) - 1
+	return p.conns[n%uint32(len(p.conns))]
+}
+
+// Size returns number of connections in the pool.
+func (p *ConnPool) Size() int {
+	return len(p.conns)
+}
+
+// Close closes all connections in the pool.
+func (p *ConnPool) Close() error {
+	var err error
+	for _, conn := range p.conns {
+		cerr := conn.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestConnPool(t *testing.T) {
+	ctx := context.Background()
+	p, err := DialPool(ctx, "localhost:0", 3, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if got, want := p.Size(), 3; got != want {
+		t.Errorf("p.Size()=%d; want %d", got, want)
+	}
+	c := Client{Pool: p}
+	seen := make(map[*grpc.ClientConn]int)
+	for i := 0; i < 6; i++ {
+		seen[c.conn()]++
+	}
+	if len(seen) != 3 {
+		t.Errorf("conns=%d; want 3", len(seen))
+	}
+	for conn, n := range seen {
+		if n != 2 {
+			t.Errorf("conn %p used %d times; want 2", conn, n)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// DefaultMissingContinuationTTL is default TTL of MissingContinuation entries.
+const DefaultMissingContinuationTTL = 10 * time.Minute
+
+// continuationKey identifies a continuation.
+// Action digest is returned to client as cache_key in ExecResp, and
+// retry of the same request has the same action digest, so it works
+// as continuation token without changes in client.
+type continuationKey struct {
+	instance string
+	action   string
+}
+
+// blobKey identifies a blob in a continuation.
+type blobKey struct {
+	hash string
+	size int64
+}
+
+type continuationEntry struct {
+	present   map[blobKey]bool
+	expiresAt time.Time
+}
+
+// MissingContinuation remembers blobs verified to exist in CAS by
+// FindMissingBlobs for requests that failed with missing inputs, so
+// that retry of the request after client uploads the missing inputs
+// only checks remaining blobs.
+//
+// Blobs may be evicted from CAS after they were verified, so entries
+// expire after TTL. If evicted blob is used in action, RBE fails
+// the action with missing blobs, and it is handled as usual.
+type MissingContinuation struct {
+	// TTL of entries. DefaultMissingContinuationTTL if zero.
+	TTL time.Duration
+
+	mu  sync.Mutex
+	lru lru.Cache
+}
+
+// NewMissingContinuation creates new missing continuation with maxEntries
+// and ttl. maxEntries 0 means no limit.
+func NewMissingContinuation(maxEntries int, ttl time.Duration) *MissingContinuation {
+	c := &MissingContinuation{
+		TTL: ttl,
+	}
+	c.lru.MaxEntries = maxEntries
+	return c
+}
+
+func (c *MissingContinuation) ttl() time.Duration {
+	if c.TTL == 0 {
+		return DefaultMissingContinuationTTL
+	}
+	return c.TTL
+}
+
+// skip returns blobs in list that are not verified to exist
+// by previous attempt of the request.
+func (c *MissingContinuation) skip(ctx context.Context, instance string, action *rpb.Digest, list []*rpb.Digest) []*rpb.Digest {
+	if c == nil || action == nil {
+		return list
+	}
+	key := continuationKey{
+		instance: instance,
+		action:   action.GetHash(),
+	}
+	c.mu.Lock()
+	v, ok := c.lru.Get(key)
+	if ok && time.Now().After(v.(continuationEntry).expiresAt) {
+		c.lru.Remove(key)
+		ok = false
+	}
+	c.mu.Unlock()
+	op := "miss"
+	if ok {
+		op = "hit"
+		present := v.(continuationEntry).present
+		remaining := make([]*rpb.Digest, 0, len(list))
+		for _, d := range list {
+			if present[blobKey{hash: d.GetHash(), size: d.GetSizeBytes()}] {
+				continue
+			}
+			remaining = append(remaining, d)
+		}
+		stats.Record(ctx, missingContinuationSkipped.M(int64(len(list)-len(remaining))))
+		list = remaining
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(missingContinuationOpKey, op),
+	}, missingContinuationStats.M(1))
+	return list
+}
+
+// save saves blobs verified to exist for the request.
+// It extends the blobs verified by previous attempt.
+func (c *MissingContinuation) save(instance string, action *rpb.Digest, present []*rpb.Digest) {
+	if c == nil || action == nil {
+		return
+	}
+	key := continuationKey{
+		instance: instance,
+		action:   action.GetHash(),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var e continuationEntry
+	if v, ok := c.lru.Get(key); ok {
+		e = v.(continuationEntry)
+	} else {
+		e.present = make(map[blobKey]bool)
+	}
+	for _, d := range present {
+		e.present[blobKey{hash: d.GetHash(), size: d.GetSizeBytes()}] = true
+	}
+	e.expiresAt = time.Now().Add(c.ttl())
+	c.lru.Add(key, e)
+}
+
+// done removes continuation of the request.
+func (c *MissingContinuation) done(instance string, action *rpb.Digest) {
+	if c == nil || action == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Remove(continuationKey{
+		instance: instance,
+		action:   action.GetHash(),
+	})
+}
+
+// Len returns number of entries.
+func (c *MissingContinuation) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestMissingContinuation(t *testing.T) {
+	ctx := context.Background()
+	const instance = "projects/goma-dev/instances/default_instance"
+	action := &rpb.Digest{Hash: "action", SizeBytes: 10}
+	a := &rpb.Digest{Hash: "a", SizeBytes: 1}
+	b := &rpb.Digest{Hash: "b", SizeBytes: 2}
+	c := &rpb.Digest{Hash: "c", SizeBytes: 3}
+	list := []*rpb.Digest{a, b, c}
+
+	mc := NewMissingContinuation(10, time.Minute)
+	if diff := cmp.Diff(list, mc.skip(ctx, instance, action, list), protocmp.Transform()); diff != "" {
+		t.Errorf("skip before save: diff -want +got:\n%s", diff)
+	}
+
+	mc.save(instance, action, []*rpb.Digest{a})
+	mc.save(instance, action, []*rpb.Digest{b})
+	want := []*rpb.Digest{c}
+	if diff := cmp.Diff(want, mc.skip(ctx, instance, action, list), protocmp.Transform()); diff != "" {
+		t.Errorf("skip after save: diff -want +got:\n%s", diff)
+	}
+	if diff := cmp.Diff(list, mc.skip(ctx, "other", action, list), protocmp.Transform()); diff != "" {
+		t.Errorf("skip other instance: diff -want +got:\n%s", diff)
+	}
+	// different size is not verified.
+	b2 := &rpb.Digest{Hash: "b", SizeBytes: 20}
+	want = []*rpb.Digest{b2}
+	if diff := cmp.Diff(want, mc.skip(ctx, instance, action, []*rpb.Digest{b2}), protocmp.Transform()); diff != "" {
+		t.Errorf("skip different size: diff -want +got:\n%s", diff)
+	}
+
+	mc.done(instance, action)
+	if got := mc.Len(); got != 0 {
+		t.Errorf("Len()=%d after done; want 0", got)
+	}
+
+	mc = NewMissingContinuation(10, time.Nanosecond)
+	mc.save(instance, action, []*rpb.Digest{a, b})
+	time.Sleep(time.Millisecond)
+	if diff := cmp.Diff(list, mc.skip(ctx, instance, action, list), protocmp.Transform()); diff != "" {
+		t.Errorf("skip after expired: diff -want +got:\n%s", diff)
+	}
+
+	var nilmc *MissingContinuation
+	nilmc.save(instance, action, list)
+	if diff := cmp.Diff(list, nilmc.skip(ctx, instance, action, list), protocmp.Transform()); diff != "" {
+		t.Errorf("nil skip: diff -want +got:\n%s", diff)
+	}
+}
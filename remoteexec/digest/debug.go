@@ -0,0 +1,86 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// default number of hot keys to dump in debug handler.
+const defaultDebugHotKeys = 100
+
+// ServeHTTP dumps stats of the cache and the hottest keys.
+// Number of keys can be specified by "n" query parameter.
+//
+// It holds the cache lock while scanning all entries,
+// so it would block cache access for a while if the cache is large.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	n := defaultDebugHotKeys
+	if v := req.FormValue("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("bad n=%q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	c.mu.Lock()
+	entries := c.entries()
+	maxEntries := c.lru.MaxEntries
+	missing := c.missing.Len()
+	// copy hits while holding lock.
+	hits := make([]int64, len(entries))
+	for i, e := range entries {
+		hits[i] = e.entry.hits
+	}
+	c.mu.Unlock()
+
+	var size int64
+	origins := make(map[string]int)
+	for _, e := range entries {
+		size += e.entry.digest.GetSizeBytes()
+		origins[e.entry.origin]++
+	}
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return hits[idx[i]] > hits[idx[j]]
+	})
+	if n > len(idx) {
+		n = len(idx)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "entries: %d / max %d\n", len(entries), maxEntries)
+	fmt.Fprintf(w, "bytes: %d\n", size)
+	fmt.Fprintf(w, "missing entries: %d (ttl %s)\n", missing, c.MissingTTL)
+	var keys []string
+	for k := range origins {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "origin %s: %d\n", k, origins[k])
+	}
+	if len(entries) > 0 {
+		// entries are ordered from oldest to newest.
+		fmt.Fprintf(w, "oldest entry age: %s\n", time.Since(entries[0].entry.added))
+	}
+	fmt.Fprintf(w, "\nhottest %d keys:\n", n)
+	for _, i := range idx[:n] {
+		e := entries[i]
+		src := "-"
+		if e.entry.data != nil {
+			src = e.entry.data.String()
+		}
+		fmt.Fprintf(w, "%d %s %s/%d %s %s\n", hits[i], e.key, e.entry.digest.GetHash(), e.entry.digest.GetSizeBytes(), e.entry.origin, src)
+	}
+}
@@ -6,8 +6,6 @@ package digest
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"io"
 
@@ -15,7 +13,6 @@ import (
 
 	"google.golang.org/protobuf/proto"
 
-	"go.chromium.org/goma/server/hash"
 	"go.chromium.org/goma/server/remoteexec/datasource"
 )
 
@@ -60,7 +57,7 @@ func (d data) String() string {
 
 // Bytes creates data for bytes.
 func Bytes(name string, b []byte) Data {
-	h := hash.SHA256Content(b)
+	h := hashContent(b)
 	return data{
 		digest: &rpb.Digest{
 			Hash:      h,
@@ -86,14 +83,13 @@ func FromSource(ctx context.Context, src Source) (Data, error) {
 		return nil, err
 	}
 	defer f.Close()
-	h := sha256.New()
-	n, err := io.Copy(h, f)
+	h, n, err := hashReader(f)
 	if err != nil {
 		return nil, err
 	}
 	return data{
 		digest: &rpb.Digest{
-			Hash:      hex.EncodeToString(h.Sum(nil)),
+			Hash:      h,
 			SizeBytes: n,
 		},
 		source: src,
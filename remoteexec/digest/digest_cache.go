@@ -21,6 +21,7 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 	cachepb "go.chromium.org/goma/server/proto/cache"
 )
 
@@ -30,13 +31,25 @@ var (
 		"digest cache operations",
 		stats.UnitDimensionless)
 
+	cacheBytes = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec/digest.cache-bytes",
+		"total size of blobs in digest cache",
+		stats.UnitBytes)
+
+	evictAge = stats.Float64(
+		"go.chromium.org/goma/server/remoteexec/digest.evict-age",
+		"age of evicted digest cache entries",
+		"s")
+
 	opKey      = tag.MustNewKey("op")
 	fileExtKey = tag.MustNewKey("file_ext")
+	originKey  = tag.MustNewKey("origin")
 
 	DefaultViews = []*view.View{
 		{
 			Name:        "go.chromium.org/goma/server/remoteexec/digest.cache-entries",
 			Description: `number of digest cache entries`,
+			TagKeys:     metrics.TagKeys(),
 			Measure:     cacheStats,
 			Aggregation: view.Sum(),
 		},
@@ -44,21 +57,63 @@ var (
 			Name:        "go.chromium.org/goma/server/remoteexec/digest.cache-ops",
 			Description: `digest cache operations`,
 			Measure:     cacheStats,
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				opKey,
 				fileExtKey,
-			},
+				originKey,
+			),
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        "go.chromium.org/goma/server/remoteexec/digest.cache-bytes",
+			Description: `total size of blobs in digest cache`,
+			TagKeys:     metrics.TagKeys(),
+			Measure:     cacheBytes,
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        "go.chromium.org/goma/server/remoteexec/digest.evict-age",
+			Description: `age of evicted digest cache entries`,
+			TagKeys: metrics.TagKeys(
+				originKey,
+			),
+			Measure:     evictAge,
+			Aggregation: view.Distribution(1, 10, 60, 300, 600, 1800, 3600, 3*3600, 6*3600, 12*3600, 24*3600, 7*24*3600),
+		},
 	}
 )
 
+// cacheEntry is a value in the lru.
+type cacheEntry struct {
+	// data is nil for entry restored from snapshot until it is used.
+	data   Data
+	digest *rpb.Digest
+	origin string
+	added  time.Time
+	// hits is number of cache hits. protected by Cache.mu.
+	hits int64
+}
+
+// origins of cache entry.
+const (
+	originSource   = "source"
+	originCache    = "cache"
+	originSnapshot = "snapshot"
+)
+
 // Cache caches file's digest data.
 type Cache struct {
 	c cachepb.CacheServiceClient
 
-	mu  sync.Mutex
-	lru lru.Cache
+	// MissingTTL is TTL of negative entries for blobs missing in CAS.
+	// Concurrent requests using the same missing blobs don't need to
+	// query CAS for them again within the TTL.
+	// 0 disables negative entries.
+	MissingTTL time.Duration
+
+	mu      sync.Mutex
+	lru     lru.Cache
+	missing lru.Cache
 }
 
 // NewCache creates new cache for digest data.
@@ -68,6 +123,7 @@ func NewCache(c cachepb.CacheServiceClient, maxEntries int) *Cache {
 	}
 	cache.lru.MaxEntries = maxEntries
 	cache.lru.OnEvicted = cache.onEvicted
+	cache.missing.MaxEntries = maxEntries
 	return cache
 }
 
@@ -91,10 +147,30 @@ func (c *Cache) cacheGet(ctx context.Context, key string) (*rpb.Digest, error) {
 	return d, nil
 }
 
+// cacheExists reports whether key exists in cache client, without
+// fetching its value.
+func (c *Cache) cacheExists(ctx context.Context, key string) (bool, error) {
+	if c == nil || c.c == nil {
+		return false, errNoCacheClient
+	}
+	resp, err := c.c.Exists(ctx, &cachepb.ExistsReq{
+		Keys: []string{key},
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(resp.GetExists()) == 1 && resp.Exists[0], nil
+}
+
 func (c *Cache) cacheSet(ctx context.Context, key string, d *rpb.Digest) error {
 	if c == nil || c.c == nil {
 		return errNoCacheClient
 	}
+	// other servers may have set the same key while computing digest
+	// from source.
+	if ok, err := c.cacheExists(ctx, key); err == nil && ok {
+		return nil
+	}
 	v, err := proto.Marshal(d)
 	if err != nil {
 		return err
@@ -110,6 +186,8 @@ func (c *Cache) cacheSet(ctx context.Context, key string, d *rpb.Digest) error {
 
 // Get gets source's digest.
 func (c *Cache) Get(ctx context.Context, key string, src Source) (Data, error) {
+	// digests computed by other digest function should not be used.
+	key = keyPrefix() + key
 	var fileExt string
 	if gi, ok := src.(interface {
 		Filename() string
@@ -119,7 +197,17 @@ func (c *Cache) Get(ctx context.Context, key string, src Source) (Data, error) {
 
 	if c != nil {
 		c.mu.Lock()
-		data, ok := c.lru.Get(lru.Key(key))
+		var d Data
+		v, ok := c.lru.Get(lru.Key(key))
+		if ok {
+			e := v.(*cacheEntry)
+			e.hits++
+			if e.data == nil {
+				// restored from snapshot.
+				e.data = New(src, e.digest)
+			}
+			d = e.data
+		}
 		c.mu.Unlock()
 		if ok {
 			stats.RecordWithTags(ctx, []tag.Mutator{
@@ -128,7 +216,7 @@ func (c *Cache) Get(ctx context.Context, key string, src Source) (Data, error) {
 			}, cacheStats.M(0))
 			// stochastically put it to cache client
 			// to make lru/lfu work?
-			return data.(Data), nil
+			return d, nil
 		}
 	}
 	var keystr string
@@ -145,9 +233,7 @@ func (c *Cache) Get(ctx context.Context, key string, src Source) (Data, error) {
 		logger.Infof("digest cache get %s => %v: %s", keystr, dk, time.Since(start))
 		d := New(src, dk)
 		if c != nil {
-			c.mu.Lock()
-			c.lru.Add(lru.Key(key), d)
-			c.mu.Unlock()
+			c.add(ctx, key, d, originCache)
 			stats.RecordWithTags(ctx, []tag.Mutator{
 				tag.Upsert(opKey, "cache-get"),
 				tag.Upsert(fileExtKey, fileExt),
@@ -170,9 +256,7 @@ func (c *Cache) Get(ctx context.Context, key string, src Source) (Data, error) {
 		return nil, err
 	}
 	if c != nil {
-		c.mu.Lock()
-		c.lru.Add(lru.Key(key), d)
-		c.mu.Unlock()
+		c.add(ctx, key, d, originSource)
 		logger.Infof("digest cache set %s => %v: %s", keystr, d, time.Since(start))
 		err = c.cacheSet(ctx, key, d.Digest())
 		op := "cache-set"
@@ -188,13 +272,33 @@ func (c *Cache) Get(ctx context.Context, key string, src Source) (Data, error) {
 	return d, nil
 }
 
+// add adds d for key in the lru.
+func (c *Cache) add(ctx context.Context, key string, d Data, origin string) {
+	size := d.Digest().GetSizeBytes()
+	c.mu.Lock()
+	if v, ok := c.lru.Get(lru.Key(key)); ok {
+		// replaced without eviction.
+		size -= v.(*cacheEntry).digest.GetSizeBytes()
+	}
+	c.lru.Add(lru.Key(key), &cacheEntry{
+		data:   d,
+		digest: d.Digest(),
+		origin: origin,
+		added:  time.Now(),
+	})
+	c.mu.Unlock()
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(originKey, origin),
+	}, cacheBytes.M(size))
+}
+
 func (c *Cache) onEvicted(k lru.Key, value interface{}) {
 	ctx := context.Background()
 	logger := log.FromContext(ctx)
 	key := k.(string)
+	e := value.(*cacheEntry)
 	var filename, fileExt string
-	d := value.(Data)
-	if dd, ok := d.(data); ok {
+	if dd, ok := e.data.(data); ok {
 		src := dd.source
 		if gi, ok := src.(interface {
 			Filename() string
@@ -203,11 +307,13 @@ func (c *Cache) onEvicted(k lru.Key, value interface{}) {
 			fileExt = filepathExt(gi.Filename())
 		}
 	}
-	logger.Infof("digest cache evict %s %s %q", key, d.Digest(), filename)
+	age := time.Since(e.added)
+	logger.Infof("digest cache evict %s %s %q origin=%s age=%s hits=%d", key, e.digest, filename, e.origin, age, e.hits)
 	stats.RecordWithTags(ctx, []tag.Mutator{
 		tag.Upsert(opKey, "evict"),
 		tag.Upsert(fileExtKey, fileExt),
-	}, cacheStats.M(-1))
+		tag.Upsert(originKey, e.origin),
+	}, cacheStats.M(-1), cacheBytes.M(-e.digest.GetSizeBytes()), evictAge.M(age.Seconds()))
 }
 
 func filepathExt(fname string) string {
@@ -4,7 +4,12 @@ package digest
 
 import (
 	"context"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 
 	"go.chromium.org/goma/server/cache"
 )
@@ -36,3 +41,65 @@ func TestCacheGet(t *testing.T) {
 		t.Errorf("Get(ctx, 12, 'second')=%v; want %v", d2, want)
 	}
 }
+
+func TestCacheKnownMissing(t *testing.T) {
+	ctx := context.Background()
+	dc := NewCache(nil, 1000)
+	d1 := Bytes("d1", []byte("d1")).Digest()
+	d2 := Bytes("d2", []byte("d2")).Digest()
+
+	dc.SetMissing("inst", []*rpb.Digest{d1})
+	missing, unknown := dc.KnownMissing(ctx, "inst", []*rpb.Digest{d1, d2})
+	if len(missing) != 0 || len(unknown) != 2 {
+		t.Errorf("KnownMissing(d1, d2)=%v, %v; want no missing without ttl", missing, unknown)
+	}
+
+	dc.MissingTTL = time.Minute
+	dc.SetMissing("inst", []*rpb.Digest{d1})
+	missing, unknown = dc.KnownMissing(ctx, "inst", []*rpb.Digest{d1, d2})
+	if len(missing) != 1 || missing[0] != d1 || len(unknown) != 1 || unknown[0] != d2 {
+		t.Errorf("KnownMissing(d1, d2)=%v, %v; want [d1], [d2]", missing, unknown)
+	}
+	missing, _ = dc.KnownMissing(ctx, "other", []*rpb.Digest{d1, d2})
+	if len(missing) != 0 {
+		t.Errorf("KnownMissing(other, d1, d2)=%v; want no missing in other instance", missing)
+	}
+
+	dc.ClearMissing("inst", []*rpb.Digest{d1})
+	missing, _ = dc.KnownMissing(ctx, "inst", []*rpb.Digest{d1, d2})
+	if len(missing) != 0 {
+		t.Errorf("KnownMissing(d1, d2)=%v after ClearMissing; want no missing", missing)
+	}
+
+	dc.MissingTTL = time.Nanosecond
+	dc.SetMissing("inst", []*rpb.Digest{d1})
+	time.Sleep(time.Millisecond)
+	dc.MissingTTL = time.Minute
+	missing, _ = dc.KnownMissing(ctx, "inst", []*rpb.Digest{d1, d2})
+	if len(missing) != 0 {
+		t.Errorf("KnownMissing(d1, d2)=%v after expired; want no missing", missing)
+	}
+}
+
+func TestCacheServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	dc := NewCache(nil, 1000)
+	for _, k := range []string{"cold", "hot", "hot", "hot", "warm", "warm"} {
+		_, err := dc.Get(ctx, k, Bytes(k, []byte(k)))
+		if err != nil {
+			t.Fatalf("Get(ctx, %q)=_, %v; want nil error", k, err)
+		}
+	}
+	req := httptest.NewRequest("GET", "/debug/digestcache?n=2", nil)
+	w := httptest.NewRecorder()
+	dc.ServeHTTP(w, req)
+	body := w.Body.String()
+	for _, want := range []string{"entries: 3 / max 1000\n", "bytes: 11\n", "origin source: 3\n", "\n2 hot ", "\n1 warm "} {
+		if !strings.Contains(body, want) {
+			t.Errorf("ServeHTTP: body=%q; want to contain %q", body, want)
+		}
+	}
+	if strings.Contains(body, " cold ") {
+		t.Errorf("ServeHTTP: body=%q; want not to contain cold key", body)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+	"sync/atomic"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+// hash functions for supported digest functions.
+// SHA256TREE and BLAKE3 are not supported (not defined in remote-apis
+// version we use).
+var hashFuncs = map[rpb.DigestFunction_Value]func() hash.Hash{
+	rpb.DigestFunction_SHA256: sha256.New,
+	rpb.DigestFunction_SHA1:   sha1.New,
+	rpb.DigestFunction_MD5:    md5.New,
+	rpb.DigestFunction_SHA384: sha512.New384,
+	rpb.DigestFunction_SHA512: sha512.New,
+}
+
+// function is current digest function (rpb.DigestFunction_Value).
+var function int32 = int32(rpb.DigestFunction_SHA256)
+
+// Function returns current digest function.
+func Function() rpb.DigestFunction_Value {
+	return rpb.DigestFunction_Value(atomic.LoadInt32(&function))
+}
+
+// SetFunction sets digest function used to compute digests.
+// It should be called before computing any digests, typically
+// when the RBE backend capabilities are negotiated.
+func SetFunction(f rpb.DigestFunction_Value) error {
+	if !Supported(f) {
+		return fmt.Errorf("unsupported digest function %v", f)
+	}
+	atomic.StoreInt32(&function, int32(f))
+	return nil
+}
+
+// Supported reports whether digest function f is supported.
+func Supported(f rpb.DigestFunction_Value) bool {
+	_, ok := hashFuncs[f]
+	return ok
+}
+
+// ParseFunction parses digest function name, e.g. "SHA256".
+func ParseFunction(name string) (rpb.DigestFunction_Value, error) {
+	v, ok := rpb.DigestFunction_Value_value[strings.ToUpper(name)]
+	if !ok || !Supported(rpb.DigestFunction_Value(v)) {
+		return rpb.DigestFunction_UNKNOWN, fmt.Errorf("unsupported digest function %q", name)
+	}
+	return rpb.DigestFunction_Value(v), nil
+}
+
+// Negotiate selects digest function from functions advertised by
+// the RBE backend. It prefers preferred if it is advertised.
+// Empty advertised means the backend only supports SHA256.
+func Negotiate(preferred rpb.DigestFunction_Value, advertised []rpb.DigestFunction_Value) (rpb.DigestFunction_Value, error) {
+	if preferred == rpb.DigestFunction_UNKNOWN {
+		preferred = rpb.DigestFunction_SHA256
+	}
+	if len(advertised) == 0 {
+		advertised = []rpb.DigestFunction_Value{rpb.DigestFunction_SHA256}
+	}
+	for _, f := range advertised {
+		if f == preferred && Supported(f) {
+			return f, nil
+		}
+	}
+	for _, f := range advertised {
+		if f == rpb.DigestFunction_SHA256 {
+			return f, nil
+		}
+	}
+	for _, f := range advertised {
+		if Supported(f) {
+			return f, nil
+		}
+	}
+	return rpb.DigestFunction_UNKNOWN, fmt.Errorf("no supported digest function in %v", advertised)
+}
+
+// hashContent returns hex encoded digest hash of b.
+func hashContent(b []byte) string {
+	f, h := getHash()
+	defer putHash(f, h)
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keyPrefix returns prefix of cache key for current digest function.
+// It is empty for SHA256 for compatibility.
+func keyPrefix() string {
+	f := Function()
+	if f == rpb.DigestFunction_SHA256 {
+		return ""
+	}
+	return strings.ToLower(f.String()) + ":"
+}
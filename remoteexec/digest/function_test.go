@@ -0,0 +1,78 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		preferred  rpb.DigestFunction_Value
+		advertised []rpb.DigestFunction_Value
+		want       rpb.DigestFunction_Value
+		wantErr    bool
+	}{
+		{
+			want: rpb.DigestFunction_SHA256,
+		},
+		{
+			preferred: rpb.DigestFunction_SHA512,
+			want:      rpb.DigestFunction_SHA256,
+		},
+		{
+			preferred:  rpb.DigestFunction_SHA512,
+			advertised: []rpb.DigestFunction_Value{rpb.DigestFunction_SHA256, rpb.DigestFunction_SHA512},
+			want:       rpb.DigestFunction_SHA512,
+		},
+		{
+			preferred:  rpb.DigestFunction_SHA512,
+			advertised: []rpb.DigestFunction_Value{rpb.DigestFunction_SHA1, rpb.DigestFunction_SHA256},
+			want:       rpb.DigestFunction_SHA256,
+		},
+		{
+			advertised: []rpb.DigestFunction_Value{rpb.DigestFunction_VSO, rpb.DigestFunction_SHA1},
+			want:       rpb.DigestFunction_SHA1,
+		},
+		{
+			advertised: []rpb.DigestFunction_Value{rpb.DigestFunction_VSO},
+			wantErr:    true,
+		},
+	} {
+		got, err := Negotiate(tc.preferred, tc.advertised)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("Negotiate(%v, %v)=%v, %v; want %v, err=%t", tc.preferred, tc.advertised, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestSetFunction(t *testing.T) {
+	defer SetFunction(rpb.DigestFunction_SHA256)
+
+	f, err := ParseFunction("sha1")
+	if err != nil || f != rpb.DigestFunction_SHA1 {
+		t.Fatalf("ParseFunction(sha1)=%v, %v; want SHA1, nil", f, err)
+	}
+	if f, err := ParseFunction("VSO"); err == nil {
+		t.Errorf("ParseFunction(VSO)=%v, nil; want error", f)
+	}
+	err = SetFunction(f)
+	if err != nil {
+		t.Fatalf("SetFunction(%v)=%v; want nil error", f, err)
+	}
+	d := Bytes("hello", []byte("hello")).Digest()
+	// sha1sum of "hello".
+	if got, want := d.Hash, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"; got != want {
+		t.Errorf("Bytes(hello).Digest().Hash=%q; want %q", got, want)
+	}
+	if got, want := keyPrefix(), "sha1:"; got != want {
+		t.Errorf("keyPrefix()=%q; want %q", got, want)
+	}
+	if err := SetFunction(rpb.DigestFunction_VSO); err == nil {
+		t.Errorf("SetFunction(VSO)=nil; want error")
+	}
+}
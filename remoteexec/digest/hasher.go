@@ -0,0 +1,117 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"runtime"
+	"sync"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// crypto/sha256 and crypto/sha512 select hardware-accelerated
+// implementations (SHA-NI, AVX2 on amd64, SHA2 instructions on arm64)
+// at runtime, so hashing speed is mostly bound by how much we feed
+// them per call and how many of them run in parallel.
+// hashers keeps hash states and copy buffers in pools to avoid
+// allocations per input, and FromSources hashes independent sources
+// concurrently.
+
+// hashBufSize is size of buffer used to feed data to hash.
+// larger buffer reduces the number of Read/Write calls for large inputs.
+const hashBufSize = 1 << 20
+
+var (
+	hashPools sync.Map // rpb.DigestFunction_Value -> *sync.Pool
+
+	hashBufPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, hashBufSize)
+			return &b
+		},
+	}
+)
+
+// getHash gets hash.Hash for current digest function from pool.
+// It must be returned by putHash with the same f.
+func getHash() (rpb.DigestFunction_Value, hash.Hash) {
+	f := Function()
+	p, ok := hashPools.Load(f)
+	if !ok {
+		newFunc := hashFuncs[f]
+		p, _ = hashPools.LoadOrStore(f, &sync.Pool{
+			New: func() interface{} {
+				return newFunc()
+			},
+		})
+	}
+	h := p.(*sync.Pool).Get().(hash.Hash)
+	h.Reset()
+	return f, h
+}
+
+func putHash(f rpb.DigestFunction_Value, h hash.Hash) {
+	p, ok := hashPools.Load(f)
+	if !ok {
+		return
+	}
+	p.(*sync.Pool).Put(h)
+}
+
+// hashReader returns hex encoded digest hash and size of r.
+func hashReader(r io.Reader) (string, int64, error) {
+	f, h := getHash()
+	defer putHash(f, h)
+	bufp := hashBufPool.Get().(*[]byte)
+	defer hashBufPool.Put(bufp)
+	// use CopyBuffer with plain writer/reader to make sure
+	// our buffer is used, rather than WriterTo/ReaderFrom.
+	n, err := io.CopyBuffer(struct{ io.Writer }{h}, struct{ io.Reader }{r}, *bufp)
+	if err != nil {
+		return "", n, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// FromSources creates digests from srcs concurrently.
+// It hashes at most concurrency sources at once.
+// If concurrency <= 0, runtime.NumCPU() is used, since hashing is
+// CPU-bound.
+// It returns the first error if any source failed.
+func FromSources(ctx context.Context, srcs []Source, concurrency int) ([]Data, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	datas := make([]Data, len(srcs))
+	sema := make(chan struct{}, concurrency)
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, src := range srcs {
+		i, src := i, src
+		eg.Go(func() error {
+			select {
+			case sema <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sema }()
+			d, err := FromSource(ctx, src)
+			if err != nil {
+				return err
+			}
+			datas[i] = d
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return datas, nil
+}
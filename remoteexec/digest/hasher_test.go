@@ -0,0 +1,111 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+
+	"go.chromium.org/goma/server/remoteexec/datasource"
+)
+
+func TestFromSources(t *testing.T) {
+	ctx := context.Background()
+	var srcs []Source
+	var want []string
+	for i := 0; i < 20; i++ {
+		b := bytes.Repeat([]byte{byte(i)}, i*hashBufSize/4)
+		srcs = append(srcs, datasource.Bytes(fmt.Sprintf("src%d", i), b))
+		h := sha256.Sum256(b)
+		want = append(want, hex.EncodeToString(h[:]))
+	}
+	datas, err := FromSources(ctx, srcs, 4)
+	if err != nil {
+		t.Fatalf("FromSources(ctx, srcs, 4)=_, %v; want nil err", err)
+	}
+	if len(datas) != len(srcs) {
+		t.Fatalf("FromSources(ctx, srcs, 4) returns %d datas; want %d", len(datas), len(srcs))
+	}
+	for i, d := range datas {
+		if got := d.Digest().GetHash(); got != want[i] {
+			t.Errorf("datas[%d].Digest().Hash=%q; want %q", i, got, want[i])
+		}
+		if got, want := d.Digest().GetSizeBytes(), int64(i*hashBufSize/4); got != want {
+			t.Errorf("datas[%d].Digest().SizeBytes=%d; want %d", i, got, want)
+		}
+	}
+}
+
+func TestHashPoolPerFunction(t *testing.T) {
+	defer func() {
+		err := SetFunction(rpb.DigestFunction_SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := []byte("hello")
+	sha256Hash := hashContent(b)
+	err := SetFunction(rpb.DigestFunction_SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha512Hash := hashContent(b)
+	if len(sha512Hash) != 128 {
+		t.Errorf("sha512 hash=%q; want 128 hex digits", sha512Hash)
+	}
+	err = SetFunction(rpb.DigestFunction_SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hashContent(b); got != sha256Hash {
+		t.Errorf("sha256 hash=%q; want %q", got, sha256Hash)
+	}
+}
+
+func benchmarkFromSource(b *testing.B, size int) {
+	ctx := context.Background()
+	src := datasource.Bytes("bench", bytes.Repeat([]byte{'x'}, size))
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := FromSource(ctx, src)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFromSource4KiB(b *testing.B)  { benchmarkFromSource(b, 4<<10) }
+func BenchmarkFromSource1MiB(b *testing.B)  { benchmarkFromSource(b, 1<<20) }
+func BenchmarkFromSource64MiB(b *testing.B) { benchmarkFromSource(b, 64<<20) }
+
+func benchmarkFromSources(b *testing.B, concurrency int) {
+	ctx := context.Background()
+	const n = 32
+	const size = 4 << 20
+	var srcs []Source
+	for i := 0; i < n; i++ {
+		srcs = append(srcs, datasource.Bytes(fmt.Sprintf("bench%d", i), bytes.Repeat([]byte{byte(i)}, size)))
+	}
+	b.SetBytes(n * size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := FromSources(ctx, srcs, concurrency)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFromSourcesSerial(b *testing.B)   { benchmarkFromSources(b, 1) }
+func BenchmarkFromSourcesParallel(b *testing.B) { benchmarkFromSources(b, 0) }
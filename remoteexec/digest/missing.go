@@ -0,0 +1,74 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+func missingKey(instance string, d *rpb.Digest) lru.Key {
+	return fmt.Sprintf("%s/%s/%d", instance, d.Hash, d.SizeBytes)
+}
+
+// KnownMissing splits blobs into blobs known to be missing in CAS of
+// instance, and the other blobs.
+func (c *Cache) KnownMissing(ctx context.Context, instance string, blobs []*rpb.Digest) (missing, unknown []*rpb.Digest) {
+	if c == nil || c.MissingTTL <= 0 {
+		return nil, blobs
+	}
+	now := time.Now()
+	c.mu.Lock()
+	for _, d := range blobs {
+		v, ok := c.missing.Get(missingKey(instance, d))
+		if ok && now.Before(v.(time.Time)) {
+			missing = append(missing, d)
+			continue
+		}
+		if ok {
+			c.missing.Remove(missingKey(instance, d))
+		}
+		unknown = append(unknown, d)
+	}
+	c.mu.Unlock()
+	if len(missing) > 0 {
+		stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(opKey, "missing-hit"),
+		}, cacheStats.M(0))
+	}
+	return missing, unknown
+}
+
+// SetMissing records blobs are missing in CAS of instance.
+func (c *Cache) SetMissing(instance string, blobs []*rpb.Digest) {
+	if c == nil || c.MissingTTL <= 0 {
+		return
+	}
+	expire := time.Now().Add(c.MissingTTL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range blobs {
+		c.missing.Add(missingKey(instance, d), expire)
+	}
+}
+
+// ClearMissing clears negative entries for blobs in instance,
+// e.g. after the blobs are uploaded.
+func (c *Cache) ClearMissing(instance string, blobs []*rpb.Digest) {
+	if c == nil || c.MissingTTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range blobs {
+		c.missing.Remove(missingKey(instance, d))
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// snapshotEntry is an entry of digest cache snapshot.
+type snapshotEntry struct {
+	key   string
+	entry *cacheEntry
+}
+
+// entries returns entries in the lru, from oldest to newest.
+// c.mu must be held.
+func (c *Cache) entries() []snapshotEntry {
+	// groupcache lru doesn't provide iteration, so drain the lru
+	// and add entries back in the same order.
+	onEvicted := c.lru.OnEvicted
+	c.lru.OnEvicted = nil
+	defer func() {
+		c.lru.OnEvicted = onEvicted
+	}()
+	type kv struct {
+		key   lru.Key
+		value interface{}
+	}
+	var kvs []kv
+	for c.lru.Len() > 0 {
+		var e kv
+		c.lru.OnEvicted = func(k lru.Key, v interface{}) {
+			e = kv{key: k, value: v}
+		}
+		c.lru.RemoveOldest()
+		kvs = append(kvs, e)
+	}
+	c.lru.OnEvicted = nil
+	entries := make([]snapshotEntry, 0, len(kvs))
+	for _, e := range kvs {
+		c.lru.Add(e.key, e.value)
+		entries = append(entries, snapshotEntry{
+			key:   e.key.(string),
+			entry: e.value.(*cacheEntry),
+		})
+	}
+	return entries
+}
+
+// Snapshot writes digest cache entries to w.
+// Each line is "<key> <hash> <size>", from oldest to newest.
+// It returns number of entries written.
+func (c *Cache) Snapshot(w io.Writer) (int, error) {
+	c.mu.Lock()
+	entries := c.entries()
+	c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	n := 0
+	for _, e := range entries {
+		d := e.entry.digest
+		_, err := fmt.Fprintf(bw, "%s %s %d\n", e.key, d.Hash, d.SizeBytes)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, bw.Flush()
+}
+
+// Restore reads digest cache entries written by Snapshot from r,
+// and adds them to the cache.
+// Restored entries don't have source, so Get will use source given
+// by the caller when it hits restored entries.
+// It returns number of entries restored.
+func (c *Cache) Restore(r io.Reader) (int, error) {
+	s := bufio.NewScanner(r)
+	var entries []snapshotEntry
+	for lineno := 1; s.Scan(); lineno++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("line %d: wrong number of fields: %q", lineno, s.Text())
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: wrong size: %v", lineno, err)
+		}
+		entries = append(entries, snapshotEntry{
+			key: fields[0],
+			entry: &cacheEntry{
+				digest: &rpb.Digest{
+					Hash:      fields[1],
+					SizeBytes: size,
+				},
+				origin: originSnapshot,
+			},
+		})
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	var size int64
+	now := time.Now()
+	c.mu.Lock()
+	for _, e := range entries {
+		if _, ok := c.lru.Get(lru.Key(e.key)); ok {
+			// keep entry added after start.
+			continue
+		}
+		e.entry.added = now
+		c.lru.Add(lru.Key(e.key), e.entry)
+		n++
+		size += e.entry.digest.SizeBytes
+	}
+	c.mu.Unlock()
+	stats.RecordWithTags(context.Background(), []tag.Mutator{
+		tag.Upsert(opKey, "restore"),
+		tag.Upsert(originKey, originSnapshot),
+	}, cacheStats.M(int64(n)), cacheBytes.M(size))
+	return n, nil
+}
+
+// SaveFile saves snapshot of the cache in fname.
+func (c *Cache) SaveFile(fname string) (int, error) {
+	f, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.Snapshot(f)
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return n, err
+	}
+	err = os.Rename(f.Name(), fname)
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return n, err
+}
+
+// LoadFile loads snapshot of the cache from fname.
+func (c *Cache) LoadFile(fname string) (int, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return c.Restore(f)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package digest
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCacheSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dc := NewCache(nil, 1000)
+	srcs := map[string]Data{
+		"k1": Bytes("first", []byte("first")),
+		"k2": Bytes("second", []byte("second")),
+	}
+	for _, k := range []string{"k1", "k2"} {
+		_, err := dc.Get(ctx, k, srcs[k])
+		if err != nil {
+			t.Fatalf("Get(ctx, %q, %v)=_, %v; want nil error", k, srcs[k], err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := dc.Snapshot(&buf)
+	if err != nil || n != 2 {
+		t.Fatalf("Snapshot()=%d, %v; want 2, nil", n, err)
+	}
+	want := "k1 " + srcs["k1"].Digest().Hash + " 5\n" +
+		"k2 " + srcs["k2"].Digest().Hash + " 6\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Snapshot()=%q; want %q", got, want)
+	}
+	// snapshot should not drop entries.
+	if got := dc.lru.Len(); got != 2 {
+		t.Errorf("lru.Len()=%d after Snapshot; want 2", got)
+	}
+
+	rc := NewCache(nil, 1000)
+	n, err = rc.Restore(bytes.NewReader(buf.Bytes()))
+	if err != nil || n != 2 {
+		t.Fatalf("Restore()=%d, %v; want 2, nil", n, err)
+	}
+	// restored entry should be used even if src has different content.
+	src := Bytes("other", []byte("other"))
+	d, err := rc.Get(ctx, "k1", src)
+	if err != nil {
+		t.Fatalf("Get(ctx, k1, other)=_, %v; want nil error", err)
+	}
+	if !proto.Equal(d.Digest(), srcs["k1"].Digest()) {
+		t.Errorf("Get(ctx, k1, other).Digest()=%v; want %v", d.Digest(), srcs["k1"].Digest())
+	}
+	if got, want := d.String(), New(src, srcs["k1"].Digest()).String(); got != want {
+		t.Errorf("Get(ctx, k1, other)=%v; want %v", got, want)
+	}
+
+	_, err = rc.Restore(bytes.NewReader([]byte("k1 broken\n")))
+	if err == nil {
+		t.Errorf("Restore(broken)=_, nil; want error")
+	}
+}
+
+func TestCacheSaveLoadFile(t *testing.T) {
+	ctx := context.Background()
+	fname := filepath.Join(t.TempDir(), "digest-cache")
+	dc := NewCache(nil, 1000)
+	src := Bytes("first", []byte("first"))
+	_, err := dc.Get(ctx, "k1", src)
+	if err != nil {
+		t.Fatalf("Get(ctx, k1, first)=_, %v; want nil error", err)
+	}
+	n, err := dc.SaveFile(fname)
+	if err != nil || n != 1 {
+		t.Fatalf("SaveFile(%q)=%d, %v; want 1, nil", fname, n, err)
+	}
+	rc := NewCache(nil, 1000)
+	n, err = rc.LoadFile(fname)
+	if err != nil || n != 1 {
+		t.Fatalf("LoadFile(%q)=%d, %v; want 1, nil", fname, n, err)
+	}
+	_, err = NewCache(nil, 1000).LoadFile(fname + ".missing")
+	if err == nil {
+		t.Errorf("LoadFile(missing)=_, nil; want error")
+	}
+}
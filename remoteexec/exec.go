@@ -11,7 +11,6 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -34,11 +33,14 @@ import (
 	"go.chromium.org/goma/server/command/descriptor/winpath"
 	"go.chromium.org/goma/server/exec"
 	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/log/redact"
 	gomapb "go.chromium.org/goma/server/proto/api"
 	cmdpb "go.chromium.org/goma/server/proto/command"
+	execpb "go.chromium.org/goma/server/proto/exec"
 	"go.chromium.org/goma/server/remoteexec/cas"
 	"go.chromium.org/goma/server/remoteexec/digest"
 	"go.chromium.org/goma/server/remoteexec/merkletree"
+	"go.chromium.org/goma/server/remoteexec/provenance"
 	"go.chromium.org/goma/server/rpc"
 )
 
@@ -48,8 +50,22 @@ type request struct {
 	gomaReq   *gomapb.ExecReq
 	gomaResp  *gomapb.ExecResp
 
-	client Client
-	cas    *cas.CAS
+	// route is request to route by Adapter.Router.
+	route RouteRequest
+	// backend is RBE backend picked by Adapter.Router, or nil
+	// if Adapter.Client is used.
+	backend *Backend
+	client  Client
+	cas     *cas.CAS
+
+	// spanTimeout is timeout of each span, i.e. Adapter.SpanTimeout
+	// overridden by Adapter.TimeoutPolicy.
+	spanTimeout SpanTimeout
+
+	// inputLimit is limit of inputs by Adapter.InputLimitPolicy.
+	inputLimit InputLimitRule
+	// priority is priority by Adapter.PriorityPolicy.
+	priority PriorityRule
 
 	cmdConfig *cmdpb.Config
 	cmdFiles  []*cmdpb.FileSpec
@@ -61,6 +77,14 @@ type request struct {
 	filepath    clientFilePath
 	cmdFilepath clientFilePath
 
+	// macDeveloperDir is client's developer dir relocated in input root
+	// for mac request.
+	macDeveloperDir string
+
+	// normalizer maps client's input root dir to canonical input root
+	// dir if Adapter.NormalizeInputRoot is set.
+	normalizer *inputRootNormalizer
+
 	args         []string
 	envs         []string
 	outputs      []string
@@ -71,9 +95,22 @@ type request struct {
 
 	allowChroot bool
 	needChroot  bool
+	wrapperType wrapperType
+
+	// localOutputs holds outputs of local execution if the action
+	// was executed by Adapter.LocalFallback.
+	localOutputs *digest.Store
 
 	crossTarget string
 
+	journal *JournalRecord
+
+	// opName is name of RBE operation that executed the action.
+	opName string
+
+	// verified holds blobs verified to exist in CAS by missingBlobs.
+	verified []*rpb.Digest
+
 	err error
 }
 
@@ -120,7 +157,7 @@ func createEnvVars(ctx context.Context, envs []string) []*rpb.Command_Environmen
 		key, value := e[0], e[1]
 		storedValue, ok := envMap[key]
 		if ok {
-			logger.Infof("Duplicate env var: %s=%s => %s", key, storedValue, value)
+			logger.Infof("Duplicate env var: %s => %s", redact.String(key+"="+storedValue), redact.String(key+"="+value))
 		}
 		envMap[key] = value
 	}
@@ -176,11 +213,24 @@ func (r *request) Err() error {
 }
 
 func (r *request) instanceName() string {
-	basename := r.cmdConfig.GetRemoteexecPlatform().GetRbeInstanceBasename()
-	if basename == "" {
-		return r.f.Instance()
+	basename, ok := r.f.GroupInstances[r.userGroup]
+	if !ok {
+		basename = r.cmdConfig.GetRemoteexecPlatform().GetRbeInstanceBasename()
 	}
-	return path.Join(r.f.InstancePrefix, basename)
+	return r.backend.instanceName(r.f.InstancePrefix, r.f.instanceName(basename))
+}
+
+// setBackend switches r to backend b to fail over.
+// Blobs are checked and uploaded again in b, since b has its own CAS.
+func (r *request) setBackend(ctx context.Context, b *Backend) {
+	r.backend = b
+	r.client = r.f.backendClient(ctx, b)
+	r.cas.Client = r.client
+	r.verified = nil
+	r.err = nil
+	r.journal.Update(ctx, func(e *JournalEntry) {
+		e.Instance = r.instanceName()
+	})
 }
 
 // getInventoryData looks up Config and FileSpec from Inventory, and creates
@@ -240,11 +290,79 @@ func (r *request) getInventoryData(ctx context.Context) *gomapb.ExecResp {
 			return r.gomaResp
 		}
 	}
+	if osFamily := osFamilyFromDimensions(r.gomaReq.GetRequesterInfo().GetDimensions()); osFamily != "" && r.gomaReq.GetToolchainIncluded() && platformOSFamily(r.platform) == "unspecified" {
+		r.addPlatformProperty(ctx, "OSFamily", osFamily)
+	}
+	if r.windowsNative() {
+		switch osFamily := platformOSFamily(r.platform); osFamily {
+		case "unspecified":
+			r.addPlatformProperty(ctx, "OSFamily", "Windows")
+		case "Windows":
+		default:
+			logger.Warnf("windows path type without windows cross, but OSFamily=%s", osFamily)
+		}
+	}
+	if r.macNative() {
+		if p, ok := xcrunCompiler(cmdFiles[0].Path, r.gomaReq.GetToolchainSpecs()); ok {
+			logger.Infof("xcrun %s -> %s", cmdFiles[0].Path, p)
+			cmdFiles[0] = proto.Clone(cmdFiles[0]).(*cmdpb.FileSpec)
+			cmdFiles[0].Path = p
+		}
+		dir, ok := macDeveloperDir(cmdFiles[0].Path)
+		if !ok {
+			sysroot, _ := sysrootDir(r.gomaReq.Arg)
+			dir, ok = macDeveloperDir(sysroot)
+		}
+		if ok {
+			logger.Infof("relocate developer dir %s", dir)
+			r.macDeveloperDir = dir
+		}
+	}
 	r.allowChroot = cmdConfig.GetRemoteexecPlatform().GetHasNsjail()
 	logger.Infof("platform: %s, allowChroot=%t path_tpye=%s windows_cross=%t", r.platform, r.allowChroot, cmdConfig.GetCmdDescriptor().GetSetup().GetPathType(), cmdConfig.GetCmdDescriptor().GetCross().GetWindowsCross())
 	return nil
 }
 
+// windowsNative reports whether the request runs on windows workers,
+// i.e. windows path type without windows cross.
+func (r *request) windowsNative() bool {
+	_, ok := r.filepath.(winpath.FilePath)
+	return ok && !r.cmdConfig.GetCmdDescriptor().GetCross().GetWindowsCross()
+}
+
+// macNative reports whether the request runs on mac workers.
+func (r *request) macNative() bool {
+	_, ok := r.filepath.(posixpath.FilePath)
+	return ok && platformOSFamily(r.platform) == "MacOS"
+}
+
+// rootRel returns relative path of fname in input root.
+// fname in mac developer dir is relocated in input root.
+func (r *request) rootRel(filepath clientFilePath, fname, cwd, rootDir string) (string, error) {
+	if r.macDeveloperDir != "" {
+		if !filepath.IsAbs(fname) {
+			fname = filepath.Join(cwd, fname)
+		}
+		if p, ok := macRelocatePath(r.macDeveloperDir, filepath.Clean(fname)); ok {
+			return p, nil
+		}
+	}
+	return rootRel(filepath, fname, cwd, rootDir)
+}
+
+// useDebugPrefixMap reports whether debug prefix map is enabled
+// for the command of cmdConfig.
+func useDebugPrefixMap(cmdConfig *cmdpb.Config) bool {
+	if !cmdConfig.GetRemoteexecPlatform().GetDebugPrefixMap() {
+		return false
+	}
+	switch cmdConfig.GetCmdDescriptor().GetSelector().GetName() {
+	case "gcc", "g++", "clang", "clang++":
+		return true
+	}
+	return false
+}
+
 func isSafePlatformProperty(name, value string) bool {
 	switch name {
 	case "container-image", "InputRootAbsolutePath", "cache-silo":
@@ -332,7 +450,10 @@ func uploadInputFiles(ctx context.Context, inputs []*gomapb.ExecReq_Input, gi go
 
 			var hks []string
 			var err error
-			err = rpc.Retry{}.Do(ctx, func() error {
+			policy := rpc.PolicyFor(rpc.ServiceFile)
+			err = policy.RetryOr(rpc.Retry{}).Do(ctx, func() error {
+				ctx, cancel := policy.WithTimeout(ctx)
+				defer cancel()
 				hks, err = gi.upload(ctx, contents)
 				return err
 			})
@@ -493,6 +614,16 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 		r.gomaResp.ErrorMessage = append(r.gomaResp.ErrorMessage, fmt.Sprintf("bad input: %v", err))
 		return r.gomaResp
 	}
+	if r.macDeveloperDir != "" {
+		// files in developer dir will be relocated in input root.
+		paths := execPaths[:0]
+		for _, p := range execPaths {
+			if !hasPrefixDir(p, r.macDeveloperDir) {
+				paths = append(paths, p)
+			}
+		}
+		execPaths = paths
+	}
 	execRootDir := r.gomaReq.GetRequesterInfo().GetExecRoot()
 	rootDir, needChroot, err := deriveExecRoot(r.filepath, execPaths, r.allowChroot, execRootDir)
 	if err != nil {
@@ -503,6 +634,8 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 		return r.gomaResp
 	}
 	r.tree = merkletree.New(r.filepath, rootDir, r.digestStore)
+	// windows file system is case insensitive.
+	r.tree.CaseInsensitive = r.windowsNative()
 	r.needChroot = needChroot
 
 	logger.Infof("new input tree cwd:%s root:%s execRoot:%s %s", r.gomaReq.GetCwd(), r.tree.RootDir(), execRootDir, r.filepath)
@@ -536,7 +669,7 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 
 	start := time.Now()
 	reqInputs := r.gomaReq.Input
-	if _, ok := r.filepath.(winpath.FilePath); ok && !r.cmdConfig.GetCmdDescriptor().GetCross().GetWindowsCross() {
+	if r.windowsNative() {
 		// need to dedup filename for windows,
 		// except windows cross case.
 		reqInputs = dedupInputs(r.filepath, cleanCWD, r.gomaReq.Input)
@@ -545,7 +678,7 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 		}
 	}
 	results := inputFiles(ctx, reqInputs, r.input, func(filename string) (string, error) {
-		return rootRel(r.filepath, filename, cleanCWD, cleanRootDir)
+		return r.rootRel(r.filepath, filename, cleanCWD, cleanRootDir)
 	}, executableInputs)
 	uploads := make([]*gomapb.ExecReq_Input, 0, len(reqInputs))
 	for i, input := range reqInputs {
@@ -566,6 +699,7 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 	var files []merkletree.Entry
 	var missingInputs []string
 	var missingReason []string
+	var inputBytes int64
 	for _, in := range results {
 		if in.missingInput != "" {
 			missingInputs = append(missingInputs, in.missingInput)
@@ -577,6 +711,15 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 			continue
 		}
 		files = append(files, in.file)
+		inputBytes += in.file.Data.Digest().GetSizeBytes()
+	}
+	// check before asking missing inputs, so client won't upload
+	// inputs for the request that will be rejected.
+	if msg := r.inputLimit.checkInputBytes(r.userGroup, inputBytes); msg != "" {
+		logger.Warnf("bad input: %s", msg)
+		r.gomaResp.Error = gomapb.ExecResp_BAD_REQUEST.Enum()
+		r.gomaResp.ErrorMessage = append(r.gomaResp.ErrorMessage, msg)
+		return r.gomaResp
 	}
 	if len(missingInputs) > 0 {
 		logger.Infof("missing %d inputs out of %d. need to uploads=%d", len(missingInputs), len(reqInputs), len(uploads))
@@ -612,18 +755,21 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 		cmdCleanRootDir = winpath.ToPosix(cleanRootDir)
 	}
 
+	var cmdFiles []*cmdpb.FileSpec
 	for _, f := range r.cmdFiles {
 		if _, found := toolchainInputs[f.Path]; found {
 			// Must be processed in r.gomaReq.Input. So, skip this.
 			// TODO: cmdFiles should be empty instead if toolchain_included = true case?
 			continue
 		}
-
-		e, err := fileSpecToEntry(ctx, f, r.f.CmdStorage)
-		if err != nil {
-			r.err = fmt.Errorf("fileSpecToEntry: %v", err)
-			return nil
-		}
+		cmdFiles = append(cmdFiles, f)
+	}
+	cmdEntries, err := fileSpecsToEntries(ctx, cmdFiles, r.f.CmdStorage, r.f.DigestCache)
+	if err != nil {
+		r.err = fmt.Errorf("fileSpecToEntry: %v", err)
+		return nil
+	}
+	for _, e := range cmdEntries {
 		if !symAbsOk && e.Target != "" && filepath.IsAbs(e.Target) {
 			e, err = changeSymlinkAbsToRel(e)
 			if err != nil {
@@ -631,7 +777,7 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 				return nil
 			}
 		}
-		fname, err := rootRel(r.cmdFilepath, e.Name, cmdCleanCWD, cmdCleanRootDir)
+		fname, err := r.rootRel(r.cmdFilepath, e.Name, cmdCleanCWD, cmdCleanRootDir)
 		if err != nil {
 			if err == errOutOfRoot {
 				logger.Warnf("cmd files: out of root: %s", e.Name)
@@ -649,7 +795,7 @@ func (r *request) newInputTree(ctx context.Context) *gomapb.ExecResp {
 			return
 		}
 		for _, d := range dirs {
-			rel, err := rootRel(r.filepath, d, cleanCWD, cleanRootDir)
+			rel, err := r.rootRel(r.filepath, d, cleanCWD, cleanRootDir)
 			if err != nil {
 				if err == errOutOfRoot {
 					logger.Warnf("%s %s: %v", name, d, err)
@@ -784,24 +930,36 @@ func (r *request) newWrapperScript(ctx context.Context, cmdConfig *cmdpb.Config,
 	// TODO: only allow specific envs.
 	r.crossTarget = targetFromArgs(args)
 
+	debugPrefixMap := useDebugPrefixMap(cmdConfig)
 	var relocatableErr error
 	wt := wrapperRelocatable
 	switch r.filepath.(type) {
 	case posixpath.FilePath:
 		if r.needChroot {
 			wt = wrapperNsjailChroot
-		} else {
-			relocatableErr = relocatableReq(ctx, cmdConfig, r.filepath, r.gomaReq.Arg, r.gomaReq.Env)
-			if relocatableErr != nil {
-				wt = wrapperInputRootAbsolutePath
-				logger.Infof("non relocatable: %v", relocatableErr)
-			}
+			break
+		}
+		relocArgs := r.gomaReq.Arg
+		if r.macDeveloperDir != "" {
+			args = macRelocateArgs(args, r.macDeveloperDir, wd)
+			relocArgs = args
+		}
+		relocatableErr = relocatableReq(ctx, cmdConfig, r.filepath, relocArgs, r.gomaReq.Env)
+		var debugErr debugBuildError
+		if debugPrefixMap && errors.As(relocatableErr, &debugErr) {
+			// DW_AT_comp_dir will be normalized by debug prefix map.
+			logger.Infof("relocatable with debug prefix map: %v", relocatableErr)
+			relocatableErr = nil
+		}
+		if relocatableErr != nil {
+			wt = wrapperInputRootAbsolutePath
+			logger.Infof("non relocatable: %s", redact.String(relocatableErr.Error()))
 		}
 	case winpath.FilePath:
 		relocatableErr = relocatableReq(ctx, cmdConfig, r.filepath, r.gomaReq.Arg, r.gomaReq.Env)
 		if relocatableErr != nil {
 			wt = wrapperWinInputRootAbsolutePath
-			logger.Infof("non relocatable: %v", relocatableErr)
+			logger.Infof("non relocatable: %s", redact.String(relocatableErr.Error()))
 		} else {
 			wt = wrapperWin
 		}
@@ -823,6 +981,17 @@ func (r *request) newWrapperScript(ctx context.Context, cmdConfig *cmdpb.Config,
 		return fmt.Errorf("bad path type: %T", r.filepath)
 	}
 
+	switch wt {
+	case wrapperRelocatable, wrapperInputRootAbsolutePath:
+		if !debugPrefixMap || cmdConfig.GetCmdDescriptor().GetCross().GetWindowsCross() {
+			break
+		}
+		// run.sh appends -fdebug-prefix-map=<input root>=<relative path to
+		// input root>, so outputs don't depend on input root dir.
+		envs = append(envs, "DEBUG_PREFIX_MAP="+relRootDir(wd))
+		recordDebugPrefixMap(ctx, cmdConfig.GetCmdDescriptor().GetSelector().GetName(), wt)
+	}
+
 	const posixWrapperName = "run.sh"
 	switch wt {
 	case wrapperNsjailChroot:
@@ -856,10 +1025,19 @@ func (r *request) newWrapperScript(ctx context.Context, cmdConfig *cmdpb.Config,
 			// better to omit drive letter and make the
 			// effective for the same drive letter.
 			rootDir = winpath.ToPosix(rootDir)
+		} else if r.f.NormalizeInputRoot {
+			r.normalizer = newInputRootNormalizer(rootDir)
 		}
 		// r.addPlatformProperty(ctx, "InputRootAbsolutePath", rootDir)
+		if r.normalizer != nil {
+			// same action for the same source in different checkouts.
+			rootDir = r.normalizer.rootDir(rootDir)
+			args = r.normalizer.args(args)
+			logger.Infof("normalize input root %s -> %s", r.tree.RootDir(), rootDir)
+			r.addPlatformProperty(ctx, "InputRootAbsolutePath", rootDir)
+		}
 		for _, e := range r.gomaReq.Env {
-			envs = append(envs, e)
+			envs = append(envs, r.normalizer.env(e))
 		}
 		files = append([]merkletree.Entry{
 			{
@@ -904,14 +1082,25 @@ func (r *request) newWrapperScript(ctx context.Context, cmdConfig *cmdpb.Config,
 		}
 	case wrapperWinInputRootAbsolutePath:
 		logger.Infof("run on win with InputRootAbsolutePath")
-		if relocatableErr != nil && !strings.HasPrefix(strings.ToUpper(r.tree.RootDir()), `C:\`) {
-			// TODO Docker Internal Errors
-			// see also http://b/161274896 Catch specific case where drive letter other than C: specified for input root on Windows
-			logger.Errorf("non relocatable on windows, but absolute path is not C: drive. %s", r.tree.RootDir())
-			return badRequestError{err: fmt.Errorf("non relocatable %v, but root dir is %q. make request relocatable, or use `C:`", relocatableErr, r.tree.RootDir())}
+		rootDir := r.tree.RootDir()
+		if !strings.HasPrefix(strings.ToUpper(rootDir), `C:\`) {
+			// Docker Internal Errors if drive letter other than C:
+			// is specified for input root on Windows.
+			// see also http://b/161274896
+			// translate the drive letter of paths under root dir,
+			// so that the request works in C: input root.
+			if len(rootDir) < len(`C:`) || rootDir[1] != ':' {
+				logger.Errorf("root dir is not on drive: %s", rootDir)
+				return badRequestError{err: fmt.Errorf("non relocatable %v, but root dir is %q. make request relocatable, or use `C:`", relocatableErr, rootDir)}
+			}
+			rootDir = `C:` + rootDir[len(`C:`):]
+			logger.Infof("translate root dir %s -> %s", r.tree.RootDir(), rootDir)
+			for i := range args {
+				args[i] = translateRootDir(args[i], r.tree.RootDir(), rootDir)
+			}
 		}
 		// https://cloud.google.com/remote-build-execution/docs/remote-execution-properties#container_properties
-		r.addPlatformProperty(ctx, "InputRootAbsolutePath", r.tree.RootDir())
+		r.addPlatformProperty(ctx, "InputRootAbsolutePath", rootDir)
 		wn, data, err := wrapperForWindows(ctx)
 		if err != nil {
 			// missing run.exe?
@@ -923,7 +1112,7 @@ func (r *request) newWrapperScript(ctx context.Context, cmdConfig *cmdpb.Config,
 		// be in stored in the case of `wrapperWin` is left for future consideration.
 		for _, e := range r.gomaReq.Env {
 			if strings.HasPrefix(e, "INCLUDE=") || strings.HasPrefix(e, "LIB=") {
-				envs = append(envs, e)
+				envs = append(envs, translateRootDir(e, r.tree.RootDir(), rootDir))
 			}
 		}
 		files = []merkletree.Entry{
@@ -967,6 +1156,7 @@ func (r *request) newWrapperScript(ctx context.Context, cmdConfig *cmdpb.Config,
 		wrapperPath = winpath.ToPosix(wrapperPath)
 	}
 	r.args = append([]string{wrapperPath}, args...)
+	r.wrapperType = wt
 
 	err = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(wrapperTypeKey, wt.String())}, wrapperCount.M(1))
 	if err != nil {
@@ -1321,17 +1511,43 @@ func (r *request) missingBlobs(ctx context.Context) ([]*rpb.Digest, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
+	list := r.f.MissingContinuation.skip(ctx, r.instanceName(), r.actionDigest, r.digestStore.List())
+	var known []*rpb.Digest
+	mc, _ := r.f.DigestCache.(missingDigestCache)
+	if mc != nil {
+		known, list = mc.KnownMissing(ctx, r.instanceName(), list)
+		if len(known) > 0 {
+			logger := log.FromContext(ctx)
+			logger.Infof("known missing %d blobs", len(known))
+		}
+	}
 	var blobs []*rpb.Digest
-	err := rpc.Retry{}.Do(ctx, func() error {
-		var err error
-		blobs, err = r.cas.Missing(ctx, r.instanceName(), r.digestStore.List())
-		return fixRBEInternalError(err)
-	})
-	if err != nil {
-		r.err = err
-		return nil, err
+	if len(list) > 0 {
+		err := rpc.Retry{}.Do(ctx, func() error {
+			var err error
+			blobs, err = r.cas.Missing(ctx, r.instanceName(), list)
+			return fixRBEInternalError(err)
+		})
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+	}
+	if mc != nil {
+		mc.SetMissing(r.instanceName(), blobs)
 	}
-	return blobs, nil
+	if r.f.MissingContinuation != nil {
+		missing := make(map[string]bool, len(blobs))
+		for _, d := range blobs {
+			missing[d.GetHash()] = true
+		}
+		for _, d := range list {
+			if !missing[d.GetHash()] {
+				r.verified = append(r.verified, d)
+			}
+		}
+	}
+	return append(known, blobs...), nil
 }
 
 func inputForDigest(ds *digest.Store, d *rpb.Digest) (string, error) {
@@ -1418,6 +1634,9 @@ func (r *request) uploadBlobs(ctx context.Context, blobs []*rpb.Digest) (*gomapb
 		return nil, r.err
 	}
 	err := r.cas.Upload(ctx, r.instanceName(), r.f.CASBlobLookupSema, blobs...)
+	if mc, ok := r.f.DigestCache.(missingDigestCache); ok && err == nil {
+		mc.ClearMissing(r.instanceName(), blobs)
+	}
 	if err != nil {
 		if missing, ok := err.(cas.MissingError); ok {
 			logger := log.FromContext(ctx)
@@ -1454,13 +1673,48 @@ func (r *request) executeAction(ctx context.Context) (*rpb.ExecuteResponse, erro
 	if r.err != nil {
 		return nil, r.Err()
 	}
-	_, resp, err := ExecuteAndWait(ctx, r.client, &rpb.ExecuteRequest{
-		InstanceName:    r.instanceName(),
-		SkipCacheLookup: skipCacheLookup(r.gomaReq),
-		ActionDigest:    r.actionDigest,
-		// ExecutionPolicy
-		// ResultsCachePolicy
+	// hedged Execute may start several operations concurrently.
+	// all of them are finished when the winner finished, and
+	// the others are being canceled.
+	var mu sync.Mutex
+	var opNames []string
+	done := false
+	opName, resp, err := executeAndWait(ctx, r.client, &rpb.ExecuteRequest{
+		InstanceName:       r.instanceName(),
+		SkipCacheLookup:    skipCacheLookup(r.gomaReq),
+		ActionDigest:       r.actionDigest,
+		ExecutionPolicy:    r.f.executionPolicy(r.priority),
+		ResultsCachePolicy: r.f.resultsCachePolicy(r.priority),
+	}, func(opName string, md *rpb.ExecuteOperationMetadata) {
+		if md != nil {
+			r.f.Operations.update(opName, md.GetStage())
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		opNames = append(opNames, opName)
+		r.journal.Update(ctx, func(e *JournalEntry) {
+			e.Phase = journalExecute
+			e.Operation = opName
+		})
+		r.f.Operations.start(Operation{
+			Name:         opName,
+			Instance:     r.instanceName(),
+			ActionDigest: r.actionDigest.String(),
+			RequesterID:  r.gomaReq.GetRequesterInfo().GetCompilerProxyId(),
+			Start:        time.Now(),
+		})
 	})
+	mu.Lock()
+	done = true
+	for _, name := range opNames {
+		r.f.Operations.finish(name)
+	}
+	mu.Unlock()
+	r.opName = opName
 	if err != nil {
 		r.err = err
 		return nil, r.Err()
@@ -1541,11 +1795,30 @@ func (r *request) newResp(ctx context.Context, eresp *rpb.ExecuteResponse, cache
 		ExecutionStartTimestamp:     md.GetExecutionStartTimestamp(),
 		ExecutionCompletedTimestamp: md.GetExecutionCompletedTimestamp(),
 	}
+	setExecutionMetadata(ctx, r.opName, md)
+	setProvenance(ctx, r.provenance(ctx, md))
 	gout := gomaOutput{
 		gomaResp: r.gomaResp,
 		bs:       r.client.ByteStream(),
 		instance: r.instanceName(),
 		gomaFile: r.f.GomaFile,
+		backfill: r.f.OutputBackfill,
+		pch:      r.f.PCHPolicy,
+		// use the same compressor with uploads.
+		compressor: r.cas.Compressor,
+		cas:        r.client.CAS(),
+		// gRPC's default max receive message size is 4MB.
+		batchLimit: cas.DefaultBatchByteLimit,
+		normalizer: r.normalizer,
+	}
+	if s := r.cas.CacheCapabilities.GetMaxBatchTotalSizeBytes(); s > 0 && s < gout.batchLimit {
+		gout.batchLimit = s
+	}
+	if r.localOutputs != nil {
+		// outputs of local execution are not in CAS.
+		gout.cas = nil
+		gout.backfill = nil
+		gout.prefetched = r.localOutputs
 	}
 	// gomaOutput should return err for codes.Unauthenticated,
 	// instead of setting ErrorMessage in r.gomaResp,
@@ -1562,6 +1835,9 @@ func (r *request) newResp(ctx context.Context, eresp *rpb.ExecuteResponse, cache
 		}
 	}
 
+	r.gomaResp.Result.StdoutBuffer = r.normalizer.restore(r.gomaResp.Result.StdoutBuffer)
+	r.gomaResp.Result.StderrBuffer = r.normalizer.restore(r.gomaResp.Result.StderrBuffer)
+
 	if len(r.gomaResp.Result.StdoutBuffer) > 0 {
 		// docker failure would be error of goma server, not users.
 		// so make it internal error, rather than command execution error.
@@ -1585,6 +1861,7 @@ func (r *request) newResp(ctx context.Context, eresp *rpb.ExecuteResponse, cache
 		logger.Infof("stderr %s", shortLogMsg(r.gomaResp.Result.StderrBuffer))
 	}
 
+	gout = gout.prefetch(ctx, eresp.Result.OutputFiles)
 	for _, output := range eresp.Result.OutputFiles {
 		if r.err != nil {
 			break
@@ -1622,6 +1899,13 @@ func (r *request) newResp(ctx context.Context, eresp *rpb.ExecuteResponse, cache
 	if len(r.gomaResp.ErrorMessage) == 0 {
 		r.gomaResp.Result.ExitStatus = proto.Int32(eresp.Result.ExitCode)
 	}
+	if r.f.Attestor != nil && r.localOutputs == nil && len(r.gomaResp.ErrorMessage) == 0 && eresp.Result.ExitCode == 0 {
+		// attestation is best effort. failure doesn't fail the request.
+		err := r.attest(ctx, eresp, md)
+		if err != nil {
+			logger.Warnf("attest provenance: %v", err)
+		}
+	}
 
 	sizeLimit := exec.DefaultMaxRespMsgSize
 	respSize := proto.Size(r.gomaResp)
@@ -1637,6 +1921,101 @@ func (r *request) newResp(ctx context.Context, eresp *rpb.ExecuteResponse, cache
 	return r.gomaResp, r.Err()
 }
 
+// provenance returns provenance of the execution with metadata md,
+// to attribute outputs to the worker and the toolchain config.
+func (r *request) provenance(ctx context.Context, md *rpb.ExecutedActionMetadata) *execpb.ExecProvenance {
+	p := &execpb.ExecProvenance{
+		Instance:     proto.String(r.instanceName()),
+		ActionDigest: proto.String(fmt.Sprintf("%s/%d", r.actionDigest.GetHash(), r.actionDigest.GetSizeBytes())),
+	}
+	if w := md.GetWorker(); w != "" {
+		p.Worker = proto.String(w)
+	}
+	if image := platformContainerImage(r.platform); image != "" {
+		p.ContainerImage = proto.String(image)
+	}
+	if toolchain := r.cmdConfig.GetBuildInfo().GetToolchain(); toolchain != "" {
+		p.Toolchain = proto.String(toolchain)
+	}
+	if md != nil {
+		b, err := proto.Marshal(md)
+		if err != nil {
+			log.FromContext(ctx).Warnf("failed to marshal executed action metadata: %v", err)
+		} else {
+			p.ExecutedActionMetadata = b
+		}
+	}
+	return p
+}
+
+// attest generates provenance attestation of outputs in eresp
+// executed with metadata md.
+func (r *request) attest(ctx context.Context, eresp *rpb.ExecuteResponse, md *rpb.ExecutedActionMetadata) error {
+	algo := digestAlgorithm()
+	var outputs []provenance.Subject
+	for _, output := range eresp.Result.OutputFiles {
+		fname, err := r.filepath.Rel(r.gomaReq.GetCwd(), r.filepath.Join(r.tree.RootDir(), output.Path))
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, provenance.Subject{
+			Name: fname,
+			Digest: provenance.DigestSet{
+				algo: output.GetDigest().GetHash(),
+			},
+		})
+	}
+	instance := r.instanceName()
+	cmdSpec := r.gomaReq.GetCommandSpec()
+	predicate := provenance.Predicate{
+		Invocation: provenance.Invocation{
+			Parameters: map[string]string{
+				"actionDigest":   fmt.Sprintf("%s/%d", r.actionDigest.GetHash(), r.actionDigest.GetSizeBytes()),
+				"commandDigest":  fmt.Sprintf("%s/%d", r.action.GetCommandDigest().GetHash(), r.action.GetCommandDigest().GetSizeBytes()),
+				"commandName":    cmdSpec.GetName(),
+				"commandVersion": cmdSpec.GetVersion(),
+				"commandTarget":  cmdSpec.GetTarget(),
+				"toolchain":      r.cmdConfig.GetBuildInfo().GetToolchain(),
+			},
+			Environment: map[string]string{
+				"instance": instance,
+				"worker":   md.GetWorker(),
+			},
+		},
+		Metadata: &provenance.Metadata{
+			BuildInvocationID: r.opName,
+			Completeness: provenance.Completeness{
+				Parameters: true,
+				Materials:  true,
+			},
+		},
+		Materials: []provenance.Material{
+			provenanceMaterial(instance, r.action.GetInputRootDigest()),
+		},
+	}
+	if md.GetWorkerStartTimestamp().IsValid() {
+		t := md.GetWorkerStartTimestamp().AsTime()
+		predicate.Metadata.BuildStartedOn = &t
+	}
+	if md.GetWorkerCompletedTimestamp().IsValid() {
+		t := md.GetWorkerCompletedTimestamp().AsTime()
+		predicate.Metadata.BuildFinishedOn = &t
+	}
+	if image := platformContainerImage(r.platform); image != "" {
+		predicate.Materials = append(predicate.Materials, imageMaterial(image))
+	}
+	return r.f.Attestor.Attest(ctx, outputs, predicate)
+}
+
+func platformContainerImage(p *rpb.Platform) string {
+	for _, p := range p.Properties {
+		if p.Name == "container-image" {
+			return p.Value
+		}
+	}
+	return ""
+}
+
 func platformOSFamily(p *rpb.Platform) string {
 	for _, p := range p.Properties {
 		if p.Name == "OSFamily" {
@@ -1678,15 +2057,16 @@ func crossCompileType(cross *cmdpb.CmdDescriptor_Cross) string {
 	return "no"
 }
 
+// shortLogMsg returns msg shortened and redacted for logging.
 func shortLogMsg(msg []byte) string {
 	if len(msg) <= 1024 {
-		return string(msg)
+		return redact.String(string(msg))
 	}
 	var b strings.Builder
 	b.Write(msg[:512])
 	fmt.Fprint(&b, "...")
 	b.Write(msg[len(msg)-512:])
-	return b.String()
+	return redact.String(b.String())
 }
 
 // logLLVMError records LLVM ERROR.
@@ -1696,7 +2076,7 @@ func logLLVMError(logger log.Logger, id string, msg []byte) {
 	if !ok {
 		return
 	}
-	logger.Errorf("%s: %s", id, llvmErrorMsg)
+	logger.Errorf("%s: %s", id, redact.String(string(llvmErrorMsg)))
 }
 
 func extractLLVMError(msg []byte) ([]byte, bool) {
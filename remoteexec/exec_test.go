@@ -10,9 +10,11 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/protobuf/proto"
 
@@ -20,6 +22,7 @@ import (
 	"go.chromium.org/goma/server/hash"
 	"go.chromium.org/goma/server/log"
 	gomapb "go.chromium.org/goma/server/proto/api"
+	cmdpb "go.chromium.org/goma/server/proto/command"
 	"go.chromium.org/goma/server/remoteexec/digest"
 	"go.chromium.org/goma/server/remoteexec/merkletree"
 )
@@ -202,6 +205,41 @@ clang-cl: note: diagnostic msg:
 
 }
 
+type captureLogger struct {
+	log.Logger
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *captureLogger) logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
+
+func (l *captureLogger) Debugf(format string, args ...interface{}) { l.logf(format, args...) }
+func (l *captureLogger) Infof(format string, args ...interface{})  { l.logf(format, args...) }
+func (l *captureLogger) Warnf(format string, args ...interface{})  { l.logf(format, args...) }
+func (l *captureLogger) Errorf(format string, args ...interface{}) { l.logf(format, args...) }
+
+func TestExecLogsRedacted(t *testing.T) {
+	logger := &captureLogger{}
+	ctx := log.NewContext(context.Background(), logger)
+
+	createEnvVars(ctx, []string{"API_KEY=secret1", "PATH=/bin", "API_KEY=secret2"})
+	logLLVMError(logger, "stderr", []byte("LLVM ERROR: bad -DAPI_KEY=secret3\n"))
+	logger.Infof("stdout %s", shortLogMsg([]byte("warning: -DAPI_KEY=secret4 is unused")))
+
+	if got, want := len(logger.msgs), 3; got != want {
+		t.Errorf("logs=%q; want %d logs", logger.msgs, want)
+	}
+	for _, msg := range logger.msgs {
+		if strings.Contains(msg, "secret") {
+			t.Errorf("log %q contains secret", msg)
+		}
+	}
+}
+
 func TestChangeSymlinkAbsToRel(t *testing.T) {
 	for _, tc := range []struct {
 		desc       string
@@ -577,3 +615,54 @@ func BenchmarkInputFiles(b *testing.B) {
 		inputFiles(ctx, inputs, gi, rootRel, executableInputs)
 	}
 }
+
+func TestProvenance(t *testing.T) {
+	ctx := context.Background()
+	r := &request{
+		f: &Adapter{
+			InstancePrefix: "projects/goma/instances",
+		},
+		cmdConfig: &cmdpb.Config{
+			BuildInfo: &cmdpb.BuildInfo{
+				Toolchain: "clang 1234",
+			},
+		},
+		platform: &rpb.Platform{
+			Properties: []*rpb.Platform_Property{
+				{Name: "OSFamily", Value: "Linux"},
+				{Name: "container-image", Value: "docker://gcr.io/goma/toolchain@sha256:1234"},
+			},
+		},
+		actionDigest: &rpb.Digest{
+			Hash:      "abcdef",
+			SizeBytes: 123,
+		},
+	}
+	md := &rpb.ExecutedActionMetadata{
+		Worker: "worker-1",
+	}
+	p := r.provenance(ctx, md)
+	if got, want := p.GetInstance(), "projects/goma/instances/default_instance"; got != want {
+		t.Errorf("instance=%q; want %q", got, want)
+	}
+	if got, want := p.GetActionDigest(), "abcdef/123"; got != want {
+		t.Errorf("action_digest=%q; want %q", got, want)
+	}
+	if got, want := p.GetWorker(), "worker-1"; got != want {
+		t.Errorf("worker=%q; want %q", got, want)
+	}
+	if got, want := p.GetContainerImage(), "docker://gcr.io/goma/toolchain@sha256:1234"; got != want {
+		t.Errorf("container_image=%q; want %q", got, want)
+	}
+	if got, want := p.GetToolchain(), "clang 1234"; got != want {
+		t.Errorf("toolchain=%q; want %q", got, want)
+	}
+	gotMD := &rpb.ExecutedActionMetadata{}
+	err := proto.Unmarshal(p.GetExecutedActionMetadata(), gotMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(gotMD, md) {
+		t.Errorf("executed_action_metadata=%v; want %v", gotMD, md)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+	execpb "go.chromium.org/goma/server/proto/exec"
+)
+
+type execExtKey struct{}
+
+type execExtRespKey struct{}
+
+// withExecExt returns context to handle ExecReq in req with
+// extensions in req.
+func withExecExt(ctx context.Context, req *execpb.ExecExtReq) context.Context {
+	return context.WithValue(ctx, execExtKey{}, req)
+}
+
+// execExtFromContext returns extensions of the request in ctx.
+// It returns nil if ctx has no extensions.
+func execExtFromContext(ctx context.Context) *execpb.ExecExtReq {
+	req, _ := ctx.Value(execExtKey{}).(*execpb.ExecExtReq)
+	return req
+}
+
+// withExecExtResp returns context to set extensions of response
+// in resp.
+func withExecExtResp(ctx context.Context, resp *execpb.ExecExtResp) context.Context {
+	return context.WithValue(ctx, execExtRespKey{}, resp)
+}
+
+// setExecutionMetadata sets metadata of RBE operation opName in
+// extensions of response in ctx, if any.
+func setExecutionMetadata(ctx context.Context, opName string, md *rpb.ExecutedActionMetadata) {
+	resp, ok := ctx.Value(execExtRespKey{}).(*execpb.ExecExtResp)
+	if !ok {
+		return
+	}
+	m := &execpb.ExecutionMetadata{
+		QueuedTimestamp:          md.GetQueuedTimestamp(),
+		WorkerStartTimestamp:     md.GetWorkerStartTimestamp(),
+		WorkerCompletedTimestamp: md.GetWorkerCompletedTimestamp(),
+	}
+	if opName != "" {
+		m.OperationName = proto.String(opName)
+	}
+	if w := md.GetWorker(); w != "" {
+		m.Worker = proto.String(w)
+	}
+	resp.ExecutionMetadata = m
+}
+
+// setProvenance sets provenance of the execution in extensions of
+// response in ctx, if any.
+func setProvenance(ctx context.Context, p *execpb.ExecProvenance) {
+	resp, ok := ctx.Value(execExtRespKey{}).(*execpb.ExecExtResp)
+	if !ok {
+		return
+	}
+	resp.Provenance = p
+}
+
+// inputMetaMap returns map from input of req to its metadata hints.
+// It returns nil if req has no metadata hints.
+func inputMetaMap(req *execpb.ExecExtReq) map[*gomapb.ExecReq_Input]*execpb.InputMeta {
+	inputs := req.GetReq().GetInput()
+	metas := req.GetInputMeta()
+	if len(metas) == 0 {
+		return nil
+	}
+	m := make(map[*gomapb.ExecReq_Input]*execpb.InputMeta)
+	for i, meta := range metas {
+		if i >= len(inputs) {
+			break
+		}
+		m[inputs[i]] = meta
+	}
+	return m
+}
+
+// ExecExt handles goma Exec request with extensions of goma server.
+func (f *Adapter) ExecExt(ctx context.Context, req *execpb.ExecExtReq) (*execpb.ExecExtResp, error) {
+	extResp := &execpb.ExecExtResp{}
+	ctx = withExecExtResp(withExecExt(ctx, req), extResp)
+	resp, err := f.Exec(ctx, req.GetReq())
+	if err != nil {
+		return nil, err
+	}
+	extResp.Resp = resp
+	return extResp, nil
+}
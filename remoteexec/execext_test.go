@@ -0,0 +1,46 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+
+	execpb "go.chromium.org/goma/server/proto/exec"
+)
+
+func TestSetExecutionMetadata(t *testing.T) {
+	t0 := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	md := &rpb.ExecutedActionMetadata{
+		Worker:                   "worker1",
+		QueuedTimestamp:          tspb.New(t0),
+		WorkerStartTimestamp:     tspb.New(t0.Add(1 * time.Second)),
+		WorkerCompletedTimestamp: tspb.New(t0.Add(3 * time.Second)),
+	}
+
+	// no extensions of response in context.
+	setExecutionMetadata(context.Background(), "operations/1", md)
+
+	resp := &execpb.ExecExtResp{}
+	ctx := withExecExtResp(context.Background(), resp)
+	setExecutionMetadata(ctx, "operations/1", md)
+	want := &execpb.ExecutionMetadata{
+		OperationName:            proto.String("operations/1"),
+		Worker:                   proto.String("worker1"),
+		QueuedTimestamp:          tspb.New(t0),
+		WorkerStartTimestamp:     tspb.New(t0.Add(1 * time.Second)),
+		WorkerCompletedTimestamp: tspb.New(t0.Add(3 * time.Second)),
+	}
+	if diff := cmp.Diff(want, resp.GetExecutionMetadata(), protocmp.Transform()); diff != "" {
+		t.Errorf("execution metadata diff -want +got:\n%s", diff)
+	}
+}
@@ -439,6 +439,18 @@ func (f *fakeRedis) Put(ctx context.Context, req *cachepb.PutReq, opts ...grpc.C
 	return &cachepb.PutResp{}, nil
 }
 
+func (f *fakeRedis) Exists(ctx context.Context, req *cachepb.ExistsReq, opts ...grpc.CallOption) (*cachepb.ExistsResp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &cachepb.ExistsResp{
+		Exists: make([]bool, len(req.Keys)),
+	}
+	for i, key := range req.Keys {
+		_, resp.Exists[i] = f.m[key]
+	}
+	return resp, nil
+}
+
 // fakeCmdStorage represents fake cmdstorage bucket.
 type fakeCmdStorage struct {
 	m map[string]string // hash -> data
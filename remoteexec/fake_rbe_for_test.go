@@ -26,15 +26,18 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
 
 	"go.chromium.org/goma/server/log"
 	"go.chromium.org/goma/server/remoteexec/cas"
+	"go.chromium.org/goma/server/remoteexec/datasource"
 	"go.chromium.org/goma/server/remoteexec/digest"
 )
 
 type operations struct {
-	mu  sync.Mutex
-	ops map[string][]*opb.Operation
+	mu       sync.Mutex
+	ops      map[string][]*opb.Operation
+	canceled []string
 }
 
 func (o *operations) Add(opname string, op *opb.Operation) {
@@ -54,6 +57,18 @@ func (o *operations) Get(opname string) []*opb.Operation {
 	return ops
 }
 
+func (o *operations) Cancel(opname string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.canceled = append(o.canceled, opname)
+}
+
+func (o *operations) Canceled() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.canceled...)
+}
+
 func execRespOp(opname string, resp *rpb.ExecuteResponse, err error) (*opb.Operation, error) {
 	op := &opb.Operation{
 		Name: opname,
@@ -99,6 +114,7 @@ type fakeRBE struct {
 	fakeExec func(ctx context.Context, req *rpb.ExecuteRequest) (*rpb.ExecuteResponse, error)
 
 	rpb.ExecutionServer
+	opb.OperationsServer
 	ops operations
 
 	rpb.ActionCacheServer
@@ -120,6 +136,7 @@ type fakeRBE struct {
 
 func registerFakeRBE(srv *grpc.Server, rbe *fakeRBE) {
 	rpb.RegisterExecutionServer(srv, rbe)
+	opb.RegisterOperationsServer(srv, rbe)
 	rpb.RegisterActionCacheServer(srv, rbe)
 	rpb.RegisterContentAddressableStorageServer(srv, rbe)
 	bpb.RegisterByteStreamServer(srv, rbe)
@@ -390,6 +407,13 @@ func (f *fakeRBE) Execute(req *rpb.ExecuteRequest, s rpb.Execution_ExecuteServer
 			return s.Send(op)
 		}
 	}
+	// notify operation name before execution, as RBE does.
+	err = s.Send(&opb.Operation{
+		Name: opname,
+	})
+	if err != nil {
+		return err
+	}
 	var resp *rpb.ExecuteResponse
 	if f.fakeExec == nil {
 		err = status.Errorf(codes.Unavailable, "exec service unavailable")
@@ -441,6 +465,13 @@ func (f *fakeRBE) WaitExecution(req *rpb.WaitExecutionRequest, s rpb.Execution_W
 	}
 }
 
+func (f *fakeRBE) CancelOperation(ctx context.Context, req *opb.CancelOperationRequest) (*emptypb.Empty, error) {
+	logger := log.FromContext(ctx)
+	logger.Infof("cancel %q", req.Name)
+	f.ops.Cancel(req.Name)
+	return &emptypb.Empty{}, nil
+}
+
 func (f *fakeRBE) GetActionResult(ctx context.Context, req *rpb.GetActionResultRequest) (*rpb.ActionResult, error) {
 	if !f.isValidInstance(req.InstanceName) {
 		return nil, status.Errorf(codes.PermissionDenied, "unexpected instance name %q", req.InstanceName)
@@ -500,6 +531,45 @@ func (f *fakeRBE) BatchUpdateBlobs(ctx context.Context, req *rpb.BatchUpdateBlob
 	return resp, nil
 }
 
+func (f *fakeRBE) BatchReadBlobs(ctx context.Context, req *rpb.BatchReadBlobsRequest) (*rpb.BatchReadBlobsResponse, error) {
+	if !f.isValidInstance(req.InstanceName) {
+		return nil, status.Errorf(codes.PermissionDenied, "unexpected instance name %q", req.InstanceName)
+	}
+	var totalSize int64
+	resp := &rpb.BatchReadBlobsResponse{}
+	for _, d := range req.Digests {
+		bresp := &rpb.BatchReadBlobsResponse_Response{
+			Digest: d,
+		}
+		resp.Responses = append(resp.Responses, bresp)
+		v, ok := f.cas.Get(d)
+		if !ok {
+			bresp.Status = &spb.Status{
+				Code:    int32(codes.NotFound),
+				Message: fmt.Sprintf("%s not found", d),
+			}
+			continue
+		}
+		b, err := datasource.ReadAll(ctx, v)
+		if err != nil {
+			bresp.Status = &spb.Status{
+				Code:    int32(codes.Internal),
+				Message: fmt.Sprintf("read %s: %v", d, err),
+			}
+			continue
+		}
+		totalSize += int64(len(b))
+		bresp.Data = b
+		bresp.Status = &spb.Status{
+			Code: int32(codes.OK),
+		}
+	}
+	if totalSize > f.ServerCapabilities.CacheCapabilities.MaxBatchTotalSizeBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "exceed server capabilities: %d > %d", totalSize, f.ServerCapabilities.CacheCapabilities.MaxBatchTotalSizeBytes)
+	}
+	return resp, nil
+}
+
 // TODO: GetTree?
 
 func (f *fakeRBE) Read(req *bpb.ReadRequest, s bpb.ByteStream_ReadServer) error {
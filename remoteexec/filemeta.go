@@ -0,0 +1,119 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	execpb "go.chromium.org/goma/server/proto/exec"
+	"go.chromium.org/goma/server/remoteexec/digest"
+)
+
+// fileMetaKey identifies a file in a client by metadata hints.
+type fileMetaKey struct {
+	client   string
+	filename string
+	mtime    int64
+	size     int64
+}
+
+// FileMetaCache maps file metadata hints (filename, mtime, size) sent
+// by a client to digest data computed for previous requests from the
+// same client, so client can omit hash_key of unchanged files, and
+// such files don't need to be hashed or looked up in digest cache again.
+type FileMetaCache struct {
+	mu  sync.Mutex
+	lru lru.Cache
+}
+
+// NewFileMetaCache creates new file metadata cache with maxEntries.
+// maxEntries 0 means no limit.
+func NewFileMetaCache(maxEntries int) *FileMetaCache {
+	c := &FileMetaCache{}
+	c.lru.MaxEntries = maxEntries
+	return c
+}
+
+// clientID returns client identifier from authenticated end user and
+// compiler_proxy_id. compiler_proxy_id is "<compiler_proxy instance>/<task id>",
+// and instance part is used to distinguish clients of the same user.
+// compiler_proxy_id is controlled by the client, so the identifier is
+// scoped by the authenticated user and group, so that a client can't
+// get digests of files of other users by metadata hints.
+// It returns empty string if user is not authenticated, or
+// compiler_proxy_id doesn't have instance part.
+func clientID(user *enduser.EndUser, reqInfo *gomapb.RequesterInfo) string {
+	if user == nil || user.Email == "" {
+		return ""
+	}
+	id := reqInfo.GetCompilerProxyId()
+	i := strings.LastIndexByte(id, '/')
+	if i <= 0 {
+		return ""
+	}
+	return strings.Join([]string{string(user.Email), user.Group, id[:i]}, "\x00")
+}
+
+// metaKey returns fileMetaKey for input with metadata hints meta.
+// It returns false if meta has no metadata hints.
+func metaKey(client string, input *gomapb.ExecReq_Input, meta *execpb.InputMeta) (fileMetaKey, bool) {
+	if client == "" || input.GetFilename() == "" || meta == nil || meta.Mtime == nil || meta.Size == nil {
+		return fileMetaKey{}, false
+	}
+	return fileMetaKey{
+		client:   client,
+		filename: input.GetFilename(),
+		mtime:    meta.GetMtime(),
+		size:     meta.GetSize(),
+	}, true
+}
+
+// get returns digest data for key.
+func (c *FileMetaCache) get(ctx context.Context, key fileMetaKey) (digest.Data, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	v, ok := c.lru.Get(key)
+	c.mu.Unlock()
+	op := "miss"
+	var d digest.Data
+	if ok {
+		op = "hit"
+		d = v.(digest.Data)
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(fileMetaOpKey, op),
+	}, fileMetaCacheStats.M(1))
+	return d, ok
+}
+
+// set sets digest data for key.
+func (c *FileMetaCache) set(key fileMetaKey, d digest.Data) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Add(key, d)
+}
+
+// Len returns number of entries in the cache.
+func (c *FileMetaCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/auth/enduser"
+	gomapb "go.chromium.org/goma/server/proto/api"
+	execpb "go.chromium.org/goma/server/proto/exec"
+	"go.chromium.org/goma/server/remoteexec/digest"
+)
+
+func TestClientID(t *testing.T) {
+	user := enduser.New("user@example.com", "group", nil)
+	for _, tc := range []struct {
+		desc string
+		user *enduser.EndUser
+		id   string
+		want string
+	}{
+		{
+			desc: "authenticated",
+			user: user,
+			id:   "user@host:8088/1234567890/42",
+			want: "user@example.com\x00group\x00user@host:8088/1234567890",
+		},
+		{
+			desc: "other group",
+			user: enduser.New("user@example.com", "other", nil),
+			id:   "user@host:8088/1234567890/42",
+			want: "user@example.com\x00other\x00user@host:8088/1234567890",
+		},
+		{
+			desc: "unauthenticated",
+			id:   "user@host:8088/1234567890/42",
+			want: "",
+		},
+		{
+			desc: "no email",
+			user: enduser.New("", "group", nil),
+			id:   "user@host:8088/1234567890/42",
+			want: "",
+		},
+		{
+			desc: "no slash",
+			user: user,
+			id:   "noslash",
+			want: "",
+		},
+		{
+			desc: "no instance",
+			user: user,
+			id:   "/42",
+			want: "",
+		},
+	} {
+		got := clientID(tc.user, &gomapb.RequesterInfo{
+			CompilerProxyId: proto.String(tc.id),
+		})
+		if got != tc.want {
+			t.Errorf("%s: clientID(user, %q)=%q; want %q", tc.desc, tc.id, got, tc.want)
+		}
+	}
+}
+
+func TestFileMetaCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewFileMetaCache(10)
+
+	input := &gomapb.ExecReq_Input{
+		Filename: proto.String("../../base/base.h"),
+		HashKey:  proto.String(""),
+	}
+	meta := &execpb.InputMeta{
+		Mtime: proto.Int64(1234567890),
+		Size:  proto.Int64(5),
+	}
+	if _, ok := metaKey("", input, meta); ok {
+		t.Errorf("metaKey(\"\", input, meta)=_, true; want false")
+	}
+	if _, ok := metaKey("client", input, nil); ok {
+		t.Errorf("metaKey(client, input, nil)=_, true; want false")
+	}
+	key, ok := metaKey("client", input, meta)
+	if !ok {
+		t.Fatalf("metaKey(client, input, meta)=_, false; want true")
+	}
+	if _, ok := c.get(ctx, key); ok {
+		t.Errorf("c.get(ctx, key)=_, true; want false for empty cache")
+	}
+	d := digest.Bytes("base.h", []byte("hello"))
+	c.set(key, d)
+
+	got, ok := c.get(ctx, key)
+	if !ok || !proto.Equal(got.Digest(), d.Digest()) {
+		t.Errorf("c.get(ctx, key)=%v, %t; want %v, true", got, ok, d)
+	}
+
+	key2, _ := metaKey("client", input, &execpb.InputMeta{
+		Mtime: proto.Int64(1234567891),
+		Size:  proto.Int64(5),
+	})
+	if _, ok := c.get(ctx, key2); ok {
+		t.Errorf("c.get(ctx, key2)=_, true; want false for modified mtime")
+	}
+	key3, _ := metaKey("other-client", input, meta)
+	if _, ok := c.get(ctx, key3); ok {
+		t.Errorf("c.get(ctx, key3)=_, true; want false for other client")
+	}
+
+	var nilCache *FileMetaCache
+	nilCache.set(key, d)
+	if _, ok := nilCache.get(ctx, key); ok {
+		t.Errorf("nilCache.get(ctx, key)=_, true; want false")
+	}
+}
+
+type countDigestCache struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *countDigestCache) Get(ctx context.Context, key string, src digest.Source) (digest.Data, error) {
+	c.mu.Lock()
+	c.n++
+	c.mu.Unlock()
+	return digest.Bytes(key, []byte(key)), nil
+}
+
+func TestGomaInputToDigestFileMeta(t *testing.T) {
+	ctx := context.Background()
+	dc := &countDigestCache{}
+	gi := &gomaInput{
+		digestCache:   dc,
+		fileMetaCache: NewFileMetaCache(10),
+		client:        "client",
+		inputMeta:     make(map[*gomapb.ExecReq_Input]*execpb.InputMeta),
+	}
+	input := func(hashKey string, mtime int64) *gomapb.ExecReq_Input {
+		in := &gomapb.ExecReq_Input{
+			Filename: proto.String("../../base/base.h"),
+			HashKey:  proto.String(hashKey),
+		}
+		gi.inputMeta[in] = &execpb.InputMeta{
+			Mtime: proto.Int64(mtime),
+			Size:  proto.Int64(5),
+		}
+		return in
+	}
+
+	want, err := gi.toDigest(ctx, input("hash1", 1234567890))
+	if err != nil {
+		t.Fatalf("toDigest(hash1)=_, %v; want nil error", err)
+	}
+	if dc.n != 1 {
+		t.Errorf("digest cache lookups=%d; want 1", dc.n)
+	}
+
+	// unchanged file without hash_key.
+	got, err := gi.toDigest(ctx, input("", 1234567890))
+	if err != nil || !proto.Equal(got.Digest(), want.Digest()) {
+		t.Errorf("toDigest(no hash_key)=%v, %v; want %v, nil", got, err, want)
+	}
+	if dc.n != 1 {
+		t.Errorf("digest cache lookups=%d; want 1 (no lookup for unchanged file)", dc.n)
+	}
+
+	// modified file without hash_key would be missing input.
+	_, err = gi.toDigest(ctx, input("", 1234567891))
+	if err == nil {
+		t.Errorf("toDigest(no hash_key, modified)=_, nil; want error")
+	}
+}
+
+func TestInputMetaMap(t *testing.T) {
+	inputs := []*gomapb.ExecReq_Input{
+		{
+			Filename: proto.String("../../base/base.h"),
+			HashKey:  proto.String(""),
+		},
+		{
+			Filename: proto.String("../../base/base.cc"),
+			HashKey:  proto.String("hash1"),
+		},
+	}
+	meta := &execpb.InputMeta{
+		Mtime: proto.Int64(1234567890),
+		Size:  proto.Int64(5),
+	}
+	m := inputMetaMap(&execpb.ExecExtReq{
+		Req: &gomapb.ExecReq{
+			Input: inputs,
+		},
+		// no hints for 2nd input.
+		InputMeta: []*execpb.InputMeta{meta},
+	})
+	if got := m[inputs[0]]; got != meta {
+		t.Errorf("inputMetaMap(req)[inputs[0]]=%v; want %v", got, meta)
+	}
+	if got := m[inputs[1]]; got != nil {
+		t.Errorf("inputMetaMap(req)[inputs[1]]=%v; want nil", got)
+	}
+	if m := inputMetaMap(nil); m != nil {
+		t.Errorf("inputMetaMap(nil)=%v; want nil", m)
+	}
+}
@@ -35,6 +35,17 @@ var pathFlags = []string{
 
 // TODO: share exec/gcc.go ?
 
+// debugBuildError is an error for debug build without
+// -fdebug-compilation-dir, i.e. DW_AT_comp_dir would be
+// absolute path of the working directory.
+type debugBuildError struct {
+	flags []string
+}
+
+func (e debugBuildError) Error() string {
+	return fmt.Sprintf("debug build: %q", e.flags)
+}
+
 // gccRelocatableReq checks if the request (args, envs) uses relative
 // paths only and doesn't use flags that generates output including cwd,
 // so will generate cwd-agnostic outputs
@@ -214,9 +225,6 @@ Loop:
 		}
 	}
 
-	if len(debugFlags) > 0 && !debugCompilationDir {
-		return fmt.Errorf("debug build: %q", debugFlags)
-	}
 	if len(subArgs) > 0 {
 		for cmd, args := range subArgs {
 			switch cmd {
@@ -253,6 +261,11 @@ Loop:
 			return fmt.Errorf("abs path in env %s=%s", e[0], e[1])
 		}
 	}
+	// check debug build last, so debugBuildError means that
+	// the request is relocatable except DW_AT_comp_dir.
+	if len(debugFlags) > 0 && !debugCompilationDir {
+		return debugBuildError{flags: debugFlags}
+	}
 	return nil
 }
 
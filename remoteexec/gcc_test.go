@@ -5,6 +5,7 @@
 package remoteexec
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -644,6 +645,49 @@ func TestGccRelocatableReqForDebugCompilationDir(t *testing.T) {
 	}
 }
 
+func TestGccRelocatableReqDebugBuildError(t *testing.T) {
+	baseArgs := []string{
+		"../../third_party/llvm-build/Release+Asserts/bin/clang++",
+		"-I../..",
+		"-c",
+		"../../base/time/time.cc",
+		"-o",
+		"obj/base/base/time.o",
+	}
+	for _, tc := range []struct {
+		desc string
+		args []string
+		want bool
+	}{
+		{
+			desc: "debug build",
+			args: append(append([]string{}, baseArgs...), "-g"),
+			want: true,
+		},
+		{
+			desc: "debug build with abs path",
+			args: append(append([]string{}, baseArgs...), "-g", "-I/usr/local/include"),
+			want: false,
+		},
+		{
+			desc: "release build with abs path",
+			args: append(append([]string{}, baseArgs...), "-I/usr/local/include"),
+			want: false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := gccRelocatableReq(posixpath.FilePath{}, tc.args, nil)
+			if err == nil {
+				t.Fatalf("gccRelocatableReq(posixpath.FilePath, %q, nil)=nil; want err", tc.args)
+			}
+			var debugErr debugBuildError
+			if got := errors.As(err, &debugErr); got != tc.want {
+				t.Errorf("gccRelocatableReq(posixpath.FilePath, %q, nil)=%v; debug build error=%t; want %t", tc.args, err, got, tc.want)
+			}
+		})
+	}
+}
+
 func TestGccOutputs(t *testing.T) {
 	for _, tc := range []struct {
 		desc string
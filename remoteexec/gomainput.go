@@ -7,6 +7,7 @@ package remoteexec
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -23,6 +24,7 @@ import (
 	"go.chromium.org/goma/server/hash"
 	"go.chromium.org/goma/server/log"
 	gomapb "go.chromium.org/goma/server/proto/api"
+	execpb "go.chromium.org/goma/server/proto/exec"
 	fpb "go.chromium.org/goma/server/proto/file"
 	"go.chromium.org/goma/server/remoteexec/digest"
 	"go.chromium.org/goma/server/rpc"
@@ -42,6 +44,11 @@ type gomaInput struct {
 	// key: goma file hash -> value: digest.Data
 	digestCache DigestCache
 
+	// key: file metadata hints in client -> value: digest.Data
+	fileMetaCache *FileMetaCache
+	client        string
+	inputMeta     map[*gomapb.ExecReq_Input]*execpb.InputMeta
+
 	mu   sync.Mutex
 	srcs []*gomaInputSource
 }
@@ -57,6 +64,14 @@ func (gi *gomaInput) Close() {
 // gomaInput converts goma input file to remoteexec digest.
 func (gi *gomaInput) toDigest(ctx context.Context, input *gomapb.ExecReq_Input) (digest.Data, error) {
 	hashKey := input.GetHashKey()
+	mkey, hasMeta := metaKey(gi.client, input, gi.inputMeta[input])
+	if hashKey == "" && hasMeta {
+		// client may omit hashKey of the file unchanged since
+		// previous request.
+		if d, ok := gi.fileMetaCache.get(ctx, mkey); ok {
+			return d, nil
+		}
+	}
 	// TODO: if input has size bytes, use it as digest.
 	// if it has inlined content, put it in digest.Data.
 
@@ -68,6 +83,10 @@ func (gi *gomaInput) toDigest(ctx context.Context, input *gomapb.ExecReq_Input)
 			return nil, err
 		}
 	}
+	if hashKey == "" {
+		// client will retry with hashKey for missing input.
+		return nil, errors.New("no hash_key")
+	}
 	src := &gomaInputSource{
 		lookupClient: gi.gomaFile,
 		sema:         gi.sema,
@@ -79,7 +98,14 @@ func (gi *gomaInput) toDigest(ctx context.Context, input *gomapb.ExecReq_Input)
 	gi.srcs = append(gi.srcs, src)
 	gi.mu.Unlock()
 
-	return gi.digestCache.Get(ctx, hashKey, src)
+	d, err := gi.digestCache.Get(ctx, hashKey, src)
+	if err != nil {
+		return nil, err
+	}
+	if hasMeta {
+		gi.fileMetaCache.set(mkey, d)
+	}
+	return d, nil
 }
 
 func (gi *gomaInput) upload(ctx context.Context, content []*gomapb.FileBlob) ([]string, error) {
@@ -137,9 +163,12 @@ func (g *gomaInputSource) lookup(ctx context.Context, hashKeys []string) ([]*gom
 	}
 	var resp *gomapb.LookupFileResp
 	var err error
-	err = rpc.Retry{}.Do(ctx, func() error {
+	policy := rpc.PolicyFor(rpc.ServiceFile)
+	err = policy.RetryOr(rpc.Retry{}).Do(ctx, func() error {
 		select {
 		case g.sema <- struct{}{}:
+			ctx, cancel := policy.WithTimeout(ctx)
+			defer cancel()
 			resp, err = g.lookupClient.LookupFile(ctx, req)
 			<-g.sema
 			return err
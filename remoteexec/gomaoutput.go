@@ -23,6 +23,7 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"go.chromium.org/goma/server/cache"
 	"go.chromium.org/goma/server/file"
 	"go.chromium.org/goma/server/log"
 	gomapb "go.chromium.org/goma/server/proto/api"
@@ -39,8 +40,28 @@ type gomaOutput struct {
 	bs       bpb.ByteStreamClient
 	instance string
 	gomaFile fpb.FileServiceClient
+	backfill *OutputBackfill
+	pch      PCHPolicy
+
+	// compressor is used to download outputs by bytestream.
+	compressor cas.Compressor
+
+	// cas is used to read small outputs by BatchReadBlobs.
+	cas rpb.ContentAddressableStorageClient
+	// batchLimit is max total size of blobs in BatchReadBlobs.
+	batchLimit int64
+	// prefetched holds outputs read by BatchReadBlobs.
+	prefetched *digest.Store
+
+	// normalizer restores client's input root dir in depfile outputs
+	// of normalized action.
+	normalizer *inputRootNormalizer
 }
 
+// max size of output to read by BatchReadBlobs.
+// larger outputs are read by bytestream.
+const outputBatchReadMaxSize = 1024 * 1024
+
 func outputTimeout(size int64) time.Duration {
 	// assume at least 4MB/s
 	t := time.Duration(int64((float64(size) / (4 * 1024 * 1024)) * 1e9))
@@ -73,7 +94,7 @@ func (g gomaOutput) stdoutData(ctx context.Context, eresp *rpb.ExecuteResponse)
 	var buf bytes.Buffer
 	err := retryCAS(ctx, outputTimeout(eresp.Result.StdoutDigest.SizeBytes), func(ctx context.Context) error {
 		buf.Reset()
-		return cas.DownloadDigest(ctx, g.bs, &buf, g.instance, eresp.Result.StdoutDigest)
+		return cas.DownloadDigestCompressed(ctx, g.bs, &buf, g.instance, eresp.Result.StdoutDigest, g.compressor)
 	})
 	if err != nil {
 		logger := log.FromContext(ctx)
@@ -99,7 +120,7 @@ func (g gomaOutput) stderrData(ctx context.Context, eresp *rpb.ExecuteResponse)
 	var buf bytes.Buffer
 	err := retryCAS(ctx, outputTimeout(eresp.Result.StderrDigest.SizeBytes), func(ctx context.Context) error {
 		buf.Reset()
-		return cas.DownloadDigest(ctx, g.bs, &buf, g.instance, eresp.Result.StderrDigest)
+		return cas.DownloadDigestCompressed(ctx, g.bs, &buf, g.instance, eresp.Result.StderrDigest, g.compressor)
 	})
 	if err != nil {
 		logger := log.FromContext(ctx)
@@ -114,13 +135,61 @@ func (g gomaOutput) stderrData(ctx context.Context, eresp *rpb.ExecuteResponse)
 	return nil
 }
 
+// prefetch reads small outputs by BatchReadBlobs, so they are not
+// read by bytestream one by one.
+// It returns gomaOutput that uses the prefetched outputs.
+func (g gomaOutput) prefetch(ctx context.Context, outputs []*rpb.OutputFile) gomaOutput {
+	if g.cas == nil {
+		return g
+	}
+	var blobs []*rpb.Digest
+	for _, output := range outputs {
+		d := output.GetDigest()
+		if d.GetSizeBytes() == 0 || d.GetSizeBytes() > outputBatchReadMaxSize {
+			continue
+		}
+		if g.backfill.lazy(d) {
+			continue
+		}
+		if kind := pchKind(output.Path); kind != "" && (g.pch.Reject || g.pch.MaxSize > 0 && d.GetSizeBytes() > g.pch.MaxSize) {
+			continue
+		}
+		blobs = append(blobs, d)
+	}
+	if len(blobs) < 2 {
+		// no benefit over bytestream.
+		return g
+	}
+	store, err := cas.BatchDownload(ctx, g.cas, g.instance, blobs, g.batchLimit)
+	if err != nil {
+		// fallback to bytestream.
+		logger := log.FromContext(ctx)
+		logger.Warnf("batch read %d outputs: %v", len(blobs), err)
+		return g
+	}
+	g.prefetched = store
+	return g
+}
+
 func (g gomaOutput) outputFileHelper(ctx context.Context, fname string, output *rpb.OutputFile) (*gomapb.ExecResult_Output, error) {
+	if kind := pchKind(output.Path); kind != "" {
+		err := g.pch.check(ctx, kind, output)
+		if err != nil {
+			logger := log.FromContext(ctx)
+			logger.Warnf("%s output: %v", kind, err)
+			return nil, err
+		}
+	}
 	var blob *gomapb.FileBlob
 	err := retryCAS(ctx, outputTimeout(output.GetDigest().GetSizeBytes()), func(ctx context.Context) error {
 		var err error
 		blob, err = g.toFileBlob(ctx, output)
 		return err
 	})
+	if err == nil && g.normalizer.restoreOutput(output.Path) && blob.GetBlobType() == gomapb.FileBlob_FILE {
+		blob.Content = g.normalizer.restoreDepfile(blob.Content)
+		blob.FileSize = proto.Int64(int64(len(blob.Content)))
+	}
 	if err != nil {
 		logger := log.FromContext(ctx)
 		switch status.Code(err) {
@@ -209,7 +278,10 @@ func toChunkedFileBlob(ctx context.Context, rd io.Reader, size int64, fs fpb.Fil
 		}
 		eof = err == io.EOF
 		var resp *gomapb.StoreFileResp
-		err = rpc.Retry{}.Do(ctx, func() error {
+		policy := rpc.PolicyFor(rpc.ServiceFile)
+		err = policy.RetryOr(rpc.Retry{}).Do(ctx, func() error {
+			ctx, cancel := policy.WithTimeout(ctx)
+			defer cancel()
 			resp, err = fs.StoreFile(ctx, &gomapb.StoreFileReq{
 				Blob: []*gomapb.FileBlob{
 					{
@@ -255,10 +327,33 @@ func (g gomaOutput) toFileBlob(ctx context.Context, output *rpb.OutputFile) (*go
 
 	logger := log.FromContext(ctx)
 
+	// depfile needs its content to restore client's input root dir.
+	if g.backfill.lazy(output.Digest) && !g.normalizer.restoreOutput(output.Path) {
+		keyPrefix := backfillKeyPrefix
+		if pchKind(output.Path) != "" {
+			keyPrefix = pchBackfillKeyPrefix
+		}
+		return g.backfill.register(ctx, g.instance, keyPrefix, output.Digest)
+	}
+
+	if g.prefetched != nil {
+		if data, ok := g.prefetched.Get(output.Digest); ok {
+			b, err := datasource.ReadAll(ctx, data)
+			if err != nil {
+				return nil, err
+			}
+			return &gomapb.FileBlob{
+				BlobType: gomapb.FileBlob_FILE.Enum(),
+				Content:  b,
+				FileSize: proto.Int64(output.Digest.SizeBytes),
+			}, nil
+		}
+	}
+
 	if output.Digest.SizeBytes <= file.LargeFileThreshold {
 		// for single FileBlob.
 		var buf bytes.Buffer
-		err := cas.DownloadDigest(ctx, g.bs, &buf, g.instance, output.Digest)
+		err := cas.DownloadDigestCompressed(ctx, g.bs, &buf, g.instance, output.Digest, g.compressor)
 		if err != nil {
 			return nil, err
 		}
@@ -276,7 +371,7 @@ func (g gomaOutput) toFileBlob(ctx context.Context, output *rpb.OutputFile) (*go
 	}
 	defer rd.Close()
 	go func() {
-		err := cas.DownloadDigest(ctx, g.bs, wr, g.instance, output.Digest)
+		err := cas.DownloadDigestCompressed(ctx, g.bs, wr, g.instance, output.Digest, g.compressor)
 		if err != nil {
 			switch status.Code(err) {
 			case codes.Unavailable, codes.Canceled, codes.Aborted:
@@ -289,7 +384,7 @@ func (g gomaOutput) toFileBlob(ctx context.Context, output *rpb.OutputFile) (*go
 		casErrCh <- err
 	}()
 
-	blob, err := toChunkedFileBlob(ctx, rd, output.Digest.SizeBytes, g.gomaFile)
+	blob, err := toChunkedFileBlob(cache.WithBlobType(ctx, cache.BlobTypeFromPath(output.Path)), rd, output.Digest.SizeBytes, g.gomaFile)
 	// prefer cas err for Unauthenticated error.
 	// http://b/181914314
 	if casErr := <-casErrCh; casErr != nil {
@@ -341,7 +436,7 @@ func (g gomaOutput) outputDirectory(ctx context.Context, filepath clientFilePath
 	}
 	var buf bytes.Buffer
 	err := retryCAS(ctx, outputTimeout(output.TreeDigest.SizeBytes), func(ctx context.Context) error {
-		return cas.DownloadDigest(ctx, g.bs, &buf, g.instance, output.TreeDigest)
+		return cas.DownloadDigestCompressed(ctx, g.bs, &buf, g.instance, output.TreeDigest, g.compressor)
 	})
 	if err != nil {
 		logger.Errorf("failed to download tree %s: %v", dname, err)
@@ -369,7 +464,7 @@ func (g gomaOutput) outputDirectory(ctx context.Context, filepath clientFilePath
 		ds.Set(d)
 	}
 	outputFiles := traverseTree(ctx, filepath, dname, tree.Root, ds)
-	return g.outputFilesConcurrent(ctx, outputFiles, sema)
+	return g.prefetch(ctx, outputFiles).outputFilesConcurrent(ctx, outputFiles, sema)
 }
 
 // reduceRespSize attempts to reduce the encoded size of `g.gomaResp` to under `byteLimit`.
@@ -394,7 +489,10 @@ func (g gomaOutput) reduceRespSize(ctx context.Context, byteLimit int, sema chan
 		}
 		var resp *gomapb.StoreFileResp
 		var err error
-		err = rpc.Retry{}.Do(ctx, func() error {
+		policy := rpc.PolicyFor(rpc.ServiceFile)
+		err = policy.RetryOr(rpc.Retry{}).Do(ctx, func() error {
+			ctx, cancel := policy.WithTimeout(ctx)
+			defer cancel()
 			blob := &gomapb.FileBlob{
 				BlobType: gomapb.FileBlob_FILE.Enum(),
 				Content:  input,
@@ -436,7 +534,7 @@ func (g gomaOutput) reduceRespSize(ctx context.Context, byteLimit int, sema chan
 				<-sema
 			}()
 
-			newBlob, err := toStoredFileBlob(ctx, blob.Content, g.gomaFile)
+			newBlob, err := toStoredFileBlob(cache.WithBlobType(ctx, cache.BlobTypeFromPath(out.GetFilename())), blob.Content, g.gomaFile)
 			if err != nil {
 				return err
 			}
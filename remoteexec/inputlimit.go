@@ -0,0 +1,115 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// InputLimitPolicy limits number of inputs and total size of inputs
+// per ExecReq for each user group.
+// Requests exceeding the limits are rejected as bad request, rather
+// than spending time to build input tree and to upload to CAS for
+// requests that would time out anyway.
+//
+// It is loaded from JSON config, e.g.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "group": "chrome-bot",
+//	      "max_inputs": 100000,
+//	      "max_input_bytes": 10737418240
+//	    },
+//	    {
+//	      "max_inputs": 50000,
+//	      "max_input_bytes": 4294967296
+//	    }
+//	  ]
+//	}
+type InputLimitPolicy struct {
+	// Rules are checked in order, and the first matched rule is applied.
+	Rules []InputLimitRule `json:"rules"`
+}
+
+// InputLimitRule is a rule of InputLimitPolicy.
+type InputLimitRule struct {
+	// Group matches end user's group. empty matches any group.
+	Group string `json:"group,omitempty"`
+
+	// MaxInputs is maximum number of inputs in a request.
+	// 0 means no limit.
+	MaxInputs int `json:"max_inputs,omitempty"`
+
+	// MaxInputBytes is maximum total size of inputs in a request.
+	// 0 means no limit.
+	MaxInputBytes int64 `json:"max_input_bytes,omitempty"`
+}
+
+// LoadInputLimitPolicy loads InputLimitPolicy from JSON file fname.
+func LoadInputLimitPolicy(fname string) (*InputLimitPolicy, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	p := &InputLimitPolicy{}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return p, nil
+}
+
+// Validate checks p is valid.
+func (p *InputLimitPolicy) Validate() error {
+	for i, r := range p.Rules {
+		if r.MaxInputs < 0 {
+			return fmt.Errorf("rule %d: negative max_inputs %d", i, r.MaxInputs)
+		}
+		if r.MaxInputBytes < 0 {
+			return fmt.Errorf("rule %d: negative max_input_bytes %d", i, r.MaxInputBytes)
+		}
+	}
+	return nil
+}
+
+// Limit returns the first rule matched with group.
+// It returns zero rule (i.e. no limit) if p is nil or no rule matches.
+func (p *InputLimitPolicy) Limit(group string) InputLimitRule {
+	if p == nil {
+		return InputLimitRule{}
+	}
+	for _, r := range p.Rules {
+		if r.Group != "" && r.Group != group {
+			continue
+		}
+		return r
+	}
+	return InputLimitRule{}
+}
+
+// checkInputs checks number of inputs n.
+// It returns error message if it exceeds the limit.
+func (r InputLimitRule) checkInputs(group string, n int) string {
+	if r.MaxInputs == 0 || n <= r.MaxInputs {
+		return ""
+	}
+	return fmt.Sprintf("too many inputs: %d inputs exceeds limit %d for group %q", n, r.MaxInputs, group)
+}
+
+// checkInputBytes checks total size of inputs size.
+// It returns error message if it exceeds the limit.
+func (r InputLimitRule) checkInputBytes(group string, size int64) string {
+	if r.MaxInputBytes == 0 || size <= r.MaxInputBytes {
+		return ""
+	}
+	return fmt.Sprintf("inputs too large: total %d bytes exceeds limit %d bytes for group %q", size, r.MaxInputBytes, group)
+}
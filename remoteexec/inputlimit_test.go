@@ -0,0 +1,91 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInputLimitPolicy(t *testing.T) {
+	const config = `{
+  "rules": [
+    {
+      "group": "chrome-bot",
+      "max_inputs": 100000,
+      "max_input_bytes": 10737418240
+    },
+    {
+      "max_inputs": 50000
+    }
+  ]
+}`
+	fname := filepath.Join(t.TempDir(), "input_limit.json")
+	err := ioutil.WriteFile(fname, []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadInputLimitPolicy(fname)
+	if err != nil {
+		t.Fatalf("LoadInputLimitPolicy(%q)=_, %v; want nil error", fname, err)
+	}
+
+	for _, tc := range []struct {
+		group      string
+		inputs     int
+		inputBytes int64
+		wantInputs bool
+		wantBytes  bool
+	}{
+		{
+			group:      "chrome-bot",
+			inputs:     60000,
+			inputBytes: 8 << 30,
+		},
+		{
+			group:      "chrome-bot",
+			inputs:     100001,
+			inputBytes: 11 << 30,
+			wantInputs: true,
+			wantBytes:  true,
+		},
+		{
+			group:      "user",
+			inputs:     60000,
+			inputBytes: 11 << 30,
+			wantInputs: true,
+		},
+		{
+			group:      "user",
+			inputs:     50000,
+			inputBytes: 1 << 30,
+		},
+	} {
+		r := p.Limit(tc.group)
+		if got := r.checkInputs(tc.group, tc.inputs); (got != "") != tc.wantInputs {
+			t.Errorf("Limit(%q).checkInputs(%d)=%q; want error=%t", tc.group, tc.inputs, got, tc.wantInputs)
+		}
+		if got := r.checkInputBytes(tc.group, tc.inputBytes); (got != "") != tc.wantBytes {
+			t.Errorf("Limit(%q).checkInputBytes(%d)=%q; want error=%t", tc.group, tc.inputBytes, got, tc.wantBytes)
+		}
+	}
+
+	var nilPolicy *InputLimitPolicy
+	if got := nilPolicy.Limit("user"); got != (InputLimitRule{}) {
+		t.Errorf("nil policy Limit=%v; want no limit", got)
+	}
+}
+
+func TestInputLimitPolicyValidate(t *testing.T) {
+	p := &InputLimitPolicy{
+		Rules: []InputLimitRule{
+			{MaxInputs: -1},
+		},
+	}
+	if err := p.Validate(); err == nil {
+		t.Errorf("Validate()=nil; want error for negative max_inputs")
+	}
+}
@@ -316,3 +316,42 @@ func hasPrefixDir(p, prefix string) bool {
 	}
 	return p[len(prefix)] == '/'
 }
+
+// relRootDir returns relative path to input root from wd,
+// which is relative working directory in input root.
+func relRootDir(wd string) string {
+	if wd == "" || wd == "." {
+		return "."
+	}
+	return strings.TrimSuffix(strings.Repeat("../", len(posixpath.SplitElem(wd))), "/")
+}
+
+// translateRootDir replaces rootDir in s with newRootDir.
+// rootDir is matched case insensitively, and only as a directory name,
+// i.e. followed by path separator, list separator, quote or end of s.
+// It is used to translate drive letter of windows paths,
+// e.g. `/IE:\src\include` to `/IC:\src\include` for rootDir `E:\src`.
+func translateRootDir(s, rootDir, newRootDir string) string {
+	if rootDir == "" || rootDir == newRootDir {
+		return s
+	}
+	var sb strings.Builder
+	i := 0
+	for i+len(rootDir) <= len(s) {
+		if !strings.EqualFold(s[i:i+len(rootDir)], rootDir) {
+			i++
+			continue
+		}
+		j := i + len(rootDir)
+		if j < len(s) && !strings.ContainsRune(`\/;"`, rune(s[j])) {
+			i++
+			continue
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(newRootDir)
+		s = s[j:]
+		i = 0
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
@@ -605,3 +605,61 @@ func TestHasPrefixDir(t *testing.T) {
 		}
 	}
 }
+
+func TestRelRootDir(t *testing.T) {
+	for _, tc := range []struct {
+		wd   string
+		want string
+	}{
+		{wd: "", want: "."},
+		{wd: ".", want: "."},
+		{wd: "out", want: ".."},
+		{wd: "out/Release", want: "../.."},
+	} {
+		got := relRootDir(tc.wd)
+		if got != tc.want {
+			t.Errorf("relRootDir(%q)=%q; want %q", tc.wd, got, tc.want)
+		}
+	}
+}
+
+func TestTranslateRootDir(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{
+			s:    `E:\src\out\Release\clang-cl.exe`,
+			want: `C:\src\out\Release\clang-cl.exe`,
+		},
+		{
+			s:    `/Ie:\SRC\include`,
+			want: `/IC:\src\include`,
+		},
+		{
+			s:    `INCLUDE=E:\src\include;E:\src\sdk\include;D:\other`,
+			want: `INCLUDE=C:\src\include;C:\src\sdk\include;D:\other`,
+		},
+		{
+			s:    `"/FoE:\src\out\foo.obj"`,
+			want: `"/FoC:\src\out\foo.obj"`,
+		},
+		{
+			s:    `E:\src`,
+			want: `C:\src`,
+		},
+		{
+			s:    `E:\srcs\foo.cc`,
+			want: `E:\srcs\foo.cc`,
+		},
+		{
+			s:    `foo.cc`,
+			want: `foo.cc`,
+		},
+	} {
+		got := translateRootDir(tc.s, `E:\src`, `C:\src`)
+		if got != tc.want {
+			t.Errorf("translateRootDir(%q, `E:\\src`, `C:\\src`)=%q; want %q", tc.s, got, tc.want)
+		}
+	}
+}
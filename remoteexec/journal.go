@@ -0,0 +1,272 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// journal phases.
+const (
+	journalAccepted = "accepted"
+	journalSetup    = "setup"
+	journalExecute  = "execute"
+)
+
+// JournalEntry is an in-flight exec request recorded in Journal.
+type JournalEntry struct {
+	// ID is an unique id of the entry.
+	ID string `json:"id"`
+
+	// RequestID is compiler_proxy_id of the request.
+	RequestID string `json:"request_id"`
+
+	// Phase is the last phase the request reached.
+	// "accepted", "setup" or "execute".
+	Phase string `json:"phase"`
+
+	// Instance is RBE instance name for the action.
+	Instance string `json:"instance,omitempty"`
+
+	// ActionDigest is digest of the action ("<hash>/<size>"),
+	// available after "setup".
+	ActionDigest string `json:"action_digest,omitempty"`
+
+	// Operation is RBE operation name, available after "execute".
+	Operation string `json:"operation,omitempty"`
+
+	// Start is the time when the request was accepted.
+	Start time.Time `json:"start"`
+}
+
+// Journal records in-flight exec requests on local disk, so that
+// restarted server can report requests lost by crash, and re-attach
+// to RBE operations that may be still running.
+//
+// Each in-flight request is stored in a file in the journal dir,
+// and removed when the request finishes.
+type Journal struct {
+	dir    string
+	prefix string
+	seq    int64
+}
+
+// NewJournal creates new journal in dir.
+func NewJournal(dir string) (*Journal, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		dir:    dir,
+		prefix: fmt.Sprintf("%d-%d", time.Now().UnixNano(), os.Getpid()),
+	}, nil
+}
+
+// Load loads entries left in the journal by previous process,
+// and removes them from the journal.
+// It should be called before accepting new requests.
+func (j *Journal) Load(ctx context.Context) ([]JournalEntry, error) {
+	logger := log.FromContext(ctx)
+	fis, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []JournalEntry
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		if strings.HasPrefix(fi.Name(), j.prefix+"-") {
+			// entry of this process.
+			continue
+		}
+		fname := filepath.Join(j.dir, fi.Name())
+		b, err := ioutil.ReadFile(fname)
+		if err != nil {
+			logger.Warnf("journal %s: %v", fname, err)
+			continue
+		}
+		var e JournalEntry
+		err = json.Unmarshal(b, &e)
+		if err != nil {
+			// partially written?
+			logger.Warnf("journal %s: %v", fname, err)
+		} else {
+			entries = append(entries, e)
+		}
+		err = os.Remove(fname)
+		if err != nil {
+			logger.Warnf("journal remove %s: %v", fname, err)
+		}
+	}
+	return entries, nil
+}
+
+// Begin begins new journal record for request.
+// It returns nil if j is nil.
+func (j *Journal) Begin(ctx context.Context, requestID string) *JournalRecord {
+	if j == nil {
+		return nil
+	}
+	id := fmt.Sprintf("%s-%d", j.prefix, atomic.AddInt64(&j.seq, 1))
+	r := &JournalRecord{
+		j: j,
+		e: JournalEntry{
+			ID:        id,
+			RequestID: requestID,
+			Phase:     journalAccepted,
+			Start:     time.Now(),
+		},
+	}
+	r.write(ctx)
+	return r
+}
+
+func (j *Journal) filename(id string) string {
+	return filepath.Join(j.dir, id+".json")
+}
+
+// JournalRecord is a record of an in-flight request in Journal.
+// All methods are no-op for nil record.
+type JournalRecord struct {
+	j *Journal
+
+	mu sync.Mutex
+	e  JournalEntry
+}
+
+// Update updates the record by f.
+func (r *JournalRecord) Update(ctx context.Context, f func(e *JournalEntry)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.e)
+	r.write(ctx)
+}
+
+// write writes the record. r.mu must be held, or r is not shared yet.
+func (r *JournalRecord) write(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	b, err := json.Marshal(r.e)
+	if err != nil {
+		logger.Errorf("journal marshal %s: %v", r.e.ID, err)
+		return
+	}
+	fname := r.j.filename(r.e.ID)
+	tmpname := fname + ".tmp"
+	err = ioutil.WriteFile(tmpname, b, 0644)
+	if err != nil {
+		logger.Errorf("journal write %s: %v", r.e.ID, err)
+		return
+	}
+	err = os.Rename(tmpname, fname)
+	if err != nil {
+		logger.Errorf("journal rename %s: %v", r.e.ID, err)
+	}
+}
+
+// Done removes the record from the journal.
+func (r *JournalRecord) Done(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := os.Remove(r.j.filename(r.e.ID))
+	if err != nil {
+		logger := log.FromContext(ctx)
+		logger.Errorf("journal remove %s: %v", r.e.ID, err)
+	}
+}
+
+// Recover reports in-flight requests lost by previous process.
+// If reattach is true, it waits for RBE operations that may be still
+// running, so that these results are stored in action cache and their
+// outcome is logged.
+func (f *Adapter) Recover(ctx context.Context, entries []JournalEntry, reattach bool) {
+	logger := log.FromContext(ctx)
+	phases := make(map[string]int)
+	for _, e := range entries {
+		phases[e.Phase]++
+		stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(journalPhaseKey, e.Phase),
+		}, journalLost.M(1))
+		logger.Warnf("lost in-flight request %s: phase=%s action=%s operation=%s started at %s", e.RequestID, e.Phase, e.ActionDigest, e.Operation, e.Start)
+	}
+	logger.Infof("lost %d in-flight requests: %v", len(entries), phases)
+	if !reattach {
+		return
+	}
+	client := f.client(ctx)
+	for _, e := range entries {
+		if e.Operation == "" {
+			continue
+		}
+		resp, err := waitOperation(ctx, client, e.Operation)
+		result := "ok"
+		switch {
+		case status.Code(err) == codes.NotFound:
+			result = "not-found"
+		case err != nil:
+			result = "error"
+		}
+		stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(journalResultKey, result),
+		}, journalReattach.M(1))
+		if err != nil {
+			logger.Warnf("reattach %s for %s: %v", e.Operation, e.RequestID, err)
+			continue
+		}
+		logger.Infof("reattach %s for %s: exit=%d cached=%t", e.Operation, e.RequestID, resp.GetResult().GetExitCode(), resp.GetCachedResult())
+	}
+}
+
+// waitOperation waits for operation name to complete.
+func waitOperation(ctx context.Context, c Client, name string) (*rpb.ExecuteResponse, error) {
+	stream, err := c.Exec().WaitExecution(ctx, &rpb.WaitExecutionRequest{
+		Name: name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if !op.GetDone() {
+			continue
+		}
+		if st := op.GetError(); st != nil {
+			return nil, status.FromProto(st).Err()
+		}
+		resp := &rpb.ExecuteResponse{}
+		err = op.GetResponse().UnmarshalTo(resp)
+		if err != nil {
+			return nil, err
+		}
+		return resp, status.FromProto(resp.GetStatus()).Err()
+	}
+}
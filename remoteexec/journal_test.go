@@ -0,0 +1,69 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := NewJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := j.Begin(ctx, "done-request")
+	done.Done(ctx)
+
+	lost := j.Begin(ctx, "lost-request")
+	lost.Update(ctx, func(e *JournalEntry) {
+		e.Phase = journalExecute
+		e.ActionDigest = "1234/56"
+		e.Operation = "operations/1"
+	})
+
+	// journal of the same process is not loaded.
+	entries, err := j.Load(ctx)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("j.Load()=%v, %v; want no entries", entries, err)
+	}
+
+	// restart.
+	j, err = NewJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = j.Load(ctx)
+	if err != nil {
+		t.Fatalf("j.Load()=%v, %v; want nil error", entries, err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("j.Load()=%v; want 1 entry", entries)
+	}
+	e := entries[0]
+	if e.RequestID != "lost-request" || e.Phase != journalExecute || e.ActionDigest != "1234/56" || e.Operation != "operations/1" {
+		t.Errorf("j.Load()[0]=%#v; want lost-request in execute phase", e)
+	}
+
+	entries, err = j.Load(ctx)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("j.Load()=%v, %v; want no entries after load", entries, err)
+	}
+
+	// nil journal is no-op.
+	var nj *Journal
+	r := nj.Begin(ctx, "request")
+	r.Update(ctx, func(e *JournalEntry) { e.Phase = journalSetup })
+	r.Done(ctx)
+}
@@ -0,0 +1,450 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+
+	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/remoteexec/datasource"
+	"go.chromium.org/goma/server/remoteexec/digest"
+)
+
+// Sandboxes to run actions locally.
+const (
+	// LocalSandboxDocker runs action in the action's container image
+	// without network.
+	LocalSandboxDocker = "docker"
+	// LocalSandboxNsjail runs action in nsjail without network.
+	// Only input root and LocalExecutor.ReadOnlyDirs are visible
+	// in the sandbox.
+	LocalSandboxNsjail = "nsjail"
+
+	// localSandboxNone runs action directly on host.
+	// It is only for test, as it would run arbitrary commands
+	// requested by clients on the proxy host.
+	localSandboxNone = "none"
+)
+
+// DefaultLocalReadOnlyDirs are default host directories visible
+// in LocalSandboxNsjail, i.e. system libraries and tools.
+var DefaultLocalReadOnlyDirs = []string{"/bin", "/lib", "/lib64", "/usr"}
+
+// LocalExecutor executes actions on the local host, when RBE backend
+// is unreachable or retries are exhausted, so that builds can make
+// progress (slowly) during RBE outages.
+//
+// It supports linux actions that don't need privileged containers.
+// Actions that need input root at absolute path are supported
+// only by LocalSandboxDocker.
+type LocalExecutor struct {
+	// Sandbox is one of LocalSandbox*.
+	Sandbox string
+
+	// Dir is a directory to create working directories of actions.
+	Dir string
+
+	// Sema limits concurrent local executions.
+	Sema chan struct{}
+
+	// Hostname is reported as worker in execution metadata.
+	Hostname string
+
+	// ReadOnlyDirs are host directories mounted read-only in
+	// LocalSandboxNsjail, e.g. system libraries and toolchains.
+	// Directories that don't exist on the host are ignored.
+	ReadOnlyDirs []string
+}
+
+// NewLocalExecutor creates LocalExecutor to run at most concurrency
+// actions in sandbox, using dir as working space.
+func NewLocalExecutor(sandbox, dir string, concurrency int) (*LocalExecutor, error) {
+	switch sandbox {
+	case LocalSandboxDocker, LocalSandboxNsjail:
+	default:
+		return nil, fmt.Errorf("unknown local sandbox %q", sandbox)
+	}
+	if concurrency <= 0 {
+		return nil, fmt.Errorf("bad local concurrency %d", concurrency)
+	}
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "goma-local-exec")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	return &LocalExecutor{
+		Sandbox:      sandbox,
+		Dir:          dir,
+		Sema:         make(chan struct{}, concurrency),
+		Hostname:     hostname,
+		ReadOnlyDirs: DefaultLocalReadOnlyDirs,
+	}, nil
+}
+
+// fallbackable reports whether r, failed with RBE, could be executed locally.
+func (l *LocalExecutor) fallbackable(ctx context.Context, r *request) bool {
+	if l == nil || ctx.Err() != nil {
+		return false
+	}
+	switch status.Code(r.err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+	default:
+		return false
+	}
+	if r.action == nil || r.action.CommandDigest == nil || r.action.InputRootDigest == nil {
+		return false
+	}
+	if platformOSFamily(r.platform) == "Windows" {
+		return false
+	}
+	switch r.wrapperType {
+	case wrapperRelocatable:
+	case wrapperInputRootAbsolutePath:
+		if l.Sandbox != LocalSandboxDocker {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, p := range r.platform.GetProperties() {
+		if p.Name == "dockerPrivileged" && p.Value == "true" {
+			return false
+		}
+	}
+	return true
+}
+
+// run runs r's action locally, and sets r to use outputs of the local
+// execution. It returns ExecuteResponse of the local execution.
+func (l *LocalExecutor) run(ctx context.Context, r *request) (eresp *rpb.ExecuteResponse, err error) {
+	logger := log.FromContext(ctx)
+	t0 := time.Now()
+	defer func() {
+		result := "success"
+		switch {
+		case err != nil:
+			result = "failure"
+		case eresp.Result.ExitCode != 0:
+			result = "exit-error"
+		}
+		stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(localFallbackResultKey, result)}, localFallbacks.M(1), localFallbackTime.M(float64(time.Since(t0).Nanoseconds())/1e6))
+	}()
+
+	select {
+	case l.Sema <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-l.Sema
+	}()
+
+	command := &rpb.Command{}
+	data, ok := r.digestStore.Get(r.action.CommandDigest)
+	if !ok {
+		return nil, fmt.Errorf("command %v not found", r.action.CommandDigest)
+	}
+	err = datasource.ReadProto(ctx, data, command)
+	if err != nil {
+		return nil, fmt.Errorf("command %v: %v", r.action.CommandDigest, err)
+	}
+
+	workDir, err := ioutil.TempDir(l.Dir, "exec")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+	root := filepath.Join(workDir, "root")
+	err = materializeDir(ctx, r.digestStore, r.action.InputRootDigest, root)
+	if err != nil {
+		return nil, fmt.Errorf("input root: %v", err)
+	}
+	for _, p := range command.OutputFiles {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(root, filepath.FromSlash(p))), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range command.OutputDirectories {
+		err = os.MkdirAll(filepath.Join(root, filepath.FromSlash(p)), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mountDir := root
+	if r.wrapperType == wrapperInputRootAbsolutePath {
+		mountDir = r.tree.RootDir()
+	}
+	if d := r.action.Timeout.AsDuration(); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	cmd, err := l.command(ctx, command, root, mountDir)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err = cmd.Run()
+	end := time.Now()
+	var exitCode int
+	if err != nil {
+		var eerr *exec.ExitError
+		if !errors.As(err, &eerr) || ctx.Err() != nil {
+			return nil, fmt.Errorf("run %s: %v", l.Sandbox, err)
+		}
+		exitCode = eerr.ExitCode()
+	}
+	logger.Infof("local %s exit=%d: %s", l.Sandbox, exitCode, end.Sub(start))
+
+	store := digest.NewStore()
+	result := &rpb.ActionResult{
+		ExitCode:  int32(exitCode),
+		StdoutRaw: stdout.Bytes(),
+		StderrRaw: stderr.Bytes(),
+		ExecutionMetadata: &rpb.ExecutedActionMetadata{
+			Worker:                      "local:" + l.Hostname,
+			QueuedTimestamp:             tspb.New(t0),
+			WorkerStartTimestamp:        tspb.New(t0),
+			ExecutionStartTimestamp:     tspb.New(start),
+			ExecutionCompletedTimestamp: tspb.New(end),
+			WorkerCompletedTimestamp:    tspb.New(time.Now()),
+		},
+	}
+	for _, p := range command.OutputFiles {
+		output, err := collectOutput(root, p, store)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %v", p, err)
+		}
+		result.OutputFiles = append(result.OutputFiles, output)
+	}
+	// output directories are flattened to output files,
+	// so they are served without Tree in CAS.
+	for _, p := range command.OutputDirectories {
+		dir := filepath.Join(root, filepath.FromSlash(p))
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			output, err := collectOutput(root, filepath.ToSlash(rel), store)
+			if err != nil {
+				return err
+			}
+			result.OutputFiles = append(result.OutputFiles, output)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("output dir %s: %v", p, err)
+		}
+	}
+	r.err = nil
+	r.localOutputs = store
+	return &rpb.ExecuteResponse{
+		Result: result,
+	}, nil
+}
+
+// command returns a command to run command in root,
+// which is visible as mountDir in the sandbox.
+func (l *LocalExecutor) command(ctx context.Context, command *rpb.Command, root, mountDir string) (*exec.Cmd, error) {
+	if len(command.Arguments) == 0 {
+		return nil, errors.New("no arguments")
+	}
+	var envs []string
+	for _, e := range command.EnvironmentVariables {
+		envs = append(envs, e.Name+"="+e.Value)
+	}
+	switch l.Sandbox {
+	case localSandboxNone:
+		// arg0 is relative to root, but exec.Command resolves it
+		// in current directory.
+		arg0 := command.Arguments[0]
+		if !filepath.IsAbs(arg0) && strings.Contains(arg0, "/") {
+			arg0 = filepath.Join(root, arg0)
+		}
+		cmd := exec.CommandContext(ctx, arg0, command.Arguments[1:]...)
+		cmd.Dir = root
+		cmd.Env = envs
+		return cmd, nil
+
+	case LocalSandboxNsjail:
+		args := []string{
+			"--mode", "o",
+			"--quiet",
+			"--time_limit", "0",
+			"--disable_rlimits",
+		}
+		// don't expose whole host filesystem, which may have
+		// credentials of the proxy.
+		for _, dir := range l.ReadOnlyDirs {
+			if _, err := os.Stat(dir); err != nil {
+				continue
+			}
+			args = append(args, "--bindmount_ro", dir)
+		}
+		args = append(args,
+			"--bindmount", "/dev/null",
+			"--tmpfsmount", "/tmp",
+			"--bindmount", root+":"+mountDir,
+			"--cwd", mountDir,
+		)
+		for _, e := range envs {
+			args = append(args, "--env", e)
+		}
+		args = append(args, "--")
+		args = append(args, command.Arguments...)
+		return exec.CommandContext(ctx, "nsjail", args...), nil
+
+	case LocalSandboxDocker:
+		var image string
+		for _, p := range command.Platform.GetProperties() {
+			if p.Name == "container-image" {
+				image = strings.TrimPrefix(p.Value, "docker://")
+			}
+		}
+		if image == "" {
+			return nil, errors.New("no container-image in platform")
+		}
+		args := []string{
+			"run", "--rm",
+			"--network", "none",
+			"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			"--volume", root + ":" + mountDir,
+			"--workdir", mountDir,
+		}
+		for _, e := range envs {
+			args = append(args, "--env", e)
+		}
+		args = append(args, image)
+		args = append(args, command.Arguments...)
+		return exec.CommandContext(ctx, "docker", args...), nil
+	}
+	return nil, fmt.Errorf("unknown local sandbox %q", l.Sandbox)
+}
+
+// materializeDir writes directory tree of d in ds to dir.
+func materializeDir(ctx context.Context, ds *digest.Store, d *rpb.Digest, dir string) error {
+	data, ok := ds.Get(d)
+	if !ok {
+		return fmt.Errorf("directory %v not found for %s", d, dir)
+	}
+	pdir := &rpb.Directory{}
+	err := datasource.ReadProto(ctx, data, pdir)
+	if err != nil {
+		return fmt.Errorf("directory %v for %s: %v", d, dir, err)
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	for _, f := range pdir.Files {
+		err := materializeFile(ctx, ds, f, filepath.Join(dir, f.Name))
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range pdir.Symlinks {
+		err := os.Symlink(s.Target, filepath.Join(dir, s.Name))
+		if err != nil {
+			return err
+		}
+	}
+	for _, sd := range pdir.Directories {
+		err := materializeDir(ctx, ds, sd.Digest, filepath.Join(dir, sd.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func materializeFile(ctx context.Context, ds *digest.Store, f *rpb.FileNode, fname string) error {
+	var mode os.FileMode = 0644
+	if f.IsExecutable {
+		mode = 0755
+	}
+	w, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if f.Digest.GetSizeBytes() == 0 {
+		return w.Close()
+	}
+	data, ok := ds.Get(f.Digest)
+	if !ok {
+		w.Close()
+		return fmt.Errorf("file %v not found for %s", f.Digest, fname)
+	}
+	rd, err := data.Open(ctx)
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("file %v for %s: %v", f.Digest, fname, err)
+	}
+	defer rd.Close()
+	_, err = io.Copy(w, rd)
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("file %v for %s: %v", f.Digest, fname, err)
+	}
+	return w.Close()
+}
+
+// collectOutput reads root relative output file p in root, and stores
+// its content in store.
+func collectOutput(root, p string, store *digest.Store) (*rpb.OutputFile, error) {
+	fname := filepath.Join(root, filepath.FromSlash(p))
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("not regular file: %s", fi.Mode())
+	}
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	data := digest.Bytes(p, b)
+	store.Set(data)
+	return &rpb.OutputFile{
+		Path:         p,
+		Digest:       data.Digest(),
+		IsExecutable: fi.Mode()&0100 != 0,
+	}, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/remoteexec/datasource"
+	"go.chromium.org/goma/server/remoteexec/digest"
+)
+
+func TestLocalExecutorRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skipf("no sh: %v", err)
+	}
+	ctx := context.Background()
+	ds := digest.NewStore()
+	setData := func(d digest.Data) *rpb.Digest {
+		ds.Set(d)
+		return d.Digest()
+	}
+	setProto := func(m *rpb.Directory) *rpb.Digest {
+		d, err := digest.Proto(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return setData(d)
+	}
+
+	wrapper := digest.Bytes("run.sh", []byte(`#!/bin/sh
+cd "$WORK_DIR"
+cat in.txt > "$1"
+mkdir -p gen/sub
+echo gen > gen/sub/x.h
+echo warning >&2
+exit 3
+`))
+	input := digest.Bytes("in.txt", []byte("hello\n"))
+	srcDir := setProto(&rpb.Directory{
+		Files: []*rpb.FileNode{
+			{Name: "in.txt", Digest: setData(input)},
+		},
+	})
+	rootDir := setProto(&rpb.Directory{
+		Files: []*rpb.FileNode{
+			{Name: "run.sh", Digest: setData(wrapper), IsExecutable: true},
+		},
+		Directories: []*rpb.DirectoryNode{
+			{Name: "src", Digest: srcDir},
+		},
+	})
+	cmd, err := digest.Proto(&rpb.Command{
+		Arguments: []string{"./run.sh", "../out/a.txt"},
+		EnvironmentVariables: []*rpb.Command_EnvironmentVariable{
+			{Name: "WORK_DIR", Value: "src"},
+		},
+		OutputFiles:       []string{"out/a.txt", "out/missing.o"},
+		OutputDirectories: []string{"src/gen"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &LocalExecutor{
+		Sandbox: localSandboxNone,
+		Dir:     t.TempDir(),
+		Sema:    make(chan struct{}, 1),
+	}
+	r := &request{
+		digestStore: ds,
+		platform:    &rpb.Platform{},
+		action: &rpb.Action{
+			CommandDigest:   setData(cmd),
+			InputRootDigest: rootDir,
+		},
+		wrapperType: wrapperRelocatable,
+		err:         status.Error(codes.Unavailable, "rbe is down"),
+	}
+	if !l.fallbackable(ctx, r) {
+		t.Fatalf("fallbackable=false; want true")
+	}
+	eresp, err := l.run(ctx, r)
+	if err != nil {
+		t.Fatalf("run=_, %v; want nil error", err)
+	}
+	if r.err != nil {
+		t.Errorf("r.err=%v; want nil", r.err)
+	}
+	if got, want := eresp.Result.ExitCode, int32(3); got != want {
+		t.Errorf("exit code=%d; want %d", got, want)
+	}
+	if got, want := string(eresp.Result.StderrRaw), "warning\n"; got != want {
+		t.Errorf("stderr=%q; want %q", got, want)
+	}
+	want := map[string]string{
+		"out/a.txt":       "hello\n",
+		"src/gen/sub/x.h": "gen\n",
+	}
+	if len(eresp.Result.OutputFiles) != len(want) {
+		t.Errorf("outputs=%v; want %d outputs", eresp.Result.OutputFiles, len(want))
+	}
+	for _, output := range eresp.Result.OutputFiles {
+		data, ok := r.localOutputs.Get(output.Digest)
+		if !ok {
+			t.Errorf("output %s %v not in local outputs", output.Path, output.Digest)
+			continue
+		}
+		b, err := datasource.ReadAll(ctx, data)
+		if err != nil {
+			t.Errorf("read %s: %v", output.Path, err)
+			continue
+		}
+		if got := string(b); got != want[output.Path] {
+			t.Errorf("output %s=%q; want %q", output.Path, got, want[output.Path])
+		}
+	}
+}
+
+func TestLocalExecutorFallbackable(t *testing.T) {
+	ctx := context.Background()
+	l := &LocalExecutor{Sandbox: LocalSandboxNsjail}
+	newReq := func() *request {
+		return &request{
+			platform: &rpb.Platform{},
+			action: &rpb.Action{
+				CommandDigest:   &rpb.Digest{Hash: "cmd", SizeBytes: 1},
+				InputRootDigest: &rpb.Digest{Hash: "root", SizeBytes: 1},
+			},
+			wrapperType: wrapperRelocatable,
+			err:         status.Error(codes.DeadlineExceeded, "timed out"),
+		}
+	}
+	for _, tc := range []struct {
+		desc string
+		l    *LocalExecutor
+		mod  func(r *request)
+		want bool
+	}{
+		{
+			desc: "deadline exceeded",
+			l:    l,
+			want: true,
+		},
+		{
+			desc: "disabled",
+			want: false,
+		},
+		{
+			desc: "permission denied",
+			l:    l,
+			mod: func(r *request) {
+				r.err = status.Error(codes.PermissionDenied, "denied")
+			},
+			want: false,
+		},
+		{
+			desc: "input root absolute path",
+			l:    l,
+			mod: func(r *request) {
+				r.wrapperType = wrapperInputRootAbsolutePath
+			},
+			want: false,
+		},
+		{
+			desc: "input root absolute path in docker",
+			l:    &LocalExecutor{Sandbox: LocalSandboxDocker},
+			mod: func(r *request) {
+				r.wrapperType = wrapperInputRootAbsolutePath
+			},
+			want: true,
+		},
+		{
+			desc: "privileged",
+			l:    l,
+			mod: func(r *request) {
+				r.platform.Properties = append(r.platform.Properties, &rpb.Platform_Property{
+					Name:  "dockerPrivileged",
+					Value: "true",
+				})
+			},
+			want: false,
+		},
+		{
+			desc: "windows",
+			l:    l,
+			mod: func(r *request) {
+				r.platform.Properties = append(r.platform.Properties, &rpb.Platform_Property{
+					Name:  "OSFamily",
+					Value: "Windows",
+				})
+			},
+			want: false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := newReq()
+			if tc.mod != nil {
+				tc.mod(r)
+			}
+			if got := tc.l.fallbackable(ctx, r); got != tc.want {
+				t.Errorf("fallbackable=%t; want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewLocalExecutorSandbox(t *testing.T) {
+	for _, sandbox := range []string{"", localSandboxNone, "chroot"} {
+		_, err := NewLocalExecutor(sandbox, t.TempDir(), 1)
+		if err == nil {
+			t.Errorf("NewLocalExecutor(%q, dir, 1)=_, nil; want error", sandbox)
+		}
+	}
+}
+
+func TestLocalExecutorCommandNsjail(t *testing.T) {
+	ctx := context.Background()
+	hostDir := t.TempDir()
+	l := &LocalExecutor{
+		Sandbox:      LocalSandboxNsjail,
+		ReadOnlyDirs: []string{hostDir, "/nonexistent-toolchain-dir"},
+	}
+	cmd, err := l.command(ctx, &rpb.Command{
+		Arguments: []string{"./clang", "-c", "a.c"},
+	}, "/work/root", "/work/root")
+	if err != nil {
+		t.Fatalf("command=_, %v; want nil error", err)
+	}
+	var mounts []string
+	for i, arg := range cmd.Args {
+		if i+1 < len(cmd.Args) && strings.HasPrefix(arg, "--bindmount") {
+			mounts = append(mounts, arg+" "+cmd.Args[i+1])
+		}
+	}
+	want := []string{
+		"--bindmount_ro " + hostDir,
+		"--bindmount /dev/null",
+		"--bindmount /work/root:/work/root",
+	}
+	if diff := cmp.Diff(want, mounts); diff != "" {
+		t.Errorf("mounts diff -want +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"strings"
+
+	"go.chromium.org/goma/server/command/descriptor/posixpath"
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// macOS toolchain support for arbitrary toolchain.
+//
+// Xcode toolchain and SDKs are installed in developer dir
+// (e.g. /Applications/Xcode.app/Contents/Developer), which is
+// out of the build directory, so the input root would be "/"
+// and needs chroot, which is not available on mac workers.
+// Instead, files in developer dir (toolchain binaries, SDK headers,
+// framework directories, .tbd stubs etc) are relocated to
+// macDeveloperDirInRoot in the input root, and paths in args are
+// rewritten to relative paths to it.
+
+// macDeveloperDirInRoot is a directory in input root to relocate
+// developer dir.
+const macDeveloperDirInRoot = ".goma_developer_dir"
+
+// macXcodeToolchainDir is a directory of default toolchain in developer dir.
+const macXcodeToolchainDir = "Toolchains/XcodeDefault.xctoolchain/usr/bin"
+
+// osFamilyFromDimensions returns OSFamily platform property value
+// for requester's dimensions, e.g. "os:mac".
+// It returns "" if no os dimension is found.
+func osFamilyFromDimensions(dimensions []string) string {
+	for _, d := range dimensions {
+		switch strings.ToLower(d) {
+		case "os:mac", "os:macos", "os:darwin":
+			return "MacOS"
+		case "os:win", "os:windows":
+			return "Windows"
+		case "os:linux":
+			return "Linux"
+		}
+	}
+	return ""
+}
+
+// macDeveloperDir returns developer dir that contains path p, i.e.
+// "/Applications/<xcode>.app/Contents/Developer" or
+// "/Library/Developer/CommandLineTools".
+func macDeveloperDir(p string) (string, bool) {
+	const cmdlineTools = "/Library/Developer/CommandLineTools"
+	if hasPrefixDir(p, cmdlineTools) {
+		return cmdlineTools, true
+	}
+	if !strings.HasPrefix(p, "/Applications/") {
+		return "", false
+	}
+	i := strings.Index(p, ".app/Contents/Developer")
+	if i < 0 {
+		return "", false
+	}
+	dir := p[:i+len(".app/Contents/Developer")]
+	if !hasPrefixDir(p, dir) {
+		return "", false
+	}
+	return dir, true
+}
+
+// xcrunShim reports whether argv0 is xcrun shim in /usr/bin,
+// which runs the command in developer dir selected by xcode-select.
+func xcrunShim(argv0 string) bool {
+	switch argv0 {
+	case "/usr/bin/cc", "/usr/bin/c++", "/usr/bin/clang", "/usr/bin/clang++", "/usr/bin/gcc", "/usr/bin/g++":
+		return true
+	}
+	return false
+}
+
+// xcrunCompiler returns compiler in toolchain specs that xcrun shim argv0
+// would run. It returns false if no such compiler is found in toolchain
+// specs.
+func xcrunCompiler(argv0 string, ts []*gomapb.ToolchainSpec) (string, bool) {
+	if !xcrunShim(argv0) {
+		return "", false
+	}
+	base := posixpath.Base(argv0)
+	for _, t := range ts {
+		p := t.GetPath()
+		if !t.GetIsExecutable() && t.GetSymlinkPath() == "" {
+			continue
+		}
+		dir, ok := macDeveloperDir(p)
+		if !ok {
+			continue
+		}
+		if p == posixpath.Join(dir, macXcodeToolchainDir, base) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// macRelocatePath returns path in input root for path p in developerDir.
+// It returns false if p is not in developerDir.
+func macRelocatePath(developerDir, p string) (string, bool) {
+	if developerDir == "" || !hasPrefixDir(p, developerDir) {
+		return "", false
+	}
+	return posixpath.Join(macDeveloperDirInRoot, strings.TrimPrefix(p[len(developerDir):], "/")), true
+}
+
+// macRelocateArgs rewrites paths in developerDir in args to relative
+// paths from wd, which is relative working directory in input root.
+func macRelocateArgs(args []string, developerDir, wd string) []string {
+	if developerDir == "" {
+		return args
+	}
+	dir := macDeveloperDirInRoot
+	if wd != "" && wd != "." {
+		dir = strings.Repeat("../", len(posixpath.SplitElem(wd))) + macDeveloperDirInRoot
+	}
+	relocated := make([]string, 0, len(args))
+	for _, arg := range args {
+		relocated = append(relocated, translateRootDir(arg, developerDir, dir))
+	}
+	return relocated
+}
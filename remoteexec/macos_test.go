@@ -0,0 +1,160 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestOSFamilyFromDimensions(t *testing.T) {
+	for _, tc := range []struct {
+		dimensions []string
+		want       string
+	}{
+		{
+			dimensions: []string{"os:mac", "cpu:x86-64"},
+			want:       "MacOS",
+		},
+		{
+			dimensions: []string{"cpu:x86-64", "os:win"},
+			want:       "Windows",
+		},
+		{
+			dimensions: []string{"os:linux"},
+			want:       "Linux",
+		},
+		{
+			dimensions: []string{"cpu:x86-64"},
+			want:       "",
+		},
+	} {
+		got := osFamilyFromDimensions(tc.dimensions)
+		if got != tc.want {
+			t.Errorf("osFamilyFromDimensions(%q)=%q; want %q", tc.dimensions, got, tc.want)
+		}
+	}
+}
+
+func TestMacDeveloperDir(t *testing.T) {
+	for _, tc := range []struct {
+		p      string
+		want   string
+		wantOK bool
+	}{
+		{
+			p:      "/Applications/Xcode.app/Contents/Developer/Toolchains/XcodeDefault.xctoolchain/usr/bin/clang",
+			want:   "/Applications/Xcode.app/Contents/Developer",
+			wantOK: true,
+		},
+		{
+			p:      "/Applications/Xcode_13.4.app/Contents/Developer/Platforms/MacOSX.platform/Developer/SDKs/MacOSX.sdk",
+			want:   "/Applications/Xcode_13.4.app/Contents/Developer",
+			wantOK: true,
+		},
+		{
+			p:      "/Library/Developer/CommandLineTools/usr/bin/clang",
+			want:   "/Library/Developer/CommandLineTools",
+			wantOK: true,
+		},
+		{
+			p: "/Applications/Xcode.app/Contents/DeveloperTools/clang",
+		},
+		{
+			p: "/Users/goma/src/third_party/llvm-build/Release+Asserts/bin/clang",
+		},
+		{
+			p: "/usr/bin/clang",
+		},
+	} {
+		got, ok := macDeveloperDir(tc.p)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("macDeveloperDir(%q)=%q, %t; want %q, %t", tc.p, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestXcrunCompiler(t *testing.T) {
+	const clang = "/Applications/Xcode.app/Contents/Developer/Toolchains/XcodeDefault.xctoolchain/usr/bin/clang"
+	ts := []*gomapb.ToolchainSpec{
+		{
+			Path:         proto.String("/usr/bin/clang"),
+			IsExecutable: proto.Bool(true),
+		},
+		{
+			Path:         proto.String(clang),
+			IsExecutable: proto.Bool(true),
+		},
+		{
+			Path:        proto.String("/Applications/Xcode.app/Contents/Developer/Toolchains/XcodeDefault.xctoolchain/usr/bin/clang++"),
+			SymlinkPath: proto.String("clang"),
+		},
+	}
+	for _, tc := range []struct {
+		argv0  string
+		want   string
+		wantOK bool
+	}{
+		{
+			argv0:  "/usr/bin/clang",
+			want:   clang,
+			wantOK: true,
+		},
+		{
+			argv0:  "/usr/bin/clang++",
+			want:   clang + "++",
+			wantOK: true,
+		},
+		{
+			argv0: "/usr/bin/gcc",
+		},
+		{
+			argv0: clang,
+		},
+	} {
+		got, ok := xcrunCompiler(tc.argv0, ts)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("xcrunCompiler(%q)=%q, %t; want %q, %t", tc.argv0, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestMacRelocate(t *testing.T) {
+	const developerDir = "/Applications/Xcode.app/Contents/Developer"
+	const sdk = developerDir + "/Platforms/MacOSX.platform/Developer/SDKs/MacOSX.sdk"
+
+	got, ok := macRelocatePath(developerDir, sdk+"/usr/include/stdio.h")
+	if want := ".goma_developer_dir/Platforms/MacOSX.platform/Developer/SDKs/MacOSX.sdk/usr/include/stdio.h"; got != want || !ok {
+		t.Errorf("macRelocatePath(%q, stdio.h)=%q, %t; want %q, true", developerDir, got, ok, want)
+	}
+	got, ok = macRelocatePath(developerDir, "/Users/goma/src/foo.cc")
+	if ok {
+		t.Errorf("macRelocatePath(%q, foo.cc)=%q, %t; want false", developerDir, got, ok)
+	}
+
+	args := []string{
+		developerDir + "/Toolchains/XcodeDefault.xctoolchain/usr/bin/clang",
+		"-isysroot", sdk,
+		"-F" + sdk + "/System/Library/Frameworks",
+		"-c", "../../foo.mm",
+		"-o", "obj/foo.o",
+	}
+	gotArgs := macRelocateArgs(args, developerDir, "out/Release")
+	const relDir = "../../.goma_developer_dir"
+	wantArgs := []string{
+		relDir + "/Toolchains/XcodeDefault.xctoolchain/usr/bin/clang",
+		"-isysroot", relDir + "/Platforms/MacOSX.platform/Developer/SDKs/MacOSX.sdk",
+		"-F" + relDir + "/Platforms/MacOSX.platform/Developer/SDKs/MacOSX.sdk/System/Library/Frameworks",
+		"-c", "../../foo.mm",
+		"-o", "obj/foo.o",
+	}
+	if !cmp.Equal(gotArgs, wantArgs) {
+		t.Errorf("macRelocateArgs(args, %q, out/Release) diff -want +got:\n%s", developerDir, cmp.Diff(wantArgs, gotArgs))
+	}
+}
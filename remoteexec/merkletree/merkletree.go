@@ -23,6 +23,12 @@ import (
 
 // MerkleTree represents a merkle tree.
 type MerkleTree struct {
+	// CaseInsensitive makes names in the tree case insensitive,
+	// e.g. for windows. Directories whose names differ only in case
+	// are merged into the directory set first, and files whose names
+	// differ only in case are deduped as duplicates.
+	CaseInsensitive bool
+
 	filepath FilePath
 
 	rootDir string
@@ -108,7 +114,7 @@ func (m *MerkleTree) Set(entry Entry) error {
 	}
 	if entry.Data == nil && entry.Target == "" {
 		// entry is dir
-		if _, exists := m.m[fname]; exists {
+		if _, exists := m.m[m.key(fname)]; exists {
 			// dir already exists
 			return nil
 		}
@@ -188,9 +194,17 @@ func pathJoin(dir, base string) string {
 	return b.String()
 }
 
+// key returns key of name for m.m and for duplicate check.
+func (m *MerkleTree) key(name string) string {
+	if m.CaseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
 func (m *MerkleTree) setDir(cur dirstate, name string) dirstate {
 	dirname := pathJoin(cur.name, name)
-	dir, exists := m.m[dirname]
+	dir, exists := m.m[m.key(dirname)]
 	if !exists {
 		dirnode := &rpb.DirectoryNode{
 			Name: name,
@@ -198,7 +212,7 @@ func (m *MerkleTree) setDir(cur dirstate, name string) dirstate {
 		}
 		cur.dir.Directories = append(cur.dir.Directories, dirnode)
 		dir = &rpb.Directory{}
-		m.m[dirname] = dir
+		m.m[m.key(dirname)] = dir
 	}
 	return dirstate{name: dirname, dir: dir}
 }
@@ -216,9 +230,9 @@ func (m *MerkleTree) buildTree(ctx context.Context, curdir *rpb.Directory, dirna
 	names := map[string]proto.Message{}
 	var files []*rpb.FileNode
 	for _, f := range curdir.Files {
-		p, found := names[f.Name]
+		p, found := names[m.key(f.Name)]
 		if found {
-			if !proto.Equal(f, p) {
+			if !m.sameNode(f, p) {
 				return nil, fmt.Errorf("duplicate file %s in %s: %s != %s", f.Name, dirname, f, p)
 			}
 			// goma client might send duplicate entries such as
@@ -227,7 +241,7 @@ func (m *MerkleTree) buildTree(ctx context.Context, curdir *rpb.Directory, dirna
 			logger.Infof("duplicate file %s in %s: %s", f.Name, dirname, f)
 			continue
 		}
-		names[f.Name] = f
+		names[m.key(f.Name)] = f
 		files = append(files, f)
 	}
 	sort.Slice(files, func(i, j int) bool {
@@ -237,15 +251,15 @@ func (m *MerkleTree) buildTree(ctx context.Context, curdir *rpb.Directory, dirna
 
 	var symlinks []*rpb.SymlinkNode
 	for _, s := range curdir.Symlinks {
-		p, found := names[s.Name]
+		p, found := names[m.key(s.Name)]
 		if found {
-			if !proto.Equal(s, p) {
+			if !m.sameNode(s, p) {
 				return nil, fmt.Errorf("duplicate symlink %s in %s: %s != %s", s.Name, dirname, s, p)
 			}
 			logger.Infof("duplicate symlink %s in %s: %s", s.Name, dirname, s)
 			continue
 		}
-		names[s.Name] = s
+		names[m.key(s.Name)] = s
 		symlinks = append(symlinks, s)
 	}
 	sort.Slice(symlinks, func(i, j int) bool {
@@ -256,7 +270,7 @@ func (m *MerkleTree) buildTree(ctx context.Context, curdir *rpb.Directory, dirna
 	var dirs []*rpb.DirectoryNode
 	for _, subdir := range curdir.Directories {
 		dirname := pathJoin(dirname, subdir.Name)
-		dir, found := m.m[dirname]
+		dir, found := m.m[m.key(dirname)]
 		if !found {
 			return nil, fmt.Errorf("directory not found: %s", dirname)
 		}
@@ -266,15 +280,15 @@ func (m *MerkleTree) buildTree(ctx context.Context, curdir *rpb.Directory, dirna
 		}
 		subdir.Digest = digest
 
-		p, found := names[subdir.Name]
+		p, found := names[m.key(subdir.Name)]
 		if found {
-			if !proto.Equal(subdir, p) {
+			if !m.sameNode(subdir, p) {
 				return nil, fmt.Errorf("duplicate dir %s in %s: %s != %s", subdir.Name, dirname, subdir, p)
 			}
 			logger.Infof("duplicate dir %s in %s: %s", subdir.Name, dirname, subdir)
 			continue
 		}
-		names[subdir.Name] = subdir
+		names[m.key(subdir.Name)] = subdir
 		dirs = append(dirs, subdir)
 	}
 	sort.Slice(dirs, func(i, j int) bool {
@@ -289,3 +303,23 @@ func (m *MerkleTree) buildTree(ctx context.Context, curdir *rpb.Directory, dirna
 	m.store.Set(data)
 	return data.Digest(), nil
 }
+
+// sameNode reports whether node a and b are the same,
+// ignoring case of names if m is case insensitive.
+func (m *MerkleTree) sameNode(a, b proto.Message) bool {
+	if !m.CaseInsensitive {
+		return proto.Equal(a, b)
+	}
+	a, b = proto.Clone(a), proto.Clone(b)
+	for _, n := range []proto.Message{a, b} {
+		switch n := n.(type) {
+		case *rpb.FileNode:
+			n.Name = strings.ToLower(n.Name)
+		case *rpb.SymlinkNode:
+			n.Name = strings.ToLower(n.Name)
+		case *rpb.DirectoryNode:
+			n.Name = strings.ToLower(n.Name)
+		}
+	}
+	return proto.Equal(a, b)
+}
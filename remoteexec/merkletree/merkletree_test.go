@@ -17,6 +17,7 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	"go.chromium.org/goma/server/command/descriptor/posixpath"
+	"go.chromium.org/goma/server/command/descriptor/winpath"
 	"go.chromium.org/goma/server/remoteexec/datasource"
 	"go.chromium.org/goma/server/remoteexec/digest"
 )
@@ -410,6 +411,74 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestBuildCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	ds := digest.NewStore()
+	mt := New(winpath.FilePath{}, `C:\src`, ds)
+	mt.CaseInsensitive = true
+
+	for _, ent := range []Entry{
+		{
+			Name: `Base\Debug\debugger.cc`,
+			Data: digest.Bytes("debugger.cc", []byte("debugger.cc content")),
+		},
+		{
+			Name: `base\debug\debugger.h`,
+			Data: digest.Bytes("debugger.h", []byte("debugger.h content")),
+		},
+		{
+			Name: `base\DEBUG\Debugger.h`,
+			Data: digest.Bytes("debugger.h", []byte("debugger.h content")),
+		},
+		{
+			Name: `base\macros.h`,
+			Data: digest.Bytes("macros.h", []byte("macros.h content")),
+		},
+	} {
+		err := mt.Set(ent)
+		if err != nil {
+			t.Fatalf("mt.Set(%q)=%v; want=nil", ent.Name, err)
+		}
+	}
+	d, err := mt.Build(ctx)
+	if err != nil {
+		t.Fatalf("mt.Build()=_, %v; want=nil", err)
+	}
+	dir, err := openDir(ctx, ds, d)
+	if err != nil {
+		t.Fatalf("root %v not found: %v", d, err)
+	}
+	baseDir := checkDir(ctx, t, ds, dir, "Base",
+		[]string{"macros.h"},
+		[]string{"Debug"},
+		nil)
+	checkDir(ctx, t, ds, baseDir, "Debug",
+		[]string{"debugger.cc", "debugger.h"},
+		nil, nil)
+
+	mt = New(winpath.FilePath{}, `C:\src`, ds)
+	mt.CaseInsensitive = true
+	for _, ent := range []Entry{
+		{
+			Name: `base\debugger.h`,
+			Data: digest.Bytes("debugger.h", []byte("debugger.h content")),
+		},
+		{
+			Name: `base\Debugger.h`,
+			Data: digest.Bytes("other debugger.h", []byte("other debugger.h content")),
+		},
+	} {
+		err := mt.Set(ent)
+		if err != nil {
+			t.Fatalf("mt.Set(%q)=%v; want=nil", ent.Name, err)
+		}
+	}
+	_, err = mt.Build(ctx)
+	if err == nil {
+		t.Errorf("mt.Build()=_, nil; want error for files differ only in case with different content")
+	}
+}
+
 func TestBuildDuplicateError(t *testing.T) {
 	for _, tc := range []struct {
 		desc string
@@ -0,0 +1,200 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"strings"
+)
+
+// Input root normalization.
+//
+// Non relocatable requests (e.g. absolute include dirs or --sysroot in
+// the checkout) embed client's input root dir in args and envs, so the
+// same compile in different checkouts (e.g. /home/alice/src and
+// /home/bob/src) results in different actions and never shares
+// action cache.
+// If normalization is enabled, client's input root dir is mapped to
+// canonicalInputRoot in args and envs, and the action runs with
+// InputRootAbsolutePath=canonicalInputRoot.
+// canonicalInputRoot in stdout, stderr and depfile outputs is mapped back
+// to client's input root dir in the response.
+
+// canonicalInputRoot is input root dir of normalized actions.
+const canonicalInputRoot = "/goma_input_root"
+
+// inputRootNormalizer maps client's input root dir to canonical input
+// root dir, and back.
+// nil inputRootNormalizer doesn't modify anything.
+type inputRootNormalizer struct {
+	clientRoot    string
+	canonicalRoot string
+}
+
+// newInputRootNormalizer returns inputRootNormalizer for client's input
+// root dir clientRoot.
+// It returns nil if clientRoot can't be normalized, i.e. "/" (for chroot),
+// or clientRoot and canonicalInputRoot overlap.
+func newInputRootNormalizer(clientRoot string) *inputRootNormalizer {
+	clientRoot = strings.TrimSuffix(clientRoot, "/")
+	if clientRoot == "" || !strings.HasPrefix(clientRoot, "/") {
+		return nil
+	}
+	if hasPrefixDir(clientRoot, canonicalInputRoot) || hasPrefixDir(canonicalInputRoot, clientRoot) {
+		return nil
+	}
+	return &inputRootNormalizer{
+		clientRoot:    clientRoot,
+		canonicalRoot: canonicalInputRoot,
+	}
+}
+
+// rootDir returns input root dir of the action.
+func (n *inputRootNormalizer) rootDir(rootDir string) string {
+	if n == nil {
+		return rootDir
+	}
+	return n.canonicalRoot
+}
+
+// args returns args with client's input root dir mapped to canonical
+// input root dir.
+func (n *inputRootNormalizer) args(args []string) []string {
+	if n == nil {
+		return args
+	}
+	normalized := make([]string, 0, len(args))
+	for _, arg := range args {
+		normalized = append(normalized, replaceRootDir(arg, n.clientRoot, n.canonicalRoot))
+	}
+	return normalized
+}
+
+// env returns environment variable e ("NAME=value") with client's input
+// root dir mapped to canonical input root dir.
+func (n *inputRootNormalizer) env(e string) string {
+	if n == nil {
+		return e
+	}
+	return replaceRootDir(e, n.clientRoot, n.canonicalRoot)
+}
+
+// restore returns buf with canonical input root dir mapped back to
+// client's input root dir. It is used for stdout and stderr.
+func (n *inputRootNormalizer) restore(buf []byte) []byte {
+	if n == nil || len(buf) == 0 {
+		return buf
+	}
+	s := string(buf)
+	r := replaceRootDir(s, n.canonicalRoot, n.clientRoot)
+	if r == s {
+		return buf
+	}
+	return []byte(r)
+}
+
+// restoreOutput reports whether output file of fname needs to restore
+// client's input root dir in its content.
+func (n *inputRootNormalizer) restoreOutput(fname string) bool {
+	if n == nil {
+		return false
+	}
+	return isDepfile(fname)
+}
+
+// restoreDepfile returns depfile content buf with canonical input root dir
+// mapped back to client's input root dir, escaped for depfile.
+func (n *inputRootNormalizer) restoreDepfile(buf []byte) []byte {
+	if n == nil || len(buf) == 0 {
+		return buf
+	}
+	s := string(buf)
+	r := replaceRootDir(s, n.canonicalRoot, escapeDepfilePath(n.clientRoot))
+	if r == s {
+		return buf
+	}
+	return []byte(r)
+}
+
+// isDepfile reports whether fname is depfile generated by -MD, -MMD or -MF.
+func isDepfile(fname string) bool {
+	return strings.HasSuffix(fname, ".d")
+}
+
+// escapeDepfilePath escapes path p for make-style depfile.
+func escapeDepfilePath(p string) string {
+	if !strings.ContainsAny(p, " #$") {
+		return p
+	}
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case ' ', '#':
+			sb.WriteByte('\\')
+		case '$':
+			sb.WriteByte('$')
+		}
+		sb.WriteByte(p[i])
+	}
+	return sb.String()
+}
+
+// replaceRootDir replaces rootDir in s with newRootDir.
+// rootDir is matched only as a path, i.e. at the beginning of s,
+// after separator (e.g. space, '=', ',', ':' or quote) or after a flag
+// (e.g. "-I", "-isystem"), and followed by '/', separator or end of s.
+// Unlike translateRootDir, it is case sensitive for posix path.
+func replaceRootDir(s, rootDir, newRootDir string) string {
+	if rootDir == "" || rootDir == newRootDir || !strings.Contains(s, rootDir) {
+		return s
+	}
+	var sb strings.Builder
+	last := 0
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], rootDir)
+		if j < 0 {
+			break
+		}
+		start := i + j
+		end := start + len(rootDir)
+		if rootDirStart(s, start) && (end == len(s) || rootDirEnd(s[end])) {
+			sb.WriteString(s[last:start])
+			sb.WriteString(newRootDir)
+			last = end
+		}
+		i = end
+	}
+	if last == 0 {
+		return s
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// rootDirStart reports whether path may start at s[i].
+func rootDirStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	switch s[i-1] {
+	case ' ', '\t', '\n', '=', ',', ':', ';', '"', '\'', '(', '@':
+		return true
+	}
+	// joined flag, e.g. "-I/path", "-isystem/path".
+	// s may be multiple lines (stdout, stderr), so check last word only.
+	w := s[:i]
+	if k := strings.LastIndexAny(w, " \t\n"); k >= 0 {
+		w = w[k+1:]
+	}
+	return strings.HasPrefix(w, "-") && !strings.ContainsAny(w, "/=")
+}
+
+// rootDirEnd reports whether c may follow root dir in path.
+func rootDirEnd(c byte) bool {
+	switch c {
+	case '/', ' ', '\t', '\n', '\r', ',', ':', ';', '"', '\'', ')', '\\':
+		return true
+	}
+	return false
+}
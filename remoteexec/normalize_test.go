@@ -0,0 +1,229 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewInputRootNormalizer(t *testing.T) {
+	for _, tc := range []struct {
+		rootDir string
+		want    bool
+	}{
+		{rootDir: "/home/alice/src", want: true},
+		{rootDir: "/home/alice/src/", want: true},
+		{rootDir: "/", want: false},
+		{rootDir: "", want: false},
+		{rootDir: canonicalInputRoot, want: false},
+		{rootDir: canonicalInputRoot + "/src", want: false},
+		{rootDir: canonicalInputRoot + "2", want: true},
+	} {
+		n := newInputRootNormalizer(tc.rootDir)
+		if got := n != nil; got != tc.want {
+			t.Errorf("newInputRootNormalizer(%q)=%v; want normalizer=%t", tc.rootDir, n, tc.want)
+		}
+	}
+}
+
+func TestInputRootNormalizerArgs(t *testing.T) {
+	alice := newInputRootNormalizer("/home/alice/src")
+	bob := newInputRootNormalizer("/home/bob/chromium/src")
+
+	args := func(root string) []string {
+		return []string{
+			"../../third_party/llvm-build/Release+Asserts/bin/clang++",
+			"-I" + root + "/include",
+			"-isystem", root + "/third_party/include",
+			"-isystem" + root + "/build/include",
+			"--sysroot=" + root + "/build/linux/sysroot",
+			"--sysroot", root + "/build/linux/sysroot",
+			"-Wl,-rpath," + root + "/out/lib",
+			"-I/usr/include",
+			"-I" + root + "2/include",
+			"-DSRC=\"" + root + "\"",
+			"-c",
+			root + "/base/time/time.cc",
+			"-o",
+			"obj/base/base/time.o",
+		}
+	}
+
+	want := args(canonicalInputRoot)
+	want[10] = "-I/home/alice/src2/include"
+	got := alice.args(args("/home/alice/src"))
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("alice.args(...) diff -want +got:\n%s", diff)
+	}
+
+	want[10] = "-I/home/bob/chromium/src2/include"
+	got = bob.args(args("/home/bob/chromium/src"))
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("bob.args(...) diff -want +got:\n%s", diff)
+	}
+
+	var nilNormalizer *inputRootNormalizer
+	in := args("/home/alice/src")
+	got = nilNormalizer.args(in)
+	if diff := cmp.Diff(in, got); diff != "" {
+		t.Errorf("nil.args(...) diff -want +got:\n%s", diff)
+	}
+}
+
+func TestInputRootNormalizerEnv(t *testing.T) {
+	n := newInputRootNormalizer("/home/alice/src")
+	for _, tc := range []struct {
+		env  string
+		want string
+	}{
+		{
+			env:  "PWD=/home/alice/src/out/Release",
+			want: "PWD=" + canonicalInputRoot + "/out/Release",
+		},
+		{
+			env:  "CPATH=/home/alice/src/include:/usr/include:/home/alice/src",
+			want: "CPATH=" + canonicalInputRoot + "/include:/usr/include:" + canonicalInputRoot,
+		},
+		{
+			env:  "HOME=/home/alice",
+			want: "HOME=/home/alice",
+		},
+	} {
+		got := n.env(tc.env)
+		if got != tc.want {
+			t.Errorf("env(%q)=%q; want %q", tc.env, got, tc.want)
+		}
+	}
+}
+
+func TestInputRootNormalizerRestore(t *testing.T) {
+	n := newInputRootNormalizer("/home/alice/src")
+
+	stderr := []byte(canonicalInputRoot + "/base/time/time.cc:10:3: error: unknown type name 'foo'\n" +
+		"In file included from " + canonicalInputRoot + "/include/foo.h:1:\n" +
+		"/usr/include/stdio.h:1: note: here\n")
+	want := "/home/alice/src/base/time/time.cc:10:3: error: unknown type name 'foo'\n" +
+		"In file included from /home/alice/src/include/foo.h:1:\n" +
+		"/usr/include/stdio.h:1: note: here\n"
+	if got := string(n.restore(stderr)); got != want {
+		t.Errorf("restore(%q)=%q; want %q", stderr, got, want)
+	}
+
+	var nilNormalizer *inputRootNormalizer
+	if got := string(nilNormalizer.restore(stderr)); got != string(stderr) {
+		t.Errorf("nil.restore(%q)=%q; want %q", stderr, got, stderr)
+	}
+}
+
+func TestInputRootNormalizerRestoreDepfile(t *testing.T) {
+	depfile := []byte("obj/base/base/time.o: ../../base/time/time.cc \\\n" +
+		"  " + canonicalInputRoot + "/include/foo.h \\\n" +
+		"  " + canonicalInputRoot + "/build/linux/sysroot/usr/include/stdio.h \\\n" +
+		"  /usr/include/stdlib.h\n")
+
+	for _, tc := range []struct {
+		rootDir string
+		want    string
+	}{
+		{
+			rootDir: "/home/alice/src",
+			want: "obj/base/base/time.o: ../../base/time/time.cc \\\n" +
+				"  /home/alice/src/include/foo.h \\\n" +
+				"  /home/alice/src/build/linux/sysroot/usr/include/stdio.h \\\n" +
+				"  /usr/include/stdlib.h\n",
+		},
+		{
+			rootDir: "/home/alice/my src",
+			want: "obj/base/base/time.o: ../../base/time/time.cc \\\n" +
+				"  /home/alice/my\\ src/include/foo.h \\\n" +
+				"  /home/alice/my\\ src/build/linux/sysroot/usr/include/stdio.h \\\n" +
+				"  /usr/include/stdlib.h\n",
+		},
+		{
+			rootDir: "/home/alice/src#1",
+			want: "obj/base/base/time.o: ../../base/time/time.cc \\\n" +
+				"  /home/alice/src\\#1/include/foo.h \\\n" +
+				"  /home/alice/src\\#1/build/linux/sysroot/usr/include/stdio.h \\\n" +
+				"  /usr/include/stdlib.h\n",
+		},
+	} {
+		n := newInputRootNormalizer(tc.rootDir)
+		if !n.restoreOutput("obj/base/base/time.o.d") {
+			t.Errorf("restoreOutput(%q)=false; want true", "obj/base/base/time.o.d")
+		}
+		if n.restoreOutput("obj/base/base/time.o") {
+			t.Errorf("restoreOutput(%q)=true; want false", "obj/base/base/time.o")
+		}
+		got := string(n.restoreDepfile(depfile))
+		if got != tc.want {
+			t.Errorf("restoreDepfile(...) for %q=%q; want %q", tc.rootDir, got, tc.want)
+		}
+	}
+}
+
+func TestReplaceRootDir(t *testing.T) {
+	for _, tc := range []struct {
+		s, rootDir, newRootDir string
+		want                   string
+	}{
+		{
+			s:          "/home/alice/src",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "/r",
+		},
+		{
+			s:          "/home/alice/src/foo.h",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "/r/foo.h",
+		},
+		{
+			s:          "/home/alice/srcfoo.h",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "/home/alice/srcfoo.h",
+		},
+		{
+			// not in the beginning of path.
+			s:          "/mnt/home/alice/src/foo.h",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "/mnt/home/alice/src/foo.h",
+		},
+		{
+			s:          "-I/mnt/home/alice/src/include",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "-I/mnt/home/alice/src/include",
+		},
+		{
+			s:          "-fprofile-use=/home/alice/src/pgo/default.profdata",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "-fprofile-use=/r/pgo/default.profdata",
+		},
+		{
+			// case sensitive.
+			s:          "-I/home/Alice/src/include",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "-I/home/Alice/src/include",
+		},
+		{
+			s:          "/home/alice/src/a.h /home/alice/src/b.h",
+			rootDir:    "/home/alice/src",
+			newRootDir: "/r",
+			want:       "/r/a.h /r/b.h",
+		},
+	} {
+		got := replaceRootDir(tc.s, tc.rootDir, tc.newRootDir)
+		if got != tc.want {
+			t.Errorf("replaceRootDir(%q, %q, %q)=%q; want %q", tc.s, tc.rootDir, tc.newRootDir, got, tc.want)
+		}
+	}
+}
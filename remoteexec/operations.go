@@ -0,0 +1,111 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+// Operation is an in-flight RBE operation.
+type Operation struct {
+	Name         string
+	Instance     string
+	ActionDigest string
+	// RequesterID is compiler_proxy_id of the request.
+	RequesterID string
+	Start       time.Time
+
+	// Stage is the last stage reported by RBE, and Updated is
+	// when it was reported.
+	Stage   rpb.ExecutionStage_Value
+	Updated time.Time
+}
+
+// Operations tracks in-flight RBE operations.
+// nil Operations tracks nothing.
+type Operations struct {
+	mu  sync.Mutex
+	ops map[string]*Operation
+}
+
+func (o *Operations) start(op Operation) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ops == nil {
+		o.ops = make(map[string]*Operation)
+	}
+	op.Updated = op.Start
+	o.ops[op.Name] = &op
+}
+
+func (o *Operations) update(name string, stage rpb.ExecutionStage_Value) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	op, ok := o.ops[name]
+	if !ok || op.Stage == stage {
+		return
+	}
+	op.Stage = stage
+	op.Updated = time.Now()
+}
+
+func (o *Operations) finish(name string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.ops, name)
+}
+
+// List returns in-flight operations, oldest first.
+func (o *Operations) List() []Operation {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	ops := make([]Operation, 0, len(o.ops))
+	for _, op := range o.ops {
+		ops = append(ops, *op)
+	}
+	o.mu.Unlock()
+	sort.Slice(ops, func(i, j int) bool {
+		if !ops[i].Start.Equal(ops[j].Start) {
+			return ops[i].Start.Before(ops[j].Start)
+		}
+		return ops[i].Name < ops[j].Name
+	})
+	return ops
+}
+
+// ServeHTTP dumps in-flight operations, oldest first.
+func (o *Operations) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ops := o.List()
+	now := time.Now()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "in-flight operations: %d\n\n", len(ops))
+	for _, op := range ops {
+		fmt.Fprintf(w, "%s\n  instance=%s action=%s requester=%s\n  age=%s stage=%s for %s\n",
+			op.Name,
+			op.Instance,
+			op.ActionDigest,
+			op.RequesterID,
+			now.Sub(op.Start).Truncate(time.Millisecond),
+			op.Stage,
+			now.Sub(op.Updated).Truncate(time.Millisecond))
+	}
+}
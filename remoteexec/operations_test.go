@@ -0,0 +1,57 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+func TestOperations(t *testing.T) {
+	o := &Operations{}
+	now := time.Now()
+	o.start(Operation{
+		Name:     "operations/2",
+		Instance: "projects/goma-dev/instances/default_instance",
+		Start:    now,
+	})
+	o.start(Operation{
+		Name:     "operations/1",
+		Instance: "projects/goma-dev/instances/default_instance",
+		Start:    now.Add(-1 * time.Second),
+	})
+	o.update("operations/2", rpb.ExecutionStage_EXECUTING)
+	o.update("operations/unknown", rpb.ExecutionStage_QUEUED)
+
+	ops := o.List()
+	if len(ops) != 2 || ops[0].Name != "operations/1" || ops[1].Name != "operations/2" {
+		t.Fatalf("List()=%v; want [operations/1 operations/2]", ops)
+	}
+	if ops[1].Stage != rpb.ExecutionStage_EXECUTING {
+		t.Errorf("operations/2 stage=%s; want %s", ops[1].Stage, rpb.ExecutionStage_EXECUTING)
+	}
+
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, httptest.NewRequest("GET", "/debug/operations", nil))
+	if body := w.Body.String(); !strings.Contains(body, "in-flight operations: 2") || !strings.Contains(body, "stage=EXECUTING") {
+		t.Errorf("ServeHTTP=%q; want 2 operations, one EXECUTING", body)
+	}
+
+	o.finish("operations/1")
+	o.finish("operations/2")
+	if ops := o.List(); len(ops) != 0 {
+		t.Errorf("List()=%v; want empty", ops)
+	}
+
+	var nilOps *Operations
+	nilOps.start(Operation{Name: "operations/3"})
+	if ops := nilOps.List(); len(ops) != 0 {
+		t.Errorf("nil List()=%v; want empty", ops)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PCHPolicy is a policy for clang precompiled header (*.pch, *.gch)
+// and explicit module (*.pcm) outputs.
+//
+// These outputs are large and dominate goma file cache storage, but
+// they are rarely reused by other users, since they depend on exact
+// compile flags and headers.
+type PCHPolicy struct {
+	// MaxSize is max size of PCH/module output to store in goma
+	// file service. Larger output is rejected, and client will get
+	// error for the output, so it would run the compile locally.
+	// 0 means no limit.
+	MaxSize int64
+
+	// Reject rejects all PCH/module outputs.
+	Reject bool
+}
+
+// pchKind returns kind of PCH/module output for fname,
+// i.e. "pch" or "pcm". It returns empty string for other files.
+func pchKind(fname string) string {
+	switch strings.ToLower(path.Ext(strings.ReplaceAll(fname, `\`, "/"))) {
+	case ".pch", ".gch":
+		return "pch"
+	case ".pcm":
+		return "pcm"
+	}
+	return ""
+}
+
+// check checks output by the policy and records metrics.
+// It returns error with codes.ResourceExhausted if output is rejected.
+func (p PCHPolicy) check(ctx context.Context, kind string, output *rpb.OutputFile) error {
+	size := output.GetDigest().GetSizeBytes()
+	result := "ok"
+	var err error
+	switch {
+	case p.Reject:
+		result = "rejected"
+		err = status.Errorf(codes.ResourceExhausted, "%s output %s: rejected by policy", kind, output.Path)
+	case p.MaxSize > 0 && size > p.MaxSize:
+		result = "rejected"
+		err = status.Errorf(codes.ResourceExhausted, "%s output %s: size=%d exceeds limit %d", kind, output.Path, size, p.MaxSize)
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(pchKindKey, kind),
+		tag.Upsert(pchResultKey, result),
+	}, pchOutputs.M(1), pchOutputBytes.M(size))
+	return err
+}
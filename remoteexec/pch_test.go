@@ -0,0 +1,57 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPCHKind(t *testing.T) {
+	for _, tc := range []struct {
+		fname string
+		want  string
+	}{
+		{"obj/foo/precompile.h.pch", "pch"},
+		{"obj/foo/precompile.h.gch", "pch"},
+		{`obj\foo\precompile.PCH`, "pch"},
+		{"obj/foo/std.pcm", "pcm"},
+		{"obj/foo/foo.o", ""},
+		{"obj/foo.pch/foo.o", ""},
+	} {
+		if got := pchKind(tc.fname); got != tc.want {
+			t.Errorf("pchKind(%q)=%q; want %q", tc.fname, got, tc.want)
+		}
+	}
+}
+
+func TestPCHPolicyCheck(t *testing.T) {
+	ctx := context.Background()
+	output := &rpb.OutputFile{
+		Path: "obj/foo/precompile.h.pch",
+		Digest: &rpb.Digest{
+			Hash:      "dummy",
+			SizeBytes: 1024,
+		},
+	}
+	for _, tc := range []struct {
+		policy PCHPolicy
+		want   codes.Code
+	}{
+		{PCHPolicy{}, codes.OK},
+		{PCHPolicy{MaxSize: 1024}, codes.OK},
+		{PCHPolicy{MaxSize: 1023}, codes.ResourceExhausted},
+		{PCHPolicy{Reject: true}, codes.ResourceExhausted},
+	} {
+		err := tc.policy.check(ctx, "pch", output)
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%#v.check(...)=%v; want %v", tc.policy, err, tc.want)
+		}
+	}
+}
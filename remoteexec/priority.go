@@ -0,0 +1,107 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	execpb "go.chromium.org/goma/server/proto/exec"
+)
+
+// PriorityPolicy maps priority hint in ExecExtReq to priority of
+// execution and action cache entries in RBE for each user group,
+// so that interactive developer builds preempt CI batch builds.
+// In RBE, smaller priority value means higher priority.
+//
+// It is loaded from JSON config, e.g.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "group": "chrome-bot",
+//	      "hint": "BATCH",
+//	      "execution_priority": 10,
+//	      "cache_priority": 10
+//	    },
+//	    {
+//	      "hint": "INTERACTIVE",
+//	      "execution_priority": -10
+//	    }
+//	  ]
+//	}
+type PriorityPolicy struct {
+	// Rules are checked in order, and the first matched rule is applied.
+	Rules []PriorityRule `json:"rules"`
+}
+
+// PriorityRule is a rule of PriorityPolicy.
+type PriorityRule struct {
+	// Group matches end user's group. empty matches any group.
+	Group string `json:"group,omitempty"`
+
+	// Hint matches priority hint in ExecExtReq, e.g.
+	// "INTERACTIVE", "BATCH". empty matches any hint.
+	Hint string `json:"hint,omitempty"`
+
+	// ExecutionPriority is priority of execution.
+	// 0 means Adapter.ExecutionPriority.
+	ExecutionPriority int32 `json:"execution_priority,omitempty"`
+
+	// CachePriority is priority of action cache entries.
+	// 0 means Adapter.CachePriority.
+	CachePriority int32 `json:"cache_priority,omitempty"`
+}
+
+// LoadPriorityPolicy loads PriorityPolicy from JSON file fname.
+func LoadPriorityPolicy(fname string) (*PriorityPolicy, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	p := &PriorityPolicy{}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return p, nil
+}
+
+// Validate checks p is valid.
+func (p *PriorityPolicy) Validate() error {
+	for i, r := range p.Rules {
+		if r.Hint == "" {
+			continue
+		}
+		if _, ok := execpb.ExecExtReq_Priority_value[r.Hint]; !ok {
+			return fmt.Errorf("rule %d: unknown hint %q", i, r.Hint)
+		}
+	}
+	return nil
+}
+
+// Priority returns the first rule matched with group and hint.
+// It returns zero rule (i.e. default priorities) if p is nil or
+// no rule matches.
+func (p *PriorityPolicy) Priority(group string, hint execpb.ExecExtReq_Priority) PriorityRule {
+	if p == nil {
+		return PriorityRule{}
+	}
+	for _, r := range p.Rules {
+		if r.Group != "" && r.Group != group {
+			continue
+		}
+		if r.Hint != "" && r.Hint != hint.String() {
+			continue
+		}
+		return r
+	}
+	return PriorityRule{}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	execpb "go.chromium.org/goma/server/proto/exec"
+)
+
+func TestPriorityPolicy(t *testing.T) {
+	const config = `{
+  "rules": [
+    {
+      "group": "chrome-bot",
+      "hint": "BATCH",
+      "execution_priority": 10,
+      "cache_priority": 10
+    },
+    {
+      "hint": "INTERACTIVE",
+      "execution_priority": -10
+    }
+  ]
+}`
+	fname := filepath.Join(t.TempDir(), "priority.json")
+	err := ioutil.WriteFile(fname, []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPriorityPolicy(fname)
+	if err != nil {
+		t.Fatalf("LoadPriorityPolicy(%q)=_, %v; want nil error", fname, err)
+	}
+
+	for _, tc := range []struct {
+		group     string
+		hint      execpb.ExecExtReq_Priority
+		wantExec  int32
+		wantCache int32
+	}{
+		{
+			group:     "chrome-bot",
+			hint:      execpb.ExecExtReq_BATCH,
+			wantExec:  10,
+			wantCache: 10,
+		},
+		{
+			group: "user",
+			hint:  execpb.ExecExtReq_BATCH,
+		},
+		{
+			group:    "user",
+			hint:     execpb.ExecExtReq_INTERACTIVE,
+			wantExec: -10,
+		},
+		{
+			group: "chrome-bot",
+			hint:  execpb.ExecExtReq_DEFAULT_PRIORITY,
+		},
+	} {
+		r := p.Priority(tc.group, tc.hint)
+		if r.ExecutionPriority != tc.wantExec || r.CachePriority != tc.wantCache {
+			t.Errorf("Priority(%q, %v)=%d, %d; want %d, %d", tc.group, tc.hint, r.ExecutionPriority, r.CachePriority, tc.wantExec, tc.wantCache)
+		}
+	}
+
+	var nilPolicy *PriorityPolicy
+	if got := nilPolicy.Priority("user", execpb.ExecExtReq_INTERACTIVE); got != (PriorityRule{}) {
+		t.Errorf("nil policy Priority=%v; want default priority", got)
+	}
+
+	bad := &PriorityPolicy{
+		Rules: []PriorityRule{
+			{Hint: "URGENT"},
+		},
+	}
+	if err := bad.Validate(); err == nil {
+		t.Errorf("Validate(unknown hint)=nil; want error")
+	}
+}
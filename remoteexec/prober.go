@@ -0,0 +1,321 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/rpc"
+)
+
+const (
+	// DefaultProberInterval is default interval of Prober.
+	DefaultProberInterval = 1 * time.Minute
+
+	// DefaultProberTimeout is default timeout of each probe.
+	DefaultProberTimeout = 30 * time.Second
+)
+
+// Prober periodically runs a CAS round trip and a no-op action against
+// RBE instances of Adapter, and records latency and availability per
+// instance, so that RBE outage or quota exhaustion can be detected
+// independent of user traffic.
+type Prober struct {
+	Adapter *Adapter
+
+	// Instances are RBE instance names to probe.
+	// If empty, default instance and instances in GroupInstances
+	// of Adapter are probed.
+	Instances []string
+
+	// Platform is platform of no-op action.
+	// If nil, OSFamily=Linux is used.
+	Platform *rpb.Platform
+
+	// Interval is interval of probes. DefaultProberInterval if zero.
+	Interval time.Duration
+
+	// Timeout is timeout of each probe. DefaultProberTimeout if zero.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	results map[string]ProbeResult
+}
+
+// ProbeResult is a result of a probe.
+type ProbeResult struct {
+	Time    time.Time
+	Latency time.Duration
+	Err     error
+}
+
+// instances returns instances to probe.
+func (p *Prober) instances() []string {
+	if len(p.Instances) > 0 {
+		return p.Instances
+	}
+	f := p.Adapter
+	seen := map[string]bool{
+		f.Instance(): true,
+	}
+	instances := []string{f.Instance()}
+	for _, basename := range f.GroupInstances {
+		name := f.instanceName(basename)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		instances = append(instances, name)
+	}
+	sort.Strings(instances[1:])
+	return instances
+}
+
+// Run runs probes periodically until ctx is done.
+func (p *Prober) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultProberInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes all instances once.
+func (p *Prober) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, instance := range p.instances() {
+		wg.Add(1)
+		go func(instance string) {
+			defer wg.Done()
+			p.probe(ctx, instance, "cas", p.probeCAS)
+			p.probe(ctx, instance, "exec", p.probeExec)
+		}(instance)
+	}
+	wg.Wait()
+}
+
+// Results returns the last probe results, keyed by "<instance> <probe>".
+func (p *Prober) Results() map[string]ProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make(map[string]ProbeResult, len(p.results))
+	for k, v := range p.results {
+		results[k] = v
+	}
+	return results
+}
+
+// Check returns an error if the last probe of any instance failed.
+// It is intended to be used for statusz check.
+func (p *Prober) Check(ctx context.Context) error {
+	results := p.Results()
+	keys := make([]string, 0, len(results))
+	for k := range results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := results[k].Err; err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+func (p *Prober) timeout() time.Duration {
+	if p.Timeout == 0 {
+		return DefaultProberTimeout
+	}
+	return p.Timeout
+}
+
+func (p *Prober) probe(ctx context.Context, instance, probe string, fn func(context.Context, string) error) {
+	logger := log.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout())
+	defer cancel()
+	t := time.Now()
+	err := fn(ctx, instance)
+	latency := time.Since(t)
+	if err != nil {
+		logger.Warnf("probe %s %s: %v", instance, probe, err)
+	}
+	recordProbe(ctx, instance, probe, latency, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.results == nil {
+		p.results = make(map[string]ProbeResult)
+	}
+	p.results[instance+" "+probe] = ProbeResult{
+		Time:    t,
+		Latency: latency,
+		Err:     err,
+	}
+}
+
+// probeCAS uploads unique blob to CAS, and reads it back.
+func (p *Prober) probeCAS(ctx context.Context, instance string) error {
+	client := p.Adapter.client(ctx)
+	data := []byte(fmt.Sprintf("goma prober %s %d", instance, time.Now().UnixNano()))
+	d := digest.Bytes("probe", data).Digest()
+	uresp, err := client.CAS().BatchUpdateBlobs(ctx, &rpb.BatchUpdateBlobsRequest{
+		InstanceName: instance,
+		Requests: []*rpb.BatchUpdateBlobsRequest_Request{
+			{
+				Digest: d,
+				Data:   data,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("BatchUpdateBlobs: %v", err)
+	}
+	for _, r := range uresp.GetResponses() {
+		if err := status.FromProto(r.GetStatus()).Err(); err != nil {
+			return fmt.Errorf("BatchUpdateBlobs %s: %v", r.GetDigest(), err)
+		}
+	}
+	rresp, err := client.CAS().BatchReadBlobs(ctx, &rpb.BatchReadBlobsRequest{
+		InstanceName: instance,
+		Digests:      []*rpb.Digest{d},
+	})
+	if err != nil {
+		return fmt.Errorf("BatchReadBlobs: %v", err)
+	}
+	if len(rresp.GetResponses()) != 1 {
+		return fmt.Errorf("BatchReadBlobs: %d responses; want 1", len(rresp.GetResponses()))
+	}
+	r := rresp.GetResponses()[0]
+	if err := status.FromProto(r.GetStatus()).Err(); err != nil {
+		return fmt.Errorf("BatchReadBlobs %s: %v", d, err)
+	}
+	if !bytes.Equal(r.GetData(), data) {
+		return fmt.Errorf("BatchReadBlobs %s: data mismatch", d)
+	}
+	return nil
+}
+
+// probeExec executes no-op action without action cache.
+func (p *Prober) probeExec(ctx context.Context, instance string) error {
+	platform := p.Platform
+	if platform == nil {
+		platform = &rpb.Platform{
+			Properties: []*rpb.Platform_Property{
+				{
+					Name:  "OSFamily",
+					Value: "Linux",
+				},
+			},
+		}
+	}
+	var blobs []*rpb.BatchUpdateBlobsRequest_Request
+	add := func(m proto.Message) (*rpb.Digest, error) {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		d := digest.Bytes(fmt.Sprintf("%T", m), b).Digest()
+		blobs = append(blobs, &rpb.BatchUpdateBlobsRequest_Request{
+			Digest: d,
+			Data:   b,
+		})
+		return d, nil
+	}
+	commandDigest, err := add(&rpb.Command{
+		Arguments: []string{"true"},
+		Platform:  platform,
+	})
+	if err != nil {
+		return err
+	}
+	inputRootDigest, err := add(&rpb.Directory{})
+	if err != nil {
+		return err
+	}
+	actionDigest, err := add(&rpb.Action{
+		CommandDigest:   commandDigest,
+		InputRootDigest: inputRootDigest,
+		Timeout:         durationpb.New(p.timeout()),
+		DoNotCache:      true,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := p.Adapter.client(ctx)
+	// retry once, so unavailability is not hidden by retries.
+	client.Retry = rpc.Retry{
+		MaxRetry: 1,
+	}
+	uresp, err := client.CAS().BatchUpdateBlobs(ctx, &rpb.BatchUpdateBlobsRequest{
+		InstanceName: instance,
+		Requests:     blobs,
+	})
+	if err != nil {
+		return fmt.Errorf("BatchUpdateBlobs: %v", err)
+	}
+	for _, r := range uresp.GetResponses() {
+		if err := status.FromProto(r.GetStatus()).Err(); err != nil {
+			return fmt.Errorf("BatchUpdateBlobs %s: %v", r.GetDigest(), err)
+		}
+	}
+	_, resp, err := ExecuteAndWait(ctx, client, &rpb.ExecuteRequest{
+		InstanceName:    instance,
+		SkipCacheLookup: true,
+		ActionDigest:    actionDigest,
+	})
+	if err != nil {
+		return fmt.Errorf("execute: %v", err)
+	}
+	if st := resp.GetStatus(); st.GetCode() != int32(codes.OK) {
+		return fmt.Errorf("execute: %v", status.FromProto(st).Err())
+	}
+	if code := resp.GetResult().GetExitCode(); code != 0 {
+		return fmt.Errorf("execute: exit=%d", code)
+	}
+	return nil
+}
+
+func recordProbe(ctx context.Context, instance, probe string, latency time.Duration, err error) {
+	result := "ok"
+	var available int64 = 1
+	if err != nil {
+		result = "error"
+		available = 0
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(proberInstanceKey, instance),
+		tag.Upsert(proberProbeKey, probe),
+		tag.Upsert(proberResultKey, result),
+	}, proberLatency.M(float64(latency.Nanoseconds())/1e6))
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(proberInstanceKey, instance),
+		tag.Upsert(proberProbeKey, probe),
+	}, proberAvailable.M(available))
+}
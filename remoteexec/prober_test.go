@@ -0,0 +1,93 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProberInstances(t *testing.T) {
+	p := &Prober{
+		Adapter: &Adapter{
+			InstancePrefix:   "projects/goma-dev/instances",
+			InstanceBaseName: "default_instance",
+			GroupInstances: map[string]string{
+				"chrome-bot": "ci_instance",
+				"dev":        "dev_instance",
+				"other":      "default_instance",
+			},
+		},
+	}
+	want := []string{
+		"projects/goma-dev/instances/default_instance",
+		"projects/goma-dev/instances/ci_instance",
+		"projects/goma-dev/instances/dev_instance",
+	}
+	if diff := cmp.Diff(want, p.instances()); diff != "" {
+		t.Errorf("instances() diff -want +got:\n%s", diff)
+	}
+}
+
+func TestProberProbeAll(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cluster := &fakeCluster{
+		rbe: newFakeRBE(),
+	}
+	err := cluster.setup(ctx, cluster.rbe.instancePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.teardown()
+
+	p := &Prober{
+		Adapter: &cluster.adapter,
+		Timeout: 5 * time.Second,
+	}
+	p.ProbeAll(ctx)
+	results := p.Results()
+	if len(results) != 2 {
+		t.Errorf("Results()=%v; want 2 results", results)
+	}
+	for k, r := range results {
+		if r.Err != nil || r.Time.IsZero() {
+			t.Errorf("Results()[%q]=%v; want success", k, r)
+		}
+	}
+	if err := p.Check(ctx); err != nil {
+		t.Errorf("Check(ctx)=%v; want nil", err)
+	}
+	if got := cluster.rbe.gotCommand.GetArguments(); len(got) != 1 || got[0] != "true" {
+		t.Errorf("command arguments=%q; want [\"true\"]", got)
+	}
+	if !cluster.rbe.gotAction.GetDoNotCache() {
+		t.Errorf("action.DoNotCache=false; want true")
+	}
+
+	cluster.rbe.fakeExec = func(ctx context.Context, req *rpb.ExecuteRequest) (*rpb.ExecuteResponse, error) {
+		return &rpb.ExecuteResponse{
+			Result: &rpb.ActionResult{
+				ExitCode: 1,
+			},
+		}, nil
+	}
+	p.ProbeAll(ctx)
+	results = p.Results()
+	if r := results[cluster.adapter.Instance()+" exec"]; r.Err == nil {
+		t.Errorf("exec probe=%v; want error", r)
+	}
+	if r := results[cluster.adapter.Instance()+" cas"]; r.Err != nil {
+		t.Errorf("cas probe=%v; want success", r)
+	}
+	if err := p.Check(ctx); err == nil {
+		t.Errorf("Check(ctx)=nil; want error")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"sync"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/proto"
+
+	"go.chromium.org/goma/server/log"
+	execpb "go.chromium.org/goma/server/proto/exec"
+)
+
+type progressKey struct{}
+
+// progressReporter reports progress of remote execution.
+// hedged Execute may report progress concurrently.
+type progressReporter struct {
+	send func(*execpb.ExecProgress) error
+
+	mu     sync.Mutex
+	closed bool
+	opName string
+	stage  execpb.ExecProgress_Stage
+	err    error
+}
+
+// close stops reporting progress, and returns the last operation name.
+func (p *progressReporter) close() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.opName
+}
+
+// withProgress returns context to report progress of remote execution
+// in the context to p.
+func withProgress(ctx context.Context, p *progressReporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// reportProgress reports progress of operation opName in md,
+// if ctx has progress reporter.
+// It doesn't report the same stage again, since WaitExecution
+// may send the same operation status repeatedly.
+func reportProgress(ctx context.Context, opName string, md *rpb.ExecuteOperationMetadata) {
+	p, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok || md == nil {
+		return
+	}
+	stage := execpb.ExecProgress_Stage(md.GetStage())
+	if _, ok := execpb.ExecProgress_Stage_name[int32(stage)]; !ok {
+		stage = execpb.ExecProgress_UNKNOWN
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.err != nil || (p.opName == opName && p.stage == stage) {
+		return
+	}
+	p.opName = opName
+	p.stage = stage
+	p.err = p.send(&execpb.ExecProgress{
+		Stage:         stage.Enum(),
+		OperationName: proto.String(opName),
+	})
+	if p.err != nil {
+		logger := log.FromContext(ctx)
+		logger.Warnf("failed to send progress %s %s: %v", opName, stage, p.err)
+	}
+}
+
+// ExecStream handles goma Exec request with extensions with RBE backend,
+// and streams progress of remote execution before the final ExecExtResp.
+func (f *Adapter) ExecStream(req *execpb.ExecExtReq, stream execpb.ExecService_ExecStreamServer) error {
+	ctx := stream.Context()
+	p := &progressReporter{
+		send: stream.Send,
+	}
+	resp, err := f.ExecExt(withProgress(ctx, p), req)
+	opName := p.close()
+	if err != nil {
+		return err
+	}
+	return stream.Send(&execpb.ExecProgress{
+		Stage:         execpb.ExecProgress_COMPLETED.Enum(),
+		OperationName: proto.String(opName),
+		Resp:          resp,
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// PayloadType is DSSE payload type of in-toto statement.
+const PayloadType = "application/vnd.in-toto+json"
+
+// Envelope is DSSE envelope.
+// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+type Envelope struct {
+	PayloadType string `json:"payloadType"`
+	// Payload is serialized statement. It is base64 encoded in JSON.
+	Payload    []byte      `json:"payload"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// Signature is a signature in DSSE envelope.
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	// Sig is base64 encoded in JSON.
+	Sig []byte `json:"sig"`
+}
+
+// pae returns DSSE pre-authentication encoding of payload.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Signer signs DSSE envelopes.
+type Signer struct {
+	// KeyID is key id put in signatures.
+	KeyID string
+
+	// Key is ed25519, ecdsa or rsa private key.
+	Key crypto.Signer
+}
+
+// LoadSigner loads PEM encoded PKCS #8 private key from fname.
+func LoadSigner(fname, keyID string) (*Signer, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", fname)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key in %s: %v", fname, err)
+	}
+	key, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key in %s: %T", fname, k)
+	}
+	switch key.(type) {
+	case ed25519.PrivateKey, *ecdsa.PrivateKey, *rsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported private key in %s: %T", fname, k)
+	}
+	return &Signer{
+		KeyID: keyID,
+		Key:   key,
+	}, nil
+}
+
+// Sign signs statement and returns DSSE envelope of it.
+func (s *Signer) Sign(st *Statement) (*Envelope, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	msg := pae(PayloadType, payload)
+	var sig []byte
+	switch s.Key.(type) {
+	case ed25519.PrivateKey:
+		sig, err = s.Key.Sign(rand.Reader, msg, crypto.Hash(0))
+	default:
+		h := sha256.Sum256(msg)
+		sig, err = s.Key.Sign(rand.Reader, h[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     payload,
+		Signatures: []Signature{
+			{
+				KeyID: s.KeyID,
+				Sig:   sig,
+			},
+		},
+	}, nil
+}
+
+// Verify verifies env is signed by pub, and returns statement in it.
+func Verify(env *Envelope, pub crypto.PublicKey) (*Statement, error) {
+	if env.PayloadType != PayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", env.PayloadType)
+	}
+	msg := pae(env.PayloadType, env.Payload)
+	h := sha256.Sum256(msg)
+	verified := false
+	for _, s := range env.Signatures {
+		switch pub := pub.(type) {
+		case ed25519.PublicKey:
+			verified = ed25519.Verify(pub, msg, s.Sig)
+		case *ecdsa.PublicKey:
+			verified = ecdsa.VerifyASN1(pub, h[:], s.Sig)
+		case *rsa.PublicKey:
+			verified = rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], s.Sig) == nil
+		default:
+			return nil, fmt.Errorf("unsupported public key %T", pub)
+		}
+		if verified {
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("no valid signature")
+	}
+	st := &Statement{}
+	err := json.Unmarshal(env.Payload, st)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
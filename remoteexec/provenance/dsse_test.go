@@ -0,0 +1,123 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPAE(t *testing.T) {
+	got := string(pae("http://example.com/HelloWorld", []byte("hello world")))
+	const want = "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got != want {
+		t.Errorf("pae=%q; want %q", got, want)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewStatement([]Subject{
+		{
+			Name: "out/foo.o",
+			Digest: DigestSet{
+				"sha256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+		},
+	}, Predicate{
+		Builder: Builder{ID: "https://goma.example.com/remoteexec"},
+		Invocation: Invocation{
+			Parameters: map[string]string{
+				"actionDigest": "1234/56",
+			},
+		},
+		Materials: []Material{
+			{
+				URI:    "projects/p/instances/default_instance/blobs/abcd/10",
+				Digest: DigestSet{"sha256": "abcd"},
+			},
+		},
+	})
+
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{
+			name: "ecdsa",
+			key:  ecKey,
+		},
+		{
+			name: "ed25519",
+			key:  edKey,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fname := filepath.Join(dir, tc.name+".pem")
+			err = ioutil.WriteFile(fname, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := LoadSigner(fname, "key-1")
+			if err != nil {
+				t.Fatalf("LoadSigner(%q)=_, %v; want nil error", fname, err)
+			}
+			env, err := s.Sign(st)
+			if err != nil {
+				t.Fatalf("Sign=_, %v; want nil error", err)
+			}
+			if got, want := env.Signatures[0].KeyID, "key-1"; got != want {
+				t.Errorf("keyid=%q; want %q", got, want)
+			}
+
+			// round trip in JSON.
+			b, err := json.Marshal(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env = &Envelope{}
+			err = json.Unmarshal(b, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Verify(env, tc.key.Public())
+			if err != nil {
+				t.Fatalf("Verify=_, %v; want nil error", err)
+			}
+			if diff := cmp.Diff(st, got); diff != "" {
+				t.Errorf("Verify diff -want +got:\n%s", diff)
+			}
+
+			env.Payload = append(env.Payload[:len(env.Payload):len(env.Payload)], ' ')
+			_, err = Verify(env, tc.key.Public())
+			if err == nil {
+				t.Errorf("Verify(tampered)=_, nil; want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package provenance generates in-toto statements with SLSA provenance
+// predicate for outputs of remote execution, and signs them in DSSE
+// envelopes.
+//
+// https://github.com/in-toto/attestation/blob/main/spec/README.md
+// https://slsa.dev/provenance/v0.2
+package provenance
+
+import (
+	"time"
+)
+
+const (
+	// StatementType is type of in-toto statement.
+	StatementType = "https://in-toto.io/Statement/v0.1"
+
+	// PredicateType is type of SLSA provenance predicate.
+	PredicateType = "https://slsa.dev/provenance/v0.2"
+
+	// BuildType is build type of goma remote execution.
+	BuildType = "https://chromium.googlesource.com/infra/goma/server/remoteexec@v1"
+)
+
+// DigestSet is a set of digests of an artifact, keyed by algorithm,
+// e.g. "sha256".
+type DigestSet map[string]string
+
+// Subject is an artifact the statement is about.
+type Subject struct {
+	Name   string    `json:"name"`
+	Digest DigestSet `json:"digest"`
+}
+
+// Statement is in-toto statement with SLSA provenance predicate.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Predicate is SLSA provenance v0.2 predicate.
+type Predicate struct {
+	Builder    Builder    `json:"builder"`
+	BuildType  string     `json:"buildType"`
+	Invocation Invocation `json:"invocation"`
+	Metadata   *Metadata  `json:"metadata,omitempty"`
+	Materials  []Material `json:"materials,omitempty"`
+}
+
+// Builder identifies the entity that executed the build.
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// Invocation describes how the build was invoked.
+type Invocation struct {
+	// Parameters are parameters of the build, e.g. action digest
+	// and command spec.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Environment is environment of the build, e.g. worker.
+	Environment map[string]string `json:"environment,omitempty"`
+}
+
+// Metadata is metadata of the build.
+type Metadata struct {
+	BuildInvocationID string       `json:"buildInvocationId,omitempty"`
+	BuildStartedOn    *time.Time   `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn   *time.Time   `json:"buildFinishedOn,omitempty"`
+	Completeness      Completeness `json:"completeness"`
+	Reproducible      bool         `json:"reproducible"`
+}
+
+// Completeness reports whether the claims in the predicate are complete.
+type Completeness struct {
+	Parameters  bool `json:"parameters"`
+	Environment bool `json:"environment"`
+	Materials   bool `json:"materials"`
+}
+
+// Material is an artifact that influenced the build, e.g. input root
+// or container image.
+type Material struct {
+	URI    string    `json:"uri"`
+	Digest DigestSet `json:"digest,omitempty"`
+}
+
+// NewStatement returns a statement about subjects with predicate.
+func NewStatement(subjects []Subject, predicate Predicate) *Statement {
+	if predicate.BuildType == "" {
+		predicate.BuildType = BuildType
+	}
+	return &Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateType,
+		Predicate:     predicate,
+	}
+}
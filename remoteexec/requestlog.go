@@ -0,0 +1,206 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+const (
+	// DefaultRequestLogSize is default number of records kept in RequestLog.
+	DefaultRequestLogSize = 1000
+
+	// DefaultRequestLogRetention is default retention of RequestLog.
+	DefaultRequestLogRetention = 1 * time.Hour
+)
+
+// RequestRecord is a record of a request, to reconstruct how
+// the request was handled after it finished.
+type RequestRecord struct {
+	// ID is compiler_proxy_id of the request.
+	ID    string
+	Time  time.Time
+	Group string
+
+	// Config is selector of command config used for the request.
+	Config       string
+	Instance     string
+	ActionDigest string
+	// CacheHit is cache source of the result.
+	CacheHit      gomapb.ExecResp_CacheSource
+	OperationName string
+
+	// Phases are durations of each phase of the request.
+	Phases []string
+
+	Result gomapb.ExecResp_ExecError
+	// ExitCode is exit code of the command if it was executed.
+	ExitCode int32
+	// MissingInputs is number of missing inputs.
+	MissingInputs int
+	// Errors are chain of errors occurred in the request.
+	Errors []string
+}
+
+// Failed reports whether the request failed.
+func (r RequestRecord) Failed() bool {
+	return len(r.Errors) > 0 || r.Result != gomapb.ExecResp_OK || r.ExitCode != 0 || r.MissingInputs > 0
+}
+
+// RequestLog keeps records of recent requests in ring buffer,
+// so that support can look up how failed requests were handled
+// by request ID.
+// Failed requests are always recorded, and succeeded requests are
+// sampled by SuccessSampleRatio.
+// nil RequestLog records nothing.
+type RequestLog struct {
+	// Size is maximum number of records. DefaultRequestLogSize if zero.
+	Size int
+
+	// Retention is how long records are kept.
+	// DefaultRequestLogRetention if zero.
+	Retention time.Duration
+
+	// SuccessSampleRatio is ratio to record succeeded requests.
+	SuccessSampleRatio float64
+
+	mu      sync.Mutex
+	records []RequestRecord
+	next    int
+}
+
+func (l *RequestLog) size() int {
+	if l.Size == 0 {
+		return DefaultRequestLogSize
+	}
+	return l.Size
+}
+
+func (l *RequestLog) retention() time.Duration {
+	if l.Retention == 0 {
+		return DefaultRequestLogRetention
+	}
+	return l.Retention
+}
+
+// record records r handled by s with resp and err.
+func (l *RequestLog) record(s *execSpan, resp *gomapb.ExecResp, err error) {
+	if l == nil || s.req == nil {
+		return
+	}
+	r := s.req
+	rec := RequestRecord{
+		ID:            r.ID(),
+		Time:          s.t0,
+		Group:         r.userGroup,
+		Config:        r.cmdConfig.GetCmdDescriptor().GetSelector().String(),
+		OperationName: r.opName,
+		Phases:        append([]string(nil), s.timestamps...),
+		Result:        resp.GetError(),
+		MissingInputs: len(resp.GetMissingInput()),
+		CacheHit:      resp.GetCacheHit(),
+	}
+	if resp.GetResult() != nil {
+		rec.ExitCode = resp.GetResult().GetExitStatus()
+	}
+	if r.actionDigest != nil {
+		rec.Instance = r.instanceName()
+		rec.ActionDigest = fmt.Sprintf("%s/%d", r.actionDigest.GetHash(), r.actionDigest.GetSizeBytes())
+	}
+	if err != nil {
+		rec.Errors = append(rec.Errors, err.Error())
+	}
+	if r.err != nil && r.err != err {
+		rec.Errors = append(rec.Errors, r.err.Error())
+	}
+	rec.Errors = append(rec.Errors, resp.GetErrorMessage()...)
+	if !rec.Failed() && rand.Float64() >= l.SuccessSampleRatio {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < l.size() {
+		l.records = append(l.records, rec)
+		return
+	}
+	l.records[l.next] = rec
+	l.next = (l.next + 1) % len(l.records)
+}
+
+// Lookup returns records of request id within retention, oldest first.
+// Retried requests have the same id, so it may return several records.
+func (l *RequestLog) Lookup(id string) []RequestRecord {
+	var recs []RequestRecord
+	for _, rec := range l.List() {
+		if rec.ID == id {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// List returns records within retention, oldest first.
+func (l *RequestLog) List() []RequestRecord {
+	if l == nil {
+		return nil
+	}
+	expired := time.Now().Add(-l.retention())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recs := make([]RequestRecord, 0, len(l.records))
+	for i := range l.records {
+		rec := l.records[(l.next+i)%len(l.records)]
+		if rec.Time.Before(expired) {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// ServeHTTP dumps records of request specified by "id" query parameter.
+// It lists failed requests if "id" is not given.
+func (l *RequestLog) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	id := req.FormValue("id")
+	if id == "" {
+		var n int
+		for _, rec := range l.List() {
+			if !rec.Failed() {
+				continue
+			}
+			n++
+			fmt.Fprintf(w, "%s %s %s\n", rec.Time.Format(time.RFC3339), rec.ID, rec.Result)
+		}
+		fmt.Fprintf(w, "\nfailed requests: %d\n", n)
+		return
+	}
+	recs := l.Lookup(id)
+	if len(recs) == 0 {
+		http.Error(w, fmt.Sprintf("no record for %q", id), http.StatusNotFound)
+		return
+	}
+	for _, rec := range recs {
+		fmt.Fprintf(w, "%s %s\n", rec.Time.Format(time.RFC3339Nano), rec.ID)
+		fmt.Fprintf(w, "  group=%s\n", rec.Group)
+		fmt.Fprintf(w, "  config=%s\n", rec.Config)
+		fmt.Fprintf(w, "  instance=%s action=%s\n", rec.Instance, rec.ActionDigest)
+		fmt.Fprintf(w, "  cache=%s operation=%s\n", rec.CacheHit, rec.OperationName)
+		fmt.Fprintf(w, "  phases: %s\n", strings.Join(rec.Phases, ", "))
+		fmt.Fprintf(w, "  result=%s exit=%d missing_inputs=%d\n", rec.Result, rec.ExitCode, rec.MissingInputs)
+		for _, e := range rec.Errors {
+			fmt.Fprintf(w, "  error: %s\n", e)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestRequestLog(t *testing.T) {
+	l := &RequestLog{
+		Size: 3,
+	}
+	span := func(id string) *execSpan {
+		return &execSpan{
+			t0: time.Now(),
+			req: &request{
+				gomaReq: &gomapb.ExecReq{
+					RequesterInfo: &gomapb.RequesterInfo{
+						CompilerProxyId: proto.String(id),
+					},
+				},
+			},
+			timestamps: []string{"inventory: 1ms"},
+		}
+	}
+	okResp := &gomapb.ExecResp{
+		Result: &gomapb.ExecResult{
+			ExitStatus: proto.Int32(0),
+		},
+	}
+	l.record(span("ok"), okResp, nil)
+	if got := l.List(); len(got) != 0 {
+		t.Errorf("List()=%v; want no records for succeeded request", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		l.record(span(fmt.Sprintf("fail-%d", i)), nil, errors.New("rbe unavailable"))
+	}
+	var ids []string
+	for _, rec := range l.List() {
+		ids = append(ids, rec.ID)
+	}
+	if got, want := strings.Join(ids, ","), "fail-1,fail-2,fail-3"; got != want {
+		t.Errorf("List() ids=%q; want %q", got, want)
+	}
+
+	recs := l.Lookup("fail-3")
+	if len(recs) != 1 {
+		t.Fatalf("Lookup(%q)=%v; want 1 record", "fail-3", recs)
+	}
+	if got, want := strings.Join(recs[0].Errors, ";"), "rbe unavailable"; got != want {
+		t.Errorf("Errors=%q; want %q", got, want)
+	}
+	if len(l.Lookup("fail-0")) != 0 {
+		t.Errorf("Lookup(%q) returns evicted record", "fail-0")
+	}
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest("GET", "/debug/requests?id=fail-3", nil))
+	if !strings.Contains(w.Body.String(), "error: rbe unavailable") {
+		t.Errorf("ServeHTTP(id=fail-3)=%q; want error in body", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest("GET", "/debug/requests?id=unknown", nil))
+	if w.Code != 404 {
+		t.Errorf("ServeHTTP(id=unknown) code=%d; want 404", w.Code)
+	}
+
+	l.Retention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if got := l.List(); len(got) != 0 {
+		t.Errorf("List()=%v; want no records after retention", got)
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+const (
+	// DefaultRouterFailureThreshold is default number of consecutive
+	// failures to mark a backend unhealthy.
+	DefaultRouterFailureThreshold = 3
+
+	// DefaultRouterCooldown is default duration to exclude unhealthy
+	// backend from routing.
+	DefaultRouterCooldown = 30 * time.Second
+
+	// DefaultRouterHealthCheckInterval is default interval of
+	// active health checks.
+	DefaultRouterHealthCheckInterval = 10 * time.Second
+
+	// routerCloseDelay is delay to close client of backend removed
+	// from config, so that in-flight requests on the backend finish.
+	routerCloseDelay = 15 * time.Minute
+)
+
+// Backend is an RBE backend that Router routes requests to.
+type Backend struct {
+	// Addr is address of RBE API endpoint, i.e. target address
+	// in command configs.
+	Addr string
+
+	// Weight is relative weight of requests routed to the backend.
+	Weight int32
+
+	// InstancePrefix is RBE instance prefix in the backend.
+	// If empty, Adapter.InstancePrefix is used.
+	InstancePrefix string
+
+	Client Client
+
+	mu        sync.Mutex
+	failures  int
+	downUntil time.Time
+	lastErr   error
+}
+
+func (b *Backend) String() string {
+	return b.Addr
+}
+
+// instanceName returns instance name in b for instance name under
+// prefix.
+func (b *Backend) instanceName(prefix, instance string) string {
+	if b == nil || b.InstancePrefix == "" {
+		return instance
+	}
+	prefix = strings.Trim(prefix, "/")
+	name := strings.TrimPrefix(strings.Trim(instance, "/"), prefix)
+	return path.Join(b.InstancePrefix, name)
+}
+
+// healthy reports whether b is healthy at now.
+func (b *Backend) healthy(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.downUntil)
+}
+
+// BackendStatus is status of a backend.
+type BackendStatus struct {
+	Addr           string
+	Weight         int32
+	InstancePrefix string
+	Healthy        bool
+	Failures       int
+	LastErr        error
+}
+
+// Router routes exec requests to RBE backends by Strategy,
+// and fails over to other backends while a backend is unhealthy, so
+// that RBE clusters in multiple regions share load and an outage of
+// a region doesn't fail requests.
+//
+// Backends are configured by targets in command configs.
+// All targets are expected to serve the same toolchains, i.e. RBE
+// instances with the same configurations in different regions.
+// A backend is marked unhealthy for Cooldown when requests or health
+// checks failed FailureThreshold times in a row. If all backends are
+// unhealthy, requests are routed to all backends.
+//
+// Adapter.Client is still used for capabilities, bytestream proxy,
+// output backfill and journal recovery, so it should be connected to
+// one of the backends.
+type Router struct {
+	// Dial returns client of target.
+	Dial func(ctx context.Context, target *cmdpb.Target) (Client, error)
+
+	// HealthCheck checks health of backend. It is called every
+	// HealthCheckInterval in Run.
+	HealthCheck func(ctx context.Context, b *Backend) error
+
+	// Strategy picks a backend for a request.
+	// WeightedRandom if nil.
+	Strategy RouteStrategy
+
+	// HealthCheckInterval is interval of health checks.
+	// DefaultRouterHealthCheckInterval if zero.
+	HealthCheckInterval time.Duration
+
+	// FailureThreshold is number of consecutive failures to mark
+	// a backend unhealthy. DefaultRouterFailureThreshold if zero.
+	FailureThreshold int
+
+	// Cooldown is duration to exclude unhealthy backend from routing.
+	// DefaultRouterCooldown if zero.
+	Cooldown time.Duration
+
+	mu       sync.RWMutex
+	backends []*Backend
+}
+
+func (r *Router) failureThreshold() int {
+	if r.FailureThreshold == 0 {
+		return DefaultRouterFailureThreshold
+	}
+	return r.FailureThreshold
+}
+
+func (r *Router) cooldown() time.Duration {
+	if r.Cooldown == 0 {
+		return DefaultRouterCooldown
+	}
+	return r.Cooldown
+}
+
+func (r *Router) strategy() RouteStrategy {
+	if r.Strategy == nil {
+		return WeightedRandom{}
+	}
+	return r.Strategy
+}
+
+func (r *Router) healthCheckInterval() time.Duration {
+	if r.HealthCheckInterval == 0 {
+		return DefaultRouterHealthCheckInterval
+	}
+	return r.HealthCheckInterval
+}
+
+// Configure configures backends from targets in configs.
+// Clients of existing backends are reused, and clients of backends
+// no longer in configs are closed later.
+// It is intended to be used for exec.Inventory.OnConfigure.
+func (r *Router) Configure(ctx context.Context, configs []*cmdpb.Config) {
+	logger := log.FromContext(ctx)
+	targets := make(map[string]*cmdpb.Target)
+	var addrs []string
+	for _, cfg := range configs {
+		t := cfg.GetTarget()
+		if t.GetAddr() == "" {
+			continue
+		}
+		if _, ok := targets[t.GetAddr()]; ok {
+			continue
+		}
+		targets[t.GetAddr()] = t
+		addrs = append(addrs, t.GetAddr())
+	}
+	sort.Strings(addrs)
+
+	r.mu.RLock()
+	current := make(map[string]*Backend)
+	for _, b := range r.backends {
+		current[b.Addr] = b
+	}
+	r.mu.RUnlock()
+
+	var backends []*Backend
+	for _, addr := range addrs {
+		t := targets[addr]
+		weight := t.GetWeight()
+		if weight <= 0 {
+			weight = 1
+		}
+		cur, ok := current[addr]
+		if ok && cur.Weight == weight && cur.InstancePrefix == t.GetInstancePrefix() {
+			backends = append(backends, cur)
+			delete(current, addr)
+			continue
+		}
+		b := &Backend{
+			Addr:           addr,
+			Weight:         weight,
+			InstancePrefix: t.GetInstancePrefix(),
+		}
+		if ok {
+			b.Client = cur.Client
+			delete(current, addr)
+		} else {
+			client, err := r.Dial(ctx, t)
+			if err != nil {
+				logger.Errorf("router: dial %s: %v", addr, err)
+				continue
+			}
+			b.Client = client
+		}
+		logger.Infof("router: backend %s weight=%d instance-prefix=%q", addr, weight, b.InstancePrefix)
+		backends = append(backends, b)
+	}
+	r.mu.Lock()
+	r.backends = backends
+	r.mu.Unlock()
+
+	for addr, b := range current {
+		logger.Infof("router: remove backend %s", addr)
+		client := b.Client
+		time.AfterFunc(routerCloseDelay, func() {
+			closeClient(client)
+		})
+	}
+}
+
+// closeClient closes connections of client.
+func closeClient(c Client) error {
+	if c.Pool != nil {
+		return c.Pool.Close()
+	}
+	if c.ClientConn != nil {
+		return c.ClientConn.Close()
+	}
+	return nil
+}
+
+// Pick picks a backend for req by Strategy among healthy backends.
+// It picks among all backends if no backend is healthy.
+// It returns nil if r is nil or has no backends.
+func (r *Router) Pick(req RouteRequest) *Backend {
+	return r.pick(req, nil)
+}
+
+// pick picks a backend for req other than exclude.
+func (r *Router) pick(req RouteRequest, exclude *Backend) *Backend {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	var candidates []*Backend
+	for _, b := range r.backends {
+		if b == exclude || !b.healthy(now) {
+			continue
+		}
+		candidates = append(candidates, b)
+	}
+	if len(candidates) == 0 {
+		for _, b := range r.backends {
+			if b == exclude {
+				continue
+			}
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return r.strategy().Pick(req, candidates)
+}
+
+// Failover picks a healthy backend other than b to retry req
+// failed on b with err. It returns nil if err is not caused by
+// unavailability of b, or no other healthy backend.
+func (r *Router) Failover(ctx context.Context, req RouteRequest, b *Backend, err error) *Backend {
+	if r == nil || b == nil || ctx.Err() != nil || !backendUnavailable(err) {
+		return nil
+	}
+	nb := r.pick(req, b)
+	if nb == nil || !nb.healthy(time.Now()) {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	logger.Warnf("router: failover %s -> %s: %v", b, nb, err)
+	recordBackend(ctx, b, "failover")
+	return nb
+}
+
+// backendUnavailable reports whether err is caused by unavailability
+// of backend.
+func backendUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// Report reports result of a request on b.
+// b becomes unhealthy when requests failed with unavailability
+// FailureThreshold times in a row.
+func (r *Router) Report(ctx context.Context, b *Backend, err error) {
+	if r == nil || b == nil {
+		return
+	}
+	if err != nil && !backendUnavailable(err) {
+		// backend is available but request failed.
+		err = nil
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	recordBackend(ctx, b, result)
+	r.report(ctx, b, err)
+}
+
+func (r *Router) report(ctx context.Context, b *Backend, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.downUntil = time.Time{}
+		b.lastErr = nil
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.failures >= r.failureThreshold() {
+		b.downUntil = time.Now().Add(r.cooldown())
+		logger := log.FromContext(ctx)
+		logger.Errorf("router: backend %s unhealthy for %s: %d failures: %v", b, r.cooldown(), b.failures, err)
+	}
+}
+
+// Run runs health checks of backends periodically until ctx is done.
+// It does nothing if HealthCheck is not set.
+func (r *Router) Run(ctx context.Context) {
+	if r == nil || r.HealthCheck == nil {
+		return
+	}
+	ticker := time.NewTicker(r.healthCheckInterval())
+	defer ticker.Stop()
+	for {
+		r.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks health of all backends once.
+func (r *Router) CheckAll(ctx context.Context) {
+	r.mu.RLock()
+	backends := append([]*Backend(nil), r.backends...)
+	r.mu.RUnlock()
+	var wg sync.WaitGroup
+	for _, b := range backends {
+		wg.Add(1)
+		go func(b *Backend) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, r.healthCheckInterval())
+			defer cancel()
+			err := r.HealthCheck(cctx, b)
+			if err != nil && !backendUnavailable(err) {
+				err = nil
+			}
+			if err != nil {
+				logger := log.FromContext(ctx)
+				logger.Warnf("router: health check %s: %v", b, err)
+			}
+			r.report(ctx, b, err)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// Status returns status of backends.
+func (r *Router) Status() []BackendStatus {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	var ss []BackendStatus
+	for _, b := range r.backends {
+		b.mu.Lock()
+		ss = append(ss, BackendStatus{
+			Addr:           b.Addr,
+			Weight:         b.Weight,
+			InstancePrefix: b.InstancePrefix,
+			Healthy:        !now.Before(b.downUntil),
+			Failures:       b.failures,
+			LastErr:        b.lastErr,
+		})
+		b.mu.Unlock()
+	}
+	return ss
+}
+
+// Check returns an error if all backends are unhealthy.
+// It is intended to be used for statusz check.
+func (r *Router) Check(ctx context.Context) error {
+	ss := r.Status()
+	if len(ss) == 0 {
+		return nil
+	}
+	var errs []string
+	for _, s := range ss {
+		if s.Healthy {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", s.Addr, s.LastErr))
+	}
+	return errors.New("all backends unhealthy: " + strings.Join(errs, "; "))
+}
+
+func recordBackend(ctx context.Context, b *Backend, result string) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(backendAddrKey, b.Addr),
+		tag.Upsert(backendResultKey, result),
+	}, backendRequests.M(1))
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+	var dialed []string
+	r := &Router{
+		Dial: func(ctx context.Context, target *cmdpb.Target) (Client, error) {
+			dialed = append(dialed, target.Addr)
+			return Client{}, nil
+		},
+		FailureThreshold: 2,
+	}
+	if b := r.Pick(RouteRequest{}); b != nil {
+		t.Errorf("Pick()=%v; want nil before Configure", b)
+	}
+	r.Configure(ctx, []*cmdpb.Config{
+		{Target: &cmdpb.Target{Addr: "us.rbe", Weight: 3}},
+		{Target: &cmdpb.Target{Addr: "eu.rbe", InstancePrefix: "projects/eu/instances"}},
+		{Target: &cmdpb.Target{Addr: "us.rbe", Weight: 3}},
+		{},
+	})
+	ss := r.Status()
+	if len(ss) != 2 || ss[0].Addr != "eu.rbe" || ss[0].Weight != 1 || ss[1].Addr != "us.rbe" || ss[1].Weight != 3 {
+		t.Fatalf("Status()=%+v; want eu.rbe weight=1, us.rbe weight=3", ss)
+	}
+
+	picks := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		picks[r.Pick(RouteRequest{}).Addr]++
+	}
+	if picks["us.rbe"] < 2700 || picks["us.rbe"] > 3300 {
+		t.Errorf("picks=%v; want us.rbe about 3000", picks)
+	}
+
+	var us *Backend
+	for _, b := range r.backends {
+		if b.Addr == "us.rbe" {
+			us = b
+		}
+	}
+	unavailable := status.Error(codes.Unavailable, "region down")
+	r.Report(ctx, us, status.Error(codes.InvalidArgument, "bad request"))
+	r.Report(ctx, us, unavailable)
+	if !us.healthy(time.Now()) {
+		t.Errorf("us.rbe unhealthy after 1 failure; want healthy")
+	}
+	if b := r.Failover(ctx, RouteRequest{}, us, errors.New("compile error")); b != nil {
+		t.Errorf("Failover(us.rbe, non-unavailable error)=%v; want nil", b)
+	}
+	b := r.Failover(ctx, RouteRequest{}, us, unavailable)
+	if b == nil || b.Addr != "eu.rbe" {
+		t.Errorf("Failover(us.rbe)=%v; want eu.rbe", b)
+	}
+	r.Report(ctx, us, unavailable)
+	for i := 0; i < 100; i++ {
+		if b := r.Pick(RouteRequest{}); b.Addr != "eu.rbe" {
+			t.Fatalf("Pick()=%v; want eu.rbe while us.rbe is unhealthy", b)
+		}
+	}
+	if err := r.Check(ctx); err != nil {
+		t.Errorf("Check()=%v; want nil", err)
+	}
+
+	eu := r.Failover(ctx, RouteRequest{}, us, unavailable)
+	r.Report(ctx, eu, unavailable)
+	r.Report(ctx, eu, unavailable)
+	if err := r.Check(ctx); err == nil {
+		t.Errorf("Check()=nil; want error when all backends are unhealthy")
+	}
+	if b := r.Pick(RouteRequest{}); b == nil {
+		t.Errorf("Pick()=nil; want any backend when all backends are unhealthy")
+	}
+	r.Report(ctx, us, nil)
+	if !us.healthy(time.Now()) {
+		t.Errorf("us.rbe unhealthy after success; want healthy")
+	}
+
+	if got, want := eu.instanceName("projects/p/instances", "projects/p/instances/default_instance"), "projects/eu/instances/default_instance"; got != want {
+		t.Errorf("instanceName=%q; want %q", got, want)
+	}
+	if got, want := us.instanceName("projects/p/instances", "projects/p/instances/default_instance"), "projects/p/instances/default_instance"; got != want {
+		t.Errorf("instanceName=%q; want %q", got, want)
+	}
+
+	r.Configure(ctx, []*cmdpb.Config{
+		{Target: &cmdpb.Target{Addr: "us.rbe", Weight: 3}},
+		{Target: &cmdpb.Target{Addr: "asia.rbe"}},
+	})
+	if len(dialed) != 3 || dialed[2] != "asia.rbe" {
+		t.Errorf("dialed=%q; want [eu.rbe us.rbe asia.rbe]", dialed)
+	}
+	ss = r.Status()
+	if len(ss) != 2 || ss[0].Addr != "asia.rbe" || ss[1].Addr != "us.rbe" {
+		t.Errorf("Status()=%+v; want asia.rbe, us.rbe", ss)
+	}
+}
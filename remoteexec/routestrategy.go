@@ -0,0 +1,127 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+// RouteRequest is a request to route to a backend.
+type RouteRequest struct {
+	// Group is end user's group.
+	Group string
+
+	// BuildID is build id in RequesterInfo.
+	BuildID string
+
+	// Cwd is current working directory of the request.
+	Cwd string
+}
+
+// RouteStrategy picks a backend for a request among healthy backends.
+type RouteStrategy interface {
+	// Pick picks a backend for req in backends.
+	// backends is not empty.
+	Pick(req RouteRequest, backends []*Backend) *Backend
+}
+
+// WeightedRandom picks a backend in weighted random.
+// It is the default strategy of Router.
+type WeightedRandom struct{}
+
+// Pick picks a backend in weighted random.
+func (WeightedRandom) Pick(req RouteRequest, backends []*Backend) *Backend {
+	var total int64
+	for _, b := range backends {
+		total += int64(b.Weight)
+	}
+	n := rand.Int63n(total)
+	for _, b := range backends {
+		n -= int64(b.Weight)
+		if n < 0 {
+			return b
+		}
+	}
+	return backends[len(backends)-1]
+}
+
+// StickyKey is a key of request for StickyHash.
+type StickyKey int
+
+const (
+	// StickyBuild uses build id, or cwd if build id is not set.
+	StickyBuild StickyKey = iota
+	// StickyCwd uses cwd.
+	StickyCwd
+)
+
+// StickyHash routes requests with the same key to the same backend,
+// so that remote workers of the backend get better input cache hits
+// across a build.
+//
+// It uses weighted rendezvous hashing, so requests are spread over
+// backends by their weights, and only requests routed to a backend
+// move to other backends when the backend becomes unhealthy.
+// Requests without key are routed in weighted random.
+type StickyHash struct {
+	Key StickyKey
+}
+
+func (s StickyHash) key(req RouteRequest) string {
+	switch s.Key {
+	case StickyCwd:
+		return req.Cwd
+	default:
+		if req.BuildID != "" {
+			return req.BuildID
+		}
+		return req.Cwd
+	}
+}
+
+// Pick picks a backend with the highest score for the request's key.
+func (s StickyHash) Pick(req RouteRequest, backends []*Backend) *Backend {
+	key := s.key(req)
+	if key == "" {
+		return WeightedRandom{}.Pick(req, backends)
+	}
+	var picked *Backend
+	var max float64
+	for _, b := range backends {
+		score := rendezvousScore(key, b)
+		if picked == nil || score > max {
+			picked = b
+			max = score
+		}
+	}
+	return picked
+}
+
+// rendezvousScore returns weighted rendezvous hash score of key for b.
+// https://en.wikipedia.org/wiki/Rendezvous_hashing#Weighted_rendezvous_hash
+func rendezvousScore(key string, b *Backend) float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s", key, b.Addr)
+	// map hash to (0, 1).
+	u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+	return -float64(b.Weight) / math.Log(u)
+}
+
+// ParseRouteStrategy parses name of route strategy:
+// "weighted" (or empty), "sticky-build" or "sticky-cwd".
+func ParseRouteStrategy(name string) (RouteStrategy, error) {
+	switch name {
+	case "", "weighted":
+		return WeightedRandom{}, nil
+	case "sticky-build":
+		return StickyHash{Key: StickyBuild}, nil
+	case "sticky-cwd":
+		return StickyHash{Key: StickyCwd}, nil
+	}
+	return nil, fmt.Errorf("unknown route strategy %q: want weighted, sticky-build or sticky-cwd", name)
+}
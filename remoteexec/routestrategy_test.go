@@ -0,0 +1,75 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStickyHash(t *testing.T) {
+	backends := []*Backend{
+		{Addr: "us.rbe", Weight: 3},
+		{Addr: "eu.rbe", Weight: 1},
+		{Addr: "asia.rbe", Weight: 1},
+	}
+	s := StickyHash{Key: StickyBuild}
+
+	picks := make(map[string]int)
+	picked := make(map[string]*Backend)
+	for i := 0; i < 5000; i++ {
+		req := RouteRequest{
+			BuildID: fmt.Sprintf("build-%d", i),
+			Cwd:     "/b/s/w/ir/cache/builder/src",
+		}
+		b := s.Pick(req, backends)
+		for j := 0; j < 3; j++ {
+			if got := s.Pick(req, backends); got != b {
+				t.Fatalf("Pick(%v)=%v; want %v", req, got, b)
+			}
+		}
+		picks[b.Addr]++
+		picked[req.BuildID] = b
+	}
+	if picks["us.rbe"] < 2700 || picks["us.rbe"] > 3300 {
+		t.Errorf("picks=%v; want us.rbe about 3000", picks)
+	}
+
+	// requests on healthy backends stay when a backend is removed.
+	remaining := []*Backend{backends[0], backends[2]}
+	for id, b := range picked {
+		if b == backends[1] {
+			continue
+		}
+		if got := s.Pick(RouteRequest{BuildID: id}, remaining); got != b {
+			t.Errorf("Pick(%s) without eu.rbe=%v; want %v", id, got, b)
+		}
+	}
+
+	req := RouteRequest{Cwd: "/home/user/chromium/src"}
+	b := s.Pick(req, backends)
+	if got := (StickyHash{Key: StickyCwd}).Pick(RouteRequest{BuildID: "build-1", Cwd: req.Cwd}, backends); got != b {
+		t.Errorf("StickyCwd Pick=%v; want %v picked by cwd", got, b)
+	}
+}
+
+func TestParseRouteStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		want    RouteStrategy
+		wantErr bool
+	}{
+		{name: "", want: WeightedRandom{}},
+		{name: "weighted", want: WeightedRandom{}},
+		{name: "sticky-build", want: StickyHash{Key: StickyBuild}},
+		{name: "sticky-cwd", want: StickyHash{Key: StickyCwd}},
+		{name: "round-robin", wantErr: true},
+	} {
+		got, err := ParseRouteStrategy(tc.name)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseRouteStrategy(%q)=%v, %v; want %v, err=%t", tc.name, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 #!/bin/bash
 set -e
+if [[ "$DEBUG_PREFIX_MAP" != "" ]]; then
+  # map input root to relative path from work dir,
+  # so outputs don't depend on input root dir.
+  set -- "$@" "-fdebug-prefix-map=$(pwd)=${DEBUG_PREFIX_MAP}"
+fi
 if [[ "$WORK_DIR" != "" ]]; then
   cd "${WORK_DIR}"
 fi
@@ -0,0 +1,291 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	"go.chromium.org/goma/server/fswatch"
+	"go.chromium.org/goma/server/log"
+	authpb "go.chromium.org/goma/server/proto/auth"
+	"go.chromium.org/goma/server/server"
+)
+
+// GroupQuota is a quota of exec requests for a group in Scheduler.
+type GroupQuota struct {
+	// MaxConcurrent is max number of concurrent exec requests of
+	// the group. 0 means no limit.
+	MaxConcurrent int
+
+	// Weight is weight of the group to share concurrency with other
+	// groups when Scheduler.MaxConcurrent is hit. 0 means 1.
+	Weight int
+}
+
+func (q GroupQuota) weight() int {
+	if q.Weight <= 0 {
+		return 1
+	}
+	return q.Weight
+}
+
+// QuotasFromACL returns group quotas configured in acl.
+func QuotasFromACL(acl *authpb.ACL) map[string]GroupQuota {
+	quotas := make(map[string]GroupQuota)
+	for _, g := range acl.GetGroups() {
+		if g.GetMaxConcurrentExecs() <= 0 && g.GetExecWeight() <= 0 {
+			continue
+		}
+		if _, ok := quotas[g.GetId()]; ok {
+			// first matched group is used.
+			continue
+		}
+		quotas[g.GetId()] = GroupQuota{
+			MaxConcurrent: int(g.GetMaxConcurrentExecs()),
+			Weight:        int(g.GetExecWeight()),
+		}
+	}
+	return quotas
+}
+
+// Scheduler limits concurrent exec requests per group of end users,
+// so that a large build of a group doesn't starve other groups.
+// Requests that exceed the limits wait in a weighted fair queue:
+// when a slot becomes available, a waiting request of the group
+// that uses the least slots relative to its weight runs first.
+// nil Scheduler doesn't limit requests.
+type Scheduler struct {
+	// MaxConcurrent is max number of concurrent exec requests
+	// in total. 0 means no limit.
+	MaxConcurrent int
+
+	mu      sync.Mutex
+	quotas  map[string]GroupQuota
+	running int
+	groups  map[string]*schedGroup
+	seq     uint64
+}
+
+type schedGroup struct {
+	running int
+	waiters []*schedWaiter
+}
+
+type schedWaiter struct {
+	seq   uint64
+	ready chan struct{}
+}
+
+// SetQuotas sets quotas per group.
+func (s *Scheduler) SetQuotas(quotas map[string]GroupQuota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotas = quotas
+	s.dispatch()
+}
+
+// LoadACL loads quotas per group from ACL in text proto in fname.
+func (s *Scheduler) LoadACL(fname string) error {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	acl := &authpb.ACL{}
+	err = prototext.Unmarshal(b, acl)
+	if err != nil {
+		return fmt.Errorf("load error %s: %v", fname, err)
+	}
+	s.SetQuotas(QuotasFromACL(acl))
+	return nil
+}
+
+// Watch loads quotas from ACL in fname, and reloads it when fname
+// is updated until ctx is done.
+func (s *Scheduler) Watch(ctx context.Context, fname string) error {
+	logger := log.FromContext(ctx)
+	err := s.LoadACL(fname)
+	if err != nil {
+		return err
+	}
+	logger.Infof("scheduler quotas %s: %v", fname, s.Quotas())
+	watcher, err := fswatch.New(ctx, filepath.Dir(fname))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			ev, err := watcher.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Errorf("scheduler watch %s: %v", fname, err)
+				}
+				return
+			}
+			logger.Infof("scheduler acl update: %v", ev)
+			err = s.LoadACL(fname)
+			if err != nil {
+				logger.Errorf("scheduler acl %s: %v", fname, err)
+				continue
+			}
+			logger.Infof("scheduler quotas %s: %v", fname, s.Quotas())
+		}
+	}()
+	return nil
+}
+
+// Quotas returns quotas per group.
+func (s *Scheduler) Quotas() map[string]GroupQuota {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quotas
+}
+
+// Running returns number of running requests of group.
+func (s *Scheduler) Running(group string) int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[group]
+	if !ok {
+		return 0
+	}
+	return g.running
+}
+
+func (s *Scheduler) group(name string) *schedGroup {
+	if s.groups == nil {
+		s.groups = make(map[string]*schedGroup)
+	}
+	g, ok := s.groups[name]
+	if !ok {
+		g = &schedGroup{}
+		s.groups[name] = g
+	}
+	return g
+}
+
+// runnable reports whether a request of group name could run now.
+// s.mu must be held.
+func (s *Scheduler) runnable(name string, g *schedGroup) bool {
+	if s.MaxConcurrent > 0 && s.running >= s.MaxConcurrent {
+		return false
+	}
+	q := s.quotas[name]
+	return q.MaxConcurrent <= 0 || g.running < q.MaxConcurrent
+}
+
+// dispatch runs waiting requests while slots are available.
+// s.mu must be held.
+func (s *Scheduler) dispatch() {
+	for {
+		var next string
+		var ng *schedGroup
+		for name, g := range s.groups {
+			if len(g.waiters) == 0 || !s.runnable(name, g) {
+				continue
+			}
+			if ng == nil || s.less(name, g, next, ng) {
+				next, ng = name, g
+			}
+		}
+		if ng == nil {
+			return
+		}
+		w := ng.waiters[0]
+		ng.waiters = ng.waiters[1:]
+		ng.running++
+		s.running++
+		close(w.ready)
+	}
+}
+
+// less reports whether group a should run before group b,
+// i.e. a uses less slots relative to its weight, or its request
+// has waited longer if they are the same.
+// s.mu must be held.
+func (s *Scheduler) less(an string, a *schedGroup, bn string, b *schedGroup) bool {
+	aw := s.quotas[an].weight()
+	bw := s.quotas[bn].weight()
+	if x, y := a.running*bw, b.running*aw; x != y {
+		return x < y
+	}
+	return a.waiters[0].seq < b.waiters[0].seq
+}
+
+func (s *Scheduler) release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[name]
+	g.running--
+	s.running--
+	if g.running == 0 && len(g.waiters) == 0 {
+		delete(s.groups, name)
+	}
+	s.dispatch()
+}
+
+// Acquire waits until a request of group could run, and returns
+// a func to call when the request finishes.
+// It returns error if ctx is done while waiting.
+// Waiting requests are reported as queue depth of server.LoadExec,
+// and requests that give up waiting as its admission rejections.
+func (s *Scheduler) Acquire(ctx context.Context, group string) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	s.mu.Lock()
+	g := s.group(group)
+	s.seq++
+	w := &schedWaiter{
+		seq:   s.seq,
+		ready: make(chan struct{}),
+	}
+	g.waiters = append(g.waiters, w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return func() { s.release(group) }, nil
+	default:
+	}
+	dequeue := server.LoadQueue(ctx, server.LoadExec)
+	defer dequeue()
+	select {
+	case <-w.ready:
+		return func() { s.release(group) }, nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	select {
+	case <-w.ready:
+		// dispatched while ctx was done.
+		s.mu.Unlock()
+		s.release(group)
+	default:
+		for i, gw := range g.waiters {
+			if gw == w {
+				g.waiters = append(g.waiters[:i], g.waiters[i+1:]...)
+				break
+			}
+		}
+		if g.running == 0 && len(g.waiters) == 0 {
+			delete(s.groups, group)
+		}
+		s.mu.Unlock()
+		server.LoadReject(ctx, server.LoadExec)
+	}
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authpb "go.chromium.org/goma/server/proto/auth"
+)
+
+func TestQuotasFromACL(t *testing.T) {
+	acl := &authpb.ACL{
+		Groups: []*authpb.Group{
+			{Id: "big-team", MaxConcurrentExecs: 100},
+			{Id: "chrome-bot", MaxConcurrentExecs: 500, ExecWeight: 4},
+			{Id: "big-team", MaxConcurrentExecs: 10},
+			{Id: "user"},
+		},
+	}
+	got := QuotasFromACL(acl)
+	want := map[string]GroupQuota{
+		"big-team":   {MaxConcurrent: 100},
+		"chrome-bot": {MaxConcurrent: 500, Weight: 4},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("QuotasFromACL diff -want +got:\n%s", diff)
+	}
+}
+
+func TestSchedulerGroupLimit(t *testing.T) {
+	ctx := context.Background()
+	s := &Scheduler{}
+	s.SetQuotas(map[string]GroupQuota{
+		"big-team": {MaxConcurrent: 2},
+	})
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := s.Acquire(ctx, "big-team")
+		if err != nil {
+			t.Fatalf("Acquire(big-team) %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+
+	// other group is not limited.
+	release, err := s.Acquire(ctx, "user")
+	if err != nil {
+		t.Fatalf("Acquire(user): %v", err)
+	}
+	release()
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = s.Acquire(tctx, "big-team")
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Acquire(big-team) over limit=%v; want DeadlineExceeded", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		release, err := s.Acquire(ctx, "big-team")
+		if err == nil {
+			defer release()
+		}
+		done <- err
+	}()
+	releases[0]()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Acquire(big-team) after release: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Acquire(big-team) not dispatched after release")
+	}
+	releases[1]()
+	if got := s.Running("big-team"); got != 0 {
+		t.Errorf("Running(big-team)=%d; want 0", got)
+	}
+}
+
+func TestSchedulerFairQueue(t *testing.T) {
+	ctx := context.Background()
+	s := &Scheduler{
+		MaxConcurrent: 3,
+	}
+	s.SetQuotas(map[string]GroupQuota{
+		"chrome-bot": {Weight: 2},
+	})
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		release, err := s.Acquire(ctx, "big-team")
+		if err != nil {
+			t.Fatalf("Acquire(big-team) %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+
+	// queue big-team first, then others.
+	order := make(chan string, 4)
+	queued := func(group string) int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		g, ok := s.groups[group]
+		if !ok {
+			return 0
+		}
+		return len(g.waiters)
+	}
+	start := func(group string) {
+		n := queued(group)
+		go func() {
+			_, err := s.Acquire(ctx, group)
+			if err != nil {
+				t.Errorf("Acquire(%s): %v", group, err)
+				return
+			}
+			order <- group
+		}()
+		// wait until the request is queued.
+		for queued(group) <= n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	start("big-team")
+	start("user")
+	start("chrome-bot")
+	start("chrome-bot")
+
+	var got []string
+	for _, release := range releases {
+		release()
+		select {
+		case group := <-order:
+			got = append(got, group)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("dispatched %q; no request dispatched after release", got)
+		}
+	}
+	// 1st slot: user and chrome-bot have no running requests,
+	// and user was queued earlier.
+	// 2nd slot: chrome-bot has no running requests.
+	// 3rd slot: big-team has no running requests, while chrome-bot
+	// has 1 running request with weight 2.
+	want := []string{"user", "chrome-bot", "big-team"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("dispatch order diff -want +got:\n%s", diff)
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+	"go.chromium.org/goma/server/metrics"
 )
 
 var (
@@ -31,6 +34,11 @@ var (
 		stats.UnitDimensionless)
 	compilerNameKey = tag.MustNewKey("compiler")
 
+	debugPrefixMapCount = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.debug-prefix-map",
+		"Number of requests normalized by debug prefix map",
+		stats.UnitDimensionless)
+
 	inputBufferAllocSize = stats.Int64(
 		"go.chromium.org/goma/server/remoteexec.input-buffer-alloc",
 		"Size to allocate buffer for input files",
@@ -38,6 +46,10 @@ var (
 
 	allocStatusKey = tag.MustNewKey("status")
 
+	execScheduleTime = stats.Float64(
+		"go.chromium.org/goma/server/remoteexec.exec-schedule",
+		"Time to wait in scheduler",
+		stats.UnitMilliseconds)
 	execInventoryTime = stats.Float64(
 		"go.chromium.org/goma/server/remoteexec.exec-inventory",
 		"Time in inventory check",
@@ -92,6 +104,126 @@ var (
 		"Time in RBE output",
 		stats.UnitMilliseconds)
 
+	warmerFiles = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.warmer-files",
+		"Number of toolchain files to warm",
+		stats.UnitDimensionless)
+	warmerUploads = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.warmer-uploads",
+		"Number of toolchain files uploaded by warmer",
+		stats.UnitDimensionless)
+	warmerUploadBytes = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.warmer-upload-bytes",
+		"Size of toolchain files uploaded by warmer",
+		stats.UnitBytes)
+
+	warmerResultKey = tag.MustNewKey("result")
+
+	journalLost = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.journal-lost",
+		"Number of in-flight requests lost by crash",
+		stats.UnitDimensionless)
+	journalReattach = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.journal-reattach",
+		"Number of operations re-attached after crash",
+		stats.UnitDimensionless)
+
+	journalPhaseKey  = tag.MustNewKey("phase")
+	journalResultKey = tag.MustNewKey("result")
+
+	backfillRegistered = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.backfill-registered",
+		"Number of outputs registered for lazy backfill",
+		stats.UnitDimensionless)
+	backfillFetches = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.backfill-fetches",
+		"Number of outputs fetched from CAS by backfill",
+		stats.UnitDimensionless)
+
+	backfillResultKey = tag.MustNewKey("result")
+
+	provenanceAttested = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.provenance-attested",
+		"Number of outputs attested with provenance",
+		stats.UnitDimensionless)
+
+	pchOutputs = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.pch-outputs",
+		"Number of PCH/module outputs",
+		stats.UnitDimensionless)
+	pchOutputBytes = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.pch-output-bytes",
+		"Size of PCH/module outputs",
+		stats.UnitBytes)
+
+	pchKindKey   = tag.MustNewKey("kind")
+	pchResultKey = tag.MustNewKey("result")
+
+	fileMetaCacheStats = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.file-meta-cache",
+		"Number of file metadata cache lookups",
+		stats.UnitDimensionless)
+
+	fileMetaOpKey = tag.MustNewKey("op")
+
+	missingContinuationStats = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.missing-continuation",
+		"Number of missing continuation lookups",
+		stats.UnitDimensionless)
+	missingContinuationSkipped = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.missing-continuation-skipped",
+		"Number of blobs skipped to check missing by continuation",
+		stats.UnitDimensionless)
+
+	missingContinuationOpKey = tag.MustNewKey("op")
+
+	localFallbacks = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.local-fallbacks",
+		"Number of actions executed locally when RBE is unavailable",
+		stats.UnitDimensionless)
+	localFallbackTime = stats.Float64(
+		"go.chromium.org/goma/server/remoteexec.local-fallback-time",
+		"Time to execute action locally",
+		stats.UnitMilliseconds)
+
+	localFallbackResultKey = tag.MustNewKey("result")
+
+	proberLatency = stats.Float64(
+		"go.chromium.org/goma/server/remoteexec.prober-latency",
+		"Time of RBE probe",
+		stats.UnitMilliseconds)
+	proberAvailable = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.prober-available",
+		"Availability of RBE instance by probe (1 if available, 0 otherwise)",
+		stats.UnitDimensionless)
+
+	proberInstanceKey = tag.MustNewKey("instance")
+	proberProbeKey    = tag.MustNewKey("probe")
+	proberResultKey   = tag.MustNewKey("result")
+
+	canceledOperations = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.canceled-operations",
+		"Number of RBE operations canceled since request was canceled",
+		stats.UnitDimensionless)
+
+	cancelResultKey = tag.MustNewKey("result")
+
+	hedgedRequests = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.hedged-requests",
+		"Number of RBE requests that issued hedged attempts",
+		stats.UnitDimensionless)
+
+	hedgeRPCKey    = tag.MustNewKey("hedge_rpc")
+	hedgeWinnerKey = tag.MustNewKey("winner")
+
+	backendRequests = stats.Int64(
+		"go.chromium.org/goma/server/remoteexec.backend-requests",
+		"Number of exec requests routed to RBE backends",
+		stats.UnitDimensionless)
+
+	backendAddrKey   = tag.MustNewKey("rbe_backend")
+	backendResultKey = tag.MustNewKey("result")
+
 	rbeExitKey                  = tag.MustNewKey("exit")
 	rbeCacheKey                 = tag.MustNewKey("cache")
 	rbePlatformOSFamilyKey      = tag.MustNewKey("os-family")
@@ -99,82 +231,106 @@ var (
 	rbeCrossKey                 = tag.MustNewKey("cross")
 	// wrapper?
 
-	rbeTagKeys = []tag.Key{
+	rbeTagKeys = metrics.TagKeys(
 		rbeExitKey,
 		rbeCacheKey,
 		rbePlatformOSFamilyKey,
 		rbePlatformDockerRuntimeKey,
 		rbeCrossKey,
-	}
+	)
 
 	defaultLatencyDistribution = view.Distribution(1, 2, 3, 4, 5, 6, 8, 10, 13, 16, 20, 25, 30, 40, 50, 65, 80, 100, 130, 160, 200, 250, 300, 400, 500, 650, 800, 1000, 2000, 5000, 10000, 20000, 50000, 100000, 200000, 500000)
 
 	DefaultViews = []*view.View{
 		{
 			Description: `Number of current running exec operations`,
+			TagKeys:     metrics.TagKeys(),
 			Measure:     numRunningOperations,
 			Aggregation: view.Sum(),
 		},
 		{
 			Description: "Number of requests per wrapper types",
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				wrapperTypeKey,
-			},
+			),
 			Measure:     wrapperCount,
 			Aggregation: view.Count(),
 		},
 		{
 			Measure: unknownFlagCount,
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
+				compilerNameKey,
+			),
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of requests normalized by debug prefix map",
+			TagKeys: metrics.TagKeys(
 				compilerNameKey,
-			},
+				wrapperTypeKey,
+			),
+			Measure:     debugPrefixMapCount,
 			Aggregation: view.Count(),
 		},
 		{
 			Description: "Size to allocate buffer for input files",
-			TagKeys: []tag.Key{
+			TagKeys: metrics.TagKeys(
 				allocStatusKey,
-			},
+			),
 			Measure:     inputBufferAllocSize,
 			Aggregation: view.Sum(),
 		},
+		{
+			Description: "Time to wait in scheduler",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     execScheduleTime,
+			Aggregation: defaultLatencyDistribution,
+		},
 		{
 			Description: "Time in inventory check",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execInventoryTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time in input tree construction",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execInputTreeTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time in setup",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execSetupTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time to check cache",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execCheckCacheTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time to check missing",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execCheckMissingTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time to upload blobs",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execUploadBlobsTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time to execute",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execExecuteTime,
 			Aggregation: defaultLatencyDistribution,
 		},
 		{
 			Description: "Time in response",
+			TagKeys:     metrics.TagKeys(),
 			Measure:     execResponseTime,
 			Aggregation: defaultLatencyDistribution,
 		},
@@ -208,6 +364,165 @@ var (
 			TagKeys:     rbeTagKeys,
 			Aggregation: defaultLatencyDistribution,
 		},
+		{
+			Description: "Number of toolchain files to warm",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     warmerFiles,
+			Aggregation: view.LastValue(),
+		},
+		{
+			Description: "Number of toolchain files uploaded by warmer",
+			TagKeys: metrics.TagKeys(
+				warmerResultKey,
+			),
+			Measure:     warmerUploads,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Size of toolchain files uploaded by warmer",
+			TagKeys: metrics.TagKeys(
+				warmerResultKey,
+			),
+			Measure:     warmerUploadBytes,
+			Aggregation: view.Sum(),
+		},
+		{
+			Description: "Number of in-flight requests lost by crash",
+			TagKeys: metrics.TagKeys(
+				journalPhaseKey,
+			),
+			Measure:     journalLost,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of operations re-attached after crash",
+			TagKeys: metrics.TagKeys(
+				journalResultKey,
+			),
+			Measure:     journalReattach,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of outputs registered for lazy backfill",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     backfillRegistered,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of outputs fetched from CAS by backfill",
+			TagKeys: metrics.TagKeys(
+				backfillResultKey,
+			),
+			Measure:     backfillFetches,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of outputs attested with provenance",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     provenanceAttested,
+			Aggregation: view.Sum(),
+		},
+		{
+			Description: "Number of PCH/module outputs",
+			TagKeys: metrics.TagKeys(
+				pchKindKey,
+				pchResultKey,
+			),
+			Measure:     pchOutputs,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Size of PCH/module outputs",
+			TagKeys: metrics.TagKeys(
+				pchKindKey,
+				pchResultKey,
+			),
+			Measure:     pchOutputBytes,
+			Aggregation: view.Sum(),
+		},
+		{
+			Description: "Number of file metadata cache lookups",
+			TagKeys: metrics.TagKeys(
+				fileMetaOpKey,
+			),
+			Measure:     fileMetaCacheStats,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of missing continuation lookups",
+			TagKeys: metrics.TagKeys(
+				missingContinuationOpKey,
+			),
+			Measure:     missingContinuationStats,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of blobs skipped to check missing by continuation",
+			TagKeys:     metrics.TagKeys(),
+			Measure:     missingContinuationSkipped,
+			Aggregation: view.Sum(),
+		},
+		{
+			Description: "Number of actions executed locally when RBE is unavailable",
+			TagKeys: metrics.TagKeys(
+				localFallbackResultKey,
+			),
+			Measure:     localFallbacks,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Time to execute action locally",
+			TagKeys: metrics.TagKeys(
+				localFallbackResultKey,
+			),
+			Measure:     localFallbackTime,
+			Aggregation: defaultLatencyDistribution,
+		},
+		{
+			Description: "Time of RBE probe",
+			TagKeys: metrics.TagKeys(
+				proberInstanceKey,
+				proberProbeKey,
+				proberResultKey,
+			),
+			Measure:     proberLatency,
+			Aggregation: defaultLatencyDistribution,
+		},
+		{
+			Description: "Availability of RBE instance by probe (1 if available, 0 otherwise)",
+			TagKeys: metrics.TagKeys(
+				proberInstanceKey,
+				proberProbeKey,
+			),
+			Measure:     proberAvailable,
+			Aggregation: view.LastValue(),
+		},
+		{
+			Description: "Number of RBE operations canceled since request was canceled",
+			TagKeys: metrics.TagKeys(
+				cancelResultKey,
+			),
+			Measure:     canceledOperations,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of RBE requests that issued hedged attempts",
+			TagKeys: metrics.TagKeys(
+				hedgeRPCKey,
+				hedgeWinnerKey,
+			),
+			Measure:     hedgedRequests,
+			Aggregation: view.Count(),
+		},
+		{
+			Description: "Number of exec requests routed to RBE backends",
+			TagKeys: metrics.TagKeys(
+				backendAddrKey,
+				backendResultKey,
+			),
+			Measure:     backendRequests,
+			Aggregation: view.Count(),
+		},
 	}
 )
 
@@ -218,3 +533,39 @@ func recordRemoteExecStart(ctx context.Context) {
 func recordRemoteExecFinish(ctx context.Context) {
 	stats.Record(ctx, numRunningOperations.M(-1))
 }
+
+func recordDebugPrefixMap(ctx context.Context, compiler string, wt wrapperType) {
+	err := stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(compilerNameKey, compiler),
+		tag.Upsert(wrapperTypeKey, wt.String()),
+	}, debugPrefixMapCount.M(1))
+	if err != nil {
+		logger := log.FromContext(ctx)
+		logger.Errorf("record debug-prefix-map %s: %v", compiler, err)
+	}
+}
+
+// recordHedge records which attempt won, if hedged attempts were issued.
+func recordHedge(ctx context.Context, rpc string, attempts, winner int) {
+	if attempts <= 1 {
+		return
+	}
+	w := "first"
+	if winner > 0 {
+		w = "hedge"
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(hedgeRPCKey, rpc),
+		tag.Upsert(hedgeWinnerKey, w),
+	}, hedgedRequests.M(1))
+}
+
+func recordCancelOperation(ctx context.Context, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(cancelResultKey, result),
+	}, canceledOperations.M(1))
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+// TimeoutPolicy overrides Adapter's ExecTimeout and SpanTimeout
+// per user group or per command class.
+//
+// It is loaded from JSON config, e.g.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "class": "link",
+//	      "exec_timeout": "60m",
+//	      "span_timeout": {"upload_blobs": "5m"}
+//	    },
+//	    {
+//	      "group": "chrome-bot",
+//	      "class": "compile",
+//	      "exec_timeout": "10m"
+//	    }
+//	  ]
+//	}
+type TimeoutPolicy struct {
+	// Rules are checked in order, and the first matched rule is applied.
+	Rules []TimeoutRule `json:"rules"`
+}
+
+// TimeoutRule is a rule of TimeoutPolicy.
+type TimeoutRule struct {
+	// Group matches end user's group. empty matches any group.
+	Group string `json:"group,omitempty"`
+
+	// Class matches command class of the request.
+	// "compile" for compile (e.g. gcc -c), "link" for gcc/clang
+	// commands without -c (or clang-cl without /c), or command name
+	// for other commands (e.g. "javac").
+	// empty matches any class.
+	Class string `json:"class,omitempty"`
+
+	// ExecTimeout overrides Adapter.ExecTimeout if not empty.
+	ExecTimeout Duration `json:"exec_timeout,omitempty"`
+
+	// SpanTimeout overrides Adapter.SpanTimeout for each span.
+	// key is span name in snake case, e.g. "input_tree", "upload_blobs".
+	// "0s" means no timeout.
+	SpanTimeout map[string]Duration `json:"span_timeout,omitempty"`
+}
+
+// Duration is time.Duration represented in JSON as string, e.g. "10m".
+type Duration time.Duration
+
+// MarshalJSON marshals d as duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON unmarshals duration string into d.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be string: %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// spanTimeoutFields maps span name in TimeoutRule.SpanTimeout to
+// SpanTimeout field.
+var spanTimeoutFields = map[string]func(*SpanTimeout) *time.Duration{
+	"inventory":     func(st *SpanTimeout) *time.Duration { return &st.Inventory },
+	"input_tree":    func(st *SpanTimeout) *time.Duration { return &st.InputTree },
+	"setup":         func(st *SpanTimeout) *time.Duration { return &st.Setup },
+	"check_cache":   func(st *SpanTimeout) *time.Duration { return &st.CheckCache },
+	"check_missing": func(st *SpanTimeout) *time.Duration { return &st.CheckMissing },
+	"upload_blobs":  func(st *SpanTimeout) *time.Duration { return &st.UploadBlobs },
+	"execute":       func(st *SpanTimeout) *time.Duration { return &st.Execute },
+	"response":      func(st *SpanTimeout) *time.Duration { return &st.Response },
+}
+
+// LoadTimeoutPolicy loads TimeoutPolicy from JSON file fname.
+func LoadTimeoutPolicy(fname string) (*TimeoutPolicy, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	p := &TimeoutPolicy{}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return p, nil
+}
+
+// Validate checks p is valid.
+func (p *TimeoutPolicy) Validate() error {
+	for i, r := range p.Rules {
+		if r.ExecTimeout < 0 {
+			return fmt.Errorf("rule %d: negative exec_timeout %s", i, time.Duration(r.ExecTimeout))
+		}
+		for k, v := range r.SpanTimeout {
+			if _, ok := spanTimeoutFields[k]; !ok {
+				return fmt.Errorf("rule %d: unknown span %q in span_timeout", i, k)
+			}
+			if v < 0 {
+				return fmt.Errorf("rule %d: negative span_timeout %s=%s", i, k, time.Duration(v))
+			}
+		}
+	}
+	return nil
+}
+
+// Apply returns exec timeout and span timeout for group and class,
+// overridden by the first matched rule.
+// It returns execTimeout and spanTimeout as is if p is nil or
+// no rule matches.
+func (p *TimeoutPolicy) Apply(group, class string, execTimeout time.Duration, spanTimeout SpanTimeout) (time.Duration, SpanTimeout) {
+	if p == nil {
+		return execTimeout, spanTimeout
+	}
+	for _, r := range p.Rules {
+		if r.Group != "" && r.Group != group {
+			continue
+		}
+		if r.Class != "" && r.Class != class {
+			continue
+		}
+		if r.ExecTimeout > 0 {
+			execTimeout = time.Duration(r.ExecTimeout)
+		}
+		for k, v := range r.SpanTimeout {
+			f, ok := spanTimeoutFields[k]
+			if !ok {
+				continue
+			}
+			*f(&spanTimeout) = time.Duration(v)
+		}
+		return execTimeout, spanTimeout
+	}
+	return execTimeout, spanTimeout
+}
+
+// DefaultMinDeadlineBudget is default minimum remaining time of
+// the client's deadline to start handling a request.
+const DefaultMinDeadlineBudget = 1 * time.Second
+
+// budget returns span timeouts fit in remaining time of the client's
+// deadline.
+// It reserves time for response span (up to a quarter of remaining),
+// so that the response could be sent to the client before the deadline
+// even if other spans are slow.
+func (st SpanTimeout) budget(remaining time.Duration) SpanTimeout {
+	reserve := remaining / 4
+	if st.Response > 0 && st.Response < reserve {
+		reserve = st.Response
+	}
+	avail := remaining - reserve
+	fit := func(d, limit time.Duration) time.Duration {
+		if d == 0 || d > limit {
+			return limit
+		}
+		return d
+	}
+	return SpanTimeout{
+		Inventory:    fit(st.Inventory, avail),
+		InputTree:    fit(st.InputTree, avail),
+		Setup:        fit(st.Setup, avail),
+		CheckCache:   fit(st.CheckCache, avail),
+		CheckMissing: fit(st.CheckMissing, avail),
+		UploadBlobs:  fit(st.UploadBlobs, avail),
+		Execute:      fit(st.Execute, avail),
+		Response:     fit(st.Response, remaining),
+	}
+}
+
+// commandClass returns command class of req used in TimeoutPolicy.
+func commandClass(req *gomapb.ExecReq) string {
+	name := req.GetCommandSpec().GetName()
+	switch name {
+	case "gcc", "g++", "clang", "clang++":
+		for _, arg := range req.GetArg() {
+			if arg == "-c" {
+				return "compile"
+			}
+		}
+		return "link"
+	case "clang-cl", "cl.exe":
+		for _, arg := range req.GetArg() {
+			if arg == "-c" || strings.EqualFold(arg, "/c") {
+				return "compile"
+			}
+		}
+		return "link"
+	}
+	return name
+}
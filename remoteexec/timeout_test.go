@@ -0,0 +1,207 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+
+	gomapb "go.chromium.org/goma/server/proto/api"
+)
+
+func TestTimeoutPolicy(t *testing.T) {
+	const config = `{
+  "rules": [
+    {
+      "class": "link",
+      "exec_timeout": "60m",
+      "span_timeout": {"upload_blobs": "5m", "execute": "0s"}
+    },
+    {
+      "group": "chrome-bot",
+      "class": "compile",
+      "exec_timeout": "10m"
+    }
+  ]
+}`
+	fname := filepath.Join(t.TempDir(), "timeout.json")
+	err := ioutil.WriteFile(fname, []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadTimeoutPolicy(fname)
+	if err != nil {
+		t.Fatalf("LoadTimeoutPolicy(%q)=_, %v; want nil error", fname, err)
+	}
+
+	spanTimeout := DefaultSpanTimeout
+	spanTimeout.Execute = 20 * time.Minute
+	linkSpanTimeout := spanTimeout
+	linkSpanTimeout.UploadBlobs = 5 * time.Minute
+	linkSpanTimeout.Execute = 0
+
+	for _, tc := range []struct {
+		group, class    string
+		wantExecTimeout time.Duration
+		wantSpanTimeout SpanTimeout
+	}{
+		{
+			group:           "user",
+			class:           "link",
+			wantExecTimeout: 60 * time.Minute,
+			wantSpanTimeout: linkSpanTimeout,
+		},
+		{
+			group:           "chrome-bot",
+			class:           "compile",
+			wantExecTimeout: 10 * time.Minute,
+			wantSpanTimeout: spanTimeout,
+		},
+		{
+			group:           "user",
+			class:           "compile",
+			wantExecTimeout: 15 * time.Minute,
+			wantSpanTimeout: spanTimeout,
+		},
+		{
+			group:           "chrome-bot",
+			class:           "javac",
+			wantExecTimeout: 15 * time.Minute,
+			wantSpanTimeout: spanTimeout,
+		},
+	} {
+		execTimeout, st := p.Apply(tc.group, tc.class, 15*time.Minute, spanTimeout)
+		if execTimeout != tc.wantExecTimeout {
+			t.Errorf("Apply(%q, %q) exec timeout=%s; want %s", tc.group, tc.class, execTimeout, tc.wantExecTimeout)
+		}
+		if diff := cmp.Diff(tc.wantSpanTimeout, st); diff != "" {
+			t.Errorf("Apply(%q, %q) span timeout diff -want +got:\n%s", tc.group, tc.class, diff)
+		}
+	}
+
+	var nilPolicy *TimeoutPolicy
+	execTimeout, st := nilPolicy.Apply("user", "link", 15*time.Minute, spanTimeout)
+	if execTimeout != 15*time.Minute || st != spanTimeout {
+		t.Errorf("nil.Apply()=%s, %v; want %s, %v", execTimeout, st, 15*time.Minute, spanTimeout)
+	}
+}
+
+func TestTimeoutPolicyValidate(t *testing.T) {
+	for _, config := range []string{
+		`{"rules": [{"span_timeout": {"unknown": "1s"}}]}`,
+		`{"rules": [{"exec_timeout": "-1s"}]}`,
+		`{"rules": [{"span_timeout": {"execute": "-1s"}}]}`,
+	} {
+		p := &TimeoutPolicy{}
+		err := json.Unmarshal([]byte(config), p)
+		if err != nil {
+			t.Fatalf("json.Unmarshal(%q)=%v", config, err)
+		}
+		err = p.Validate()
+		if err == nil {
+			t.Errorf("Validate(%q)=nil; want error", config)
+		}
+	}
+
+	p := &TimeoutPolicy{}
+	err := json.Unmarshal([]byte(`{"rules": [{"exec_timeout": 60}]}`), p)
+	if err == nil {
+		t.Errorf("json.Unmarshal(exec_timeout: 60)=nil; want error")
+	}
+}
+
+func TestCommandClass(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "clang++",
+			args: []string{"clang++", "-c", "foo.cc", "-o", "foo.o"},
+			want: "compile",
+		},
+		{
+			name: "clang++",
+			args: []string{"clang++", "foo.o", "-o", "foo"},
+			want: "link",
+		},
+		{
+			name: "clang-cl",
+			args: []string{"clang-cl.exe", "/c", "foo.cc"},
+			want: "compile",
+		},
+		{
+			name: "clang-cl",
+			args: []string{"clang-cl.exe", "foo.obj"},
+			want: "link",
+		},
+		{
+			name: "javac",
+			args: []string{"javac", "Foo.java"},
+			want: "javac",
+		},
+	} {
+		req := &gomapb.ExecReq{
+			CommandSpec: &gomapb.CommandSpec{
+				Name: proto.String(tc.name),
+			},
+			Arg: tc.args,
+		}
+		if got := commandClass(req); got != tc.want {
+			t.Errorf("commandClass(%q, %q)=%q; want %q", tc.name, tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestSpanTimeoutBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		remaining time.Duration
+		want      SpanTimeout
+	}{
+		{
+			name:      "long",
+			remaining: 10 * time.Minute,
+			want: SpanTimeout{
+				Inventory:    1 * time.Second,
+				InputTree:    60 * time.Second,
+				Setup:        1 * time.Second,
+				CheckCache:   3 * time.Second,
+				CheckMissing: 10 * time.Second,
+				UploadBlobs:  60 * time.Second,
+				Execute:      9*time.Minute + 30*time.Second,
+				Response:     30 * time.Second,
+			},
+		},
+		{
+			name:      "short",
+			remaining: 40 * time.Second,
+			want: SpanTimeout{
+				Inventory:    1 * time.Second,
+				InputTree:    30 * time.Second,
+				Setup:        1 * time.Second,
+				CheckCache:   3 * time.Second,
+				CheckMissing: 10 * time.Second,
+				UploadBlobs:  30 * time.Second,
+				Execute:      30 * time.Second,
+				Response:     30 * time.Second,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DefaultSpanTimeout.budget(tc.remaining)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("budget(%s) diff -want +got:\n%s", tc.remaining, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/sync/errgroup"
+
+	"go.chromium.org/goma/server/log"
+	cmdpb "go.chromium.org/goma/server/proto/command"
+	"go.chromium.org/goma/server/remoteexec/cas"
+	"go.chromium.org/goma/server/remoteexec/digest"
+	"go.chromium.org/goma/server/rpc"
+)
+
+const (
+	// DefaultWarmerConcurrency is default concurrency of Warmer uploads.
+	DefaultWarmerConcurrency = 8
+
+	// max number of blobs to check in one FindMissingBlobs call.
+	warmerMissingBatchLimit = 1000
+)
+
+// Warmer uploads toolchain prebuilt files referenced by cmd descriptors
+// to the RBE CAS in background, so that first builds after configure
+// don't need to upload toolchain files.
+type Warmer struct {
+	Adapter *Adapter
+
+	// Concurrency is number of concurrent uploads.
+	// 0 means DefaultWarmerConcurrency.
+	Concurrency int
+
+	mu     sync.Mutex
+	cancel func()
+	done   chan struct{}
+}
+
+// Warm starts to upload toolchain files in configs in background.
+// If previous warm is running, it is cancelled.
+func (w *Warmer) Warm(ctx context.Context, configs []*cmdpb.Config) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+		<-w.done
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	w.cancel = cancel
+	w.done = done
+	go func() {
+		defer close(done)
+		logger := log.FromContext(ctx)
+		t := time.Now()
+		err := w.warm(ctx, configs)
+		if err != nil {
+			logger.Errorf("warm toolchain files: %v", err)
+			return
+		}
+		logger.Infof("warm toolchain files in %s", time.Since(t))
+	}()
+}
+
+// Stop stops running warm.
+func (w *Warmer) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+	w.cancel = nil
+	w.done = nil
+}
+
+// toolchainDigests returns digests of files used in configs.
+func toolchainDigests(configs []*cmdpb.Config) []*rpb.Digest {
+	seen := make(map[string]bool)
+	var digests []*rpb.Digest
+	add := func(fs *cmdpb.FileSpec) {
+		if fs.GetHash() == "" || seen[fs.GetHash()] {
+			return
+		}
+		seen[fs.GetHash()] = true
+		digests = append(digests, &rpb.Digest{
+			Hash:      fs.GetHash(),
+			SizeBytes: fs.GetSize(),
+		})
+	}
+	for _, cfg := range configs {
+		setup := cfg.GetCmdDescriptor().GetSetup()
+		if setup == nil {
+			continue
+		}
+		add(setup.GetCmdFile())
+		for _, fs := range setup.GetFiles() {
+			add(fs)
+		}
+	}
+	return digests
+}
+
+func (w *Warmer) warm(ctx context.Context, configs []*cmdpb.Config) error {
+	logger := log.FromContext(ctx)
+	f := w.Adapter
+	if f.CmdStorage == nil {
+		return errors.New("no cmd storage")
+	}
+	if df := digest.Function(); df != rpb.DigestFunction_SHA256 {
+		// toolchain file hash is SHA-256.
+		return fmt.Errorf("unsupported digest function %v", df)
+	}
+	digests := toolchainDigests(configs)
+	stats.Record(ctx, warmerFiles.M(int64(len(digests))))
+	if len(digests) == 0 {
+		return nil
+	}
+	client := f.client(ctx)
+	instance := f.Instance()
+	comp := f.compressor()
+	c := cas.CAS{
+		Client:     client,
+		Compressor: comp,
+	}
+	var missing []*rpb.Digest
+	for len(digests) > 0 {
+		n := len(digests)
+		if n > warmerMissingBatchLimit {
+			n = warmerMissingBatchLimit
+		}
+		var m []*rpb.Digest
+		err := rpc.Retry{}.Do(ctx, func() error {
+			var err error
+			m, err = c.Missing(ctx, instance, digests[:n])
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		missing = append(missing, m...)
+		digests = digests[n:]
+	}
+	logger.Infof("warm %d toolchain files in %s", len(missing), instance)
+
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultWarmerConcurrency
+	}
+	sema := make(chan struct{}, concurrency)
+	var eg errgroup.Group
+	for _, d := range missing {
+		d := d
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			eg.Wait()
+			return ctx.Err()
+		}
+		eg.Go(func() error {
+			defer func() { <-sema }()
+			err := rpc.Retry{}.Do(ctx, func() error {
+				rd, err := f.CmdStorage.Open(ctx, d.Hash)
+				if err != nil {
+					return err
+				}
+				defer rd.Close()
+				return fixRBEInternalError(cas.UploadDigestCompressed(ctx, client.ByteStream(), instance, d, rd, comp))
+			})
+			recordWarmerUpload(ctx, d, err)
+			if err != nil {
+				logger.Warnf("warm %s: %v", d, err)
+			}
+			// continue to upload other files.
+			return nil
+		})
+	}
+	eg.Wait()
+	return ctx.Err()
+}
+
+func recordWarmerUpload(ctx context.Context, d *rpb.Digest, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(warmerResultKey, result),
+	}, warmerUploads.M(1), warmerUploadBytes.M(d.SizeBytes))
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package remoteexec
+
+import (
+	"testing"
+
+	rpb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	cmdpb "go.chromium.org/goma/server/proto/command"
+)
+
+func TestToolchainDigests(t *testing.T) {
+	configs := []*cmdpb.Config{
+		{
+			CmdDescriptor: &cmdpb.CmdDescriptor{
+				Setup: &cmdpb.CmdDescriptor_Setup{
+					CmdFile: &cmdpb.FileSpec{
+						Path: "bin/clang",
+						Hash: "clang-hash",
+						Size: 100,
+					},
+					Files: []*cmdpb.FileSpec{
+						{
+							Path: "lib/libLLVM.so",
+							Hash: "llvm-hash",
+							Size: 200,
+						},
+						{
+							Path:    "bin/clang++",
+							Symlink: "clang",
+						},
+						{
+							Path: "lib",
+						},
+					},
+				},
+			},
+		},
+		{
+			CmdDescriptor: &cmdpb.CmdDescriptor{
+				Setup: &cmdpb.CmdDescriptor_Setup{
+					CmdFile: &cmdpb.FileSpec{
+						Path: "bin/clang++",
+						Hash: "clang-hash",
+						Size: 100,
+					},
+				},
+			},
+		},
+		{
+			// arbitrary toolchain config.
+			RemoteexecPlatform: &cmdpb.RemoteexecPlatform{},
+		},
+	}
+	got := toolchainDigests(configs)
+	want := []*rpb.Digest{
+		{Hash: "clang-hash", SizeBytes: 100},
+		{Hash: "llvm-hash", SizeBytes: 200},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("toolchainDigests(...) diff -want +got:\n%s", diff)
+	}
+}
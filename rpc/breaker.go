@@ -0,0 +1,278 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+)
+
+const (
+	// DefaultBreakerErrorRate is default error rate to open circuit.
+	DefaultBreakerErrorRate = 0.5
+
+	// DefaultBreakerMinRequests is default minimum number of requests
+	// in window to evaluate error rate.
+	DefaultBreakerMinRequests = 20
+
+	// DefaultBreakerWindow is default window to count requests.
+	DefaultBreakerWindow = 10 * time.Second
+
+	// DefaultBreakerOpenDuration is default duration to keep circuit open.
+	DefaultBreakerOpenDuration = 5 * time.Second
+)
+
+// BreakerState is state of circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed passes requests to target.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects requests to target.
+	BreakerOpen
+	// BreakerHalfOpen passes a trial request to target.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// CircuitOpenError is an error returned when circuit is open.
+// Retry doesn't retry for this error.
+type CircuitOpenError struct {
+	Target string
+	// RetryAfter is duration until circuit becomes half-open.
+	RetryAfter time.Duration
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s: retry after %s", e.Target, e.RetryAfter)
+}
+
+// GRPCStatus returns codes.Unavailable status.
+func (e CircuitOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// CircuitBreaker rejects requests to targets that keep failing,
+// so that callers fail fast instead of burning retry budget
+// and timeouts while backend is down.
+//
+// Circuit for a target opens when error rate in Window exceeds
+// ErrorRate, and becomes half-open after OpenDuration to pass
+// a trial request. Circuit is closed if the trial succeeds,
+// and opens again otherwise.
+// Only codes.Unavailable and codes.DeadlineExceeded are counted as
+// errors, since other errors are not caused by backend availability.
+//
+// nil CircuitBreaker passes all requests.
+type CircuitBreaker struct {
+	// ErrorRate is error rate to open circuit.
+	// DefaultBreakerErrorRate if zero.
+	ErrorRate float64
+
+	// MinRequests is minimum number of requests in Window to
+	// evaluate error rate. DefaultBreakerMinRequests if zero.
+	MinRequests int
+
+	// Window is window to count requests.
+	// DefaultBreakerWindow if zero.
+	Window time.Duration
+
+	// OpenDuration is duration to keep circuit open.
+	// DefaultBreakerOpenDuration if zero.
+	OpenDuration time.Duration
+
+	mu      sync.Mutex
+	targets map[string]*breakerTarget
+}
+
+type breakerTarget struct {
+	state    BreakerState
+	start    time.Time // start of window, or when circuit opened.
+	requests int
+	errors   int
+	trial    bool // trial request is in flight in half-open.
+}
+
+func (b *CircuitBreaker) errorRate() float64 {
+	if b.ErrorRate == 0 {
+		return DefaultBreakerErrorRate
+	}
+	return b.ErrorRate
+}
+
+func (b *CircuitBreaker) minRequests() int {
+	if b.MinRequests == 0 {
+		return DefaultBreakerMinRequests
+	}
+	return b.MinRequests
+}
+
+func (b *CircuitBreaker) window() time.Duration {
+	if b.Window == 0 {
+		return DefaultBreakerWindow
+	}
+	return b.Window
+}
+
+func (b *CircuitBreaker) openDuration() time.Duration {
+	if b.OpenDuration == 0 {
+		return DefaultBreakerOpenDuration
+	}
+	return b.OpenDuration
+}
+
+func (b *CircuitBreaker) target(name string, now time.Time) *breakerTarget {
+	if b.targets == nil {
+		b.targets = make(map[string]*breakerTarget)
+	}
+	t, ok := b.targets[name]
+	if !ok {
+		t = &breakerTarget{
+			start: now,
+		}
+		b.targets[name] = t
+	}
+	return t
+}
+
+// State returns current state of circuit for target.
+func (b *CircuitBreaker) State(target string) BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.targets[target]
+	if !ok {
+		return BreakerClosed
+	}
+	if t.state == BreakerOpen && time.Since(t.start) >= b.openDuration() {
+		return BreakerHalfOpen
+	}
+	return t.state
+}
+
+// allow checks whether request to target is allowed.
+// It returns CircuitOpenError if not allowed.
+func (b *CircuitBreaker) allow(target string) error {
+	if b == nil {
+		return nil
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.target(target, now)
+	switch t.state {
+	case BreakerOpen:
+		if d := now.Sub(t.start); d < b.openDuration() {
+			return CircuitOpenError{
+				Target:     target,
+				RetryAfter: b.openDuration() - d,
+			}
+		}
+		t.state = BreakerHalfOpen
+		t.trial = false
+		fallthrough
+	case BreakerHalfOpen:
+		if t.trial {
+			return CircuitOpenError{
+				Target: target,
+			}
+		}
+		t.trial = true
+	}
+	return nil
+}
+
+// done records result of request to target.
+func (b *CircuitBreaker) done(ctx context.Context, target string, err error) {
+	if b == nil {
+		return
+	}
+	failed := false
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		// caller's deadline is not backend failure.
+		failed = ctx.Err() == nil
+	}
+	logger := log.FromContext(ctx)
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.target(target, now)
+	switch t.state {
+	case BreakerHalfOpen:
+		t.trial = false
+		if failed {
+			logger.Warnf("circuit breaker %s: trial failed, open again: %v", target, err)
+			t.state = BreakerOpen
+			t.start = now
+			return
+		}
+		logger.Infof("circuit breaker %s: closed", target)
+		t.state = BreakerClosed
+		t.start = now
+		t.requests = 0
+		t.errors = 0
+		return
+	case BreakerOpen:
+		// request allowed before circuit opened.
+		return
+	}
+	if now.Sub(t.start) >= b.window() {
+		t.start = now
+		t.requests = 0
+		t.errors = 0
+	}
+	t.requests++
+	if failed {
+		t.errors++
+	}
+	if t.requests >= b.minRequests() && float64(t.errors) >= b.errorRate()*float64(t.requests) {
+		logger.Errorf("circuit breaker %s: open: %d errors in %d requests: %v", target, t.errors, t.requests, err)
+		t.state = BreakerOpen
+		t.start = now
+	}
+}
+
+// Do calls f if circuit for target is not open, and records its result.
+// It returns CircuitOpenError without calling f if circuit is open.
+func (b *CircuitBreaker) Do(ctx context.Context, target string, f func() error) error {
+	if err := b.allow(target); err != nil {
+		return err
+	}
+	err := f()
+	b.done(ctx, target, err)
+	return err
+}
+
+// UnaryClientInterceptor returns grpc unary client interceptor
+// to apply circuit breaker per target of grpc connection.
+func (b *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return b.Do(ctx, cc.Target(), func() error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	b := &CircuitBreaker{
+		ErrorRate:    0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		OpenDuration: 10 * time.Millisecond,
+	}
+	unavailable := status.Error(codes.Unavailable, "backend down")
+	call := func(target string, err error) error {
+		return b.Do(ctx, target, func() error {
+			return err
+		})
+	}
+
+	call("a", nil)
+	call("a", unavailable)
+	call("a", status.Error(codes.NotFound, "not found"))
+	if got := b.State("a"); got != BreakerClosed {
+		t.Errorf("State(a)=%v; want %v", got, BreakerClosed)
+	}
+	call("a", unavailable)
+	if got := b.State("a"); got != BreakerOpen {
+		t.Errorf("State(a)=%v; want %v", got, BreakerOpen)
+	}
+	if got := b.State("b"); got != BreakerClosed {
+		t.Errorf("State(b)=%v; want %v", got, BreakerClosed)
+	}
+
+	called := false
+	err := b.Do(ctx, "a", func() error {
+		called = true
+		return nil
+	})
+	if _, ok := err.(CircuitOpenError); !ok || called {
+		t.Errorf("Do(a)=%v, called=%t; want CircuitOpenError, not called", err, called)
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("status.Code(%v)=%v; want %v", err, status.Code(err), codes.Unavailable)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if got := b.State("a"); got != BreakerHalfOpen {
+		t.Errorf("State(a)=%v; want %v", got, BreakerHalfOpen)
+	}
+	if err := call("a", unavailable); err != unavailable {
+		t.Errorf("trial=%v; want %v", err, unavailable)
+	}
+	if got := b.State("a"); got != BreakerOpen {
+		t.Errorf("State(a) after failed trial=%v; want %v", got, BreakerOpen)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := call("a", nil); err != nil {
+		t.Errorf("trial=%v; want nil", err)
+	}
+	if got := b.State("a"); got != BreakerClosed {
+		t.Errorf("State(a) after succeeded trial=%v; want %v", got, BreakerClosed)
+	}
+}
+
+func TestRetryCircuitOpen(t *testing.T) {
+	ctx := context.Background()
+	b := &CircuitBreaker{
+		MinRequests:  1,
+		OpenDuration: time.Minute,
+	}
+	n := 0
+	err := Retry{
+		MaxRetry: 5,
+		Breaker:  b,
+		Target:   "backend",
+	}.Do(ctx, func() error {
+		n++
+		return status.Error(codes.Unavailable, "backend down")
+	})
+	if n != 1 {
+		t.Errorf("called %d times; want 1", n)
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Retry.Do=%v; want %v", err, codes.Unavailable)
+	}
+}
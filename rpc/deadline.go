@@ -0,0 +1,47 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+type clientDeadlineKeyType int
+
+var clientDeadlineKey clientDeadlineKeyType
+
+// metadata key to mark the deadline of the context is the client's
+// deadline. the deadline itself is propagated by grpc.
+const clientDeadlineMDKey = "x-goma-client-deadline"
+
+// WithClientDeadline returns a copy of ctx bounded by the client's
+// timeout, and marks that the deadline is client's budget, so that
+// backends could fit their work in the budget.
+// The mark is propagated to downstream grpc calls in metadata.
+func WithClientDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx = metadata.AppendToOutgoingContext(ctx, clientDeadlineMDKey, "1")
+	return context.WithValue(ctx, clientDeadlineKey, true), cancel
+}
+
+// ClientDeadline returns the client's deadline of ctx, if the client
+// specified its timeout.
+func ClientDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Time{}, false
+	}
+	if v, _ := ctx.Value(clientDeadlineKey).(bool); v {
+		return deadline, true
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(clientDeadlineMDKey)) == 0 {
+		return time.Time{}, false
+	}
+	return deadline, true
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestClientDeadline(t *testing.T) {
+	ctx := context.Background()
+	tctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if _, ok := ClientDeadline(tctx); ok {
+		t.Errorf("ClientDeadline(ctx with timeout)=_, true; want false")
+	}
+
+	cctx, cancel := WithClientDeadline(ctx, 30*time.Second)
+	defer cancel()
+	deadline, ok := ClientDeadline(cctx)
+	if !ok {
+		t.Fatalf("ClientDeadline(ctx with client deadline)=_, false; want true")
+	}
+	if remaining := time.Until(deadline); remaining <= 0 || remaining > 30*time.Second {
+		t.Errorf("ClientDeadline(ctx with client deadline)=%s (remaining %s); want in 30s", deadline, remaining)
+	}
+
+	// on grpc server.
+	md, _ := metadata.FromOutgoingContext(cctx)
+	sctx := metadata.NewIncomingContext(tctx, md)
+	if _, ok := ClientDeadline(sctx); !ok {
+		t.Errorf("ClientDeadline(incoming ctx)=_, false; want true")
+	}
+}
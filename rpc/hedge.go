@@ -0,0 +1,82 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+// Hedge handles hedged rpc to mitigate long-tail latency.
+// If an attempt doesn't finish within Delay, it issues another
+// attempt, and uses whichever finishes first.
+type Hedge struct {
+	// Delay is delay to issue hedged attempt.
+	// If it is not positive, no hedged attempt is issued.
+	Delay time.Duration
+
+	// MaxAttempts is max number of attempts including
+	// the first attempt. default is 2.
+	MaxAttempts int
+}
+
+func (h Hedge) maxAttempts() int {
+	if h.MaxAttempts <= 0 {
+		return 2
+	}
+	return h.MaxAttempts
+}
+
+// Do calls f with attempt number, and calls f again with next attempt
+// number concurrently every Delay until any attempt succeeds.
+// It returns number of attempts issued, attempt number that finished
+// first and its error.
+// If an attempt fails while other attempts are in flight, it waits
+// for them. Attempts in flight are canceled when Do returns.
+//
+// f should store its result per attempt number, since attempts run
+// concurrently and may finish after Do returns.
+func (h Hedge) Do(ctx context.Context, f func(ctx context.Context, attempt int) error) (attempts, winner int, err error) {
+	if h.Delay <= 0 {
+		return 1, 0, f(ctx, 0)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		attempt int
+		err     error
+	}
+	ch := make(chan result, h.maxAttempts())
+	start := func() {
+		attempt := attempts
+		attempts++
+		go func() {
+			ch <- result{
+				attempt: attempt,
+				err:     f(ctx, attempt),
+			}
+		}()
+	}
+	start()
+	inflight := 1
+	timer := time.NewTimer(h.Delay)
+	defer timer.Stop()
+	for {
+		select {
+		case r := <-ch:
+			inflight--
+			if r.err == nil || inflight == 0 {
+				return attempts, r.attempt, r.err
+			}
+		case <-timer.C:
+			if attempts < h.maxAttempts() {
+				start()
+				inflight++
+				timer.Reset(h.Delay)
+			}
+		}
+	}
+}
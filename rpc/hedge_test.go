@@ -0,0 +1,81 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	ctx := context.Background()
+	h := Hedge{
+		Delay: 10 * time.Millisecond,
+	}
+
+	t.Run("fast", func(t *testing.T) {
+		attempts, winner, err := h.Do(ctx, func(ctx context.Context, attempt int) error {
+			return nil
+		})
+		if attempts != 1 || winner != 0 || err != nil {
+			t.Errorf("Do=%d, %d, %v; want 1, 0, nil", attempts, winner, err)
+		}
+	})
+
+	t.Run("hedge wins", func(t *testing.T) {
+		canceled := make(chan struct{})
+		attempts, winner, err := h.Do(ctx, func(ctx context.Context, attempt int) error {
+			if attempt == 0 {
+				<-ctx.Done()
+				close(canceled)
+				return ctx.Err()
+			}
+			return nil
+		})
+		if attempts != 2 || winner != 1 || err != nil {
+			t.Errorf("Do=%d, %d, %v; want 2, 1, nil", attempts, winner, err)
+		}
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Errorf("first attempt was not canceled")
+		}
+	})
+
+	t.Run("wait in-flight after error", func(t *testing.T) {
+		attempts, winner, err := h.Do(ctx, func(ctx context.Context, attempt int) error {
+			if attempt == 0 {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}
+			return errors.New("hedge failed")
+		})
+		if attempts != 2 || winner != 0 || err != nil {
+			t.Errorf("Do=%d, %d, %v; want 2, 0, nil", attempts, winner, err)
+		}
+	})
+
+	t.Run("all failed", func(t *testing.T) {
+		_, _, err := h.Do(ctx, func(ctx context.Context, attempt int) error {
+			time.Sleep(20 * time.Millisecond)
+			return errors.New("failed")
+		})
+		if err == nil {
+			t.Errorf("Do=_, _, nil; want error")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		attempts, winner, err := Hedge{}.Do(ctx, func(ctx context.Context, attempt int) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		if attempts != 1 || winner != 0 || err != nil {
+			t.Errorf("Do=%d, %d, %v; want 1, 0, nil", attempts, winner, err)
+		}
+	})
+}
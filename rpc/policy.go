@@ -0,0 +1,172 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/prototext"
+
+	rpcpb "go.chromium.org/goma/server/proto/rpc"
+)
+
+// Target services of Policy.
+const (
+	// ServiceAuth is oauth2 tokeninfo endpoint used by auth server.
+	ServiceAuth = "auth"
+
+	// ServiceAuthDB is authdb used by auth server.
+	ServiceAuthDB = "authdb"
+
+	// ServiceCache is cache backend (i.e. redis).
+	ServiceCache = "cache"
+
+	// ServiceFile is file server used by exec server.
+	ServiceFile = "file"
+
+	// ServiceRemoteexec is remoteexec API.
+	ServiceRemoteexec = "remoteexec"
+)
+
+// Policy is a policy of calls to a target service.
+type Policy struct {
+	// Timeout is timeout of each call.
+	// 0 means the default timeout of the caller.
+	Timeout time.Duration
+
+	// Retry is retry policy of calls.
+	// nil means the default retry policy of the caller.
+	Retry *Retry
+
+	// Hedge is hedging policy of calls, used if the caller
+	// supports hedging. Hedge.Delay 0 means the default of the caller.
+	Hedge Hedge
+}
+
+// TimeoutOr returns p.Timeout if set, or d.
+func (p Policy) TimeoutOr(d time.Duration) time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return d
+}
+
+// WithTimeout returns ctx with p.Timeout if set.
+// Otherwise, it returns cancelable ctx without timeout.
+func (p Policy) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Timeout > 0 {
+		return context.WithTimeout(ctx, p.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// RetryOr returns p.Retry if set, or r.
+func (p Policy) RetryOr(r Retry) Retry {
+	if p.Retry != nil {
+		return *p.Retry
+	}
+	return r
+}
+
+// NewPolicy returns Policy configured by p.
+func NewPolicy(p *rpcpb.ServicePolicy) (Policy, error) {
+	if p.GetTimeoutMsec() < 0 || p.GetHedgeDelayMsec() < 0 || p.GetHedgeMaxAttempts() < 0 {
+		return Policy{}, fmt.Errorf("negative value in policy: %v", p)
+	}
+	policy := Policy{
+		Timeout: time.Duration(p.GetTimeoutMsec()) * time.Millisecond,
+		Hedge: Hedge{
+			Delay:       time.Duration(p.GetHedgeDelayMsec()) * time.Millisecond,
+			MaxAttempts: int(p.GetHedgeMaxAttempts()),
+		},
+	}
+	if p.GetRetry() != nil {
+		r, err := NewRetry(p.GetRetry())
+		if err != nil {
+			return Policy{}, err
+		}
+		policy.Retry = &r
+	}
+	return policy, nil
+}
+
+// Policies holds Policy per target service.
+type Policies struct {
+	m map[string]Policy
+}
+
+// NewPolicies returns Policies configured by c.
+func NewPolicies(c *rpcpb.PolicyConfig) (*Policies, error) {
+	p := &Policies{
+		m: make(map[string]Policy),
+	}
+	for _, sp := range c.GetServices() {
+		if sp.GetService() == "" {
+			return nil, fmt.Errorf("no service in policy: %v", sp)
+		}
+		if _, found := p.m[sp.GetService()]; found {
+			return nil, fmt.Errorf("duplicate policy for %q", sp.GetService())
+		}
+		policy, err := NewPolicy(sp)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %v", sp.GetService(), err)
+		}
+		p.m[sp.GetService()] = policy
+	}
+	return p, nil
+}
+
+// LoadPolicies loads Policies from text proto of rpc.PolicyConfig
+// in fname, e.g.
+//
+//	services {
+//	  service: "authdb"
+//	  timeout_msec: 3000
+//	  retry { max_attempts: 3 initial_backoff_msec: 100 }
+//	}
+func LoadPolicies(fname string) (*Policies, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	c := &rpcpb.PolicyConfig{}
+	err = prototext.Unmarshal(b, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	p, err := NewPolicies(c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return p, nil
+}
+
+// Policy returns policy for service.
+// It returns zero Policy (i.e. default of the caller) if p is nil or
+// no policy is configured for service.
+func (p *Policies) Policy(service string) Policy {
+	if p == nil {
+		return Policy{}
+	}
+	return p.m[service]
+}
+
+var defaultPolicies atomic.Value
+
+// SetPolicies sets p as Policies used by PolicyFor.
+// nil uses default of the callers.
+func SetPolicies(p *Policies) {
+	defaultPolicies.Store(p)
+}
+
+// PolicyFor returns policy for service set by SetPolicies.
+func PolicyFor(service string) Policy {
+	p, _ := defaultPolicies.Load().(*Policies)
+	return p.Policy(service)
+}
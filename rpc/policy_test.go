@@ -0,0 +1,118 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadPolicies(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "policy.textproto")
+	err := os.WriteFile(fname, []byte(`
+services {
+  service: "authdb"
+  timeout_msec: 5000
+  retry { max_attempts: 3 initial_backoff_msec: 100 }
+}
+services {
+  service: "remoteexec"
+  hedge_delay_msec: 2000
+  hedge_max_attempts: 3
+}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicies(fname)
+	if err != nil {
+		t.Fatalf("LoadPolicies(%q)=_, %v; want nil error", fname, err)
+	}
+	for _, tc := range []struct {
+		service string
+		want    Policy
+	}{
+		{
+			service: ServiceAuthDB,
+			want: Policy{
+				Timeout: 5 * time.Second,
+				Retry: &Retry{
+					MaxRetry:  3,
+					BaseDelay: 100 * time.Millisecond,
+				},
+			},
+		},
+		{
+			service: ServiceRemoteexec,
+			want: Policy{
+				Hedge: Hedge{
+					Delay:       2 * time.Second,
+					MaxAttempts: 3,
+				},
+			},
+		},
+		{
+			service: ServiceFile,
+			want:    Policy{},
+		},
+	} {
+		got := p.Policy(tc.service)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("Policy(%q) diff -want +got:\n%s", tc.service, diff)
+		}
+	}
+
+	for _, tc := range []string{
+		`services { timeout_msec: 1000 }`,
+		`services { service: "file" timeout_msec: -1 }`,
+		`services { service: "file" } services { service: "file" }`,
+		`services { service: "file" retry { retryable_codes: "NO_SUCH_CODE" } }`,
+		`service { service: "file" }`,
+	} {
+		fname := filepath.Join(dir, "bad.textproto")
+		err := os.WriteFile(fname, []byte(tc), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadPolicies(fname)
+		if err == nil {
+			t.Errorf("LoadPolicies(%s)=_, nil; want error", tc)
+		}
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	defer SetPolicies(nil)
+
+	if got := PolicyFor(ServiceAuthDB).TimeoutOr(3 * time.Second); got != 3*time.Second {
+		t.Errorf("TimeoutOr(3s) with no policies=%s; want 3s", got)
+	}
+	if got := PolicyFor(ServiceAuthDB).RetryOr(Retry{MaxRetry: 2}); got.MaxRetry != 2 {
+		t.Errorf("RetryOr(MaxRetry: 2) with no policies=%#v; want MaxRetry: 2", got)
+	}
+
+	SetPolicies(&Policies{
+		m: map[string]Policy{
+			ServiceAuthDB: {
+				Timeout: time.Second,
+				Retry:   &Retry{MaxRetry: 5},
+			},
+		},
+	})
+	if got := PolicyFor(ServiceAuthDB).TimeoutOr(3 * time.Second); got != time.Second {
+		t.Errorf("TimeoutOr(3s)=%s; want 1s", got)
+	}
+	if got := PolicyFor(ServiceAuthDB).RetryOr(Retry{MaxRetry: 2}); got.MaxRetry != 5 {
+		t.Errorf("RetryOr(MaxRetry: 2)=%#v; want MaxRetry: 5", got)
+	}
+	if got := PolicyFor(ServiceFile).TimeoutOr(3 * time.Second); got != 3*time.Second {
+		t.Errorf("TimeoutOr(3s) for %s=%s; want 3s", ServiceFile, got)
+	}
+}
@@ -35,6 +35,20 @@ type Retry struct {
 
 	// backoff factor. default is 1.6
 	Factor float64
+
+	// Jitter is jitter ratio of backoff. default is 0.2.
+	// Negative value disables jitter.
+	Jitter float64
+
+	// Codes are retriable grpc codes, if set.
+	// If empty, it retries codes.Unavailable, codes.ResourceExhausted
+	// and some transient errors.
+	Codes []codes.Code
+
+	// Breaker rejects calls to Target while its circuit is open,
+	// if set. Retry stops retrying when circuit is open.
+	Breaker *CircuitBreaker
+	Target  string
 }
 
 func (r Retry) retry() int {
@@ -65,7 +79,15 @@ func (r Retry) factor() float64 {
 	return r.Factor
 }
 
-func (r Retry) jitter() float64 { return 0.2 }
+func (r Retry) jitter() float64 {
+	switch {
+	case r.Jitter < 0:
+		return 0
+	case r.Jitter == 0:
+		return 0.2
+	}
+	return r.Jitter
+}
 
 func (r Retry) backoff(n int) time.Duration {
 	if n == 0 {
@@ -110,6 +132,10 @@ func retryInfo(ctx context.Context, err error) error {
 	if e, ok := err.(RetriableError); ok {
 		return e
 	}
+	if _, ok := err.(CircuitOpenError); ok {
+		// backend is down. fail fast.
+		return nil
+	}
 	if err == context.DeadlineExceeded && ctx.Err() == nil {
 		// f might used shorter deadline than ctx for Retry.Do.
 		// In this case, we could retry until ctx for Retry.Do
@@ -201,15 +227,46 @@ func retryInfo(ctx context.Context, err error) error {
 	}
 }
 
+// retryInfo returns retriable error for err if err is in r.Codes.
+// It returns default retryInfo if r.Codes is empty.
+func (r Retry) retryInfo(ctx context.Context, err error) error {
+	if len(r.Codes) == 0 {
+		return retryInfo(ctx, err)
+	}
+	switch err.(type) {
+	case RetriableError:
+		return err
+	case CircuitOpenError:
+		return nil
+	}
+	code := status.Code(err)
+	if err == context.DeadlineExceeded {
+		code = codes.DeadlineExceeded
+	}
+	for _, c := range r.Codes {
+		if c != code {
+			continue
+		}
+		if rerr := retryInfo(ctx, err); rerr != nil {
+			return rerr
+		}
+		return RetriableError{
+			Err: err,
+		}
+	}
+	return nil
+}
+
 var timeAfter = time.After
 
 // Do calls f with retry, while f returns RetriableError, codes.Unavailable or
-// codes.ResourceExhausted.
+// codes.ResourceExhausted, or codes in r.Codes if set.
 // It returns codes.DeadlineExceeded if ctx is cancelled.
 // It returns last error if f returns error other than codes.Unavailable or
 // codes.ResourceExhausted, or it reaches too many retries.
 // It respects RetriableError.Delay or errdetail RetryInfo
 // if it is specified as error details.
+// It returns CircuitOpenError without retry if r.Breaker rejects the call.
 func (r Retry) Do(ctx context.Context, f func() error) error {
 	ctx, span := trace.StartSpan(ctx, "go.chromium.org/goma/server/rpc.Retry.Do")
 	defer span.End()
@@ -241,14 +298,14 @@ func (r Retry) Do(ctx context.Context, f func() error) error {
 			break
 		}
 		t := time.Now()
-		err := f()
+		err := r.Breaker.Do(ctx, r.Target, f)
 		if err == nil {
 			return nil
 		}
 		d = append(d, time.Since(t))
 		errs = append(errs, err)
 
-		rerr, ok := retryInfo(ctx, err).(RetriableError)
+		rerr, ok := r.retryInfo(ctx, err).(RetriableError)
 		if !ok {
 			return toError(errs)
 		}
@@ -0,0 +1,51 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	rpcpb "go.chromium.org/goma/server/proto/rpc"
+)
+
+// NewRetry returns Retry configured by policy p.
+// Zero value fields in p use default of Retry.
+func NewRetry(p *rpcpb.RetryPolicy) (Retry, error) {
+	if p.GetMaxAttempts() < 0 || p.GetInitialBackoffMsec() < 0 || p.GetMaxBackoffMsec() < 0 || p.GetMultiplier() < 0 {
+		return Retry{}, fmt.Errorf("negative value in retry policy: %v", p)
+	}
+	r := Retry{
+		MaxRetry:  int(p.GetMaxAttempts()),
+		BaseDelay: time.Duration(p.GetInitialBackoffMsec()) * time.Millisecond,
+		MaxDelay:  time.Duration(p.GetMaxBackoffMsec()) * time.Millisecond,
+		Factor:    p.GetMultiplier(),
+		Jitter:    p.GetJitter(),
+	}
+	for _, name := range p.GetRetryableCodes() {
+		var c codes.Code
+		err := c.UnmarshalJSON([]byte(strconv.Quote(name)))
+		if err != nil {
+			return Retry{}, fmt.Errorf("retryable code %q: %v", name, err)
+		}
+		r.Codes = append(r.Codes, c)
+	}
+	return r, nil
+}
+
+// ParseRetryPolicy parses text proto of rpc.RetryPolicy, e.g. flag value,
+// and returns Retry configured by it.
+func ParseRetryPolicy(s string) (Retry, error) {
+	p := &rpcpb.RetryPolicy{}
+	err := prototext.Unmarshal([]byte(s), p)
+	if err != nil {
+		return Retry{}, err
+	}
+	return NewRetry(p)
+}
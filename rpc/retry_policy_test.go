@@ -0,0 +1,58 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy  string
+		want    Retry
+		wantErr bool
+	}{
+		{
+			policy: "",
+			want:   Retry{},
+		},
+		{
+			policy: `max_attempts: 3 initial_backoff_msec: 100 max_backoff_msec: 5000 multiplier: 2 jitter: -1 retryable_codes: "UNAVAILABLE" retryable_codes: "ABORTED"`,
+			want: Retry{
+				MaxRetry:  3,
+				BaseDelay: 100 * time.Millisecond,
+				MaxDelay:  5 * time.Second,
+				Factor:    2,
+				Jitter:    -1,
+				Codes:     []codes.Code{codes.Unavailable, codes.Aborted},
+			},
+		},
+		{
+			policy:  `retryable_codes: "NO_SUCH_CODE"`,
+			wantErr: true,
+		},
+		{
+			policy:  `max_attempts: -1`,
+			wantErr: true,
+		},
+		{
+			policy:  `max_attempt: 1`,
+			wantErr: true,
+		},
+	} {
+		got, err := ParseRetryPolicy(tc.policy)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseRetryPolicy(%q)=_, %v; want err=%t", tc.policy, err, tc.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("ParseRetryPolicy(%q) diff -want +got:\n%s", tc.policy, diff)
+		}
+	}
+}
@@ -184,6 +184,33 @@ func TestRetry(t *testing.T) {
 			wantN:   5,
 			wantErr: true,
 		},
+		{
+			desc: "retry with codes",
+			retry: Retry{
+				Codes: []codes.Code{codes.Aborted},
+			},
+			f: &retrySpy{
+				errs: []error{
+					status.Error(codes.Aborted, "aborted"),
+					nil,
+				},
+			},
+			wantN: 2,
+		},
+		{
+			desc: "no retry with code not in codes",
+			retry: Retry{
+				Codes: []codes.Code{codes.Aborted},
+			},
+			f: &retrySpy{
+				errs: []error{
+					status.Error(codes.Unavailable, "unavailable"),
+					nil,
+				},
+			},
+			wantN:   1,
+			wantErr: true,
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			ctx := context.Background()
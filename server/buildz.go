@@ -0,0 +1,137 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// BuildzPath is path to serve build info and config fingerprint
+// of the server in JSON.
+const BuildzPath = "/buildz"
+
+// Buildz is build info and config fingerprint of the server,
+// to audit fleet-wide consistency.
+type Buildz struct {
+	Server        string   `json:"server"`
+	GoVersion     string   `json:"go_version"`
+	Binary        string   `json:"binary,omitempty"`
+	ModuleVersion string   `json:"module_version,omitempty"`
+	Commit        string   `json:"commit,omitempty"`
+	CommitTime    string   `json:"commit_time,omitempty"`
+	Modified      bool     `json:"modified,omitempty"`
+	Features      []string `json:"features,omitempty"`
+
+	// ConfigHash is a hash of flags and config versions,
+	// so that servers with the same hash run with the same config.
+	// flag values are not shown, since they may contain secrets.
+	ConfigHash string `json:"config_hash"`
+}
+
+var (
+	featuresMu sync.Mutex
+	features   = map[string]bool{}
+)
+
+// EnableFeature records feature name is enabled in the server,
+// shown in BuildzPath.
+func EnableFeature(name string) {
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	features[name] = true
+}
+
+func enabledFeatures() []string {
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	var names []string
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configHash returns hash of flag values in fs and config versions.
+func configHash(fs *flag.FlagSet, configs map[string]string) string {
+	h := sha256.New()
+	fs.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "flag %s=%q\n", f.Name, f.Value.String())
+	})
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "config %s=%q\n", name, configs[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// newBuildz returns Buildz of the server name.
+func newBuildz(name string, bi *debug.BuildInfo, fs *flag.FlagSet, configs map[string]string) Buildz {
+	b := Buildz{
+		Server:     name,
+		GoVersion:  runtime.Version(),
+		Features:   enabledFeatures(),
+		ConfigHash: configHash(fs, configs),
+	}
+	if bi == nil {
+		return b
+	}
+	b.Binary = bi.Path
+	b.ModuleVersion = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Commit = s.Value
+		case "vcs.time":
+			b.CommitTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+func serveBuildz(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := log.FromContext(ctx)
+	bi, _ := debug.ReadBuildInfo()
+	defaultStatusz.mu.Lock()
+	name := defaultStatusz.name
+	configs := make(map[string]string, len(defaultStatusz.configs))
+	for k, v := range defaultStatusz.configs {
+		configs[k] = v
+	}
+	defaultStatusz.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(newBuildz(name, bi, flag.CommandLine, configs))
+	if err != nil {
+		logger.Errorf("buildz: %v", err)
+	}
+}
+
+var buildzOnce sync.Once
+
+// initBuildz sets up build info page.
+func initBuildz() {
+	buildzOnce.Do(func() {
+		http.HandleFunc(BuildzPath, serveBuildz)
+	})
+}
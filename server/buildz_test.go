@@ -0,0 +1,67 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"flag"
+	"runtime/debug"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewBuildz(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("addr", "localhost:5050", "")
+	fs.Int("port", 8080, "")
+	configs := map[string]string{
+		"toolchain": "20220401-v1",
+	}
+	bi := &debug.BuildInfo{
+		Path: "go.chromium.org/goma/server/cmd/exec_server",
+		Main: debug.Module{
+			Path:    "go.chromium.org/goma/server",
+			Version: "(devel)",
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef"},
+			{Key: "vcs.time", Value: "2022-04-01T00:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	EnableFeature("test-feature")
+
+	b := newBuildz("exec_server", bi, fs, configs)
+	want := Buildz{
+		Server:        "exec_server",
+		GoVersion:     b.GoVersion,
+		Binary:        "go.chromium.org/goma/server/cmd/exec_server",
+		ModuleVersion: "(devel)",
+		Commit:        "0123456789abcdef",
+		CommitTime:    "2022-04-01T00:00:00Z",
+		Modified:      true,
+		Features:      []string{"test-feature"},
+		ConfigHash:    b.ConfigHash,
+	}
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Errorf("newBuildz diff -want +got:\n%s", diff)
+	}
+
+	if got := newBuildz("exec_server", bi, fs, configs).ConfigHash; got != b.ConfigHash {
+		t.Errorf("ConfigHash=%q; want %q (same config)", got, b.ConfigHash)
+	}
+	err := fs.Set("port", "8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagHash := newBuildz("exec_server", bi, fs, configs).ConfigHash
+	if flagHash == b.ConfigHash {
+		t.Errorf("ConfigHash=%q; want different hash after flag change", flagHash)
+	}
+	configs["toolchain"] = "20220401-v2"
+	if got := newBuildz("exec_server", bi, fs, configs).ConfigHash; got == flagHash {
+		t.Errorf("ConfigHash=%q; want different hash after config change", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// ZstdCompressor is the name of zstd grpc compressor.
+// It is registered for both client and server side.
+const ZstdCompressor = "zstd"
+
+func init() {
+	encoding.RegisterCompressor(zstdCompressor{})
+}
+
+// CheckCompressor checks name is registered grpc compressor.
+// Empty name means no compression.
+func CheckCompressor(name string) error {
+	if name != "" && encoding.GetCompressor(name) == nil {
+		return fmt.Errorf("unknown grpc compressor %q", name)
+	}
+	return nil
+}
+
+var (
+	zstdEncoderPool sync.Pool
+	zstdDecoderPool sync.Pool
+)
+
+// zstdCompressor is grpc compressor with zstd.
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string { return ZstdCompressor }
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if v := zstdEncoderPool.Get(); v != nil {
+		enc := v.(*zstd.Encoder)
+		enc.Reset(w)
+		return zstdWriter{enc}, nil
+	}
+	enc, err := zstd.NewWriter(w,
+		zstd.WithEncoderLevel(zstd.SpeedFastest),
+		zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zstdWriter{enc}, nil
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	if v := zstdDecoderPool.Get(); v != nil {
+		dec := v.(*zstd.Decoder)
+		err := dec.Reset(r)
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{dec: dec}, nil
+	}
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{dec: dec}, nil
+}
+
+// zstdWriter returns encoder to the pool on Close.
+type zstdWriter struct {
+	*zstd.Encoder
+}
+
+func (w zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	zstdEncoderPool.Put(w.Encoder)
+	return err
+}
+
+// zstdReader returns decoder to the pool when it reaches EOF.
+type zstdReader struct {
+	dec *zstd.Decoder
+}
+
+func (r *zstdReader) Read(buf []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+	n, err := r.dec.Read(buf)
+	if err == io.EOF {
+		zstdDecoderPool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
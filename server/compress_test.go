@@ -0,0 +1,61 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+)
+
+func TestZstdCompressor(t *testing.T) {
+	c := encoding.GetCompressor(ZstdCompressor)
+	if c == nil {
+		t.Fatalf("GetCompressor(%q)=nil; want registered compressor", ZstdCompressor)
+	}
+	// run twice to use pooled encoder and decoder.
+	for i := 0; i < 2; i++ {
+		data := bytes.Repeat([]byte("goma zstd compressor "), 1024*(i+1))
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= len(data) {
+			t.Errorf("compressed size=%d; want < %d", buf.Len(), len(data))
+		}
+		r, err := c.Decompress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("decompress=%d bytes, %v; want %d bytes, nil", len(got), err, len(data))
+		}
+	}
+}
+
+func TestCheckCompressor(t *testing.T) {
+	for _, name := range []string{"", "gzip", ZstdCompressor} {
+		err := CheckCompressor(name)
+		if err != nil {
+			t.Errorf("CheckCompressor(%q)=%v; want nil", name, err)
+		}
+	}
+	err := CheckCompressor("unknown")
+	if err == nil {
+		t.Errorf("CheckCompressor(%q)=nil; want error", "unknown")
+	}
+}
@@ -37,9 +37,10 @@ var (
 
 // Init initializes opencensus instrumentations, and error reporter.
 // If projectID is not empty, it registers stackdriver exporter for the project.
-// It also calls SetupHTTPClient.
+// It also calls SetMaxProcs and SetupHTTPClient.
 func Init(ctx context.Context, projectID, name string) error {
 	logger := log.FromContext(ctx)
+	SetMaxProcs(ctx)
 	if projectID != "" {
 		logger.Infof("send stackdriver trace log to project %s", projectID)
 
@@ -87,6 +88,12 @@ func Init(ctx context.Context, projectID, name string) error {
 		return fmt.Errorf("failed to subscribe ochttp view: %v", err)
 	}
 	SetupHTTPClient()
+	initStatusz(ctx, name)
+	initBuildz()
+	err = initScalez()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe load view: %v", err)
+	}
 
 	err = view.Register(procStatViews...)
 	if err != nil {
@@ -110,6 +117,12 @@ func SetupHTTPClient() {
 
 // Flush flushes opencensus data.
 func Flush() {
+	otlpMu.Lock()
+	e := otlpExporter
+	otlpMu.Unlock()
+	if e != nil {
+		e.Flush(context.Background())
+	}
 	if exporter == nil {
 		return
 	}
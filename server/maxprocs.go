@@ -0,0 +1,149 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.chromium.org/goma/server/log"
+)
+
+var (
+	// cgroup v2 cpu controller.
+	cgroupCPUMax = "/sys/fs/cgroup/cpu.max"
+
+	// cgroup v1 cpu controller.
+	cgroupCFSQuota  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupCFSPeriod = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+)
+
+var (
+	maxProcsOnce   sync.Once
+	maxProcsSource string
+)
+
+// parseCPUMax parses content of cgroup v2 cpu.max,
+// i.e. "$MAX $PERIOD", and returns cpu quota in number of cpus.
+// It returns 0 if no quota is set.
+func parseCPUMax(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, fmt.Errorf("unexpected cpu.max: %q", s)
+	}
+	if fields[0] == "max" {
+		return 0, nil
+	}
+	period := "100000"
+	if len(fields) == 2 {
+		period = fields[1]
+	}
+	return cpuQuota(fields[0], period)
+}
+
+// cpuQuota returns quota/period in number of cpus.
+// It returns 0 if quota is not positive (i.e. -1 for no quota in cgroup v1).
+func cpuQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad cpu quota %q: %v", quota, err)
+	}
+	if q <= 0 {
+		return 0, nil
+	}
+	p, err := strconv.ParseInt(strings.TrimSpace(period), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad cpu period %q: %v", period, err)
+	}
+	if p <= 0 {
+		return 0, fmt.Errorf("bad cpu period %q", period)
+	}
+	return float64(q) / float64(p), nil
+}
+
+// cgroupCPUQuota returns cpu quota of the process's cgroup in number of cpus.
+// It returns 0 if no quota is set, or cgroup is not available.
+func cgroupCPUQuota() (float64, error) {
+	buf, err := ioutil.ReadFile(cgroupCPUMax)
+	if err == nil {
+		return parseCPUMax(string(buf))
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+	quota, err := ioutil.ReadFile(cgroupCFSQuota)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	period, err := ioutil.ReadFile(cgroupCFSPeriod)
+	if err != nil {
+		return 0, err
+	}
+	return cpuQuota(string(quota), string(period))
+}
+
+// maxProcsForQuota returns GOMAXPROCS for cpu quota.
+// Fraction of quota is rounded down to avoid throttling,
+// but it is at least 1.
+func maxProcsForQuota(quota float64) int {
+	n := int(math.Floor(quota))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// SetMaxProcs sets GOMAXPROCS to match cpu quota of cgroup,
+// so that the server won't be throttled by CFS on cpu limited pods,
+// where runtime.NumCPU reports cpus of the node, not the limit.
+// It respects GOMAXPROCS environment variable if set.
+// It is called by Init, and only the first call takes effect.
+func SetMaxProcs(ctx context.Context) {
+	maxProcsOnce.Do(func() {
+		maxProcsSource = setMaxProcs(ctx)
+	})
+}
+
+// maxProcsBy returns how GOMAXPROCS was set, shown in status page.
+func maxProcsBy() string {
+	if maxProcsSource == "" {
+		return "default"
+	}
+	return maxProcsSource
+}
+
+func setMaxProcs(ctx context.Context) string {
+	logger := log.FromContext(ctx)
+	if v, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		logger.Infof("GOMAXPROCS=%d: set by env GOMAXPROCS=%q", runtime.GOMAXPROCS(0), v)
+		return "env"
+	}
+	quota, err := cgroupCPUQuota()
+	if err != nil {
+		logger.Warnf("failed to get cgroup cpu quota: %v", err)
+		return "default"
+	}
+	if quota == 0 {
+		logger.Infof("GOMAXPROCS=%d: no cgroup cpu quota", runtime.GOMAXPROCS(0))
+		return "default"
+	}
+	n := maxProcsForQuota(quota)
+	if n > runtime.NumCPU() {
+		n = runtime.NumCPU()
+	}
+	prev := runtime.GOMAXPROCS(n)
+	logger.Infof("GOMAXPROCS=%d (was %d): cgroup cpu quota=%g", n, prev, quota)
+	return fmt.Sprintf("cgroup cpu quota %g", quota)
+}
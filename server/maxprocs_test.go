@@ -0,0 +1,96 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCPUMax(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "max 100000\n", want: 0},
+		{in: "200000 100000\n", want: 2},
+		{in: "150000 100000\n", want: 1.5},
+		{in: "50000\n", want: 0.5},
+		{in: "", wantErr: true},
+		{in: "foo 100000", wantErr: true},
+		{in: "100000 0", wantErr: true},
+	} {
+		got, err := parseCPUMax(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseCPUMax(%q)=%g, nil; want error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseCPUMax(%q)=%g, %v; want %g, nil", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestCgroupCPUQuota(t *testing.T) {
+	defer func(cpuMax, quota, period string) {
+		cgroupCPUMax, cgroupCFSQuota, cgroupCFSPeriod = cpuMax, quota, period
+	}(cgroupCPUMax, cgroupCFSQuota, cgroupCFSPeriod)
+
+	dir := t.TempDir()
+	cgroupCPUMax = filepath.Join(dir, "cpu.max")
+	cgroupCFSQuota = filepath.Join(dir, "cpu.cfs_quota_us")
+	cgroupCFSPeriod = filepath.Join(dir, "cpu.cfs_period_us")
+	writeFile := func(fname, content string) {
+		t.Helper()
+		err := ioutil.WriteFile(fname, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := cgroupCPUQuota()
+	if err != nil || got != 0 {
+		t.Errorf("cgroupCPUQuota()=%g, %v; want 0, nil for no cgroup", got, err)
+	}
+
+	writeFile(cgroupCFSQuota, "-1\n")
+	writeFile(cgroupCFSPeriod, "100000\n")
+	got, err = cgroupCPUQuota()
+	if err != nil || got != 0 {
+		t.Errorf("cgroupCPUQuota()=%g, %v; want 0, nil for v1 no quota", got, err)
+	}
+
+	writeFile(cgroupCFSQuota, "400000\n")
+	got, err = cgroupCPUQuota()
+	if err != nil || got != 4 {
+		t.Errorf("cgroupCPUQuota()=%g, %v; want 4, nil for v1", got, err)
+	}
+
+	writeFile(cgroupCPUMax, "250000 100000\n")
+	got, err = cgroupCPUQuota()
+	if err != nil || got != 2.5 {
+		t.Errorf("cgroupCPUQuota()=%g, %v; want 2.5, nil for v2", got, err)
+	}
+}
+
+func TestMaxProcsForQuota(t *testing.T) {
+	for _, tc := range []struct {
+		quota float64
+		want  int
+	}{
+		{quota: 0.5, want: 1},
+		{quota: 1, want: 1},
+		{quota: 2.5, want: 2},
+		{quota: 8, want: 8},
+	} {
+		if got := maxProcsForQuota(tc.quota); got != tc.want {
+			t.Errorf("maxProcsForQuota(%g)=%d; want %d", tc.quota, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// OpenTelemetry protocol (OTLP) export.
+//
+// Instrumentations in goma server are written with opencensus.
+// otlpExporter bridges them to OpenTelemetry: it receives spans and
+// views as opencensus exporter, converts them to OTLP JSON encoding,
+// and sends them to OTLP/HTTP endpoint (e.g. OpenTelemetry collector,
+// Jaeger or Tempo).
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+
+const (
+	otlpTracesPath  = "/v1/traces"
+	otlpMetricsPath = "/v1/metrics"
+
+	// otlpFlushInterval is interval to send batched spans.
+	otlpFlushInterval = 5 * time.Second
+	// otlpMaxBatch is number of spans to send at once.
+	otlpMaxBatch = 512
+	// otlpMaxQueue is maximum number of queued spans.
+	// spans are dropped if the queue is full, e.g. endpoint is slow.
+	otlpMaxQueue = 8192
+	// otlpMaxMetrics is maximum number of queued metrics.
+	// metrics are cumulative, so only the latest data of each view
+	// is queued, and it is bounded by the number of views.
+	otlpMaxMetrics = 1024
+)
+
+var (
+	otlpMu       sync.Mutex
+	otlpExporter *otlpExporterImpl
+)
+
+// ExportOTLP exports opencensus traces and views to OTLP/HTTP endpoint,
+// e.g. "http://otel-collector:4318".
+// headers is comma separated key=value pairs sent as http headers,
+// in the same format as OTEL_EXPORTER_OTLP_HEADERS.
+// Empty endpoint does nothing.
+// Trace sampling is configured by trace.ApplyConfig, see TraceSampler.
+func ExportOTLP(ctx context.Context, name, endpoint, headers string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("bad otlp endpoint %q: %v", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("bad otlp endpoint %q: scheme must be http or https", endpoint)
+	}
+	h, err := parseOTLPHeaders(headers)
+	if err != nil {
+		return err
+	}
+	logger := log.FromContext(ctx)
+	logger.Infof("export traces and metrics to otlp endpoint %s", endpoint)
+	e := &otlpExporterImpl{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		headers:  h,
+		resource: otlpResource(ctx, name),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		flushc: make(chan struct{}, 1),
+	}
+	go e.run(context.Background())
+	trace.RegisterExporter(e)
+	view.RegisterExporter(e)
+	view.SetReportingPeriod(reportingInterval)
+	otlpMu.Lock()
+	otlpExporter = e
+	otlpMu.Unlock()
+	return nil
+}
+
+// parseOTLPHeaders parses "k1=v1,k2=v2".
+// values may be url encoded.
+func parseOTLPHeaders(s string) (http.Header, error) {
+	h := make(http.Header)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("bad otlp header %q: want key=value", kv)
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(kv[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("bad otlp header %q: %v", kv, err)
+		}
+		h.Add(strings.TrimSpace(kv[:i]), v)
+	}
+	return h, nil
+}
+
+// TraceSampler returns trace sampler limited by fraction and qps.
+// If OTEL_TRACES_SAMPLER_ARG environment variable is set, it is used
+// as fraction instead.
+func TraceSampler(fraction, qps float64) trace.Sampler {
+	if s := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil && f >= 0 && f <= 1 {
+			fraction = f
+		}
+	}
+	return NewLimitedSampler(fraction, qps)
+}
+
+// otlp JSON encoding.
+// https://github.com/open-telemetry/opentelemetry-proto/tree/main/opentelemetry/proto
+// 64 bit integers are encoded as decimal strings, and trace/span ids
+// are encoded as hex strings.
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpResourceAttrs struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue  `json:"attributes,omitempty"`
+	Events            []otlpSpanEvent `json:"events,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpSpanEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpTracesReq struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResourceAttrs `json:"resource"`
+	ScopeSpans []otlpScopeSpans  `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpMetricsReq struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResourceAttrs  `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Unit        string         `json:"unit,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+// aggregation temporality cumulative.
+const otlpCumulative = 2
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsInt             *string        `json:"asInt,omitempty"`
+	AsDouble          *float64       `json:"asDouble,omitempty"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttr(key string, v interface{}) otlpKeyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpString(key, v)
+	case bool:
+		return otlpKeyValue{Key: key, Value: otlpValue{BoolValue: &v}}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpKeyValue{Key: key, Value: otlpValue{IntValue: &s}}
+	case float64:
+		return otlpKeyValue{Key: key, Value: otlpValue{DoubleValue: &v}}
+	default:
+		return otlpString(key, fmt.Sprint(v))
+	}
+}
+
+func otlpAttrs(attrs map[string]interface{}) []otlpKeyValue {
+	var kvs []otlpKeyValue
+	for k, v := range attrs {
+		kvs = append(kvs, otlpAttr(k, v))
+	}
+	return kvs
+}
+
+func otlpResource(ctx context.Context, name string) otlpResourceAttrs {
+	return otlpResourceAttrs{
+		Attributes: []otlpKeyValue{
+			otlpString("service.name", name),
+			otlpString("service.instance.id", HostName(ctx)),
+		},
+	}
+}
+
+// otlpSpanFromSpanData converts opencensus span to otlp span.
+func otlpSpanFromSpanData(sd *trace.SpanData) otlpSpan {
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(sd.TraceID[:]),
+		SpanID:            hex.EncodeToString(sd.SpanID[:]),
+		Name:              sd.Name,
+		StartTimeUnixNano: otlpTime(sd.StartTime),
+		EndTimeUnixNano:   otlpTime(sd.EndTime),
+		Attributes:        otlpAttrs(sd.Attributes),
+	}
+	if sd.ParentSpanID != (trace.SpanID{}) {
+		s.ParentSpanID = hex.EncodeToString(sd.ParentSpanID[:])
+	}
+	switch sd.SpanKind {
+	case trace.SpanKindServer:
+		s.Kind = 2
+	case trace.SpanKindClient:
+		s.Kind = 3
+	default:
+		// internal.
+		s.Kind = 1
+	}
+	for _, a := range sd.Annotations {
+		s.Events = append(s.Events, otlpSpanEvent{
+			TimeUnixNano: otlpTime(a.Time),
+			Name:         a.Message,
+			Attributes:   otlpAttrs(a.Attributes),
+		})
+	}
+	if sd.Code != 0 {
+		// opencensus uses grpc status code.
+		s.Status = otlpStatus{
+			Code:    2, // error
+			Message: sd.Message,
+		}
+	}
+	return s
+}
+
+// otlpMetricFromViewData converts opencensus view data to otlp metric.
+func otlpMetricFromViewData(vd *view.Data) (otlpMetric, bool) {
+	v := vd.View
+	m := otlpMetric{
+		Name:        v.Name,
+		Description: v.Description,
+		Unit:        v.Measure.Unit(),
+	}
+	start := otlpTime(vd.Start)
+	end := otlpTime(vd.End)
+	var numbers []otlpNumberDataPoint
+	for _, row := range vd.Rows {
+		var attrs []otlpKeyValue
+		for _, t := range row.Tags {
+			attrs = append(attrs, otlpString(t.Key.Name(), t.Value))
+		}
+		switch d := row.Data.(type) {
+		case *view.CountData:
+			s := strconv.FormatInt(d.Value, 10)
+			numbers = append(numbers, otlpNumberDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				AsInt:             &s,
+			})
+		case *view.SumData:
+			val := d.Value
+			numbers = append(numbers, otlpNumberDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				AsDouble:          &val,
+			})
+		case *view.LastValueData:
+			val := d.Value
+			numbers = append(numbers, otlpNumberDataPoint{
+				Attributes:   attrs,
+				TimeUnixNano: end,
+				AsDouble:     &val,
+			})
+		case *view.DistributionData:
+			if m.Histogram == nil {
+				m.Histogram = &otlpHistogram{
+					AggregationTemporality: otlpCumulative,
+				}
+			}
+			dp := otlpHistogramDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				Count:             strconv.FormatInt(d.Count, 10),
+				Sum:               d.Mean * float64(d.Count),
+				ExplicitBounds:    v.Aggregation.Buckets,
+			}
+			for _, c := range d.CountPerBucket {
+				dp.BucketCounts = append(dp.BucketCounts, strconv.FormatInt(c, 10))
+			}
+			m.Histogram.DataPoints = append(m.Histogram.DataPoints, dp)
+		}
+	}
+	switch v.Aggregation.Type {
+	case view.AggTypeCount, view.AggTypeSum:
+		m.Sum = &otlpSum{
+			DataPoints:             numbers,
+			AggregationTemporality: otlpCumulative,
+			// sum may decrease, e.g. number of running operations.
+			IsMonotonic: v.Aggregation.Type == view.AggTypeCount,
+		}
+	case view.AggTypeLastValue:
+		m.Gauge = &otlpGauge{
+			DataPoints: numbers,
+		}
+	case view.AggTypeDistribution:
+	default:
+		return m, false
+	}
+	if m.Histogram == nil && len(numbers) == 0 {
+		return m, false
+	}
+	return m, true
+}
+
+// otlpExporterImpl is opencensus trace and view exporter to send
+// them to otlp endpoint.
+type otlpExporterImpl struct {
+	endpoint string
+	headers  http.Header
+	resource otlpResourceAttrs
+	client   *http.Client
+
+	flushc chan struct{}
+
+	mu      sync.Mutex
+	spans   []otlpSpan
+	metrics map[string]otlpMetric // view name -> latest metric
+	dropped int
+
+	droppedMetrics int
+}
+
+// ExportSpan queues sd to send.
+func (e *otlpExporterImpl) ExportSpan(sd *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.spans) >= otlpMaxQueue {
+		e.dropped++
+		return
+	}
+	e.spans = append(e.spans, otlpSpanFromSpanData(sd))
+	if len(e.spans) >= otlpMaxBatch {
+		select {
+		case e.flushc <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ExportView queues vd to send.
+// It replaces queued data of the same view, since data is cumulative.
+func (e *otlpExporterImpl) ExportView(vd *view.Data) {
+	m, ok := otlpMetricFromViewData(vd)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.metrics == nil {
+		e.metrics = make(map[string]otlpMetric)
+	}
+	if _, ok := e.metrics[m.Name]; !ok && len(e.metrics) >= otlpMaxMetrics {
+		e.droppedMetrics++
+		return
+	}
+	e.metrics[m.Name] = m
+}
+
+func (e *otlpExporterImpl) run(ctx context.Context) {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.flushc:
+		}
+		e.Flush(ctx)
+	}
+}
+
+// Flush sends queued spans and metrics.
+func (e *otlpExporterImpl) Flush(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	e.mu.Lock()
+	spans := e.spans
+	metrics := make([]otlpMetric, 0, len(e.metrics))
+	for _, m := range e.metrics {
+		metrics = append(metrics, m)
+	}
+	dropped := e.dropped
+	droppedMetrics := e.droppedMetrics
+	e.spans = nil
+	e.metrics = nil
+	e.dropped = 0
+	e.droppedMetrics = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		logger.Warnf("otlp: dropped %d spans: queue full", dropped)
+	}
+	if droppedMetrics > 0 {
+		logger.Warnf("otlp: dropped %d metrics: queue full", droppedMetrics)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	for len(spans) > 0 {
+		n := len(spans)
+		if n > otlpMaxBatch {
+			n = otlpMaxBatch
+		}
+		err := e.send(ctx, otlpTracesPath, otlpTracesReq{
+			ResourceSpans: []otlpResourceSpans{
+				{
+					Resource: e.resource,
+					ScopeSpans: []otlpScopeSpans{
+						{
+							Scope: otlpScope{Name: "go.opencensus.io"},
+							Spans: spans[:n],
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			logger.Warnf("otlp: failed to send %d spans: %v", n, err)
+		}
+		spans = spans[n:]
+	}
+	if len(metrics) > 0 {
+		err := e.send(ctx, otlpMetricsPath, otlpMetricsReq{
+			ResourceMetrics: []otlpResourceMetrics{
+				{
+					Resource: e.resource,
+					ScopeMetrics: []otlpScopeMetrics{
+						{
+							Scope:   otlpScope{Name: "go.opencensus.io"},
+							Metrics: metrics,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			logger.Warnf("otlp: failed to send %d metrics: %v", len(metrics), err)
+		}
+	}
+}
+
+func (e *otlpExporterImpl) send(ctx context.Context, path string, msg interface{}) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s%s: %s", e.endpoint, path, resp.Status)
+	}
+	return nil
+}
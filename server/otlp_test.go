@@ -0,0 +1,195 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+func TestParseOTLPHeaders(t *testing.T) {
+	h, err := parseOTLPHeaders("api-key=secret, x-scope-orgid = tenant%201,")
+	if err != nil {
+		t.Fatalf("parseOTLPHeaders=_, %v; want nil err", err)
+	}
+	if got, want := h.Get("Api-Key"), "secret"; got != want {
+		t.Errorf("api-key=%q; want %q", got, want)
+	}
+	if got, want := h.Get("X-Scope-Orgid"), "tenant 1"; got != want {
+		t.Errorf("x-scope-orgid=%q; want %q", got, want)
+	}
+	_, err = parseOTLPHeaders("novalue")
+	if err == nil {
+		t.Errorf("parseOTLPHeaders(novalue)=_, nil; want error")
+	}
+}
+
+func TestOTLPSpanFromSpanData(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	sd := &trace.SpanData{
+		SpanContext: trace.SpanContext{
+			TraceID: trace.TraceID{0x01, 0x02, 15: 0xff},
+			SpanID:  trace.SpanID{0x0a, 7: 0x0b},
+		},
+		ParentSpanID: trace.SpanID{0x0c},
+		SpanKind:     trace.SpanKindServer,
+		Name:         "go.chromium.org/goma/server/test",
+		StartTime:    start,
+		EndTime:      start.Add(time.Second),
+		Attributes: map[string]interface{}{
+			"size": int64(42),
+		},
+		Status: trace.Status{
+			Code:    5,
+			Message: "not found",
+		},
+	}
+	got := otlpSpanFromSpanData(sd)
+	size := "42"
+	want := otlpSpan{
+		TraceID:           "010200000000000000000000000000ff",
+		SpanID:            "0a0000000000000b",
+		ParentSpanID:      "0c00000000000000",
+		Name:              "go.chromium.org/goma/server/test",
+		Kind:              2,
+		StartTimeUnixNano: "1600000000000000000",
+		EndTimeUnixNano:   "1600000001000000000",
+		Attributes: []otlpKeyValue{
+			{Key: "size", Value: otlpValue{IntValue: &size}},
+		},
+		Status: otlpStatus{
+			Code:    2,
+			Message: "not found",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("otlpSpanFromSpanData(sd) diff -want +got:\n%s", diff)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	reqs := map[string][]byte{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Errorf("read %s: %v", req.URL.Path, err)
+		}
+		if got, want := req.Header.Get("Api-Key"), "secret"; got != want {
+			t.Errorf("%s api-key=%q; want %q", req.URL.Path, got, want)
+		}
+		mu.Lock()
+		reqs[req.URL.Path] = b
+		mu.Unlock()
+	}))
+	defer s.Close()
+
+	h, err := parseOTLPHeaders("api-key=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &otlpExporterImpl{
+		endpoint: s.URL,
+		headers:  h,
+		resource: otlpResource(ctx, "test"),
+		client:   s.Client(),
+		flushc:   make(chan struct{}, 1),
+	}
+	e.ExportSpan(&trace.SpanData{
+		Name:      "test-span",
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+	})
+
+	m := stats.Int64("go.chromium.org/goma/server/server.otlp_test", "otlp test", stats.UnitMilliseconds)
+	key := tag.MustNewKey("op")
+	v := &view.View{
+		Name:        "go.chromium.org/goma/server/server.otlp_test_latency",
+		Description: "otlp test latency",
+		TagKeys:     []tag.Key{key},
+		Measure:     m,
+		Aggregation: view.Distribution(10, 100),
+	}
+	// older data of the same view is replaced.
+	e.ExportView(&view.Data{
+		View:  v,
+		Start: time.Now(),
+		End:   time.Now(),
+		Rows: []*view.Row{
+			{
+				Tags: []tag.Tag{{Key: key, Value: "get"}},
+				Data: &view.DistributionData{
+					Count:          1,
+					Mean:           5,
+					CountPerBucket: []int64{1, 0, 0},
+				},
+			},
+		},
+	})
+	e.ExportView(&view.Data{
+		View:  v,
+		Start: time.Now(),
+		End:   time.Now(),
+		Rows: []*view.Row{
+			{
+				Tags: []tag.Tag{{Key: key, Value: "get"}},
+				Data: &view.DistributionData{
+					Count:          3,
+					Mean:           185,
+					CountPerBucket: []int64{1, 1, 1},
+				},
+			},
+		},
+	})
+	e.Flush(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var traces otlpTracesReq
+	err = json.Unmarshal(reqs[otlpTracesPath], &traces)
+	if err != nil {
+		t.Fatalf("unmarshal traces %q: %v", reqs[otlpTracesPath], err)
+	}
+	if len(traces.ResourceSpans) != 1 || len(traces.ResourceSpans[0].ScopeSpans) != 1 || len(traces.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("traces=%q; want 1 span", reqs[otlpTracesPath])
+	}
+	if got, want := traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Name, "test-span"; got != want {
+		t.Errorf("span name=%q; want %q", got, want)
+	}
+
+	var metrics otlpMetricsReq
+	err = json.Unmarshal(reqs[otlpMetricsPath], &metrics)
+	if err != nil {
+		t.Fatalf("unmarshal metrics %q: %v", reqs[otlpMetricsPath], err)
+	}
+	if len(metrics.ResourceMetrics) != 1 || len(metrics.ResourceMetrics[0].ScopeMetrics) != 1 || len(metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics) != 1 {
+		t.Fatalf("metrics=%q; want 1 metric", reqs[otlpMetricsPath])
+	}
+	hist := metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Histogram
+	if hist == nil || len(hist.DataPoints) != 1 {
+		t.Fatalf("metrics=%q; want histogram with 1 data point", reqs[otlpMetricsPath])
+	}
+	dp := hist.DataPoints[0]
+	if dp.Count != "3" || dp.Sum != 555 {
+		t.Errorf("data point count=%s sum=%v; want count=3 sum=555", dp.Count, dp.Sum)
+	}
+	if diff := cmp.Diff([]string{"1", "1", "1"}, dp.BucketCounts); diff != "" {
+		t.Errorf("bucket counts diff -want +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/stats/view"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// MetricsPath is path to serve metrics in Prometheus text format.
+const MetricsPath = "/metrics"
+
+// ExportMetrics exports opencensus views in the format.
+// "prometheus" serves all views in Prometheus text exposition format
+// on MetricsPath of http.DefaultServeMux (i.e. monitoring port).
+// Empty format does nothing.
+func ExportMetrics(ctx context.Context, format string) error {
+	switch format {
+	case "":
+		return nil
+	case "prometheus":
+		logger := log.FromContext(ctx)
+		logger.Infof("export metrics in prometheus format on %s", MetricsPath)
+		e := &prometheusExporter{}
+		view.RegisterExporter(e)
+		http.Handle(MetricsPath, e)
+		return nil
+	default:
+		return fmt.Errorf("unknown metrics format %q", format)
+	}
+}
+
+// prometheusExporter is a view exporter to serve views in Prometheus
+// text exposition format.
+// It collects views by ExportView, and retrieves the latest data of
+// the views when it is scraped.
+type prometheusExporter struct {
+	mu    sync.Mutex
+	views map[string]*view.View
+}
+
+// ExportView records the view to serve.
+func (e *prometheusExporter) ExportView(vd *view.Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.views == nil {
+		e.views = make(map[string]*view.View)
+	}
+	e.views[vd.View.Name] = vd.View
+}
+
+func (e *prometheusExporter) viewList() []*view.View {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	views := make([]*view.View, 0, len(e.views))
+	for _, v := range e.views {
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	return views
+}
+
+func (e *prometheusExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, v := range e.viewList() {
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			// view has been unregistered.
+			continue
+		}
+		writePrometheusView(bw, v, rows)
+	}
+	bw.Flush()
+}
+
+// prometheusName sanitizes name as Prometheus metric or label name.
+func prometheusName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabels formats labels of row, with extra label if not empty.
+func prometheusLabels(row *view.Row, extra ...string) string {
+	var labels []string
+	for _, t := range row.Tags {
+		labels = append(labels, prometheusName(t.Key.Name())+`="`+labelValueEscaper.Replace(t.Value)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels = append(labels, extra[i]+`="`+extra[i+1]+`"`)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writePrometheusView(w io.Writer, v *view.View, rows []*view.Row) {
+	name := prometheusName(v.Name)
+	var typ string
+	switch v.Aggregation.Type {
+	case view.AggTypeCount, view.AggTypeSum:
+		typ = "counter"
+	case view.AggTypeLastValue:
+		typ = "gauge"
+	case view.AggTypeDistribution:
+		typ = "histogram"
+	default:
+		typ = "untyped"
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(v.Description, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	for _, row := range rows {
+		switch d := row.Data.(type) {
+		case *view.CountData:
+			fmt.Fprintf(w, "%s%s %d\n", name, prometheusLabels(row), d.Value)
+		case *view.SumData:
+			fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(row), formatFloat(d.Value))
+		case *view.LastValueData:
+			fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(row), formatFloat(d.Value))
+		case *view.DistributionData:
+			var cum int64
+			for i, b := range v.Aggregation.Buckets {
+				if i < len(d.CountPerBucket) {
+					cum += d.CountPerBucket[i]
+				}
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(row, "le", formatFloat(b)), cum)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(row, "le", "+Inf"), d.Count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, prometheusLabels(row), formatFloat(d.Mean*float64(d.Count)))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, prometheusLabels(row), d.Count)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestPrometheusExporter(t *testing.T) {
+	ctx := context.Background()
+	m := stats.Int64("go.chromium.org/goma/server/server.test_latency", "test latency", stats.UnitMilliseconds)
+	key := tag.MustNewKey("op")
+	views := []*view.View{
+		{
+			Name:        "go.chromium.org/goma/server/server.test_count",
+			Description: "test count",
+			TagKeys:     []tag.Key{key},
+			Measure:     m,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        "go.chromium.org/goma/server/server.test_latency",
+			Description: "test latency",
+			Measure:     m,
+			Aggregation: view.Distribution(10, 100),
+		},
+	}
+	err := view.Register(views...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(views...)
+
+	for _, v := range []int64{5, 50, 500} {
+		err = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(key, `a"b`)}, m.M(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &prometheusExporter{}
+	for _, v := range views {
+		e.ExportView(&view.Data{View: v})
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", MetricsPath, nil))
+	got := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE go_chromium_org_goma_server_server_test_count counter\n",
+		`go_chromium_org_goma_server_server_test_count{op="a\"b"} 3` + "\n",
+		"# TYPE go_chromium_org_goma_server_server_test_latency histogram\n",
+		`go_chromium_org_goma_server_server_test_latency_bucket{le="10"} 1` + "\n",
+		`go_chromium_org_goma_server_server_test_latency_bucket{le="100"} 2` + "\n",
+		`go_chromium_org_goma_server_server_test_latency_bucket{le="+Inf"} 3` + "\n",
+		"go_chromium_org_goma_server_server_test_latency_sum 555\n",
+		"go_chromium_org_goma_server_server_test_latency_count 3\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics doesn't contain %q\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// ScalezPath is path to serve autoscaling signals of the server in JSON.
+//
+// Response is Scalez, e.g.
+//
+//	{
+//	  "server": "exec_server",
+//	  "loads": {
+//	    "exec": {
+//	      "inflight": 120,
+//	      "queue_depth": 8,
+//	      "admission_rejections_per_second": 0.5
+//	    }
+//	  }
+//	}
+//
+// inflight and queue_depth are current values, and
+// admission_rejections_per_second is averaged over the last minute.
+// The same signals are exported as metrics tagged by "path"
+// (see loadViews), so that HorizontalPodAutoscaler can scale
+// on custom metrics, e.g. average inflight per pod, rather than CPU alone.
+const ScalezPath = "/scalez"
+
+// Load paths to report autoscaling signals.
+const (
+	// LoadFrontend is http requests in frontend.
+	LoadFrontend = "frontend"
+
+	// LoadExec is exec requests in exec server.
+	LoadExec = "exec"
+
+	// LoadFile is file requests in file server.
+	LoadFile = "file"
+)
+
+const (
+	// scalezWindow is window in seconds to calculate rejections per second.
+	scalezWindow = 60
+)
+
+var (
+	loadPathKey = tag.MustNewKey("path")
+
+	inflightRequests = stats.Int64("go.chromium.org/goma/server/server/inflight-requests",
+		"Number of in-flight requests",
+		stats.UnitDimensionless)
+	queueDepth = stats.Int64("go.chromium.org/goma/server/server/queue-depth",
+		"Number of requests waiting in queue",
+		stats.UnitDimensionless)
+	admissionRejections = stats.Int64("go.chromium.org/goma/server/server/admission-rejections",
+		"Number of requests rejected by admission control",
+		stats.UnitDimensionless)
+	admissionRejectionRate = stats.Float64("go.chromium.org/goma/server/server/admission-rejections-per-second",
+		"Admission rejections per second in the last minute",
+		stats.UnitDimensionless)
+
+	loadViews = []*view.View{
+		{
+			Name:        "go.chromium.org/goma/server/server/inflight-requests",
+			Description: "Number of in-flight requests",
+			TagKeys:     []tag.Key{loadPathKey},
+			Measure:     inflightRequests,
+			Aggregation: view.LastValue(),
+		},
+		{
+			Name:        "go.chromium.org/goma/server/server/queue-depth",
+			Description: "Number of requests waiting in queue",
+			TagKeys:     []tag.Key{loadPathKey},
+			Measure:     queueDepth,
+			Aggregation: view.LastValue(),
+		},
+		{
+			Name:        "go.chromium.org/goma/server/server/admission-rejections",
+			Description: "Number of requests rejected by admission control",
+			TagKeys:     []tag.Key{loadPathKey},
+			Measure:     admissionRejections,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        "go.chromium.org/goma/server/server/admission-rejections-per-second",
+			Description: "Admission rejections per second in the last minute",
+			TagKeys:     []tag.Key{loadPathKey},
+			Measure:     admissionRejectionRate,
+			Aggregation: view.LastValue(),
+		},
+	}
+)
+
+// Scalez is autoscaling signals of the server.
+type Scalez struct {
+	Server string                 `json:"server"`
+	Loads  map[string]LoadSignals `json:"loads"`
+}
+
+// LoadSignals is autoscaling signals of a load path.
+type LoadSignals struct {
+	Inflight                     int64   `json:"inflight"`
+	QueueDepth                   int64   `json:"queue_depth"`
+	AdmissionRejectionsPerSecond float64 `json:"admission_rejections_per_second"`
+}
+
+// loadStats tracks load of a path.
+type loadStats struct {
+	inflight int64 // atomic.
+	queued   int64 // atomic.
+
+	mu sync.Mutex
+	// rejects[i] is number of rejections in rejectSecs[i] (unix time),
+	// where i = rejectSecs[i] % scalezWindow.
+	rejects    [scalezWindow]int64
+	rejectSecs [scalezWindow]int64
+}
+
+func (l *loadStats) reject(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sec := now.Unix()
+	i := sec % scalezWindow
+	if l.rejectSecs[i] != sec {
+		l.rejectSecs[i] = sec
+		l.rejects[i] = 0
+	}
+	l.rejects[i]++
+}
+
+// rejectRate returns rejections per second in the last scalezWindow seconds.
+func (l *loadStats) rejectRate(now time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sec := now.Unix()
+	var n int64
+	for i := range l.rejects {
+		if sec-l.rejectSecs[i] < scalezWindow {
+			n += l.rejects[i]
+		}
+	}
+	return float64(n) / scalezWindow
+}
+
+func (l *loadStats) signals(now time.Time) LoadSignals {
+	return LoadSignals{
+		Inflight:                     atomic.LoadInt64(&l.inflight),
+		QueueDepth:                   atomic.LoadInt64(&l.queued),
+		AdmissionRejectionsPerSecond: l.rejectRate(now),
+	}
+}
+
+var (
+	loadsMu sync.Mutex
+	loads   = map[string]*loadStats{}
+)
+
+func loadFor(path string) *loadStats {
+	loadsMu.Lock()
+	defer loadsMu.Unlock()
+	l, ok := loads[path]
+	if !ok {
+		l = &loadStats{}
+		loads[path] = l
+	}
+	return l
+}
+
+// LoadStart records a request of path starts, and returns a func to
+// call when the request finishes.
+func LoadStart(ctx context.Context, path string) func() {
+	l := loadFor(path)
+	atomic.AddInt64(&l.inflight, 1)
+	return func() {
+		atomic.AddInt64(&l.inflight, -1)
+	}
+}
+
+// LoadQueue records a request of path is waiting in queue, and returns
+// a func to call when the request leaves the queue.
+func LoadQueue(ctx context.Context, path string) func() {
+	l := loadFor(path)
+	atomic.AddInt64(&l.queued, 1)
+	return func() {
+		atomic.AddInt64(&l.queued, -1)
+	}
+}
+
+// LoadReject records a request of path is rejected by admission control.
+func LoadReject(ctx context.Context, path string) {
+	loadFor(path).reject(time.Now())
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(loadPathKey, path),
+	}, admissionRejections.M(1))
+}
+
+// loadSignals returns signals per load path.
+func loadSignals(now time.Time) map[string]LoadSignals {
+	loadsMu.Lock()
+	paths := make([]string, 0, len(loads))
+	ls := make([]*loadStats, 0, len(loads))
+	for path, l := range loads {
+		paths = append(paths, path)
+		ls = append(ls, l)
+	}
+	loadsMu.Unlock()
+	m := make(map[string]LoadSignals, len(paths))
+	for i, path := range paths {
+		m[path] = ls[i].signals(now)
+	}
+	return m
+}
+
+func loadStatsReport(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	for path, s := range loadSignals(time.Now()) {
+		err := stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Upsert(loadPathKey, path),
+		}, inflightRequests.M(s.Inflight),
+			queueDepth.M(s.QueueDepth),
+			admissionRejectionRate.M(s.AdmissionRejectionsPerSecond))
+		if err != nil {
+			logger.Errorf("load stats %s: %v", path, err)
+		}
+	}
+}
+
+func reportLoadStats(ctx context.Context) {
+	t := time.NewTicker(samplingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			loadStatsReport(ctx)
+		}
+	}
+}
+
+func serveScalez(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := log.FromContext(ctx)
+	defaultStatusz.mu.Lock()
+	name := defaultStatusz.name
+	defaultStatusz.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(Scalez{
+		Server: name,
+		Loads:  loadSignals(time.Now()),
+	})
+	if err != nil {
+		logger.Errorf("scalez: %v", err)
+	}
+}
+
+var scalezOnce sync.Once
+
+// initScalez sets up autoscaling signals page and metrics.
+func initScalez() error {
+	var err error
+	scalezOnce.Do(func() {
+		err = view.Register(loadViews...)
+		if err != nil {
+			return
+		}
+		http.HandleFunc(ScalezPath, serveScalez)
+		go reportLoadStats(context.Background())
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadStatsRejectRate(t *testing.T) {
+	var l loadStats
+	now := time.Unix(1600000000, 0)
+	// too old; must not be counted.
+	l.reject(now.Add(-90 * time.Second))
+	for i := 0; i < 30; i++ {
+		l.reject(now.Add(time.Duration(i) * time.Second))
+	}
+
+	if got, want := l.rejectRate(now.Add(29*time.Second)), 30.0/scalezWindow; got != want {
+		t.Errorf("rejectRate=%f; want %f", got, want)
+	}
+	if got, want := l.rejectRate(now.Add(59*time.Second)), 30.0/scalezWindow; got != want {
+		t.Errorf("rejectRate after 59s=%f; want %f", got, want)
+	}
+	if got, want := l.rejectRate(now.Add(74*time.Second)), 15.0/scalezWindow; got != want {
+		t.Errorf("rejectRate after 74s=%f; want %f", got, want)
+	}
+	if got := l.rejectRate(now.Add(2 * time.Minute)); got != 0 {
+		t.Errorf("rejectRate after 2m=%f; want 0", got)
+	}
+}
+
+func TestServeScalez(t *testing.T) {
+	ctx := context.Background()
+	const path = "scalez_test"
+
+	done1 := LoadStart(ctx, path)
+	done2 := LoadStart(ctx, path)
+	dequeue := LoadQueue(ctx, path)
+	LoadReject(ctx, path)
+	done1()
+
+	w := httptest.NewRecorder()
+	serveScalez(w, httptest.NewRequest("GET", ScalezPath, nil))
+	var s Scalez
+	err := json.Unmarshal(w.Body.Bytes(), &s)
+	if err != nil {
+		t.Fatalf("unmarshal %q: %v", w.Body.String(), err)
+	}
+	got := s.Loads[path]
+	if got.Inflight != 1 || got.QueueDepth != 1 || got.AdmissionRejectionsPerSecond != 1.0/scalezWindow {
+		t.Errorf("scalez %s=%#v; want inflight=1 queue_depth=1 rejections=%f", path, got, 1.0/scalezWindow)
+	}
+
+	done2()
+	dequeue()
+	got = loadSignals(time.Now())[path]
+	if got.Inflight != 0 || got.QueueDepth != 0 {
+		t.Errorf("signals %s=%#v; want inflight=0 queue_depth=0", path, got)
+	}
+}
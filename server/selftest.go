@@ -0,0 +1,129 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// SelfTestTimeout is timeout of each self-test check.
+const SelfTestTimeout = 30 * time.Second
+
+// SelfTest runs checks of server's dependencies end to end,
+// e.g. as deployment preflight or in init container.
+type SelfTest struct {
+	// Name is the name of the server.
+	Name string
+
+	checks []selfTestCheck
+}
+
+type selfTestCheck struct {
+	name string
+	f    func(context.Context) error
+}
+
+// Add adds check f named name.
+func (st *SelfTest) Add(name string, f func(context.Context) error) {
+	st.checks = append(st.checks, selfTestCheck{
+		name: name,
+		f:    f,
+	})
+}
+
+// SelfTestResult is a result of a self-test check.
+type SelfTestResult struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// SelfTestReport is a report of self-test.
+type SelfTestReport struct {
+	Server  string           `json:"server"`
+	OK      bool             `json:"ok"`
+	Results []SelfTestResult `json:"results"`
+}
+
+// Run runs all checks in order, and returns the report.
+// Each check runs with SelfTestTimeout, and failure of a check
+// doesn't stop the rest of checks.
+func (st *SelfTest) Run(ctx context.Context) SelfTestReport {
+	logger := log.FromContext(ctx)
+	report := SelfTestReport{
+		Server: st.Name,
+		OK:     true,
+	}
+	for _, c := range st.checks {
+		t := time.Now()
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, SelfTestTimeout)
+			defer cancel()
+			return c.f(ctx)
+		}()
+		r := SelfTestResult{
+			Name:     c.name,
+			OK:       err == nil,
+			Duration: time.Since(t).String(),
+		}
+		if err != nil {
+			logger.Errorf("selftest %s: %v", c.name, err)
+			r.Error = err.Error()
+			report.OK = false
+		} else {
+			logger.Infof("selftest %s: ok in %s", c.name, r.Duration)
+		}
+		report.Results = append(report.Results, r)
+	}
+	return report
+}
+
+// RunSelfTest runs self-test, writes the report in JSON to stdout,
+// and exits with status 0 if all checks passed, or 1 otherwise.
+// This is typically invoked instead of Run in --selftest mode.
+func RunSelfTest(ctx context.Context, st *SelfTest) {
+	logger := log.FromContext(ctx)
+	report := st.Run(ctx)
+	err := writeSelfTestReport(os.Stdout, report)
+	if err != nil {
+		logger.Errorf("selftest report: %v", err)
+	}
+	logger.Sync()
+	if !report.OK {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func writeSelfTestReport(w io.Writer, report SelfTestReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// CheckConn checks conn can connect to the server.
+func CheckConn(ctx context.Context, conn *grpc.ClientConn) error {
+	conn.Connect()
+	for {
+		s := conn.GetState()
+		if s == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, s) {
+			return fmt.Errorf("connect %s: %s: %v", conn.Target(), s, ctx.Err())
+		}
+	}
+}
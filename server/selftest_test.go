@@ -0,0 +1,76 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	st := &SelfTest{Name: "test_server"}
+	var ran []string
+	st.Add("ok", func(ctx context.Context) error {
+		ran = append(ran, "ok")
+		return nil
+	})
+	st.Add("fail", func(ctx context.Context) error {
+		ran = append(ran, "fail")
+		return errors.New("cache unavailable")
+	})
+	st.Add("deadline", func(ctx context.Context) error {
+		ran = append(ran, "deadline")
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		return nil
+	})
+
+	report := st.Run(context.Background())
+	if got, want := len(ran), 3; got != want {
+		t.Errorf("ran %q; want %d checks", ran, want)
+	}
+	if report.OK {
+		t.Errorf("report.OK=true; want false")
+	}
+	if report.Server != "test_server" {
+		t.Errorf("report.Server=%q; want %q", report.Server, "test_server")
+	}
+	for i, want := range []SelfTestResult{
+		{Name: "ok", OK: true},
+		{Name: "fail", OK: false, Error: "cache unavailable"},
+		{Name: "deadline", OK: true},
+	} {
+		got := report.Results[i]
+		if got.Name != want.Name || got.OK != want.OK || got.Error != want.Error {
+			t.Errorf("report.Results[%d]=%#v; want %#v", i, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := writeSelfTestReport(&buf, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SelfTestReport
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal(%q)=%v; want nil", buf.Bytes(), err)
+	}
+	if decoded.OK || len(decoded.Results) != 3 || decoded.Results[1].Error != "cache unavailable" {
+		t.Errorf("decoded report=%#v; want %#v", decoded, report)
+	}
+}
+
+func TestSelfTestEmpty(t *testing.T) {
+	st := &SelfTest{Name: "test_server"}
+	report := st.Run(context.Background())
+	if !report.OK || len(report.Results) != 0 {
+		t.Errorf("st.Run()=%#v; want ok with no results", report)
+	}
+}
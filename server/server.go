@@ -81,17 +81,25 @@ func NewGRPC(port int, opts ...grpc.ServerOption) (GRPC, error) {
 			if errorreporter.Enabled() {
 				return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 					defer errorreporter.Do(nil, &err)
-					return interceptor(ctx, req, info, handler)
+					return statuszUnaryInterceptor(ctx, req, info, handler, interceptor)
 				}
 			}
-			return interceptor
+			return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+				return statuszUnaryInterceptor(ctx, req, info, handler, interceptor)
+			}
 		}()))
 	s := grpc.NewServer(opts...)
 	return GRPC{Server: s, Listener: lis}, nil
 }
 
 // NewHTTP creates http server.
+// Requests to non-nil handler are recorded in status page.
+// nil handler (i.e. http.DefaultServeMux) is typically used for
+// monitoring port, so its requests are not recorded.
 func NewHTTP(port int, handler http.Handler) *http.Server {
+	if handler != nil {
+		handler = statuszHandler(handler)
+	}
 	return &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: handler,
@@ -112,6 +120,19 @@ func NewHTTPS(hs *http.Server, certFile, keyFile string) Server {
 	return httpsServer{Server: hs, certFile: certFile, keyFile: keyFile}
 }
 
+var (
+	shutdownMu    sync.Mutex
+	shutdownHooks []func(context.Context)
+)
+
+// OnShutdown registers f to be called in Run after servers are
+// gracefully shut down, and before the process exits.
+func OnShutdown(f func(context.Context)) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownHooks = append(shutdownHooks, f)
+}
+
 // Run runs servers.
 // This is typically invoked as the last statement in the server's main function.
 func Run(ctx context.Context, servers ...Server) {
@@ -154,6 +175,12 @@ func Run(ctx context.Context, servers ...Server) {
 		}(s)
 	}
 	wg.Wait()
+	shutdownMu.Lock()
+	hooks := shutdownHooks
+	shutdownMu.Unlock()
+	for _, f := range hooks {
+		f(ctx)
+	}
 	Flush()
 	logger.Infof("server shutdown complete")
 	logger.Sync()
@@ -0,0 +1,440 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.chromium.org/goma/server/log"
+)
+
+// StatuszPath is path to serve status page of the server.
+const StatuszPath = "/statusz"
+
+const (
+	// statuszMinutes is number of minutes to show request stats.
+	statuszMinutes = 60
+	// statuszMaxConfigChanges is number of recent config changes to show.
+	statuszMaxConfigChanges = 10
+	// statuszCheckTimeout is timeout of each dependency check.
+	statuszCheckTimeout = 5 * time.Second
+	// statuszCheckInterval is minimum interval to run dependency checks,
+	// to avoid overloading dependencies by frequent page loads.
+	statuszCheckInterval = 30 * time.Second
+)
+
+// statusz collects status of the server to show on StatuszPath:
+// build info, config versions, dependency health, request stats
+// and recent config changes.
+type statusz struct {
+	name  string
+	host  string
+	start time.Time
+
+	requests requestStats
+
+	mu            sync.Mutex
+	configs       map[string]string
+	configChanges []configChange
+	checks        []selfTestCheck
+	checkResults  []SelfTestResult
+	checkTime     time.Time
+}
+
+type configChange struct {
+	Time    time.Time
+	Name    string
+	Version string
+}
+
+var defaultStatusz = &statusz{
+	start: time.Now(),
+}
+
+var statuszOnce sync.Once
+
+// initStatusz sets up status page for the server name.
+func initStatusz(ctx context.Context, name string) {
+	statuszOnce.Do(func() {
+		defaultStatusz.mu.Lock()
+		defaultStatusz.name = name
+		defaultStatusz.host = HostName(ctx)
+		defaultStatusz.mu.Unlock()
+		http.Handle(StatuszPath, defaultStatusz)
+	})
+}
+
+// RecordConfigChange records config name is updated to version,
+// shown in status page.
+func RecordConfigChange(ctx context.Context, name, version string) {
+	defaultStatusz.recordConfigChange(ctx, name, version, time.Now())
+}
+
+// AddStatuszCheck adds dependency health check f named name,
+// shown in status page.
+func AddStatuszCheck(name string, f func(context.Context) error) {
+	defaultStatusz.mu.Lock()
+	defer defaultStatusz.mu.Unlock()
+	defaultStatusz.checks = append(defaultStatusz.checks, selfTestCheck{
+		name: name,
+		f:    f,
+	})
+}
+
+func (s *statusz) recordConfigChange(ctx context.Context, name, version string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.configs == nil {
+		s.configs = make(map[string]string)
+	}
+	if s.configs[name] == version {
+		return
+	}
+	logger := log.FromContext(ctx)
+	logger.Infof("config %s: %q -> %q", name, s.configs[name], version)
+	s.configs[name] = version
+	s.configChanges = append(s.configChanges, configChange{
+		Time:    t,
+		Name:    name,
+		Version: version,
+	})
+	if len(s.configChanges) > statuszMaxConfigChanges {
+		s.configChanges = s.configChanges[len(s.configChanges)-statuszMaxConfigChanges:]
+	}
+}
+
+// runChecks runs dependency checks concurrently, or returns results
+// of the last run if it was within statuszCheckInterval.
+func (s *statusz) runChecks(ctx context.Context) []SelfTestResult {
+	s.mu.Lock()
+	checks := s.checks
+	if time.Since(s.checkTime) < statuszCheckInterval && len(s.checkResults) == len(checks) {
+		results := s.checkResults
+		s.mu.Unlock()
+		return results
+	}
+	s.mu.Unlock()
+
+	results := make([]SelfTestResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(c selfTestCheck, r *SelfTestResult) {
+			defer wg.Done()
+			t := time.Now()
+			ctx, cancel := context.WithTimeout(ctx, statuszCheckTimeout)
+			defer cancel()
+			err := c.f(ctx)
+			*r = SelfTestResult{
+				Name:     c.name,
+				OK:       err == nil,
+				Duration: time.Since(t).Truncate(time.Millisecond).String(),
+			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+		}(c, &results[i])
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.checkResults = results
+	s.checkTime = time.Now()
+	s.mu.Unlock()
+	return results
+}
+
+// requestStats records requests per minute.
+type requestStats struct {
+	mu      sync.Mutex
+	buckets [statuszMinutes]requestBucket
+}
+
+type requestBucket struct {
+	minute  int64
+	count   int64
+	errors  int64
+	latency time.Duration
+}
+
+// record records a request finished at t, which took d.
+func (rs *requestStats) record(t time.Time, d time.Duration, failed bool) {
+	minute := t.Unix() / 60
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	b := &rs.buckets[minute%statuszMinutes]
+	if b.minute > minute {
+		// too old to be shown; don't reset newer bucket.
+		return
+	}
+	if b.minute != minute {
+		*b = requestBucket{minute: minute}
+	}
+	b.count++
+	if failed {
+		b.errors++
+	}
+	b.latency += d
+}
+
+// series returns QPS, error ratio and mean latency in milliseconds
+// per minute for the last statuszMinutes minutes, oldest first.
+func (rs *requestStats) series(now time.Time) (qps, errRatio, latency []float64) {
+	cur := now.Unix() / 60
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for m := cur - statuszMinutes + 1; m <= cur; m++ {
+		b := rs.buckets[m%statuszMinutes]
+		if b.minute != m || b.count == 0 {
+			qps = append(qps, 0)
+			errRatio = append(errRatio, 0)
+			latency = append(latency, 0)
+			continue
+		}
+		qps = append(qps, float64(b.count)/60)
+		errRatio = append(errRatio, float64(b.errors)/float64(b.count))
+		latency = append(latency, float64(b.latency.Milliseconds())/float64(b.count))
+	}
+	return qps, errRatio, latency
+}
+
+// recordRequest records request stats for status page.
+func recordRequest(start time.Time, failed bool) {
+	now := time.Now()
+	defaultStatusz.requests.record(now, now.Sub(start), failed)
+}
+
+// statuszUnaryInterceptor calls interceptor and records request stats
+// for status page.
+func statuszUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	start := time.Now()
+	resp, err := interceptor(ctx, req, info, handler)
+	recordRequest(start, isServerError(err))
+	return resp, err
+}
+
+// isServerError reports whether err is server side error, rather than
+// client's error (e.g. invalid argument, not found).
+func isServerError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// statuszResponseWriter captures http status code.
+type statuszResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statuszResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statuszResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// statuszHandler wraps h to record request stats for status page.
+func statuszHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statuszResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, req)
+		recordRequest(start, sw.code >= 500)
+	})
+}
+
+// sparkline returns svg polyline points of values in w x h box.
+func sparkline(values []float64, w, h int) string {
+	maxv := 0.0
+	for _, v := range values {
+		if v > maxv {
+			maxv = v
+		}
+	}
+	var points []string
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) * float64(w) / float64(len(values)-1)
+		}
+		y := float64(h)
+		if maxv > 0 {
+			y = float64(h) - v/maxv*float64(h)
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+type statuszSeries struct {
+	Name   string
+	Last   string
+	Max    string
+	Points string
+}
+
+func newStatuszSeries(name string, values []float64, format string) statuszSeries {
+	var maxv, last float64
+	for _, v := range values {
+		if v > maxv {
+			maxv = v
+		}
+	}
+	if len(values) > 0 {
+		last = values[len(values)-1]
+	}
+	return statuszSeries{
+		Name:   name,
+		Last:   fmt.Sprintf(format, last),
+		Max:    fmt.Sprintf(format, maxv),
+		Points: sparkline(values, 240, 30),
+	}
+}
+
+type statuszConfig struct {
+	Name    string
+	Version string
+}
+
+type statuszData struct {
+	Name          string
+	Host          string
+	Start         time.Time
+	Uptime        time.Duration
+	GoVersion     string
+	Binary        string
+	ModuleVersion string
+	PID           int
+	Goroutines    int
+	MaxProcs      int
+	NumCPU        int
+	MaxProcsBy    string
+	Configs       []statuszConfig
+	ConfigChanges []configChange
+	Checks        []SelfTestResult
+	Series        []statuszSeries
+}
+
+var statuszTmpl = template.Must(template.New("statusz").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Name}} statusz</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.ok { color: green; }
+.ng { color: red; font-weight: bold; }
+polyline { fill: none; stroke: #1a73e8; stroke-width: 1; }
+</style>
+</head>
+<body>
+<h1>{{.Name}} on {{.Host}}</h1>
+<h2>Build</h2>
+<table>
+<tr><th>binary</th><td>{{.Binary}} {{.ModuleVersion}}</td></tr>
+<tr><th>go</th><td>{{.GoVersion}}</td></tr>
+<tr><th>pid</th><td>{{.PID}}</td></tr>
+<tr><th>started</th><td>{{.Start.Format "2006-01-02T15:04:05Z07:00"}} (up {{.Uptime}})</td></tr>
+<tr><th>goroutines</th><td>{{.Goroutines}}</td></tr>
+<tr><th>GOMAXPROCS</th><td>{{.MaxProcs}} (cpus {{.NumCPU}}, by {{.MaxProcsBy}})</td></tr>
+</table>
+<h2>Config</h2>
+{{if .Configs}}<table>
+<tr><th>name</th><th>version</th></tr>
+{{range .Configs}}<tr><td>{{.Name}}</td><td>{{.Version}}</td></tr>
+{{end}}</table>{{else}}<p>no config</p>{{end}}
+<h2>Dependencies</h2>
+{{if .Checks}}<table>
+<tr><th>name</th><th>status</th><th>duration</th><th>error</th></tr>
+{{range .Checks}}<tr><td>{{.Name}}</td>{{if .OK}}<td class="ok">ok</td>{{else}}<td class="ng">NG</td>{{end}}<td>{{.Duration}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>{{else}}<p>no dependency checks</p>{{end}}
+<h2>Requests (last 60 minutes)</h2>
+<table>
+<tr><th></th><th>last minute</th><th>max</th><th></th></tr>
+{{range .Series}}<tr><th>{{.Name}}</th><td>{{.Last}}</td><td>{{.Max}}</td><td><svg width="240" height="30"><polyline points="{{.Points}}"/></svg></td></tr>
+{{end}}</table>
+<h2>Recent config changes</h2>
+{{if .ConfigChanges}}<table>
+<tr><th>time</th><th>name</th><th>version</th></tr>
+{{range .ConfigChanges}}<tr><td>{{.Time.Format "2006-01-02T15:04:05Z07:00"}}</td><td>{{.Name}}</td><td>{{.Version}}</td></tr>
+{{end}}</table>{{else}}<p>no config changes</p>{{end}}
+</body>
+</html>
+`))
+
+func (s *statusz) data(ctx context.Context, now time.Time) statuszData {
+	checks := s.runChecks(ctx)
+	s.mu.Lock()
+	d := statuszData{
+		Name:      s.name,
+		Host:      s.host,
+		Start:     s.start,
+		Uptime:    now.Sub(s.start).Truncate(time.Second),
+		GoVersion: runtime.Version(),
+		Binary:    os.Args[0],
+		PID:       os.Getpid(),
+		Checks:    checks,
+	}
+	for name, version := range s.configs {
+		d.Configs = append(d.Configs, statuszConfig{Name: name, Version: version})
+	}
+	// newest first.
+	for i := len(s.configChanges) - 1; i >= 0; i-- {
+		d.ConfigChanges = append(d.ConfigChanges, s.configChanges[i])
+	}
+	s.mu.Unlock()
+	sort.Slice(d.Configs, func(i, j int) bool {
+		return d.Configs[i].Name < d.Configs[j].Name
+	})
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		d.Binary = bi.Path
+		d.ModuleVersion = bi.Main.Version
+	}
+	d.Goroutines = runtime.NumGoroutine()
+	d.MaxProcs = runtime.GOMAXPROCS(0)
+	d.NumCPU = runtime.NumCPU()
+	d.MaxProcsBy = maxProcsBy()
+	qps, errRatio, latency := s.requests.series(now)
+	d.Series = []statuszSeries{
+		newStatuszSeries("qps", qps, "%.2f"),
+		newStatuszSeries("error ratio", errRatio, "%.3f"),
+		newStatuszSeries("latency (ms)", latency, "%.1f"),
+	}
+	return d
+}
+
+func (s *statusz) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := log.FromContext(ctx)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statuszTmpl.Execute(w, s.data(ctx, time.Now()))
+	if err != nil {
+		logger.Errorf("statusz: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestStatsSeries(t *testing.T) {
+	var rs requestStats
+	now := time.Unix(1600000000, 0)
+	for i := 0; i < 6; i++ {
+		rs.record(now, 100*time.Millisecond, i%3 == 0)
+	}
+	// too old; must not be shown.
+	rs.record(now.Add(-2*time.Hour), time.Second, true)
+
+	qps, errRatio, latency := rs.series(now)
+	if len(qps) != statuszMinutes || len(errRatio) != statuszMinutes || len(latency) != statuszMinutes {
+		t.Fatalf("series len=%d,%d,%d; want %d", len(qps), len(errRatio), len(latency), statuszMinutes)
+	}
+	last := statuszMinutes - 1
+	if got, want := qps[last], 6.0/60; got != want {
+		t.Errorf("qps=%f; want %f", got, want)
+	}
+	if got, want := errRatio[last], 2.0/6; got != want {
+		t.Errorf("error ratio=%f; want %f", got, want)
+	}
+	if got, want := latency[last], 100.0; got != want {
+		t.Errorf("latency=%f; want %f", got, want)
+	}
+	for i := 0; i < last; i++ {
+		if qps[i] != 0 {
+			t.Errorf("qps[%d]=%f; want 0", i, qps[i])
+		}
+	}
+}
+
+func TestStatuszRecordConfigChange(t *testing.T) {
+	ctx := context.Background()
+	s := &statusz{}
+	now := time.Now()
+	s.recordConfigChange(ctx, "toolchain", "v1", now)
+	s.recordConfigChange(ctx, "toolchain", "v1", now)
+	if got, want := len(s.configChanges), 1; got != want {
+		t.Errorf("len(configChanges)=%d; want %d (same version recorded twice)", got, want)
+	}
+	for i := 0; i < statuszMaxConfigChanges+5; i++ {
+		s.recordConfigChange(ctx, "toolchain", fmt.Sprintf("v%d", i+2), now)
+	}
+	if got, want := len(s.configChanges), statuszMaxConfigChanges; got != want {
+		t.Errorf("len(configChanges)=%d; want %d", got, want)
+	}
+	want := fmt.Sprintf("v%d", statuszMaxConfigChanges+6)
+	if got := s.configs["toolchain"]; got != want {
+		t.Errorf("configs[toolchain]=%q; want %q", got, want)
+	}
+	if got := s.configChanges[len(s.configChanges)-1].Version; got != want {
+		t.Errorf("last config change=%q; want %q", got, want)
+	}
+}
+
+func TestStatuszServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	s := &statusz{
+		name:  "test_server",
+		host:  "test-host",
+		start: time.Now(),
+		checks: []selfTestCheck{
+			{
+				name: "cache",
+				f: func(ctx context.Context) error {
+					return nil
+				},
+			},
+			{
+				name: "file-server",
+				f: func(ctx context.Context) error {
+					return errors.New("connection refused")
+				},
+			},
+		},
+	}
+	s.recordConfigChange(ctx, "toolchain", "20220401-v1", time.Now())
+	s.requests.record(time.Now(), 10*time.Millisecond, false)
+
+	req := httptest.NewRequest("GET", StatuszPath, nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("code=%d; want %d", got, want)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"test_server on test-host",
+		"20220401-v1",
+		"cache",
+		"file-server",
+		"connection refused",
+		"<polyline",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("statusz page doesn't contain %q\n%s", want, body)
+		}
+	}
+}
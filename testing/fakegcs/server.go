@@ -0,0 +1,752 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package fakegcs provides in-process fake Google Cloud Storage server
+// for test.
+//
+// It serves subset of JSON API (buckets, objects, uploads and
+// notification configs) and XML API reads used by
+// cloud.google.com/go/storage. Create a client with
+//
+//	s := fakegcs.NewServer(t)
+//	client, err := storage.NewClient(ctx,
+//		option.WithEndpoint(s.Endpoint()),
+//		option.WithoutAuthentication())
+package fakegcs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Event types of notifications.
+// https://cloud.google.com/storage/docs/pubsub-notifications#events
+const (
+	ObjectFinalizeEvent = "OBJECT_FINALIZE"
+	ObjectDeleteEvent   = "OBJECT_DELETE"
+)
+
+// Publisher publishes pubsub message to topic, e.g. fakepubsub.Server.
+type Publisher interface {
+	Publish(topic string, data []byte, attrs map[string]string) string
+}
+
+// Server is a fake Google Cloud Storage server.
+type Server struct {
+	srv *httptest.Server
+
+	// Publisher receives notifications of object changes on buckets
+	// that have notification configs, if set.
+	// It should be set before sending any requests.
+	Publisher Publisher
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	uploads map[string]*upload
+	gen     int64
+	id      int
+}
+
+type bucket struct {
+	created       time.Time
+	objects       map[string]*object
+	notifications []*notification
+}
+
+type object struct {
+	Name        string
+	Bucket      string
+	Generation  int64
+	ContentType string
+	Metadata    map[string]string
+	Updated     time.Time
+	Data        []byte
+}
+
+type upload struct {
+	bucket string
+	meta   objectMeta
+	data   []byte
+}
+
+// objectMeta is object metadata sent in uploads.
+type objectMeta struct {
+	Name        string            `json:"name"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+type notification struct {
+	ID               string            `json:"id"`
+	Kind             string            `json:"kind"`
+	Topic            string            `json:"topic"`
+	EventTypes       []string          `json:"event_types,omitempty"`
+	ObjectNamePrefix string            `json:"object_name_prefix,omitempty"`
+	CustomAttributes map[string]string `json:"custom_attributes,omitempty"`
+	PayloadFormat    string            `json:"payload_format"`
+}
+
+// NewServer starts a new fake GCS server.
+// It is closed when tb finishes.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{
+		buckets: make(map[string]*bucket),
+		uploads: make(map[string]*upload),
+	}
+	s.srv = httptest.NewServer(s)
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// URL returns base URL of the fake GCS server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Endpoint returns JSON API endpoint for option.WithEndpoint.
+func (s *Server) Endpoint() string {
+	return s.srv.URL + "/storage/v1/"
+}
+
+// Close shuts down the fake GCS server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// CreateBucket creates bucket name if not exist.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bucket(name)
+}
+
+// bucket returns bucket name, creating it if not exist.
+// s.mu must be held.
+func (s *Server) bucket(name string) *bucket {
+	b, ok := s.buckets[name]
+	if !ok {
+		b = &bucket{
+			created: time.Now(),
+			objects: make(map[string]*object),
+		}
+		s.buckets[name] = b
+	}
+	return b
+}
+
+// AddNotification adds notification config on bucket to publish
+// object changes to topic in project in JSON_API_V1 payload format.
+// It returns id of the notification config.
+func (s *Server) AddNotification(bucket, project, topic string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id++
+	n := &notification{
+		ID:            strconv.Itoa(s.id),
+		Kind:          "storage#notification",
+		Topic:         fmt.Sprintf("//pubsub.googleapis.com/projects/%s/topics/%s", project, topic),
+		PayloadFormat: "JSON_API_V1",
+	}
+	b := s.bucket(bucket)
+	b.notifications = append(b.notifications, n)
+	return n.ID
+}
+
+// PutObject stores data as object name in bucket.
+func (s *Server) PutObject(bucket, name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(bucket, objectMeta{Name: name}, data)
+}
+
+// GetObject returns data of object name in bucket.
+func (s *Server) GetObject(bucket, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, false
+	}
+	obj, ok := b.objects[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), obj.Data...), true
+}
+
+// put stores data as object in bucket, and notifies it.
+// s.mu must be held.
+func (s *Server) put(bucket string, meta objectMeta, data []byte) *object {
+	b := s.bucket(bucket)
+	s.gen++
+	obj := &object{
+		Name:        meta.Name,
+		Bucket:      bucket,
+		Generation:  s.gen,
+		ContentType: meta.ContentType,
+		Metadata:    meta.Metadata,
+		Updated:     time.Now(),
+		Data:        append([]byte(nil), data...),
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = "application/octet-stream"
+	}
+	b.objects[obj.Name] = obj
+	s.notify(b, obj, ObjectFinalizeEvent)
+	return obj
+}
+
+// notify publishes event of obj in b.
+// s.mu must be held.
+func (s *Server) notify(b *bucket, obj *object, eventType string) {
+	if s.Publisher == nil {
+		return
+	}
+	for _, n := range b.notifications {
+		if len(n.EventTypes) > 0 && !contains(n.EventTypes, eventType) {
+			continue
+		}
+		if !strings.HasPrefix(obj.Name, n.ObjectNamePrefix) {
+			continue
+		}
+		attrs := map[string]string{
+			"notificationConfig": fmt.Sprintf("projects/_/buckets/%s/notificationConfigs/%s", obj.Bucket, n.ID),
+			"eventType":          eventType,
+			"payloadFormat":      n.PayloadFormat,
+			"bucketId":           obj.Bucket,
+			"objectId":           obj.Name,
+			"objectGeneration":   strconv.FormatInt(obj.Generation, 10),
+			"eventTime":          time.Now().UTC().Format(time.RFC3339Nano),
+		}
+		for k, v := range n.CustomAttributes {
+			attrs[k] = v
+		}
+		var data []byte
+		if n.PayloadFormat == "JSON_API_V1" {
+			data, _ = json.Marshal(obj.resource())
+		}
+		s.Publisher.Publish(strings.TrimPrefix(n.Topic, "//pubsub.googleapis.com/"), data, attrs)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func crc32cOf(b []byte) string {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)))
+	return base64.StdEncoding.EncodeToString(buf[:])
+}
+
+func md5Of(b []byte) string {
+	sum := md5.Sum(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// resource returns JSON API object resource of obj.
+func (obj *object) resource() map[string]interface{} {
+	return map[string]interface{}{
+		"kind":           "storage#object",
+		"id":             fmt.Sprintf("%s/%s/%d", obj.Bucket, obj.Name, obj.Generation),
+		"name":           obj.Name,
+		"bucket":         obj.Bucket,
+		"generation":     strconv.FormatInt(obj.Generation, 10),
+		"metageneration": "1",
+		"contentType":    obj.ContentType,
+		"size":           strconv.Itoa(len(obj.Data)),
+		"md5Hash":        md5Of(obj.Data),
+		"crc32c":         crc32cOf(obj.Data),
+		"metadata":       obj.Metadata,
+		"timeCreated":    obj.Updated.UTC().Format(time.RFC3339Nano),
+		"updated":        obj.Updated.UTC().Format(time.RFC3339Nano),
+		"storageClass":   "STANDARD",
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes error in JSON API error format.
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": msg,
+			"errors": []map[string]string{
+				{
+					"domain":  "global",
+					"message": msg,
+				},
+			},
+		},
+	})
+}
+
+// ServeHTTP serves GCS API requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.EscapedPath()
+	switch {
+	case strings.HasPrefix(path, "/upload/storage/v1/b/"):
+		s.serveUpload(w, req, strings.TrimPrefix(path, "/upload/storage/v1/b/"))
+	case strings.HasPrefix(path, "/storage/v1/b/"):
+		s.serveJSON(w, req, strings.TrimPrefix(path, "/storage/v1/b/"))
+	default:
+		s.serveXML(w, req, strings.TrimPrefix(path, "/"))
+	}
+}
+
+// splitPath splits escaped path into bucket and the rest.
+func splitPath(path string) (string, string, error) {
+	i := strings.Index(path, "/")
+	rest := ""
+	if i >= 0 {
+		path, rest = path[:i], path[i:]
+	}
+	bucket, err := url.PathUnescape(path)
+	return bucket, rest, err
+}
+
+func (s *Server) serveJSON(w http.ResponseWriter, req *http.Request, path string) {
+	bucketName, rest, err := splitPath(path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad path %q: %v", path, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "bucket %s not found", bucketName)
+		return
+	}
+	switch {
+	case rest == "" && req.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{
+			"kind":           "storage#bucket",
+			"id":             bucketName,
+			"name":           bucketName,
+			"metageneration": "1",
+			"location":       "US",
+			"storageClass":   "STANDARD",
+			"timeCreated":    b.created.UTC().Format(time.RFC3339Nano),
+			"updated":        b.created.UTC().Format(time.RFC3339Nano),
+		})
+
+	case rest == "/o" && req.Method == http.MethodGet:
+		s.listObjects(w, req, b)
+
+	case strings.HasPrefix(rest, "/o/"):
+		name, err := url.PathUnescape(strings.TrimPrefix(rest, "/o/"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad object name %q: %v", rest, err)
+			return
+		}
+		obj, ok := b.objects[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "object %s/%s not found", bucketName, name)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			if req.URL.Query().Get("alt") == "media" {
+				serveObject(w, req, obj)
+				return
+			}
+			writeJSON(w, obj.resource())
+		case http.MethodDelete:
+			delete(b.objects, name)
+			s.notify(b, obj, ObjectDeleteEvent)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", req.Method)
+		}
+
+	case rest == "/notificationConfigs":
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, map[string]interface{}{
+				"kind":  "storage#notifications",
+				"items": b.notifications,
+			})
+		case http.MethodPost:
+			n := &notification{}
+			err := json.NewDecoder(req.Body).Decode(n)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "bad notification: %v", err)
+				return
+			}
+			s.id++
+			n.ID = strconv.Itoa(s.id)
+			n.Kind = "storage#notification"
+			b.notifications = append(b.notifications, n)
+			writeJSON(w, n)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", req.Method)
+		}
+
+	case strings.HasPrefix(rest, "/notificationConfigs/") && req.Method == http.MethodDelete:
+		id := strings.TrimPrefix(rest, "/notificationConfigs/")
+		for i, n := range b.notifications {
+			if n.ID == id {
+				b.notifications = append(b.notifications[:i], b.notifications[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "notification %s not found", id)
+
+	default:
+		writeError(w, http.StatusNotFound, "unsupported request %s %s", req.Method, req.URL)
+	}
+}
+
+// listObjects lists objects in b.
+// s.mu must be held.
+func (s *Server) listObjects(w http.ResponseWriter, req *http.Request, b *bucket) {
+	q := req.URL.Query()
+	prefix := q.Get("prefix")
+	delimiter := q.Get("delimiter")
+	startOffset := q.Get("startOffset")
+	endOffset := q.Get("endOffset")
+	var names []string
+	for name := range b.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := []interface{}{}
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if startOffset != "" && name < startOffset {
+			continue
+		}
+		if endOffset != "" && name >= endOffset {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				p := name[:len(prefix)+i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					prefixes = append(prefixes, p)
+				}
+				continue
+			}
+		}
+		items = append(items, b.objects[name].resource())
+	}
+	writeJSON(w, map[string]interface{}{
+		"kind":     "storage#objects",
+		"items":    items,
+		"prefixes": prefixes,
+	})
+}
+
+// serveObject serves content of obj, with range if requested.
+func serveObject(w http.ResponseWriter, req *http.Request, obj *object) {
+	h := w.Header()
+	h.Set("Content-Type", obj.ContentType)
+	h.Set("Last-Modified", obj.Updated.UTC().Format(http.TimeFormat))
+	h.Set("X-Goog-Generation", strconv.FormatInt(obj.Generation, 10))
+	h.Set("X-Goog-Metageneration", "1")
+	h.Set("X-Goog-Hash", fmt.Sprintf("crc32c=%s,md5=%s", crc32cOf(obj.Data), md5Of(obj.Data)))
+	data := obj.Data
+	size := int64(len(data))
+	status := http.StatusOK
+	if r := req.Header.Get("Range"); r != "" {
+		start, end, ok := parseRange(r, size)
+		if !ok {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+		data = data[start:end]
+		status = http.StatusPartialContent
+	}
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if req.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
+
+// parseRange parses Range header "bytes=<start>-<end>", "bytes=<start>-"
+// or "bytes=-<suffix>", and returns [start, end) in size.
+func parseRange(r string, size int64) (int64, int64, bool) {
+	if !strings.HasPrefix(r, "bytes=") {
+		return 0, 0, false
+	}
+	v := strings.SplitN(strings.TrimPrefix(r, "bytes="), "-", 2)
+	if len(v) != 2 {
+		return 0, 0, false
+	}
+	if v[0] == "" {
+		n, err := strconv.ParseInt(v[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, true
+	}
+	start, err := strconv.ParseInt(v[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size
+	if v[1] != "" {
+		e, err := strconv.ParseInt(v[1], 10, 64)
+		if err != nil || e < start {
+			return 0, 0, false
+		}
+		if e+1 < end {
+			end = e + 1
+		}
+	}
+	return start, end, true
+}
+
+// serveXML serves XML API reads of "<bucket>/<object>".
+func (s *Server) serveXML(w http.ResponseWriter, req *http.Request, path string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", req.Method)
+		return
+	}
+	bucketName, rest, err := splitPath(path)
+	if err != nil || rest == "" {
+		writeError(w, http.StatusBadRequest, "bad path %q", path)
+		return
+	}
+	name, err := url.PathUnescape(strings.TrimPrefix(rest, "/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad object name %q: %v", rest, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "bucket %s not found", bucketName)
+		return
+	}
+	obj, ok := b.objects[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object %s/%s not found", bucketName, name)
+		return
+	}
+	if g := req.URL.Query().Get("generation"); g != "" && g != strconv.FormatInt(obj.Generation, 10) {
+		writeError(w, http.StatusNotFound, "object %s/%s#%s not found", bucketName, name, g)
+		return
+	}
+	serveObject(w, req, obj)
+}
+
+// serveUpload serves media, multipart and resumable uploads to
+// "<bucket>/o".
+func (s *Server) serveUpload(w http.ResponseWriter, req *http.Request, path string) {
+	bucketName, rest, err := splitPath(path)
+	if err != nil || rest != "/o" {
+		writeError(w, http.StatusBadRequest, "bad upload path %q", path)
+		return
+	}
+	q := req.URL.Query()
+	if id := q.Get("upload_id"); id != "" {
+		s.resumeUpload(w, req, id)
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", req.Method)
+		return
+	}
+	var meta objectMeta
+	var data []byte
+	switch q.Get("uploadType") {
+	case "media":
+		meta.Name = q.Get("name")
+		meta.ContentType = req.Header.Get("Content-Type")
+		data, err = ioutil.ReadAll(req.Body)
+	case "multipart":
+		meta, data, err = readMultipart(req)
+	case "resumable":
+		err = json.NewDecoder(req.Body).Decode(&meta)
+		if err == io.EOF {
+			err = nil
+		}
+		if meta.Name == "" {
+			meta.Name = q.Get("name")
+		}
+		if meta.ContentType == "" {
+			meta.ContentType = req.Header.Get("X-Upload-Content-Type")
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad upload metadata: %v", err)
+			return
+		}
+		s.mu.Lock()
+		s.id++
+		id := strconv.Itoa(s.id)
+		s.uploads[id] = &upload{
+			bucket: bucketName,
+			meta:   meta,
+		}
+		s.mu.Unlock()
+		u := *req.URL
+		u.Scheme = "http"
+		u.Host = req.Host
+		q.Set("upload_id", id)
+		u.RawQuery = q.Encode()
+		w.Header().Set("Location", u.String())
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported uploadType %q", q.Get("uploadType"))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad upload: %v", err)
+		return
+	}
+	if meta.Name == "" {
+		writeError(w, http.StatusBadRequest, "no object name")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucketName]; !ok {
+		writeError(w, http.StatusNotFound, "bucket %s not found", bucketName)
+		return
+	}
+	obj := s.put(bucketName, meta, data)
+	writeJSON(w, obj.resource())
+}
+
+// readMultipart reads multipart/related upload of metadata in JSON
+// and media.
+func readMultipart(req *http.Request) (objectMeta, []byte, error) {
+	var meta objectMeta
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return meta, nil, err
+	}
+	mr := multipart.NewReader(req.Body, params["boundary"])
+	p, err := mr.NextPart()
+	if err != nil {
+		return meta, nil, fmt.Errorf("metadata part: %v", err)
+	}
+	err = json.NewDecoder(p).Decode(&meta)
+	if err != nil {
+		return meta, nil, fmt.Errorf("metadata: %v", err)
+	}
+	p, err = mr.NextPart()
+	if err != nil {
+		return meta, nil, fmt.Errorf("media part: %v", err)
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = p.Header.Get("Content-Type")
+	}
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, p)
+	if err != nil {
+		return meta, nil, fmt.Errorf("media: %v", err)
+	}
+	return meta, buf.Bytes(), nil
+}
+
+// resumeUpload serves a chunk of resumable upload id, with
+// Content-Range "bytes <first>-<last>/<total or *>" or "bytes */<total>".
+func (s *Server) resumeUpload(w http.ResponseWriter, req *http.Request, id string) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read chunk: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "upload %s not found", id)
+		return
+	}
+	if req.Method == http.MethodDelete {
+		delete(s.uploads, id)
+		w.WriteHeader(499)
+		return
+	}
+	total := int64(-1)
+	cr := strings.TrimPrefix(req.Header.Get("Content-Range"), "bytes ")
+	if i := strings.LastIndex(cr, "/"); i >= 0 {
+		if t := cr[i+1:]; t != "*" {
+			total, err = strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "bad Content-Range %q", req.Header.Get("Content-Range"))
+				return
+			}
+		}
+		if r := cr[:i]; r != "*" {
+			first, err := strconv.ParseInt(strings.SplitN(r, "-", 2)[0], 10, 64)
+			if err != nil || first != int64(len(u.data)) {
+				writeError(w, http.StatusBadRequest, "unexpected Content-Range %q; received %d bytes", req.Header.Get("Content-Range"), len(u.data))
+				return
+			}
+		}
+	}
+	u.data = append(u.data, data...)
+	if total < 0 || int64(len(u.data)) < total {
+		if len(u.data) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(u.data)-1))
+		}
+		// 308 Resume Incomplete.
+		// Go client asks to reply 200 with the status in a header,
+		// since 308 conflicts with Permanent Redirect.
+		if req.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	delete(s.uploads, id)
+	if _, ok := s.buckets[u.bucket]; !ok {
+		writeError(w, http.StatusNotFound, "bucket %s not found", u.bucket)
+		return
+	}
+	obj := s.put(u.bucket, u.meta, u.data)
+	writeJSON(w, obj.resource())
+}
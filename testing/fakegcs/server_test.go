@@ -0,0 +1,158 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package fakegcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakePublisher struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (p *fakePublisher) Publish(topic string, data []byte, attrs map[string]string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, fmt.Sprintf("%s %s %s", topic, attrs["eventType"], attrs["objectId"]))
+	return fmt.Sprint(len(p.msgs))
+}
+
+func do(t *testing.T, method, url, contentType, body string, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, b
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(t)
+	pub := &fakePublisher{}
+	s.Publisher = pub
+	s.CreateBucket("bucket")
+	s.AddNotification("bucket", "project", "topic")
+
+	resp, _ := do(t, "GET", s.Endpoint()+"b/nobucket", "", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("get nobucket: %d; want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	resp, b := do(t, "POST", s.URL()+"/upload/storage/v1/b/bucket/o?uploadType=media&name=dir/a", "text/plain", "hello", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("media upload: %d %s", resp.StatusCode, b)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj["name"] != "dir/a" || obj["size"] != "5" || obj["crc32c"] == "" {
+		t.Errorf("uploaded object=%v", obj)
+	}
+
+	body := "--xyz\r\nContent-Type: application/json\r\n\r\n{\"name\":\"dir/b\",\"metadata\":{\"k\":\"v\"}}\r\n--xyz\r\nContent-Type: text/plain\r\n\r\nworld\r\n--xyz--\r\n"
+	resp, b = do(t, "POST", s.URL()+"/upload/storage/v1/b/bucket/o?uploadType=multipart", "multipart/related; boundary=xyz", body, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("multipart upload: %d %s", resp.StatusCode, b)
+	}
+
+	resp, b = do(t, "POST", s.URL()+"/upload/storage/v1/b/bucket/o?uploadType=resumable", "application/json", `{"name":"c"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("resumable upload: %d %s", resp.StatusCode, b)
+	}
+	loc := resp.Header.Get("Location")
+	resp, b = do(t, "PUT", loc, "", "ab", map[string]string{"Content-Range": "bytes 0-1/*"})
+	if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Range") != "bytes=0-1" {
+		t.Fatalf("resumable chunk: %d %q %s", resp.StatusCode, resp.Header.Get("Range"), b)
+	}
+	resp, b = do(t, "PUT", loc, "", "c", map[string]string{"Content-Range": "bytes 2-2/*", "X-GUploader-No-308": "yes"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Http-Status-Code-Override") != "308" || resp.Header.Get("Range") != "bytes=0-2" {
+		t.Fatalf("resumable chunk with X-GUploader-No-308: %d %q %q %s", resp.StatusCode, resp.Header.Get("X-Http-Status-Code-Override"), resp.Header.Get("Range"), b)
+	}
+	resp, b = do(t, "PUT", loc, "", "de", map[string]string{"Content-Range": "bytes 3-4/5"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("resumable last chunk: %d %s", resp.StatusCode, b)
+	}
+	if got, ok := s.GetObject("bucket", "c"); !ok || string(got) != "abcde" {
+		t.Errorf("GetObject(bucket, c)=%q, %t; want %q, true", got, ok, "abcde")
+	}
+
+	resp, b = do(t, "GET", s.URL()+"/bucket/dir/b", "", "", nil)
+	if resp.StatusCode != http.StatusOK || string(b) != "world" {
+		t.Errorf("read dir/b: %d %q; want %d %q", resp.StatusCode, b, http.StatusOK, "world")
+	}
+	resp, b = do(t, "GET", s.URL()+"/bucket/dir/a", "", "", map[string]string{"Range": "bytes=1-3"})
+	if resp.StatusCode != http.StatusPartialContent || string(b) != "ell" || resp.Header.Get("Content-Range") != "bytes 1-3/5" {
+		t.Errorf("range read dir/a: %d %q %q", resp.StatusCode, b, resp.Header.Get("Content-Range"))
+	}
+	resp, _ = do(t, "GET", s.URL()+"/bucket/nosuch", "", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("read nosuch: %d; want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	resp, b = do(t, "GET", s.Endpoint()+"b/bucket/o?delimiter=/", "", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: %d %s", resp.StatusCode, b)
+	}
+	var list struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+		Prefixes []string `json:"prefixes"`
+	}
+	if err := json.Unmarshal(b, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Name != "c" || len(list.Prefixes) != 1 || list.Prefixes[0] != "dir/" {
+		t.Errorf("list=%+v; want items [c], prefixes [dir/]", list)
+	}
+
+	resp, b = do(t, "GET", s.Endpoint()+"b/bucket/o/dir%2Fb", "", "", nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Contains(b, []byte(`"k":"v"`)) {
+		t.Errorf("get attrs dir/b: %d %s", resp.StatusCode, b)
+	}
+	resp, b = do(t, "DELETE", s.Endpoint()+"b/bucket/o/dir%2Fb", "", "", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete dir/b: %d %s", resp.StatusCode, b)
+	}
+	if _, ok := s.GetObject("bucket", "dir/b"); ok {
+		t.Errorf("dir/b exists after delete")
+	}
+
+	want := []string{
+		"projects/project/topics/topic OBJECT_FINALIZE dir/a",
+		"projects/project/topics/topic OBJECT_FINALIZE dir/b",
+		"projects/project/topics/topic OBJECT_FINALIZE c",
+		"projects/project/topics/topic OBJECT_DELETE dir/b",
+	}
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+	if strings.Join(pub.msgs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("notifications=%q; want %q", pub.msgs, want)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package fakepubsub provides in-process fake Cloud Pub/Sub server
+// for test.
+//
+// Server can be used as fakegcs.Publisher to deliver storage
+// notifications:
+//
+//	ps := fakepubsub.NewServer(t)
+//	gcs := fakegcs.NewServer(t)
+//	gcs.Publisher = ps
+package fakepubsub
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// Server is a fake Cloud Pub/Sub server.
+type Server struct {
+	*pstest.Server
+	tb testing.TB
+}
+
+// NewServer starts a new fake pubsub server.
+// It is closed when tb finishes.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{
+		Server: pstest.NewServer(),
+		tb:     tb,
+	}
+	tb.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Client returns new pubsub client for project connected to the
+// fake pubsub server.
+// It is closed when tb finishes.
+func (s *Server) Client(ctx context.Context, project string) *pubsub.Client {
+	conn, err := grpc.DialContext(ctx, s.Addr, grpc.WithInsecure())
+	if err != nil {
+		s.tb.Fatal(err)
+	}
+	client, err := pubsub.NewClient(ctx, project, option.WithGRPCConn(conn))
+	if err != nil {
+		conn.Close()
+		s.tb.Fatal(err)
+	}
+	s.tb.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client
+}
+
+// CreateTopic creates topic in project.
+func (s *Server) CreateTopic(ctx context.Context, project, topic string) *pubsub.Topic {
+	t, err := s.Client(ctx, project).CreateTopic(ctx, topic)
+	if err != nil {
+		s.tb.Fatal(err)
+	}
+	return t
+}
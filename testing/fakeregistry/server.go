@@ -0,0 +1,178 @@
+// Copyright 2022 The Goma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package fakeregistry provides in-process fake OCI registry server
+// for test.
+//
+// It serves pull of manifests and blobs in the OCI distribution API,
+// and token auth if credential is required.
+//
+//	s := fakeregistry.NewServer(t)
+//	digest := s.PutManifest("repo", manifest)
+//	client := &registry.Client{HTTPClient: s.Client()}
+package fakeregistry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Server is a fake OCI registry server.
+type Server struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	manifests map[string][]byte // key: repo@digest
+	blobs     map[string][]byte // key: repo@digest
+
+	username, password string
+	token              string
+	requests           []string
+}
+
+// NewServer starts new fake registry server.
+// It will be closed at the end of the test.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	s.srv = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Host returns host:port of the server, used as registry in reference.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.srv.URL, "https://")
+}
+
+// Client returns http client that trusts the server.
+func (s *Server) Client() *http.Client {
+	return s.srv.Client()
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// RequireAuth requires bearer token issued for username and password.
+func (s *Server) RequireAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username = username
+	s.password = password
+	s.token = fmt.Sprintf("token-%x", sha256.Sum256([]byte(username+":"+password)))
+}
+
+// Digest returns digest of data.
+func Digest(data []byte) string {
+	h := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// PutBlob puts blob data in repo, and returns its digest.
+func (s *Server) PutBlob(repo string, data []byte) string {
+	digest := Digest(data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[repo+"@"+digest] = append([]byte(nil), data...)
+	return digest
+}
+
+// PutManifest puts manifest in repo, and returns its digest.
+// manifest is marshaled in JSON unless it is []byte.
+func (s *Server) PutManifest(repo string, manifest interface{}) string {
+	data, ok := manifest.([]byte)
+	if !ok {
+		var err error
+		data, err = json.Marshal(manifest)
+		if err != nil {
+			panic(fmt.Sprintf("marshal manifest: %v", err))
+		}
+	}
+	digest := Digest(data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manifests[repo+"@"+digest] = data
+	return digest
+}
+
+// Requests returns paths of requests the server received.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req.URL.Path)
+	if req.URL.Path == "/token" {
+		s.handleToken(w, req)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if p == req.URL.Path {
+		http.NotFound(w, req)
+		return
+	}
+	var repo string
+	var m map[string][]byte
+	var contentType string
+	if i := strings.LastIndex(p, "/manifests/"); i >= 0 {
+		repo, p = p[:i], p[i+len("/manifests/"):]
+		m = s.manifests
+		contentType = "application/vnd.oci.image.manifest.v1+json"
+	} else if i := strings.LastIndex(p, "/blobs/"); i >= 0 {
+		repo, p = p[:i], p[i+len("/blobs/"):]
+		m = s.blobs
+		contentType = "application/octet-stream"
+	} else {
+		http.NotFound(w, req)
+		return
+	}
+	if s.token != "" && req.Header.Get("Authorization") != "Bearer "+s.token {
+		w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="%s",scope="repository:%s:pull"`, s.srv.URL, s.Host(), repo))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	data, ok := m[repo+"@"+p]
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s@%s not found", repo, p), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Docker-Content-Digest", p)
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	if req.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, req *http.Request) {
+	username, password, ok := req.BasicAuth()
+	if s.token == "" || !ok || username != s.username || password != s.password {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"token": s.token,
+	})
+}